@@ -1,6 +1,9 @@
 package codec
 
-import "errors"
+import (
+    "errors"
+    "fmt"
+)
 
 // Table 31 – Profiles
 // index      profile
@@ -181,17 +184,82 @@ func AACSampleIdxToSample(idx int) int {
     return AAC_Sampling_Idx[idx]
 }
 
-// +--------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------+
-// |  audio object type(5 bits)  |  sampling frequency index(4 bits) |   channel configuration(4 bits)  | GA framelength flag(1 bits) |  GA Depends on core coder(1 bits) | GA Extension Flag(1 bits) |
-// +--------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------+
+// ISO/IEC 14496-3 1.6.2.1 AudioSpecificConfig
+//
+// AudioSpecificConfig() {
+//     audioObjectType = GetAudioObjectType();                            5/11
+//     samplingFrequencyIndex;                                            4
+//     if (samplingFrequencyIndex == 0xf)
+//         samplingFrequency;                                             24
+//     channelConfiguration;                                              4
+//     sbrPresentFlag = -1;
+//     psPresentFlag = -1;
+//     if (audioObjectType == 5 || audioObjectType == 29) {              //显式层级信令
+//         extensionAudioObjectType = 5;
+//         sbrPresentFlag = 1;
+//         if (audioObjectType == 29)
+//             psPresentFlag = 1;
+//         extensionSamplingFrequencyIndex;                               4
+//         if (extensionSamplingFrequencyIndex == 0xf)
+//             extensionSamplingFrequency;                                24
+//         audioObjectType = GetAudioObjectType();
+//         if (audioObjectType == 22)
+//             extensionChannelConfiguration;                             4
+//     }
+//     GASpecificConfig() / ELDSpecificConfig()
+//     epConfig
+//     if (extensionAudioObjectType != 5 && bits_to_decode() >= 16) {    //向后兼容的显式信令
+//         syncExtensionType(0x2b7)                                       11
+//         ......
+//     }
+// }
+
+const (
+    AOT_AAC_MAIN         = 1
+    AOT_AAC_LC           = 2
+    AOT_AAC_SSR          = 3
+    AOT_AAC_LTP          = 4
+    AOT_SBR              = 5
+    AOT_AAC_SCALABLE     = 6
+    AOT_TWINVQ           = 7
+    AOT_ER_AAC_LC        = 17
+    AOT_ER_AAC_LTP       = 19
+    AOT_ER_AAC_SCALABLE  = 20
+    AOT_ER_TWINVQ        = 21
+    AOT_ER_BSAC          = 22
+    AOT_ER_AAC_LD        = 23
+    AOT_PS               = 29
+    AOT_ER_AAC_ELD       = 39
+)
 
 type AudioSpecificConfiguration struct {
-    Audio_object_type        uint8
+    Audio_object_type        uint8  //显式层级信令时为5/29之后的核心object type
     Sample_freq_index        uint8
+    Sampling_frequency       uint32 //Sample_freq_index == 0xF时有效
     Channel_configuration    uint8
     GA_framelength_flag      uint8
     GA_depends_on_core_coder uint8
     GA_extension_flag        uint8
+
+    Hierarchical_object_type           uint8 //显式层级信令时为5(SBR)或29(PS), 否则为0
+    Extension_audio_object_type        uint8 //5(SBR)或22(ER BSAC), 0表示没有扩展
+    Sbr_present_flag                   int8  //-1表示没有显式信令, 可能是隐式信令的SBR
+    Ps_present_flag                    int8
+    Extension_sampling_frequency_index uint8
+    Extension_sampling_frequency       uint32
+    Extension_channel_configuration    uint8
+
+    Core_coder_delay                     uint16
+    Layer_nr                             uint8
+    Num_of_sub_frame                     uint8
+    Layer_length                         uint16
+    Aac_section_data_resilience_flag     uint8
+    Aac_scalefactor_data_resilience_flag uint8
+    Aac_spectral_data_resilience_flag    uint8
+    Extension_flag3                      uint8
+    Pce                                  *ProgramConfigElement //Channel_configuration == 0时有效
+    Eld                                  *ELDSpecificConfig    //Audio_object_type == 39时有效
+    Ep_config                            uint8
 }
 
 func NewAudioSpecificConfiguration() *AudioSpecificConfiguration {
@@ -202,29 +270,662 @@ func NewAudioSpecificConfiguration() *AudioSpecificConfiguration {
         GA_framelength_flag:      0,
         GA_depends_on_core_coder: 0,
         GA_extension_flag:        0,
+        Sbr_present_flag:         -1,
+        Ps_present_flag:          -1,
     }
 }
 
 func (asc *AudioSpecificConfiguration) Encode() []byte {
-    buf := make([]byte, 2)
-    buf[0] = (asc.Audio_object_type & 0x1f << 3) | (asc.Sample_freq_index & 0x0F >> 1)
-    buf[1] = (asc.Sample_freq_index & 0x0F << 7) | (asc.Channel_configuration & 0x0F << 3) | (asc.GA_framelength_flag & 0x01 << 2) | (asc.GA_depends_on_core_coder & 0x01 << 1) | (asc.GA_extension_flag & 0x01)
-    return buf
+    bsw := NewBitStreamWriter(16)
+    asc.encode(bsw, true)
+    return bsw.Bits()
 }
 
+//完整解析失败时(不支持的object type, channel_configuration为0但缺少PCE等)
+//只保留前两个字节中的基本字段, 不返回错误, 需要完整校验时使用DecodeStrict
 func (asc *AudioSpecificConfiguration) Decode(buf []byte) error {
+    if len(buf) < 2 {
+        return errors.New("len of buf < 2 ")
+    }
+    if err := asc.DecodeStrict(buf); err != nil {
+        asc.decodeHeader(buf)
+    }
+    return nil
+}
+
+func (asc *AudioSpecificConfiguration) DecodeStrict(buf []byte) (err error) {
 
     if len(buf) < 2 {
         return errors.New("len of buf < 2 ")
     }
 
+    defer func() {
+        if e := recover(); e != nil {
+            err = fmt.Errorf("decode AudioSpecificConfig failed: %v", e)
+        }
+    }()
+    asc.decode(NewBitStream(buf), true)
+    return nil
+}
+
+func (asc *AudioSpecificConfiguration) decodeHeader(buf []byte) {
+    *asc = AudioSpecificConfiguration{Sbr_present_flag: -1, Ps_present_flag: -1}
     asc.Audio_object_type = buf[0] >> 3
     asc.Sample_freq_index = (buf[0] & 0x07 << 1) | (buf[1] >> 7)
     asc.Channel_configuration = buf[1] >> 3 & 0x0F
     asc.GA_framelength_flag = buf[1] >> 2 & 0x01
     asc.GA_depends_on_core_coder = buf[1] >> 1 & 0x01
     asc.GA_extension_flag = buf[1] & 0x01
-    return nil
+}
+
+//核心编码的采样率
+func (asc *AudioSpecificConfiguration) CoreSampleRate() int {
+    return aacSamplingFrequency(asc.Sample_freq_index, asc.Sampling_frequency)
+}
+
+//解码输出的采样率, 隐式信令的SBR无法从AudioSpecificConfig中得知, 返回的是核心编码的采样率
+func (asc *AudioSpecificConfiguration) SampleRate() int {
+    if asc.Sbr_present_flag == 1 {
+        return aacSamplingFrequency(asc.Extension_sampling_frequency_index, asc.Extension_sampling_frequency)
+    }
+    if asc.Eld != nil && asc.Eld.Ld_sbr_present_flag == 1 && asc.Eld.Ld_sbr_sampling_rate == 1 {
+        return asc.CoreSampleRate() * 2
+    }
+    return asc.CoreSampleRate()
+}
+
+//解码输出的声道数, Channel_configuration为0时由program_config_element决定
+func (asc *AudioSpecificConfiguration) ChannelCount() int {
+    channels := 0
+    switch asc.Channel_configuration {
+    case 0:
+        if asc.Pce != nil {
+            channels = asc.Pce.ChannelCount()
+        }
+    case 1, 2, 3, 4, 5, 6:
+        channels = int(asc.Channel_configuration)
+    case 7, 12, 14:
+        channels = 8
+    case 11:
+        channels = 7
+    case 13:
+        channels = 24
+    }
+    if asc.Ps_present_flag == 1 && channels == 1 {
+        channels = 2
+    }
+    return channels
+}
+
+//syncExtension: 是否解析末尾的向后兼容扩展信令, LATM(audioMuxVersion=0)中不存在
+func (asc *AudioSpecificConfiguration) decode(bs *BitStream, syncExtension bool) {
+    *asc = AudioSpecificConfiguration{Sbr_present_flag: -1, Ps_present_flag: -1}
+    bs.Markdot()
+    asc.Audio_object_type = getAudioObjectType(bs)
+    asc.Sample_freq_index, asc.Sampling_frequency = getSamplingFrequency(bs)
+    asc.Channel_configuration = bs.Uint8(4)
+    if asc.Audio_object_type == AOT_SBR || asc.Audio_object_type == AOT_PS {
+        asc.Hierarchical_object_type = asc.Audio_object_type
+        asc.Extension_audio_object_type = AOT_SBR
+        asc.Sbr_present_flag = 1
+        if asc.Audio_object_type == AOT_PS {
+            asc.Ps_present_flag = 1
+        }
+        asc.Extension_sampling_frequency_index, asc.Extension_sampling_frequency = getSamplingFrequency(bs)
+        asc.Audio_object_type = getAudioObjectType(bs)
+        if asc.Audio_object_type == AOT_ER_BSAC {
+            asc.Extension_channel_configuration = bs.Uint8(4)
+        }
+    }
+
+    switch asc.Audio_object_type {
+    case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+        asc.decodeGASpecificConfig(bs)
+    case AOT_ER_AAC_ELD:
+        asc.Eld = new(ELDSpecificConfig)
+        asc.Eld.decode(bs, asc.Channel_configuration)
+    default:
+        panic(fmt.Errorf("unsupport audio object type %d", asc.Audio_object_type))
+    }
+
+    switch asc.Audio_object_type {
+    case 17, 19, 20, 21, 22, 23, 24, 25, 26, 27, 39:
+        asc.Ep_config = bs.Uint8(2)
+        if asc.Ep_config > 1 {
+            panic(errors.New("unsupport ErrorProtectionSpecificConfig"))
+        }
+    }
+
+    if !syncExtension || asc.Extension_audio_object_type == AOT_SBR || bs.RemainBits() < 16 {
+        return
+    }
+    if bs.NextBits(11) != 0x2B7 {
+        return
+    }
+    bs.SkipBits(11)
+    switch getAudioObjectType(bs) {
+    case AOT_SBR:
+        asc.Extension_audio_object_type = AOT_SBR
+        asc.Sbr_present_flag = int8(bs.GetBit())
+        if asc.Sbr_present_flag == 1 {
+            asc.Extension_sampling_frequency_index, asc.Extension_sampling_frequency = getSamplingFrequency(bs)
+            if bs.RemainBits() >= 12 && bs.NextBits(11) == 0x548 {
+                bs.SkipBits(11)
+                asc.Ps_present_flag = int8(bs.GetBit())
+            }
+        }
+    case AOT_ER_BSAC:
+        asc.Extension_audio_object_type = AOT_ER_BSAC
+        asc.Sbr_present_flag = int8(bs.GetBit())
+        if asc.Sbr_present_flag == 1 {
+            asc.Extension_sampling_frequency_index, asc.Extension_sampling_frequency = getSamplingFrequency(bs)
+        }
+        asc.Extension_channel_configuration = bs.Uint8(4)
+    }
+}
+
+func (asc *AudioSpecificConfiguration) encode(bsw *BitStreamWriter, syncExtension bool) {
+    bsw.Markdot()
+    if asc.Hierarchical_object_type != 0 {
+        putAudioObjectType(bsw, asc.Hierarchical_object_type)
+    } else {
+        putAudioObjectType(bsw, asc.Audio_object_type)
+    }
+    putSamplingFrequency(bsw, asc.Sample_freq_index, asc.Sampling_frequency)
+    bsw.PutUint8(asc.Channel_configuration, 4)
+    if asc.Hierarchical_object_type != 0 {
+        putSamplingFrequency(bsw, asc.Extension_sampling_frequency_index, asc.Extension_sampling_frequency)
+        putAudioObjectType(bsw, asc.Audio_object_type)
+        if asc.Audio_object_type == AOT_ER_BSAC {
+            bsw.PutUint8(asc.Extension_channel_configuration, 4)
+        }
+    }
+
+    switch asc.Audio_object_type {
+    case AOT_ER_AAC_ELD:
+        if asc.Eld != nil {
+            asc.Eld.encode(bsw, asc.Channel_configuration)
+        } else {
+            (&ELDSpecificConfig{}).encode(bsw, asc.Channel_configuration)
+        }
+    default:
+        asc.encodeGASpecificConfig(bsw)
+    }
+
+    switch asc.Audio_object_type {
+    case 17, 19, 20, 21, 22, 23, 24, 25, 26, 27, 39:
+        bsw.PutUint8(asc.Ep_config, 2)
+    }
+
+    if !syncExtension || asc.Hierarchical_object_type != 0 {
+        return
+    }
+    switch asc.Extension_audio_object_type {
+    case AOT_SBR:
+        bsw.PutUint16(0x2B7, 11)
+        putAudioObjectType(bsw, AOT_SBR)
+        if asc.Sbr_present_flag != 1 {
+            bsw.PutUint8(0, 1)
+            return
+        }
+        bsw.PutUint8(1, 1)
+        putSamplingFrequency(bsw, asc.Extension_sampling_frequency_index, asc.Extension_sampling_frequency)
+        if asc.Ps_present_flag >= 0 {
+            bsw.PutUint16(0x548, 11)
+            bsw.PutUint8(uint8(asc.Ps_present_flag), 1)
+        }
+    case AOT_ER_BSAC:
+        bsw.PutUint16(0x2B7, 11)
+        putAudioObjectType(bsw, AOT_ER_BSAC)
+        if asc.Sbr_present_flag == 1 {
+            bsw.PutUint8(1, 1)
+            putSamplingFrequency(bsw, asc.Extension_sampling_frequency_index, asc.Extension_sampling_frequency)
+        } else {
+            bsw.PutUint8(0, 1)
+        }
+        bsw.PutUint8(asc.Extension_channel_configuration, 4)
+    }
+}
+
+// GASpecificConfig(samplingFrequencyIndex, channelConfiguration, audioObjectType) {
+//     frameLengthFlag;                                1
+//     dependsOnCoreCoder;                             1
+//     if (dependsOnCoreCoder)
+//         coreCoderDelay;                             14
+//     extensionFlag;                                  1
+//     if (!channelConfiguration)
+//         program_config_element();
+//     if ((audioObjectType == 6) || (audioObjectType == 20))
+//         layerNr;                                    3
+//     if (extensionFlag) {
+//         if (audioObjectType == 22) {
+//             numOfSubFrame;                          5
+//             layer_length;                           11
+//         }
+//         if (audioObjectType == 17 || audioObjectType == 19 || audioObjectType == 20 || audioObjectType == 23) {
+//             aacSectionDataResilienceFlag;           1
+//             aacScalefactorDataResilienceFlag;       1
+//             aacSpectralDataResilienceFlag;          1
+//         }
+//         extensionFlag3;                             1
+//     }
+// }
+func (asc *AudioSpecificConfiguration) decodeGASpecificConfig(bs *BitStream) {
+    asc.GA_framelength_flag = bs.GetBit()
+    asc.GA_depends_on_core_coder = bs.GetBit()
+    if asc.GA_depends_on_core_coder == 1 {
+        asc.Core_coder_delay = bs.Uint16(14)
+    }
+    asc.GA_extension_flag = bs.GetBit()
+    if asc.Channel_configuration == 0 {
+        asc.Pce = new(ProgramConfigElement)
+        asc.Pce.decode(bs)
+    }
+    if asc.Audio_object_type == AOT_AAC_SCALABLE || asc.Audio_object_type == AOT_ER_AAC_SCALABLE {
+        asc.Layer_nr = bs.Uint8(3)
+    }
+    if asc.GA_extension_flag == 1 {
+        if asc.Audio_object_type == AOT_ER_BSAC {
+            asc.Num_of_sub_frame = bs.Uint8(5)
+            asc.Layer_length = bs.Uint16(11)
+        }
+        switch asc.Audio_object_type {
+        case 17, 19, 20, 23:
+            asc.Aac_section_data_resilience_flag = bs.GetBit()
+            asc.Aac_scalefactor_data_resilience_flag = bs.GetBit()
+            asc.Aac_spectral_data_resilience_flag = bs.GetBit()
+        }
+        asc.Extension_flag3 = bs.GetBit()
+    }
+}
+
+func (asc *AudioSpecificConfiguration) encodeGASpecificConfig(bsw *BitStreamWriter) {
+    bsw.PutUint8(asc.GA_framelength_flag, 1)
+    bsw.PutUint8(asc.GA_depends_on_core_coder, 1)
+    if asc.GA_depends_on_core_coder == 1 {
+        bsw.PutUint16(asc.Core_coder_delay, 14)
+    }
+    bsw.PutUint8(asc.GA_extension_flag, 1)
+    if asc.Channel_configuration == 0 {
+        if asc.Pce != nil {
+            asc.Pce.encode(bsw)
+        } else {
+            (&ProgramConfigElement{}).encode(bsw)
+        }
+    }
+    if asc.Audio_object_type == AOT_AAC_SCALABLE || asc.Audio_object_type == AOT_ER_AAC_SCALABLE {
+        bsw.PutUint8(asc.Layer_nr, 3)
+    }
+    if asc.GA_extension_flag == 1 {
+        if asc.Audio_object_type == AOT_ER_BSAC {
+            bsw.PutUint8(asc.Num_of_sub_frame, 5)
+            bsw.PutUint16(asc.Layer_length, 11)
+        }
+        switch asc.Audio_object_type {
+        case 17, 19, 20, 23:
+            bsw.PutUint8(asc.Aac_section_data_resilience_flag, 1)
+            bsw.PutUint8(asc.Aac_scalefactor_data_resilience_flag, 1)
+            bsw.PutUint8(asc.Aac_spectral_data_resilience_flag, 1)
+        }
+        bsw.PutUint8(asc.Extension_flag3, 1)
+    }
+}
+
+type PCEChannelElement struct {
+    Is_cpe     uint8 //cc element中为cc_element_is_ind_sw
+    Tag_select uint8
+}
+
+// Table 4.2 – Syntax of program_config_element()
+type ProgramConfigElement struct {
+    Element_instance_tag        uint8
+    Object_type                 uint8
+    Sampling_frequency_index    uint8
+    Mono_mixdown_present        uint8
+    Mono_mixdown_element_number uint8
+    Stereo_mixdown_present      uint8
+    Stereo_mixdown_element_number uint8
+    Matrix_mixdown_idx_present  uint8
+    Matrix_mixdown_idx          uint8
+    Pseudo_surround_enable      uint8
+    Front_elements              []PCEChannelElement
+    Side_elements               []PCEChannelElement
+    Back_elements               []PCEChannelElement
+    Lfe_element_tag_select      []uint8
+    Assoc_data_element_tag_select []uint8
+    Cc_elements                 []PCEChannelElement
+    Comment_field_data          []byte
+}
+
+func (pce *ProgramConfigElement) ChannelCount() int {
+    channels := len(pce.Lfe_element_tag_select)
+    for _, elements := range [][]PCEChannelElement{pce.Front_elements, pce.Side_elements, pce.Back_elements} {
+        for _, e := range elements {
+            channels += 1 + int(e.Is_cpe)
+        }
+    }
+    return channels
+}
+
+//byte_alignment()相对于AudioSpecificConfig的起始位置, 调用前需要在AudioSpecificConfig的起始位置Markdot
+func (pce *ProgramConfigElement) decode(bs *BitStream) {
+    pce.Element_instance_tag = bs.Uint8(4)
+    pce.Object_type = bs.Uint8(2)
+    pce.Sampling_frequency_index = bs.Uint8(4)
+    pce.Front_elements = make([]PCEChannelElement, bs.Uint8(4))
+    pce.Side_elements = make([]PCEChannelElement, bs.Uint8(4))
+    pce.Back_elements = make([]PCEChannelElement, bs.Uint8(4))
+    pce.Lfe_element_tag_select = make([]uint8, bs.Uint8(2))
+    pce.Assoc_data_element_tag_select = make([]uint8, bs.Uint8(3))
+    pce.Cc_elements = make([]PCEChannelElement, bs.Uint8(4))
+    pce.Mono_mixdown_present = bs.GetBit()
+    if pce.Mono_mixdown_present == 1 {
+        pce.Mono_mixdown_element_number = bs.Uint8(4)
+    }
+    pce.Stereo_mixdown_present = bs.GetBit()
+    if pce.Stereo_mixdown_present == 1 {
+        pce.Stereo_mixdown_element_number = bs.Uint8(4)
+    }
+    pce.Matrix_mixdown_idx_present = bs.GetBit()
+    if pce.Matrix_mixdown_idx_present == 1 {
+        pce.Matrix_mixdown_idx = bs.Uint8(2)
+        pce.Pseudo_surround_enable = bs.GetBit()
+    }
+    for _, elements := range [][]PCEChannelElement{pce.Front_elements, pce.Side_elements, pce.Back_elements} {
+        for i := range elements {
+            elements[i].Is_cpe = bs.GetBit()
+            elements[i].Tag_select = bs.Uint8(4)
+        }
+    }
+    for i := range pce.Lfe_element_tag_select {
+        pce.Lfe_element_tag_select[i] = bs.Uint8(4)
+    }
+    for i := range pce.Assoc_data_element_tag_select {
+        pce.Assoc_data_element_tag_select[i] = bs.Uint8(4)
+    }
+    for i := range pce.Cc_elements {
+        pce.Cc_elements[i].Is_cpe = bs.GetBit()
+        pce.Cc_elements[i].Tag_select = bs.Uint8(4)
+    }
+    if pad := bs.DistanceFromMarkDot() % 8; pad > 0 {
+        bs.SkipBits(8 - pad)
+    }
+    pce.Comment_field_data = make([]byte, bs.Uint8(8))
+    for i := range pce.Comment_field_data {
+        pce.Comment_field_data[i] = bs.Uint8(8)
+    }
+}
+
+func (pce *ProgramConfigElement) encode(bsw *BitStreamWriter) {
+    bsw.PutUint8(pce.Element_instance_tag, 4)
+    bsw.PutUint8(pce.Object_type, 2)
+    bsw.PutUint8(pce.Sampling_frequency_index, 4)
+    bsw.PutUint8(uint8(len(pce.Front_elements)), 4)
+    bsw.PutUint8(uint8(len(pce.Side_elements)), 4)
+    bsw.PutUint8(uint8(len(pce.Back_elements)), 4)
+    bsw.PutUint8(uint8(len(pce.Lfe_element_tag_select)), 2)
+    bsw.PutUint8(uint8(len(pce.Assoc_data_element_tag_select)), 3)
+    bsw.PutUint8(uint8(len(pce.Cc_elements)), 4)
+    bsw.PutUint8(pce.Mono_mixdown_present, 1)
+    if pce.Mono_mixdown_present == 1 {
+        bsw.PutUint8(pce.Mono_mixdown_element_number, 4)
+    }
+    bsw.PutUint8(pce.Stereo_mixdown_present, 1)
+    if pce.Stereo_mixdown_present == 1 {
+        bsw.PutUint8(pce.Stereo_mixdown_element_number, 4)
+    }
+    bsw.PutUint8(pce.Matrix_mixdown_idx_present, 1)
+    if pce.Matrix_mixdown_idx_present == 1 {
+        bsw.PutUint8(pce.Matrix_mixdown_idx, 2)
+        bsw.PutUint8(pce.Pseudo_surround_enable, 1)
+    }
+    for _, elements := range [][]PCEChannelElement{pce.Front_elements, pce.Side_elements, pce.Back_elements} {
+        for _, e := range elements {
+            bsw.PutUint8(e.Is_cpe, 1)
+            bsw.PutUint8(e.Tag_select, 4)
+        }
+    }
+    for _, tag := range pce.Lfe_element_tag_select {
+        bsw.PutUint8(tag, 4)
+    }
+    for _, tag := range pce.Assoc_data_element_tag_select {
+        bsw.PutUint8(tag, 4)
+    }
+    for _, e := range pce.Cc_elements {
+        bsw.PutUint8(e.Is_cpe, 1)
+        bsw.PutUint8(e.Tag_select, 4)
+    }
+    if pad := bsw.DistanceFromMarkDot() % 8; pad > 0 {
+        bsw.PutUint8(0, 8-pad)
+    }
+    bsw.PutUint8(uint8(len(pce.Comment_field_data)), 8)
+    for _, c := range pce.Comment_field_data {
+        bsw.PutUint8(c, 8)
+    }
+}
+
+// Table 4.180 – Syntax of sbr_header()
+type SBRHeader struct {
+    Bs_amp_res        uint8
+    Bs_start_freq     uint8
+    Bs_stop_freq      uint8
+    Bs_xover_band     uint8
+    Bs_reserved       uint8
+    Bs_header_extra_1 uint8
+    Bs_header_extra_2 uint8
+    Bs_freq_scale     uint8
+    Bs_alter_scale    uint8
+    Bs_noise_bands    uint8
+    Bs_limiter_bands  uint8
+    Bs_limiter_gains  uint8
+    Bs_interpol_freq  uint8
+    Bs_smoothing_mode uint8
+}
+
+func (hdr *SBRHeader) decode(bs *BitStream) {
+    hdr.Bs_amp_res = bs.GetBit()
+    hdr.Bs_start_freq = bs.Uint8(4)
+    hdr.Bs_stop_freq = bs.Uint8(4)
+    hdr.Bs_xover_band = bs.Uint8(3)
+    hdr.Bs_reserved = bs.Uint8(2)
+    hdr.Bs_header_extra_1 = bs.GetBit()
+    hdr.Bs_header_extra_2 = bs.GetBit()
+    if hdr.Bs_header_extra_1 == 1 {
+        hdr.Bs_freq_scale = bs.Uint8(2)
+        hdr.Bs_alter_scale = bs.GetBit()
+        hdr.Bs_noise_bands = bs.Uint8(2)
+    }
+    if hdr.Bs_header_extra_2 == 1 {
+        hdr.Bs_limiter_bands = bs.Uint8(2)
+        hdr.Bs_limiter_gains = bs.Uint8(2)
+        hdr.Bs_interpol_freq = bs.GetBit()
+        hdr.Bs_smoothing_mode = bs.GetBit()
+    }
+}
+
+func (hdr *SBRHeader) encode(bsw *BitStreamWriter) {
+    bsw.PutUint8(hdr.Bs_amp_res, 1)
+    bsw.PutUint8(hdr.Bs_start_freq, 4)
+    bsw.PutUint8(hdr.Bs_stop_freq, 4)
+    bsw.PutUint8(hdr.Bs_xover_band, 3)
+    bsw.PutUint8(hdr.Bs_reserved, 2)
+    bsw.PutUint8(hdr.Bs_header_extra_1, 1)
+    bsw.PutUint8(hdr.Bs_header_extra_2, 1)
+    if hdr.Bs_header_extra_1 == 1 {
+        bsw.PutUint8(hdr.Bs_freq_scale, 2)
+        bsw.PutUint8(hdr.Bs_alter_scale, 1)
+        bsw.PutUint8(hdr.Bs_noise_bands, 2)
+    }
+    if hdr.Bs_header_extra_2 == 1 {
+        bsw.PutUint8(hdr.Bs_limiter_bands, 2)
+        bsw.PutUint8(hdr.Bs_limiter_gains, 2)
+        bsw.PutUint8(hdr.Bs_interpol_freq, 1)
+        bsw.PutUint8(hdr.Bs_smoothing_mode, 1)
+    }
+}
+
+type ELDExtension struct {
+    Eld_ext_type uint8
+    Other_byte   []byte
+}
+
+// Table 4.3 – Syntax of ELDSpecificConfig()
+type ELDSpecificConfig struct {
+    Frame_length_flag                    uint8
+    Aac_section_data_resilience_flag     uint8
+    Aac_scalefactor_data_resilience_flag uint8
+    Aac_spectral_data_resilience_flag    uint8
+    Ld_sbr_present_flag                  uint8
+    Ld_sbr_sampling_rate                 uint8
+    Ld_sbr_crc_flag                      uint8
+    Ld_sbr_header                        []SBRHeader
+    Eld_ext                              []ELDExtension
+}
+
+//ld_sbr_header()中sbr_header的个数
+func numLdSbrHeader(channelConfiguration uint8) int {
+    switch channelConfiguration {
+    case 1, 2:
+        return 1
+    case 3:
+        return 2
+    case 4, 5, 6:
+        return 3
+    case 7:
+        return 4
+    }
+    return 0
+}
+
+func (eld *ELDSpecificConfig) decode(bs *BitStream, channelConfiguration uint8) {
+    eld.Frame_length_flag = bs.GetBit()
+    eld.Aac_section_data_resilience_flag = bs.GetBit()
+    eld.Aac_scalefactor_data_resilience_flag = bs.GetBit()
+    eld.Aac_spectral_data_resilience_flag = bs.GetBit()
+    eld.Ld_sbr_present_flag = bs.GetBit()
+    if eld.Ld_sbr_present_flag == 1 {
+        eld.Ld_sbr_sampling_rate = bs.GetBit()
+        eld.Ld_sbr_crc_flag = bs.GetBit()
+        eld.Ld_sbr_header = make([]SBRHeader, numLdSbrHeader(channelConfiguration))
+        for i := range eld.Ld_sbr_header {
+            eld.Ld_sbr_header[i].decode(bs)
+        }
+    }
+    //ELDEXT_TERM
+    for extType := bs.Uint8(4); extType != 0; extType = bs.Uint8(4) {
+        length := int(bs.Uint8(4))
+        if length == 15 {
+            add := int(bs.Uint8(8))
+            length += add
+            if add == 255 {
+                length += int(bs.Uint16(16))
+            }
+        }
+        ext := ELDExtension{Eld_ext_type: extType, Other_byte: make([]byte, length)}
+        for i := range ext.Other_byte {
+            ext.Other_byte[i] = bs.Uint8(8)
+        }
+        eld.Eld_ext = append(eld.Eld_ext, ext)
+    }
+}
+
+func (eld *ELDSpecificConfig) encode(bsw *BitStreamWriter, channelConfiguration uint8) {
+    bsw.PutUint8(eld.Frame_length_flag, 1)
+    bsw.PutUint8(eld.Aac_section_data_resilience_flag, 1)
+    bsw.PutUint8(eld.Aac_scalefactor_data_resilience_flag, 1)
+    bsw.PutUint8(eld.Aac_spectral_data_resilience_flag, 1)
+    bsw.PutUint8(eld.Ld_sbr_present_flag, 1)
+    if eld.Ld_sbr_present_flag == 1 {
+        bsw.PutUint8(eld.Ld_sbr_sampling_rate, 1)
+        bsw.PutUint8(eld.Ld_sbr_crc_flag, 1)
+        for i := 0; i < numLdSbrHeader(channelConfiguration); i++ {
+            if i < len(eld.Ld_sbr_header) {
+                eld.Ld_sbr_header[i].encode(bsw)
+            } else {
+                (&SBRHeader{}).encode(bsw)
+            }
+        }
+    }
+    for _, ext := range eld.Eld_ext {
+        if ext.Eld_ext_type == 0 {
+            continue
+        }
+        bsw.PutUint8(ext.Eld_ext_type, 4)
+        length := len(ext.Other_byte)
+        if length < 15 {
+            bsw.PutUint8(uint8(length), 4)
+        } else if length < 15+255 {
+            bsw.PutUint8(15, 4)
+            bsw.PutUint8(uint8(length-15), 8)
+        } else {
+            bsw.PutUint8(15, 4)
+            bsw.PutUint8(255, 8)
+            bsw.PutUint16(uint16(length-15-255), 16)
+        }
+        for _, b := range ext.Other_byte {
+            bsw.PutUint8(b, 8)
+        }
+    }
+    bsw.PutUint8(0, 4)
+}
+
+func getAudioObjectType(bs *BitStream) uint8 {
+    aot := bs.Uint8(5)
+    if aot == 31 {
+        aot = 32 + bs.Uint8(6)
+    }
+    return aot
+}
+
+func putAudioObjectType(bsw *BitStreamWriter, aot uint8) {
+    if aot < 31 {
+        bsw.PutUint8(aot, 5)
+    } else {
+        bsw.PutUint8(31, 5)
+        bsw.PutUint8(aot-32, 6)
+    }
+}
+
+func getSamplingFrequency(bs *BitStream) (uint8, uint32) {
+    idx := bs.Uint8(4)
+    if idx == 0x0F {
+        return idx, bs.Uint32(24)
+    }
+    return idx, 0
+}
+
+func putSamplingFrequency(bsw *BitStreamWriter, idx uint8, frequency uint32) {
+    bsw.PutUint8(idx, 4)
+    if idx == 0x0F {
+        bsw.PutUint32(frequency, 24)
+    }
+}
+
+func aacSamplingFrequency(idx uint8, frequency uint32) int {
+    if idx == 0x0F {
+        return int(frequency)
+    }
+    if int(idx) < len(AAC_Sampling_Idx) {
+        return AAC_Sampling_Idx[idx]
+    }
+    return 0
+}
+
+//ADTS不支持显式的采样率, 使用最接近的采样率索引
+func nearestAACSampleIndex(frequency int) uint8 {
+    abs := func(v int) int {
+        if v < 0 {
+            return -v
+        }
+        return v
+    }
+    idx := 0
+    for i, v := range AAC_Sampling_Idx {
+        if abs(v-frequency) < abs(AAC_Sampling_Idx[idx]-frequency) {
+            idx = i
+        }
+    }
+    return uint8(idx)
 }
 
 func ConvertADTSToASC(frame []byte) (*AudioSpecificConfiguration, error) {
@@ -240,6 +941,7 @@ func ConvertADTSToASC(frame []byte) (*AudioSpecificConfiguration, error) {
     return asc, nil
 }
 
+//ADTS中携带的是核心编码的配置, SBR/PS由解码器隐式识别
 func ConvertASCToADTS(asc []byte, aacbytes int) (*ADTS_Frame_Header, error) {
     aac_asc := NewAudioSpecificConfiguration()
     err := aac_asc.Decode(asc)
@@ -248,8 +950,15 @@ func ConvertASCToADTS(asc []byte, aacbytes int) (*ADTS_Frame_Header, error) {
     }
     aac_adts := NewAdtsFrameHeader()
     aac_adts.Fix_Header.Profile = aac_asc.Audio_object_type - 1
-    aac_adts.Fix_Header.Channel_configuration = aac_asc.Channel_configuration
+    //adts的profile只有2bit, 其他object type按AAC LC写入
+    if aac_asc.Audio_object_type < 1 || aac_asc.Audio_object_type > 4 {
+        aac_adts.Fix_Header.Profile = AOT_AAC_LC - 1
+    }
+    aac_adts.Fix_Header.Channel_configuration = aac_asc.Channel_configuration & 0x07
     aac_adts.Fix_Header.Sampling_frequency_index = aac_asc.Sample_freq_index
+    if aac_asc.Sample_freq_index == 0x0F {
+        aac_adts.Fix_Header.Sampling_frequency_index = nearestAACSampleIndex(int(aac_asc.Sampling_frequency))
+    }
     aac_adts.Fix_Header.Protection_absent = 1
     aac_adts.Variable_Header.Adts_buffer_fullness = 0x3F
     aac_adts.Variable_Header.Frame_length = uint16(aacbytes)
@@ -0,0 +1,139 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestAudioSpecificConfiguration_Decode(t *testing.T) {
+	tests := []struct {
+		name       string
+		asc        string
+		aot        uint8
+		sbr        int8
+		ps         int8
+		coreRate   int
+		sampleRate int
+		channels   int
+		wantErr    bool
+	}{
+		{name: "aac lc", asc: "1210", aot: AOT_AAC_LC, sbr: -1, ps: -1, coreRate: 44100, sampleRate: 44100, channels: 2},
+		{name: "he-aac explicit", asc: "2b118800", aot: AOT_AAC_LC, sbr: 1, ps: -1, coreRate: 24000, sampleRate: 48000, channels: 2},
+		{name: "he-aacv2 explicit", asc: "eb098800", aot: AOT_AAC_LC, sbr: 1, ps: 1, coreRate: 24000, sampleRate: 48000, channels: 2},
+		{name: "he-aacv2 backward compatible", asc: "131056e59d4880", aot: AOT_AAC_LC, sbr: 1, ps: 1, coreRate: 24000, sampleRate: 48000, channels: 2},
+		{name: "explicit frequency", asc: "17800fa008", aot: AOT_AAC_LC, sbr: -1, ps: -1, coreRate: 8000, sampleRate: 8000, channels: 1},
+		{name: "program config element", asc: "12000508050001190000", aot: AOT_AAC_LC, sbr: -1, ps: -1, coreRate: 44100, sampleRate: 44100, channels: 6},
+		{name: "aac eld with ld sbr", asc: "f8e621ab2000", aot: AOT_ER_AAC_ELD, sbr: -1, ps: -1, coreRate: 48000, sampleRate: 96000, channels: 1},
+		{name: "truncated", asc: "12", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.asc)
+			asc := NewAudioSpecificConfiguration()
+			err := asc.DecodeStrict(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AudioSpecificConfiguration.DecodeStrict() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if asc.Audio_object_type != tt.aot || asc.Sbr_present_flag != tt.sbr || asc.Ps_present_flag != tt.ps {
+				t.Errorf("aot = %d sbr = %d ps = %d, want %d %d %d", asc.Audio_object_type, asc.Sbr_present_flag, asc.Ps_present_flag, tt.aot, tt.sbr, tt.ps)
+			}
+			if asc.CoreSampleRate() != tt.coreRate || asc.SampleRate() != tt.sampleRate || asc.ChannelCount() != tt.channels {
+				t.Errorf("CoreSampleRate() = %d SampleRate() = %d ChannelCount() = %d, want %d %d %d",
+					asc.CoreSampleRate(), asc.SampleRate(), asc.ChannelCount(), tt.coreRate, tt.sampleRate, tt.channels)
+			}
+			if got := asc.Encode(); !bytes.Equal(got, data) {
+				t.Errorf("AudioSpecificConfiguration.Encode() = %x, want %x", got, data)
+			}
+		})
+	}
+}
+
+func TestAudioSpecificConfiguration_DecodeFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		asc      string
+		aot      uint8
+		freqIdx  uint8
+		channels uint8
+	}{
+		{name: "unsupported aot", asc: "4010", aot: 8, freqIdx: 0, channels: 2},
+		{name: "channel config 0 without pce", asc: "1200", aot: AOT_AAC_LC, freqIdx: 4, channels: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.asc)
+			asc := NewAudioSpecificConfiguration()
+			if err := asc.DecodeStrict(data); err == nil {
+				t.Fatalf("AudioSpecificConfiguration.DecodeStrict() error = nil, want error")
+			}
+			if err := asc.Decode(data); err != nil {
+				t.Fatalf("AudioSpecificConfiguration.Decode() error = %v", err)
+			}
+			if asc.Audio_object_type != tt.aot || asc.Sample_freq_index != tt.freqIdx || asc.Channel_configuration != tt.channels {
+				t.Errorf("aot = %d freq index = %d channels = %d, want %d %d %d",
+					asc.Audio_object_type, asc.Sample_freq_index, asc.Channel_configuration, tt.aot, tt.freqIdx, tt.channels)
+			}
+			if asc.Sbr_present_flag != -1 || asc.Ps_present_flag != -1 {
+				t.Errorf("sbr = %d ps = %d, want -1 -1", asc.Sbr_present_flag, asc.Ps_present_flag)
+			}
+		})
+	}
+}
+
+func TestAudioSpecificConfiguration_Encode(t *testing.T) {
+	asc := NewAudioSpecificConfiguration()
+	asc.Audio_object_type = AOT_AAC_LC
+	asc.Sample_freq_index = 3
+	asc.Channel_configuration = 2
+	if got := asc.Encode(); !bytes.Equal(got, []byte{0x11, 0x90}) {
+		t.Errorf("AudioSpecificConfiguration.Encode() = %x, want 1190", got)
+	}
+
+	eld := NewAudioSpecificConfiguration()
+	eld.Audio_object_type = AOT_ER_AAC_ELD
+	eld.Sample_freq_index = 3
+	eld.Channel_configuration = 2
+	eld.Eld = &ELDSpecificConfig{Eld_ext: []ELDExtension{{Eld_ext_type: 1, Other_byte: bytes.Repeat([]byte{0xAB}, 300)}}}
+	got := NewAudioSpecificConfiguration()
+	if err := got.Decode(eld.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Eld.Eld_ext) != 1 || !bytes.Equal(got.Eld.Eld_ext[0].Other_byte, eld.Eld.Eld_ext[0].Other_byte) {
+		t.Errorf("ELDSpecificConfig extension round trip failed: %+v", got.Eld.Eld_ext)
+	}
+}
+
+func TestConvertASCToADTS(t *testing.T) {
+	tests := []struct {
+		name    string
+		asc     string
+		want    string
+		wantErr bool
+	}{
+		{name: "aac lc", asc: "1210", want: "fff150800207fc"},
+		{name: "he-aac explicit", asc: "2b118800", want: "fff158800207fc"},
+		{name: "explicit frequency", asc: "17800fa008", want: "fff16c400207fc"},
+		{name: "aac eld", asc: "f8e621ab2000", want: "fff14c400207fc"},
+		{name: "channel config 0 without pce", asc: "1200", want: "fff150000207fc"},
+		{name: "truncated", asc: "12", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asc, _ := hex.DecodeString(tt.asc)
+			adts, err := ConvertASCToADTS(asc, 16)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConvertASCToADTS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := hex.EncodeToString(adts.Encode()); got != tt.want {
+				t.Errorf("ConvertASCToADTS() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,690 @@
+package codec
+
+import (
+	"errors"
+)
+
+// AV1 Bitstream & Decoding Process Specification
+// https://aomediacodec.github.io/av1-spec/av1-spec.pdf
+
+type AV1_OBU_TYPE int
+
+const (
+	AV1_OBU_RESERVED AV1_OBU_TYPE = iota
+	AV1_OBU_SEQUENCE_HEADER
+	AV1_OBU_TEMPORAL_DELIMITER
+	AV1_OBU_FRAME_HEADER
+	AV1_OBU_TILE_GROUP
+	AV1_OBU_METADATA
+	AV1_OBU_FRAME
+	AV1_OBU_REDUNDANT_FRAME_HEADER
+	AV1_OBU_TILE_LIST
+	AV1_OBU_PADDING AV1_OBU_TYPE = 15
+)
+
+type AV1_FRAME_TYPE int
+
+const (
+	AV1_KEY_FRAME AV1_FRAME_TYPE = iota
+	AV1_INTER_FRAME
+	AV1_INTRA_ONLY_FRAME
+	AV1_SWITCH_FRAME
+)
+
+// obu_header() {
+//     obu_forbidden_bit        f(1)
+//     obu_type                 f(4)
+//     obu_extension_flag       f(1)
+//     obu_has_size_field       f(1)
+//     obu_reserved_1bit        f(1)
+//     if ( obu_extension_flag == 1 )
+//         obu_extension_header()
+// }
+// obu_extension_header() {
+//     temporal_id                          f(3)
+//     spatial_id                           f(2)
+//     extension_header_reserved_3bits      f(3)
+// }
+
+type AV1ObuHeader struct {
+	Obu_forbidden_bit  uint8
+	Obu_type           uint8
+	Obu_extension_flag uint8
+	Obu_has_size_field uint8
+	Obu_reserved_1bit  uint8
+	Temporal_id        uint8
+	Spatial_id         uint8
+}
+
+func (hdr *AV1ObuHeader) Decode(bs *BitStream) {
+	hdr.Obu_forbidden_bit = bs.GetBit()
+	hdr.Obu_type = bs.Uint8(4)
+	hdr.Obu_extension_flag = bs.GetBit()
+	hdr.Obu_has_size_field = bs.GetBit()
+	hdr.Obu_reserved_1bit = bs.GetBit()
+	if hdr.Obu_extension_flag == 1 {
+		hdr.Temporal_id = bs.Uint8(3)
+		hdr.Spatial_id = bs.Uint8(2)
+		bs.SkipBits(3)
+	}
+}
+
+func (hdr *AV1ObuHeader) Encode(bsw *BitStreamWriter) {
+	bsw.PutUint8(0, 1)
+	bsw.PutUint8(hdr.Obu_type, 4)
+	bsw.PutUint8(hdr.Obu_extension_flag, 1)
+	bsw.PutUint8(hdr.Obu_has_size_field, 1)
+	bsw.PutUint8(0, 1)
+	if hdr.Obu_extension_flag == 1 {
+		bsw.PutUint8(hdr.Temporal_id, 3)
+		bsw.PutUint8(hdr.Spatial_id, 2)
+		bsw.PutUint8(0, 3)
+	}
+}
+
+func (hdr *AV1ObuHeader) Size() int {
+	if hdr.Obu_extension_flag == 1 {
+		return 2
+	}
+	return 1
+}
+
+// 解析前检查长度, obu_extension_flag为1时obu_header占2个字节
+func decodeAV1ObuHeader(obu []byte) (hdr AV1ObuHeader, err error) {
+	if len(obu) < 1 || (obu[0]&0x04 != 0 && len(obu) < 2) {
+		return hdr, errors.New("incomplete av1 obu header")
+	}
+	hdr.Decode(NewBitStream(obu))
+	return hdr, nil
+}
+
+// leb128() {
+//     value = 0
+//     Leb128Bytes = 0
+//     for ( i = 0; i < 8; i++ ) {
+//         leb128_byte                      f(8)
+//         value |= ( (leb128_byte & 0x7f) << (i*7) )
+//         Leb128Bytes += 1
+//         if ( !(leb128_byte & 0x80) ) {
+//             break
+//         }
+//     }
+//     return value
+// }
+
+func ReadLeb128(data []byte) (value uint64, n int, err error) {
+	for i := 0; i < 8; i++ {
+		if i >= len(data) {
+			return 0, 0, errors.New("leb128 out of range")
+		}
+		value |= uint64(data[i]&0x7f) << (i * 7)
+		n++
+		if data[i]&0x80 == 0 {
+			return value, n, nil
+		}
+	}
+	return value, n, nil
+}
+
+func WriteLeb128(value uint64) []byte {
+	leb128 := make([]byte, 0, 8)
+	for {
+		b := byte(value & 0x7f)
+		value >>= 7
+		if value != 0 {
+			b |= 0x80
+		}
+		leb128 = append(leb128, b)
+		if value == 0 {
+			break
+		}
+	}
+	return leb128
+}
+
+// SplitAV1OBU split a temporal unit in Low Overhead Bitstream Format,every obu must has obu_size field
+// except the last one
+func SplitAV1OBU(frames []byte, onObu func(obu []byte) bool) error {
+	for len(frames) > 0 {
+		hdr, err := decodeAV1ObuHeader(frames)
+		if err != nil {
+			return err
+		}
+		hdrSize := hdr.Size()
+		obuSize := len(frames)
+		if hdr.Obu_has_size_field == 1 {
+			payloadSize, n, err := ReadLeb128(frames[hdrSize:])
+			if err != nil {
+				return err
+			}
+			obuSize = hdrSize + n + int(payloadSize)
+			if obuSize > len(frames) {
+				return errors.New("incomplete av1 obu")
+			}
+		}
+		if onObu != nil && !onObu(frames[:obuSize]) {
+			break
+		}
+		frames = frames[obuSize:]
+	}
+	return nil
+}
+
+func AV1ObuType(obu []byte) AV1_OBU_TYPE {
+	return AV1_OBU_TYPE((obu[0] >> 3) & 0x0F)
+}
+
+// AV1ObuPayload return obu_header size and payload of obu, payload is nil if obu is incomplete
+func AV1ObuPayload(obu []byte) (int, []byte) {
+	hdr, err := decodeAV1ObuHeader(obu)
+	if err != nil {
+		return len(obu), nil
+	}
+	offset := hdr.Size()
+	if hdr.Obu_has_size_field == 1 {
+		size, n, err := ReadLeb128(obu[offset:])
+		if err != nil || offset+n+int(size) > len(obu) {
+			return offset, nil
+		}
+		return offset + n, obu[offset+n : offset+n+int(size)]
+	}
+	return offset, obu[offset:]
+}
+
+// ConvertAV1ObuToSizedObu 给obu加上obu_size字段,mp4/flv 中的obu都需要带有obu_size
+func ConvertAV1ObuToSizedObu(obu []byte) []byte {
+	hdr, err := decodeAV1ObuHeader(obu)
+	if err != nil || hdr.Obu_has_size_field == 1 {
+		return obu
+	}
+	payload := obu[hdr.Size():]
+	hdr.Obu_has_size_field = 1
+	bsw := NewBitStreamWriter(hdr.Size() + 8 + len(payload))
+	hdr.Encode(bsw)
+	bsw.PutBytes(WriteLeb128(uint64(len(payload))))
+	bsw.PutBytes(payload)
+	return bsw.Bits()
+}
+
+// timing_info( ) {
+//     num_units_in_display_tick           f(32)
+//     time_scale                          f(32)
+//     equal_picture_interval              f(1)
+//     if ( equal_picture_interval )
+//         num_ticks_per_picture_minus_1   uvlc()
+// }
+
+type AV1TimingInfo struct {
+	Num_units_in_display_tick     uint32
+	Time_scale                    uint32
+	Equal_picture_interval        uint8
+	Num_ticks_per_picture_minus_1 uint32
+}
+
+// decoder_model_info( ) {
+//     buffer_delay_length_minus_1             f(5)
+//     num_units_in_decoding_tick              f(32)
+//     buffer_removal_time_length_minus_1      f(5)
+//     frame_presentation_time_length_minus_1  f(5)
+// }
+
+type AV1DecoderModelInfo struct {
+	Buffer_delay_length_minus_1            uint8
+	Num_units_in_decoding_tick             uint32
+	Buffer_removal_time_length_minus_1     uint8
+	Frame_presentation_time_length_minus_1 uint8
+}
+
+type AV1OperatingPoint struct {
+	Operating_point_idc                       uint16
+	Seq_level_idx                             uint8
+	Seq_tier                                  uint8
+	Decoder_model_present_for_this_op         uint8
+	Decoder_buffer_delay                      uint32
+	Encoder_buffer_delay                      uint32
+	Low_delay_mode_flag                       uint8
+	Initial_display_delay_present_for_this_op uint8
+	Initial_display_delay_minus_1             uint8
+}
+
+type AV1ColorConfig struct {
+	High_bitdepth                  uint8
+	Twelve_bit                     uint8
+	BitDepth                       uint8
+	Mono_chrome                    uint8
+	Color_description_present_flag uint8
+	Color_primaries                uint8
+	Transfer_characteristics       uint8
+	Matrix_coefficients            uint8
+	Color_range                    uint8
+	Subsampling_x                  uint8
+	Subsampling_y                  uint8
+	Chroma_sample_position         uint8
+	Separate_uv_delta_q            uint8
+}
+
+type AV1SequenceHeader struct {
+	Seq_profile                        uint8
+	Still_picture                      uint8
+	Reduced_still_picture_header       uint8
+	Timing_info_present_flag           uint8
+	TimingInfo                         AV1TimingInfo
+	Decoder_model_info_present_flag    uint8
+	DecoderModelInfo                   AV1DecoderModelInfo
+	Initial_display_delay_present_flag uint8
+	Operating_points_cnt_minus_1       uint8
+	OperatingPoints                    []AV1OperatingPoint
+	Frame_width_bits_minus_1           uint8
+	Frame_height_bits_minus_1          uint8
+	Max_frame_width_minus_1            uint32
+	Max_frame_height_minus_1           uint32
+	Frame_id_numbers_present_flag      uint8
+	Delta_frame_id_length_minus_2      uint8
+	Additional_frame_id_length_minus_1 uint8
+	Use_128x128_superblock             uint8
+	Enable_filter_intra                uint8
+	Enable_intra_edge_filter           uint8
+	Enable_interintra_compound         uint8
+	Enable_masked_compound             uint8
+	Enable_warped_motion               uint8
+	Enable_dual_filter                 uint8
+	Enable_order_hint                  uint8
+	Enable_jnt_comp                    uint8
+	Enable_ref_frame_mvs               uint8
+	Seq_choose_screen_content_tools    uint8
+	Seq_force_screen_content_tools     uint8
+	Seq_choose_integer_mv              uint8
+	Seq_force_integer_mv               uint8
+	Order_hint_bits_minus_1            uint8
+	Enable_superres                    uint8
+	Enable_cdef                        uint8
+	Enable_restoration                 uint8
+	ColorConfig                        AV1ColorConfig
+	Film_grain_params_present          uint8
+}
+
+func readUvlc(bs *BitStream) uint32 {
+	leadingZeros := 0
+	for bs.GetBit() == 0 {
+		leadingZeros++
+	}
+	if leadingZeros >= 32 {
+		return 0xFFFFFFFF
+	}
+	if leadingZeros == 0 {
+		return 0
+	}
+	return uint32(bs.GetBits(leadingZeros)) + uint32(1)<<leadingZeros - 1
+}
+
+// Decode sequence_header_obu without obu_header
+func (seq *AV1SequenceHeader) Decode(bs *BitStream) {
+	seq.Seq_profile = bs.Uint8(3)
+	seq.Still_picture = bs.GetBit()
+	seq.Reduced_still_picture_header = bs.GetBit()
+	if seq.Reduced_still_picture_header == 1 {
+		seq.OperatingPoints = make([]AV1OperatingPoint, 1)
+		seq.OperatingPoints[0].Seq_level_idx = bs.Uint8(5)
+	} else {
+		seq.Timing_info_present_flag = bs.GetBit()
+		if seq.Timing_info_present_flag == 1 {
+			seq.TimingInfo.Num_units_in_display_tick = bs.Uint32(32)
+			seq.TimingInfo.Time_scale = bs.Uint32(32)
+			seq.TimingInfo.Equal_picture_interval = bs.GetBit()
+			if seq.TimingInfo.Equal_picture_interval == 1 {
+				seq.TimingInfo.Num_ticks_per_picture_minus_1 = readUvlc(bs)
+			}
+			seq.Decoder_model_info_present_flag = bs.GetBit()
+			if seq.Decoder_model_info_present_flag == 1 {
+				seq.DecoderModelInfo.Buffer_delay_length_minus_1 = bs.Uint8(5)
+				seq.DecoderModelInfo.Num_units_in_decoding_tick = bs.Uint32(32)
+				seq.DecoderModelInfo.Buffer_removal_time_length_minus_1 = bs.Uint8(5)
+				seq.DecoderModelInfo.Frame_presentation_time_length_minus_1 = bs.Uint8(5)
+			}
+		}
+		seq.Initial_display_delay_present_flag = bs.GetBit()
+		seq.Operating_points_cnt_minus_1 = bs.Uint8(5)
+		seq.OperatingPoints = make([]AV1OperatingPoint, seq.Operating_points_cnt_minus_1+1)
+		for i := range seq.OperatingPoints {
+			op := &seq.OperatingPoints[i]
+			op.Operating_point_idc = bs.Uint16(12)
+			op.Seq_level_idx = bs.Uint8(5)
+			if op.Seq_level_idx > 7 {
+				op.Seq_tier = bs.GetBit()
+			}
+			if seq.Decoder_model_info_present_flag == 1 {
+				op.Decoder_model_present_for_this_op = bs.GetBit()
+				if op.Decoder_model_present_for_this_op == 1 {
+					n := int(seq.DecoderModelInfo.Buffer_delay_length_minus_1) + 1
+					op.Decoder_buffer_delay = bs.Uint32(n)
+					op.Encoder_buffer_delay = bs.Uint32(n)
+					op.Low_delay_mode_flag = bs.GetBit()
+				}
+			}
+			if seq.Initial_display_delay_present_flag == 1 {
+				op.Initial_display_delay_present_for_this_op = bs.GetBit()
+				if op.Initial_display_delay_present_for_this_op == 1 {
+					op.Initial_display_delay_minus_1 = bs.Uint8(4)
+				}
+			}
+		}
+	}
+	seq.Frame_width_bits_minus_1 = bs.Uint8(4)
+	seq.Frame_height_bits_minus_1 = bs.Uint8(4)
+	seq.Max_frame_width_minus_1 = bs.Uint32(int(seq.Frame_width_bits_minus_1) + 1)
+	seq.Max_frame_height_minus_1 = bs.Uint32(int(seq.Frame_height_bits_minus_1) + 1)
+	if seq.Reduced_still_picture_header == 0 {
+		seq.Frame_id_numbers_present_flag = bs.GetBit()
+	}
+	if seq.Frame_id_numbers_present_flag == 1 {
+		seq.Delta_frame_id_length_minus_2 = bs.Uint8(4)
+		seq.Additional_frame_id_length_minus_1 = bs.Uint8(3)
+	}
+	seq.Use_128x128_superblock = bs.GetBit()
+	seq.Enable_filter_intra = bs.GetBit()
+	seq.Enable_intra_edge_filter = bs.GetBit()
+	//SELECT_SCREEN_CONTENT_TOOLS = 2, SELECT_INTEGER_MV = 2
+	seq.Seq_force_screen_content_tools = 2
+	seq.Seq_force_integer_mv = 2
+	if seq.Reduced_still_picture_header == 0 {
+		seq.Enable_interintra_compound = bs.GetBit()
+		seq.Enable_masked_compound = bs.GetBit()
+		seq.Enable_warped_motion = bs.GetBit()
+		seq.Enable_dual_filter = bs.GetBit()
+		seq.Enable_order_hint = bs.GetBit()
+		if seq.Enable_order_hint == 1 {
+			seq.Enable_jnt_comp = bs.GetBit()
+			seq.Enable_ref_frame_mvs = bs.GetBit()
+		}
+		seq.Seq_choose_screen_content_tools = bs.GetBit()
+		if seq.Seq_choose_screen_content_tools == 0 {
+			seq.Seq_force_screen_content_tools = bs.GetBit()
+		}
+		if seq.Seq_force_screen_content_tools > 0 {
+			seq.Seq_choose_integer_mv = bs.GetBit()
+			if seq.Seq_choose_integer_mv == 0 {
+				seq.Seq_force_integer_mv = bs.GetBit()
+			}
+		}
+		if seq.Enable_order_hint == 1 {
+			seq.Order_hint_bits_minus_1 = bs.Uint8(3)
+		}
+	}
+	seq.Enable_superres = bs.GetBit()
+	seq.Enable_cdef = bs.GetBit()
+	seq.Enable_restoration = bs.GetBit()
+	seq.ColorConfig.Decode(bs, seq.Seq_profile)
+	seq.Film_grain_params_present = bs.GetBit()
+}
+
+func (cc *AV1ColorConfig) Decode(bs *BitStream, seqProfile uint8) {
+	cc.High_bitdepth = bs.GetBit()
+	cc.BitDepth = 8
+	if seqProfile == 2 && cc.High_bitdepth == 1 {
+		cc.Twelve_bit = bs.GetBit()
+		if cc.Twelve_bit == 1 {
+			cc.BitDepth = 12
+		} else {
+			cc.BitDepth = 10
+		}
+	} else if cc.High_bitdepth == 1 {
+		cc.BitDepth = 10
+	}
+	if seqProfile != 1 {
+		cc.Mono_chrome = bs.GetBit()
+	}
+	cc.Color_description_present_flag = bs.GetBit()
+	if cc.Color_description_present_flag == 1 {
+		cc.Color_primaries = bs.Uint8(8)
+		cc.Transfer_characteristics = bs.Uint8(8)
+		cc.Matrix_coefficients = bs.Uint8(8)
+	} else {
+		//CP_UNSPECIFIED TC_UNSPECIFIED MC_UNSPECIFIED
+		cc.Color_primaries = 2
+		cc.Transfer_characteristics = 2
+		cc.Matrix_coefficients = 2
+	}
+	if cc.Mono_chrome == 1 {
+		cc.Color_range = bs.GetBit()
+		cc.Subsampling_x = 1
+		cc.Subsampling_y = 1
+		return
+	} else if cc.Color_primaries == 1 && cc.Transfer_characteristics == 13 && cc.Matrix_coefficients == 0 {
+		//CP_BT_709 TC_SRGB MC_IDENTITY
+		cc.Color_range = 1
+	} else {
+		cc.Color_range = bs.GetBit()
+		if seqProfile == 0 {
+			cc.Subsampling_x = 1
+			cc.Subsampling_y = 1
+		} else if seqProfile == 2 {
+			if cc.BitDepth == 12 {
+				cc.Subsampling_x = bs.GetBit()
+				if cc.Subsampling_x == 1 {
+					cc.Subsampling_y = bs.GetBit()
+				}
+			} else {
+				cc.Subsampling_x = 1
+			}
+		}
+		if cc.Subsampling_x == 1 && cc.Subsampling_y == 1 {
+			cc.Chroma_sample_position = bs.Uint8(2)
+		}
+	}
+	cc.Separate_uv_delta_q = bs.GetBit()
+}
+
+// DecodeAV1SequenceHeader decode sequence header obu with obu_header
+func DecodeAV1SequenceHeader(obu []byte) (*AV1SequenceHeader, error) {
+	if len(obu) < 2 || AV1ObuType(obu) != AV1_OBU_SEQUENCE_HEADER {
+		return nil, errors.New("not av1 sequence header obu")
+	}
+	_, payload := AV1ObuPayload(obu)
+	if len(payload) == 0 {
+		return nil, errors.New("incomplete av1 sequence header obu")
+	}
+	var err error
+	seq := &AV1SequenceHeader{}
+	func() {
+		defer func() {
+			if e := recover(); e != nil {
+				err = errors.New("decode av1 sequence header failed")
+			}
+		}()
+		seq.Decode(NewBitStream(payload))
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
+
+func GetAV1Resolution(seqHdr []byte) (width uint32, height uint32) {
+	seq, err := DecodeAV1SequenceHeader(seqHdr)
+	if err != nil {
+		return 0, 0
+	}
+	return seq.Max_frame_width_minus_1 + 1, seq.Max_frame_height_minus_1 + 1
+}
+
+// IsAV1KeyFrame 判断temporal unit 中是否存在关键帧
+//
+//	uncompressed_header() {
+//	    if ( reduced_still_picture_header ) {
+//	        ...
+//	        frame_type = KEY_FRAME
+//	    } else {
+//	        show_existing_frame         f(1)
+//	        if ( show_existing_frame == 1 ) {
+//	            ...
+//	            return
+//	        }
+//	        frame_type                  f(2)
+//	    }
+//	}
+func IsAV1KeyFrame(frames []byte) bool {
+	key := false
+	reduced := false
+	SplitAV1OBU(frames, func(obu []byte) bool {
+		switch AV1ObuType(obu) {
+		case AV1_OBU_SEQUENCE_HEADER:
+			if seq, err := DecodeAV1SequenceHeader(obu); err == nil {
+				reduced = seq.Reduced_still_picture_header == 1
+			}
+		case AV1_OBU_FRAME, AV1_OBU_FRAME_HEADER:
+			_, payload := AV1ObuPayload(obu)
+			if reduced {
+				key = true
+			} else if len(payload) > 0 {
+				show_existing_frame := payload[0] >> 7
+				frame_type := (payload[0] >> 5) & 0x03
+				key = show_existing_frame == 0 && AV1_FRAME_TYPE(frame_type) == AV1_KEY_FRAME
+			}
+			return false
+		}
+		return true
+	})
+	return key
+}
+
+// aligned (8) class AV1CodecConfigurationRecord {
+//     unsigned int (1) marker = 1;
+//     unsigned int (7) version = 1;
+//     unsigned int (3) seq_profile;
+//     unsigned int (5) seq_level_idx_0;
+//     unsigned int (1) seq_tier_0;
+//     unsigned int (1) high_bitdepth;
+//     unsigned int (1) twelve_bit;
+//     unsigned int (1) monochrome;
+//     unsigned int (1) chroma_subsampling_x;
+//     unsigned int (1) chroma_subsampling_y;
+//     unsigned int (2) chroma_sample_position;
+//     unsigned int (3) reserved = 0;
+//     unsigned int (1) initial_presentation_delay_present;
+//     if (initial_presentation_delay_present) {
+//         unsigned int (4) initial_presentation_delay_minus_one;
+//     } else {
+//         unsigned int (4) reserved = 0;
+//     }
+//     unsigned int (8) configOBUs[];
+// }
+
+type AV1CodecConfigurationRecord struct {
+	Marker                               uint8
+	Version                              uint8
+	Seq_profile                          uint8
+	Seq_level_idx_0                      uint8
+	Seq_tier_0                           uint8
+	High_bitdepth                        uint8
+	Twelve_bit                           uint8
+	Monochrome                           uint8
+	Chroma_subsampling_x                 uint8
+	Chroma_subsampling_y                 uint8
+	Chroma_sample_position               uint8
+	Initial_presentation_delay_present   uint8
+	Initial_presentation_delay_minus_one uint8
+	ConfigOBUs                           []byte
+}
+
+func NewAV1CodecConfigurationRecord() *AV1CodecConfigurationRecord {
+	return &AV1CodecConfigurationRecord{
+		Marker:  1,
+		Version: 1,
+	}
+}
+
+func (av1c *AV1CodecConfigurationRecord) Encode() []byte {
+	bsw := NewBitStreamWriter(4 + len(av1c.ConfigOBUs))
+	bsw.PutUint8(1, 1)
+	bsw.PutUint8(av1c.Version, 7)
+	bsw.PutUint8(av1c.Seq_profile, 3)
+	bsw.PutUint8(av1c.Seq_level_idx_0, 5)
+	bsw.PutUint8(av1c.Seq_tier_0, 1)
+	bsw.PutUint8(av1c.High_bitdepth, 1)
+	bsw.PutUint8(av1c.Twelve_bit, 1)
+	bsw.PutUint8(av1c.Monochrome, 1)
+	bsw.PutUint8(av1c.Chroma_subsampling_x, 1)
+	bsw.PutUint8(av1c.Chroma_subsampling_y, 1)
+	bsw.PutUint8(av1c.Chroma_sample_position, 2)
+	bsw.PutUint8(0, 3)
+	bsw.PutUint8(av1c.Initial_presentation_delay_present, 1)
+	if av1c.Initial_presentation_delay_present == 1 {
+		bsw.PutUint8(av1c.Initial_presentation_delay_minus_one, 4)
+	} else {
+		bsw.PutUint8(0, 4)
+	}
+	bsw.PutBytes(av1c.ConfigOBUs)
+	return bsw.Bits()
+}
+
+func (av1c *AV1CodecConfigurationRecord) Decode(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("len of av1C < 4")
+	}
+	bs := NewBitStream(data)
+	av1c.Marker = bs.GetBit()
+	av1c.Version = bs.Uint8(7)
+	if av1c.Marker != 1 || av1c.Version != 1 {
+		return errors.New("unsupport av1C version")
+	}
+	av1c.Seq_profile = bs.Uint8(3)
+	av1c.Seq_level_idx_0 = bs.Uint8(5)
+	av1c.Seq_tier_0 = bs.GetBit()
+	av1c.High_bitdepth = bs.GetBit()
+	av1c.Twelve_bit = bs.GetBit()
+	av1c.Monochrome = bs.GetBit()
+	av1c.Chroma_subsampling_x = bs.GetBit()
+	av1c.Chroma_subsampling_y = bs.GetBit()
+	av1c.Chroma_sample_position = bs.Uint8(2)
+	bs.SkipBits(3)
+	av1c.Initial_presentation_delay_present = bs.GetBit()
+	av1c.Initial_presentation_delay_minus_one = bs.Uint8(4)
+	av1c.ConfigOBUs = make([]byte, len(data)-4)
+	copy(av1c.ConfigOBUs, data[4:])
+	return nil
+}
+
+// UpdateSequenceHeader 用sequence header obu 更新av1C
+func (av1c *AV1CodecConfigurationRecord) UpdateSequenceHeader(obu []byte) error {
+	seq, err := DecodeAV1SequenceHeader(obu)
+	if err != nil {
+		return err
+	}
+	av1c.Marker = 1
+	av1c.Version = 1
+	av1c.Seq_profile = seq.Seq_profile
+	av1c.Seq_level_idx_0 = seq.OperatingPoints[0].Seq_level_idx
+	av1c.Seq_tier_0 = seq.OperatingPoints[0].Seq_tier
+	av1c.High_bitdepth = seq.ColorConfig.High_bitdepth
+	av1c.Twelve_bit = seq.ColorConfig.Twelve_bit
+	av1c.Monochrome = seq.ColorConfig.Mono_chrome
+	av1c.Chroma_subsampling_x = seq.ColorConfig.Subsampling_x
+	av1c.Chroma_subsampling_y = seq.ColorConfig.Subsampling_y
+	av1c.Chroma_sample_position = seq.ColorConfig.Chroma_sample_position
+	av1c.Initial_presentation_delay_present = seq.OperatingPoints[0].Initial_display_delay_present_for_this_op
+	av1c.Initial_presentation_delay_minus_one = seq.OperatingPoints[0].Initial_display_delay_minus_1
+
+	//configOBUs 中的obu必须带有obu_size
+	av1c.ConfigOBUs = ConvertAV1ObuToSizedObu(obu)
+	return nil
+}
+
+func (av1c *AV1CodecConfigurationRecord) SequenceHeader() []byte {
+	var seqHdr []byte
+	SplitAV1OBU(av1c.ConfigOBUs, func(obu []byte) bool {
+		if AV1ObuType(obu) == AV1_OBU_SEQUENCE_HEADER {
+			seqHdr = obu
+			return false
+		}
+		return true
+	})
+	return seqHdr
+}
+
+func CreateAV1CodecConfigurationRecord(seqHdr []byte) ([]byte, error) {
+	av1c := NewAV1CodecConfigurationRecord()
+	if err := av1c.UpdateSequenceHeader(seqHdr); err != nil {
+		return nil, err
+	}
+	return av1c.Encode(), nil
+}
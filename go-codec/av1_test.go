@@ -0,0 +1,142 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 1280x720 main profile level 4.0
+var av1SeqHdr = []byte{0x0A, 0x0B, 0x00, 0x00, 0x00, 0x42, 0xA6, 0x7F, 0xD9, 0xE7, 0xFF, 0xCC, 0x02}
+
+func TestGetAV1Resolution(t *testing.T) {
+	type args struct {
+		seqHdr []byte
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantWidth  uint32
+		wantHeight uint32
+	}{
+		{name: "720p", args: args{seqHdr: av1SeqHdr}, wantWidth: 1280, wantHeight: 720},
+		{name: "not seq header", args: args{seqHdr: []byte{0x12, 0x00}}, wantWidth: 0, wantHeight: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotWidth, gotHeight := GetAV1Resolution(tt.args.seqHdr)
+			if gotWidth != tt.wantWidth {
+				t.Errorf("GetAV1Resolution() gotWidth = %v, want %v", gotWidth, tt.wantWidth)
+			}
+			if gotHeight != tt.wantHeight {
+				t.Errorf("GetAV1Resolution() gotHeight = %v, want %v", gotHeight, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestAV1CodecConfigurationRecord(t *testing.T) {
+	tests := []struct {
+		name       string
+		seqHdr     []byte
+		wantLevel  uint8
+		wantCssX   uint8
+		wantCssY   uint8
+		wantHeader []byte
+	}{
+		{name: "720p", seqHdr: av1SeqHdr, wantLevel: 8, wantCssX: 1, wantCssY: 1, wantHeader: []byte{0x81, 0x08, 0x0C, 0x00}},
+		// obu without obu_size field
+		{name: "no size field", seqHdr: append([]byte{0x08}, av1SeqHdr[2:]...), wantLevel: 8, wantCssX: 1, wantCssY: 1, wantHeader: []byte{0x81, 0x08, 0x0C, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := CreateAV1CodecConfigurationRecord(tt.seqHdr)
+			if err != nil {
+				t.Fatalf("CreateAV1CodecConfigurationRecord() error = %v", err)
+			}
+			if !bytes.Equal(data[:4], tt.wantHeader) {
+				t.Errorf("av1C header = %x, want %x", data[:4], tt.wantHeader)
+			}
+			av1c := NewAV1CodecConfigurationRecord()
+			if err := av1c.Decode(data); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if av1c.Seq_level_idx_0 != tt.wantLevel || av1c.Chroma_subsampling_x != tt.wantCssX || av1c.Chroma_subsampling_y != tt.wantCssY {
+				t.Errorf("Decode() got %+v", av1c)
+			}
+			if !bytes.Equal(av1c.SequenceHeader(), av1SeqHdr) {
+				t.Errorf("SequenceHeader() = %x, want %x", av1c.SequenceHeader(), av1SeqHdr)
+			}
+			if !bytes.Equal(av1c.Encode(), data) {
+				t.Errorf("Encode() = %x, want %x", av1c.Encode(), data)
+			}
+		})
+	}
+}
+
+func TestIsAV1KeyFrame(t *testing.T) {
+	td := []byte{0x12, 0x00}
+	tests := []struct {
+		name   string
+		frames []byte
+		want   bool
+	}{
+		{name: "key frame", frames: append(append(append([]byte{}, td...), av1SeqHdr...), 0x32, 0x02, 0x10, 0x00), want: true},
+		{name: "inter frame", frames: append(append([]byte{}, td...), 0x32, 0x02, 0x30, 0x00), want: false},
+		{name: "show existing frame", frames: append(append([]byte{}, td...), 0x1A, 0x01, 0x80), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsAV1KeyFrame(tt.frames); got != tt.want {
+				t.Errorf("IsAV1KeyFrame() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeb128(t *testing.T) {
+	tests := []struct {
+		name  string
+		value uint64
+		want  []byte
+	}{
+		{name: "1 byte", value: 0x7f, want: []byte{0x7f}},
+		{name: "2 bytes", value: 0x80, want: []byte{0x80, 0x01}},
+		{name: "3 bytes", value: 0x12345, want: []byte{0xC5, 0xC6, 0x04}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WriteLeb128(tt.value)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("WriteLeb128() = %x, want %x", got, tt.want)
+			}
+			value, n, err := ReadLeb128(got)
+			if err != nil || value != tt.value || n != len(got) {
+				t.Errorf("ReadLeb128() = %v %v %v, want %v", value, n, err, tt.value)
+			}
+		})
+	}
+}
+
+func TestSplitAV1OBU_Truncated(t *testing.T) {
+	tests := []struct {
+		name string
+		obu  []byte
+	}{
+		{name: "extension header missing", obu: []byte{0x34}},
+		{name: "extension header missing with size", obu: []byte{0x36}},
+		{name: "obu_size missing", obu: []byte{0x32}},
+		{name: "obu_size incomplete", obu: []byte{0x32, 0x80}},
+		{name: "payload incomplete", obu: []byte{0x36, 0x00, 0x05, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SplitAV1OBU(tt.obu, nil); err == nil {
+				t.Errorf("SplitAV1OBU() should fail")
+			}
+			if _, payload := AV1ObuPayload(tt.obu); payload != nil {
+				t.Errorf("AV1ObuPayload() = %x, want nil", payload)
+			}
+			ConvertAV1ObuToSizedObu(tt.obu)
+		})
+	}
+}
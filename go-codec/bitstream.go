@@ -178,6 +178,7 @@ func (bs *BitStream) UnRead(n int) {
         bs.bitsOffset -= n
     } else {
         least := n - bs.bitsOffset
+        bs.bitsOffset = 0
         for least >= 8 {
             bs.bytesOffset--
             least -= 8
@@ -195,6 +196,25 @@ func (bs *BitStream) NextBits(n int) uint64 {
     return r
 }
 
+// 7.2 more_rbsp_data(), 当前位置之后是否还有rbsp_stop_one_bit之前的数据
+func (bs *BitStream) MoreRbspData() bool {
+    last := len(bs.bits) - 1
+    for last >= 0 && bs.bits[last] == 0 {
+        last--
+    }
+    if last < 0 || last < bs.bytesOffset {
+        return false
+    }
+    if last > bs.bytesOffset {
+        return true
+    }
+    stopBit := 7
+    for bs.bits[last]&(1<<uint(7-stopBit)) == 0 {
+        stopBit--
+    }
+    return bs.bitsOffset < stopBit
+}
+
 func (bs *BitStream) EOS() bool {
     return bs.bytesOffset == len(bs.bits) && bs.bitsOffset == 0
 }
@@ -319,6 +339,35 @@ func (bsw *BitStreamWriter) PutUint64(v uint64, n int) {
     }
 }
 
+//无符号哥伦布熵编码
+func (bsw *BitStreamWriter) PutUE(v uint64) {
+    leadingZeroBits := 0
+    for (v+1)>>uint(leadingZeroBits+1) > 0 {
+        leadingZeroBits++
+    }
+    if leadingZeroBits > 0 {
+        bsw.PutUint64(0, leadingZeroBits)
+    }
+    bsw.PutUint64(v+1, leadingZeroBits+1)
+}
+
+//有符号哥伦布熵编码
+func (bsw *BitStreamWriter) PutSE(v int64) {
+    if v > 0 {
+        bsw.PutUE(uint64(v)*2 - 1)
+    } else {
+        bsw.PutUE(uint64(-v) * 2)
+    }
+}
+
+// 7.3.2.11 rbsp_trailing_bits
+func (bsw *BitStreamWriter) PutRbspTrailingBits() {
+    bsw.PutUint8(1, 1)
+    if bsw.bitsoffset > 0 {
+        bsw.PutUint8(0, 8-bsw.bitsoffset)
+    }
+}
+
 func (bsw *BitStreamWriter) SetByte(v byte, where int) {
     bsw.bits[where] = v
 }
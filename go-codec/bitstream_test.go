@@ -139,3 +139,44 @@ func TestBitStream_ReadUE(t *testing.T) {
         })
     }
 }
+
+func TestBitStreamWriter_PutUE_PutSE(t *testing.T) {
+    ues := []uint64{0, 1, 2, 3, 7, 254, 255, 65535, 1<<32 - 1}
+    ses := []int64{0, 1, -1, 2, -2, 127, -128, 1 << 20, -(1 << 20)}
+    bsw := NewBitStreamWriter(4)
+    for i := range ues {
+        bsw.PutUE(ues[i])
+        bsw.PutSE(ses[i])
+    }
+    bsw.PutRbspTrailingBits()
+    if bsw.BitOffset() != 0 {
+        t.Fatalf("PutRbspTrailingBits() bit offset = %d", bsw.BitOffset())
+    }
+    bs := NewBitStream(bsw.Bits())
+    for i := range ues {
+        if got := bs.ReadUE(); got != ues[i] {
+            t.Errorf("ReadUE() = %d, want %d", got, ues[i])
+        }
+        if got := bs.ReadSE(); got != ses[i] {
+            t.Errorf("ReadSE() = %d, want %d", got, ses[i])
+        }
+    }
+    if bs.MoreRbspData() {
+        t.Errorf("MoreRbspData() = true after trailing bits")
+    }
+}
+
+func TestBitStream_NextBits(t *testing.T) {
+    bs := NewBitStream([]byte{0x13, 0x10, 0x56, 0xE5, 0x9D})
+    bs.SkipBits(16)
+    if got := bs.NextBits(11); got != 0x2B7 {
+        t.Fatalf("NextBits(11) = %x, want 2b7", got)
+    }
+    if got := bs.RemainBits(); got != 24 {
+        t.Errorf("RemainBits() after NextBits = %d, want 24", got)
+    }
+    bs.SkipBits(11)
+    if got := bs.GetBits(5); got != 5 {
+        t.Errorf("GetBits(5) = %d, want 5", got)
+    }
+}
@@ -0,0 +1,216 @@
+package codec
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// ITU-T G.711 A-law/μ-law, 查表实现
+// PCM统一为16bit有符号小端(CODECID_AUDIO_LPCM), G.711每个采样点1个字节
+
+var (
+	alawToLinearTable [256]int16
+	ulawToLinearTable [256]int16
+	linearToAlawTable [8192]uint8  //下标为13bit线性值
+	linearToUlawTable [16384]uint8 //下标为14bit线性值
+	alawToUlawTable   [256]uint8
+	ulawToAlawTable   [256]uint8
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		alawToLinearTable[i] = alaw2linear(uint8(i))
+		ulawToLinearTable[i] = ulaw2linear(uint8(i))
+	}
+	for i := range linearToAlawTable {
+		linearToAlawTable[i] = linear2alaw(int16(i << 3))
+	}
+	for i := range linearToUlawTable {
+		linearToUlawTable[i] = linear2ulaw(int16(i << 2))
+	}
+	for i := 0; i < 256; i++ {
+		alawToUlawTable[i] = LinearToULaw(alawToLinearTable[i])
+		ulawToAlawTable[i] = LinearToALaw(ulawToLinearTable[i])
+	}
+}
+
+var alawSegEnd = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+var ulawSegEnd = [8]int{0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF, 0x1FFF}
+
+func searchSeg(val int, table *[8]int) int {
+	for i, end := range table {
+		if val <= end {
+			return i
+		}
+	}
+	return len(table)
+}
+
+func alaw2linear(a uint8) int16 {
+	a ^= 0x55
+	t := int(a&0x0F) << 4
+	seg := int(a&0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= uint(seg - 1)
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+func linear2alaw(pcm int16) uint8 {
+	val := int(pcm) >> 3
+	mask := uint8(0xD5)
+	if val < 0 {
+		mask = 0x55
+		val = -val - 1
+	}
+	seg := searchSeg(val, &alawSegEnd)
+	if seg >= 8 {
+		return 0x7F ^ mask
+	}
+	aval := uint8(seg << 4)
+	if seg < 2 {
+		aval |= uint8(val>>1) & 0x0F
+	} else {
+		aval |= uint8(val>>uint(seg)) & 0x0F
+	}
+	return aval ^ mask
+}
+
+func ulaw2linear(u uint8) int16 {
+	u = ^u
+	t := (int(u&0x0F) << 3) + 0x84
+	t <<= uint(u&0x70) >> 4
+	if u&0x80 != 0 {
+		return int16(0x84 - t)
+	}
+	return int16(t - 0x84)
+}
+
+func linear2ulaw(pcm int16) uint8 {
+	val := int(pcm) >> 2
+	mask := uint8(0xFF)
+	if val < 0 {
+		val = -val
+		mask = 0x7F
+	}
+	if val > 8159 {
+		val = 8159
+	}
+	val += 0x21
+	seg := searchSeg(val, &ulawSegEnd)
+	if seg >= 8 {
+		return 0x7F ^ mask
+	}
+	uval := uint8(seg<<4) | uint8(val>>uint(seg+1))&0x0F
+	return uval ^ mask
+}
+
+func ALawToLinear(a uint8) int16 {
+	return alawToLinearTable[a]
+}
+
+func ULawToLinear(u uint8) int16 {
+	return ulawToLinearTable[u]
+}
+
+func LinearToALaw(pcm int16) uint8 {
+	return linearToAlawTable[uint16(pcm)>>3]
+}
+
+func LinearToULaw(pcm int16) uint8 {
+	return linearToUlawTable[uint16(pcm)>>2]
+}
+
+func ALawToULaw(a uint8) uint8 {
+	return alawToUlawTable[a]
+}
+
+func ULawToALaw(u uint8) uint8 {
+	return ulawToAlawTable[u]
+}
+
+// G.711A 转 16bit小端PCM
+func G711AToPCM(g711 []byte) []byte {
+	pcm := make([]byte, len(g711)*2)
+	for i, a := range g711 {
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(alawToLinearTable[a]))
+	}
+	return pcm
+}
+
+// G.711U 转 16bit小端PCM
+func G711UToPCM(g711 []byte) []byte {
+	pcm := make([]byte, len(g711)*2)
+	for i, u := range g711 {
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(ulawToLinearTable[u]))
+	}
+	return pcm
+}
+
+// 16bit小端PCM 转 G.711A, 末尾不足一个采样点的字节被丢弃
+func PCMToG711A(pcm []byte) []byte {
+	g711 := make([]byte, len(pcm)/2)
+	for i := range g711 {
+		g711[i] = LinearToALaw(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+	}
+	return g711
+}
+
+// 16bit小端PCM 转 G.711U, 末尾不足一个采样点的字节被丢弃
+func PCMToG711U(pcm []byte) []byte {
+	g711 := make([]byte, len(pcm)/2)
+	for i := range g711 {
+		g711[i] = LinearToULaw(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+	}
+	return g711
+}
+
+func G711AToG711U(g711a []byte) []byte {
+	g711u := make([]byte, len(g711a))
+	for i, a := range g711a {
+		g711u[i] = alawToUlawTable[a]
+	}
+	return g711u
+}
+
+func G711UToG711A(g711u []byte) []byte {
+	g711a := make([]byte, len(g711u))
+	for i, u := range g711u {
+		g711a[i] = ulawToAlawTable[u]
+	}
+	return g711a
+}
+
+// G.711帧中每个声道的采样点数
+func G711SampleCount(frameSize int, channelCount int) int {
+	if channelCount <= 0 {
+		channelCount = 1
+	}
+	return frameSize / channelCount
+}
+
+// G.711帧的时长, 例如8000Hz单声道160字节为20ms
+func G711FrameDuration(frameSize int, sampleRate int, channelCount int) time.Duration {
+	return LPCMFrameDuration(frameSize, sampleRate, channelCount, 8)
+}
+
+// 线性PCM帧的时长
+func LPCMFrameDuration(frameSize int, sampleRate int, channelCount int, sampleBits int) time.Duration {
+	if sampleRate <= 0 || sampleBits <= 0 {
+		return 0
+	}
+	if channelCount <= 0 {
+		channelCount = 1
+	}
+	samples := int64(frameSize) * 8 / int64(sampleBits*channelCount)
+	return time.Duration(samples * int64(time.Second) / int64(sampleRate))
+}
@@ -0,0 +1,88 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestG711_Linear(t *testing.T) {
+	tests := []struct {
+		name string
+		law  func(uint8) int16
+		code uint8
+		want int16
+	}{
+		{name: "alaw +8", law: ALawToLinear, code: 0xD5, want: 8},
+		{name: "alaw -8", law: ALawToLinear, code: 0x55, want: -8},
+		{name: "alaw max", law: ALawToLinear, code: 0xAA, want: 32256},
+		{name: "alaw min", law: ALawToLinear, code: 0x2A, want: -32256},
+		{name: "ulaw +0", law: ULawToLinear, code: 0xFF, want: 0},
+		{name: "ulaw -0", law: ULawToLinear, code: 0x7F, want: 0},
+		{name: "ulaw max", law: ULawToLinear, code: 0x80, want: 32124},
+		{name: "ulaw min", law: ULawToLinear, code: 0x00, want: -32124},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.law(tt.code); got != tt.want {
+				t.Errorf("%02x => %d, want %d", tt.code, got, tt.want)
+			}
+		})
+	}
+	if LinearToALaw(0) != 0xD5 || LinearToULaw(0) != 0xFF {
+		t.Errorf("LinearToALaw(0) = %02x LinearToULaw(0) = %02x", LinearToALaw(0), LinearToULaw(0))
+	}
+	if LinearToALaw(32767) != 0xAA || LinearToULaw(-32768) != 0x00 {
+		t.Errorf("LinearToALaw(32767) = %02x LinearToULaw(-32768) = %02x", LinearToALaw(32767), LinearToULaw(-32768))
+	}
+	for i := 0; i < 256; i++ {
+		if got := LinearToALaw(ALawToLinear(uint8(i))); got != uint8(i) {
+			t.Errorf("alaw %02x round trip = %02x", i, got)
+		}
+		if i == 0x7F {
+			continue
+		}
+		if got := LinearToULaw(ULawToLinear(uint8(i))); got != uint8(i) {
+			t.Errorf("ulaw %02x round trip = %02x", i, got)
+		}
+	}
+}
+
+func TestG711_Transcode(t *testing.T) {
+	pcm := []byte{0x00, 0x00, 0x10, 0x00, 0xF0, 0xFF, 0xFF, 0x7F, 0x00, 0x80, 0x34, 0x12}
+	g711a := PCMToG711A(pcm)
+	g711u := PCMToG711U(pcm)
+	if len(g711a) != 6 || len(g711u) != 6 {
+		t.Fatalf("len(g711a) = %d len(g711u) = %d, want 6", len(g711a), len(g711u))
+	}
+	if !bytes.Equal(G711AToPCM(g711a), G711AToPCM(PCMToG711A(G711AToPCM(g711a)))) {
+		t.Errorf("G711AToPCM is not stable")
+	}
+	if !bytes.Equal(G711UToG711A(G711AToG711U(g711a)), g711a) {
+		t.Errorf("G711UToG711A(G711AToG711U(%x)) = %x", g711a, G711UToG711A(G711AToG711U(g711a)))
+	}
+	for i, u := range G711AToG711U(g711a) {
+		diff := int(ULawToLinear(u)) - int(ALawToLinear(g711a[i]))
+		if diff < -1024 || diff > 1024 {
+			t.Errorf("sample %d alaw %d ulaw %d", i, ALawToLinear(g711a[i]), ULawToLinear(u))
+		}
+	}
+}
+
+func TestG711_FrameDuration(t *testing.T) {
+	if got := G711FrameDuration(160, 8000, 1); got != 20*time.Millisecond {
+		t.Errorf("G711FrameDuration(160, 8000, 1) = %v", got)
+	}
+	if got := G711FrameDuration(320, 8000, 2); got != 20*time.Millisecond {
+		t.Errorf("G711FrameDuration(320, 8000, 2) = %v", got)
+	}
+	if got := G711SampleCount(320, 2); got != 160 {
+		t.Errorf("G711SampleCount(320, 2) = %d", got)
+	}
+	if got := LPCMFrameDuration(3840, 48000, 2, 16); got != 20*time.Millisecond {
+		t.Errorf("LPCMFrameDuration(3840, 48000, 2, 16) = %v", got)
+	}
+	if got := LPCMFrameDuration(100, 0, 1, 16); got != 0 {
+		t.Errorf("LPCMFrameDuration with zero sample rate = %v", got)
+	}
+}
@@ -11,6 +11,15 @@ import (
 //     nal_unit_type                u(5)
 // }
 
+// slice_type % 5
+const (
+	H264_SLICE_P  = 0
+	H264_SLICE_B  = 1
+	H264_SLICE_I  = 2
+	H264_SLICE_SP = 3
+	H264_SLICE_SI = 4
+)
+
 type H264NaluHdr struct {
 	Forbidden_zero_bit uint8
 	Nal_ref_idc        uint8
@@ -23,11 +32,53 @@ func (hdr *H264NaluHdr) Decode(bs *BitStream) {
 	hdr.Nal_unit_type = bs.Uint8(5)
 }
 
+// 参数集Encode使用的nalu header, Nal_unit_type为0(没有从nalu解码过)时使用nal_ref_idc 3
+func (hdr H264NaluHdr) orDefault(naluType H264_NAL_TYPE) H264NaluHdr {
+	if hdr.Nal_unit_type == 0 {
+		return H264NaluHdr{Nal_ref_idc: 3, Nal_unit_type: uint8(naluType)}
+	}
+	return hdr
+}
+
+func (hdr *H264NaluHdr) Encode(bsw *BitStreamWriter) {
+	bsw.PutUint8(hdr.Forbidden_zero_bit, 1)
+	bsw.PutUint8(hdr.Nal_ref_idc, 2)
+	bsw.PutUint8(hdr.Nal_unit_type, 5)
+}
+
 type SliceHeader struct {
-	First_mb_in_slice    uint64
-	Slice_type           uint64
-	Pic_parameter_set_id uint64
-	Frame_num            uint64
+	First_mb_in_slice                uint64
+	Slice_type                       uint64
+	Pic_parameter_set_id             uint64
+	Frame_num                        uint64
+	Colour_plane_id                  uint8
+	Field_pic_flag                   uint8
+	Bottom_field_flag                uint8
+	Idr_pic_id                       uint64
+	Pic_order_cnt_lsb                uint64
+	Delta_pic_order_cnt_bottom       int64
+	Delta_pic_order_cnt              [2]int64
+	Redundant_pic_cnt                uint64
+	Direct_spatial_mv_pred_flag      uint8
+	Num_ref_idx_active_override_flag uint8
+	Num_ref_idx_l0_active_minus1     uint64
+	Num_ref_idx_l1_active_minus1     uint64
+	No_output_of_prior_pics_flag     uint8
+	Long_term_reference_flag         uint8
+	Adaptive_ref_pic_marking_flag    uint8
+	Cabac_init_idc                   uint64
+	Slice_qp_delta                   int64
+	Sp_for_switch_flag               uint8
+	Slice_qs_delta                   int64
+	Disable_deblocking_filter_idc    uint64
+	Slice_alpha_c0_offset_div2       int64
+	Slice_beta_offset_div2           int64
+	Slice_group_change_cycle         uint64
+
+	// 以下字段不属于语法元素,解析时填充
+	Nal_ref_idc uint8
+	IdrPicFlag  bool
+	HasMMCO5    bool // memory_management_control_operation 等于5
 }
 
 // 调用方根据sps中的log2_max_frame_num_minus4的值来解析Frame_num
@@ -37,42 +88,265 @@ func (sh *SliceHeader) Decode(bs *BitStream) {
 	sh.Pic_parameter_set_id = bs.ReadUE()
 }
 
+// 7.3.3 slice_header
+// bs 指向nalu header之后,sps/pps为Pic_parameter_set_id对应的参数集
+func (sh *SliceHeader) DecodeFull(bs *BitStream, nalHdr *H264NaluHdr, sps *SPS, pps *PPS) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.New("h264 slice header out of range")
+		}
+	}()
+	sh.Decode(bs)
+	sh.Nal_ref_idc = nalHdr.Nal_ref_idc
+	sh.IdrPicFlag = H264_NAL_TYPE(nalHdr.Nal_unit_type) == H264_NAL_I_SLICE
+	if sh.Pic_parameter_set_id != pps.Pic_parameter_set_id || pps.Seq_parameter_set_id != sps.Seq_parameter_set_id {
+		return errors.New("h264 slice header parameter set mismatch")
+	}
+	sliceType := sh.Slice_type % 5
+	if sps.Separate_colour_plane_flag == 1 {
+		sh.Colour_plane_id = bs.Uint8(2)
+	}
+	sh.Frame_num = bs.GetBits(int(sps.Log2_max_frame_num_minus4 + 4))
+	if sps.Frame_mbs_only_flag == 0 {
+		sh.Field_pic_flag = bs.GetBit()
+		if sh.Field_pic_flag == 1 {
+			sh.Bottom_field_flag = bs.GetBit()
+		}
+	}
+	if sh.IdrPicFlag {
+		sh.Idr_pic_id = bs.ReadUE()
+	}
+	if sps.Pic_order_cnt_type == 0 {
+		sh.Pic_order_cnt_lsb = bs.GetBits(int(sps.Log2_max_pic_order_cnt_lsb_minus4 + 4))
+		if pps.Bottom_field_pic_order_in_frame_present_flag == 1 && sh.Field_pic_flag == 0 {
+			sh.Delta_pic_order_cnt_bottom = bs.ReadSE()
+		}
+	}
+	if sps.Pic_order_cnt_type == 1 && sps.Delta_pic_order_always_zero_flag == 0 {
+		sh.Delta_pic_order_cnt[0] = bs.ReadSE()
+		if pps.Bottom_field_pic_order_in_frame_present_flag == 1 && sh.Field_pic_flag == 0 {
+			sh.Delta_pic_order_cnt[1] = bs.ReadSE()
+		}
+	}
+	if pps.Redundant_pic_cnt_present_flag == 1 {
+		sh.Redundant_pic_cnt = bs.ReadUE()
+	}
+	if sliceType == H264_SLICE_B {
+		sh.Direct_spatial_mv_pred_flag = bs.GetBit()
+	}
+	sh.Num_ref_idx_l0_active_minus1 = pps.Num_ref_idx_l0_default_active_minus1
+	sh.Num_ref_idx_l1_active_minus1 = pps.Num_ref_idx_l1_default_active_minus1
+	if sliceType == H264_SLICE_P || sliceType == H264_SLICE_SP || sliceType == H264_SLICE_B {
+		sh.Num_ref_idx_active_override_flag = bs.GetBit()
+		if sh.Num_ref_idx_active_override_flag == 1 {
+			sh.Num_ref_idx_l0_active_minus1 = bs.ReadUE()
+			if sliceType == H264_SLICE_B {
+				sh.Num_ref_idx_l1_active_minus1 = bs.ReadUE()
+			}
+		}
+	}
+	// nal_unit_type 20/21 (mvc/3d-avc) 不支持
+	if sliceType != H264_SLICE_I && sliceType != H264_SLICE_SI {
+		skipRefPicListModification(bs)
+		if sliceType == H264_SLICE_B {
+			skipRefPicListModification(bs)
+		}
+	}
+	if (pps.Weighted_pred_flag == 1 && (sliceType == H264_SLICE_P || sliceType == H264_SLICE_SP)) ||
+		(pps.Weighted_bipred_idc == 1 && sliceType == H264_SLICE_B) {
+		sh.skipPredWeightTable(bs, sps.ChromaArrayType(), sliceType)
+	}
+	if sh.Nal_ref_idc != 0 {
+		sh.decodeDecRefPicMarking(bs)
+	}
+	if pps.Entropy_coding_mode_flag == 1 && sliceType != H264_SLICE_I && sliceType != H264_SLICE_SI {
+		sh.Cabac_init_idc = bs.ReadUE()
+	}
+	sh.Slice_qp_delta = bs.ReadSE()
+	if sliceType == H264_SLICE_SP || sliceType == H264_SLICE_SI {
+		if sliceType == H264_SLICE_SP {
+			sh.Sp_for_switch_flag = bs.GetBit()
+		}
+		sh.Slice_qs_delta = bs.ReadSE()
+	}
+	if pps.Deblocking_filter_control_present_flag == 1 {
+		sh.Disable_deblocking_filter_idc = bs.ReadUE()
+		if sh.Disable_deblocking_filter_idc != 1 {
+			sh.Slice_alpha_c0_offset_div2 = bs.ReadSE()
+			sh.Slice_beta_offset_div2 = bs.ReadSE()
+		}
+	}
+	if pps.Num_slice_groups_minus1 > 0 && pps.Slice_group_map_type >= 3 && pps.Slice_group_map_type <= 5 {
+		picSizeInMapUnits := (sps.Pic_width_in_mbs_minus1 + 1) * (sps.Pic_height_in_map_units_minus1 + 1)
+		changeRate := pps.Slice_group_change_rate_minus1 + 1
+		// Ceil(Log2(PicSizeInMapUnits ÷ SliceGroupChangeRate + 1))
+		n := 0
+		for changeRate<<uint(n) < picSizeInMapUnits+changeRate {
+			n++
+		}
+		if n > 0 {
+			sh.Slice_group_change_cycle = bs.GetBits(n)
+		}
+	}
+	return nil
+}
+
+// 只解析pic_parameter_set_id, 用于查找对应的pps, nalu不带startcode
+func GetH264SlicePPSId(nalu []byte) uint64 {
+	sh := SliceHeader{}
+	sh.Decode(NewBitStream(CovertRbspToSodb(nalu[1:])))
+	return sh.Pic_parameter_set_id
+}
+
+// slice header(包括nalu header)在nalu中占用的字节数, 包括防竞争字节
+// 用于CENC subsample加密, slice header必须保持明文
+func H264SliceHeaderSize(nalu []byte, sps *SPS, pps *PPS) (size int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.New("h264 slice header out of range")
+		}
+	}()
+	bs := NewBitStream(CovertRbspToSodb(nalu))
+	var hdr H264NaluHdr
+	hdr.Decode(bs)
+	sh := &SliceHeader{}
+	if err = sh.DecodeFull(bs, &hdr, sps, pps); err != nil {
+		return
+	}
+	n := bs.ByteOffset()
+	if bs.bitsOffset > 0 {
+		n++
+	}
+	return rbspLength(nalu, n), nil
+}
+
+func (sh *SliceHeader) IsBSlice() bool {
+	return sh.Slice_type%5 == H264_SLICE_B
+}
+
+// 7.3.3.1 ref_pic_list_modification
+func skipRefPicListModification(bs *BitStream) {
+	if bs.GetBit() == 0 {
+		return
+	}
+	for {
+		modification_of_pic_nums_idc := bs.ReadUE()
+		if modification_of_pic_nums_idc == 3 {
+			break
+		}
+		bs.ReadUE() //abs_diff_pic_num_minus1 or long_term_pic_num
+	}
+}
+
+// 7.3.3.2 pred_weight_table
+func (sh *SliceHeader) skipPredWeightTable(bs *BitStream, chromaArrayType uint64, sliceType uint64) {
+	bs.ReadUE() //luma_log2_weight_denom
+	if chromaArrayType != 0 {
+		bs.ReadUE() //chroma_log2_weight_denom
+	}
+	skip := func(num uint64) {
+		for i := uint64(0); i <= num; i++ {
+			if bs.GetBit() == 1 { //luma_weight_flag
+				bs.ReadSE()
+				bs.ReadSE()
+			}
+			if chromaArrayType != 0 && bs.GetBit() == 1 { //chroma_weight_flag
+				for j := 0; j < 2; j++ {
+					bs.ReadSE()
+					bs.ReadSE()
+				}
+			}
+		}
+	}
+	skip(sh.Num_ref_idx_l0_active_minus1)
+	if sliceType == H264_SLICE_B {
+		skip(sh.Num_ref_idx_l1_active_minus1)
+	}
+}
+
+// 7.3.3.3 dec_ref_pic_marking
+func (sh *SliceHeader) decodeDecRefPicMarking(bs *BitStream) {
+	if sh.IdrPicFlag {
+		sh.No_output_of_prior_pics_flag = bs.GetBit()
+		sh.Long_term_reference_flag = bs.GetBit()
+		return
+	}
+	sh.Adaptive_ref_pic_marking_flag = bs.GetBit()
+	if sh.Adaptive_ref_pic_marking_flag == 0 {
+		return
+	}
+	for {
+		mmco := bs.ReadUE()
+		if mmco == 0 {
+			break
+		}
+		if mmco == 1 || mmco == 3 {
+			bs.ReadUE() //difference_of_pic_nums_minus1
+		}
+		if mmco == 2 {
+			bs.ReadUE() //long_term_pic_num
+		}
+		if mmco == 3 || mmco == 6 {
+			bs.ReadUE() //long_term_frame_idx
+		}
+		if mmco == 4 {
+			bs.ReadUE() //max_long_term_frame_idx_plus1
+		}
+		if mmco == 5 {
+			sh.HasMMCO5 = true
+		}
+	}
+}
+
 type SPS struct {
-	Profile_idc                          uint8
-	Constraint_set0_flag                 uint8
-	Constraint_set1_flag                 uint8
-	Constraint_set2_flag                 uint8
-	Constraint_set3_flag                 uint8
-	Constraint_set4_flag                 uint8
-	Constraint_set5_flag                 uint8
-	Reserved_zero_2bits                  uint8
-	Level_idc                            uint8
-	Seq_parameter_set_id                 uint64
-	Chroma_format_idc                    uint64
-	Separate_colour_plane_flag           uint8
-	Bit_depth_luma_minus8                uint64
-	Bit_depth_chroma_minus8              uint64
-	Log2_max_frame_num_minus4            uint64
-	Pic_order_cnt_type                   uint64
-	Log2_max_pic_order_cnt_lsb_minus4    uint64
-	Delta_pic_order_always_zero_flag     uint8
-	Offset_for_non_ref_pic               int64
-	Offset_for_top_to_bottom_field       int64
-	Offset_for_ref_frame                 []int64
-	Max_num_ref_frames                   uint64
-	Gaps_in_frame_num_value_allowed_flag uint8
-	Pic_width_in_mbs_minus1              uint64
-	Pic_height_in_map_units_minus1       uint64
-	Frame_mbs_only_flag                  uint8
-	Mb_adaptive_frame_field_flag         uint8
-	Direct_8x8_inference_flag            uint8
-	Frame_cropping_flag                  uint8
-	Frame_crop_left_offset               uint64
-	Frame_crop_right_offset              uint64
-	Frame_crop_top_offset                uint64
-	Frame_crop_bottom_offset             uint64
-	Vui_parameters_present_flag          uint8
-	VuiParameters                        H264VuiParameters
+	NalHdr                                H264NaluHdr //DecodeNalu时保存, Encode时原样写回
+	Profile_idc                           uint8
+	Constraint_set0_flag                  uint8
+	Constraint_set1_flag                  uint8
+	Constraint_set2_flag                  uint8
+	Constraint_set3_flag                  uint8
+	Constraint_set4_flag                  uint8
+	Constraint_set5_flag                  uint8
+	Reserved_zero_2bits                   uint8
+	Level_idc                             uint8
+	Seq_parameter_set_id                  uint64
+	Chroma_format_idc                     uint64
+	Separate_colour_plane_flag            uint8
+	Bit_depth_luma_minus8                 uint64
+	Bit_depth_chroma_minus8               uint64
+	Qpprime_y_zero_transform_bypass_flag  uint8
+	Seq_scaling_matrix_present_flag       uint8
+	Seq_scaling_list_present_flag         [12]uint8
+	Seq_scaling_list_delta_scale          [12][]int64
+	Log2_max_frame_num_minus4             uint64
+	Pic_order_cnt_type                    uint64
+	Log2_max_pic_order_cnt_lsb_minus4     uint64
+	Delta_pic_order_always_zero_flag      uint8
+	Offset_for_non_ref_pic                int64
+	Offset_for_top_to_bottom_field        int64
+	Num_ref_frames_in_pic_order_cnt_cycle uint64
+	Offset_for_ref_frame                  []int64
+	Max_num_ref_frames                    uint64
+	Gaps_in_frame_num_value_allowed_flag  uint8
+	Pic_width_in_mbs_minus1               uint64
+	Pic_height_in_map_units_minus1        uint64
+	Frame_mbs_only_flag                   uint8
+	Mb_adaptive_frame_field_flag          uint8
+	Direct_8x8_inference_flag             uint8
+	Frame_cropping_flag                   uint8
+	Frame_crop_left_offset                uint64
+	Frame_crop_right_offset               uint64
+	Frame_crop_top_offset                 uint64
+	Frame_crop_bottom_offset              uint64
+	Vui_parameters_present_flag           uint8
+	VuiParameters                         H264VuiParameters
+}
+
+// nalu不带startcode, 同时解析nalu header
+func (sps *SPS) DecodeNalu(nalu []byte) {
+	bs := NewBitStream(CovertRbspToSodb(nalu))
+	sps.NalHdr.Decode(bs)
+	sps.Decode(bs)
 }
 
 func (sps *SPS) Decode(bs *BitStream) {
@@ -86,6 +360,7 @@ func (sps *SPS) Decode(bs *BitStream) {
 	sps.Reserved_zero_2bits = bs.Uint8(2)
 	sps.Level_idc = bs.Uint8(8)
 	sps.Seq_parameter_set_id = bs.ReadUE()
+	sps.Chroma_format_idc = 1
 	if sps.Profile_idc == 100 || sps.Profile_idc == 110 ||
 		sps.Profile_idc == 122 || sps.Profile_idc == 244 || sps.Profile_idc == 44 ||
 		sps.Profile_idc == 83 || sps.Profile_idc == 86 || sps.Profile_idc == 118 ||
@@ -97,14 +372,22 @@ func (sps *SPS) Decode(bs *BitStream) {
 		}
 		sps.Bit_depth_luma_minus8 = bs.ReadUE()   //bit_depth_luma_minus8
 		sps.Bit_depth_chroma_minus8 = bs.ReadUE() //bit_depth_chroma_minus8
-		bs.SkipBits(1)                            //qpprime_y_zero_transform_bypass_flag
-		seq_scaling_matrix_present_flag := bs.GetBit()
-		if seq_scaling_matrix_present_flag == 1 {
-			//seq_scaling_list_present_flag[i]
+		sps.Qpprime_y_zero_transform_bypass_flag = bs.GetBit()
+		sps.Seq_scaling_matrix_present_flag = bs.GetBit()
+		if sps.Seq_scaling_matrix_present_flag == 1 {
+			count := 8
 			if sps.Chroma_format_idc == 3 {
-				bs.SkipBits(12)
-			} else {
-				bs.SkipBits(8)
+				count = 12
+			}
+			for i := 0; i < count; i++ {
+				sps.Seq_scaling_list_present_flag[i] = bs.GetBit()
+				if sps.Seq_scaling_list_present_flag[i] == 1 {
+					if i < 6 {
+						sps.Seq_scaling_list_delta_scale[i] = readScalingList(bs, 16)
+					} else {
+						sps.Seq_scaling_list_delta_scale[i] = readScalingList(bs, 64)
+					}
+				}
 			}
 		}
 	}
@@ -116,8 +399,9 @@ func (sps *SPS) Decode(bs *BitStream) {
 		sps.Delta_pic_order_always_zero_flag = bs.GetBit()
 		sps.Offset_for_non_ref_pic = bs.ReadSE()         // offset_for_non_ref_pic
 		sps.Offset_for_top_to_bottom_field = bs.ReadSE() // offset_for_top_to_bottom_field
-		num_ref_frames_in_pic_order_cnt_cycle := bs.ReadUE()
-		for i := 0; i < int(num_ref_frames_in_pic_order_cnt_cycle); i++ {
+		sps.Num_ref_frames_in_pic_order_cnt_cycle = bs.ReadUE()
+		sps.Offset_for_ref_frame = make([]int64, sps.Num_ref_frames_in_pic_order_cnt_cycle)
+		for i := 0; i < int(sps.Num_ref_frames_in_pic_order_cnt_cycle); i++ {
 			sps.Offset_for_ref_frame[i] = bs.ReadSE() // offset_for_ref_frame
 		}
 	}
@@ -144,78 +428,320 @@ func (sps *SPS) Decode(bs *BitStream) {
 	}
 }
 
+// ChromaArrayType
+func (sps *SPS) ChromaArrayType() uint64 {
+	if sps.Separate_colour_plane_flag == 1 {
+		return 0
+	}
+	return sps.Chroma_format_idc
+}
+
+// 7.3.2.1.1.1 scaling_list, 返回码流中的delta_scale, 遇到nextScale为0时结束
+func readScalingList(bs *BitStream, sizeOfScalingList int) []int64 {
+	deltas := make([]int64, 0, sizeOfScalingList)
+	lastScale, nextScale := int64(8), int64(8)
+	for j := 0; j < sizeOfScalingList && nextScale != 0; j++ {
+		delta_scale := bs.ReadSE()
+		deltas = append(deltas, delta_scale)
+		nextScale = (lastScale + delta_scale + 256) % 256
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+	return deltas
+}
+
+// 参数集的Encode(h264 SPS/PPS, h265 VPS/SPS/PPS)都返回不带startcode的nalu,
+// 包含nalu header(NalHdr, 从nalu解码时原样保存), 已经插入防竞争字节, 可以直接写入avcC/hvcC或者加上startcode输出
+func (sps *SPS) Encode() []byte {
+	bsw := NewBitStreamWriter(32)
+	hdr := sps.NalHdr.orDefault(H264_NAL_SPS)
+	hdr.Encode(bsw)
+	sps.encode(bsw)
+	return CovertSodbToRbsp(bsw.Bits())
+}
+
+func (sps *SPS) encode(bsw *BitStreamWriter) {
+	bsw.PutUint8(sps.Profile_idc, 8)
+	bsw.PutUint8(sps.Constraint_set0_flag, 1)
+	bsw.PutUint8(sps.Constraint_set1_flag, 1)
+	bsw.PutUint8(sps.Constraint_set2_flag, 1)
+	bsw.PutUint8(sps.Constraint_set3_flag, 1)
+	bsw.PutUint8(sps.Constraint_set4_flag, 1)
+	bsw.PutUint8(sps.Constraint_set5_flag, 1)
+	bsw.PutUint8(sps.Reserved_zero_2bits, 2)
+	bsw.PutUint8(sps.Level_idc, 8)
+	bsw.PutUE(sps.Seq_parameter_set_id)
+	if sps.Profile_idc == 100 || sps.Profile_idc == 110 ||
+		sps.Profile_idc == 122 || sps.Profile_idc == 244 || sps.Profile_idc == 44 ||
+		sps.Profile_idc == 83 || sps.Profile_idc == 86 || sps.Profile_idc == 118 ||
+		sps.Profile_idc == 128 || sps.Profile_idc == 138 || sps.Profile_idc == 139 ||
+		sps.Profile_idc == 134 || sps.Profile_idc == 135 {
+		bsw.PutUE(sps.Chroma_format_idc)
+		if sps.Chroma_format_idc == 3 {
+			bsw.PutUint8(sps.Separate_colour_plane_flag, 1)
+		}
+		bsw.PutUE(sps.Bit_depth_luma_minus8)
+		bsw.PutUE(sps.Bit_depth_chroma_minus8)
+		bsw.PutUint8(sps.Qpprime_y_zero_transform_bypass_flag, 1)
+		bsw.PutUint8(sps.Seq_scaling_matrix_present_flag, 1)
+		if sps.Seq_scaling_matrix_present_flag == 1 {
+			count := 8
+			if sps.Chroma_format_idc == 3 {
+				count = 12
+			}
+			for i := 0; i < count; i++ {
+				bsw.PutUint8(sps.Seq_scaling_list_present_flag[i], 1)
+				if sps.Seq_scaling_list_present_flag[i] == 1 {
+					writeScalingList(bsw, sps.Seq_scaling_list_delta_scale[i])
+				}
+			}
+		}
+	}
+	bsw.PutUE(sps.Log2_max_frame_num_minus4)
+	bsw.PutUE(sps.Pic_order_cnt_type)
+	if sps.Pic_order_cnt_type == 0 {
+		bsw.PutUE(sps.Log2_max_pic_order_cnt_lsb_minus4)
+	} else if sps.Pic_order_cnt_type == 1 {
+		bsw.PutUint8(sps.Delta_pic_order_always_zero_flag, 1)
+		bsw.PutSE(sps.Offset_for_non_ref_pic)
+		bsw.PutSE(sps.Offset_for_top_to_bottom_field)
+		bsw.PutUE(sps.Num_ref_frames_in_pic_order_cnt_cycle)
+		for i := 0; i < int(sps.Num_ref_frames_in_pic_order_cnt_cycle); i++ {
+			bsw.PutSE(sps.Offset_for_ref_frame[i])
+		}
+	}
+	bsw.PutUE(sps.Max_num_ref_frames)
+	bsw.PutUint8(sps.Gaps_in_frame_num_value_allowed_flag, 1)
+	bsw.PutUE(sps.Pic_width_in_mbs_minus1)
+	bsw.PutUE(sps.Pic_height_in_map_units_minus1)
+	bsw.PutUint8(sps.Frame_mbs_only_flag, 1)
+	if sps.Frame_mbs_only_flag == 0 {
+		bsw.PutUint8(sps.Mb_adaptive_frame_field_flag, 1)
+	}
+	bsw.PutUint8(sps.Direct_8x8_inference_flag, 1)
+	bsw.PutUint8(sps.Frame_cropping_flag, 1)
+	if sps.Frame_cropping_flag == 1 {
+		bsw.PutUE(sps.Frame_crop_left_offset)
+		bsw.PutUE(sps.Frame_crop_right_offset)
+		bsw.PutUE(sps.Frame_crop_top_offset)
+		bsw.PutUE(sps.Frame_crop_bottom_offset)
+	}
+	bsw.PutUint8(sps.Vui_parameters_present_flag, 1)
+	if sps.Vui_parameters_present_flag == 1 {
+		sps.VuiParameters.Encode(bsw)
+	}
+	bsw.PutRbspTrailingBits()
+}
+
+func writeScalingList(bsw *BitStreamWriter, deltas []int64) {
+	for _, delta_scale := range deltas {
+		bsw.PutSE(delta_scale)
+	}
+}
+
 type PPS struct {
+	NalHdr                                       H264NaluHdr //DecodeNalu时保存, Encode时原样写回
 	Pic_parameter_set_id                         uint64
 	Seq_parameter_set_id                         uint64
 	Entropy_coding_mode_flag                     uint8
 	Bottom_field_pic_order_in_frame_present_flag uint8
 	Num_slice_groups_minus1                      uint64
+	Slice_group_map_type                         uint64
+	Run_length_minus1                            []uint64
+	Top_left                                     []uint64
+	Bottom_right                                 []uint64
+	Slice_group_change_direction_flag            uint8
+	Slice_group_change_rate_minus1               uint64
+	Pic_size_in_map_units_minus1                 uint64
+	Slice_group_id                               []uint64
+	Num_ref_idx_l0_default_active_minus1         uint64
+	Num_ref_idx_l1_default_active_minus1         uint64
+	Weighted_pred_flag                           uint8
+	Weighted_bipred_idc                          uint8
+	Pic_init_qp_minus26                          int64
+	Pic_init_qs_minus26                          int64
+	Chroma_qp_index_offset                       int64
+	Deblocking_filter_control_present_flag       uint8
+	Constrained_intra_pred_flag                  uint8
+	Redundant_pic_cnt_present_flag               uint8
+	More_rbsp_data                               bool // 是否有transform_8x8_mode_flag等扩展字段
+	Transform_8x8_mode_flag                      uint8
+	Pic_scaling_matrix_present_flag              uint8
+	Pic_scaling_list_present_flag                [12]uint8
+	Pic_scaling_list_delta_scale                 [12][]int64
+	Second_chroma_qp_index_offset                int64
 }
 
-func (pps *PPS) Decode(bs *BitStream) {
-	pps.Pic_parameter_set_id = bs.ReadUE()
-	pps.Seq_parameter_set_id = bs.ReadUE()
-	pps.Entropy_coding_mode_flag = bs.GetBit()
-	pps.Bottom_field_pic_order_in_frame_present_flag = bs.GetBit()
-	pps.Num_slice_groups_minus1 = bs.ReadUE()
-}
-
-type SEIReaderWriter interface {
-	Read(size uint16, bs *BitStream)
-	Write(bsw *BitStreamWriter)
+// 按chroma_format_idc 为1 解析, 4:4:4 码流请使用DecodeWithSPS
+// nalu不带startcode, 同时解析nalu header
+func (pps *PPS) DecodeNalu(nalu []byte) {
+	bs := NewBitStream(CovertRbspToSodb(nalu))
+	pps.NalHdr.Decode(bs)
+	pps.Decode(bs)
 }
 
-type UserDataUnregistered struct {
-	UUID     []byte
-	UserData []byte
+func (pps *PPS) Decode(bs *BitStream) {
+	pps.decode(bs, 1)
 }
 
-func (udu *UserDataUnregistered) Read(size uint16, bs *BitStream) {
-	udu.UUID = bs.GetBytes(16)
-	udu.UserData = bs.GetBytes(int(size - 16))
+func (pps *PPS) DecodeWithSPS(bs *BitStream, sps *SPS) {
+	pps.decode(bs, sps.Chroma_format_idc)
 }
 
-func (udu *UserDataUnregistered) Write(bsw *BitStreamWriter) {
-	bsw.PutBytes(udu.UUID)
-	bsw.PutBytes(udu.UserData)
+func (pps *PPS) decode(bs *BitStream, chroma_format_idc uint64) {
+	pps.Pic_parameter_set_id = bs.ReadUE()
+	pps.Seq_parameter_set_id = bs.ReadUE()
+	pps.Entropy_coding_mode_flag = bs.GetBit()
+	pps.Bottom_field_pic_order_in_frame_present_flag = bs.GetBit()
+	pps.Num_slice_groups_minus1 = bs.ReadUE()
+	if pps.Num_slice_groups_minus1 > 0 {
+		pps.Slice_group_map_type = bs.ReadUE()
+		switch pps.Slice_group_map_type {
+		case 0:
+			pps.Run_length_minus1 = make([]uint64, pps.Num_slice_groups_minus1+1)
+			for i := range pps.Run_length_minus1 {
+				pps.Run_length_minus1[i] = bs.ReadUE()
+			}
+		case 2:
+			pps.Top_left = make([]uint64, pps.Num_slice_groups_minus1)
+			pps.Bottom_right = make([]uint64, pps.Num_slice_groups_minus1)
+			for i := range pps.Top_left {
+				pps.Top_left[i] = bs.ReadUE()
+				pps.Bottom_right[i] = bs.ReadUE()
+			}
+		case 3, 4, 5:
+			pps.Slice_group_change_direction_flag = bs.GetBit()
+			pps.Slice_group_change_rate_minus1 = bs.ReadUE()
+		case 6:
+			pps.Pic_size_in_map_units_minus1 = bs.ReadUE()
+			n := 0
+			for (uint64(1) << uint(n)) < pps.Num_slice_groups_minus1+1 {
+				n++
+			}
+			pps.Slice_group_id = make([]uint64, pps.Pic_size_in_map_units_minus1+1)
+			for i := range pps.Slice_group_id {
+				pps.Slice_group_id[i] = bs.GetBits(n)
+			}
+		}
+	}
+	pps.Num_ref_idx_l0_default_active_minus1 = bs.ReadUE()
+	pps.Num_ref_idx_l1_default_active_minus1 = bs.ReadUE()
+	pps.Weighted_pred_flag = bs.GetBit()
+	pps.Weighted_bipred_idc = bs.Uint8(2)
+	pps.Pic_init_qp_minus26 = bs.ReadSE()
+	pps.Pic_init_qs_minus26 = bs.ReadSE()
+	pps.Chroma_qp_index_offset = bs.ReadSE()
+	pps.Deblocking_filter_control_present_flag = bs.GetBit()
+	pps.Constrained_intra_pred_flag = bs.GetBit()
+	pps.Redundant_pic_cnt_present_flag = bs.GetBit()
+	pps.Second_chroma_qp_index_offset = pps.Chroma_qp_index_offset
+	pps.More_rbsp_data = bs.MoreRbspData()
+	if !pps.More_rbsp_data {
+		return
+	}
+	pps.Transform_8x8_mode_flag = bs.GetBit()
+	pps.Pic_scaling_matrix_present_flag = bs.GetBit()
+	if pps.Pic_scaling_matrix_present_flag == 1 {
+		count := 6
+		if pps.Transform_8x8_mode_flag == 1 {
+			if chroma_format_idc == 3 {
+				count += 6
+			} else {
+				count += 2
+			}
+		}
+		for i := 0; i < count; i++ {
+			pps.Pic_scaling_list_present_flag[i] = bs.GetBit()
+			if pps.Pic_scaling_list_present_flag[i] == 1 {
+				if i < 6 {
+					pps.Pic_scaling_list_delta_scale[i] = readScalingList(bs, 16)
+				} else {
+					pps.Pic_scaling_list_delta_scale[i] = readScalingList(bs, 64)
+				}
+			}
+		}
+	}
+	pps.Second_chroma_qp_index_offset = bs.ReadSE()
 }
 
-type SEI struct {
-	PayloadType uint16
-	PayloadSize uint16
-	Sei_payload SEIReaderWriter
+// 按chroma_format_idc 为1 编码, 4:4:4 码流请使用EncodeWithSPS
+func (pps *PPS) Encode() []byte {
+	return pps.encode(1)
 }
 
-func (sei *SEI) Decode(bs *BitStream) {
-	for bs.NextBits(8) == 0xFF {
-		sei.PayloadType += 255
-	}
-	sei.PayloadType += uint16(bs.Uint8(8))
-	for bs.NextBits(8) == 0xFF {
-		sei.PayloadSize += 255
-	}
-	sei.PayloadSize += uint16(bs.Uint8(8))
-	if sei.PayloadType == 5 {
-		sei.Sei_payload = new(UserDataUnregistered)
-		sei.Sei_payload.Read(sei.PayloadSize, bs)
-	}
+func (pps *PPS) EncodeWithSPS(sps *SPS) []byte {
+	return pps.encode(sps.Chroma_format_idc)
 }
 
-func (sei *SEI) Encode(bsw *BitStreamWriter) []byte {
-	payloadType := sei.PayloadType
-	payloadSize := sei.PayloadSize
-	for payloadType >= 0xFF {
-		bsw.PutByte(0xFF)
-		payloadType -= 255
+func (pps *PPS) encode(chroma_format_idc uint64) []byte {
+	bsw := NewBitStreamWriter(16)
+	hdr := pps.NalHdr.orDefault(H264_NAL_PPS)
+	hdr.Encode(bsw)
+	bsw.PutUE(pps.Pic_parameter_set_id)
+	bsw.PutUE(pps.Seq_parameter_set_id)
+	bsw.PutUint8(pps.Entropy_coding_mode_flag, 1)
+	bsw.PutUint8(pps.Bottom_field_pic_order_in_frame_present_flag, 1)
+	bsw.PutUE(pps.Num_slice_groups_minus1)
+	if pps.Num_slice_groups_minus1 > 0 {
+		bsw.PutUE(pps.Slice_group_map_type)
+		switch pps.Slice_group_map_type {
+		case 0:
+			for _, run_length_minus1 := range pps.Run_length_minus1 {
+				bsw.PutUE(run_length_minus1)
+			}
+		case 2:
+			for i := range pps.Top_left {
+				bsw.PutUE(pps.Top_left[i])
+				bsw.PutUE(pps.Bottom_right[i])
+			}
+		case 3, 4, 5:
+			bsw.PutUint8(pps.Slice_group_change_direction_flag, 1)
+			bsw.PutUE(pps.Slice_group_change_rate_minus1)
+		case 6:
+			bsw.PutUE(pps.Pic_size_in_map_units_minus1)
+			n := 0
+			for (uint64(1) << uint(n)) < pps.Num_slice_groups_minus1+1 {
+				n++
+			}
+			for _, id := range pps.Slice_group_id {
+				bsw.PutUint64(id, n)
+			}
+		}
 	}
-	bsw.PutByte(uint8(payloadType))
-	for payloadSize >= 0xFF {
-		bsw.PutByte(0xFF)
-		payloadSize -= 255
+	bsw.PutUE(pps.Num_ref_idx_l0_default_active_minus1)
+	bsw.PutUE(pps.Num_ref_idx_l1_default_active_minus1)
+	bsw.PutUint8(pps.Weighted_pred_flag, 1)
+	bsw.PutUint8(pps.Weighted_bipred_idc, 2)
+	bsw.PutSE(pps.Pic_init_qp_minus26)
+	bsw.PutSE(pps.Pic_init_qs_minus26)
+	bsw.PutSE(pps.Chroma_qp_index_offset)
+	bsw.PutUint8(pps.Deblocking_filter_control_present_flag, 1)
+	bsw.PutUint8(pps.Constrained_intra_pred_flag, 1)
+	bsw.PutUint8(pps.Redundant_pic_cnt_present_flag, 1)
+	if pps.More_rbsp_data {
+		bsw.PutUint8(pps.Transform_8x8_mode_flag, 1)
+		bsw.PutUint8(pps.Pic_scaling_matrix_present_flag, 1)
+		if pps.Pic_scaling_matrix_present_flag == 1 {
+			count := 6
+			if pps.Transform_8x8_mode_flag == 1 {
+				if chroma_format_idc == 3 {
+					count += 6
+				} else {
+					count += 2
+				}
+			}
+			for i := 0; i < count; i++ {
+				bsw.PutUint8(pps.Pic_scaling_list_present_flag[i], 1)
+				if pps.Pic_scaling_list_present_flag[i] == 1 {
+					writeScalingList(bsw, pps.Pic_scaling_list_delta_scale[i])
+				}
+			}
+		}
+		bsw.PutSE(pps.Second_chroma_qp_index_offset)
 	}
-	bsw.PutByte(uint8(payloadSize))
-	sei.Sei_payload.Write(bsw)
-	return bsw.Bits()
+	bsw.PutRbspTrailingBits()
+	return CovertSodbToRbsp(bsw.Bits())
 }
 
 func GetSPSIdWithStartCode(sps []byte) uint64 {
@@ -486,7 +1012,7 @@ func (h264Vui *H264VuiParameters) Decode(bs *BitStream) {
 
 		if h264Vui.AspectRatioIdc == ExtendedSar {
 			h264Vui.SarWidth = bs.Uint16(16)
-			h264Vui.SarWidth = bs.Uint16(16)
+			h264Vui.SarHeight = bs.Uint16(16)
 		}
 	}
 
@@ -541,21 +1067,22 @@ func (h264Vui *H264VuiParameters) Decode(bs *BitStream) {
 		h264Vui.LowDelayHrdFlag = bs.Uint8(1)
 	}
 
-	/*
-		TODO - These fields were causing problems because we'd run out of bits when parsing. Maybe they're optional in certain versions/levels/configurations?
-			h264Vui.PicStructPresentFlag = bs.GetBit()
-			h264Vui.BitstreamRestrictionFlag = bs.GetBit()
-
-			if h264Vui.BitstreamRestrictionFlag == 1 {
-				h264Vui.MotionVectorsOverPicBoundaries = bs.GetBit()
-				h264Vui.MaxBytesPerPicDenom = bs.ReadUE()
-				h264Vui.MaxBitsPerMbDenom = bs.ReadUE()
-				h264Vui.Log2MaxMvLengthHorizontal = bs.ReadUE()
-				h264Vui.Log2MaxMvLengthVertical = bs.ReadUE()
-				h264Vui.NumReorderFrames = bs.ReadUE()
-				h264Vui.MaxDecFrameBuffering = bs.ReadUE()
-			}
-	*/
+	// 部分码流的vui在此处就结束了
+	if bs.RemainBits() < 2 {
+		return
+	}
+	h264Vui.PicStructPresentFlag = bs.GetBit()
+	h264Vui.BitstreamRestrictionFlag = bs.GetBit()
+
+	if h264Vui.BitstreamRestrictionFlag == 1 {
+		h264Vui.MotionVectorsOverPicBoundaries = bs.GetBit()
+		h264Vui.MaxBytesPerPicDenom = bs.ReadUE()
+		h264Vui.MaxBitsPerMbDenom = bs.ReadUE()
+		h264Vui.Log2MaxMvLengthHorizontal = bs.ReadUE()
+		h264Vui.Log2MaxMvLengthVertical = bs.ReadUE()
+		h264Vui.NumReorderFrames = bs.ReadUE()
+		h264Vui.MaxDecFrameBuffering = bs.ReadUE()
+	}
 }
 
 func (h264Hrd *H264HrdParameters) Decode(bs *BitStream) {
@@ -576,3 +1103,234 @@ func (h264Hrd *H264HrdParameters) Decode(bs *BitStream) {
 	h264Hrd.DpbOutputDelayLengthMinus1 = bs.Uint8(5)
 	h264Hrd.TimeOffsetLength = bs.Uint8(5)
 }
+
+func (h264Vui *H264VuiParameters) Encode(bsw *BitStreamWriter) {
+	bsw.PutUint8(h264Vui.AspectRatioInfoPresentFlag, 1)
+	if h264Vui.AspectRatioInfoPresentFlag == 1 {
+		bsw.PutUint8(h264Vui.AspectRatioIdc, 8)
+		if h264Vui.AspectRatioIdc == ExtendedSar {
+			bsw.PutUint16(h264Vui.SarWidth, 16)
+			bsw.PutUint16(h264Vui.SarHeight, 16)
+		}
+	}
+	bsw.PutUint8(h264Vui.OverscanInfoPresentFlag, 1)
+	if h264Vui.OverscanInfoPresentFlag == 1 {
+		bsw.PutUint8(h264Vui.OverscanAppropriateFlag, 1)
+	}
+	bsw.PutUint8(h264Vui.VideoSignalTypePresentFlag, 1)
+	if h264Vui.VideoSignalTypePresentFlag == 1 {
+		bsw.PutUint8(h264Vui.VideoFormat, 3)
+		bsw.PutUint8(h264Vui.VideoFullRangeFlag, 1)
+		bsw.PutUint8(h264Vui.ColourDescriptionPresentFlag, 1)
+		if h264Vui.ColourDescriptionPresentFlag == 1 {
+			bsw.PutUint8(h264Vui.ColourPrimaries, 8)
+			bsw.PutUint8(h264Vui.TransferCharacteristics, 8)
+			bsw.PutUint8(h264Vui.MatrixCoefficients, 8)
+		}
+	}
+	bsw.PutUint8(h264Vui.ChromaLocInfoPresentFlag, 1)
+	if h264Vui.ChromaLocInfoPresentFlag == 1 {
+		bsw.PutUE(h264Vui.ChromaSampleLocTypeTopField)
+		bsw.PutUE(h264Vui.ChromaSampleLocTypeBottomField)
+	}
+	bsw.PutUint8(h264Vui.TimingInfoPresentFlag, 1)
+	if h264Vui.TimingInfoPresentFlag == 1 {
+		bsw.PutUint32(h264Vui.NumUnitsInTick, 32)
+		bsw.PutUint32(h264Vui.TimeScale, 32)
+		bsw.PutUint8(h264Vui.FixedFrameRateFlag, 1)
+	}
+	bsw.PutUint8(h264Vui.NalHrdParametersPresentFlag, 1)
+	if h264Vui.NalHrdParametersPresentFlag == 1 {
+		h264Vui.NalHrdParameters.Encode(bsw)
+	}
+	bsw.PutUint8(h264Vui.VclHrdParametersPresentFlag, 1)
+	if h264Vui.VclHrdParametersPresentFlag == 1 {
+		h264Vui.VclHrdParameters.Encode(bsw)
+	}
+	if h264Vui.NalHrdParametersPresentFlag == 1 || h264Vui.VclHrdParametersPresentFlag == 1 {
+		bsw.PutUint8(h264Vui.LowDelayHrdFlag, 1)
+	}
+	bsw.PutUint8(h264Vui.PicStructPresentFlag, 1)
+	bsw.PutUint8(h264Vui.BitstreamRestrictionFlag, 1)
+	if h264Vui.BitstreamRestrictionFlag == 1 {
+		bsw.PutUint8(h264Vui.MotionVectorsOverPicBoundaries, 1)
+		bsw.PutUE(h264Vui.MaxBytesPerPicDenom)
+		bsw.PutUE(h264Vui.MaxBitsPerMbDenom)
+		bsw.PutUE(h264Vui.Log2MaxMvLengthHorizontal)
+		bsw.PutUE(h264Vui.Log2MaxMvLengthVertical)
+		bsw.PutUE(h264Vui.NumReorderFrames)
+		bsw.PutUE(h264Vui.MaxDecFrameBuffering)
+	}
+}
+
+func (h264Hrd *H264HrdParameters) Encode(bsw *BitStreamWriter) {
+	bsw.PutUE(h264Hrd.CpbCntMinus1)
+	bsw.PutUint8(h264Hrd.BitRateScale, 4)
+	bsw.PutUint8(h264Hrd.CpbSizeScale, 4)
+	for i := 0; i <= int(h264Hrd.CpbCntMinus1); i++ {
+		bsw.PutUE(h264Hrd.H264BitRateCpbSizeCbrFlag[i].BitRateValueMinus1)
+		bsw.PutUE(h264Hrd.H264BitRateCpbSizeCbrFlag[i].CpbSizeValueMinus1)
+		bsw.PutUint8(h264Hrd.H264BitRateCpbSizeCbrFlag[i].CbrFlag, 1)
+	}
+	bsw.PutUint8(h264Hrd.InitialCpbRemovalDelayLengthMinus1, 5)
+	bsw.PutUint8(h264Hrd.CpbRemovalDelayLengthMinus1, 5)
+	bsw.PutUint8(h264Hrd.DpbOutputDelayLengthMinus1, 5)
+	bsw.PutUint8(h264Hrd.TimeOffsetLength, 5)
+}
+
+// 8.2.1 图像顺序号(POC)计算, 需要按照解码顺序对每一帧(第一个slice)调用Calculate
+type H264PocCalculator struct {
+	prevPocMsb         int64
+	prevPocLsb         int64
+	prevFrameNumOffset int64
+	prevFrameNum       uint64
+	prevHasMMCO5       bool
+}
+
+func NewH264PocCalculator() *H264PocCalculator {
+	return &H264PocCalculator{}
+}
+
+// 返回PicOrderCnt(CurrPic), 如果当前帧包含mmco5,返回的是8.2.1中减去tempPicOrderCnt之后的值
+func (calc *H264PocCalculator) Calculate(sh *SliceHeader, sps *SPS) int64 {
+	var topPoc, bottomPoc int64
+	switch sps.Pic_order_cnt_type {
+	case 0:
+		topPoc, bottomPoc = calc.pocType0(sh, sps)
+	case 1:
+		topPoc, bottomPoc = calc.pocType1(sh, sps)
+	default:
+		topPoc, bottomPoc = calc.pocType2(sh, sps)
+	}
+
+	var poc int64
+	if sh.Field_pic_flag == 0 {
+		if topPoc < bottomPoc {
+			poc = topPoc
+		} else {
+			poc = bottomPoc
+		}
+	} else if sh.Bottom_field_flag == 0 {
+		poc = topPoc
+	} else {
+		poc = bottomPoc
+	}
+
+	if sh.HasMMCO5 {
+		topPoc -= poc
+		bottomPoc -= poc
+		poc = 0
+	}
+
+	if sps.Pic_order_cnt_type == 0 && sh.Nal_ref_idc != 0 {
+		if sh.HasMMCO5 {
+			calc.prevPocMsb = 0
+			calc.prevPocLsb = 0
+			if sh.Field_pic_flag == 0 || sh.Bottom_field_flag == 0 {
+				calc.prevPocLsb = topPoc
+			}
+		} else {
+			calc.prevPocLsb = int64(sh.Pic_order_cnt_lsb)
+		}
+	}
+	calc.prevFrameNum = sh.Frame_num
+	calc.prevHasMMCO5 = sh.HasMMCO5
+	if sh.HasMMCO5 {
+		calc.prevFrameNum = 0
+	}
+	return poc
+}
+
+func (calc *H264PocCalculator) pocType0(sh *SliceHeader, sps *SPS) (int64, int64) {
+	if sh.IdrPicFlag {
+		calc.prevPocMsb = 0
+		calc.prevPocLsb = 0
+	}
+	maxPocLsb := int64(1) << (sps.Log2_max_pic_order_cnt_lsb_minus4 + 4)
+	lsb := int64(sh.Pic_order_cnt_lsb)
+	msb := calc.prevPocMsb
+	if lsb < calc.prevPocLsb && calc.prevPocLsb-lsb >= maxPocLsb/2 {
+		msb = calc.prevPocMsb + maxPocLsb
+	} else if lsb > calc.prevPocLsb && lsb-calc.prevPocLsb > maxPocLsb/2 {
+		msb = calc.prevPocMsb - maxPocLsb
+	}
+	if sh.Nal_ref_idc != 0 {
+		calc.prevPocMsb = msb
+	}
+	topPoc := msb + lsb
+	bottomPoc := topPoc
+	if sh.Field_pic_flag == 0 {
+		bottomPoc = topPoc + sh.Delta_pic_order_cnt_bottom
+	}
+	return topPoc, bottomPoc
+}
+
+func (calc *H264PocCalculator) frameNumOffset(sh *SliceHeader, sps *SPS) int64 {
+	prevFrameNumOffset := calc.prevFrameNumOffset
+	if calc.prevHasMMCO5 {
+		prevFrameNumOffset = 0
+	}
+	var frameNumOffset int64
+	if sh.IdrPicFlag {
+		frameNumOffset = 0
+	} else if calc.prevFrameNum > sh.Frame_num {
+		frameNumOffset = prevFrameNumOffset + int64(1)<<(sps.Log2_max_frame_num_minus4+4)
+	} else {
+		frameNumOffset = prevFrameNumOffset
+	}
+	calc.prevFrameNumOffset = frameNumOffset
+	return frameNumOffset
+}
+
+func (calc *H264PocCalculator) pocType1(sh *SliceHeader, sps *SPS) (int64, int64) {
+	frameNumOffset := calc.frameNumOffset(sh, sps)
+	numRefFrames := int64(len(sps.Offset_for_ref_frame))
+	var absFrameNum int64
+	if numRefFrames != 0 {
+		absFrameNum = frameNumOffset + int64(sh.Frame_num)
+	}
+	if sh.Nal_ref_idc == 0 && absFrameNum > 0 {
+		absFrameNum--
+	}
+	var expectedPoc int64
+	if absFrameNum > 0 {
+		var expectedDeltaPerCycle int64
+		for _, offset := range sps.Offset_for_ref_frame {
+			expectedDeltaPerCycle += offset
+		}
+		cycleCnt := (absFrameNum - 1) / numRefFrames
+		frameNumInCycle := (absFrameNum - 1) % numRefFrames
+		expectedPoc = cycleCnt * expectedDeltaPerCycle
+		for i := int64(0); i <= frameNumInCycle; i++ {
+			expectedPoc += sps.Offset_for_ref_frame[i]
+		}
+	}
+	if sh.Nal_ref_idc == 0 {
+		expectedPoc += sps.Offset_for_non_ref_pic
+	}
+	var topPoc, bottomPoc int64
+	if sh.Field_pic_flag == 0 {
+		topPoc = expectedPoc + sh.Delta_pic_order_cnt[0]
+		bottomPoc = topPoc + sps.Offset_for_top_to_bottom_field + sh.Delta_pic_order_cnt[1]
+	} else if sh.Bottom_field_flag == 0 {
+		topPoc = expectedPoc + sh.Delta_pic_order_cnt[0]
+		bottomPoc = topPoc
+	} else {
+		bottomPoc = expectedPoc + sps.Offset_for_top_to_bottom_field + sh.Delta_pic_order_cnt[0]
+		topPoc = bottomPoc
+	}
+	return topPoc, bottomPoc
+}
+
+func (calc *H264PocCalculator) pocType2(sh *SliceHeader, sps *SPS) (int64, int64) {
+	frameNumOffset := calc.frameNumOffset(sh, sps)
+	var tempPoc int64
+	if sh.IdrPicFlag {
+		tempPoc = 0
+	} else if sh.Nal_ref_idc == 0 {
+		tempPoc = 2*(frameNumOffset+int64(sh.Frame_num)) - 1
+	} else {
+		tempPoc = 2 * (frameNumOffset + int64(sh.Frame_num))
+	}
+	return tempPoc, tempPoc
+}
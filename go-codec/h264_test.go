@@ -98,3 +98,140 @@ func TestCreateH264AVCCExtradata(t *testing.T) {
         })
     }
 }
+
+func TestSPS_Decode_VuiBitstreamRestriction(t *testing.T) {
+    tests := []struct {
+        name                 string
+        sps                  []byte
+        wantSarHeight        uint16
+        wantNumReorderFrames uint64
+        wantMaxDecFrameBuf   uint64
+    }{
+        {name: "sps1", sps: sps1, wantSarHeight: 1, wantNumReorderFrames: 1, wantMaxDecFrameBuf: 3},
+        {name: "spss1", sps: CovertRbspToSodb([]byte{0x64, 0x00, 0x0A, 0xAC, 0x72, 0x84, 0x44, 0x26, 0x84, 0x00, 0x00, 0x03,
+            0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xCA, 0x3C, 0x48, 0x96, 0x11, 0x80}), wantSarHeight: 0, wantNumReorderFrames: 2, wantMaxDecFrameBuf: 16},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            sps := &SPS{}
+            sps.Decode(NewBitStream(tt.sps))
+            vui := sps.VuiParameters
+            if vui.SarHeight != tt.wantSarHeight || vui.BitstreamRestrictionFlag != 1 ||
+                vui.NumReorderFrames != tt.wantNumReorderFrames || vui.MaxDecFrameBuffering != tt.wantMaxDecFrameBuf {
+                t.Errorf("SPS.Decode() vui = %+v", vui)
+            }
+        })
+    }
+}
+
+func TestPPS_Decode(t *testing.T) {
+    pps := &PPS{}
+    pps.Decode(NewBitStream([]byte{0xE8, 0x43, 0x8F, 0x13, 0x21, 0x30}))
+    want := PPS{
+        Entropy_coding_mode_flag:               1,
+        Num_ref_idx_l0_default_active_minus1:   15,
+        Weighted_pred_flag:                     1,
+        Weighted_bipred_idc:                    2,
+        Pic_init_qp_minus26:                    -3,
+        Chroma_qp_index_offset:                 -4,
+        Deblocking_filter_control_present_flag: 1,
+        More_rbsp_data:                         true,
+        Transform_8x8_mode_flag:                1,
+        Second_chroma_qp_index_offset:          -4,
+    }
+    if !reflect.DeepEqual(*pps, want) {
+        t.Errorf("PPS.Decode() = %+v, want %+v", *pps, want)
+    }
+}
+
+func TestH264PocCalculator_Type2(t *testing.T) {
+    sps := &SPS{Pic_order_cnt_type: 2, Log2_max_frame_num_minus4: 0}
+    tests := []struct {
+        name string
+        sh   SliceHeader
+        want int64
+    }{
+        {name: "idr", sh: SliceHeader{Frame_num: 0, Nal_ref_idc: 3, IdrPicFlag: true}, want: 0},
+        {name: "p1", sh: SliceHeader{Frame_num: 1, Nal_ref_idc: 2}, want: 2},
+        {name: "non ref", sh: SliceHeader{Frame_num: 2, Nal_ref_idc: 0}, want: 3},
+        {name: "p2", sh: SliceHeader{Frame_num: 2, Nal_ref_idc: 2}, want: 4},
+        {name: "frame_num wrap", sh: SliceHeader{Frame_num: 0, Nal_ref_idc: 2}, want: 32},
+    }
+    calc := NewH264PocCalculator()
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := calc.Calculate(&tt.sh, sps); got != tt.want {
+                t.Errorf("H264PocCalculator.Calculate() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestSPS_Encode(t *testing.T) {
+    tests := []struct {
+        name string
+        nalu []byte
+    }{
+        {name: "sps1", nalu: append([]byte{0x67}, sps1...)},
+        {name: "spss1", nalu: []byte{0x67, 0x64, 0x00, 0x0A, 0xAC, 0x72, 0x84, 0x44, 0x26, 0x84, 0x00, 0x00, 0x03,
+            0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xCA, 0x3C, 0x48, 0x96, 0x11, 0x80}},
+        {name: "without vui", nalu: testH264SPS(-1)[4:]},
+        //VideoToolbox输出的nal_ref_idc为1
+        {name: "nal_ref_idc 1", nalu: append([]byte{0x27}, sps1...)},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            sps := &SPS{}
+            sps.DecodeNalu(tt.nalu)
+            if got := sps.Encode(); !reflect.DeepEqual(got, tt.nalu) {
+                t.Errorf("SPS.Encode() = %x, want %x", got, tt.nalu)
+            }
+        })
+    }
+    //没有从nalu解码时nal_ref_idc为3
+    sps := &SPS{}
+    sps.Decode(NewBitStream(CovertRbspToSodb(sps1)))
+    if got := sps.Encode(); got[0] != 0x67 {
+        t.Errorf("SPS.Encode() nalu header = %x, want 67", got[0])
+    }
+}
+
+func TestSPS_Encode_PatchVui(t *testing.T) {
+    sps := &SPS{}
+    sps.Decode(NewBitStream(CovertRbspToSodb(sps1)))
+    sps.Level_idc = 41
+    sps.Seq_parameter_set_id = 3
+    sps.VuiParameters.NumUnitsInTick = 1001
+    sps.VuiParameters.TimeScale = 60000
+    sps.VuiParameters.BitstreamRestrictionFlag = 0
+    patched := &SPS{}
+    patched.Decode(NewBitStream(CovertRbspToSodb(sps.Encode()[1:])))
+    if !reflect.DeepEqual(patched.VuiParameters.NalHrdParameters, sps.VuiParameters.NalHrdParameters) {
+        t.Errorf("hrd = %+v, want %+v", patched.VuiParameters.NalHrdParameters, sps.VuiParameters.NalHrdParameters)
+    }
+    vui := patched.VuiParameters
+    if patched.Level_idc != 41 || patched.Seq_parameter_set_id != 3 || vui.NumUnitsInTick != 1001 ||
+        vui.TimeScale != 60000 || vui.BitstreamRestrictionFlag != 0 || vui.NumReorderFrames != 0 {
+        t.Errorf("SPS.Encode() patched = %+v", patched)
+    }
+}
+
+func TestPPS_Encode(t *testing.T) {
+    tests := []struct {
+        name string
+        nalu []byte
+    }{
+        {name: "ppss1", nalu: []byte{0x68, 0xE8, 0x43, 0x8F, 0x13, 0x21, 0x30}},
+        {name: "without transform_8x8_mode_flag", nalu: testH264PPS()[4:]},
+        {name: "nal_ref_idc 1", nalu: []byte{0x28, 0xE8, 0x43, 0x8F, 0x13, 0x21, 0x30}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pps := &PPS{}
+            pps.DecodeNalu(tt.nalu)
+            if got := pps.Encode(); !reflect.DeepEqual(got, tt.nalu) {
+                t.Errorf("PPS.Encode() = %x, want %x", got, tt.nalu)
+            }
+        })
+    }
+}
@@ -26,7 +26,23 @@ func (hdr *H265NaluHdr) Decode(bs *BitStream) {
     hdr.Nuh_temporal_id_plus1 = bs.Uint8(3)
 }
 
+// 参数集Encode使用的nalu header, Nal_unit_type为0(没有从nalu解码过)时使用默认值
+func (hdr H265NaluHdr) orDefault(naluType H265_NAL_TYPE) H265NaluHdr {
+    if hdr.Nal_unit_type == 0 {
+        return H265NaluHdr{Nal_unit_type: uint8(naluType), Nuh_temporal_id_plus1: 1}
+    }
+    return hdr
+}
+
+func (hdr *H265NaluHdr) Encode(bsw *BitStreamWriter) {
+    bsw.PutUint8(hdr.Forbidden_zero_bit, 1)
+    bsw.PutUint8(hdr.Nal_unit_type, 6)
+    bsw.PutUint8(hdr.Nuh_layer_id, 6)
+    bsw.PutUint8(hdr.Nuh_temporal_id_plus1, 3)
+}
+
 type VPS struct {
+    NalHdr                                   H265NaluHdr //Decode时保存, Encode时原样写回
     Vps_video_parameter_set_id               uint8
     Vps_base_layer_internal_flag             uint8
     Vps_base_layer_available_flag            uint8
@@ -44,7 +60,8 @@ type VPS struct {
     Layer_id_included_flag                   [][]uint8
     Vps_timing_info_present_flag             uint8
     TimeInfo                                 VPSTimeInfo
-    // Vps_extension_flag                       uint8
+    Vps_extension_flag                       uint8
+    Vps_extension_data_flag                  []uint8 //vps_extension()不解析,按bit原样保存
 }
 
 type VPSTimeInfo struct {
@@ -55,6 +72,7 @@ type VPSTimeInfo struct {
     Vps_num_hrd_parameters              uint64
     Hrd_layer_set_idx                   []uint64
     Cprms_present_flag                  []uint8
+    Hrd_parameters                      []H265HrdParameters
 }
 
 type ProfileTierLevel struct {
@@ -66,14 +84,19 @@ type ProfileTierLevel struct {
     General_level_idc                  uint8
     Sub_layer_profile_present_flag     [8]uint8
     Sub_layer_level_present_flag       [8]uint8
+    Sub_layer_profile_space            [8]uint8
+    Sub_layer_tier_flag                [8]uint8
+    Sub_layer_profile_idc              [8]uint8
+    Sub_layer_profile_compatibility_flag [8]uint32
+    Sub_layer_constraint_indicator_flag  [8]uint64
+    Sub_layer_level_idc                [8]uint8
 }
 
 //nalu without startcode
 func (vps *VPS) Decode(nalu []byte) {
     sodb := CovertRbspToSodb(nalu)
     bs := NewBitStream(sodb)
-    hdr := H265NaluHdr{}
-    hdr.Decode(bs)
+    vps.NalHdr.Decode(bs)
     vps.Vps_video_parameter_set_id = bs.Uint8(4)
     vps.Vps_base_layer_internal_flag = bs.Uint8(1)
     vps.Vps_base_layer_available_flag = bs.Uint8(1)
@@ -108,7 +131,71 @@ func (vps *VPS) Decode(nalu []byte) {
     vps.Vps_timing_info_present_flag = bs.Uint8(1)
     if vps.Vps_timing_info_present_flag == 1 {
         vps.TimeInfo = ParserVPSTimeinfo(bs)
+        vps.decodeHrdParameters(bs)
+    }
+    if !bs.MoreRbspData() {
+        return
+    }
+    vps.Vps_extension_flag = bs.GetBit()
+    if vps.Vps_extension_flag == 1 {
+        vps.Vps_extension_data_flag = readExtensionDataFlags(bs)
+    }
+}
+
+//返回不带startcode的nalu
+func (vps *VPS) Encode() []byte {
+    bsw := NewBitStreamWriter(64)
+    hdr := vps.NalHdr.orDefault(H265_NAL_VPS)
+    hdr.Encode(bsw)
+    bsw.PutUint8(vps.Vps_video_parameter_set_id, 4)
+    bsw.PutUint8(vps.Vps_base_layer_internal_flag, 1)
+    bsw.PutUint8(vps.Vps_base_layer_available_flag, 1)
+    bsw.PutUint8(vps.Vps_max_layers_minus1, 6)
+    bsw.PutUint8(vps.Vps_max_sub_layers_minus1, 3)
+    bsw.PutUint8(vps.Vps_temporal_id_nesting_flag, 1)
+    bsw.PutUint16(vps.Vps_reserved_0xffff_16bits, 16)
+    vps.Ptl.Encode(vps.Vps_max_sub_layers_minus1, bsw)
+    bsw.PutUint8(vps.Vps_sub_layer_ordering_info_present_flag, 1)
+    i := 0
+    if vps.Vps_sub_layer_ordering_info_present_flag == 0 {
+        i = int(vps.Vps_max_sub_layers_minus1)
+    }
+    for ; i <= int(vps.Vps_max_sub_layers_minus1); i++ {
+        bsw.PutUE(vps.Vps_max_dec_pic_buffering_minus1[i])
+        bsw.PutUE(vps.Vps_max_num_reorder_pics[i])
+        bsw.PutUE(vps.Vps_max_latency_increase_plus1[i])
+    }
+    bsw.PutUint8(vps.Vps_max_layer_id, 6)
+    bsw.PutUE(vps.Vps_num_layer_sets_minus1)
+    for i := 1; i <= int(vps.Vps_num_layer_sets_minus1); i++ {
+        for j := 0; j <= int(vps.Vps_max_layer_id); j++ {
+            bsw.PutUint8(vps.Layer_id_included_flag[i][j], 1)
+        }
+    }
+    bsw.PutUint8(vps.Vps_timing_info_present_flag, 1)
+    if vps.Vps_timing_info_present_flag == 1 {
+        ti := &vps.TimeInfo
+        bsw.PutUint32(ti.Vps_num_units_in_tick, 32)
+        bsw.PutUint32(ti.Vps_time_scale, 32)
+        bsw.PutUint8(ti.Vps_poc_proportional_to_timing_flag, 1)
+        if ti.Vps_poc_proportional_to_timing_flag == 1 {
+            bsw.PutUE(ti.Vps_num_ticks_poc_diff_one_minus1)
+        }
+        bsw.PutUE(ti.Vps_num_hrd_parameters)
+        for i := 0; i < int(ti.Vps_num_hrd_parameters); i++ {
+            bsw.PutUE(ti.Hrd_layer_set_idx[i])
+            if i > 0 {
+                bsw.PutUint8(ti.Cprms_present_flag[i], 1)
+            }
+            ti.Hrd_parameters[i].Encode(bsw, ti.Cprms_present_flag[i], vps.Vps_max_sub_layers_minus1)
+        }
     }
+    bsw.PutUint8(vps.Vps_extension_flag, 1)
+    if vps.Vps_extension_flag == 1 {
+        writeExtensionDataFlags(bsw, vps.Vps_extension_data_flag)
+    }
+    bsw.PutRbspTrailingBits()
+    return CovertSodbToRbsp(bsw.Bits())
 }
 
 //ffmpeg hevc.c
@@ -144,15 +231,49 @@ func Profile_tier_level(profilePresentFlag uint8, maxNumSubLayersMinus1 uint8, b
              * sub_layer_frame_only_constraint_flag[i]        u(1)
              * sub_layer_reserved_zero_44bits[i]              u(44)
              */
-            bs.SkipBits(88)
+            ptl.Sub_layer_profile_space[i] = bs.Uint8(2)
+            ptl.Sub_layer_tier_flag[i] = bs.Uint8(1)
+            ptl.Sub_layer_profile_idc[i] = bs.Uint8(5)
+            ptl.Sub_layer_profile_compatibility_flag[i] = bs.Uint32(32)
+            ptl.Sub_layer_constraint_indicator_flag[i] = bs.GetBits(48)
         }
         if ptl.Sub_layer_level_present_flag[i] == 1 {
-            bs.SkipBits(8)
+            ptl.Sub_layer_level_idc[i] = bs.Uint8(8)
         }
     }
     return ptl
 }
 
+func (ptl *ProfileTierLevel) Encode(maxNumSubLayersMinus1 uint8, bsw *BitStreamWriter) {
+    bsw.PutUint8(ptl.General_profile_space, 2)
+    bsw.PutUint8(ptl.General_tier_flag, 1)
+    bsw.PutUint8(ptl.General_profile_idc, 5)
+    bsw.PutUint32(ptl.General_profile_compatibility_flag, 32)
+    bsw.PutUint64(ptl.General_constraint_indicator_flag, 48)
+    bsw.PutUint8(ptl.General_level_idc, 8)
+    for i := 0; i < int(maxNumSubLayersMinus1); i++ {
+        bsw.PutUint8(ptl.Sub_layer_profile_present_flag[i], 1)
+        bsw.PutUint8(ptl.Sub_layer_level_present_flag[i], 1)
+    }
+    if maxNumSubLayersMinus1 > 0 {
+        for i := maxNumSubLayersMinus1; i < 8; i++ {
+            bsw.PutUint8(0, 2)
+        }
+    }
+    for i := 0; i < int(maxNumSubLayersMinus1); i++ {
+        if ptl.Sub_layer_profile_present_flag[i] == 1 {
+            bsw.PutUint8(ptl.Sub_layer_profile_space[i], 2)
+            bsw.PutUint8(ptl.Sub_layer_tier_flag[i], 1)
+            bsw.PutUint8(ptl.Sub_layer_profile_idc[i], 5)
+            bsw.PutUint32(ptl.Sub_layer_profile_compatibility_flag[i], 32)
+            bsw.PutUint64(ptl.Sub_layer_constraint_indicator_flag[i], 48)
+        }
+        if ptl.Sub_layer_level_present_flag[i] == 1 {
+            bsw.PutUint8(ptl.Sub_layer_level_idc[i], 8)
+        }
+    }
+}
+
 func ParserVPSTimeinfo(bs *BitStream) VPSTimeInfo {
     var ti VPSTimeInfo
     ti.Vps_num_units_in_tick = bs.Uint32(32)
@@ -162,23 +283,51 @@ func ParserVPSTimeinfo(bs *BitStream) VPSTimeInfo {
         ti.Vps_num_ticks_poc_diff_one_minus1 = bs.ReadUE()
     }
     ti.Vps_num_hrd_parameters = bs.ReadUE()
-    // for i := 0; i < int(ti.Vps_num_hrd_parameters); i++ {
-    //     ti.Hrd_layer_set_idx[i] = bs.ReadUE()
-    //     if i > 0 {
-    //         ti.Cprms_present_flag[i] = bs.Uint8(1)
-    //     }
-    //     //Hrd_parameters(ti.Cprms_present_flag[i])
-    // }
     return ti
 }
 
+func (vps *VPS) decodeHrdParameters(bs *BitStream) {
+    ti := &vps.TimeInfo
+    if ti.Vps_num_hrd_parameters > 1024 {
+        panic("vps_num_hrd_parameters > 1024")
+    }
+    ti.Hrd_layer_set_idx = make([]uint64, ti.Vps_num_hrd_parameters)
+    ti.Cprms_present_flag = make([]uint8, ti.Vps_num_hrd_parameters)
+    ti.Hrd_parameters = make([]H265HrdParameters, ti.Vps_num_hrd_parameters)
+    for i := 0; i < int(ti.Vps_num_hrd_parameters); i++ {
+        ti.Hrd_layer_set_idx[i] = bs.ReadUE()
+        ti.Cprms_present_flag[i] = 1
+        if i > 0 {
+            ti.Cprms_present_flag[i] = bs.Uint8(1)
+        }
+        ti.Hrd_parameters[i].Decode(bs, ti.Cprms_present_flag[i], vps.Vps_max_sub_layers_minus1)
+    }
+}
+
+// 扩展数据不解析, 按bit保存到rbsp_trailing_bits之前
+func readExtensionDataFlags(bs *BitStream) []uint8 {
+    var flags []uint8
+    for bs.MoreRbspData() {
+        flags = append(flags, bs.GetBit())
+    }
+    return flags
+}
+
+func writeExtensionDataFlags(bsw *BitStreamWriter, flags []uint8) {
+    for _, flag := range flags {
+        bsw.PutUint8(flag, 1)
+    }
+}
+
 type H265RawSPS struct {
+    NalHdr                                   H265NaluHdr //Decode时保存, Encode时原样写回
     Sps_video_parameter_set_id               uint8
     Sps_max_sub_layers_minus1                uint8
     Sps_temporal_id_nesting_flag             uint8
     Ptl                                      ProfileTierLevel
     Sps_seq_parameter_set_id                 uint64
     Chroma_format_idc                        uint64
+    Separate_colour_plane_flag               uint8
     Pic_width_in_luma_samples                uint64
     Pic_height_in_luma_samples               uint64
     Conformance_window_flag                  uint8
@@ -190,16 +339,59 @@ type H265RawSPS struct {
     Bit_depth_chroma_minus8                  uint64
     Log2_max_pic_order_cnt_lsb_minus4        uint64
     Sps_sub_layer_ordering_info_present_flag uint8
+    Sps_max_dec_pic_buffering_minus1         [8]uint64
+    Sps_max_num_reorder_pics                 [8]uint64
+    Sps_max_latency_increase_plus1           [8]uint64
+    Log2_min_luma_coding_block_size_minus3   uint64
+    Log2_diff_max_min_luma_coding_block_size uint64
+    Log2_min_luma_transform_block_size_minus2   uint64
+    Log2_diff_max_min_luma_transform_block_size uint64
+    Max_transform_hierarchy_depth_inter      uint64
+    Max_transform_hierarchy_depth_intra      uint64
+    Scaling_list_enabled_flag                uint8
+    Sps_scaling_list_data_present_flag       uint8
+    Scaling_list_data                        H265ScalingListData
+    Amp_enabled_flag                         uint8
+    Sample_adaptive_offset_enabled_flag      uint8
+    Pcm_enabled_flag                         uint8
+    Pcm_sample_bit_depth_luma_minus1         uint8
+    Pcm_sample_bit_depth_chroma_minus1       uint8
+    Log2_min_pcm_luma_coding_block_size_minus3 uint64
+    Log2_diff_max_min_pcm_luma_coding_block_size uint64
+    Pcm_loop_filter_disabled_flag            uint8
+    Num_short_term_ref_pic_sets              uint64
+    St_ref_pic_set                           []H265ShortTermRefPicSet
+    Long_term_ref_pics_present_flag          uint8
+    Num_long_term_ref_pics_sps               uint64
+    Lt_ref_pic_poc_lsb_sps                   []uint64
+    Used_by_curr_pic_lt_sps_flag             []uint8
+    Sps_temporal_mvp_enabled_flag            uint8
+    Strong_intra_smoothing_enabled_flag      uint8
     Vui_parameters_present_flag              uint8
     Vui                                      VUI_Parameters
+    Sps_extension_present_flag               uint8
+    Sps_range_extension_flag                 uint8
+    Sps_multilayer_extension_flag            uint8
+    Sps_3d_extension_flag                    uint8
+    Sps_scc_extension_flag                   uint8
+    Sps_extension_4bits                      uint8
+    Transform_skip_rotation_enabled_flag     uint8
+    Transform_skip_context_enabled_flag      uint8
+    Implicit_rdpcm_enabled_flag              uint8
+    Explicit_rdpcm_enabled_flag              uint8
+    Extended_precision_processing_flag       uint8
+    Intra_smoothing_disabled_flag            uint8
+    High_precision_offsets_enabled_flag      uint8
+    Persistent_rice_adaptation_enabled_flag  uint8
+    Cabac_bypass_alignment_enabled_flag      uint8
+    Sps_extension_data_flag                  []uint8 //multilayer/3d/scc扩展不解析,按bit原样保存
 }
 
 //nalu without startcode
 func (sps *H265RawSPS) Decode(nalu []byte) {
     sodb := CovertRbspToSodb(nalu)
     bs := NewBitStream(sodb)
-    hdr := H265NaluHdr{}
-    hdr.Decode(bs)
+    sps.NalHdr.Decode(bs)
     sps.Sps_video_parameter_set_id = bs.Uint8(4)
     sps.Sps_max_sub_layers_minus1 = bs.Uint8(3)
     sps.Sps_temporal_id_nesting_flag = bs.Uint8(1)
@@ -207,7 +399,7 @@ func (sps *H265RawSPS) Decode(nalu []byte) {
     sps.Sps_seq_parameter_set_id = bs.ReadUE()
     sps.Chroma_format_idc = bs.ReadUE()
     if sps.Chroma_format_idc == 3 {
-        bs.SkipBits(1)
+        sps.Separate_colour_plane_flag = bs.Uint8(1)
     }
     sps.Pic_width_in_luma_samples = bs.ReadUE()
     sps.Pic_height_in_luma_samples = bs.ReadUE()
@@ -227,71 +419,248 @@ func (sps *H265RawSPS) Decode(nalu []byte) {
         i = int(sps.Sps_max_sub_layers_minus1)
     }
     for ; i <= int(sps.Sps_max_sub_layers_minus1); i++ {
-        bs.ReadUE()
-        bs.ReadUE()
-        bs.ReadUE()
-    }
-
-    bs.ReadUE() // log2_min_luma_coding_block_size_minus3
-    bs.ReadUE() // log2_diff_max_min_luma_coding_block_size
-    bs.ReadUE() // log2_min_transform_block_size_minus2
-    bs.ReadUE() // log2_diff_max_min_transform_block_size
-    bs.ReadUE() // max_transform_hierarchy_depth_inter
-    bs.ReadUE() // max_transform_hierarchy_depth_intra
-    scaling_list_enabled_flag := bs.GetBit()
-    if scaling_list_enabled_flag > 0 {
-        sps_scaling_list_data_present_flag := bs.GetBit()
-        if sps_scaling_list_data_present_flag > 0 {
-            scaling_list_data(bs)
-        }
-    }
-
-    bs.SkipBits(1)
-    bs.SkipBits(1)
-    if bs.GetBit() == 1 {
-        bs.GetBits(4)
-        bs.GetBits(4)
-        bs.ReadUE()
-        bs.ReadUE()
-        bs.GetBit()
+        sps.Sps_max_dec_pic_buffering_minus1[i] = bs.ReadUE()
+        sps.Sps_max_num_reorder_pics[i] = bs.ReadUE()
+        sps.Sps_max_latency_increase_plus1[i] = bs.ReadUE()
     }
-    num_short_term_ref_pic_sets := bs.ReadUE()
-    if num_short_term_ref_pic_sets > 64 {
+    if sps.Sps_sub_layer_ordering_info_present_flag == 0 {
+        for i := 0; i < int(sps.Sps_max_sub_layers_minus1); i++ {
+            sps.Sps_max_dec_pic_buffering_minus1[i] = sps.Sps_max_dec_pic_buffering_minus1[sps.Sps_max_sub_layers_minus1]
+            sps.Sps_max_num_reorder_pics[i] = sps.Sps_max_num_reorder_pics[sps.Sps_max_sub_layers_minus1]
+            sps.Sps_max_latency_increase_plus1[i] = sps.Sps_max_latency_increase_plus1[sps.Sps_max_sub_layers_minus1]
+        }
+    }
+
+    sps.Log2_min_luma_coding_block_size_minus3 = bs.ReadUE()
+    sps.Log2_diff_max_min_luma_coding_block_size = bs.ReadUE()
+    sps.Log2_min_luma_transform_block_size_minus2 = bs.ReadUE()
+    sps.Log2_diff_max_min_luma_transform_block_size = bs.ReadUE()
+    sps.Max_transform_hierarchy_depth_inter = bs.ReadUE()
+    sps.Max_transform_hierarchy_depth_intra = bs.ReadUE()
+    sps.Scaling_list_enabled_flag = bs.GetBit()
+    if sps.Scaling_list_enabled_flag > 0 {
+        sps.Sps_scaling_list_data_present_flag = bs.GetBit()
+        if sps.Sps_scaling_list_data_present_flag > 0 {
+            sps.Scaling_list_data.Decode(bs)
+        }
+    }
+
+    sps.Amp_enabled_flag = bs.GetBit()
+    sps.Sample_adaptive_offset_enabled_flag = bs.GetBit()
+    sps.Pcm_enabled_flag = bs.GetBit()
+    if sps.Pcm_enabled_flag == 1 {
+        sps.Pcm_sample_bit_depth_luma_minus1 = bs.Uint8(4)
+        sps.Pcm_sample_bit_depth_chroma_minus1 = bs.Uint8(4)
+        sps.Log2_min_pcm_luma_coding_block_size_minus3 = bs.ReadUE()
+        sps.Log2_diff_max_min_pcm_luma_coding_block_size = bs.ReadUE()
+        sps.Pcm_loop_filter_disabled_flag = bs.GetBit()
+    }
+    sps.Num_short_term_ref_pic_sets = bs.ReadUE()
+    if sps.Num_short_term_ref_pic_sets > 64 {
         panic("beyond HEVC_MAX_SHORT_TERM_REF_PIC_SETS")
     }
-    var num_delta_pocs [64]uint32
-    for i := 0; i < int(num_short_term_ref_pic_sets); i++ {
-        parse_rps(i, num_short_term_ref_pic_sets, num_delta_pocs, bs)
+    sps.St_ref_pic_set = make([]H265ShortTermRefPicSet, sps.Num_short_term_ref_pic_sets)
+    for i := 0; i < int(sps.Num_short_term_ref_pic_sets); i++ {
+        sps.St_ref_pic_set[i].Decode(bs, i, sps.St_ref_pic_set)
     }
-    if bs.GetBit() == 1 {
-        num_long_term_ref_pics_sps := bs.ReadUE()
-        for i := 0; i < int(num_long_term_ref_pics_sps); i++ {
-            length := Min(int(sps.Log2_max_pic_order_cnt_lsb_minus4+4), 16)
-            bs.SkipBits(length)
-            bs.SkipBits(1)
+    sps.Long_term_ref_pics_present_flag = bs.GetBit()
+    if sps.Long_term_ref_pics_present_flag == 1 {
+        sps.Num_long_term_ref_pics_sps = bs.ReadUE()
+        if sps.Num_long_term_ref_pics_sps > 32 {
+            panic("beyond HEVC_MAX_LONG_TERM_REF_PICS")
+        }
+        sps.Lt_ref_pic_poc_lsb_sps = make([]uint64, sps.Num_long_term_ref_pics_sps)
+        sps.Used_by_curr_pic_lt_sps_flag = make([]uint8, sps.Num_long_term_ref_pics_sps)
+        for i := 0; i < int(sps.Num_long_term_ref_pics_sps); i++ {
+            sps.Lt_ref_pic_poc_lsb_sps[i] = bs.GetBits(int(sps.Log2_max_pic_order_cnt_lsb_minus4 + 4))
+            sps.Used_by_curr_pic_lt_sps_flag[i] = bs.GetBit()
         }
     }
-    bs.SkipBits(1)
-    bs.SkipBits(1)
+    sps.Sps_temporal_mvp_enabled_flag = bs.GetBit()
+    sps.Strong_intra_smoothing_enabled_flag = bs.GetBit()
     sps.Vui_parameters_present_flag = bs.GetBit()
     if sps.Vui_parameters_present_flag == 1 {
         sps.Vui.Decode(bs, sps.Sps_max_sub_layers_minus1)
     }
+    // 部分码流的sps没有rbsp_trailing_bits
+    if !bs.MoreRbspData() {
+        return
+    }
+    sps.Sps_extension_present_flag = bs.GetBit()
+    if sps.Sps_extension_present_flag == 0 {
+        return
+    }
+    sps.Sps_range_extension_flag = bs.GetBit()
+    sps.Sps_multilayer_extension_flag = bs.GetBit()
+    sps.Sps_3d_extension_flag = bs.GetBit()
+    sps.Sps_scc_extension_flag = bs.GetBit()
+    sps.Sps_extension_4bits = bs.Uint8(4)
+    if sps.Sps_range_extension_flag == 1 {
+        sps.Transform_skip_rotation_enabled_flag = bs.GetBit()
+        sps.Transform_skip_context_enabled_flag = bs.GetBit()
+        sps.Implicit_rdpcm_enabled_flag = bs.GetBit()
+        sps.Explicit_rdpcm_enabled_flag = bs.GetBit()
+        sps.Extended_precision_processing_flag = bs.GetBit()
+        sps.Intra_smoothing_disabled_flag = bs.GetBit()
+        sps.High_precision_offsets_enabled_flag = bs.GetBit()
+        sps.Persistent_rice_adaptation_enabled_flag = bs.GetBit()
+        sps.Cabac_bypass_alignment_enabled_flag = bs.GetBit()
+    }
+    if sps.Sps_multilayer_extension_flag == 1 || sps.Sps_3d_extension_flag == 1 ||
+        sps.Sps_scc_extension_flag == 1 || sps.Sps_extension_4bits > 0 {
+        sps.Sps_extension_data_flag = readExtensionDataFlags(bs)
+    }
+}
+
+//返回不带startcode的nalu
+func (sps *H265RawSPS) Encode() []byte {
+    bsw := NewBitStreamWriter(64)
+    hdr := sps.NalHdr.orDefault(H265_NAL_SPS)
+    hdr.Encode(bsw)
+    bsw.PutUint8(sps.Sps_video_parameter_set_id, 4)
+    bsw.PutUint8(sps.Sps_max_sub_layers_minus1, 3)
+    bsw.PutUint8(sps.Sps_temporal_id_nesting_flag, 1)
+    sps.Ptl.Encode(sps.Sps_max_sub_layers_minus1, bsw)
+    bsw.PutUE(sps.Sps_seq_parameter_set_id)
+    bsw.PutUE(sps.Chroma_format_idc)
+    if sps.Chroma_format_idc == 3 {
+        bsw.PutUint8(sps.Separate_colour_plane_flag, 1)
+    }
+    bsw.PutUE(sps.Pic_width_in_luma_samples)
+    bsw.PutUE(sps.Pic_height_in_luma_samples)
+    bsw.PutUint8(sps.Conformance_window_flag, 1)
+    if sps.Conformance_window_flag == 1 {
+        bsw.PutUE(sps.Conf_win_left_offset)
+        bsw.PutUE(sps.Conf_win_right_offset)
+        bsw.PutUE(sps.Conf_win_top_offset)
+        bsw.PutUE(sps.Conf_win_bottom_offset)
+    }
+    bsw.PutUE(sps.Bit_depth_luma_minus8)
+    bsw.PutUE(sps.Bit_depth_chroma_minus8)
+    bsw.PutUE(sps.Log2_max_pic_order_cnt_lsb_minus4)
+    bsw.PutUint8(sps.Sps_sub_layer_ordering_info_present_flag, 1)
+    i := 0
+    if sps.Sps_sub_layer_ordering_info_present_flag == 0 {
+        i = int(sps.Sps_max_sub_layers_minus1)
+    }
+    for ; i <= int(sps.Sps_max_sub_layers_minus1); i++ {
+        bsw.PutUE(sps.Sps_max_dec_pic_buffering_minus1[i])
+        bsw.PutUE(sps.Sps_max_num_reorder_pics[i])
+        bsw.PutUE(sps.Sps_max_latency_increase_plus1[i])
+    }
+    bsw.PutUE(sps.Log2_min_luma_coding_block_size_minus3)
+    bsw.PutUE(sps.Log2_diff_max_min_luma_coding_block_size)
+    bsw.PutUE(sps.Log2_min_luma_transform_block_size_minus2)
+    bsw.PutUE(sps.Log2_diff_max_min_luma_transform_block_size)
+    bsw.PutUE(sps.Max_transform_hierarchy_depth_inter)
+    bsw.PutUE(sps.Max_transform_hierarchy_depth_intra)
+    bsw.PutUint8(sps.Scaling_list_enabled_flag, 1)
+    if sps.Scaling_list_enabled_flag > 0 {
+        bsw.PutUint8(sps.Sps_scaling_list_data_present_flag, 1)
+        if sps.Sps_scaling_list_data_present_flag > 0 {
+            sps.Scaling_list_data.Encode(bsw)
+        }
+    }
+    bsw.PutUint8(sps.Amp_enabled_flag, 1)
+    bsw.PutUint8(sps.Sample_adaptive_offset_enabled_flag, 1)
+    bsw.PutUint8(sps.Pcm_enabled_flag, 1)
+    if sps.Pcm_enabled_flag == 1 {
+        bsw.PutUint8(sps.Pcm_sample_bit_depth_luma_minus1, 4)
+        bsw.PutUint8(sps.Pcm_sample_bit_depth_chroma_minus1, 4)
+        bsw.PutUE(sps.Log2_min_pcm_luma_coding_block_size_minus3)
+        bsw.PutUE(sps.Log2_diff_max_min_pcm_luma_coding_block_size)
+        bsw.PutUint8(sps.Pcm_loop_filter_disabled_flag, 1)
+    }
+    bsw.PutUE(sps.Num_short_term_ref_pic_sets)
+    for i := 0; i < int(sps.Num_short_term_ref_pic_sets); i++ {
+        sps.St_ref_pic_set[i].Encode(bsw, i, sps.St_ref_pic_set)
+    }
+    bsw.PutUint8(sps.Long_term_ref_pics_present_flag, 1)
+    if sps.Long_term_ref_pics_present_flag == 1 {
+        bsw.PutUE(sps.Num_long_term_ref_pics_sps)
+        for i := 0; i < int(sps.Num_long_term_ref_pics_sps); i++ {
+            bsw.PutUint64(sps.Lt_ref_pic_poc_lsb_sps[i], int(sps.Log2_max_pic_order_cnt_lsb_minus4+4))
+            bsw.PutUint8(sps.Used_by_curr_pic_lt_sps_flag[i], 1)
+        }
+    }
+    bsw.PutUint8(sps.Sps_temporal_mvp_enabled_flag, 1)
+    bsw.PutUint8(sps.Strong_intra_smoothing_enabled_flag, 1)
+    bsw.PutUint8(sps.Vui_parameters_present_flag, 1)
+    if sps.Vui_parameters_present_flag == 1 {
+        sps.Vui.Encode(bsw, sps.Sps_max_sub_layers_minus1)
+    }
+    bsw.PutUint8(sps.Sps_extension_present_flag, 1)
+    if sps.Sps_extension_present_flag == 1 {
+        bsw.PutUint8(sps.Sps_range_extension_flag, 1)
+        bsw.PutUint8(sps.Sps_multilayer_extension_flag, 1)
+        bsw.PutUint8(sps.Sps_3d_extension_flag, 1)
+        bsw.PutUint8(sps.Sps_scc_extension_flag, 1)
+        bsw.PutUint8(sps.Sps_extension_4bits, 4)
+        if sps.Sps_range_extension_flag == 1 {
+            bsw.PutUint8(sps.Transform_skip_rotation_enabled_flag, 1)
+            bsw.PutUint8(sps.Transform_skip_context_enabled_flag, 1)
+            bsw.PutUint8(sps.Implicit_rdpcm_enabled_flag, 1)
+            bsw.PutUint8(sps.Explicit_rdpcm_enabled_flag, 1)
+            bsw.PutUint8(sps.Extended_precision_processing_flag, 1)
+            bsw.PutUint8(sps.Intra_smoothing_disabled_flag, 1)
+            bsw.PutUint8(sps.High_precision_offsets_enabled_flag, 1)
+            bsw.PutUint8(sps.Persistent_rice_adaptation_enabled_flag, 1)
+            bsw.PutUint8(sps.Cabac_bypass_alignment_enabled_flag, 1)
+        }
+        writeExtensionDataFlags(bsw, sps.Sps_extension_data_flag)
+    }
+    bsw.PutRbspTrailingBits()
+    return CovertSodbToRbsp(bsw.Bits())
+}
+
+func (sps *H265RawSPS) ChromaArrayType() uint64 {
+    if sps.Separate_colour_plane_flag == 1 {
+        return 0
+    }
+    return sps.Chroma_format_idc
+}
+
+// PicSizeInCtbsY
+func (sps *H265RawSPS) PicSizeInCtbsY() uint64 {
+    ctbLog2SizeY := sps.Log2_min_luma_coding_block_size_minus3 + 3 + sps.Log2_diff_max_min_luma_coding_block_size
+    ctbSizeY := uint64(1) << ctbLog2SizeY
+    picWidthInCtbsY := (sps.Pic_width_in_luma_samples + ctbSizeY - 1) / ctbSizeY
+    picHeightInCtbsY := (sps.Pic_height_in_luma_samples + ctbSizeY - 1) / ctbSizeY
+    return picWidthInCtbsY * picHeightInCtbsY
 }
 
 type VUI_Parameters struct {
     Aspect_ratio_info_present_flag          uint8
+    Aspect_ratio_idc                        uint8
+    Sar_width                               uint16
+    Sar_height                              uint16
     Overscan_info_present_flag              uint8
+    Overscan_appropriate_flag               uint8
+    Video_signal_type_present_flag          uint8
+    Video_format                            uint8
+    Video_full_range_flag                   uint8
+    Colour_description_present_flag         uint8
+    Colour_primaries                        uint8
+    Transfer_characteristics                uint8
+    Matrix_coeffs                           uint8
     Chroma_loc_info_present_flag            uint8
+    Chroma_sample_loc_type_top_field        uint64
+    Chroma_sample_loc_type_bottom_field     uint64
     Neutral_chroma_indication_flag          uint8
     Field_seq_flag                          uint8
     Frame_field_info_present_flag           uint8
     Default_display_window_flag             uint8
+    Def_disp_win_left_offset                uint64
+    Def_disp_win_right_offset               uint64
+    Def_disp_win_top_offset                 uint64
+    Def_disp_win_bottom_offset              uint64
     Vui_timing_info_present_flag            uint8
     Vui_num_units_in_tick                   uint32
     Vui_time_scale                          uint32
     Vui_poc_proportional_to_timing_flag     uint8
+    Vui_num_ticks_poc_diff_one_minus1       uint64
     Vui_hrd_parameters_present_flag         uint8
+    Hrd_parameters                          H265HrdParameters
     Bitstream_restriction_flag              uint8
     Tiles_fixed_structure_flag              uint8
     Motion_vectors_over_pic_boundaries_flag uint8
@@ -306,34 +675,41 @@ type VUI_Parameters struct {
 func (vui *VUI_Parameters) Decode(bs *BitStream, max_sub_layers_minus1 uint8) {
     vui.Aspect_ratio_info_present_flag = bs.Uint8(1)
     if vui.Aspect_ratio_info_present_flag == 1 {
-        if bs.Uint8(8) == 255 {
-            bs.SkipBits(32)
+        vui.Aspect_ratio_idc = bs.Uint8(8)
+        if vui.Aspect_ratio_idc == 255 {
+            vui.Sar_width = bs.Uint16(16)
+            vui.Sar_height = bs.Uint16(16)
         }
     }
     vui.Overscan_info_present_flag = bs.Uint8(1)
     if vui.Overscan_info_present_flag == 1 {
-        bs.SkipBits(1)
+        vui.Overscan_appropriate_flag = bs.GetBit()
     }
-    if bs.GetBit() == 1 {
-        bs.SkipBits(4)
-        if bs.GetBit() == 1 {
-            bs.SkipBits(24)
+    vui.Video_signal_type_present_flag = bs.GetBit()
+    if vui.Video_signal_type_present_flag == 1 {
+        vui.Video_format = bs.Uint8(3)
+        vui.Video_full_range_flag = bs.GetBit()
+        vui.Colour_description_present_flag = bs.GetBit()
+        if vui.Colour_description_present_flag == 1 {
+            vui.Colour_primaries = bs.Uint8(8)
+            vui.Transfer_characteristics = bs.Uint8(8)
+            vui.Matrix_coeffs = bs.Uint8(8)
         }
     }
     vui.Chroma_loc_info_present_flag = bs.GetBit()
     if vui.Chroma_loc_info_present_flag == 1 {
-        bs.ReadUE()
-        bs.ReadUE()
+        vui.Chroma_sample_loc_type_top_field = bs.ReadUE()
+        vui.Chroma_sample_loc_type_bottom_field = bs.ReadUE()
     }
     vui.Neutral_chroma_indication_flag = bs.GetBit()
     vui.Field_seq_flag = bs.GetBit()
     vui.Frame_field_info_present_flag = bs.GetBit()
     vui.Default_display_window_flag = bs.GetBit()
     if vui.Default_display_window_flag == 1 {
-        bs.ReadUE()
-        bs.ReadUE()
-        bs.ReadUE()
-        bs.ReadUE()
+        vui.Def_disp_win_left_offset = bs.ReadUE()
+        vui.Def_disp_win_right_offset = bs.ReadUE()
+        vui.Def_disp_win_top_offset = bs.ReadUE()
+        vui.Def_disp_win_bottom_offset = bs.ReadUE()
     }
     vui.Vui_timing_info_present_flag = bs.GetBit()
     if vui.Vui_timing_info_present_flag == 1 {
@@ -341,11 +717,11 @@ func (vui *VUI_Parameters) Decode(bs *BitStream, max_sub_layers_minus1 uint8) {
         vui.Vui_time_scale = bs.Uint32(32)
         vui.Vui_poc_proportional_to_timing_flag = bs.GetBit()
         if vui.Vui_poc_proportional_to_timing_flag == 1 {
-            bs.ReadUE()
+            vui.Vui_num_ticks_poc_diff_one_minus1 = bs.ReadUE()
         }
         vui.Vui_hrd_parameters_present_flag = bs.GetBit()
         if vui.Vui_hrd_parameters_present_flag == 1 {
-            skip_hrd_parameters(1, uint32(max_sub_layers_minus1), bs)
+            vui.Hrd_parameters.Decode(bs, 1, max_sub_layers_minus1)
         }
     }
     vui.Bitstream_restriction_flag = bs.GetBit()
@@ -361,139 +737,450 @@ func (vui *VUI_Parameters) Decode(bs *BitStream, max_sub_layers_minus1 uint8) {
     }
 }
 
-func skip_hrd_parameters(cprms_present_flag uint8, max_sub_layers_minus1 uint32, bs *BitStream) {
-    nal_hrd_parameters_present_flag := uint8(0)
-    vcl_hrd_parameters_present_flag := uint8(0)
-    sub_pic_hrd_params_present_flag := uint8(0)
-    if cprms_present_flag == 1 {
-        nal_hrd_parameters_present_flag = bs.GetBit()
-        vcl_hrd_parameters_present_flag = bs.GetBit()
-
-        if nal_hrd_parameters_present_flag == 1 || vcl_hrd_parameters_present_flag == 1 {
-            sub_pic_hrd_params_present_flag = bs.GetBit()
+func (vui *VUI_Parameters) Encode(bsw *BitStreamWriter, max_sub_layers_minus1 uint8) {
+    bsw.PutUint8(vui.Aspect_ratio_info_present_flag, 1)
+    if vui.Aspect_ratio_info_present_flag == 1 {
+        bsw.PutUint8(vui.Aspect_ratio_idc, 8)
+        if vui.Aspect_ratio_idc == 255 {
+            bsw.PutUint16(vui.Sar_width, 16)
+            bsw.PutUint16(vui.Sar_height, 16)
+        }
+    }
+    bsw.PutUint8(vui.Overscan_info_present_flag, 1)
+    if vui.Overscan_info_present_flag == 1 {
+        bsw.PutUint8(vui.Overscan_appropriate_flag, 1)
+    }
+    bsw.PutUint8(vui.Video_signal_type_present_flag, 1)
+    if vui.Video_signal_type_present_flag == 1 {
+        bsw.PutUint8(vui.Video_format, 3)
+        bsw.PutUint8(vui.Video_full_range_flag, 1)
+        bsw.PutUint8(vui.Colour_description_present_flag, 1)
+        if vui.Colour_description_present_flag == 1 {
+            bsw.PutUint8(vui.Colour_primaries, 8)
+            bsw.PutUint8(vui.Transfer_characteristics, 8)
+            bsw.PutUint8(vui.Matrix_coeffs, 8)
+        }
+    }
+    bsw.PutUint8(vui.Chroma_loc_info_present_flag, 1)
+    if vui.Chroma_loc_info_present_flag == 1 {
+        bsw.PutUE(vui.Chroma_sample_loc_type_top_field)
+        bsw.PutUE(vui.Chroma_sample_loc_type_bottom_field)
+    }
+    bsw.PutUint8(vui.Neutral_chroma_indication_flag, 1)
+    bsw.PutUint8(vui.Field_seq_flag, 1)
+    bsw.PutUint8(vui.Frame_field_info_present_flag, 1)
+    bsw.PutUint8(vui.Default_display_window_flag, 1)
+    if vui.Default_display_window_flag == 1 {
+        bsw.PutUE(vui.Def_disp_win_left_offset)
+        bsw.PutUE(vui.Def_disp_win_right_offset)
+        bsw.PutUE(vui.Def_disp_win_top_offset)
+        bsw.PutUE(vui.Def_disp_win_bottom_offset)
+    }
+    bsw.PutUint8(vui.Vui_timing_info_present_flag, 1)
+    if vui.Vui_timing_info_present_flag == 1 {
+        bsw.PutUint32(vui.Vui_num_units_in_tick, 32)
+        bsw.PutUint32(vui.Vui_time_scale, 32)
+        bsw.PutUint8(vui.Vui_poc_proportional_to_timing_flag, 1)
+        if vui.Vui_poc_proportional_to_timing_flag == 1 {
+            bsw.PutUE(vui.Vui_num_ticks_poc_diff_one_minus1)
+        }
+        bsw.PutUint8(vui.Vui_hrd_parameters_present_flag, 1)
+        if vui.Vui_hrd_parameters_present_flag == 1 {
+            vui.Hrd_parameters.Encode(bsw, 1, max_sub_layers_minus1)
+        }
+    }
+    bsw.PutUint8(vui.Bitstream_restriction_flag, 1)
+    if vui.Bitstream_restriction_flag == 1 {
+        bsw.PutUint8(vui.Tiles_fixed_structure_flag, 1)
+        bsw.PutUint8(vui.Motion_vectors_over_pic_boundaries_flag, 1)
+        bsw.PutUint8(vui.Restricted_ref_pic_lists_flag, 1)
+        bsw.PutUE(vui.Min_spatial_segmentation_idc)
+        bsw.PutUE(vui.Max_bytes_per_pic_denom)
+        bsw.PutUE(vui.Max_bits_per_min_cu_denom)
+        bsw.PutUE(vui.Log2_max_mv_length_horizontal)
+        bsw.PutUE(vui.Log2_max_mv_length_vertical)
+    }
+}
 
-            if sub_pic_hrd_params_present_flag == 1 {
-                /*
-                 * tick_divisor_minus2                          u(8)
-                 * du_cpb_removal_delay_increment_length_minus1 u(5)
-                 * sub_pic_cpb_params_in_pic_timing_sei_flag    u(1)
-                 * dpb_output_delay_du_length_minus1            u(5)
-                 */
-                bs.SkipBits(19)
-            }
+// E.2.2 hrd_parameters
+type H265HrdParameters struct {
+    Nal_hrd_parameters_present_flag              uint8
+    Vcl_hrd_parameters_present_flag              uint8
+    Sub_pic_hrd_params_present_flag              uint8
+    Tick_divisor_minus2                          uint8
+    Du_cpb_removal_delay_increment_length_minus1 uint8
+    Sub_pic_cpb_params_in_pic_timing_sei_flag    uint8
+    Dpb_output_delay_du_length_minus1            uint8
+    Bit_rate_scale                               uint8
+    Cpb_size_scale                               uint8
+    Cpb_size_du_scale                            uint8
+    Initial_cpb_removal_delay_length_minus1      uint8
+    Au_cpb_removal_delay_length_minus1           uint8
+    Dpb_output_delay_length_minus1               uint8
+    Fixed_pic_rate_general_flag                  [8]uint8
+    Fixed_pic_rate_within_cvs_flag               [8]uint8
+    Elemental_duration_in_tc_minus1              [8]uint64
+    Low_delay_hrd_flag                           [8]uint8
+    Cpb_cnt_minus1                               [8]uint64
+    Nal_sub_layer_hrd_parameters                 [8][]H265SubLayerHrdParameters
+    Vcl_sub_layer_hrd_parameters                 [8][]H265SubLayerHrdParameters
+}
 
-            bs.SkipBits(8)
+// E.2.3 sub_layer_hrd_parameters
+type H265SubLayerHrdParameters struct {
+    Bit_rate_value_minus1    uint64
+    Cpb_size_value_minus1    uint64
+    Cpb_size_du_value_minus1 uint64
+    Bit_rate_du_value_minus1 uint64
+    Cbr_flag                 uint8
+}
 
-            if sub_pic_hrd_params_present_flag == 1 {
-                // cpb_size_du_scale
-                bs.SkipBits(4)
+func (hrd *H265HrdParameters) Decode(bs *BitStream, cprms_present_flag uint8, max_sub_layers_minus1 uint8) {
+    if cprms_present_flag == 1 {
+        hrd.Nal_hrd_parameters_present_flag = bs.GetBit()
+        hrd.Vcl_hrd_parameters_present_flag = bs.GetBit()
+        if hrd.Nal_hrd_parameters_present_flag == 1 || hrd.Vcl_hrd_parameters_present_flag == 1 {
+            hrd.Sub_pic_hrd_params_present_flag = bs.GetBit()
+            if hrd.Sub_pic_hrd_params_present_flag == 1 {
+                hrd.Tick_divisor_minus2 = bs.Uint8(8)
+                hrd.Du_cpb_removal_delay_increment_length_minus1 = bs.Uint8(5)
+                hrd.Sub_pic_cpb_params_in_pic_timing_sei_flag = bs.GetBit()
+                hrd.Dpb_output_delay_du_length_minus1 = bs.Uint8(5)
             }
-
-            /*
-             * initial_cpb_removal_delay_length_minus1 u(5)
-             * au_cpb_removal_delay_length_minus1      u(5)
-             * dpb_output_delay_length_minus1          u(5)
-             */
-            bs.SkipBits(15)
+            hrd.Bit_rate_scale = bs.Uint8(4)
+            hrd.Cpb_size_scale = bs.Uint8(4)
+            if hrd.Sub_pic_hrd_params_present_flag == 1 {
+                hrd.Cpb_size_du_scale = bs.Uint8(4)
+            }
+            hrd.Initial_cpb_removal_delay_length_minus1 = bs.Uint8(5)
+            hrd.Au_cpb_removal_delay_length_minus1 = bs.Uint8(5)
+            hrd.Dpb_output_delay_length_minus1 = bs.Uint8(5)
         }
     }
     for i := 0; i <= int(max_sub_layers_minus1); i++ {
-        fixed_pic_rate_general_flag := bs.GetBit()
-        fixed_pic_rate_within_cvs_flag := uint8(0)
-        low_delay_hrd_flag := uint8(0)
-        cpb_cnt_minus1 := uint32(0)
-        if fixed_pic_rate_general_flag == 0 {
-            fixed_pic_rate_within_cvs_flag = bs.GetBit()
-        }
-        if fixed_pic_rate_within_cvs_flag == 1 {
-            bs.ReadUE()
+        hrd.Fixed_pic_rate_general_flag[i] = bs.GetBit()
+        hrd.Fixed_pic_rate_within_cvs_flag[i] = 1
+        if hrd.Fixed_pic_rate_general_flag[i] == 0 {
+            hrd.Fixed_pic_rate_within_cvs_flag[i] = bs.GetBit()
+        }
+        if hrd.Fixed_pic_rate_within_cvs_flag[i] == 1 {
+            hrd.Elemental_duration_in_tc_minus1[i] = bs.ReadUE()
         } else {
-            low_delay_hrd_flag = bs.GetBit()
+            hrd.Low_delay_hrd_flag[i] = bs.GetBit()
         }
-        if low_delay_hrd_flag == 0 {
-            cpb_cnt_minus1 = uint32(bs.ReadUE())
-            if cpb_cnt_minus1 > 31 {
+        if hrd.Low_delay_hrd_flag[i] == 0 {
+            hrd.Cpb_cnt_minus1[i] = bs.ReadUE()
+            if hrd.Cpb_cnt_minus1[i] > 31 {
                 panic("cpb_cnt_minus1 > 31")
             }
         }
-        skip_sub_layer_hrd_parameters := func() {
-            for i := 0; i < int(cpb_cnt_minus1); i++ {
-                bs.ReadUE()
-                bs.ReadUE()
-                if sub_pic_hrd_params_present_flag == 1 {
-                    bs.ReadUE()
-                    bs.ReadUE()
-                }
-                bs.SkipBits(1)
+        if hrd.Nal_hrd_parameters_present_flag == 1 {
+            hrd.Nal_sub_layer_hrd_parameters[i] = hrd.decodeSubLayer(bs, hrd.Cpb_cnt_minus1[i])
+        }
+        if hrd.Vcl_hrd_parameters_present_flag == 1 {
+            hrd.Vcl_sub_layer_hrd_parameters[i] = hrd.decodeSubLayer(bs, hrd.Cpb_cnt_minus1[i])
+        }
+    }
+}
+
+func (hrd *H265HrdParameters) decodeSubLayer(bs *BitStream, cpb_cnt_minus1 uint64) []H265SubLayerHrdParameters {
+    params := make([]H265SubLayerHrdParameters, cpb_cnt_minus1+1)
+    for i := range params {
+        params[i].Bit_rate_value_minus1 = bs.ReadUE()
+        params[i].Cpb_size_value_minus1 = bs.ReadUE()
+        if hrd.Sub_pic_hrd_params_present_flag == 1 {
+            params[i].Cpb_size_du_value_minus1 = bs.ReadUE()
+            params[i].Bit_rate_du_value_minus1 = bs.ReadUE()
+        }
+        params[i].Cbr_flag = bs.GetBit()
+    }
+    return params
+}
+
+func (hrd *H265HrdParameters) Encode(bsw *BitStreamWriter, cprms_present_flag uint8, max_sub_layers_minus1 uint8) {
+    if cprms_present_flag == 1 {
+        bsw.PutUint8(hrd.Nal_hrd_parameters_present_flag, 1)
+        bsw.PutUint8(hrd.Vcl_hrd_parameters_present_flag, 1)
+        if hrd.Nal_hrd_parameters_present_flag == 1 || hrd.Vcl_hrd_parameters_present_flag == 1 {
+            bsw.PutUint8(hrd.Sub_pic_hrd_params_present_flag, 1)
+            if hrd.Sub_pic_hrd_params_present_flag == 1 {
+                bsw.PutUint8(hrd.Tick_divisor_minus2, 8)
+                bsw.PutUint8(hrd.Du_cpb_removal_delay_increment_length_minus1, 5)
+                bsw.PutUint8(hrd.Sub_pic_cpb_params_in_pic_timing_sei_flag, 1)
+                bsw.PutUint8(hrd.Dpb_output_delay_du_length_minus1, 5)
+            }
+            bsw.PutUint8(hrd.Bit_rate_scale, 4)
+            bsw.PutUint8(hrd.Cpb_size_scale, 4)
+            if hrd.Sub_pic_hrd_params_present_flag == 1 {
+                bsw.PutUint8(hrd.Cpb_size_du_scale, 4)
             }
+            bsw.PutUint8(hrd.Initial_cpb_removal_delay_length_minus1, 5)
+            bsw.PutUint8(hrd.Au_cpb_removal_delay_length_minus1, 5)
+            bsw.PutUint8(hrd.Dpb_output_delay_length_minus1, 5)
+        }
+    }
+    for i := 0; i <= int(max_sub_layers_minus1); i++ {
+        bsw.PutUint8(hrd.Fixed_pic_rate_general_flag[i], 1)
+        if hrd.Fixed_pic_rate_general_flag[i] == 0 {
+            bsw.PutUint8(hrd.Fixed_pic_rate_within_cvs_flag[i], 1)
         }
-        if nal_hrd_parameters_present_flag == 1 {
-            skip_sub_layer_hrd_parameters()
+        if hrd.Fixed_pic_rate_general_flag[i] == 1 || hrd.Fixed_pic_rate_within_cvs_flag[i] == 1 {
+            bsw.PutUE(hrd.Elemental_duration_in_tc_minus1[i])
+        } else {
+            bsw.PutUint8(hrd.Low_delay_hrd_flag[i], 1)
+        }
+        if hrd.Low_delay_hrd_flag[i] == 0 {
+            bsw.PutUE(hrd.Cpb_cnt_minus1[i])
+        }
+        if hrd.Nal_hrd_parameters_present_flag == 1 {
+            hrd.encodeSubLayer(bsw, hrd.Nal_sub_layer_hrd_parameters[i], hrd.Cpb_cnt_minus1[i])
         }
-        if vcl_hrd_parameters_present_flag == 1 {
-            skip_sub_layer_hrd_parameters()
+        if hrd.Vcl_hrd_parameters_present_flag == 1 {
+            hrd.encodeSubLayer(bsw, hrd.Vcl_sub_layer_hrd_parameters[i], hrd.Cpb_cnt_minus1[i])
         }
     }
 }
 
-func scaling_list_data(bs *BitStream) {
-    for i := 0; i < 4; i++ {
-        maxj := 6
-        if i == 3 {
-            maxj = 2
+func (hrd *H265HrdParameters) encodeSubLayer(bsw *BitStreamWriter, params []H265SubLayerHrdParameters, cpb_cnt_minus1 uint64) {
+    for i := 0; i <= int(cpb_cnt_minus1); i++ {
+        bsw.PutUE(params[i].Bit_rate_value_minus1)
+        bsw.PutUE(params[i].Cpb_size_value_minus1)
+        if hrd.Sub_pic_hrd_params_present_flag == 1 {
+            bsw.PutUE(params[i].Cpb_size_du_value_minus1)
+            bsw.PutUE(params[i].Bit_rate_du_value_minus1)
         }
-        for j := 0; j < maxj; j++ {
-            if bs.GetBit() == 0 {
-                bs.ReadUE()
+        bsw.PutUint8(params[i].Cbr_flag, 1)
+    }
+}
+
+// 7.3.4 scaling_list_data, sizeId为3时只有matrixId 0和3
+type H265ScalingListData struct {
+    Scaling_list_pred_mode_flag       [4][6]uint8
+    Scaling_list_pred_matrix_id_delta [4][6]uint64
+    Scaling_list_dc_coef_minus8       [4][6]int64
+    Scaling_list_delta_coef           [4][6][]int64
+}
+
+func (sld *H265ScalingListData) Decode(bs *BitStream) {
+    for sizeId := 0; sizeId < 4; sizeId++ {
+        for matrixId := 0; matrixId < 6; matrixId += scalingListMatrixStep(sizeId) {
+            sld.Scaling_list_pred_mode_flag[sizeId][matrixId] = bs.GetBit()
+            if sld.Scaling_list_pred_mode_flag[sizeId][matrixId] == 0 {
+                sld.Scaling_list_pred_matrix_id_delta[sizeId][matrixId] = bs.ReadUE()
             } else {
-                num_coeffs := Min(64, 1<<(4+(i<<1)))
-                if i > 1 {
-                    bs.ReadSE()
+                num_coeffs := Min(64, 1<<(4+(sizeId<<1)))
+                if sizeId > 1 {
+                    sld.Scaling_list_dc_coef_minus8[sizeId][matrixId] = bs.ReadSE()
                 }
+                sld.Scaling_list_delta_coef[sizeId][matrixId] = make([]int64, num_coeffs)
                 for k := 0; k < num_coeffs; k++ {
-                    bs.ReadSE()
+                    sld.Scaling_list_delta_coef[sizeId][matrixId][k] = bs.ReadSE()
                 }
             }
         }
     }
 }
 
-func parse_rps(rps_idx int, nums_rps uint64, num_delta_pocs [64]uint32, bs *BitStream) {
-    if rps_idx > 0 && bs.GetBit() > 0 {
-        if rps_idx > int(nums_rps) {
-            panic("rps_idx > int(nums_rps)")
-        }
-        bs.SkipBits(1)
-        bs.ReadUE()
-        num_delta_pocs[rps_idx] = 0
-        for i := uint32(0); i <= num_delta_pocs[rps_idx-1]; i++ {
-            var use_delta_flag uint8
-            var used_by_curr_pic_flag uint8 = bs.GetBit()
-            if used_by_curr_pic_flag == 0 {
-                use_delta_flag = bs.GetBit()
-            }
-            if use_delta_flag > 0 || used_by_curr_pic_flag > 0 {
-                num_delta_pocs[rps_idx]++
+func (sld *H265ScalingListData) Encode(bsw *BitStreamWriter) {
+    for sizeId := 0; sizeId < 4; sizeId++ {
+        for matrixId := 0; matrixId < 6; matrixId += scalingListMatrixStep(sizeId) {
+            bsw.PutUint8(sld.Scaling_list_pred_mode_flag[sizeId][matrixId], 1)
+            if sld.Scaling_list_pred_mode_flag[sizeId][matrixId] == 0 {
+                bsw.PutUE(sld.Scaling_list_pred_matrix_id_delta[sizeId][matrixId])
+            } else {
+                if sizeId > 1 {
+                    bsw.PutSE(sld.Scaling_list_dc_coef_minus8[sizeId][matrixId])
+                }
+                for _, coef := range sld.Scaling_list_delta_coef[sizeId][matrixId] {
+                    bsw.PutSE(coef)
+                }
             }
         }
-    } else {
-        num_negative_pics := bs.ReadUE()
-        num_positive_pics := bs.ReadUE()
-        if (num_negative_pics+num_positive_pics)*2 > uint64(bs.RemainBits()) {
-            panic("(num_negative_pics + num_positive_pics) * 2> uint64(bs.RemainBits())")
+    }
+}
+
+func scalingListMatrixStep(sizeId int) int {
+    if sizeId == 3 {
+        return 3
+    }
+    return 1
+}
+
+// 7.3.7 st_ref_pic_set(stRpsIdx)
+type H265ShortTermRefPicSet struct {
+    Inter_ref_pic_set_prediction_flag uint8
+    Delta_idx_minus1                  uint64
+    Delta_rps_sign                    uint8
+    Abs_delta_rps_minus1              uint64
+    Used_by_curr_pic_flag             []uint8
+    Use_delta_flag                    []uint8
+    Num_negative_pics                 uint64
+    Num_positive_pics                 uint64
+    Delta_poc_s0_minus1               []uint64
+    Used_by_curr_pic_s0_flag          []uint8
+    Delta_poc_s1_minus1               []uint64
+    Used_by_curr_pic_s1_flag          []uint8
+
+    // 7.4.8 推导出的参考帧poc差值
+    DeltaPocS0      []int64
+    UsedByCurrPicS0 []uint8
+    DeltaPocS1      []int64
+    UsedByCurrPicS1 []uint8
+}
+
+func (rps *H265ShortTermRefPicSet) NumDeltaPocs() int {
+    return len(rps.DeltaPocS0) + len(rps.DeltaPocS1)
+}
+
+// 当前图像使用的参考帧个数
+func (rps *H265ShortTermRefPicSet) NumUsedByCurrPic() int {
+    n := 0
+    for _, used := range rps.UsedByCurrPicS0 {
+        n += int(used)
+    }
+    for _, used := range rps.UsedByCurrPicS1 {
+        n += int(used)
+    }
+    return n
+}
+
+// sets 为sps中的st_ref_pic_set, 解析sps时stRpsIdx < num_short_term_ref_pic_sets
+// slice header中的st_ref_pic_set, stRpsIdx等于num_short_term_ref_pic_sets
+func (rps *H265ShortTermRefPicSet) Decode(bs *BitStream, stRpsIdx int, sets []H265ShortTermRefPicSet) {
+    numStRps := len(sets)
+    if stRpsIdx != 0 {
+        rps.Inter_ref_pic_set_prediction_flag = bs.GetBit()
+    }
+    if rps.Inter_ref_pic_set_prediction_flag == 0 {
+        rps.Num_negative_pics = bs.ReadUE()
+        rps.Num_positive_pics = bs.ReadUE()
+        if rps.Num_negative_pics > 16 || rps.Num_positive_pics > 16 {
+            panic("beyond HEVC_MAX_DPB_SIZE")
+        }
+        rps.Delta_poc_s0_minus1 = make([]uint64, rps.Num_negative_pics)
+        rps.Used_by_curr_pic_s0_flag = make([]uint8, rps.Num_negative_pics)
+        rps.DeltaPocS0 = make([]int64, rps.Num_negative_pics)
+        rps.UsedByCurrPicS0 = rps.Used_by_curr_pic_s0_flag
+        var poc int64 = 0
+        for i := 0; i < int(rps.Num_negative_pics); i++ {
+            rps.Delta_poc_s0_minus1[i] = bs.ReadUE()
+            rps.Used_by_curr_pic_s0_flag[i] = bs.GetBit()
+            poc -= int64(rps.Delta_poc_s0_minus1[i]) + 1
+            rps.DeltaPocS0[i] = poc
+        }
+        rps.Delta_poc_s1_minus1 = make([]uint64, rps.Num_positive_pics)
+        rps.Used_by_curr_pic_s1_flag = make([]uint8, rps.Num_positive_pics)
+        rps.DeltaPocS1 = make([]int64, rps.Num_positive_pics)
+        rps.UsedByCurrPicS1 = rps.Used_by_curr_pic_s1_flag
+        poc = 0
+        for i := 0; i < int(rps.Num_positive_pics); i++ {
+            rps.Delta_poc_s1_minus1[i] = bs.ReadUE()
+            rps.Used_by_curr_pic_s1_flag[i] = bs.GetBit()
+            poc += int64(rps.Delta_poc_s1_minus1[i]) + 1
+            rps.DeltaPocS1[i] = poc
+        }
+        return
+    }
+
+    if stRpsIdx == numStRps {
+        rps.Delta_idx_minus1 = bs.ReadUE()
+    }
+    if uint64(stRpsIdx) < rps.Delta_idx_minus1+1 {
+        panic("delta_idx_minus1 out of range")
+    }
+    ref := &sets[stRpsIdx-int(rps.Delta_idx_minus1+1)]
+    rps.Delta_rps_sign = bs.GetBit()
+    rps.Abs_delta_rps_minus1 = bs.ReadUE()
+    deltaRps := int64(rps.Abs_delta_rps_minus1 + 1)
+    if rps.Delta_rps_sign == 1 {
+        deltaRps = -deltaRps
+    }
+    numDeltaPocs := ref.NumDeltaPocs()
+    rps.Used_by_curr_pic_flag = make([]uint8, numDeltaPocs+1)
+    rps.Use_delta_flag = make([]uint8, numDeltaPocs+1)
+    for j := 0; j <= numDeltaPocs; j++ {
+        rps.Used_by_curr_pic_flag[j] = bs.GetBit()
+        rps.Use_delta_flag[j] = 1
+        if rps.Used_by_curr_pic_flag[j] == 0 {
+            rps.Use_delta_flag[j] = bs.GetBit()
+        }
+    }
+
+    // (7-61) (7-62)
+    numNegative := len(ref.DeltaPocS0)
+    numPositive := len(ref.DeltaPocS1)
+    for j := numPositive - 1; j >= 0; j-- {
+        dPoc := ref.DeltaPocS1[j] + deltaRps
+        if dPoc < 0 && rps.Use_delta_flag[numNegative+j] == 1 {
+            rps.DeltaPocS0 = append(rps.DeltaPocS0, dPoc)
+            rps.UsedByCurrPicS0 = append(rps.UsedByCurrPicS0, rps.Used_by_curr_pic_flag[numNegative+j])
+        }
+    }
+    if deltaRps < 0 && rps.Use_delta_flag[numDeltaPocs] == 1 {
+        rps.DeltaPocS0 = append(rps.DeltaPocS0, deltaRps)
+        rps.UsedByCurrPicS0 = append(rps.UsedByCurrPicS0, rps.Used_by_curr_pic_flag[numDeltaPocs])
+    }
+    for j := 0; j < numNegative; j++ {
+        dPoc := ref.DeltaPocS0[j] + deltaRps
+        if dPoc < 0 && rps.Use_delta_flag[j] == 1 {
+            rps.DeltaPocS0 = append(rps.DeltaPocS0, dPoc)
+            rps.UsedByCurrPicS0 = append(rps.UsedByCurrPicS0, rps.Used_by_curr_pic_flag[j])
+        }
+    }
+    for j := numNegative - 1; j >= 0; j-- {
+        dPoc := ref.DeltaPocS0[j] + deltaRps
+        if dPoc > 0 && rps.Use_delta_flag[j] == 1 {
+            rps.DeltaPocS1 = append(rps.DeltaPocS1, dPoc)
+            rps.UsedByCurrPicS1 = append(rps.UsedByCurrPicS1, rps.Used_by_curr_pic_flag[j])
+        }
+    }
+    if deltaRps > 0 && rps.Use_delta_flag[numDeltaPocs] == 1 {
+        rps.DeltaPocS1 = append(rps.DeltaPocS1, deltaRps)
+        rps.UsedByCurrPicS1 = append(rps.UsedByCurrPicS1, rps.Used_by_curr_pic_flag[numDeltaPocs])
+    }
+    for j := 0; j < numPositive; j++ {
+        dPoc := ref.DeltaPocS1[j] + deltaRps
+        if dPoc > 0 && rps.Use_delta_flag[numNegative+j] == 1 {
+            rps.DeltaPocS1 = append(rps.DeltaPocS1, dPoc)
+            rps.UsedByCurrPicS1 = append(rps.UsedByCurrPicS1, rps.Used_by_curr_pic_flag[numNegative+j])
+        }
+    }
+    rps.Num_negative_pics = uint64(len(rps.DeltaPocS0))
+    rps.Num_positive_pics = uint64(len(rps.DeltaPocS1))
+}
+
+func (rps *H265ShortTermRefPicSet) Encode(bsw *BitStreamWriter, stRpsIdx int, sets []H265ShortTermRefPicSet) {
+    if stRpsIdx != 0 {
+        bsw.PutUint8(rps.Inter_ref_pic_set_prediction_flag, 1)
+    }
+    if rps.Inter_ref_pic_set_prediction_flag == 0 {
+        bsw.PutUE(rps.Num_negative_pics)
+        bsw.PutUE(rps.Num_positive_pics)
+        for i := 0; i < int(rps.Num_negative_pics); i++ {
+            bsw.PutUE(rps.Delta_poc_s0_minus1[i])
+            bsw.PutUint8(rps.Used_by_curr_pic_s0_flag[i], 1)
         }
-        for i := 0; i < int(num_negative_pics); i++ {
-            bs.ReadUE()
-            bs.SkipBits(1)
+        for i := 0; i < int(rps.Num_positive_pics); i++ {
+            bsw.PutUE(rps.Delta_poc_s1_minus1[i])
+            bsw.PutUint8(rps.Used_by_curr_pic_s1_flag[i], 1)
         }
-        for i := 0; i < int(num_positive_pics); i++ {
-            bs.ReadUE()
-            bs.SkipBits(1)
+        return
+    }
+    if stRpsIdx == len(sets) {
+        bsw.PutUE(rps.Delta_idx_minus1)
+    }
+    bsw.PutUint8(rps.Delta_rps_sign, 1)
+    bsw.PutUE(rps.Abs_delta_rps_minus1)
+    for j := range rps.Used_by_curr_pic_flag {
+        bsw.PutUint8(rps.Used_by_curr_pic_flag[j], 1)
+        if rps.Used_by_curr_pic_flag[j] == 0 {
+            bsw.PutUint8(rps.Use_delta_flag[j], 1)
         }
     }
 }
 
 type H265RawPPS struct {
+    NalHdr                                   H265NaluHdr //Decode时保存, Encode时原样写回
     Pps_pic_parameter_set_id                 uint64
     Pps_seq_parameter_set_id                 uint64
     Dependent_slice_segments_enabled_flag    uint8
@@ -516,14 +1203,46 @@ type H265RawPPS struct {
     Transquant_bypass_enabled_flag           uint8
     Tiles_enabled_flag                       uint8
     Entropy_coding_sync_enabled_flag         uint8
+    Num_tile_columns_minus1                  uint64
+    Num_tile_rows_minus1                     uint64
+    Uniform_spacing_flag                     uint8
+    Column_width_minus1                      []uint64
+    Row_height_minus1                        []uint64
+    Loop_filter_across_tiles_enabled_flag    uint8
+    Pps_loop_filter_across_slices_enabled_flag uint8
+    Deblocking_filter_control_present_flag   uint8
+    Deblocking_filter_override_enabled_flag  uint8
+    Pps_deblocking_filter_disabled_flag      uint8
+    Pps_beta_offset_div2                     int64
+    Pps_tc_offset_div2                       int64
+    Pps_scaling_list_data_present_flag       uint8
+    Pps_scaling_list_data                    H265ScalingListData
+    Lists_modification_present_flag          uint8
+    Log2_parallel_merge_level_minus2         uint64
+    Slice_segment_header_extension_present_flag uint8
+    Pps_extension_present_flag               uint8
+    Pps_range_extension_flag                 uint8
+    Pps_multilayer_extension_flag            uint8
+    Pps_3d_extension_flag                    uint8
+    Pps_scc_extension_flag                   uint8
+    Pps_extension_4bits                      uint8
+    Log2_max_transform_skip_block_size_minus2 uint64
+    Cross_component_prediction_enabled_flag  uint8
+    Chroma_qp_offset_list_enabled_flag       uint8
+    Diff_cu_chroma_qp_offset_depth           uint64
+    Chroma_qp_offset_list_len_minus1         uint64
+    Cb_qp_offset_list                        []int64
+    Cr_qp_offset_list                        []int64
+    Log2_sao_offset_scale_luma               uint64
+    Log2_sao_offset_scale_chroma             uint64
+    Pps_extension_data_flag                  []uint8 //multilayer/3d/scc扩展不解析,按bit原样保存
 }
 
 //nalu without startcode
 func (pps *H265RawPPS) Decode(nalu []byte) {
     sodb := CovertRbspToSodb(nalu)
     bs := NewBitStream(sodb)
-    hdr := H265NaluHdr{}
-    hdr.Decode(bs)
+    pps.NalHdr.Decode(bs)
     pps.Pps_pic_parameter_set_id = bs.ReadUE()
     pps.Pps_seq_parameter_set_id = bs.ReadUE()
     pps.Dependent_slice_segments_enabled_flag = bs.GetBit()
@@ -548,6 +1267,175 @@ func (pps *H265RawPPS) Decode(nalu []byte) {
     pps.Transquant_bypass_enabled_flag = bs.GetBit()
     pps.Tiles_enabled_flag = bs.GetBit()
     pps.Entropy_coding_sync_enabled_flag = bs.GetBit()
+    pps.decodeTail(bs)
+}
+
+// 不完整的pps仍然可以拿到pps id等头部字段,后面的字段解析失败时忽略
+func (pps *H265RawPPS) decodeTail(bs *BitStream) {
+    defer func() {
+        recover()
+    }()
+    if pps.Tiles_enabled_flag == 1 {
+        pps.Num_tile_columns_minus1 = bs.ReadUE()
+        pps.Num_tile_rows_minus1 = bs.ReadUE()
+        if pps.Num_tile_columns_minus1 > 19 || pps.Num_tile_rows_minus1 > 21 {
+            panic("beyond HEVC_MAX_TILE_COLUMNS/HEVC_MAX_TILE_ROWS")
+        }
+        pps.Uniform_spacing_flag = bs.GetBit()
+        if pps.Uniform_spacing_flag == 0 {
+            pps.Column_width_minus1 = make([]uint64, pps.Num_tile_columns_minus1)
+            for i := range pps.Column_width_minus1 {
+                pps.Column_width_minus1[i] = bs.ReadUE()
+            }
+            pps.Row_height_minus1 = make([]uint64, pps.Num_tile_rows_minus1)
+            for i := range pps.Row_height_minus1 {
+                pps.Row_height_minus1[i] = bs.ReadUE()
+            }
+        }
+        pps.Loop_filter_across_tiles_enabled_flag = bs.GetBit()
+    }
+    pps.Pps_loop_filter_across_slices_enabled_flag = bs.GetBit()
+    pps.Deblocking_filter_control_present_flag = bs.GetBit()
+    if pps.Deblocking_filter_control_present_flag == 1 {
+        pps.Deblocking_filter_override_enabled_flag = bs.GetBit()
+        pps.Pps_deblocking_filter_disabled_flag = bs.GetBit()
+        if pps.Pps_deblocking_filter_disabled_flag == 0 {
+            pps.Pps_beta_offset_div2 = bs.ReadSE()
+            pps.Pps_tc_offset_div2 = bs.ReadSE()
+        }
+    }
+    pps.Pps_scaling_list_data_present_flag = bs.GetBit()
+    if pps.Pps_scaling_list_data_present_flag == 1 {
+        pps.Pps_scaling_list_data.Decode(bs)
+    }
+    pps.Lists_modification_present_flag = bs.GetBit()
+    pps.Log2_parallel_merge_level_minus2 = bs.ReadUE()
+    pps.Slice_segment_header_extension_present_flag = bs.GetBit()
+    pps.Pps_extension_present_flag = bs.GetBit()
+    if pps.Pps_extension_present_flag == 0 {
+        return
+    }
+    pps.Pps_range_extension_flag = bs.GetBit()
+    pps.Pps_multilayer_extension_flag = bs.GetBit()
+    pps.Pps_3d_extension_flag = bs.GetBit()
+    pps.Pps_scc_extension_flag = bs.GetBit()
+    pps.Pps_extension_4bits = bs.Uint8(4)
+    if pps.Pps_range_extension_flag == 1 {
+        if pps.Transform_skip_enabled_flag == 1 {
+            pps.Log2_max_transform_skip_block_size_minus2 = bs.ReadUE()
+        }
+        pps.Cross_component_prediction_enabled_flag = bs.GetBit()
+        pps.Chroma_qp_offset_list_enabled_flag = bs.GetBit()
+        if pps.Chroma_qp_offset_list_enabled_flag == 1 {
+            pps.Diff_cu_chroma_qp_offset_depth = bs.ReadUE()
+            pps.Chroma_qp_offset_list_len_minus1 = bs.ReadUE()
+            if pps.Chroma_qp_offset_list_len_minus1 > 5 {
+                panic("chroma_qp_offset_list_len_minus1 > 5")
+            }
+            pps.Cb_qp_offset_list = make([]int64, pps.Chroma_qp_offset_list_len_minus1+1)
+            pps.Cr_qp_offset_list = make([]int64, pps.Chroma_qp_offset_list_len_minus1+1)
+            for i := range pps.Cb_qp_offset_list {
+                pps.Cb_qp_offset_list[i] = bs.ReadSE()
+                pps.Cr_qp_offset_list[i] = bs.ReadSE()
+            }
+        }
+        pps.Log2_sao_offset_scale_luma = bs.ReadUE()
+        pps.Log2_sao_offset_scale_chroma = bs.ReadUE()
+    }
+    if pps.Pps_multilayer_extension_flag == 1 || pps.Pps_3d_extension_flag == 1 ||
+        pps.Pps_scc_extension_flag == 1 || pps.Pps_extension_4bits > 0 {
+        pps.Pps_extension_data_flag = readExtensionDataFlags(bs)
+    }
+}
+
+//返回不带startcode的nalu
+func (pps *H265RawPPS) Encode() []byte {
+    bsw := NewBitStreamWriter(64)
+    hdr := pps.NalHdr.orDefault(H265_NAL_PPS)
+    hdr.Encode(bsw)
+    bsw.PutUE(pps.Pps_pic_parameter_set_id)
+    bsw.PutUE(pps.Pps_seq_parameter_set_id)
+    bsw.PutUint8(pps.Dependent_slice_segments_enabled_flag, 1)
+    bsw.PutUint8(pps.Output_flag_present_flag, 1)
+    bsw.PutUint8(pps.Num_extra_slice_header_bits, 3)
+    bsw.PutUint8(pps.Sign_data_hiding_enabled_flag, 1)
+    bsw.PutUint8(pps.Cabac_init_present_flag, 1)
+    bsw.PutUE(pps.Num_ref_idx_l0_default_active_minus1)
+    bsw.PutUE(pps.Num_ref_idx_l1_default_active_minus1)
+    bsw.PutSE(pps.Init_qp_minus26)
+    bsw.PutUint8(pps.Constrained_intra_pred_flag, 1)
+    bsw.PutUint8(pps.Transform_skip_enabled_flag, 1)
+    bsw.PutUint8(pps.Cu_qp_delta_enabled_flag, 1)
+    if pps.Cu_qp_delta_enabled_flag == 1 {
+        bsw.PutUE(pps.Diff_cu_qp_delta_depth)
+    }
+    bsw.PutSE(pps.Pps_cb_qp_offset)
+    bsw.PutSE(pps.Pps_cr_qp_offset)
+    bsw.PutUint8(pps.Pps_slice_chroma_qp_offsets_present_flag, 1)
+    bsw.PutUint8(pps.Weighted_pred_flag, 1)
+    bsw.PutUint8(pps.Weighted_bipred_flag, 1)
+    bsw.PutUint8(pps.Transquant_bypass_enabled_flag, 1)
+    bsw.PutUint8(pps.Tiles_enabled_flag, 1)
+    bsw.PutUint8(pps.Entropy_coding_sync_enabled_flag, 1)
+    if pps.Tiles_enabled_flag == 1 {
+        bsw.PutUE(pps.Num_tile_columns_minus1)
+        bsw.PutUE(pps.Num_tile_rows_minus1)
+        bsw.PutUint8(pps.Uniform_spacing_flag, 1)
+        if pps.Uniform_spacing_flag == 0 {
+            for _, width := range pps.Column_width_minus1 {
+                bsw.PutUE(width)
+            }
+            for _, height := range pps.Row_height_minus1 {
+                bsw.PutUE(height)
+            }
+        }
+        bsw.PutUint8(pps.Loop_filter_across_tiles_enabled_flag, 1)
+    }
+    bsw.PutUint8(pps.Pps_loop_filter_across_slices_enabled_flag, 1)
+    bsw.PutUint8(pps.Deblocking_filter_control_present_flag, 1)
+    if pps.Deblocking_filter_control_present_flag == 1 {
+        bsw.PutUint8(pps.Deblocking_filter_override_enabled_flag, 1)
+        bsw.PutUint8(pps.Pps_deblocking_filter_disabled_flag, 1)
+        if pps.Pps_deblocking_filter_disabled_flag == 0 {
+            bsw.PutSE(pps.Pps_beta_offset_div2)
+            bsw.PutSE(pps.Pps_tc_offset_div2)
+        }
+    }
+    bsw.PutUint8(pps.Pps_scaling_list_data_present_flag, 1)
+    if pps.Pps_scaling_list_data_present_flag == 1 {
+        pps.Pps_scaling_list_data.Encode(bsw)
+    }
+    bsw.PutUint8(pps.Lists_modification_present_flag, 1)
+    bsw.PutUE(pps.Log2_parallel_merge_level_minus2)
+    bsw.PutUint8(pps.Slice_segment_header_extension_present_flag, 1)
+    bsw.PutUint8(pps.Pps_extension_present_flag, 1)
+    if pps.Pps_extension_present_flag == 1 {
+        bsw.PutUint8(pps.Pps_range_extension_flag, 1)
+        bsw.PutUint8(pps.Pps_multilayer_extension_flag, 1)
+        bsw.PutUint8(pps.Pps_3d_extension_flag, 1)
+        bsw.PutUint8(pps.Pps_scc_extension_flag, 1)
+        bsw.PutUint8(pps.Pps_extension_4bits, 4)
+        if pps.Pps_range_extension_flag == 1 {
+            if pps.Transform_skip_enabled_flag == 1 {
+                bsw.PutUE(pps.Log2_max_transform_skip_block_size_minus2)
+            }
+            bsw.PutUint8(pps.Cross_component_prediction_enabled_flag, 1)
+            bsw.PutUint8(pps.Chroma_qp_offset_list_enabled_flag, 1)
+            if pps.Chroma_qp_offset_list_enabled_flag == 1 {
+                bsw.PutUE(pps.Diff_cu_chroma_qp_offset_depth)
+                bsw.PutUE(pps.Chroma_qp_offset_list_len_minus1)
+                for i := range pps.Cb_qp_offset_list {
+                    bsw.PutSE(pps.Cb_qp_offset_list[i])
+                    bsw.PutSE(pps.Cr_qp_offset_list[i])
+                }
+            }
+            bsw.PutUE(pps.Log2_sao_offset_scale_luma)
+            bsw.PutUE(pps.Log2_sao_offset_scale_chroma)
+        }
+        writeExtensionDataFlags(bsw, pps.Pps_extension_data_flag)
+    }
+    bsw.PutRbspTrailingBits()
+    return CovertSodbToRbsp(bsw.Bits())
 }
 
 func GetH265Resolution(sps []byte) (width uint32, height uint32) {
@@ -592,6 +1480,408 @@ func GetH265PPSId(pps []byte) uint64 {
     return rawpps.Pps_pic_parameter_set_id
 }
 
+const (
+    H265_SLICE_B = 0
+    H265_SLICE_P = 1
+    H265_SLICE_I = 2
+)
+
+// 7.3.6.1 slice_segment_header
+type H265SliceHeader struct {
+    First_slice_segment_in_pic_flag        uint8
+    No_output_of_prior_pics_flag           uint8
+    Slice_pic_parameter_set_id             uint64
+    Dependent_slice_segment_flag           uint8
+    Slice_segment_address                  uint64
+    Slice_type                             uint64
+    Pic_output_flag                        uint8
+    Colour_plane_id                        uint8
+    Slice_pic_order_cnt_lsb                uint64
+    Short_term_ref_pic_set_sps_flag        uint8
+    Short_term_ref_pic_set_idx             uint64
+    St_ref_pic_set                         H265ShortTermRefPicSet //short_term_ref_pic_set_sps_flag为0时在slice header中
+    Num_long_term_sps                      uint64
+    Num_long_term_pics                     uint64
+    Lt_idx_sps                             []uint64
+    Poc_lsb_lt                             []uint64
+    Used_by_curr_pic_lt_flag               []uint8
+    Delta_poc_msb_present_flag             []uint8
+    Delta_poc_msb_cycle_lt                 []uint64
+    Slice_temporal_mvp_enabled_flag        uint8
+    Slice_sao_luma_flag                    uint8
+    Slice_sao_chroma_flag                  uint8
+    Num_ref_idx_active_override_flag       uint8
+    Num_ref_idx_l0_active_minus1           uint64
+    Num_ref_idx_l1_active_minus1           uint64
+    Mvd_l1_zero_flag                       uint8
+    Cabac_init_flag                        uint8
+    Collocated_from_l0_flag                uint8
+    Collocated_ref_idx                     uint64
+    Five_minus_max_num_merge_cand          uint64
+    Slice_qp_delta                         int64
+    Slice_cb_qp_offset                     int64
+    Slice_cr_qp_offset                     int64
+    Cu_chroma_qp_offset_enabled_flag       uint8
+    Deblocking_filter_override_flag        uint8
+    Slice_deblocking_filter_disabled_flag  uint8
+    Slice_beta_offset_div2                 int64
+    Slice_tc_offset_div2                   int64
+    Slice_loop_filter_across_slices_enabled_flag uint8
+    Num_entry_point_offsets                uint64
+    Offset_len_minus1                      uint64
+    Entry_point_offset_minus1              []uint64
+
+    // 以下字段不属于语法元素,解析时填充
+    Nal_unit_type  H265_NAL_TYPE
+    TemporalId     uint8
+    NumPicTotalCurr int
+}
+
+// 当前slice使用的短期参考帧集合
+func (sh *H265SliceHeader) ShortTermRefPicSet(sps *H265RawSPS) *H265ShortTermRefPicSet {
+    if sh.Short_term_ref_pic_set_sps_flag == 0 {
+        return &sh.St_ref_pic_set
+    }
+    return &sps.St_ref_pic_set[sh.Short_term_ref_pic_set_idx]
+}
+
+func (sh *H265SliceHeader) IsIRAP() bool {
+    return sh.Nal_unit_type >= H265_NAL_SLICE_BLA_W_LP && sh.Nal_unit_type <= 23
+}
+
+func (sh *H265SliceHeader) IsIDR() bool {
+    return sh.Nal_unit_type == H265_NAL_SLICE_IDR_W_RADL || sh.Nal_unit_type == H265_NAL_SLICE_IDR_N_LP
+}
+
+func (sh *H265SliceHeader) IsBSlice() bool {
+    return sh.Slice_type == H265_SLICE_B
+}
+
+// 只解析slice_pic_parameter_set_id, 用于查找对应的pps, nalu不带startcode
+func GetH265SlicePPSId(nalu []byte) uint64 {
+    bs := NewBitStream(CovertRbspToSodb(nalu[2:]))
+    nalType := H265NaluTypeWithoutStartCode(nalu)
+    bs.GetBit()
+    if nalType >= H265_NAL_SLICE_BLA_W_LP && nalType <= 23 {
+        bs.GetBit()
+    }
+    return bs.ReadUE()
+}
+
+// nalu不带startcode, sps/pps 为slice_pic_parameter_set_id对应的参数集
+// dependent slice segment 只解析slice_segment_address和entry point,其余字段需要从前一个独立slice segment拷贝
+func (sh *H265SliceHeader) Decode(nalu []byte, sps *H265RawSPS, pps *H265RawPPS) (err error) {
+    defer func() {
+        if e := recover(); e != nil {
+            err = errors.New("h265 slice header out of range")
+        }
+    }()
+    return sh.decode(NewBitStream(CovertRbspToSodb(nalu)), sps, pps)
+}
+
+// 7.3.6 slice_segment_header, 解析到byte_alignment()之后
+func (sh *H265SliceHeader) decode(bs *BitStream, sps *H265RawSPS, pps *H265RawPPS) error {
+    hdr := H265NaluHdr{}
+    hdr.Decode(bs)
+    sh.Nal_unit_type = H265_NAL_TYPE(hdr.Nal_unit_type)
+    sh.TemporalId = hdr.Nuh_temporal_id_plus1 - 1
+    sh.First_slice_segment_in_pic_flag = bs.GetBit()
+    if sh.IsIRAP() {
+        sh.No_output_of_prior_pics_flag = bs.GetBit()
+    }
+    sh.Slice_pic_parameter_set_id = bs.ReadUE()
+    if sh.Slice_pic_parameter_set_id != pps.Pps_pic_parameter_set_id || pps.Pps_seq_parameter_set_id != sps.Sps_seq_parameter_set_id {
+        return errors.New("h265 slice header parameter set mismatch")
+    }
+    if sh.First_slice_segment_in_pic_flag == 0 {
+        if pps.Dependent_slice_segments_enabled_flag == 1 {
+            sh.Dependent_slice_segment_flag = bs.GetBit()
+        }
+        sh.Slice_segment_address = bs.GetBits(ceilLog2(sps.PicSizeInCtbsY()))
+    }
+    if sh.Dependent_slice_segment_flag == 1 {
+        return sh.decodeEntryPoints(bs, pps)
+    }
+    bs.SkipBits(int(pps.Num_extra_slice_header_bits))
+    sh.Slice_type = bs.ReadUE()
+    sh.Pic_output_flag = 1
+    if pps.Output_flag_present_flag == 1 {
+        sh.Pic_output_flag = bs.GetBit()
+    }
+    if sps.Separate_colour_plane_flag == 1 {
+        sh.Colour_plane_id = bs.Uint8(2)
+    }
+    if !sh.IsIDR() {
+        sh.Slice_pic_order_cnt_lsb = bs.GetBits(int(sps.Log2_max_pic_order_cnt_lsb_minus4 + 4))
+        sh.Short_term_ref_pic_set_sps_flag = bs.GetBit()
+        if sh.Short_term_ref_pic_set_sps_flag == 0 {
+            sh.St_ref_pic_set.Decode(bs, int(sps.Num_short_term_ref_pic_sets), sps.St_ref_pic_set)
+        } else if sps.Num_short_term_ref_pic_sets > 1 {
+            sh.Short_term_ref_pic_set_idx = bs.GetBits(ceilLog2(sps.Num_short_term_ref_pic_sets))
+        }
+        if sh.Short_term_ref_pic_set_idx >= sps.Num_short_term_ref_pic_sets && sh.Short_term_ref_pic_set_sps_flag == 1 {
+            return errors.New("h265 short_term_ref_pic_set_idx out of range")
+        }
+        if sps.Long_term_ref_pics_present_flag == 1 {
+            sh.decodeLongTermRefPics(bs, sps)
+        }
+        if sps.Sps_temporal_mvp_enabled_flag == 1 {
+            sh.Slice_temporal_mvp_enabled_flag = bs.GetBit()
+        }
+    }
+    if sps.Sample_adaptive_offset_enabled_flag == 1 {
+        sh.Slice_sao_luma_flag = bs.GetBit()
+        if sps.ChromaArrayType() != 0 {
+            sh.Slice_sao_chroma_flag = bs.GetBit()
+        }
+    }
+    if !sh.IsIDR() {
+        sh.NumPicTotalCurr = sh.ShortTermRefPicSet(sps).NumUsedByCurrPic()
+        for _, used := range sh.Used_by_curr_pic_lt_flag {
+            sh.NumPicTotalCurr += int(used)
+        }
+    }
+    if sh.Slice_type == H265_SLICE_P || sh.Slice_type == H265_SLICE_B {
+        sh.Num_ref_idx_l0_active_minus1 = pps.Num_ref_idx_l0_default_active_minus1
+        sh.Num_ref_idx_l1_active_minus1 = pps.Num_ref_idx_l1_default_active_minus1
+        sh.Num_ref_idx_active_override_flag = bs.GetBit()
+        if sh.Num_ref_idx_active_override_flag == 1 {
+            sh.Num_ref_idx_l0_active_minus1 = bs.ReadUE()
+            if sh.Slice_type == H265_SLICE_B {
+                sh.Num_ref_idx_l1_active_minus1 = bs.ReadUE()
+            }
+        }
+        if pps.Lists_modification_present_flag == 1 && sh.NumPicTotalCurr > 1 {
+            // ref_pic_lists_modification
+            n := ceilLog2(uint64(sh.NumPicTotalCurr))
+            if bs.GetBit() == 1 {
+                bs.SkipBits(n * int(sh.Num_ref_idx_l0_active_minus1+1))
+            }
+            if sh.Slice_type == H265_SLICE_B && bs.GetBit() == 1 {
+                bs.SkipBits(n * int(sh.Num_ref_idx_l1_active_minus1+1))
+            }
+        }
+        if sh.Slice_type == H265_SLICE_B {
+            sh.Mvd_l1_zero_flag = bs.GetBit()
+        }
+        if pps.Cabac_init_present_flag == 1 {
+            sh.Cabac_init_flag = bs.GetBit()
+        }
+        if sh.Slice_temporal_mvp_enabled_flag == 1 {
+            sh.Collocated_from_l0_flag = 1
+            if sh.Slice_type == H265_SLICE_B {
+                sh.Collocated_from_l0_flag = bs.GetBit()
+            }
+            if (sh.Collocated_from_l0_flag == 1 && sh.Num_ref_idx_l0_active_minus1 > 0) ||
+                (sh.Collocated_from_l0_flag == 0 && sh.Num_ref_idx_l1_active_minus1 > 0) {
+                sh.Collocated_ref_idx = bs.ReadUE()
+            }
+        }
+        if (pps.Weighted_pred_flag == 1 && sh.Slice_type == H265_SLICE_P) ||
+            (pps.Weighted_bipred_flag == 1 && sh.Slice_type == H265_SLICE_B) {
+            sh.skipPredWeightTable(bs, sps.ChromaArrayType())
+        }
+        sh.Five_minus_max_num_merge_cand = bs.ReadUE()
+    }
+    sh.Slice_qp_delta = bs.ReadSE()
+    if pps.Pps_slice_chroma_qp_offsets_present_flag == 1 {
+        sh.Slice_cb_qp_offset = bs.ReadSE()
+        sh.Slice_cr_qp_offset = bs.ReadSE()
+    }
+    if pps.Chroma_qp_offset_list_enabled_flag == 1 {
+        sh.Cu_chroma_qp_offset_enabled_flag = bs.GetBit()
+    }
+    if pps.Deblocking_filter_override_enabled_flag == 1 {
+        sh.Deblocking_filter_override_flag = bs.GetBit()
+    }
+    sh.Slice_deblocking_filter_disabled_flag = pps.Pps_deblocking_filter_disabled_flag
+    sh.Slice_beta_offset_div2 = pps.Pps_beta_offset_div2
+    sh.Slice_tc_offset_div2 = pps.Pps_tc_offset_div2
+    if sh.Deblocking_filter_override_flag == 1 {
+        sh.Slice_deblocking_filter_disabled_flag = bs.GetBit()
+        if sh.Slice_deblocking_filter_disabled_flag == 0 {
+            sh.Slice_beta_offset_div2 = bs.ReadSE()
+            sh.Slice_tc_offset_div2 = bs.ReadSE()
+        }
+    }
+    sh.Slice_loop_filter_across_slices_enabled_flag = pps.Pps_loop_filter_across_slices_enabled_flag
+    if pps.Pps_loop_filter_across_slices_enabled_flag == 1 &&
+        (sh.Slice_sao_luma_flag == 1 || sh.Slice_sao_chroma_flag == 1 || sh.Slice_deblocking_filter_disabled_flag == 0) {
+        sh.Slice_loop_filter_across_slices_enabled_flag = bs.GetBit()
+    }
+    return sh.decodeEntryPoints(bs, pps)
+}
+
+// slice_segment_header(包括nalu header)在nalu中占用的字节数, 包括防竞争字节
+// 用于CENC subsample加密, slice header必须保持明文
+func H265SliceHeaderSize(nalu []byte, sps *H265RawSPS, pps *H265RawPPS) (size int, err error) {
+    defer func() {
+        if e := recover(); e != nil {
+            err = errors.New("h265 slice header out of range")
+        }
+    }()
+    bs := NewBitStream(CovertRbspToSodb(nalu))
+    sh := &H265SliceHeader{}
+    if err = sh.decode(bs, sps, pps); err != nil {
+        return
+    }
+    if pps.Slice_segment_header_extension_present_flag == 1 {
+        bs.SkipBits(int(bs.ReadUE()) * 8)
+    }
+    //byte_alignment()
+    bs.GetBit()
+    n := bs.ByteOffset()
+    if bs.bitsOffset > 0 {
+        n++
+    }
+    return rbspLength(nalu, n), nil
+}
+
+func (sh *H265SliceHeader) decodeEntryPoints(bs *BitStream, pps *H265RawPPS) error {
+    if pps.Tiles_enabled_flag == 1 || pps.Entropy_coding_sync_enabled_flag == 1 {
+        sh.Num_entry_point_offsets = bs.ReadUE()
+        if sh.Num_entry_point_offsets > 0 {
+            sh.Offset_len_minus1 = bs.ReadUE()
+            if sh.Offset_len_minus1 > 31 {
+                return errors.New("h265 offset_len_minus1 out of range")
+            }
+            sh.Entry_point_offset_minus1 = make([]uint64, sh.Num_entry_point_offsets)
+            for i := range sh.Entry_point_offset_minus1 {
+                sh.Entry_point_offset_minus1[i] = bs.GetBits(int(sh.Offset_len_minus1 + 1))
+            }
+        }
+    }
+    return nil
+}
+
+func (sh *H265SliceHeader) decodeLongTermRefPics(bs *BitStream, sps *H265RawSPS) {
+    if sps.Num_long_term_ref_pics_sps > 0 {
+        sh.Num_long_term_sps = bs.ReadUE()
+    }
+    sh.Num_long_term_pics = bs.ReadUE()
+    num := sh.Num_long_term_sps + sh.Num_long_term_pics
+    if num > 32 {
+        panic("beyond HEVC_MAX_LONG_TERM_REF_PICS")
+    }
+    sh.Lt_idx_sps = make([]uint64, num)
+    sh.Poc_lsb_lt = make([]uint64, num)
+    sh.Used_by_curr_pic_lt_flag = make([]uint8, num)
+    sh.Delta_poc_msb_present_flag = make([]uint8, num)
+    sh.Delta_poc_msb_cycle_lt = make([]uint64, num)
+    for i := 0; i < int(num); i++ {
+        if i < int(sh.Num_long_term_sps) {
+            if sps.Num_long_term_ref_pics_sps > 1 {
+                sh.Lt_idx_sps[i] = bs.GetBits(ceilLog2(sps.Num_long_term_ref_pics_sps))
+            }
+            sh.Poc_lsb_lt[i] = sps.Lt_ref_pic_poc_lsb_sps[sh.Lt_idx_sps[i]]
+            sh.Used_by_curr_pic_lt_flag[i] = sps.Used_by_curr_pic_lt_sps_flag[sh.Lt_idx_sps[i]]
+        } else {
+            sh.Poc_lsb_lt[i] = bs.GetBits(int(sps.Log2_max_pic_order_cnt_lsb_minus4 + 4))
+            sh.Used_by_curr_pic_lt_flag[i] = bs.GetBit()
+        }
+        sh.Delta_poc_msb_present_flag[i] = bs.GetBit()
+        if sh.Delta_poc_msb_present_flag[i] == 1 {
+            sh.Delta_poc_msb_cycle_lt[i] = bs.ReadUE()
+        }
+    }
+}
+
+// 7.3.6.3 pred_weight_table, 只考虑单层码流
+func (sh *H265SliceHeader) skipPredWeightTable(bs *BitStream, chromaArrayType uint64) {
+    bs.ReadUE() //luma_log2_weight_denom
+    if chromaArrayType != 0 {
+        bs.ReadSE() //delta_chroma_log2_weight_denom
+    }
+    skip := func(num uint64) {
+        lumaWeightFlags := make([]uint8, num+1)
+        chromaWeightFlags := make([]uint8, num+1)
+        for i := range lumaWeightFlags {
+            lumaWeightFlags[i] = bs.GetBit()
+        }
+        if chromaArrayType != 0 {
+            for i := range chromaWeightFlags {
+                chromaWeightFlags[i] = bs.GetBit()
+            }
+        }
+        for i := range lumaWeightFlags {
+            if lumaWeightFlags[i] == 1 {
+                bs.ReadSE()
+                bs.ReadSE()
+            }
+            if chromaWeightFlags[i] == 1 {
+                for j := 0; j < 4; j++ {
+                    bs.ReadSE()
+                }
+            }
+        }
+    }
+    skip(sh.Num_ref_idx_l0_active_minus1)
+    if sh.Slice_type == H265_SLICE_B {
+        skip(sh.Num_ref_idx_l1_active_minus1)
+    }
+}
+
+// Ceil(Log2(n))
+func ceilLog2(n uint64) int {
+    bits := 0
+    for (uint64(1) << uint(bits)) < n {
+        bits++
+    }
+    return bits
+}
+
+// 8.3.1 图像顺序号(POC)计算, 按照解码顺序对每一帧的第一个slice segment调用Calculate
+type H265PocCalculator struct {
+    prevTid0Poc int64
+    started     bool
+    firstAfterEos bool
+}
+
+func NewH265PocCalculator() *H265PocCalculator {
+    return &H265PocCalculator{}
+}
+
+// 码流中出现end of sequence后,下一个IRAP的NoRaslOutputFlag为1
+func (calc *H265PocCalculator) EndOfSequence() {
+    calc.firstAfterEos = true
+}
+
+// 当前帧是否是NoRaslOutputFlag为1的IRAP(IDR/BLA, 或者码流开始/EOS之后的CRA), 这种帧会重置POC
+func (calc *H265PocCalculator) IsPocReset(sh *H265SliceHeader) bool {
+    if !sh.IsIRAP() {
+        return false
+    }
+    return sh.Nal_unit_type != H265_NAL_SLICE_CRA || !calc.started || calc.firstAfterEos
+}
+
+func (calc *H265PocCalculator) Calculate(sh *H265SliceHeader, sps *H265RawSPS) int64 {
+    maxPocLsb := int64(1) << (sps.Log2_max_pic_order_cnt_lsb_minus4 + 4)
+    lsb := int64(sh.Slice_pic_order_cnt_lsb)
+    var msb int64
+    if !calc.IsPocReset(sh) {
+        prevPocLsb := calc.prevTid0Poc & (maxPocLsb - 1)
+        prevPocMsb := calc.prevTid0Poc - prevPocLsb
+        if lsb < prevPocLsb && prevPocLsb-lsb >= maxPocLsb/2 {
+            msb = prevPocMsb + maxPocLsb
+        } else if lsb > prevPocLsb && lsb-prevPocLsb > maxPocLsb/2 {
+            msb = prevPocMsb - maxPocLsb
+        } else {
+            msb = prevPocMsb
+        }
+    }
+    poc := msb + lsb
+    calc.started = true
+    if sh.IsIRAP() {
+        calc.firstAfterEos = false
+    }
+    // TemporalId为0并且不是RASL/RADL/SLNR的图像
+    if sh.TemporalId == 0 && !(sh.Nal_unit_type >= H265_NAL_SLICE_RADL_N && sh.Nal_unit_type <= H265_NAL_SLICE_RASL_R) &&
+        !(sh.Nal_unit_type <= 14 && sh.Nal_unit_type%2 == 0) {
+        calc.prevTid0Poc = poc
+    }
+    return poc
+}
+
 /*
 ISO/IEC 14496-15:2017(E) 8.3.3.1.2 Syntax (p71)
 
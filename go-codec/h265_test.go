@@ -188,3 +188,238 @@ func TestHEVCRecordConfiguration_ToNalus(t *testing.T) {
 		})
 	}
 }
+
+func TestH265ShortTermRefPicSet_Decode(t *testing.T) {
+	// set0: S0 = {-1, -3}, S1 = {2}; set1 由set0预测, deltaRps = -1
+	bs := NewBitStream(testBits(testUE(2), testUE(1), testUE(0), "1", testUE(1), "1", testUE(1), "1",
+		"1", "1", testUE(0), "1", "1", "1", "1"))
+	sets := make([]H265ShortTermRefPicSet, 2)
+	for i := range sets {
+		sets[i].Decode(bs, i, sets)
+	}
+	tests := []struct {
+		name   string
+		rps    H265ShortTermRefPicSet
+		wantS0 []int64
+		wantS1 []int64
+	}{
+		{name: "explicit", rps: sets[0], wantS0: []int64{-1, -3}, wantS1: []int64{2}},
+		{name: "inter rps prediction", rps: sets[1], wantS0: []int64{-1, -2, -4}, wantS1: []int64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.rps.DeltaPocS0, tt.wantS0) || !reflect.DeepEqual(tt.rps.DeltaPocS1, tt.wantS1) {
+				t.Errorf("H265ShortTermRefPicSet.Decode() S0 = %v S1 = %v, want %v %v", tt.rps.DeltaPocS0, tt.rps.DeltaPocS1, tt.wantS0, tt.wantS1)
+			}
+			if tt.rps.NumUsedByCurrPic() != tt.rps.NumDeltaPocs() {
+				t.Errorf("H265ShortTermRefPicSet.NumUsedByCurrPic() = %d, want %d", tt.rps.NumUsedByCurrPic(), tt.rps.NumDeltaPocs())
+			}
+		})
+	}
+}
+
+// 基于sps/pps构造slice, sps中没有st_ref_pic_set, pps打开了weighted_pred和entropy_coding_sync
+func testH265Slice(naluType H265_NAL_TYPE, sliceType uint64, pocLsb uint64, s0 []uint64, s1 []uint64) []byte {
+	fields := []string{"1"}
+	irap := naluType >= H265_NAL_SLICE_BLA_W_LP && naluType <= 23
+	if irap {
+		fields = append(fields, "0")
+	}
+	fields = append(fields, testUE(0), testUE(sliceType))
+	if naluType != H265_NAL_SLICE_IDR_W_RADL && naluType != H265_NAL_SLICE_IDR_N_LP {
+		fields = append(fields, testU(pocLsb, 8), "0", testUE(uint64(len(s0))), testUE(uint64(len(s1))))
+		for _, d := range s0 {
+			fields = append(fields, testUE(d-1), "1")
+		}
+		for _, d := range s1 {
+			fields = append(fields, testUE(d-1), "1")
+		}
+		fields = append(fields, "0")
+	}
+	fields = append(fields, "0", "0")
+	if sliceType != H265_SLICE_I {
+		fields = append(fields, "0")
+		if sliceType == H265_SLICE_B {
+			fields = append(fields, "0")
+		} else {
+			fields = append(fields, testUE(0), "1", "0", "0")
+		}
+		fields = append(fields, testUE(0))
+	}
+	fields = append(fields, "1", "1", testUE(0), "10101010")
+	return append([]byte{0x00, 0x00, 0x00, 0x01, byte(naluType) << 1, 0x01}, testBits(fields...)...)
+}
+
+// 解码顺序 IDR0 P4 B2 b1 b3
+func testH265IBPStream() [][]byte {
+	header := append(append([]byte{}, sps...), pps...)
+	return [][]byte{
+		append(header, testH265Slice(H265_NAL_SLICE_IDR_W_RADL, H265_SLICE_I, 0, nil, nil)...),
+		testH265Slice(H265_NAL_LICE_TRAIL_R, H265_SLICE_P, 4, []uint64{4}, nil),
+		testH265Slice(H265_NAL_LICE_TRAIL_R, H265_SLICE_B, 2, []uint64{2}, []uint64{2}),
+		testH265Slice(H265_NAL_Slice_TRAIL_N, H265_SLICE_B, 1, []uint64{1}, []uint64{1, 3}),
+		testH265Slice(H265_NAL_Slice_TRAIL_N, H265_SLICE_B, 3, []uint64{1, 3}, []uint64{1}),
+	}
+}
+
+func TestH265SliceHeader_Decode(t *testing.T) {
+	rawsps := &H265RawSPS{}
+	rawsps.Decode(sps[4:])
+	rawpps := &H265RawPPS{}
+	rawpps.Decode(pps[4:])
+	stream := testH265IBPStream()
+	tests := []struct {
+		name          string
+		nalu          []byte
+		wantSliceType uint64
+		wantPocLsb    uint64
+		wantS0        []int64
+		wantS1        []int64
+	}{
+		{name: "idr", nalu: stream[0][len(sps)+len(pps)+4:], wantSliceType: H265_SLICE_I},
+		{name: "p", nalu: stream[1][4:], wantSliceType: H265_SLICE_P, wantPocLsb: 4, wantS0: []int64{-4}, wantS1: []int64{}},
+		{name: "b", nalu: stream[3][4:], wantSliceType: H265_SLICE_B, wantPocLsb: 1, wantS0: []int64{-1}, wantS1: []int64{1, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if GetH265SlicePPSId(tt.nalu) != 0 {
+				t.Fatalf("GetH265SlicePPSId() = %d, want 0", GetH265SlicePPSId(tt.nalu))
+			}
+			sh := &H265SliceHeader{}
+			if err := sh.Decode(tt.nalu, rawsps, rawpps); err != nil {
+				t.Fatal(err)
+			}
+			if sh.Slice_type != tt.wantSliceType || sh.Slice_pic_order_cnt_lsb != tt.wantPocLsb {
+				t.Errorf("H265SliceHeader.Decode() slice_type = %d poc_lsb = %d, want %d %d", sh.Slice_type, sh.Slice_pic_order_cnt_lsb, tt.wantSliceType, tt.wantPocLsb)
+			}
+			if sh.IsIDR() {
+				return
+			}
+			rps := sh.ShortTermRefPicSet(rawsps)
+			if !reflect.DeepEqual(rps.DeltaPocS0, tt.wantS0) || !reflect.DeepEqual(rps.DeltaPocS1, tt.wantS1) {
+				t.Errorf("H265SliceHeader.Decode() rps S0 = %v S1 = %v, want %v %v", rps.DeltaPocS0, rps.DeltaPocS1, tt.wantS0, tt.wantS1)
+			}
+			if sh.Entry_point_offset_minus1 != nil || sh.Five_minus_max_num_merge_cand != 0 {
+				t.Errorf("H265SliceHeader.Decode() = %+v", sh)
+			}
+		})
+	}
+}
+
+func TestH265SliceHeaderSize(t *testing.T) {
+	rawsps := &H265RawSPS{}
+	rawsps.Decode(sps[4:])
+	rawpps := &H265RawPPS{}
+	rawpps.Decode(pps[4:])
+	stream := testH265IBPStream()
+	tests := []struct {
+		name string
+		nalu []byte
+		want int
+	}{
+		{name: "idr", nalu: stream[0][len(sps)+len(pps)+4:], want: 4},
+		{name: "p", nalu: stream[1][4:], want: 7},
+		{name: "b", nalu: stream[3][4:], want: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := H265SliceHeaderSize(tt.nalu, rawsps, rawpps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("H265SliceHeaderSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestH265PocCalculator_Calculate(t *testing.T) {
+	rawsps := &H265RawSPS{Log2_max_pic_order_cnt_lsb_minus4: 4}
+	tests := []struct {
+		name string
+		sh   H265SliceHeader
+		eos  bool
+		want int64
+	}{
+		{name: "idr", sh: H265SliceHeader{Nal_unit_type: H265_NAL_SLICE_IDR_W_RADL}, want: 0},
+		{name: "trail", sh: H265SliceHeader{Nal_unit_type: H265_NAL_LICE_TRAIL_R, Slice_pic_order_cnt_lsb: 100}, want: 100},
+		{name: "trail2", sh: H265SliceHeader{Nal_unit_type: H265_NAL_LICE_TRAIL_R, Slice_pic_order_cnt_lsb: 200}, want: 200},
+		{name: "before wrap", sh: H265SliceHeader{Nal_unit_type: H265_NAL_LICE_TRAIL_R, Slice_pic_order_cnt_lsb: 250}, want: 250},
+		{name: "wrap", sh: H265SliceHeader{Nal_unit_type: H265_NAL_LICE_TRAIL_R, Slice_pic_order_cnt_lsb: 4}, want: 260},
+		{name: "non ref", sh: H265SliceHeader{Nal_unit_type: H265_NAL_Slice_TRAIL_N, Slice_pic_order_cnt_lsb: 254}, want: 254},
+		{name: "cra", sh: H265SliceHeader{Nal_unit_type: H265_NAL_SLICE_CRA, Slice_pic_order_cnt_lsb: 20}, eos: true, want: 276},
+		{name: "cra after eos", sh: H265SliceHeader{Nal_unit_type: H265_NAL_SLICE_CRA, Slice_pic_order_cnt_lsb: 30}, want: 30},
+		{name: "trail after cra", sh: H265SliceHeader{Nal_unit_type: H265_NAL_LICE_TRAIL_R, Slice_pic_order_cnt_lsb: 34}, want: 34},
+	}
+	calc := NewH265PocCalculator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calc.Calculate(&tt.sh, rawsps); got != tt.want {
+				t.Errorf("H265PocCalculator.Calculate() = %v, want %v", got, tt.want)
+			}
+			if tt.eos {
+				calc.EndOfSequence()
+			}
+		})
+	}
+}
+
+// vps2/pps2是手工修改过的不完整码流,不参与round-trip
+func TestH265ParameterSet_Encode(t *testing.T) {
+	var nalus [][]byte
+	for _, frame := range [][]byte{vps, sps, h265sps2, pps, dst} {
+		SplitFrame(frame, func(nalu []byte) bool {
+			nalus = append(nalus, nalu)
+			return true
+		})
+	}
+	//nuh_layer_id 1, nuh_temporal_id_plus1 2
+	for _, nalu := range nalus {
+		if typ := H265NaluTypeWithoutStartCode(nalu); typ >= H265_NAL_VPS && typ <= H265_NAL_PPS {
+			layered := append([]byte{nalu[0], 0x0A}, nalu[2:]...)
+			nalus = append(nalus, layered)
+		}
+	}
+	for _, nalu := range nalus {
+		t.Run(fmt.Sprintf("nalu type %d header %x", H265NaluTypeWithoutStartCode(nalu), nalu[:2]), func(t *testing.T) {
+			var got []byte
+			switch H265NaluTypeWithoutStartCode(nalu) {
+			case H265_NAL_VPS:
+				rawvps := &VPS{}
+				rawvps.Decode(nalu)
+				got = rawvps.Encode()
+			case H265_NAL_SPS:
+				rawsps := &H265RawSPS{}
+				rawsps.Decode(nalu)
+				got = rawsps.Encode()
+			case H265_NAL_PPS:
+				rawpps := &H265RawPPS{}
+				rawpps.Decode(nalu)
+				got = rawpps.Encode()
+			}
+			if !bytes.Equal(got, nalu) {
+				t.Errorf("Encode() = %x, want %x", got, nalu)
+			}
+		})
+	}
+}
+
+func TestH265RawSPS_Encode_PatchVui(t *testing.T) {
+	rawsps := &H265RawSPS{}
+	rawsps.Decode(sps[4:])
+	rawsps.Sps_seq_parameter_set_id = 2
+	rawsps.Ptl.General_level_idc = 153
+	rawsps.Vui.Vui_num_units_in_tick = 1001
+	rawsps.Vui.Vui_time_scale = 60000
+	rawsps.Vui.Bitstream_restriction_flag = 1
+	rawsps.Vui.Min_spatial_segmentation_idc = 4
+	patched := &H265RawSPS{}
+	patched.Decode(rawsps.Encode())
+	if !reflect.DeepEqual(patched, rawsps) {
+		t.Errorf("H265RawSPS.Encode() patched = %+v, want %+v", patched, rawsps)
+	}
+	if GetH265SPSId(rawsps.Encode()) != 2 {
+		t.Errorf("GetH265SPSId() = %d, want 2", GetH265SPSId(rawsps.Encode()))
+	}
+}
@@ -0,0 +1,538 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ISO/IEC 14496-3 1.7 LATM/LOAS
+//
+// AudioSyncStream() {
+//     while (nextbits() == 0x2B7) {
+//         syncword;                11   bslbf
+//         audioMuxLengthBytes;     13   uimsbf
+//         AudioMuxElement(1);
+//     }
+// }
+//
+// AudioMuxElement(muxConfigPresent) {
+//     if (muxConfigPresent) {
+//         useSameStreamMux;        1    bslbf
+//         if (!useSameStreamMux)
+//             StreamMuxConfig();
+//     }
+//     if (audioMuxVersionA == 0) {
+//         for (i = 0; i <= numSubFrames; i++) {
+//             PayloadLengthInfo();
+//             PayloadMux();
+//         }
+//         if (otherDataPresent) {
+//             for(i = 0; I < otherDataLenBits; I++) {
+//                 otherDataBit;    1    bslbf
+//             }
+//         }
+//     }
+//     byte_alignment();
+// }
+//
+// 目前只支持allStreamsSameTimeFraming=1, frameLengthType=0(AAC)的码流, 这也是绝大多数LATM码流的形式
+
+const LOAS_SYNC_WORD = 0x2B7
+
+var errLATMUnsupported = errors.New("unsupported latm stream")
+
+type LATMStreamConfig struct {
+	Program                   uint8
+	Layer                     uint8
+	UseSameConfig             uint8
+	AscLen                    uint32 // audioMuxVersion==1时有效
+	AudioSpecificConfig       []byte
+	FrameLengthType           uint8
+	LatmBufferFullness        uint8
+	CoreFrameOffset           uint8
+	FrameLength               uint16
+	CELPframeLengthTableIndex uint8
+	HVXCframeLengthTableIndex uint8
+}
+
+type StreamMuxConfig struct {
+	AudioMuxVersion           uint8
+	AudioMuxVersionA          uint8
+	TaraBufferFullness        uint32
+	AllStreamsSameTimeFraming uint8
+	NumSubFrames              uint8
+	NumProgram                uint8
+	NumLayer                  [16]uint8
+	Streams                   []LATMStreamConfig
+	OtherDataPresent          uint8
+	OtherDataLenBits          uint32
+	CrcCheckPresent           uint8
+	CrcCheckSum               uint8
+}
+
+// 单个AAC流的StreamMuxConfig, 每个AudioMuxElement携带一帧AAC
+func NewStreamMuxConfig(asc []byte) (*StreamMuxConfig, error) {
+	if _, err := audioSpecificConfigBits(asc); err != nil {
+		return nil, err
+	}
+	return &StreamMuxConfig{
+		AllStreamsSameTimeFraming: 1,
+		Streams: []LATMStreamConfig{{
+			AudioSpecificConfig: append([]byte{}, asc...),
+			LatmBufferFullness:  0xFF,
+		}},
+	}, nil
+}
+
+// 解析sdp fmtp中config携带的StreamMuxConfig
+func (smc *StreamMuxConfig) Decode(data []byte) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("decode StreamMuxConfig failed: %v", e)
+		}
+	}()
+	smc.decode(NewBitStream(data))
+	return nil
+}
+
+func (smc *StreamMuxConfig) Encode() []byte {
+	bsw := NewBitStreamWriter(64)
+	smc.encode(bsw)
+	return bsw.Bits()
+}
+
+// program 0 layer 0的AudioSpecificConfig
+func (smc *StreamMuxConfig) AudioSpecificConfig() []byte {
+	if len(smc.Streams) == 0 {
+		return nil
+	}
+	return smc.Streams[0].AudioSpecificConfig
+}
+
+func (smc *StreamMuxConfig) decode(bs *BitStream) {
+	*smc = StreamMuxConfig{}
+	smc.AudioMuxVersion = bs.GetBit()
+	if smc.AudioMuxVersion == 1 {
+		smc.AudioMuxVersionA = bs.GetBit()
+	}
+	if smc.AudioMuxVersionA != 0 {
+		panic(errLATMUnsupported)
+	}
+	if smc.AudioMuxVersion == 1 {
+		smc.TaraBufferFullness = latmGetValue(bs)
+	}
+	smc.AllStreamsSameTimeFraming = bs.GetBit()
+	smc.NumSubFrames = bs.Uint8(6)
+	smc.NumProgram = bs.Uint8(4)
+	for prog := 0; prog <= int(smc.NumProgram); prog++ {
+		smc.NumLayer[prog] = bs.Uint8(3)
+		for lay := 0; lay <= int(smc.NumLayer[prog]); lay++ {
+			stream := LATMStreamConfig{Program: uint8(prog), Layer: uint8(lay)}
+			if prog != 0 || lay != 0 {
+				stream.UseSameConfig = bs.GetBit()
+			}
+			if stream.UseSameConfig == 0 {
+				if smc.AudioMuxVersion == 0 {
+					stream.AudioSpecificConfig = readAudioSpecificConfig(bs, -1)
+				} else {
+					stream.AscLen = latmGetValue(bs)
+					stream.AudioSpecificConfig = readAudioSpecificConfig(bs, int(stream.AscLen))
+				}
+			} else {
+				stream.AudioSpecificConfig = smc.Streams[len(smc.Streams)-1].AudioSpecificConfig
+			}
+			stream.FrameLengthType = bs.Uint8(3)
+			switch stream.FrameLengthType {
+			case 0:
+				stream.LatmBufferFullness = bs.Uint8(8)
+				if smc.AllStreamsSameTimeFraming == 0 && lay > 0 {
+					aot := audioObjectType(stream.AudioSpecificConfig)
+					preAot := audioObjectType(smc.Streams[len(smc.Streams)-1].AudioSpecificConfig)
+					if (aot == 6 || aot == 20) && (preAot == 8 || preAot == 24) {
+						stream.CoreFrameOffset = bs.Uint8(6)
+					}
+				}
+			case 1:
+				stream.FrameLength = bs.Uint16(9)
+			case 3, 4, 5:
+				stream.CELPframeLengthTableIndex = bs.Uint8(6)
+			case 6, 7:
+				stream.HVXCframeLengthTableIndex = bs.GetBit()
+			}
+			smc.Streams = append(smc.Streams, stream)
+		}
+	}
+	smc.OtherDataPresent = bs.GetBit()
+	if smc.OtherDataPresent == 1 {
+		if smc.AudioMuxVersion == 1 {
+			smc.OtherDataLenBits = latmGetValue(bs)
+		} else {
+			for {
+				smc.OtherDataLenBits <<= 8
+				esc := bs.GetBit()
+				smc.OtherDataLenBits += uint32(bs.Uint8(8))
+				if esc == 0 {
+					break
+				}
+			}
+		}
+	}
+	smc.CrcCheckPresent = bs.GetBit()
+	if smc.CrcCheckPresent == 1 {
+		smc.CrcCheckSum = bs.Uint8(8)
+	}
+}
+
+func (smc *StreamMuxConfig) encode(bsw *BitStreamWriter) {
+	bsw.PutUint8(smc.AudioMuxVersion, 1)
+	if smc.AudioMuxVersion == 1 {
+		bsw.PutUint8(smc.AudioMuxVersionA, 1)
+		latmPutValue(bsw, smc.TaraBufferFullness)
+	}
+	bsw.PutUint8(smc.AllStreamsSameTimeFraming, 1)
+	bsw.PutUint8(smc.NumSubFrames, 6)
+	bsw.PutUint8(smc.NumProgram, 4)
+	idx := 0
+	for prog := 0; prog <= int(smc.NumProgram); prog++ {
+		bsw.PutUint8(smc.NumLayer[prog], 3)
+		for lay := 0; lay <= int(smc.NumLayer[prog]); lay++ {
+			stream := &smc.Streams[idx]
+			idx++
+			if prog != 0 || lay != 0 {
+				bsw.PutUint8(stream.UseSameConfig, 1)
+			}
+			if stream.UseSameConfig == 0 {
+				ascBits, _ := audioSpecificConfigBits(stream.AudioSpecificConfig)
+				if smc.AudioMuxVersion == 1 {
+					if int(stream.AscLen) > ascBits {
+						ascBits = int(stream.AscLen)
+					}
+					latmPutValue(bsw, uint32(ascBits))
+				}
+				putBits(bsw, stream.AudioSpecificConfig, ascBits)
+			}
+			bsw.PutUint8(stream.FrameLengthType, 3)
+			switch stream.FrameLengthType {
+			case 0:
+				bsw.PutUint8(stream.LatmBufferFullness, 8)
+				if smc.AllStreamsSameTimeFraming == 0 && lay > 0 {
+					aot := audioObjectType(stream.AudioSpecificConfig)
+					preAot := audioObjectType(smc.Streams[idx-2].AudioSpecificConfig)
+					if (aot == 6 || aot == 20) && (preAot == 8 || preAot == 24) {
+						bsw.PutUint8(stream.CoreFrameOffset, 6)
+					}
+				}
+			case 1:
+				bsw.PutUint16(stream.FrameLength, 9)
+			case 3, 4, 5:
+				bsw.PutUint8(stream.CELPframeLengthTableIndex, 6)
+			case 6, 7:
+				bsw.PutUint8(stream.HVXCframeLengthTableIndex, 1)
+			}
+		}
+	}
+	bsw.PutUint8(smc.OtherDataPresent, 1)
+	if smc.OtherDataPresent == 1 {
+		if smc.AudioMuxVersion == 1 {
+			latmPutValue(bsw, smc.OtherDataLenBits)
+		} else {
+			n := 0
+			for smc.OtherDataLenBits>>(uint(n+1)*8) > 0 {
+				n++
+			}
+			for i := n; i >= 0; i-- {
+				esc := uint8(0)
+				if i > 0 {
+					esc = 1
+				}
+				bsw.PutUint8(esc, 1)
+				bsw.PutUint8(uint8(smc.OtherDataLenBits>>(uint(i)*8)), 8)
+			}
+		}
+	}
+	bsw.PutUint8(smc.CrcCheckPresent, 1)
+	if smc.CrcCheckPresent == 1 {
+		bsw.PutUint8(smc.CrcCheckSum, 8)
+	}
+}
+
+func (smc *StreamMuxConfig) checkSupport() error {
+	if smc.AllStreamsSameTimeFraming == 0 {
+		return errLATMUnsupported
+	}
+	for _, stream := range smc.Streams {
+		if stream.FrameLengthType != 0 {
+			return errLATMUnsupported
+		}
+	}
+	return nil
+}
+
+type LATMDecoder struct {
+	Config *StreamMuxConfig
+}
+
+// config为带外传输的StreamMuxConfig(rtp cpresent=0), 带内传输时可以为nil
+func NewLATMDecoder(config *StreamMuxConfig) *LATMDecoder {
+	return &LATMDecoder{Config: config}
+}
+
+func (dec *LATMDecoder) AudioSpecificConfig() []byte {
+	if dec.Config == nil {
+		return nil
+	}
+	return dec.Config.AudioSpecificConfig()
+}
+
+// 解析AudioMuxElement, 返回program 0 layer 0每个subframe的raw aac
+func (dec *LATMDecoder) DecodeAudioMuxElement(data []byte, muxConfigPresent bool) (frames [][]byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			frames = nil
+			err = fmt.Errorf("decode AudioMuxElement failed: %v", e)
+		}
+	}()
+	return dec.decodeAudioMuxElement(NewBitStream(data), muxConfigPresent)
+}
+
+// 解析连续的多个AudioMuxElement(rtp payload中可以携带多个), 返回所有subframe的raw aac
+func (dec *LATMDecoder) DecodeAudioMuxElements(data []byte, muxConfigPresent bool) (frames [][]byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			frames = nil
+			err = fmt.Errorf("decode AudioMuxElement failed: %v", e)
+		}
+	}()
+	bs := NewBitStream(data)
+	for bs.RemainBytes() > 0 {
+		tmp, err := dec.decodeAudioMuxElement(bs, muxConfigPresent)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, tmp...)
+	}
+	return frames, nil
+}
+
+func (dec *LATMDecoder) decodeAudioMuxElement(bs *BitStream, muxConfigPresent bool) ([][]byte, error) {
+	if muxConfigPresent {
+		if bs.GetBit() == 0 {
+			config := &StreamMuxConfig{}
+			config.decode(bs)
+			dec.Config = config
+		}
+	}
+	if dec.Config == nil {
+		return nil, errors.New("missing StreamMuxConfig")
+	}
+	if err := dec.Config.checkSupport(); err != nil {
+		return nil, err
+	}
+	frames := make([][]byte, 0, dec.Config.NumSubFrames+1)
+	lengths := make([]int, len(dec.Config.Streams))
+	for i := 0; i <= int(dec.Config.NumSubFrames); i++ {
+		// PayloadLengthInfo
+		for s := range dec.Config.Streams {
+			lengths[s] = 0
+			for {
+				tmp := bs.Uint8(8)
+				lengths[s] += int(tmp)
+				if tmp != 0xFF {
+					break
+				}
+			}
+		}
+		// PayloadMux
+		for s := range dec.Config.Streams {
+			if bs.RemainBits() < lengths[s]*8 {
+				return nil, errors.New("latm payload length exceeds data")
+			}
+			payload := make([]byte, lengths[s])
+			for j := range payload {
+				payload[j] = bs.Uint8(8)
+			}
+			if s == 0 {
+				frames = append(frames, payload)
+			}
+		}
+	}
+	if dec.Config.OtherDataPresent == 1 {
+		bs.SkipBits(int(dec.Config.OtherDataLenBits))
+	}
+	// byte_alignment()
+	bs.SkipBits(bs.RemainBits() % 8)
+	return frames, nil
+}
+
+// 解析一个完整的LOAS帧(AudioSyncStream中的一帧)
+func (dec *LATMDecoder) DecodeLOAS(loas []byte) ([][]byte, error) {
+	if len(loas) < 3 || uint16(loas[0])<<3|uint16(loas[1])>>5 != LOAS_SYNC_WORD {
+		return nil, errors.New("loas sync word not found")
+	}
+	length := int(loas[1]&0x1F)<<8 | int(loas[2])
+	if len(loas) < length+3 {
+		return nil, errors.New("loas frame truncated")
+	}
+	return dec.DecodeAudioMuxElement(loas[3:3+length], true)
+}
+
+type LATMEncoder struct {
+	Config *StreamMuxConfig
+}
+
+func NewLATMEncoder(asc []byte) (*LATMEncoder, error) {
+	config, err := NewStreamMuxConfig(asc)
+	if err != nil {
+		return nil, err
+	}
+	return &LATMEncoder{Config: config}, nil
+}
+
+// 生成AudioMuxElement, frames的个数必须为numSubFrames+1, muxConfigPresent为true时每次都携带StreamMuxConfig
+func (enc *LATMEncoder) EncodeAudioMuxElement(muxConfigPresent bool, frames ...[]byte) ([]byte, error) {
+	if len(frames) != int(enc.Config.NumSubFrames)+1 {
+		return nil, fmt.Errorf("latm need %d subframes", enc.Config.NumSubFrames+1)
+	}
+	if len(enc.Config.Streams) != 1 {
+		return nil, errLATMUnsupported
+	}
+	if err := enc.Config.checkSupport(); err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, frame := range frames {
+		size += len(frame) + len(frame)/255 + 1
+	}
+	bsw := NewBitStreamWriter(size + 64)
+	if muxConfigPresent {
+		bsw.PutUint8(0, 1)
+		enc.Config.encode(bsw)
+	}
+	for _, frame := range frames {
+		length := len(frame)
+		for length >= 0xFF {
+			bsw.PutUint8(0xFF, 8)
+			length -= 0xFF
+		}
+		bsw.PutUint8(uint8(length), 8)
+		for _, b := range frame {
+			bsw.PutUint8(b, 8)
+		}
+	}
+	if enc.Config.OtherDataPresent == 1 {
+		for i := 0; i < int(enc.Config.OtherDataLenBits); i++ {
+			bsw.PutUint8(0, 1)
+		}
+	}
+	return bsw.Bits(), nil
+}
+
+// 生成LOAS帧, 每一帧都携带StreamMuxConfig
+func (enc *LATMEncoder) EncodeLOAS(frames ...[]byte) ([]byte, error) {
+	element, err := enc.EncodeAudioMuxElement(true, frames...)
+	if err != nil {
+		return nil, err
+	}
+	if len(element) > 0x1FFF {
+		return nil, errors.New("loas frame too large")
+	}
+	loas := make([]byte, 3, 3+len(element))
+	loas[0] = LOAS_SYNC_WORD >> 3
+	loas[1] = uint8(LOAS_SYNC_WORD&0x07)<<5 | uint8(len(element)>>8)
+	loas[2] = uint8(len(element))
+	return append(loas, element...), nil
+}
+
+func SplitLOASFrame(frames []byte, onFrame func(loas []byte)) {
+	for i := 0; i+3 <= len(frames); {
+		if frames[i] != 0x56 || frames[i+1]&0xE0 != 0xE0 {
+			i++
+			continue
+		}
+		length := (int(frames[i+1]&0x1F)<<8 | int(frames[i+2])) + 3
+		if i+length > len(frames) {
+			return
+		}
+		onFrame(frames[i : i+length])
+		i += length
+	}
+}
+
+// LatmGetValue()
+func latmGetValue(bs *BitStream) uint32 {
+	bytesForValue := bs.Uint8(2)
+	value := uint32(0)
+	for i := 0; i <= int(bytesForValue); i++ {
+		value = value<<8 | uint32(bs.Uint8(8))
+	}
+	return value
+}
+
+func latmPutValue(bsw *BitStreamWriter, value uint32) {
+	bytesForValue := 0
+	for bytesForValue < 3 && value>>(uint(bytesForValue+1)*8) > 0 {
+		bytesForValue++
+	}
+	bsw.PutUint8(uint8(bytesForValue), 2)
+	for i := bytesForValue; i >= 0; i-- {
+		bsw.PutUint8(uint8(value>>(uint(i)*8)), 8)
+	}
+}
+
+func putBits(bsw *BitStreamWriter, data []byte, bits int) {
+	for i := 0; bits > 0; i++ {
+		var b uint8
+		if i < len(data) {
+			b = data[i]
+		}
+		if bits >= 8 {
+			bsw.PutUint8(b, 8)
+			bits -= 8
+		} else {
+			bsw.PutUint8(b>>uint(8-bits), bits)
+			bits = 0
+		}
+	}
+}
+
+// 从bs中读取AudioSpecificConfig, 按字节对齐返回, bits < 0 时通过解析确定长度
+func readAudioSpecificConfig(bs *BitStream, bits int) []byte {
+	if bits < 0 {
+		bs.Markdot()
+		new(AudioSpecificConfiguration).decode(bs, false)
+		bits = bs.DistanceFromMarkDot()
+		bs.UnRead(bits)
+	}
+	bsw := NewBitStreamWriter((bits + 7) / 8)
+	for ; bits >= 8; bits -= 8 {
+		bsw.PutUint8(bs.Uint8(8), 8)
+	}
+	if bits > 0 {
+		bsw.PutUint8(bs.Uint8(bits), bits)
+		bsw.PutUint8(0, 8-bits)
+	}
+	return bsw.Bits()
+}
+
+// AudioSpecificConfig的实际比特数
+func audioSpecificConfigBits(asc []byte) (bits int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("invalid AudioSpecificConfig: %v", e)
+		}
+	}()
+	bs := NewBitStream(asc)
+	new(AudioSpecificConfiguration).decode(bs, false)
+	return len(asc)*8 - bs.RemainBits(), nil
+}
+
+func audioObjectType(asc []byte) uint8 {
+	if len(asc) == 0 {
+		return 0
+	}
+	aot := asc[0] >> 3
+	if aot == 31 && len(asc) > 1 {
+		aot = 32 + (asc[0]&0x07)<<3 | asc[1]>>5
+	}
+	return aot
+}
@@ -0,0 +1,121 @@
+package codec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestStreamMuxConfig_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  []byte
+		asc     []byte
+		wantErr bool
+	}{
+		{name: "aac lc 44100 stereo", config: []byte{0x40, 0x00, 0x24, 0x20, 0x3F, 0xC0}, asc: []byte{0x12, 0x10}},
+		{name: "aac lc 48000 mono", config: []byte{0x40, 0x00, 0x23, 0x10, 0x3F, 0xC0}, asc: []byte{0x11, 0x88}},
+		{name: "audioMuxVersionA", config: []byte{0xC0, 0x00}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smc := &StreamMuxConfig{}
+			err := smc.Decode(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("StreamMuxConfig.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !bytes.Equal(smc.AudioSpecificConfig(), tt.asc) {
+				t.Errorf("AudioSpecificConfig() = %x, want %x", smc.AudioSpecificConfig(), tt.asc)
+			}
+			if got := smc.Encode(); !bytes.Equal(got, tt.config) {
+				t.Errorf("StreamMuxConfig.Encode() = %x, want %x", got, tt.config)
+			}
+		})
+	}
+}
+
+func TestAudioSpecificConfigBits(t *testing.T) {
+	tests := []struct {
+		name    string
+		asc     []byte
+		want    int
+		wantErr bool
+	}{
+		{name: "aac lc", asc: []byte{0x12, 0x10}, want: 16},
+		{name: "explicit sbr", asc: []byte{0x2B, 0x11, 0x88, 0x00}, want: 25},
+		{name: "escape frequency", asc: []byte{0x17, 0x80, 0x0F, 0xA0, 0x08}, want: 40},
+		{name: "unsupported aot", asc: []byte{0x40, 0x00}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := audioSpecificConfigBits(tt.asc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("audioSpecificConfigBits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("audioSpecificConfigBits() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLATM_LOAS(t *testing.T) {
+	asc := []byte{0x12, 0x10}
+	enc, err := NewLATMEncoder(asc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := [][]byte{bytes.Repeat([]byte{0x21}, 300), {0x01, 0x02, 0x03}, bytes.Repeat([]byte{0xFF}, 255)}
+	var stream []byte
+	for _, frame := range frames {
+		loas, err := enc.EncodeLOAS(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, loas...)
+	}
+
+	dec := NewLATMDecoder(nil)
+	var got [][]byte
+	SplitLOASFrame(append([]byte{0x00, 0x56}, stream...), func(loas []byte) {
+		aacs, err := dec.DecodeLOAS(loas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, aacs...)
+	})
+	if !reflect.DeepEqual(got, frames) {
+		t.Errorf("DecodeLOAS() got %d frames, want %d", len(got), len(frames))
+	}
+	if !bytes.Equal(dec.AudioSpecificConfig(), asc) {
+		t.Errorf("AudioSpecificConfig() = %x, want %x", dec.AudioSpecificConfig(), asc)
+	}
+}
+
+func TestLATM_AudioMuxElementWithoutConfig(t *testing.T) {
+	smc := &StreamMuxConfig{}
+	if err := smc.Decode([]byte{0x40, 0x00, 0x24, 0x20, 0x3F, 0xC0}); err != nil {
+		t.Fatal(err)
+	}
+	enc := &LATMEncoder{Config: smc}
+	element, err := enc.EncodeAudioMuxElement(false, []byte{0xDE, 0xAD, 0xBE, 0xEF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x04, 0xDE, 0xAD, 0xBE, 0xEF}; !bytes.Equal(element, want) {
+		t.Errorf("EncodeAudioMuxElement() = %x, want %x", element, want)
+	}
+	if _, err := NewLATMDecoder(nil).DecodeAudioMuxElement(element, false); err == nil {
+		t.Errorf("DecodeAudioMuxElement() without StreamMuxConfig should fail")
+	}
+	got, err := NewLATMDecoder(smc).DecodeAudioMuxElement(element, false)
+	if err != nil || len(got) != 1 || !bytes.Equal(got[0], []byte{0xDE, 0xAD, 0xBE, 0xEF}) {
+		t.Errorf("DecodeAudioMuxElement() = %x %v", got, err)
+	}
+	if _, err := NewLATMDecoder(smc).DecodeAudioMuxElement([]byte{0x10, 0x00}, false); err == nil {
+		t.Errorf("DecodeAudioMuxElement() with truncated payload should fail")
+	}
+}
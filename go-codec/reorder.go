@@ -0,0 +1,473 @@
+package codec
+
+import (
+	"errors"
+)
+
+// 对含有B帧的裸流(Annex-B)进行时间戳重排序
+// 帧按解码顺序输入,按解码顺序输出,输出时给出正确的pts/dts
+// 设重排序深度为D,第k个显示的帧 pts = 第k+D个解码帧的dts
+//   - 只有dts的输入(WriteWithDts),根据POC推算pts
+//   - 只有pts的输入(WriteWithPts,例如PES中只带了PTS),推算dts
+
+type REORDER_MODE int
+
+const (
+	REORDER_NONE REORDER_MODE = iota
+	REORDER_WITH_DTS
+	REORDER_WITH_PTS
+)
+
+type reorderFrame struct {
+	frame []byte
+	order int64 // 显示顺序
+	pts   uint64
+	dts   uint64
+	idx   int // 解码序号
+	done  bool
+}
+
+type frameReorder struct {
+	mode       REORDER_MODE
+	depth      int
+	decoding   []*reorderFrame // 解码顺序,等待输出
+	pending    []*reorderFrame // 还没有确定显示序号的帧,按order升序
+	timestamps []uint64        // WITH_DTS: 解码帧的dts; WITH_PTS: 已确定显示顺序帧的pts
+	tsBase     int             // timestamps[0] 对应的序号
+	numDecoded int
+	numShowed  int
+	lastDts    uint64
+	hasLastDts bool
+	onFrame    func(frame []byte, pts uint64, dts uint64)
+}
+
+func (r *frameReorder) push(frame []byte, order int64, ts uint64, mode REORDER_MODE) error {
+	if r.mode == REORDER_NONE {
+		r.mode = mode
+	} else if r.mode != mode {
+		return errors.New("reorder mode can not be changed")
+	}
+	f := &reorderFrame{
+		frame: make([]byte, len(frame)),
+		order: order,
+		idx:   r.numDecoded,
+	}
+	copy(f.frame, frame)
+	r.numDecoded++
+	if mode == REORDER_WITH_DTS {
+		f.dts = ts
+		r.timestamps = append(r.timestamps, ts)
+	} else {
+		f.pts = ts
+	}
+	r.decoding = append(r.decoding, f)
+	i := len(r.pending)
+	for i > 0 && r.pending[i-1].order > order {
+		i--
+	}
+	r.pending = append(r.pending, nil)
+	copy(r.pending[i+1:], r.pending[i:])
+	r.pending[i] = f
+	for len(r.pending) > r.depth {
+		r.show()
+	}
+	r.output(false)
+	return nil
+}
+
+// 确定pending中显示顺序最小的帧的显示序号
+func (r *frameReorder) show() {
+	f := r.pending[0]
+	r.pending = r.pending[1:]
+	if r.mode == REORDER_WITH_DTS {
+		f.pts = r.timestampAt(r.numShowed + r.depth)
+		f.done = true
+	} else {
+		r.timestamps = append(r.timestamps, f.pts)
+	}
+	r.numShowed++
+}
+
+// 取序号为idx的时间戳,超过已有范围时按照最后两个时间戳的间隔外推
+func (r *frameReorder) timestampAt(idx int) uint64 {
+	last := r.tsBase + len(r.timestamps) - 1
+	if idx <= last {
+		return r.timestamps[idx-r.tsBase]
+	}
+	return r.timestamps[len(r.timestamps)-1] + uint64(idx-last)*r.duration()
+}
+
+func (r *frameReorder) duration() uint64 {
+	n := len(r.timestamps)
+	if n < 2 || r.timestamps[n-1] < r.timestamps[n-2] {
+		return 0
+	}
+	return r.timestamps[n-1] - r.timestamps[n-2]
+}
+
+func (r *frameReorder) output(flush bool) {
+	for len(r.decoding) > 0 {
+		f := r.decoding[0]
+		if r.mode == REORDER_WITH_PTS && !r.resolveDts(f, flush) {
+			break
+		} else if r.mode == REORDER_WITH_DTS && !f.done {
+			break
+		}
+		r.decoding = r.decoding[1:]
+		if r.mode == REORDER_WITH_PTS {
+			if r.hasLastDts && f.dts < r.lastDts {
+				f.dts = r.lastDts
+			}
+			if f.dts > f.pts {
+				f.dts = f.pts
+			}
+			r.lastDts = f.dts
+			r.hasLastDts = true
+		}
+		if r.onFrame != nil {
+			r.onFrame(f.frame, f.pts, f.dts)
+		}
+	}
+	r.trim()
+}
+
+// 第n个解码帧 dts = 第n-D个显示帧的pts, 前D帧按帧间隔往前推
+func (r *frameReorder) resolveDts(f *reorderFrame, flush bool) bool {
+	if f.idx >= r.depth {
+		if f.idx-r.depth >= r.numShowed {
+			return false
+		}
+		f.dts = r.timestamps[f.idx-r.depth-r.tsBase]
+		return true
+	}
+	if r.numShowed < 2 && !flush {
+		return false
+	}
+	if r.numShowed == 0 {
+		f.dts = f.pts
+		return true
+	}
+	first := r.timestamps[0-r.tsBase]
+	var dur uint64
+	if r.numShowed >= 2 && r.timestamps[1-r.tsBase] > first {
+		dur = r.timestamps[1-r.tsBase] - first
+	}
+	delta := uint64(r.depth-f.idx) * dur
+	if delta > first {
+		f.dts = 0
+	} else {
+		f.dts = first - delta
+	}
+	return true
+}
+
+// 丢弃不再需要的时间戳,保留两个用于计算帧间隔
+func (r *frameReorder) trim() {
+	var need int
+	if r.mode == REORDER_WITH_DTS {
+		need = r.numShowed + r.depth
+	} else {
+		if len(r.decoding) > 0 {
+			need = r.decoding[0].idx - r.depth
+		} else {
+			need = r.numDecoded - r.depth
+		}
+		if need < 2 {
+			need = 0
+		}
+	}
+	drop := need - r.tsBase - 2
+	if drop > len(r.timestamps)-2 {
+		drop = len(r.timestamps) - 2
+	}
+	if drop > 0 {
+		r.timestamps = r.timestamps[drop:]
+		r.tsBase += drop
+	}
+}
+
+func (r *frameReorder) flush() {
+	for len(r.pending) > 0 {
+		r.show()
+	}
+	r.output(true)
+}
+
+// 重排序深度变化(新的sps)时,先把缓存中的帧全部输出
+func (r *frameReorder) reset(depth int) {
+	r.flush()
+	mode, onFrame := r.mode, r.onFrame
+	lastDts, hasLastDts := r.lastDts, r.hasLastDts
+	*r = frameReorder{mode: mode, depth: depth, onFrame: onFrame, lastDts: lastDts, hasLastDts: hasLastDts}
+}
+
+type H264Reorder struct {
+	OnFrame func(frame []byte, pts uint64, dts uint64)
+	reorder *frameReorder
+	spss    map[uint64]*SPS
+	ppss    map[uint64]*PPS
+	poc     H264PocCalculator
+	period  int64
+	cache   []byte // 还没有vcl nalu的数据(sps/pps/sei等), 和下一帧一起输出
+}
+
+func NewH264Reorder() *H264Reorder {
+	return &H264Reorder{
+		spss: make(map[uint64]*SPS),
+		ppss: make(map[uint64]*PPS),
+	}
+}
+
+// 输入一帧(一个access unit)和它的dts, 推算pts
+func (r *H264Reorder) WriteWithDts(frame []byte, dts uint64) error {
+	return r.write(frame, dts, REORDER_WITH_DTS)
+}
+
+// 输入一帧(一个access unit)和它的pts, 推算dts
+func (r *H264Reorder) WriteWithPts(frame []byte, pts uint64) error {
+	return r.write(frame, pts, REORDER_WITH_PTS)
+}
+
+// 输出缓存中的所有帧
+func (r *H264Reorder) Flush() {
+	if r.reorder != nil {
+		r.reorder.onFrame = r.OnFrame
+		r.reorder.flush()
+	}
+	r.cache = nil
+}
+
+func (r *H264Reorder) write(frame []byte, ts uint64, mode REORDER_MODE) error {
+	var sh *SliceHeader
+	var sps *SPS
+	var err error
+	SplitFrame(frame, func(nalu []byte) bool {
+		naluType := H264NaluTypeWithoutStartCode(nalu)
+		switch naluType {
+		case H264_NAL_SPS:
+			s := &SPS{}
+			if err = decodeH264ParameterSet(nalu, s.Decode); err == nil {
+				r.spss[s.Seq_parameter_set_id] = s
+			}
+		case H264_NAL_PPS:
+			p := &PPS{}
+			if err = decodeH264ParameterSet(nalu, p.Decode); err == nil {
+				r.ppss[p.Pic_parameter_set_id] = p
+			}
+		default:
+			if !IsH264VCLNaluType(naluType) {
+				return true
+			}
+			sh, sps, err = r.decodeSliceHeader(nalu)
+			return false
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if sh == nil {
+		r.cache = append(r.cache, frame...)
+		return nil
+	}
+	if len(r.cache) > 0 {
+		frame = append(r.cache, frame...)
+		r.cache = nil
+	}
+
+	depth := h264ReorderDepth(sps)
+	if r.reorder == nil {
+		r.reorder = &frameReorder{depth: depth, onFrame: r.OnFrame}
+	} else if sh.IdrPicFlag && depth != r.reorder.depth {
+		r.reorder.reset(depth)
+	}
+	r.reorder.onFrame = r.OnFrame
+
+	poc := r.poc.Calculate(sh, sps)
+	if sh.IdrPicFlag || sh.HasMMCO5 {
+		r.period++
+	}
+	return r.reorder.push(frame, r.period<<32+poc, ts, mode)
+}
+
+func (r *H264Reorder) decodeSliceHeader(nalu []byte) (sh *SliceHeader, sps *SPS, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			sh, sps, err = nil, nil, errors.New("h264 slice header out of range")
+		}
+	}()
+	sodb := CovertRbspToSodb(nalu)
+	bs := NewBitStream(sodb)
+	var hdr H264NaluHdr
+	hdr.Decode(bs)
+	sh = &SliceHeader{}
+	sh.Decode(NewBitStream(sodb[1:]))
+	pps, found := r.ppss[sh.Pic_parameter_set_id]
+	if !found {
+		return nil, nil, errors.New("h264 pps not found")
+	}
+	sps, found = r.spss[pps.Seq_parameter_set_id]
+	if !found {
+		return nil, nil, errors.New("h264 sps not found")
+	}
+	if err = sh.DecodeFull(bs, &hdr, sps, pps); err != nil {
+		return nil, nil, err
+	}
+	return sh, sps, nil
+}
+
+func decodeH264ParameterSet(nalu []byte, decode func(bs *BitStream)) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.New("h264 parameter set out of range")
+		}
+	}()
+	bs := NewBitStream(CovertRbspToSodb(nalu[1:]))
+	decode(bs)
+	return nil
+}
+
+// 重排序深度: 优先使用vui中的max_num_reorder_frames
+func h264ReorderDepth(sps *SPS) int {
+	if sps.Vui_parameters_present_flag == 1 && sps.VuiParameters.BitstreamRestrictionFlag == 1 {
+		return int(sps.VuiParameters.NumReorderFrames)
+	}
+	// baseline profile 以及 poc type 2 的码流,显示顺序和解码顺序一致
+	if sps.Profile_idc == 66 || sps.Pic_order_cnt_type == 2 {
+		return 0
+	}
+	if sps.Max_num_ref_frames > 16 {
+		return 16
+	}
+	return int(sps.Max_num_ref_frames)
+}
+
+type H265Reorder struct {
+	OnFrame func(frame []byte, pts uint64, dts uint64)
+	reorder *frameReorder
+	spss    map[uint64]*H265RawSPS
+	ppss    map[uint64]*H265RawPPS
+	poc     H265PocCalculator
+	period  int64
+	cache   []byte
+}
+
+func NewH265Reorder() *H265Reorder {
+	return &H265Reorder{
+		spss: make(map[uint64]*H265RawSPS),
+		ppss: make(map[uint64]*H265RawPPS),
+	}
+}
+
+// 输入一帧(一个access unit)和它的dts, 推算pts
+func (r *H265Reorder) WriteWithDts(frame []byte, dts uint64) error {
+	return r.write(frame, dts, REORDER_WITH_DTS)
+}
+
+// 输入一帧(一个access unit)和它的pts, 推算dts
+func (r *H265Reorder) WriteWithPts(frame []byte, pts uint64) error {
+	return r.write(frame, pts, REORDER_WITH_PTS)
+}
+
+// 输出缓存中的所有帧
+func (r *H265Reorder) Flush() {
+	if r.reorder != nil {
+		r.reorder.onFrame = r.OnFrame
+		r.reorder.flush()
+	}
+	r.cache = nil
+}
+
+func (r *H265Reorder) write(frame []byte, ts uint64, mode REORDER_MODE) error {
+	var sh *H265SliceHeader
+	var sps *H265RawSPS
+	var err error
+	eos := false
+	SplitFrame(frame, func(nalu []byte) bool {
+		naluType := H265NaluTypeWithoutStartCode(nalu)
+		switch naluType {
+		case H265_NAL_SPS:
+			s := &H265RawSPS{}
+			if err = decodeH265ParameterSet(nalu, s.Decode); err == nil {
+				r.spss[s.Sps_seq_parameter_set_id] = s
+			}
+		case H265_NAL_PPS:
+			p := &H265RawPPS{}
+			if err = decodeH265ParameterSet(nalu, p.Decode); err == nil {
+				r.ppss[p.Pps_pic_parameter_set_id] = p
+			}
+		case 36, 37: //EOS_NUT EOB_NUT
+			eos = true
+		default:
+			if !IsH265VCLNaluType(naluType) {
+				return true
+			}
+			sh, sps, err = r.decodeSliceHeader(nalu)
+			return false
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if sh == nil {
+		r.cache = append(r.cache, frame...)
+		if eos {
+			r.poc.EndOfSequence()
+		}
+		return nil
+	}
+	if len(r.cache) > 0 {
+		frame = append(r.cache, frame...)
+		r.cache = nil
+	}
+
+	depth := int(sps.Sps_max_num_reorder_pics[sps.Sps_max_sub_layers_minus1])
+	pocReset := r.poc.IsPocReset(sh)
+	if r.reorder == nil {
+		r.reorder = &frameReorder{depth: depth, onFrame: r.OnFrame}
+	} else if pocReset && depth != r.reorder.depth {
+		r.reorder.reset(depth)
+	}
+	r.reorder.onFrame = r.OnFrame
+
+	poc := r.poc.Calculate(sh, sps)
+	if pocReset {
+		r.period++
+	}
+	if eos {
+		r.poc.EndOfSequence()
+	}
+	return r.reorder.push(frame, r.period<<32+poc, ts, mode)
+}
+
+func (r *H265Reorder) decodeSliceHeader(nalu []byte) (sh *H265SliceHeader, sps *H265RawSPS, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			sh, sps, err = nil, nil, errors.New("h265 slice header out of range")
+		}
+	}()
+	pps, found := r.ppss[GetH265SlicePPSId(nalu)]
+	if !found {
+		return nil, nil, errors.New("h265 pps not found")
+	}
+	sps, found = r.spss[pps.Pps_seq_parameter_set_id]
+	if !found {
+		return nil, nil, errors.New("h265 sps not found")
+	}
+	sh = &H265SliceHeader{}
+	if err = sh.Decode(nalu, sps, pps); err != nil {
+		return nil, nil, err
+	}
+	return sh, sps, nil
+}
+
+func decodeH265ParameterSet(nalu []byte, decode func(nalu []byte)) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.New("h265 parameter set out of range")
+		}
+	}()
+	decode(nalu)
+	return nil
+}
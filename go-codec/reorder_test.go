@@ -0,0 +1,234 @@
+package codec
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 用'0'/'1'字符串构造码流
+func testBits(fields ...string) []byte {
+	bits := strings.Join(fields, "") + "1"
+	for len(bits)%8 != 0 {
+		bits += "0"
+	}
+	buf := make([]byte, len(bits)/8)
+	for i, c := range bits {
+		if c == '1' {
+			buf[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return buf
+}
+
+func testUE(v uint64) string {
+	s := fmt.Sprintf("%b", v+1)
+	return strings.Repeat("0", len(s)-1) + s
+}
+
+func testU(v uint64, n int) string {
+	return fmt.Sprintf("%0*b", n, v)
+}
+
+// main profile, 320x240, poc type 0, log2_max_poc_lsb = 6
+func testH264SPS(numReorderFrames int) []byte {
+	fields := []string{testU(77, 8), testU(0, 8), testU(30, 8), testUE(0), testUE(0), testUE(0), testUE(2), testUE(2),
+		"0", testUE(19), testUE(14), "1", "1", "0"}
+	if numReorderFrames < 0 {
+		fields = append(fields, "0")
+	} else {
+		// 只有bitstream_restriction的vui
+		fields = append(fields, "1", "0000000", "0", "1", "1", testUE(0), testUE(0), testUE(16), testUE(16),
+			testUE(uint64(numReorderFrames)), testUE(2))
+	}
+	return append([]byte{0x00, 0x00, 0x00, 0x01, 0x67}, testBits(fields...)...)
+}
+
+func testH264PPS() []byte {
+	return append([]byte{0x00, 0x00, 0x00, 0x01, 0x68}, testBits(testUE(0), testUE(0), "0", "0", testUE(0), testUE(0), testUE(0),
+		"0", "00", testUE(0), testUE(0), testUE(0), "1", "0", "0")...)
+}
+
+// sliceType: 0 P, 1 B, 2 I
+func testH264Slice(idr bool, ref bool, sliceType uint64, frameNum uint64, pocLsb uint64) []byte {
+	hdr := byte(0x01)
+	if idr {
+		hdr = 0x65
+	} else if ref {
+		hdr = 0x41
+	}
+	fields := []string{testUE(0), testUE(sliceType + 5), testUE(0), testU(frameNum, 4)}
+	if idr {
+		fields = append(fields, testUE(0))
+	}
+	fields = append(fields, testU(pocLsb, 6))
+	if sliceType == H264_SLICE_B {
+		fields = append(fields, "1")
+	}
+	if sliceType != H264_SLICE_I {
+		fields = append(fields, "0", "0")
+		if sliceType == H264_SLICE_B {
+			fields = append(fields, "0")
+		}
+	}
+	if idr {
+		fields = append(fields, "00")
+	} else if ref {
+		fields = append(fields, "0")
+	}
+	fields = append(fields, testUE(0), testUE(1), "10101010")
+	return append([]byte{0x00, 0x00, 0x00, 0x01, hdr}, testBits(fields...)...)
+}
+
+// 解码顺序 I0 P2 B1 P4 B3 I0(idr) P2 B1
+func testH264IBPStream(numReorderFrames int) [][]byte {
+	header := append(testH264SPS(numReorderFrames), testH264PPS()...)
+	return [][]byte{
+		append(append([]byte{}, header...), testH264Slice(true, true, H264_SLICE_I, 0, 0)...),
+		testH264Slice(false, true, H264_SLICE_P, 1, 4),
+		testH264Slice(false, false, H264_SLICE_B, 2, 2),
+		testH264Slice(false, true, H264_SLICE_P, 2, 8),
+		testH264Slice(false, false, H264_SLICE_B, 3, 6),
+		append(append([]byte{}, header...), testH264Slice(true, true, H264_SLICE_I, 0, 0)...),
+		testH264Slice(false, true, H264_SLICE_P, 1, 4),
+		testH264Slice(false, false, H264_SLICE_B, 2, 2),
+	}
+}
+
+func TestSliceHeader_DecodeFull(t *testing.T) {
+	sps := &SPS{}
+	sps.Decode(NewBitStream(testH264SPS(1)[5:]))
+	pps := &PPS{}
+	pps.Decode(NewBitStream(testH264PPS()[5:]))
+	tests := []struct {
+		name string
+		nalu []byte
+		want SliceHeader
+	}{
+		{name: "idr", nalu: testH264Slice(true, true, H264_SLICE_I, 0, 0), want: SliceHeader{Slice_type: 7, Nal_ref_idc: 3, IdrPicFlag: true, Disable_deblocking_filter_idc: 1}},
+		{name: "p", nalu: testH264Slice(false, true, H264_SLICE_P, 1, 4), want: SliceHeader{Slice_type: 5, Frame_num: 1, Pic_order_cnt_lsb: 4, Nal_ref_idc: 2, Disable_deblocking_filter_idc: 1}},
+		{name: "b", nalu: testH264Slice(false, false, H264_SLICE_B, 2, 2), want: SliceHeader{Slice_type: 6, Frame_num: 2, Pic_order_cnt_lsb: 2, Direct_spatial_mv_pred_flag: 1, Disable_deblocking_filter_idc: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bs := NewBitStream(tt.nalu[4:])
+			var hdr H264NaluHdr
+			hdr.Decode(bs)
+			sh := SliceHeader{}
+			if err := sh.DecodeFull(bs, &hdr, sps, pps); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sh, tt.want) {
+				t.Errorf("SliceHeader.DecodeFull() = %+v, want %+v", sh, tt.want)
+			}
+		})
+	}
+}
+
+func TestH264Reorder(t *testing.T) {
+	type timestamp struct {
+		pts uint64
+		dts uint64
+	}
+	tests := []struct {
+		name             string
+		numReorderFrames int
+		withPts          bool
+		input            []uint64
+		want             []timestamp
+	}{
+		{
+			name:             "dts with num_reorder_frames",
+			numReorderFrames: 1,
+			input:            []uint64{0, 40, 80, 120, 160, 200, 240, 280},
+			want:             []timestamp{{40, 0}, {120, 40}, {80, 80}, {200, 120}, {160, 160}, {240, 200}, {320, 240}, {280, 280}},
+		},
+		{
+			name:             "dts without vui",
+			numReorderFrames: -1,
+			input:            []uint64{0, 40, 80, 120, 160, 200, 240, 280},
+			want:             []timestamp{{80, 0}, {160, 40}, {120, 80}, {240, 120}, {200, 160}, {280, 200}, {360, 240}, {320, 280}},
+		},
+		{
+			name:             "pts",
+			numReorderFrames: 1,
+			withPts:          true,
+			input:            []uint64{80, 160, 120, 240, 200, 280, 360, 320},
+			want:             []timestamp{{80, 40}, {160, 80}, {120, 120}, {240, 160}, {200, 200}, {280, 240}, {360, 280}, {320, 320}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []timestamp
+			reorder := NewH264Reorder()
+			reorder.OnFrame = func(frame []byte, pts, dts uint64) {
+				got = append(got, timestamp{pts: pts, dts: dts})
+			}
+			for i, frame := range testH264IBPStream(tt.numReorderFrames) {
+				var err error
+				if tt.withPts {
+					err = reorder.WriteWithPts(frame, tt.input[i])
+				} else {
+					err = reorder.WriteWithDts(frame, tt.input[i])
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			reorder.Flush()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("H264Reorder got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestH265Reorder(t *testing.T) {
+	type timestamp struct {
+		pts uint64
+		dts uint64
+	}
+	tests := []struct {
+		name    string
+		withPts bool
+		input   []uint64
+		want    []timestamp
+	}{
+		{
+			name:  "dts",
+			input: []uint64{0, 40, 80, 120, 160},
+			want:  []timestamp{{80, 0}, {240, 40}, {160, 80}, {120, 120}, {200, 160}},
+		},
+		{
+			name:    "pts",
+			withPts: true,
+			input:   []uint64{80, 240, 160, 120, 200},
+			want:    []timestamp{{80, 0}, {240, 40}, {160, 80}, {120, 120}, {200, 160}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []timestamp
+			reorder := NewH265Reorder()
+			reorder.OnFrame = func(frame []byte, pts, dts uint64) {
+				got = append(got, timestamp{pts: pts, dts: dts})
+			}
+			for i, frame := range testH265IBPStream() {
+				var err error
+				if tt.withPts {
+					err = reorder.WriteWithPts(frame, tt.input[i])
+				} else {
+					err = reorder.WriteWithDts(frame, tt.input[i])
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			reorder.Flush()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("H265Reorder got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
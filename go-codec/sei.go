@@ -0,0 +1,325 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// H.264 D.1 / H.265 D.2 sei payloadType
+const (
+	SEI_BUFFERING_PERIOD                = 0
+	SEI_PIC_TIMING                      = 1
+	SEI_USER_DATA_REGISTERED_ITU_T_T35  = 4
+	SEI_USER_DATA_UNREGISTERED          = 5
+	SEI_RECOVERY_POINT                  = 6
+	SEI_DECODED_PICTURE_HASH            = 132
+	SEI_TIME_CODE                       = 136
+	SEI_MASTERING_DISPLAY_COLOUR_VOLUME = 137
+	SEI_CONTENT_LIGHT_LEVEL_INFO        = 144
+)
+
+var errSEITruncated = errors.New("sei message truncated")
+
+// Read的bs只包含当前payload的数据, size为payloadSize
+// Write不需要写入payloadType和payloadSize, 未按字节对齐时由SEI.Encode补齐
+type SEIReaderWriter interface {
+	Read(size uint16, bs *BitStream)
+	Write(bsw *BitStreamWriter)
+}
+
+// 未注册的payloadType, 保留原始数据
+type SEIRawPayload struct {
+	Data []byte
+}
+
+func (raw *SEIRawPayload) Read(size uint16, bs *BitStream) {
+	raw.Data = bs.GetBytes(int(size))
+}
+
+func (raw *SEIRawPayload) Write(bsw *BitStreamWriter) {
+	bsw.PutBytes(raw.Data)
+}
+
+type SEI struct {
+	PayloadType uint16
+	PayloadSize uint16
+	Sei_payload SEIReaderWriter
+}
+
+// 按照H.264解析一个sei_message, 依赖sps的payload(如pic_timing)以SEIRawPayload保存
+func (sei *SEI) Decode(bs *BitStream) {
+	sei.decode(bs, func(payloadType uint16) SEIReaderWriter {
+		return newH264SEIPayload(payloadType, nil)
+	})
+}
+
+func (sei *SEI) decode(bs *BitStream, create func(payloadType uint16) SEIReaderWriter) {
+	sei.PayloadType = 0
+	sei.PayloadSize = 0
+	for bs.NextBits(8) == 0xFF {
+		bs.SkipBits(8)
+		sei.PayloadType += 255
+	}
+	sei.PayloadType += uint16(bs.Uint8(8))
+	for bs.NextBits(8) == 0xFF {
+		bs.SkipBits(8)
+		sei.PayloadSize += 255
+	}
+	sei.PayloadSize += uint16(bs.Uint8(8))
+	if bs.RemainBytes() < int(sei.PayloadSize) {
+		panic(errSEITruncated)
+	}
+	payload := bs.GetBytes(int(sei.PayloadSize))
+	sei.Sei_payload = create(sei.PayloadType)
+	if sei.Sei_payload == nil {
+		sei.Sei_payload = new(SEIRawPayload)
+	}
+	sei.Sei_payload.Read(sei.PayloadSize, NewBitStream(payload))
+}
+
+// 写入一个sei_message, PayloadSize根据Sei_payload实际写入的长度计算
+func (sei *SEI) Encode(bsw *BitStreamWriter) []byte {
+	var payload []byte
+	if sei.Sei_payload != nil {
+		pbsw := NewBitStreamWriter(64)
+		sei.Sei_payload.Write(pbsw)
+		// payload_bit_equal_to_one + payload_bit_equal_to_zero
+		if pbsw.BitOffset() > 0 {
+			pbsw.PutUint8(1, 1)
+			if pbsw.BitOffset() > 0 {
+				pbsw.PutUint8(0, 8-pbsw.BitOffset())
+			}
+		}
+		payload = pbsw.Bits()
+		sei.PayloadSize = uint16(len(payload))
+	}
+	payloadType := sei.PayloadType
+	payloadSize := sei.PayloadSize
+	for payloadType >= 0xFF {
+		bsw.PutByte(0xFF)
+		payloadType -= 255
+	}
+	bsw.PutByte(uint8(payloadType))
+	for payloadSize >= 0xFF {
+		bsw.PutByte(0xFF)
+		payloadSize -= 255
+	}
+	bsw.PutByte(uint8(payloadSize))
+	bsw.PutBytes(payload)
+	return bsw.Bits()
+}
+
+// payloadType -> payload, sps为nil时无法解析依赖sps的payload, 此时应返回nil
+var h264SEIPayloads = map[uint16]func(sps *SPS) SEIReaderWriter{
+	SEI_PIC_TIMING: func(sps *SPS) SEIReaderWriter {
+		if sps == nil {
+			return nil
+		}
+		return NewH264PicTiming(sps)
+	},
+	SEI_USER_DATA_REGISTERED_ITU_T_T35:  func(*SPS) SEIReaderWriter { return new(UserDataRegisteredITUTT35) },
+	SEI_USER_DATA_UNREGISTERED:          func(*SPS) SEIReaderWriter { return new(UserDataUnregistered) },
+	SEI_RECOVERY_POINT:                  func(*SPS) SEIReaderWriter { return new(H264RecoveryPoint) },
+	SEI_MASTERING_DISPLAY_COLOUR_VOLUME: func(*SPS) SEIReaderWriter { return new(MasteringDisplayColourVolume) },
+	SEI_CONTENT_LIGHT_LEVEL_INFO:        func(*SPS) SEIReaderWriter { return new(ContentLightLevelInfo) },
+}
+
+var h265SEIPayloads = map[uint16]func(sps *H265RawSPS) SEIReaderWriter{
+	SEI_PIC_TIMING: func(sps *H265RawSPS) SEIReaderWriter {
+		if sps == nil {
+			return nil
+		}
+		return NewH265PicTiming(sps)
+	},
+	SEI_USER_DATA_REGISTERED_ITU_T_T35:  func(*H265RawSPS) SEIReaderWriter { return new(UserDataRegisteredITUTT35) },
+	SEI_USER_DATA_UNREGISTERED:          func(*H265RawSPS) SEIReaderWriter { return new(UserDataUnregistered) },
+	SEI_RECOVERY_POINT:                  func(*H265RawSPS) SEIReaderWriter { return new(H265RecoveryPoint) },
+	SEI_TIME_CODE:                       func(*H265RawSPS) SEIReaderWriter { return new(H265TimeCode) },
+	SEI_MASTERING_DISPLAY_COLOUR_VOLUME: func(*H265RawSPS) SEIReaderWriter { return new(MasteringDisplayColourVolume) },
+	SEI_CONTENT_LIGHT_LEVEL_INFO:        func(*H265RawSPS) SEIReaderWriter { return new(ContentLightLevelInfo) },
+}
+
+// 注册或替换H.264 sei payload的解析方式
+func RegisterH264SEIPayload(payloadType uint16, create func(sps *SPS) SEIReaderWriter) {
+	h264SEIPayloads[payloadType] = create
+}
+
+// 注册或替换H.265 sei payload的解析方式
+func RegisterH265SEIPayload(payloadType uint16, create func(sps *H265RawSPS) SEIReaderWriter) {
+	h265SEIPayloads[payloadType] = create
+}
+
+func newH264SEIPayload(payloadType uint16, sps *SPS) SEIReaderWriter {
+	if create, found := h264SEIPayloads[payloadType]; found {
+		return create(sps)
+	}
+	return nil
+}
+
+func newH265SEIPayload(payloadType uint16, sps *H265RawSPS) SEIReaderWriter {
+	if create, found := h265SEIPayloads[payloadType]; found {
+		return create(sps)
+	}
+	return nil
+}
+
+func decodeSEIRbsp(bs *BitStream, create func(payloadType uint16) SEIReaderWriter) (seis []SEI, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("decode sei failed: %v", e)
+		}
+	}()
+	for bs.MoreRbspData() {
+		sei := SEI{}
+		sei.decode(bs, create)
+		seis = append(seis, sei)
+	}
+	return
+}
+
+func encodeSEIRbsp(bsw *BitStreamWriter, seis []SEI) []byte {
+	for i := range seis {
+		seis[i].Encode(bsw)
+	}
+	bsw.PutRbspTrailingBits()
+	return CovertSodbToRbsp(bsw.Bits())
+}
+
+// 解析H.264 sei nalu(不带startcode), sps可以为nil
+func DecodeH264SEINalu(nalu []byte, sps *SPS) ([]SEI, error) {
+	if len(nalu) < 2 || H264NaluTypeWithoutStartCode(nalu) != H264_NAL_SEI {
+		return nil, errors.New("not h264 sei nalu")
+	}
+	bs := NewBitStream(CovertRbspToSodb(nalu[1:]))
+	return decodeSEIRbsp(bs, func(payloadType uint16) SEIReaderWriter {
+		return newH264SEIPayload(payloadType, sps)
+	})
+}
+
+// 生成H.264 sei nalu(不带startcode)
+func EncodeH264SEINalu(seis []SEI) []byte {
+	rbsp := encodeSEIRbsp(NewBitStreamWriter(256), seis)
+	return append([]byte{byte(H264_NAL_SEI)}, rbsp...)
+}
+
+// 解析H.265 prefix/suffix sei nalu(不带startcode), sps可以为nil
+func DecodeH265SEINalu(nalu []byte, sps *H265RawSPS) ([]SEI, error) {
+	if len(nalu) < 3 {
+		return nil, errors.New("not h265 sei nalu")
+	}
+	naluType := H265NaluTypeWithoutStartCode(nalu)
+	if naluType != H265_NAL_SEI && naluType != H265_NAL_SEI_SUFFIX {
+		return nil, errors.New("not h265 sei nalu")
+	}
+	bs := NewBitStream(CovertRbspToSodb(nalu[2:]))
+	return decodeSEIRbsp(bs, func(payloadType uint16) SEIReaderWriter {
+		return newH265SEIPayload(payloadType, sps)
+	})
+}
+
+// 生成H.265 sei nalu(不带startcode), suffix为true时生成suffix sei
+func EncodeH265SEINalu(seis []SEI, suffix bool) []byte {
+	hdr := H265NaluHdr{Nal_unit_type: uint8(H265_NAL_SEI), Nuh_temporal_id_plus1: 1}
+	if suffix {
+		hdr.Nal_unit_type = uint8(H265_NAL_SEI_SUFFIX)
+	}
+	bsw := NewBitStreamWriter(256)
+	hdr.Encode(bsw)
+	rbsp := encodeSEIRbsp(NewBitStreamWriter(256), seis)
+	return append(bsw.Bits(), rbsp...)
+}
+
+// 从Annex-B格式的access unit中提取所有sei, 如果access unit中带有sps, 优先使用access unit中的sps
+func ExtractH264SEI(frame []byte, sps *SPS) ([]SEI, error) {
+	var seis []SEI
+	var err error
+	SplitFrame(frame, func(nalu []byte) bool {
+		if len(nalu) == 0 {
+			return true
+		}
+		switch H264NaluTypeWithoutStartCode(nalu) {
+		case H264_NAL_SPS:
+			tmp := &SPS{}
+			if e := decodeH264ParameterSet(nalu, tmp.Decode); e == nil {
+				sps = tmp
+			}
+		case H264_NAL_SEI:
+			msgs, e := DecodeH264SEINalu(nalu, sps)
+			if e != nil {
+				err = e
+				return false
+			}
+			seis = append(seis, msgs...)
+		}
+		return true
+	})
+	return seis, err
+}
+
+// 在Annex-B格式的access unit的第一个VCL nalu之前插入sei nalu
+func InsertH264SEI(frame []byte, seis []SEI) []byte {
+	return insertSEINalu(frame, EncodeH264SEINalu(seis), func(nalu []byte) bool {
+		return IsH264VCLNaluType(H264NaluTypeWithoutStartCode(nalu))
+	})
+}
+
+// 从Annex-B格式的access unit中提取所有prefix和suffix sei
+func ExtractH265SEI(frame []byte, sps *H265RawSPS) ([]SEI, error) {
+	var seis []SEI
+	var err error
+	SplitFrame(frame, func(nalu []byte) bool {
+		if len(nalu) < 2 {
+			return true
+		}
+		switch H265NaluTypeWithoutStartCode(nalu) {
+		case H265_NAL_SPS:
+			tmp := &H265RawSPS{}
+			if e := decodeH265ParameterSet(nalu, tmp.Decode); e == nil {
+				sps = tmp
+			}
+		case H265_NAL_SEI, H265_NAL_SEI_SUFFIX:
+			msgs, e := DecodeH265SEINalu(nalu, sps)
+			if e != nil {
+				err = e
+				return false
+			}
+			seis = append(seis, msgs...)
+		}
+		return true
+	})
+	return seis, err
+}
+
+// 在Annex-B格式的access unit中插入sei nalu, prefix sei插入到第一个VCL nalu之前, suffix sei追加到最后一个VCL nalu之后
+func InsertH265SEI(frame []byte, seis []SEI, suffix bool) []byte {
+	seiNalu := EncodeH265SEINalu(seis, suffix)
+	if suffix {
+		out := make([]byte, 0, len(frame)+len(seiNalu)+4)
+		out = append(out, frame...)
+		out = append(out, 0x00, 0x00, 0x00, 0x01)
+		return append(out, seiNalu...)
+	}
+	return insertSEINalu(frame, seiNalu, func(nalu []byte) bool {
+		return len(nalu) >= 2 && IsH265VCLNaluType(H265NaluTypeWithoutStartCode(nalu))
+	})
+}
+
+func insertSEINalu(frame []byte, seiNalu []byte, isVcl func(nalu []byte) bool) []byte {
+	out := make([]byte, 0, len(frame)+len(seiNalu)+4)
+	inserted := false
+	SplitFrameWithStartCode(frame, func(nalu []byte) bool {
+		start, sc := FindStartCode(nalu, 0)
+		if !inserted && isVcl(nalu[start+int(sc):]) {
+			out = append(out, 0x00, 0x00, 0x00, 0x01)
+			out = append(out, seiNalu...)
+			inserted = true
+		}
+		out = append(out, nalu...)
+		return true
+	})
+	if !inserted {
+		out = append(out, 0x00, 0x00, 0x00, 0x01)
+		out = append(out, seiNalu...)
+	}
+	return out
+}
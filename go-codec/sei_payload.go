@@ -0,0 +1,545 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type UserDataUnregistered struct {
+	UUID     []byte
+	UserData []byte
+}
+
+func (udu *UserDataUnregistered) Read(size uint16, bs *BitStream) {
+	udu.UUID = bs.GetBytes(16)
+	udu.UserData = bs.GetBytes(int(size - 16))
+}
+
+func (udu *UserDataUnregistered) Write(bsw *BitStreamWriter) {
+	bsw.PutBytes(udu.UUID)
+	bsw.PutBytes(udu.UserData)
+}
+
+// D.1.6 user_data_registered_itu_t_t35
+type UserDataRegisteredITUTT35 struct {
+	Itu_t_t35_country_code                uint8
+	Itu_t_t35_country_code_extension_byte uint8
+	Itu_t_t35_payload_byte                []byte
+}
+
+func (t35 *UserDataRegisteredITUTT35) Read(size uint16, bs *BitStream) {
+	n := int(size) - 1
+	t35.Itu_t_t35_country_code = bs.Uint8(8)
+	if t35.Itu_t_t35_country_code == 0xFF {
+		t35.Itu_t_t35_country_code_extension_byte = bs.Uint8(8)
+		n--
+	}
+	t35.Itu_t_t35_payload_byte = bs.GetBytes(n)
+}
+
+func (t35 *UserDataRegisteredITUTT35) Write(bsw *BitStreamWriter) {
+	bsw.PutByte(t35.Itu_t_t35_country_code)
+	if t35.Itu_t_t35_country_code == 0xFF {
+		bsw.PutByte(t35.Itu_t_t35_country_code_extension_byte)
+	}
+	bsw.PutBytes(t35.Itu_t_t35_payload_byte)
+}
+
+// ATSC A/53 Part 4, CEA-608/708字幕通过T.35 user data携带
+const (
+	ATSC_T35_COUNTRY_CODE      = 0xB5
+	ATSC_T35_PROVIDER_CODE     = 0x0031
+	ATSC_USER_IDENTIFIER       = 0x47413934 // "GA94"
+	ATSC_USER_DATA_TYPE_CCDATA = 0x03
+)
+
+// cc_type 0/1为CEA-608 field1/field2, 2/3为CEA-708 DTVCC数据
+type CEA708CCData struct {
+	Cc_valid  uint8
+	Cc_type   uint8
+	Cc_data_1 uint8
+	Cc_data_2 uint8
+}
+
+// 解析A/53 cc_data(), 不是字幕数据时返回false
+func (t35 *UserDataRegisteredITUTT35) GetCCData() (ccs []CEA708CCData, ok bool) {
+	data := t35.Itu_t_t35_payload_byte
+	if t35.Itu_t_t35_country_code != ATSC_T35_COUNTRY_CODE || len(data) < 9 {
+		return nil, false
+	}
+	if binary.BigEndian.Uint16(data) != ATSC_T35_PROVIDER_CODE ||
+		binary.BigEndian.Uint32(data[2:]) != ATSC_USER_IDENTIFIER ||
+		data[6] != ATSC_USER_DATA_TYPE_CCDATA {
+		return nil, false
+	}
+	// process_em_data_flag process_cc_data_flag additional_data_flag cc_count(5)
+	ccCount := int(data[7] & 0x1F)
+	data = data[9:]
+	if len(data) < ccCount*3 {
+		return nil, false
+	}
+	ccs = make([]CEA708CCData, ccCount)
+	for i := 0; i < ccCount; i++ {
+		ccs[i].Cc_valid = (data[i*3] >> 2) & 0x01
+		ccs[i].Cc_type = data[i*3] & 0x03
+		ccs[i].Cc_data_1 = data[i*3+1]
+		ccs[i].Cc_data_2 = data[i*3+2]
+	}
+	return ccs, true
+}
+
+// 用A/53 cc_data()生成T.35 user data, 最多31个cc
+func NewCCDataT35(ccs []CEA708CCData) *UserDataRegisteredITUTT35 {
+	if len(ccs) > 0x1F {
+		ccs = ccs[:0x1F]
+	}
+	payload := make([]byte, 9, 10+len(ccs)*3)
+	binary.BigEndian.PutUint16(payload, ATSC_T35_PROVIDER_CODE)
+	binary.BigEndian.PutUint32(payload[2:], ATSC_USER_IDENTIFIER)
+	payload[6] = ATSC_USER_DATA_TYPE_CCDATA
+	payload[7] = 0x40 | uint8(len(ccs))
+	payload[8] = 0xFF
+	for _, cc := range ccs {
+		payload = append(payload, 0xF8|(cc.Cc_valid&0x01)<<2|cc.Cc_type&0x03, cc.Cc_data_1, cc.Cc_data_2)
+	}
+	payload = append(payload, 0xFF)
+	return &UserDataRegisteredITUTT35{
+		Itu_t_t35_country_code: ATSC_T35_COUNTRY_CODE,
+		Itu_t_t35_payload_byte: payload,
+	}
+}
+
+// H.264 D.1.8 recovery_point
+type H264RecoveryPoint struct {
+	Recovery_frame_cnt       uint64
+	Exact_match_flag         uint8
+	Broken_link_flag         uint8
+	Changing_slice_group_idc uint8
+}
+
+func (rp *H264RecoveryPoint) Read(size uint16, bs *BitStream) {
+	rp.Recovery_frame_cnt = bs.ReadUE()
+	rp.Exact_match_flag = bs.GetBit()
+	rp.Broken_link_flag = bs.GetBit()
+	rp.Changing_slice_group_idc = bs.Uint8(2)
+}
+
+func (rp *H264RecoveryPoint) Write(bsw *BitStreamWriter) {
+	bsw.PutUE(rp.Recovery_frame_cnt)
+	bsw.PutUint8(rp.Exact_match_flag, 1)
+	bsw.PutUint8(rp.Broken_link_flag, 1)
+	bsw.PutUint8(rp.Changing_slice_group_idc, 2)
+}
+
+// H.265 D.2.8 recovery_point
+type H265RecoveryPoint struct {
+	Recovery_poc_cnt int64
+	Exact_match_flag uint8
+	Broken_link_flag uint8
+}
+
+func (rp *H265RecoveryPoint) Read(size uint16, bs *BitStream) {
+	rp.Recovery_poc_cnt = bs.ReadSE()
+	rp.Exact_match_flag = bs.GetBit()
+	rp.Broken_link_flag = bs.GetBit()
+}
+
+func (rp *H265RecoveryPoint) Write(bsw *BitStreamWriter) {
+	bsw.PutSE(rp.Recovery_poc_cnt)
+	bsw.PutUint8(rp.Exact_match_flag, 1)
+	bsw.PutUint8(rp.Broken_link_flag, 1)
+}
+
+// D.2.28 mastering_display_colour_volume, 色度坐标单位0.00002, 亮度单位0.0001 cd/m2
+type MasteringDisplayColourVolume struct {
+	Display_primaries_x             [3]uint16
+	Display_primaries_y             [3]uint16
+	White_point_x                   uint16
+	White_point_y                   uint16
+	Max_display_mastering_luminance uint32
+	Min_display_mastering_luminance uint32
+}
+
+func (mdcv *MasteringDisplayColourVolume) Read(size uint16, bs *BitStream) {
+	for c := 0; c < 3; c++ {
+		mdcv.Display_primaries_x[c] = bs.Uint16(16)
+		mdcv.Display_primaries_y[c] = bs.Uint16(16)
+	}
+	mdcv.White_point_x = bs.Uint16(16)
+	mdcv.White_point_y = bs.Uint16(16)
+	mdcv.Max_display_mastering_luminance = bs.Uint32(32)
+	mdcv.Min_display_mastering_luminance = bs.Uint32(32)
+}
+
+func (mdcv *MasteringDisplayColourVolume) Write(bsw *BitStreamWriter) {
+	for c := 0; c < 3; c++ {
+		bsw.PutUint16(mdcv.Display_primaries_x[c], 16)
+		bsw.PutUint16(mdcv.Display_primaries_y[c], 16)
+	}
+	bsw.PutUint16(mdcv.White_point_x, 16)
+	bsw.PutUint16(mdcv.White_point_y, 16)
+	bsw.PutUint32(mdcv.Max_display_mastering_luminance, 32)
+	bsw.PutUint32(mdcv.Min_display_mastering_luminance, 32)
+}
+
+// D.2.35 content_light_level_info, 单位cd/m2
+type ContentLightLevelInfo struct {
+	Max_content_light_level     uint16
+	Max_pic_average_light_level uint16
+}
+
+func (clli *ContentLightLevelInfo) Read(size uint16, bs *BitStream) {
+	clli.Max_content_light_level = bs.Uint16(16)
+	clli.Max_pic_average_light_level = bs.Uint16(16)
+}
+
+func (clli *ContentLightLevelInfo) Write(bsw *BitStreamWriter) {
+	bsw.PutUint16(clli.Max_content_light_level, 16)
+	bsw.PutUint16(clli.Max_pic_average_light_level, 16)
+}
+
+// H.264 pic_timing和H.265 time_code中的clock timestamp
+// Ct_type只在H.264中存在, Time_offset_length只在H.265中存在(H.264取自hrd)
+type SEIClockTimestamp struct {
+	Clock_timestamp_flag  uint8
+	Ct_type               uint8
+	Nuit_field_based_flag uint8
+	Counting_type         uint8
+	Full_timestamp_flag   uint8
+	Discontinuity_flag    uint8
+	Cnt_dropped_flag      uint8
+	N_frames              uint16
+	Seconds_flag          uint8
+	Seconds_value         uint8
+	Minutes_flag          uint8
+	Minutes_value         uint8
+	Hours_flag            uint8
+	Hours_value           uint8
+	Time_offset_length    uint8
+	Time_offset_value     int32
+}
+
+// HH:MM:SS:FF, drop frame时使用HH:MM:SS;FF
+func (ct *SEIClockTimestamp) String() string {
+	sep := ":"
+	if ct.Cnt_dropped_flag == 1 {
+		sep = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", ct.Hours_value, ct.Minutes_value, ct.Seconds_value, sep, ct.N_frames)
+}
+
+// h265为false时timeOffsetLength取自hrd的time_offset_length
+func (ct *SEIClockTimestamp) decode(bs *BitStream, h265 bool, timeOffsetLength int) {
+	ct.Clock_timestamp_flag = bs.GetBit()
+	if ct.Clock_timestamp_flag == 0 {
+		return
+	}
+	if !h265 {
+		ct.Ct_type = bs.Uint8(2)
+	}
+	ct.Nuit_field_based_flag = bs.GetBit()
+	ct.Counting_type = bs.Uint8(5)
+	ct.Full_timestamp_flag = bs.GetBit()
+	ct.Discontinuity_flag = bs.GetBit()
+	ct.Cnt_dropped_flag = bs.GetBit()
+	if h265 {
+		ct.N_frames = bs.Uint16(9)
+	} else {
+		ct.N_frames = bs.Uint16(8)
+	}
+	if ct.Full_timestamp_flag == 1 {
+		ct.Seconds_value = bs.Uint8(6)
+		ct.Minutes_value = bs.Uint8(6)
+		ct.Hours_value = bs.Uint8(5)
+	} else {
+		ct.Seconds_flag = bs.GetBit()
+		if ct.Seconds_flag == 1 {
+			ct.Seconds_value = bs.Uint8(6)
+			ct.Minutes_flag = bs.GetBit()
+			if ct.Minutes_flag == 1 {
+				ct.Minutes_value = bs.Uint8(6)
+				ct.Hours_flag = bs.GetBit()
+				if ct.Hours_flag == 1 {
+					ct.Hours_value = bs.Uint8(5)
+				}
+			}
+		}
+	}
+	if h265 {
+		ct.Time_offset_length = bs.Uint8(5)
+		timeOffsetLength = int(ct.Time_offset_length)
+	}
+	if timeOffsetLength > 0 {
+		v := bs.GetBits(timeOffsetLength)
+		if v&(1<<uint(timeOffsetLength-1)) != 0 {
+			ct.Time_offset_value = int32(int64(v) - int64(1)<<uint(timeOffsetLength))
+		} else {
+			ct.Time_offset_value = int32(v)
+		}
+	}
+}
+
+func (ct *SEIClockTimestamp) encode(bsw *BitStreamWriter, h265 bool, timeOffsetLength int) {
+	bsw.PutUint8(ct.Clock_timestamp_flag, 1)
+	if ct.Clock_timestamp_flag == 0 {
+		return
+	}
+	if !h265 {
+		bsw.PutUint8(ct.Ct_type, 2)
+	}
+	bsw.PutUint8(ct.Nuit_field_based_flag, 1)
+	bsw.PutUint8(ct.Counting_type, 5)
+	bsw.PutUint8(ct.Full_timestamp_flag, 1)
+	bsw.PutUint8(ct.Discontinuity_flag, 1)
+	bsw.PutUint8(ct.Cnt_dropped_flag, 1)
+	if h265 {
+		bsw.PutUint16(ct.N_frames, 9)
+	} else {
+		bsw.PutUint16(ct.N_frames, 8)
+	}
+	if ct.Full_timestamp_flag == 1 {
+		bsw.PutUint8(ct.Seconds_value, 6)
+		bsw.PutUint8(ct.Minutes_value, 6)
+		bsw.PutUint8(ct.Hours_value, 5)
+	} else {
+		bsw.PutUint8(ct.Seconds_flag, 1)
+		if ct.Seconds_flag == 1 {
+			bsw.PutUint8(ct.Seconds_value, 6)
+			bsw.PutUint8(ct.Minutes_flag, 1)
+			if ct.Minutes_flag == 1 {
+				bsw.PutUint8(ct.Minutes_value, 6)
+				bsw.PutUint8(ct.Hours_flag, 1)
+				if ct.Hours_flag == 1 {
+					bsw.PutUint8(ct.Hours_value, 5)
+				}
+			}
+		}
+	}
+	if h265 {
+		bsw.PutUint8(ct.Time_offset_length, 5)
+		timeOffsetLength = int(ct.Time_offset_length)
+	}
+	if timeOffsetLength > 0 {
+		bsw.PutUint64(uint64(int64(ct.Time_offset_value))&(1<<uint(timeOffsetLength)-1), timeOffsetLength)
+	}
+}
+
+// Table D-1 pic_struct对应的NumClockTS
+func H264NumClockTS(picStruct uint8) int {
+	switch picStruct {
+	case 0, 1, 2:
+		return 1
+	case 3, 4, 7:
+		return 2
+	case 5, 6, 8:
+		return 3
+	}
+	return 0
+}
+
+// H.264 D.1.3 pic_timing, 语法依赖sps中的vui和hrd, 需要通过NewH264PicTiming创建
+type H264PicTiming struct {
+	Cpb_removal_delay uint32
+	Dpb_output_delay  uint32
+	Pic_struct        uint8
+	Clock_timestamp   []SEIClockTimestamp
+
+	cpbDpbDelaysPresent   bool
+	cpbRemovalDelayLength int
+	dpbOutputDelayLength  int
+	picStructPresent      bool
+	timeOffsetLength      int
+}
+
+func NewH264PicTiming(sps *SPS) *H264PicTiming {
+	pt := &H264PicTiming{timeOffsetLength: 24}
+	if sps.Vui_parameters_present_flag == 0 {
+		return pt
+	}
+	vui := &sps.VuiParameters
+	var hrd *H264HrdParameters
+	if vui.NalHrdParametersPresentFlag == 1 {
+		hrd = &vui.NalHrdParameters
+	} else if vui.VclHrdParametersPresentFlag == 1 {
+		hrd = &vui.VclHrdParameters
+	}
+	if hrd != nil {
+		pt.cpbDpbDelaysPresent = true
+		pt.cpbRemovalDelayLength = int(hrd.CpbRemovalDelayLengthMinus1) + 1
+		pt.dpbOutputDelayLength = int(hrd.DpbOutputDelayLengthMinus1) + 1
+		pt.timeOffsetLength = int(hrd.TimeOffsetLength)
+	}
+	pt.picStructPresent = vui.PicStructPresentFlag == 1
+	return pt
+}
+
+func (pt *H264PicTiming) Read(size uint16, bs *BitStream) {
+	if pt.cpbDpbDelaysPresent {
+		pt.Cpb_removal_delay = uint32(bs.GetBits(pt.cpbRemovalDelayLength))
+		pt.Dpb_output_delay = uint32(bs.GetBits(pt.dpbOutputDelayLength))
+	}
+	if pt.picStructPresent {
+		pt.Pic_struct = bs.Uint8(4)
+		pt.Clock_timestamp = make([]SEIClockTimestamp, H264NumClockTS(pt.Pic_struct))
+		for i := range pt.Clock_timestamp {
+			pt.Clock_timestamp[i].decode(bs, false, pt.timeOffsetLength)
+		}
+	}
+}
+
+func (pt *H264PicTiming) Write(bsw *BitStreamWriter) {
+	if pt.cpbDpbDelaysPresent {
+		bsw.PutUint32(pt.Cpb_removal_delay, pt.cpbRemovalDelayLength)
+		bsw.PutUint32(pt.Dpb_output_delay, pt.dpbOutputDelayLength)
+	}
+	if pt.picStructPresent {
+		bsw.PutUint8(pt.Pic_struct, 4)
+		for i := 0; i < H264NumClockTS(pt.Pic_struct); i++ {
+			if i < len(pt.Clock_timestamp) {
+				pt.Clock_timestamp[i].encode(bsw, false, pt.timeOffsetLength)
+			} else {
+				bsw.PutUint8(0, 1)
+			}
+		}
+	}
+}
+
+// H.265 D.2.3 pic_timing, 语法依赖sps中的vui和hrd, 需要通过NewH265PicTiming创建
+type H265PicTiming struct {
+	Pic_struct                                   uint8
+	Source_scan_type                             uint8
+	Duplicate_flag                               uint8
+	Au_cpb_removal_delay_minus1                  uint32
+	Pic_dpb_output_delay                         uint32
+	Pic_dpb_output_du_delay                      uint32
+	Num_decoding_units_minus1                    uint64
+	Du_common_cpb_removal_delay_flag             uint8
+	Du_common_cpb_removal_delay_increment_minus1 uint32
+	Num_nalus_in_du_minus1                       []uint64
+	Du_cpb_removal_delay_increment_minus1        []uint32
+
+	frameFieldInfoPresent            bool
+	cpbDpbDelaysPresent              bool
+	subPicHrdParamsPresent           bool
+	subPicCpbParamsInPicTimingSei    bool
+	auCpbRemovalDelayLength          int
+	dpbOutputDelayLength             int
+	dpbOutputDelayDuLength           int
+	duCpbRemovalDelayIncrementLength int
+}
+
+func NewH265PicTiming(sps *H265RawSPS) *H265PicTiming {
+	pt := &H265PicTiming{}
+	if sps.Vui_parameters_present_flag == 0 {
+		// E.3.1 vui不存在时, general_progressive_source_flag和general_interlaced_source_flag都为1则推断为1
+		pt.frameFieldInfoPresent = sps.Ptl.General_constraint_indicator_flag>>46 == 0x03
+		return pt
+	}
+	pt.frameFieldInfoPresent = sps.Vui.Frame_field_info_present_flag == 1
+	hrd := &sps.Vui.Hrd_parameters
+	if sps.Vui.Vui_hrd_parameters_present_flag == 1 &&
+		(hrd.Nal_hrd_parameters_present_flag == 1 || hrd.Vcl_hrd_parameters_present_flag == 1) {
+		pt.cpbDpbDelaysPresent = true
+		pt.subPicHrdParamsPresent = hrd.Sub_pic_hrd_params_present_flag == 1
+		pt.subPicCpbParamsInPicTimingSei = hrd.Sub_pic_cpb_params_in_pic_timing_sei_flag == 1
+		pt.auCpbRemovalDelayLength = int(hrd.Au_cpb_removal_delay_length_minus1) + 1
+		pt.dpbOutputDelayLength = int(hrd.Dpb_output_delay_length_minus1) + 1
+		pt.dpbOutputDelayDuLength = int(hrd.Dpb_output_delay_du_length_minus1) + 1
+		pt.duCpbRemovalDelayIncrementLength = int(hrd.Du_cpb_removal_delay_increment_length_minus1) + 1
+	}
+	return pt
+}
+
+func (pt *H265PicTiming) Read(size uint16, bs *BitStream) {
+	if pt.frameFieldInfoPresent {
+		pt.Pic_struct = bs.Uint8(4)
+		pt.Source_scan_type = bs.Uint8(2)
+		pt.Duplicate_flag = bs.GetBit()
+	}
+	if !pt.cpbDpbDelaysPresent {
+		return
+	}
+	pt.Au_cpb_removal_delay_minus1 = uint32(bs.GetBits(pt.auCpbRemovalDelayLength))
+	pt.Pic_dpb_output_delay = uint32(bs.GetBits(pt.dpbOutputDelayLength))
+	if pt.subPicHrdParamsPresent {
+		pt.Pic_dpb_output_du_delay = uint32(bs.GetBits(pt.dpbOutputDelayDuLength))
+	}
+	if !pt.subPicHrdParamsPresent || !pt.subPicCpbParamsInPicTimingSei {
+		return
+	}
+	pt.Num_decoding_units_minus1 = bs.ReadUE()
+	pt.Du_common_cpb_removal_delay_flag = bs.GetBit()
+	if pt.Du_common_cpb_removal_delay_flag == 1 {
+		pt.Du_common_cpb_removal_delay_increment_minus1 = uint32(bs.GetBits(pt.duCpbRemovalDelayIncrementLength))
+	}
+	// 每个decoding unit至少包含一个nalu, 防止异常码流申请过大的内存
+	if pt.Num_decoding_units_minus1 >= uint64(bs.RemainBits()) {
+		panic(errSEITruncated)
+	}
+	pt.Num_nalus_in_du_minus1 = make([]uint64, pt.Num_decoding_units_minus1+1)
+	pt.Du_cpb_removal_delay_increment_minus1 = make([]uint32, pt.Num_decoding_units_minus1+1)
+	for i := uint64(0); i <= pt.Num_decoding_units_minus1; i++ {
+		pt.Num_nalus_in_du_minus1[i] = bs.ReadUE()
+		if pt.Du_common_cpb_removal_delay_flag == 0 && i < pt.Num_decoding_units_minus1 {
+			pt.Du_cpb_removal_delay_increment_minus1[i] = uint32(bs.GetBits(pt.duCpbRemovalDelayIncrementLength))
+		}
+	}
+}
+
+func (pt *H265PicTiming) Write(bsw *BitStreamWriter) {
+	if pt.frameFieldInfoPresent {
+		bsw.PutUint8(pt.Pic_struct, 4)
+		bsw.PutUint8(pt.Source_scan_type, 2)
+		bsw.PutUint8(pt.Duplicate_flag, 1)
+	}
+	if !pt.cpbDpbDelaysPresent {
+		return
+	}
+	bsw.PutUint32(pt.Au_cpb_removal_delay_minus1, pt.auCpbRemovalDelayLength)
+	bsw.PutUint32(pt.Pic_dpb_output_delay, pt.dpbOutputDelayLength)
+	if pt.subPicHrdParamsPresent {
+		bsw.PutUint32(pt.Pic_dpb_output_du_delay, pt.dpbOutputDelayDuLength)
+	}
+	if !pt.subPicHrdParamsPresent || !pt.subPicCpbParamsInPicTimingSei {
+		return
+	}
+	bsw.PutUE(pt.Num_decoding_units_minus1)
+	bsw.PutUint8(pt.Du_common_cpb_removal_delay_flag, 1)
+	if pt.Du_common_cpb_removal_delay_flag == 1 {
+		bsw.PutUint32(pt.Du_common_cpb_removal_delay_increment_minus1, pt.duCpbRemovalDelayIncrementLength)
+	}
+	for i := uint64(0); i <= pt.Num_decoding_units_minus1; i++ {
+		var nalus uint64
+		if i < uint64(len(pt.Num_nalus_in_du_minus1)) {
+			nalus = pt.Num_nalus_in_du_minus1[i]
+		}
+		bsw.PutUE(nalus)
+		if pt.Du_common_cpb_removal_delay_flag == 0 && i < pt.Num_decoding_units_minus1 {
+			var increment uint32
+			if i < uint64(len(pt.Du_cpb_removal_delay_increment_minus1)) {
+				increment = pt.Du_cpb_removal_delay_increment_minus1[i]
+			}
+			bsw.PutUint32(increment, pt.duCpbRemovalDelayIncrementLength)
+		}
+	}
+}
+
+// H.265 D.2.27 time_code, 最多3个clock timestamp
+type H265TimeCode struct {
+	Num_clock_ts    uint8
+	Clock_timestamp [3]SEIClockTimestamp
+}
+
+func (tc *H265TimeCode) Read(size uint16, bs *BitStream) {
+	tc.Num_clock_ts = bs.Uint8(2)
+	for i := 0; i < int(tc.Num_clock_ts); i++ {
+		tc.Clock_timestamp[i].decode(bs, true, 0)
+	}
+}
+
+func (tc *H265TimeCode) Write(bsw *BitStreamWriter) {
+	bsw.PutUint8(tc.Num_clock_ts, 2)
+	for i := 0; i < int(tc.Num_clock_ts); i++ {
+		tc.Clock_timestamp[i].encode(bsw, true, 0)
+	}
+}
@@ -0,0 +1,222 @@
+package codec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSEI_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		nalu    []byte
+		want    []SEI
+		wantErr bool
+	}{
+		{name: "recovery point", nalu: []byte{0x06, 0x06, 0x01, 0xC4, 0x80}, want: []SEI{
+			{PayloadType: SEI_RECOVERY_POINT, PayloadSize: 1, Sei_payload: &H264RecoveryPoint{Exact_match_flag: 1}},
+		}},
+		{name: "unknown payload", nalu: []byte{0x06, 0xFF, 0x02, 0x02, 0xAA, 0xBB, 0x80}, want: []SEI{
+			{PayloadType: 257, PayloadSize: 2, Sei_payload: &SEIRawPayload{Data: []byte{0xAA, 0xBB}}},
+		}},
+		{name: "pic timing without sps", nalu: []byte{0x06, 0x01, 0x01, 0x10, 0x80}, want: []SEI{
+			{PayloadType: SEI_PIC_TIMING, PayloadSize: 1, Sei_payload: &SEIRawPayload{Data: []byte{0x10}}},
+		}},
+		{name: "truncated", nalu: []byte{0x06, 0x05, 0x20, 0x00, 0x80}, wantErr: true},
+		{name: "not sei", nalu: []byte{0x65, 0x88}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeH264SEINalu(tt.nalu, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeH264SEINalu() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeH264SEINalu() = %+v, want %+v", got, tt.want)
+			}
+			if enc := EncodeH264SEINalu(got); !bytes.Equal(enc, tt.nalu) {
+				t.Errorf("EncodeH264SEINalu() = %x, want %x", enc, tt.nalu)
+			}
+		})
+	}
+}
+
+func TestH264SEINalu_RoundTrip(t *testing.T) {
+	sps := &SPS{Vui_parameters_present_flag: 1}
+	sps.VuiParameters.PicStructPresentFlag = 1
+	sps.VuiParameters.NalHrdParametersPresentFlag = 1
+	sps.VuiParameters.NalHrdParameters = H264HrdParameters{
+		CpbRemovalDelayLengthMinus1: 23,
+		DpbOutputDelayLengthMinus1:  23,
+		TimeOffsetLength:            24,
+	}
+	picTiming := NewH264PicTiming(sps)
+	picTiming.Cpb_removal_delay = 2
+	picTiming.Dpb_output_delay = 4
+	picTiming.Pic_struct = 3
+	picTiming.Clock_timestamp = []SEIClockTimestamp{
+		{Clock_timestamp_flag: 1, Ct_type: 1, Counting_type: 4, Full_timestamp_flag: 1, Cnt_dropped_flag: 1,
+			N_frames: 29, Seconds_value: 59, Minutes_value: 1, Hours_value: 10, Time_offset_value: -3},
+		{Clock_timestamp_flag: 1, Seconds_flag: 1, Seconds_value: 12, Minutes_flag: 1, Minutes_value: 34},
+	}
+	seis := []SEI{
+		{PayloadType: SEI_PIC_TIMING, Sei_payload: picTiming},
+		{PayloadType: SEI_RECOVERY_POINT, Sei_payload: &H264RecoveryPoint{Recovery_frame_cnt: 7, Broken_link_flag: 1, Changing_slice_group_idc: 2}},
+		{PayloadType: SEI_USER_DATA_REGISTERED_ITU_T_T35, Sei_payload: NewCCDataT35([]CEA708CCData{
+			{Cc_valid: 1, Cc_type: 0, Cc_data_1: 0x94, Cc_data_2: 0x2C},
+			{Cc_valid: 0, Cc_type: 1, Cc_data_1: 0x80, Cc_data_2: 0x80},
+		})},
+		{PayloadType: SEI_MASTERING_DISPLAY_COLOUR_VOLUME, Sei_payload: &MasteringDisplayColourVolume{
+			Display_primaries_x:             [3]uint16{8500, 6550, 35400},
+			Display_primaries_y:             [3]uint16{39850, 2300, 14600},
+			White_point_x:                   15635,
+			White_point_y:                   16450,
+			Max_display_mastering_luminance: 10000000,
+			Min_display_mastering_luminance: 0,
+		}},
+		{PayloadType: SEI_CONTENT_LIGHT_LEVEL_INFO, Sei_payload: &ContentLightLevelInfo{Max_content_light_level: 1000, Max_pic_average_light_level: 400}},
+		{PayloadType: SEI_USER_DATA_UNREGISTERED, Sei_payload: &UserDataUnregistered{UUID: make([]byte, 16), UserData: []byte("gomedia")}},
+	}
+	nalu := EncodeH264SEINalu(seis)
+	if bytes.Contains(nalu, []byte{0x00, 0x00, 0x00}) {
+		t.Fatalf("missing emulation prevention: %x", nalu)
+	}
+	got, err := DecodeH264SEINalu(nalu, sps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, seis) {
+		t.Errorf("DecodeH264SEINalu() = %+v, want %+v", got, seis)
+	}
+	if got[0].Sei_payload.(*H264PicTiming).Clock_timestamp[0].String() != "10:01:59;29" {
+		t.Errorf("timecode = %s", got[0].Sei_payload.(*H264PicTiming).Clock_timestamp[0].String())
+	}
+}
+
+func TestH265SEINalu_RoundTrip(t *testing.T) {
+	sps := &H265RawSPS{Vui_parameters_present_flag: 1}
+	sps.Vui.Frame_field_info_present_flag = 1
+	sps.Vui.Vui_hrd_parameters_present_flag = 1
+	sps.Vui.Hrd_parameters = H265HrdParameters{
+		Nal_hrd_parameters_present_flag:              1,
+		Sub_pic_hrd_params_present_flag:              1,
+		Sub_pic_cpb_params_in_pic_timing_sei_flag:    1,
+		Du_cpb_removal_delay_increment_length_minus1: 7,
+		Dpb_output_delay_du_length_minus1:            9,
+		Au_cpb_removal_delay_length_minus1:           15,
+		Dpb_output_delay_length_minus1:               4,
+	}
+	picTiming := NewH265PicTiming(sps)
+	picTiming.Pic_struct = 1
+	picTiming.Source_scan_type = 1
+	picTiming.Au_cpb_removal_delay_minus1 = 1000
+	picTiming.Pic_dpb_output_delay = 3
+	picTiming.Pic_dpb_output_du_delay = 9
+	picTiming.Num_decoding_units_minus1 = 2
+	picTiming.Num_nalus_in_du_minus1 = []uint64{0, 1, 2}
+	picTiming.Du_cpb_removal_delay_increment_minus1 = []uint32{5, 6, 0}
+
+	timeCode := &H265TimeCode{Num_clock_ts: 2}
+	timeCode.Clock_timestamp[0] = SEIClockTimestamp{Clock_timestamp_flag: 1, Full_timestamp_flag: 1, N_frames: 300,
+		Seconds_value: 1, Minutes_value: 2, Hours_value: 3, Time_offset_length: 8, Time_offset_value: -128}
+
+	prefix := []SEI{
+		{PayloadType: SEI_PIC_TIMING, Sei_payload: picTiming},
+		{PayloadType: SEI_RECOVERY_POINT, Sei_payload: &H265RecoveryPoint{Recovery_poc_cnt: -4, Exact_match_flag: 1}},
+		{PayloadType: SEI_TIME_CODE, Sei_payload: timeCode},
+		{PayloadType: SEI_CONTENT_LIGHT_LEVEL_INFO, Sei_payload: &ContentLightLevelInfo{Max_content_light_level: 0}},
+	}
+	suffix := []SEI{
+		{PayloadType: SEI_DECODED_PICTURE_HASH, Sei_payload: &SEIRawPayload{Data: []byte{0x00, 0x11, 0x22}}},
+	}
+	for _, tt := range []struct {
+		name   string
+		seis   []SEI
+		suffix bool
+	}{{"prefix", prefix, false}, {"suffix", suffix, true}} {
+		t.Run(tt.name, func(t *testing.T) {
+			nalu := EncodeH265SEINalu(tt.seis, tt.suffix)
+			got, err := DecodeH265SEINalu(nalu, sps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.seis) {
+				t.Errorf("DecodeH265SEINalu() = %+v, want %+v", got, tt.seis)
+			}
+		})
+	}
+}
+
+func TestUserDataRegisteredITUTT35_GetCCData(t *testing.T) {
+	tests := []struct {
+		name   string
+		t35    []byte
+		want   []CEA708CCData
+		wantOk bool
+	}{
+		{name: "a53 cc", t35: []byte{0xB5, 0x00, 0x31, 0x47, 0x41, 0x39, 0x34, 0x03, 0x42, 0xFF, 0xFC, 0x94, 0x2C, 0xF9, 0x80, 0x80, 0xFF},
+			want: []CEA708CCData{{1, 0, 0x94, 0x2C}, {0, 1, 0x80, 0x80}}, wantOk: true},
+		{name: "afd", t35: []byte{0xB5, 0x00, 0x31, 0x44, 0x54, 0x47, 0x31, 0x41, 0xF8}},
+		{name: "other country", t35: []byte{0x26, 0x00, 0x04, 0x00, 0x05}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t35 := &UserDataRegisteredITUTT35{}
+			t35.Read(uint16(len(tt.t35)), NewBitStream(tt.t35))
+			got, ok := t35.GetCCData()
+			if ok != tt.wantOk || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("GetCCData() = %v %v, want %v %v", got, ok, tt.want, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			bsw := NewBitStreamWriter(64)
+			NewCCDataT35(got).Write(bsw)
+			if !bytes.Equal(bsw.Bits(), tt.t35) {
+				t.Errorf("NewCCDataT35() = %x, want %x", bsw.Bits(), tt.t35)
+			}
+		})
+	}
+}
+
+func TestInsertExtractSEI(t *testing.T) {
+	seis := []SEI{
+		{PayloadType: SEI_USER_DATA_UNREGISTERED, Sei_payload: &UserDataUnregistered{UUID: bytes.Repeat([]byte{0x01}, 16), UserData: []byte{0x02}}},
+	}
+	naluTypes := func(frame []byte, h265 bool) []int {
+		var types []int
+		SplitFrame(frame, func(nalu []byte) bool {
+			if h265 {
+				types = append(types, int(H265NaluTypeWithoutStartCode(nalu)))
+			} else {
+				types = append(types, int(H264NaluTypeWithoutStartCode(nalu)))
+			}
+			return true
+		})
+		return types
+	}
+
+	h264 := []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xF0, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84}
+	out := InsertH264SEI(h264, seis)
+	if want := []int{9, 6, 5, 5}; !reflect.DeepEqual(naluTypes(out, false), want) {
+		t.Errorf("InsertH264SEI() nalu types = %v, want %v", naluTypes(out, false), want)
+	}
+	got, err := ExtractH264SEI(out, nil)
+	if err != nil || !reflect.DeepEqual(got, seis) {
+		t.Errorf("ExtractH264SEI() = %+v %v, want %+v", got, err, seis)
+	}
+
+	h265 := []byte{0x00, 0x00, 0x00, 0x01, 0x46, 0x01, 0x50, 0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xAF, 0x08}
+	out = InsertH265SEI(h265, seis, false)
+	out = InsertH265SEI(out, seis, true)
+	if want := []int{35, 39, 19, 40}; !reflect.DeepEqual(naluTypes(out, true), want) {
+		t.Errorf("InsertH265SEI() nalu types = %v, want %v", naluTypes(out, true), want)
+	}
+	got, err = ExtractH265SEI(out, nil)
+	if err != nil || !reflect.DeepEqual(got, append(append([]SEI{}, seis...), seis...)) {
+		t.Errorf("ExtractH265SEI() = %+v %v", got, err)
+	}
+}
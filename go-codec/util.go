@@ -259,3 +259,44 @@ func CovertRbspToSodb(rbsp []byte) []byte {
     }
     return bsw.Bits()
 }
+
+// 去除防竞争字节之后的前sodbLen个字节, 在原始数据中占用的长度
+func rbspLength(rbsp []byte, sodbLen int) int {
+    zeros := 0
+    count := 0
+    for i, b := range rbsp {
+        if count == sodbLen {
+            return i
+        }
+        if zeros >= 2 && b == 0x03 {
+            zeros = 0
+            continue
+        }
+        count++
+        if b == 0x00 {
+            zeros++
+        } else {
+            zeros = 0
+        }
+    }
+    return len(rbsp)
+}
+
+// CovertRbspToSodb的逆过程, 插入防竞争字节0x03
+func CovertSodbToRbsp(sodb []byte) []byte {
+    rbsp := make([]byte, 0, len(sodb)+len(sodb)/64)
+    zeros := 0
+    for _, b := range sodb {
+        if zeros == 2 && b <= 0x03 {
+            rbsp = append(rbsp, 0x03)
+            zeros = 0
+        }
+        rbsp = append(rbsp, b)
+        if b == 0x00 {
+            zeros++
+        } else {
+            zeros = 0
+        }
+    }
+    return rbsp
+}
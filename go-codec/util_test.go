@@ -36,6 +36,29 @@ func TestCovertRbspToSodb(t *testing.T) {
 	}
 }
 
+func TestCovertSodbToRbsp(t *testing.T) {
+	tests := []struct {
+		name string
+		sodb []byte
+		want []byte
+	}{
+		{name: "vps", sodb: result[4:], want: nalu[4:]},
+		{name: "00 00 03", sodb: []byte{0x00, 0x00, 0x03, 0x00, 0x00, 0x04}, want: []byte{0x00, 0x00, 0x03, 0x03, 0x00, 0x00, 0x04}},
+		{name: "00 00 00 00", sodb: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x01}, want: []byte{0x01, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CovertSodbToRbsp(tt.sodb)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CovertSodbToRbsp() = %x, want %x", got, tt.want)
+			}
+			if back := CovertRbspToSodb(got); !reflect.DeepEqual(back, tt.sodb) {
+				t.Errorf("CovertRbspToSodb(CovertSodbToRbsp()) = %x, want %x", back, tt.sodb)
+			}
+		})
+	}
+}
+
 func TestFindStartCode(t *testing.T) {
 	type args struct {
 		nalu   []byte
@@ -80,3 +103,24 @@ func TestFindStartCode(t *testing.T) {
 		})
 	}
 }
+
+func Test_rbspLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		rbsp    []byte
+		sodbLen int
+		want    int
+	}{
+		{name: "no emulation", rbsp: []byte{0x01, 0x02, 0x03, 0x04}, sodbLen: 2, want: 2},
+		{name: "skip 03", rbsp: []byte{0x00, 0x00, 0x03, 0x01, 0x05}, sodbLen: 4, want: 5},
+		{name: "before 03", rbsp: []byte{0x01, 0x00, 0x00, 0x03, 0x00}, sodbLen: 3, want: 3},
+		{name: "too short", rbsp: []byte{0x01}, sodbLen: 3, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rbspLength(tt.rbsp, tt.sodbLen); got != tt.want {
+				t.Errorf("rbspLength() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
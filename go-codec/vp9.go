@@ -0,0 +1,507 @@
+package codec
+
+import (
+	"errors"
+)
+
+// VP9 Bitstream & Decoding Process Specification v0.6
+// https://storage.googleapis.com/downloads.webmproject.org/docs/vp9/vp9-bitstream-specification-v0.6-20160331-draft.pdf
+
+type VP9_FRAME_TYPE int
+
+const (
+	VP9_KEY_FRAME VP9_FRAME_TYPE = iota
+	VP9_NON_KEY_FRAME
+)
+
+type VP9_COLOR_SPACE int
+
+const (
+	VP9_CS_UNKNOWN VP9_COLOR_SPACE = iota
+	VP9_CS_BT_601
+	VP9_CS_BT_709
+	VP9_CS_SMPTE_170
+	VP9_CS_SMPTE_240
+	VP9_CS_BT_2020
+	VP9_CS_RESERVED
+	VP9_CS_RGB
+)
+
+// uncompressed_header() {
+//     frame_marker                         f(2)
+//     profile_low_bit                      f(1)
+//     profile_high_bit                     f(1)
+//     Profile = (profile_high_bit << 1) + profile_low_bit
+//     if ( Profile == 3 )
+//         reserved_zero                    f(1)
+//     show_existing_frame                  f(1)
+//     if ( show_existing_frame == 1 ) {
+//         frame_to_show_map_idx            f(3)
+//         ...
+//         return
+//     }
+//     LastFrameType = frame_type
+//     frame_type                           f(1)
+//     show_frame                           f(1)
+//     error_resilient_mode                 f(1)
+//     if ( frame_type == KEY_FRAME ) {
+//         frame_sync_code()
+//         color_config()
+//         frame_size()
+//         render_size()
+//         refresh_frame_flags = 0xFF
+//         FrameIsIntra = 1
+//     } else {
+//         if ( show_frame == 0 ) {
+//             intra_only                   f(1)
+//         } else {
+//             intra_only = 0
+//         }
+//         FrameIsIntra = intra_only
+//         if ( error_resilient_mode == 0 ) {
+//             reset_frame_context          f(2)
+//         } else {
+//             reset_frame_context = 0
+//         }
+//         if ( intra_only == 1 ) {
+//             frame_sync_code()
+//             if ( Profile > 0 ) {
+//                 color_config()
+//             } else {
+//                 ...
+//             }
+//             refresh_frame_flags          f(8)
+//             frame_size()
+//             render_size()
+//         } else {
+//             refresh_frame_flags          f(8)
+//             for ( i = 0; i < 3; i++ ) {
+//                 ref_frame_idx[ i ]       f(3)
+//                 ref_frame_sign_bias[ LAST_FRAME + i ] f(1)
+//             }
+//             frame_size_with_refs()
+//             ...
+//         }
+//     }
+//     ...
+// }
+
+type VP9FrameHeader struct {
+	Frame_marker          uint8
+	Profile               uint8
+	Show_existing_frame   uint8
+	Frame_to_show_map_idx uint8
+	Frame_type            uint8
+	Show_frame            uint8
+	Error_resilient_mode  uint8
+	Intra_only            uint8
+	Reset_frame_context   uint8
+	BitDepth              uint8
+	Color_space           uint8
+	Color_range           uint8
+	Subsampling_x         uint8
+	Subsampling_y         uint8
+	Refresh_frame_flags   uint8
+	Ref_frame_idx         [3]uint8
+	Ref_frame_sign_bias   [3]uint8
+	//inter frame 的宽高可能引用参考帧,这种情况下Width/Height 为0
+	Width        uint32
+	Height       uint32
+	RenderWidth  uint32
+	RenderHeight uint32
+}
+
+func (hdr *VP9FrameHeader) Decode(frame []byte) (err error) {
+	if len(frame) < 1 {
+		return errors.New("vp9 frame bytes < 1")
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.New("decode vp9 uncompressed header failed")
+		}
+	}()
+	bs := NewBitStream(frame)
+	hdr.Frame_marker = bs.Uint8(2)
+	if hdr.Frame_marker != 2 {
+		return errors.New("invalid vp9 frame marker")
+	}
+	profile_low_bit := bs.GetBit()
+	profile_high_bit := bs.GetBit()
+	hdr.Profile = profile_high_bit<<1 | profile_low_bit
+	if hdr.Profile == 3 {
+		bs.SkipBits(1)
+	}
+	hdr.Show_existing_frame = bs.GetBit()
+	if hdr.Show_existing_frame == 1 {
+		hdr.Frame_to_show_map_idx = bs.Uint8(3)
+		return nil
+	}
+	hdr.Frame_type = bs.GetBit()
+	hdr.Show_frame = bs.GetBit()
+	hdr.Error_resilient_mode = bs.GetBit()
+	if VP9_FRAME_TYPE(hdr.Frame_type) == VP9_KEY_FRAME {
+		if err = vp9FrameSyncCode(bs); err != nil {
+			return err
+		}
+		hdr.colorConfig(bs)
+		hdr.frameSize(bs)
+		hdr.renderSize(bs)
+		hdr.Refresh_frame_flags = 0xFF
+		return nil
+	}
+
+	if hdr.Show_frame == 0 {
+		hdr.Intra_only = bs.GetBit()
+	}
+	if hdr.Error_resilient_mode == 0 {
+		hdr.Reset_frame_context = bs.Uint8(2)
+	}
+	if hdr.Intra_only == 1 {
+		if err = vp9FrameSyncCode(bs); err != nil {
+			return err
+		}
+		if hdr.Profile > 0 {
+			hdr.colorConfig(bs)
+		} else {
+			hdr.Color_space = uint8(VP9_CS_BT_601)
+			hdr.Subsampling_x = 1
+			hdr.Subsampling_y = 1
+			hdr.BitDepth = 8
+		}
+		hdr.Refresh_frame_flags = bs.Uint8(8)
+		hdr.frameSize(bs)
+		hdr.renderSize(bs)
+	} else {
+		hdr.Refresh_frame_flags = bs.Uint8(8)
+		for i := 0; i < 3; i++ {
+			hdr.Ref_frame_idx[i] = bs.Uint8(3)
+			hdr.Ref_frame_sign_bias[i] = bs.GetBit()
+		}
+		// frame_size_with_refs()
+		found_ref := uint8(0)
+		for i := 0; i < 3; i++ {
+			if found_ref = bs.GetBit(); found_ref == 1 {
+				break
+			}
+		}
+		if found_ref == 0 {
+			hdr.frameSize(bs)
+		}
+	}
+	return nil
+}
+
+//	frame_sync_code() {
+//	    frame_sync_byte_0                    f(8)
+//	    frame_sync_byte_1                    f(8)
+//	    frame_sync_byte_2                    f(8)
+//	}
+func vp9FrameSyncCode(bs *BitStream) error {
+	if bs.Uint8(8) != 0x49 || bs.Uint8(8) != 0x83 || bs.Uint8(8) != 0x42 {
+		return errors.New("invalid vp9 frame sync code")
+	}
+	return nil
+}
+
+//	color_config() {
+//	    if ( Profile >= 2 ) {
+//	        ten_or_twelve_bit                f(1)
+//	        BitDepth = ten_or_twelve_bit ? 12 : 10
+//	    } else {
+//	        BitDepth = 8
+//	    }
+//	    color_space                          f(3)
+//	    if ( color_space != CS_RGB ) {
+//	        color_range                      f(1)
+//	        if ( Profile == 1 || Profile == 3 ) {
+//	            subsampling_x                f(1)
+//	            subsampling_y                f(1)
+//	            reserved_zero                f(1)
+//	        } else {
+//	            subsampling_x = 1
+//	            subsampling_y = 1
+//	        }
+//	    } else {
+//	        color_range = 1
+//	        if ( Profile == 1 || Profile == 3 ) {
+//	            subsampling_x = 0
+//	            subsampling_y = 0
+//	            reserved_zero                f(1)
+//	        }
+//	    }
+//	}
+func (hdr *VP9FrameHeader) colorConfig(bs *BitStream) {
+	hdr.BitDepth = 8
+	if hdr.Profile >= 2 {
+		if bs.GetBit() == 1 {
+			hdr.BitDepth = 12
+		} else {
+			hdr.BitDepth = 10
+		}
+	}
+	hdr.Color_space = bs.Uint8(3)
+	if VP9_COLOR_SPACE(hdr.Color_space) != VP9_CS_RGB {
+		hdr.Color_range = bs.GetBit()
+		if hdr.Profile == 1 || hdr.Profile == 3 {
+			hdr.Subsampling_x = bs.GetBit()
+			hdr.Subsampling_y = bs.GetBit()
+			bs.SkipBits(1)
+		} else {
+			hdr.Subsampling_x = 1
+			hdr.Subsampling_y = 1
+		}
+	} else {
+		hdr.Color_range = 1
+		if hdr.Profile == 1 || hdr.Profile == 3 {
+			hdr.Subsampling_x = 0
+			hdr.Subsampling_y = 0
+			bs.SkipBits(1)
+		}
+	}
+}
+
+func (hdr *VP9FrameHeader) frameSize(bs *BitStream) {
+	hdr.Width = uint32(bs.Uint16(16)) + 1
+	hdr.Height = uint32(bs.Uint16(16)) + 1
+}
+
+func (hdr *VP9FrameHeader) renderSize(bs *BitStream) {
+	if bs.GetBit() == 1 {
+		hdr.RenderWidth = uint32(bs.Uint16(16)) + 1
+		hdr.RenderHeight = uint32(bs.Uint16(16)) + 1
+	} else {
+		hdr.RenderWidth = hdr.Width
+		hdr.RenderHeight = hdr.Height
+	}
+}
+
+// superframe_index() {
+//     SZ = frame_size_bytes_minus_1 + 1
+//     superframe_marker                    f(3)
+//     bytes_per_framesize_minus_1          f(2)
+//     frames_in_superframe_minus_1         f(3)
+//     for ( i = 0; i < NumFrames; i++ )
+//         frame_sizes[ i ]                 f(SZ*8) (little endian)
+//     superframe_marker                    f(3)
+//     bytes_per_framesize_minus_1          f(2)
+//     frames_in_superframe_minus_1         f(3)
+// }
+
+// SplitVP9SuperFrame 拆分superframe,如果不是superframe,整帧回调一次
+func SplitVP9SuperFrame(frames []byte, onFrame func(frame []byte) bool) error {
+	if len(frames) == 0 {
+		return errors.New("empty vp9 frame")
+	}
+	marker := frames[len(frames)-1]
+	if marker&0xE0 != 0xC0 {
+		onFrame(frames)
+		return nil
+	}
+	bytesPerSize := int((marker>>3)&0x03) + 1
+	numFrames := int(marker&0x07) + 1
+	indexSize := 2 + bytesPerSize*numFrames
+	if len(frames) < indexSize || frames[len(frames)-indexSize] != marker {
+		onFrame(frames)
+		return nil
+	}
+	index := frames[len(frames)-indexSize+1:]
+	data := frames[:len(frames)-indexSize]
+	for i := 0; i < numFrames; i++ {
+		size := 0
+		for j := 0; j < bytesPerSize; j++ {
+			size |= int(index[i*bytesPerSize+j]) << (8 * j)
+		}
+		if size > len(data) {
+			return errors.New("vp9 superframe size out of range")
+		}
+		if !onFrame(data[:size]) {
+			break
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+func IsVP9KeyFrame(frames []byte) bool {
+	key := false
+	SplitVP9SuperFrame(frames, func(frame []byte) bool {
+		var hdr VP9FrameHeader
+		if err := hdr.Decode(frame); err != nil {
+			return false
+		}
+		key = hdr.Show_existing_frame == 0 && VP9_FRAME_TYPE(hdr.Frame_type) == VP9_KEY_FRAME
+		return false
+	})
+	return key
+}
+
+func GetVP9Resolution(frames []byte) (width uint32, height uint32, err error) {
+	err = errors.New("the frame is not Key frame or intra only frame")
+	SplitVP9SuperFrame(frames, func(frame []byte) bool {
+		var hdr VP9FrameHeader
+		if e := hdr.Decode(frame); e != nil {
+			err = e
+			return false
+		}
+		if hdr.Width > 0 && hdr.Height > 0 {
+			width, height, err = hdr.Width, hdr.Height, nil
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// VP Codec ISO Media File Format Binding
+// aligned (8) class VPCodecConfigurationRecord {
+//     unsigned int (8)     profile;
+//     unsigned int (8)     level;
+//     unsigned int (4)     bitDepth;
+//     unsigned int (3)     chromaSubsampling;
+//     unsigned int (1)     videoFullRangeFlag;
+//     unsigned int (8)     colourPrimaries;
+//     unsigned int (8)     transferCharacteristics;
+//     unsigned int (8)     matrixCoefficients;
+//     unsigned int (16)    codecIntializationDataSize;
+//     unsigned int (8)[]   codecIntializationData;
+// }
+
+const (
+	VP_CHROMA_420_VERTICAL             = 0
+	VP_CHROMA_420_COLLOCATED_WITH_LUMA = 1
+	VP_CHROMA_422                      = 2
+	VP_CHROMA_444                      = 3
+)
+
+type VPCodecConfigurationRecord struct {
+	Profile                    uint8
+	Level                      uint8
+	BitDepth                   uint8
+	ChromaSubsampling          uint8
+	VideoFullRangeFlag         uint8
+	ColourPrimaries            uint8
+	TransferCharacteristics    uint8
+	MatrixCoefficients         uint8
+	CodecIntializationDataSize uint16
+	CodecIntializationData     []byte
+}
+
+func (vpcc *VPCodecConfigurationRecord) Encode() []byte {
+	bsw := NewBitStreamWriter(8 + len(vpcc.CodecIntializationData))
+	bsw.PutByte(vpcc.Profile)
+	bsw.PutByte(vpcc.Level)
+	bsw.PutUint8(vpcc.BitDepth, 4)
+	bsw.PutUint8(vpcc.ChromaSubsampling, 3)
+	bsw.PutUint8(vpcc.VideoFullRangeFlag, 1)
+	bsw.PutByte(vpcc.ColourPrimaries)
+	bsw.PutByte(vpcc.TransferCharacteristics)
+	bsw.PutByte(vpcc.MatrixCoefficients)
+	bsw.PutUint16(uint16(len(vpcc.CodecIntializationData)), 16)
+	bsw.PutBytes(vpcc.CodecIntializationData)
+	return bsw.Bits()
+}
+
+func (vpcc *VPCodecConfigurationRecord) Decode(data []byte) error {
+	if len(data) < 8 {
+		return errors.New("len of vpcC < 8")
+	}
+	bs := NewBitStream(data)
+	vpcc.Profile = bs.Uint8(8)
+	vpcc.Level = bs.Uint8(8)
+	vpcc.BitDepth = bs.Uint8(4)
+	vpcc.ChromaSubsampling = bs.Uint8(3)
+	vpcc.VideoFullRangeFlag = bs.GetBit()
+	vpcc.ColourPrimaries = bs.Uint8(8)
+	vpcc.TransferCharacteristics = bs.Uint8(8)
+	vpcc.MatrixCoefficients = bs.Uint8(8)
+	vpcc.CodecIntializationDataSize = bs.Uint16(16)
+	if int(vpcc.CodecIntializationDataSize) > len(data)-8 {
+		return errors.New("vpcC codecIntializationDataSize out of range")
+	}
+	vpcc.CodecIntializationData = make([]byte, vpcc.CodecIntializationDataSize)
+	copy(vpcc.CodecIntializationData, data[8:])
+	return nil
+}
+
+// VP9 Levels and Decoder Testing,只按照图像大小来估算level
+var vp9LevelPictureSize = []struct {
+	level       uint8
+	pictureSize uint32
+}{
+	{10, 36864},
+	{11, 73728},
+	{20, 122880},
+	{21, 245760},
+	{30, 552960},
+	{31, 983040},
+	{40, 2228224},
+	{50, 8912896},
+	{60, 35651584},
+}
+
+func getVP9Level(width, height uint32) uint8 {
+	for _, l := range vp9LevelPictureSize {
+		if width*height <= l.pictureSize {
+			return l.level
+		}
+	}
+	return 62
+}
+
+// UpdateFrameHeader 用关键帧(或者intra only帧)的uncompressed header 更新vpcC
+func (vpcc *VPCodecConfigurationRecord) UpdateFrameHeader(hdr *VP9FrameHeader) {
+	vpcc.Profile = hdr.Profile
+	vpcc.Level = getVP9Level(hdr.Width, hdr.Height)
+	vpcc.BitDepth = hdr.BitDepth
+	vpcc.VideoFullRangeFlag = hdr.Color_range
+	switch {
+	case hdr.Subsampling_x == 1 && hdr.Subsampling_y == 0:
+		vpcc.ChromaSubsampling = VP_CHROMA_422
+	case hdr.Subsampling_x == 0 && hdr.Subsampling_y == 0:
+		vpcc.ChromaSubsampling = VP_CHROMA_444
+	default:
+		vpcc.ChromaSubsampling = VP_CHROMA_420_COLLOCATED_WITH_LUMA
+	}
+
+	// ISO/IEC 23091-2
+	switch VP9_COLOR_SPACE(hdr.Color_space) {
+	case VP9_CS_BT_601:
+		vpcc.ColourPrimaries, vpcc.TransferCharacteristics, vpcc.MatrixCoefficients = 5, 6, 5
+	case VP9_CS_BT_709:
+		vpcc.ColourPrimaries, vpcc.TransferCharacteristics, vpcc.MatrixCoefficients = 1, 1, 1
+	case VP9_CS_SMPTE_170:
+		vpcc.ColourPrimaries, vpcc.TransferCharacteristics, vpcc.MatrixCoefficients = 6, 6, 6
+	case VP9_CS_SMPTE_240:
+		vpcc.ColourPrimaries, vpcc.TransferCharacteristics, vpcc.MatrixCoefficients = 7, 7, 7
+	case VP9_CS_BT_2020:
+		vpcc.ColourPrimaries, vpcc.TransferCharacteristics, vpcc.MatrixCoefficients = 9, 2, 9
+	case VP9_CS_RGB:
+		vpcc.ColourPrimaries, vpcc.TransferCharacteristics, vpcc.MatrixCoefficients = 2, 2, 0
+	default:
+		vpcc.ColourPrimaries, vpcc.TransferCharacteristics, vpcc.MatrixCoefficients = 2, 2, 2
+	}
+}
+
+func CreateVPCodecConfigurationRecord(keyframe []byte) (*VPCodecConfigurationRecord, error) {
+	var hdr *VP9FrameHeader
+	err := SplitVP9SuperFrame(keyframe, func(frame []byte) bool {
+		tmp := &VP9FrameHeader{}
+		if e := tmp.Decode(frame); e != nil {
+			return false
+		}
+		if tmp.Width > 0 && tmp.Height > 0 && tmp.BitDepth > 0 {
+			hdr = tmp
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if hdr == nil {
+		return nil, errors.New("the frame is not Key frame or intra only frame")
+	}
+	vpcc := &VPCodecConfigurationRecord{}
+	vpcc.UpdateFrameHeader(hdr)
+	return vpcc, nil
+}
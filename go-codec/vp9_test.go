@@ -0,0 +1,110 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	// profile 0, 640x360, bt709
+	vp9KeyFrame = []byte{0x82, 0x49, 0x83, 0x42, 0x40, 0x27, 0xF0, 0x16, 0x70}
+	// profile 2, 10bit, 1920x1080, bt2020 full range
+	vp9KeyFrame10bit = []byte{0x92, 0x49, 0x83, 0x42, 0x58, 0x3B, 0xF8, 0x21, 0xB8}
+	vp9InterFrame    = []byte{0x86, 0x00, 0x40, 0x92}
+)
+
+func TestVP9FrameHeader_Decode(t *testing.T) {
+	tests := []struct {
+		name         string
+		frame        []byte
+		wantProfile  uint8
+		wantBitDepth uint8
+		wantKey      bool
+		wantWidth    uint32
+		wantHeight   uint32
+		wantErr      bool
+	}{
+		{name: "key frame", frame: vp9KeyFrame, wantProfile: 0, wantBitDepth: 8, wantKey: true, wantWidth: 640, wantHeight: 360},
+		{name: "10bit key frame", frame: vp9KeyFrame10bit, wantProfile: 2, wantBitDepth: 10, wantKey: true, wantWidth: 1920, wantHeight: 1080},
+		{name: "inter frame", frame: vp9InterFrame, wantProfile: 0, wantBitDepth: 0, wantKey: false, wantWidth: 0, wantHeight: 0},
+		{name: "bad marker", frame: []byte{0x00, 0x00}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := &VP9FrameHeader{}
+			err := hdr.Decode(tt.frame)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VP9FrameHeader.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if hdr.Profile != tt.wantProfile || hdr.BitDepth != tt.wantBitDepth {
+				t.Errorf("VP9FrameHeader.Decode() profile = %d bitdepth = %d", hdr.Profile, hdr.BitDepth)
+			}
+			if (VP9_FRAME_TYPE(hdr.Frame_type) == VP9_KEY_FRAME) != tt.wantKey {
+				t.Errorf("VP9FrameHeader.Decode() frame_type = %d", hdr.Frame_type)
+			}
+			if hdr.Width != tt.wantWidth || hdr.Height != tt.wantHeight {
+				t.Errorf("VP9FrameHeader.Decode() %dx%d, want %dx%d", hdr.Width, hdr.Height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestSplitVP9SuperFrame(t *testing.T) {
+	superframe := append(append(append([]byte{}, vp9KeyFrame...), vp9InterFrame...), 0xC1, 0x09, 0x04, 0xC1)
+	var frames [][]byte
+	if err := SplitVP9SuperFrame(superframe, func(frame []byte) bool {
+		frames = append(frames, frame)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || !bytes.Equal(frames[0], vp9KeyFrame) || !bytes.Equal(frames[1], vp9InterFrame) {
+		t.Fatalf("SplitVP9SuperFrame() = %x", frames)
+	}
+	if !IsVP9KeyFrame(superframe) {
+		t.Errorf("IsVP9KeyFrame() = false, want true")
+	}
+	if IsVP9KeyFrame(vp9InterFrame) {
+		t.Errorf("IsVP9KeyFrame() = true, want false")
+	}
+	w, h, err := GetVP9Resolution(superframe)
+	if err != nil || w != 640 || h != 360 {
+		t.Errorf("GetVP9Resolution() = %d %d %v", w, h, err)
+	}
+}
+
+func TestVPCodecConfigurationRecord(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		want  []byte
+	}{
+		{name: "8bit", frame: vp9KeyFrame, want: []byte{0x00, 0x15, 0x82, 0x01, 0x01, 0x01, 0x00, 0x00}},
+		{name: "10bit", frame: vp9KeyFrame10bit, want: []byte{0x02, 0x28, 0xA3, 0x09, 0x02, 0x09, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vpcc, err := CreateVPCodecConfigurationRecord(tt.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := vpcc.Encode()
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("VPCodecConfigurationRecord.Encode() = %x, want %x", got, tt.want)
+			}
+			vpcc2 := &VPCodecConfigurationRecord{}
+			if err := vpcc2.Decode(got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(vpcc2.Encode(), got) {
+				t.Errorf("VPCodecConfigurationRecord.Decode() = %+v", vpcc2)
+			}
+		})
+	}
+	if _, err := CreateVPCodecConfigurationRecord(vp9InterFrame); err == nil {
+		t.Errorf("CreateVPCodecConfigurationRecord() with inter frame should fail")
+	}
+}
@@ -192,6 +192,62 @@ func (demuxer *HevcTagDemuxer) decodeNalus(data []byte, CompositionTime int32) e
     return nil
 }
 
+type AV1TagDemuxer struct {
+    av1c    *codec.AV1CodecConfigurationRecord
+    seqHdr  []byte
+    onframe OnVideoFrameCallBack
+}
+
+func NewAV1TagDemuxer() *AV1TagDemuxer {
+    return &AV1TagDemuxer{
+        av1c:    codec.NewAV1CodecConfigurationRecord(),
+        onframe: nil,
+    }
+}
+
+func (demuxer *AV1TagDemuxer) OnFrame(onframe OnVideoFrameCallBack) {
+    demuxer.onframe = onframe
+}
+
+func (demuxer *AV1TagDemuxer) Decode(data []byte) error {
+    if len(data) < 5 {
+        return errors.New("av1 tag size < 5")
+    }
+    if data[0]&0x80 == 0 {
+        return errors.New("av1 must be carried by enhanced flv")
+    }
+
+    vtag := VideoTag{}
+    vtag.Decode(data[0:5])
+    data = data[5:]
+    switch vtag.AVCPacketType {
+    case PacketTypeSequenceStart:
+        if err := demuxer.av1c.Decode(data); err != nil {
+            return err
+        }
+        demuxer.seqHdr = demuxer.av1c.SequenceHeader()
+    case PacketTypeCodedFrames, PacketTypeCodedFramesX:
+        hasSeqHdr := false
+        codec.SplitAV1OBU(data, func(obu []byte) bool {
+            if codec.AV1ObuType(obu) == codec.AV1_OBU_SEQUENCE_HEADER {
+                hasSeqHdr = true
+                return false
+            }
+            return true
+        })
+        if !hasSeqHdr && len(demuxer.seqHdr) > 0 && vtag.FrameType == uint8(KEY_FRAME) {
+            frame := make([]byte, 0, len(demuxer.seqHdr)+len(data))
+            frame = append(frame, demuxer.seqHdr...)
+            frame = append(frame, data...)
+            data = frame
+        }
+        if demuxer.onframe != nil && len(data) > 0 {
+            demuxer.onframe(codec.CODECID_VIDEO_AV1, data, 0)
+        }
+    }
+    return nil
+}
+
 type OnAudioFrameCallBack func(codecid codec.CodecID, frame []byte)
 
 type AudioTagDemuxer interface {
@@ -280,7 +336,7 @@ func (demuxer *G711Demuxer) Decode(data []byte) error {
 
 func CreateAudioTagDemuxer(formats FLV_SOUND_FORMAT) (demuxer AudioTagDemuxer) {
     switch formats {
-    case FLV_G711A, FLV_G711U, FLV_MP3:
+    case FLV_G711A, FLV_G711U, FLV_MP3, FLV_LPCM:
         demuxer = NewG711Demuxer(formats)
     case FLV_AAC:
         demuxer = NewAACTagDemuxer()
@@ -296,6 +352,8 @@ func CreateFlvVideoTagHandle(cid FLV_VIDEO_CODEC_ID) (demuxer VideoTagDemuxer) {
         demuxer = NewAVCTagDemuxer()
     case FLV_HEVC:
         demuxer = NewHevcTagDemuxer()
+    case FLV_AV1:
+        demuxer = NewAV1TagDemuxer()
     default:
         panic("unsupport audio codec id")
     }
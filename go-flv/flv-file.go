@@ -137,7 +137,10 @@ func (f *FlvReader) Input(data []byte) (err error) {
                 f.state = FLV_PARSER_SCRIPT_TAG
             }
         case FLV_PARSER_DETECT_VIDEO:
-            if err = f.createVideoTagDemuxer(FLV_VIDEO_CODEC_ID(buf[0] & 0x0F)); err != nil {
+            if len(buf) < 1 || (buf[0]&0x80 != 0 && len(buf) < 5) {
+                goto end
+            }
+            if err = f.createVideoTagDemuxer(GetFLVVideoCodecId(buf)); err != nil {
                 goto end
             }
             f.state = FLV_PARSER_VIDEO_TAG
@@ -204,6 +207,8 @@ func (f *FlvReader) createVideoTagDemuxer(cid FLV_VIDEO_CODEC_ID) error {
         f.videoDemuxer = NewAVCTagDemuxer()
     case FLV_HEVC:
         f.videoDemuxer = NewHevcTagDemuxer()
+    case FLV_AV1:
+        f.videoDemuxer = NewAV1TagDemuxer()
     default:
         return errors.New("unsupport video codec id")
     }
@@ -217,7 +222,7 @@ func (f *FlvReader) createVideoTagDemuxer(cid FLV_VIDEO_CODEC_ID) error {
 
 func (f *FlvReader) createAudioTagDemuxer(formats FLV_SOUND_FORMAT) error {
     switch formats {
-    case FLV_G711A, FLV_G711U, FLV_MP3:
+    case FLV_G711A, FLV_G711U, FLV_MP3, FLV_LPCM:
         f.audioDemuxer = NewG711Demuxer(formats)
     case FLV_AAC:
         f.audioDemuxer = NewAACTagDemuxer()
@@ -313,6 +318,22 @@ func (f *FlvWriter) WriteG711U(data []byte, pts uint32, dts uint32) error {
     return f.writeAudio(data, pts, dts)
 }
 
+//16bit小端PCM, sampleRate/channelCount只在第一次写入时生效
+func (f *FlvWriter) WriteLPCM(data []byte, sampleRate int, channelCount int, pts uint32, dts uint32) error {
+    if f.muxer.audioMuxer == nil {
+        muxer, err := NewLPCMMuxer(channelCount, sampleRate)
+        if err != nil {
+            return err
+        }
+        f.muxer.audioMuxer = muxer
+    } else {
+        if _, ok := f.muxer.audioMuxer.(*LPCMMuxer); !ok {
+            panic("audio codec change")
+        }
+    }
+    return f.writeAudio(data, pts, dts)
+}
+
 func (f *FlvWriter) WriteMp3(data []byte, pts uint32, dts uint32) error {
     if f.muxer.audioMuxer == nil {
         f.muxer.SetAudioCodeId(FLV_MP3)
@@ -365,6 +386,17 @@ func (f *FlvWriter) WriteH265(data []byte, pts uint32, dts uint32) error {
     return f.writeVideo(data, pts, dts)
 }
 
+func (f *FlvWriter) WriteAV1(data []byte, pts uint32, dts uint32) error {
+    if f.muxer.videoMuxer == nil {
+        f.muxer.SetVideoCodeId(FLV_AV1)
+    } else {
+        if _, ok := f.muxer.videoMuxer.(*AV1Muxer); !ok {
+            panic("video codec change")
+        }
+    }
+    return f.writeVideo(data, pts, dts)
+}
+
 func (f *FlvWriter) writeVideo(data []byte, pts uint32, dts uint32) error {
     if tags, err := f.muxer.WriteVideo(data, pts, dts); err != nil {
         return err
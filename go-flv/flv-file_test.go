@@ -1,6 +1,7 @@
 package flv
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -118,3 +119,95 @@ func TestFlvReadH265(t *testing.T) {
 		}
 	})
 }
+
+func TestFlvWriter_WriteLPCM(t *testing.T) {
+	buf := new(bytes.Buffer)
+	wf := CreateFlvWriter(buf)
+	wf.WriteFlvHeader()
+	pcm := codec.G711AToPCM([]byte{0xD5, 0x55, 0xAA, 0x2A})
+	//G711解码出来的是8000Hz, flv无法表示
+	if err := wf.WriteLPCM(pcm, 8000, 1, 0, 0); err == nil {
+		t.Fatal("WriteLPCM() with 8000Hz should fail")
+	}
+	if err := wf.WriteLPCM(pcm, 44100, 1, 20, 20); err != nil {
+		t.Fatal(err)
+	}
+	rf := CreateFlvReader()
+	var got []byte
+	rf.OnFrame = func(cid codec.CodecID, frame []byte, pts, dts uint32) {
+		if cid != codec.CODECID_AUDIO_LPCM || pts != 20 {
+			t.Errorf("OnFrame() cid = %s pts = %d", codec.CodecString(cid), pts)
+		}
+		got = append(got, frame...)
+	}
+	if err := rf.Input(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("FlvReader got %x, want %x", got, pcm)
+	}
+}
+
+func TestFlvWriter_WriteAV1(t *testing.T) {
+	td := []byte{0x12, 0x00}
+	seqHdr := []byte{0x0A, 0x0B, 0x00, 0x00, 0x00, 0x42, 0xA6, 0x7F, 0xD9, 0xE7, 0xFF, 0xCC, 0x02}
+	key := []byte{0x32, 0x02, 0x10, 0x00}
+	inter := []byte{0x32, 0x02, 0x30, 0x00}
+	join := func(parts ...[]byte) []byte {
+		var out []byte
+		for _, part := range parts {
+			out = append(out, part...)
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		tu   []byte
+		//enhanced video tag header: IsExHeader|FrameType|PacketType + FourCC
+		wantHeader []byte
+		want       []byte
+	}{
+		{name: "key frame with sequence header", tu: join(td, seqHdr, key), wantHeader: []byte{0x91, 'a', 'v', '0', '1'}, want: join(seqHdr, key)},
+		{name: "inter frame", tu: join(td, inter), wantHeader: []byte{0xA1, 'a', 'v', '0', '1'}, want: inter},
+		{name: "key frame without sequence header", tu: join(td, key), wantHeader: []byte{0x91, 'a', 'v', '0', '1'}, want: join(seqHdr, key)},
+	}
+
+	buf := new(bytes.Buffer)
+	wf := CreateFlvWriter(buf)
+	wf.WriteFlvHeader()
+	for i, tt := range tests {
+		if err := wf.WriteAV1(tt.tu, uint32(i*40), uint32(i*40)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//sequence start: IsExHeader|KeyFrame|PacketTypeSequenceStart
+	if !bytes.Contains(buf.Bytes(), []byte{0x90, 'a', 'v', '0', '1', 0x81}) {
+		t.Errorf("av1 sequence start tag not found")
+	}
+	for _, tt := range tests {
+		//tag中去掉了temporal delimiter
+		if !bytes.Contains(buf.Bytes(), append(tt.wantHeader, tt.tu[len(td):]...)) {
+			t.Errorf("%s: tag header %x not found", tt.name, tt.wantHeader)
+		}
+	}
+
+	rf := CreateFlvReader()
+	var got [][]byte
+	rf.OnFrame = func(cid codec.CodecID, frame []byte, pts, dts uint32) {
+		if cid != codec.CODECID_VIDEO_AV1 || pts != uint32(len(got)*40) {
+			t.Errorf("OnFrame() cid = %s pts = %d", codec.CodecString(cid), pts)
+		}
+		got = append(got, append([]byte{}, frame...))
+	}
+	if err := rf.Input(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(tests) {
+		t.Fatalf("FlvReader got %d frames, want %d", len(got), len(tests))
+	}
+	for i, tt := range tests {
+		if !bytes.Equal(got[i], tt.want) {
+			t.Errorf("%s: FlvReader got %x, want %x", tt.name, got[i], tt.want)
+		}
+	}
+}
@@ -24,6 +24,8 @@ func CovertFlvVideoCodecId2MpegCodecId(cid FLV_VIDEO_CODEC_ID) codec.CodecID {
         return codec.CODECID_VIDEO_H264
     } else if cid == FLV_HEVC {
         return codec.CODECID_VIDEO_H265
+    } else if cid == FLV_AV1 {
+        return codec.CODECID_VIDEO_AV1
     }
     return codec.CODECID_UNRECOGNIZED
 }
@@ -37,6 +39,8 @@ func CovertFlvAudioCodecId2MpegCodecId(cid FLV_SOUND_FORMAT) codec.CodecID {
         return codec.CODECID_AUDIO_G711U
     } else if cid == FLV_MP3 {
         return codec.CODECID_AUDIO_MP3
+    } else if cid == FLV_LPCM {
+        return codec.CODECID_AUDIO_LPCM
     }
     return codec.CODECID_UNRECOGNIZED
 }
@@ -46,6 +50,8 @@ func CovertCodecId2FlvVideoCodecId(cid codec.CodecID) FLV_VIDEO_CODEC_ID {
         return FLV_AVC
     } else if cid == codec.CODECID_VIDEO_H265 {
         return FLV_HEVC
+    } else if cid == codec.CODECID_VIDEO_AV1 {
+        return FLV_AV1
     } else {
         panic("unsupport flv video codec")
     }
@@ -58,6 +64,8 @@ func CovertCodecId2SoundFromat(cid codec.CodecID) FLV_SOUND_FORMAT {
         return FLV_G711A
     } else if cid == codec.CODECID_AUDIO_G711U {
         return FLV_G711U
+    } else if cid == codec.CODECID_AUDIO_LPCM {
+        return FLV_LPCM
     } else {
         panic("unsupport flv audio codec")
     }
@@ -72,7 +80,7 @@ func GetTagLenByAudioCodec(cid FLV_SOUND_FORMAT) int {
 }
 
 func GetTagLenByVideoCodec(cid FLV_VIDEO_CODEC_ID) int {
-    if cid == FLV_AVC || cid == FLV_HEVC {
+    if cid == FLV_AVC || cid == FLV_HEVC || cid == FLV_AV1 {
         return 5
     } else {
         return 1
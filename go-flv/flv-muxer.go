@@ -197,11 +197,60 @@ func (muxer *HevcMuxer) Write(frames []byte, pts uint32, dts uint32) [][]byte {
     return tags
 }
 
+type AV1Muxer struct {
+    av1c  *codec.AV1CodecConfigurationRecord
+    cache []byte
+    first bool
+}
+
+func NewAV1Muxer() *AV1Muxer {
+    return &AV1Muxer{
+        av1c:  codec.NewAV1CodecConfigurationRecord(),
+        cache: make([]byte, 0, 1024),
+        first: true,
+    }
+}
+
+// frames 为一个temporal unit(Low Overhead Bitstream Format)
+func (muxer *AV1Muxer) Write(frames []byte, pts uint32, dts uint32) [][]byte {
+    var vcl bool = false
+    codec.SplitAV1OBU(frames, func(obu []byte) bool {
+        switch codec.AV1ObuType(obu) {
+        case codec.AV1_OBU_TEMPORAL_DELIMITER, codec.AV1_OBU_TILE_LIST, codec.AV1_OBU_PADDING:
+            return true
+        case codec.AV1_OBU_SEQUENCE_HEADER:
+            if err := muxer.av1c.UpdateSequenceHeader(obu); err != nil {
+                return true
+            }
+        case codec.AV1_OBU_FRAME, codec.AV1_OBU_FRAME_HEADER, codec.AV1_OBU_TILE_GROUP:
+            vcl = true
+        }
+        muxer.cache = append(muxer.cache, codec.ConvertAV1ObuToSizedObu(obu)...)
+        return true
+    })
+    var tags [][]byte
+    if muxer.first && len(muxer.av1c.ConfigOBUs) > 0 {
+        tags = append(tags, WriteVideoTag(muxer.av1c.Encode(), true, FLV_AV1, 0, true))
+        muxer.first = false
+    }
+    if vcl {
+        //没有收到sequence header之前的帧直接丢弃
+        if !muxer.first {
+            isKey := codec.IsAV1KeyFrame(muxer.cache)
+            tags = append(tags, WriteVideoTag(muxer.cache, isKey, FLV_AV1, 0, false))
+        }
+        muxer.cache = muxer.cache[:0]
+    }
+    return tags
+}
+
 func CreateVideoMuxer(cid FLV_VIDEO_CODEC_ID) AVTagMuxer {
     if cid == FLV_AVC {
         return NewAVCMuxer()
     } else if cid == FLV_HEVC {
         return NewHevcMuxer()
+    } else if cid == FLV_AV1 {
+        return NewAV1Muxer()
     }
     return nil
 }
@@ -265,6 +314,30 @@ func (muxer *G711UMuxer) Write(frames []byte, pts uint32, dts uint32) [][]byte {
     return tags
 }
 
+type LPCMMuxer struct {
+    channelCount int
+    sampleRate   int
+}
+
+// 16bit小端PCM, flv只能表示5500/11025/22050/44100的采样率, 其他采样率(比如8000)返回错误, 需要先重采样
+func NewLPCMMuxer(channelCount int, sampleRate int) (*LPCMMuxer, error) {
+    switch sampleRate {
+    case 5500, 11025, 22050, 44100:
+    default:
+        return nil, errors.New("flv lpcm only support 5500/11025/22050/44100 sample rate")
+    }
+    return &LPCMMuxer{
+        channelCount: channelCount,
+        sampleRate:   sampleRate,
+    }, nil
+}
+
+func (muxer *LPCMMuxer) Write(frames []byte, pts uint32, dts uint32) [][]byte {
+    tags := make([][]byte, 1)
+    tags[0] = WriteAudioTag(frames, FLV_LPCM, muxer.sampleRate, muxer.channelCount, true)
+    return tags
+}
+
 type Mp3Muxer struct {
 }
 
@@ -285,6 +358,9 @@ func CreateAudioMuxer(cid FLV_SOUND_FORMAT) AVTagMuxer {
         return NewG711UMuxer(1, 5500)
     } else if cid == FLV_MP3 {
         return new(Mp3Muxer)
+    } else if cid == FLV_LPCM {
+        muxer, _ := NewLPCMMuxer(2, 44100)
+        return muxer
     } else {
         return nil
     }
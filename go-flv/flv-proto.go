@@ -31,6 +31,7 @@ type FLV_VIDEO_CODEC_ID int
 const (
     FLV_AVC  FLV_VIDEO_CODEC_ID = 7
     FLV_HEVC FLV_VIDEO_CODEC_ID = 12
+    FLV_AV1  FLV_VIDEO_CODEC_ID = 13
 )
 
 const (
@@ -47,6 +48,7 @@ type FLV_SOUND_FORMAT int
 
 const (
     FLV_MP3   FLV_SOUND_FORMAT = 2
+    FLV_LPCM  FLV_SOUND_FORMAT = 3 //Linear PCM, little endian
     FLV_G711A FLV_SOUND_FORMAT = 7
     FLV_G711U FLV_SOUND_FORMAT = 8
     FLV_AAC   FLV_SOUND_FORMAT = 10
@@ -65,10 +67,13 @@ const (
 func GetFLVVideoCodecId(data []byte) (cid FLV_VIDEO_CODEC_ID) {
     isExHeader := data[0] & 0x80
     if isExHeader != 0 {
-        // TODO av1和VP9
+        // TODO VP9
         if data[1] == 'h' && data[2] == 'v' && data[3] == 'c' && data[4] == '1' {
             // hevc
             cid = FLV_HEVC
+        } else if data[1] == 'a' && data[2] == 'v' && data[3] == '0' && data[4] == '1' {
+            // av1
+            cid = FLV_AV1
         }
     } else {
         cid = FLV_VIDEO_CODEC_ID(data[0] & 0x0F)
@@ -86,6 +91,8 @@ func (format FLV_SOUND_FORMAT) ToMpegCodecId() codec.CodecID {
         return codec.CODECID_AUDIO_AAC
     case format == FLV_MP3:
         return codec.CODECID_AUDIO_MP3
+    case format == FLV_LPCM:
+        return codec.CODECID_AUDIO_LPCM
     default:
         panic("unsupport sound format")
     }
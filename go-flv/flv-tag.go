@@ -95,6 +95,13 @@ type VideoTag struct {
 }
 
 func (vtag VideoTag) Encode() (tag []byte) {
+    // av1 只能通过enhanced flv 来传输
+    if vtag.CodecId == uint8(FLV_AV1) {
+        tag = make([]byte, 5)
+        tag[0] = 0x80 | ((vtag.FrameType & 0x07) << 4) | (vtag.AVCPacketType & 0x0F)
+        copy(tag[1:], []byte{'a', 'v', '0', '1'})
+        return
+    }
     if vtag.CodecId == uint8(FLV_AVC) || vtag.CodecId == uint8(FLV_HEVC) {
         tag = make([]byte, 5)
         tag[1] = vtag.AVCPacketType
@@ -114,7 +121,7 @@ func (vtag *VideoTag) Decode(data []byte) {
         vtag.FrameType = (data[0] >> 4) & 0x07
         vtag.AVCPacketType = data[0] & 0x0F
 
-        // TODO av1和VP9
+        // TODO VP9
         if data[1] == 'h' && data[2] == 'v' && data[3] == 'c' && data[4] == '1' {
             // hevc
             vtag.CodecId = uint8(FLV_HEVC)
@@ -122,6 +129,9 @@ func (vtag *VideoTag) Decode(data []byte) {
             if vtag.AVCPacketType == PacketTypeCodedFrames {
                 vtag.CompositionTime = int32(GetUint24(data[5:]))
             }
+        } else if data[1] == 'a' && data[2] == 'v' && data[3] == '0' && data[4] == '1' {
+            // av1 没有CompositionTime
+            vtag.CodecId = uint8(FLV_AV1)
         }
     } else {
         vtag.FrameType = data[0] >> 4
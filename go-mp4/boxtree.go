@@ -0,0 +1,624 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 通用的box树, 可以查看/修改/删除/移动box之后重新写出, 不需要重新封装sample
+// 不认识的box按原始数据透传, mdat不读入内存, 写出时从源文件拷贝
+
+type BoxSpec struct {
+	Container bool
+	//子box之前的字段长度(不包括box头), 比如stsd的version/flags/entry_count, 为nil时是0
+	HeaderLen func(payload []byte) int
+}
+
+var boxSpecs = make(map[[4]byte]BoxSpec)
+
+// 注册box类型, 已经存在的会被覆盖
+func RegisterBoxSpec(boxtype [4]byte, spec BoxSpec) {
+	boxSpecs[boxtype] = spec
+}
+
+func fixedHeaderLen(n int) func(payload []byte) int {
+	return func(payload []byte) int {
+		return n
+	}
+}
+
+func init() {
+	containers := []string{"moov", "trak", "mdia", "minf", "stbl", "dinf", "edts", "mvex", "moof", "traf", "mfra",
+		"udta", "sinf", "schi", "rinf", "tref", "trgr", "ilst", "meco", "strk", "strd", "vttc"}
+	for _, t := range containers {
+		RegisterBoxSpec(fourcc(t), BoxSpec{Container: true})
+	}
+	// version/flags + entry_count
+	RegisterBoxSpec(fourcc("stsd"), BoxSpec{Container: true, HeaderLen: fixedHeaderLen(8)})
+	RegisterBoxSpec(fourcc("dref"), BoxSpec{Container: true, HeaderLen: fixedHeaderLen(8)})
+	// ISO的meta是FullBox, QuickTime的meta没有version/flags
+	RegisterBoxSpec(fourcc("meta"), BoxSpec{Container: true, HeaderLen: func(payload []byte) int {
+		if len(payload) >= 8 && string(payload[4:8]) == "hdlr" {
+			return 0
+		}
+		return 4
+	}})
+	for _, t := range []string{"avc1", "avc2", "avc3", "avc4", "hvc1", "hev1", "encv", "av01", "vp08", "vp09", "mp4v"} {
+		RegisterBoxSpec(fourcc(t), BoxSpec{Container: true, HeaderLen: fixedHeaderLen(78)})
+	}
+	// SampleEntry, tx3g还有30字节的显示参数
+	RegisterBoxSpec(fourcc("wvtt"), BoxSpec{Container: true, HeaderLen: fixedHeaderLen(8)})
+	RegisterBoxSpec(fourcc("urim"), BoxSpec{Container: true, HeaderLen: fixedHeaderLen(8)})
+	RegisterBoxSpec(fourcc("tx3g"), BoxSpec{Container: true, HeaderLen: fixedHeaderLen(38)})
+	for _, t := range []string{"mp4a", "enca", "Opus", "fLaC", "alaw", "ulaw", "ipcm", "fpcm", ".mp3", "ac-3", "ec-3", "lpcm", "sowt", "twos"} {
+		RegisterBoxSpec(fourcc(t), BoxSpec{Container: true, HeaderLen: audioSampleEntryLen})
+	}
+}
+
+// QuickTime的SoundDescription version 1/2有额外的字段
+func audioSampleEntryLen(payload []byte) int {
+	if len(payload) < 10 {
+		return 28
+	}
+	switch binary.BigEndian.Uint16(payload[8:]) {
+	case 1:
+		return 28 + 16
+	case 2:
+		return 28 + 36
+	default:
+		return 28
+	}
+}
+
+func fourcc(t string) (boxtype [4]byte) {
+	copy(boxtype[:], t)
+	return
+}
+
+type BoxNode struct {
+	Type     [4]byte
+	UserType [16]byte //Type为uuid时有效
+	//box头之后, 子box之前的数据; 不认识的box所有内容都在Data中
+	Data     []byte
+	Children []*BoxNode
+	Parent   *BoxNode
+
+	Offset        uint64 //解析时box在源文件中的偏移
+	largeSize     bool
+	fromSource    bool
+	payloadOffset uint64 //解析时box头之后的偏移
+	payloadSize   uint64
+	lazy          bool //内容还在源文件中
+	src           io.ReadSeeker
+}
+
+func NewBoxNode(boxtype [4]byte, data []byte) *BoxNode {
+	return &BoxNode{Type: boxtype, Data: data}
+}
+
+// 从完整的box数据(包括box头)创建节点, 比如XXXBox.Encode()的输出
+func ParseBox(boxdata []byte) (*BoxNode, error) {
+	nodes, err := parseBoxes(boxdata, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) != 1 {
+		return nil, fmt.Errorf("expect one box, got %d", len(nodes))
+	}
+	nodes[0].fromSource = false
+	return nodes[0], nil
+}
+
+type BoxTree struct {
+	Root *BoxNode //文件本身, Children是顶层box
+}
+
+// 解析r中所有的box, mdat只记录位置, WriteTo时从r读取, 所以写出之前r不能关闭
+func ParseBoxTree(r io.ReadSeeker) (*BoxTree, error) {
+	tree := &BoxTree{Root: &BoxNode{}}
+	offset, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		basebox := BasicBox{}
+		hdrLen, err := basebox.Decode(r)
+		if err == io.EOF && hdrLen == 0 {
+			return tree, nil
+		} else if err != nil {
+			return nil, err
+		}
+		node := &BoxNode{
+			Type:          basebox.Type,
+			UserType:      basebox.UserType,
+			Offset:        uint64(offset),
+			largeSize:     hdrLen >= 16 && basebox.Type != fourcc("uuid") || hdrLen >= 32,
+			fromSource:    true,
+			payloadOffset: uint64(offset) + uint64(hdrLen),
+			src:           r,
+		}
+		if basebox.Size == 0 {
+			//box一直到文件结束
+			end, err := r.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = r.Seek(int64(node.payloadOffset), io.SeekStart); err != nil {
+				return nil, err
+			}
+			basebox.Size = uint64(end) - node.Offset
+		}
+		if basebox.Size < uint64(hdrLen) {
+			return nil, fmt.Errorf("box %s at %d has invalid size %d", string(basebox.Type[:]), offset, basebox.Size)
+		}
+		node.payloadSize = basebox.Size - uint64(hdrLen)
+		if node.Type == fourcc("mdat") {
+			node.lazy = true
+			if _, err = r.Seek(int64(node.payloadSize), io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		} else {
+			payload := make([]byte, node.payloadSize)
+			if _, err = io.ReadFull(r, payload); err != nil {
+				return nil, err
+			}
+			node.setPayload(payload, node.payloadOffset)
+		}
+		node.Parent = tree.Root
+		tree.Root.Children = append(tree.Root.Children, node)
+		offset += int64(basebox.Size)
+	}
+}
+
+func parseBoxes(buf []byte, offset uint64, parent *BoxNode) ([]*BoxNode, error) {
+	var nodes []*BoxNode
+	r := bytes.NewReader(buf)
+	for r.Len() > 0 {
+		start := uint64(len(buf) - r.Len())
+		basebox := BasicBox{}
+		hdrLen, err := basebox.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		if basebox.Size == 0 {
+			basebox.Size = uint64(len(buf)) - start
+		}
+		if basebox.Size < uint64(hdrLen) || basebox.Size-uint64(hdrLen) > uint64(r.Len()) {
+			return nil, fmt.Errorf("box %s at %d has invalid size %d", string(basebox.Type[:]), offset+start, basebox.Size)
+		}
+		node := &BoxNode{
+			Type:          basebox.Type,
+			UserType:      basebox.UserType,
+			Parent:        parent,
+			Offset:        offset + start,
+			largeSize:     hdrLen >= 16 && basebox.Type != fourcc("uuid") || hdrLen >= 32,
+			fromSource:    true,
+			payloadOffset: offset + start + uint64(hdrLen),
+			payloadSize:   basebox.Size - uint64(hdrLen),
+		}
+		payloadStart := start + uint64(hdrLen)
+		payloadEnd := payloadStart + node.payloadSize
+		//限制cap, 修改Data时不会覆盖后面的box
+		node.setPayload(buf[payloadStart:payloadEnd:payloadEnd], node.payloadOffset)
+		r.Seek(int64(payloadStart+node.payloadSize), io.SeekStart)
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (node *BoxNode) spec() (BoxSpec, bool) {
+	//ilst下面的每一项(©nam, covr...)都是data box的容器
+	if node.Parent != nil && node.Parent.Type == fourcc("ilst") {
+		return BoxSpec{Container: true}, true
+	}
+	spec, ok := boxSpecs[node.Type]
+	return spec, ok
+}
+
+func (node *BoxNode) setPayload(payload []byte, offset uint64) {
+	node.Data = payload
+	node.Children = nil
+	spec, ok := node.spec()
+	if !ok || !spec.Container {
+		return
+	}
+	hdrLen := 0
+	if spec.HeaderLen != nil {
+		hdrLen = spec.HeaderLen(payload)
+	}
+	if hdrLen > len(payload) {
+		return
+	}
+	children, err := parseBoxes(payload[hdrLen:], offset+uint64(hdrLen), node)
+	if err != nil {
+		//解析失败按原始数据透传
+		return
+	}
+	node.Data = payload[:hdrLen:hdrLen]
+	node.Children = children
+}
+
+// box大小, 包括box头
+func (node *BoxNode) Size() uint64 {
+	payload := node.PayloadSize()
+	return node.headerLen(payload) + payload
+}
+
+// box头之后的大小
+func (node *BoxNode) PayloadSize() uint64 {
+	if node.lazy {
+		return node.payloadSize
+	}
+	size := uint64(len(node.Data))
+	for _, child := range node.Children {
+		size += child.Size()
+	}
+	return size
+}
+
+func (node *BoxNode) headerLen(payloadSize uint64) uint64 {
+	n := uint64(BasicBoxLen)
+	if node.largeSize || payloadSize+n > 0xFFFFFFFF {
+		n += 8
+	}
+	if node.Type == fourcc("uuid") {
+		n += 16
+	}
+	return n
+}
+
+// mdat等没有读入内存的box返回false, 可以使用ReadPayload读取
+func (node *BoxNode) Loaded() bool {
+	return !node.lazy
+}
+
+// 读取box头之后的全部内容
+func (node *BoxNode) ReadPayload() ([]byte, error) {
+	if !node.lazy {
+		var buf bytes.Buffer
+		if err := node.writePayload(&buf, nil); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	if _, err := node.src.Seek(int64(node.payloadOffset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, node.payloadSize)
+	if _, err := io.ReadFull(node.src, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// 用完整的box数据(包括box头)替换当前box的内容, 比如修改MovieHeaderBox之后Encode()的输出
+func (node *BoxNode) Replace(boxdata []byte) error {
+	//按原来的位置解析, ilst下的box需要知道父box
+	nodes, err := parseBoxes(boxdata, 0, node.Parent)
+	if err != nil {
+		return err
+	}
+	if len(nodes) != 1 {
+		return fmt.Errorf("expect one box, got %d", len(nodes))
+	}
+	newNode := nodes[0]
+	node.Type = newNode.Type
+	node.UserType = newNode.UserType
+	node.Data = newNode.Data
+	node.Children = newNode.Children
+	for _, child := range node.Children {
+		child.Parent = node
+	}
+	node.lazy = false
+	node.src = nil
+	return nil
+}
+
+func (node *BoxNode) Append(children ...*BoxNode) {
+	for _, child := range children {
+		child.Parent = node
+	}
+	node.Children = append(node.Children, children...)
+}
+
+// 把child插入到ref之前, ref不是node的子box时插入到最后
+func (node *BoxNode) InsertBefore(child *BoxNode, ref *BoxNode) {
+	child.Parent = node
+	for i, c := range node.Children {
+		if c == ref {
+			node.Children = append(node.Children[:i], append([]*BoxNode{child}, node.Children[i:]...)...)
+			return
+		}
+	}
+	node.Children = append(node.Children, child)
+}
+
+// 从父box中删除
+func (node *BoxNode) Remove() {
+	if node.Parent == nil {
+		return
+	}
+	children := node.Parent.Children
+	for i, c := range children {
+		if c == node {
+			node.Parent.Children = append(children[:i:i], children[i+1:]...)
+			break
+		}
+	}
+	node.Parent = nil
+}
+
+// 深度优先遍历, fn返回false时不再遍历该box的子box
+func (node *BoxNode) Walk(fn func(node *BoxNode, depth int) bool) {
+	node.walk(fn, 0)
+}
+
+func (node *BoxNode) walk(fn func(node *BoxNode, depth int) bool, depth int) {
+	for _, child := range node.Children {
+		if fn(child, depth) {
+			child.walk(fn, depth+1)
+		}
+	}
+}
+
+// 按路径查找box, 比如"moov/trak[1]/mdia/mdhd", 下标从0开始, 没有下标时匹配所有同类型的box
+func (node *BoxNode) FindAll(path string) []*BoxNode {
+	nodes := []*BoxNode{node}
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		boxtype, idx, err := parsePathElem(name)
+		if err != nil {
+			return nil
+		}
+		var next []*BoxNode
+		for _, n := range nodes {
+			i := 0
+			for _, child := range n.Children {
+				if child.Type != boxtype {
+					continue
+				}
+				if idx < 0 || idx == i {
+					next = append(next, child)
+				}
+				i++
+			}
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// 第一个匹配的box, 没有时返回nil
+func (node *BoxNode) Find(path string) *BoxNode {
+	if nodes := node.FindAll(path); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return nil
+}
+
+func parsePathElem(elem string) (boxtype [4]byte, idx int, err error) {
+	idx = -1
+	if i := strings.IndexByte(elem, '['); i >= 0 && strings.HasSuffix(elem, "]") {
+		if idx, err = strconv.Atoi(elem[i+1 : len(elem)-1]); err != nil {
+			return
+		}
+		elem = elem[:i]
+	}
+	if len(elem) == 4 {
+		copy(boxtype[:], elem)
+		return
+	}
+	//iTunes的©nam等类型, 按Latin-1转换
+	runes := []rune(elem)
+	if len(runes) != 4 {
+		err = fmt.Errorf("invalid box type %q", elem)
+		return
+	}
+	for i, r := range runes {
+		if r > 0xFF {
+			err = fmt.Errorf("invalid box type %q", elem)
+			return
+		}
+		boxtype[i] = byte(r)
+	}
+	return
+}
+
+// 序列化整个box, 包括box头
+func (node *BoxNode) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := node.write(&buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (tree *BoxTree) Find(path string) *BoxNode {
+	return tree.Root.Find(path)
+}
+
+func (tree *BoxTree) FindAll(path string) []*BoxNode {
+	return tree.Root.FindAll(path)
+}
+
+func (tree *BoxTree) Walk(fn func(node *BoxNode, depth int) bool) {
+	tree.Root.Walk(fn)
+}
+
+// 重新计算所有box的大小后写出, 顶层box的位置变化后(比如moov移到mdat之前),
+// stco/co64/tfhd/tfra中的文件偏移会按新的位置修正, mfro按mfra的实际大小修正
+func (tree *BoxTree) WriteTo(w io.Writer) (int64, error) {
+	remap := tree.offsetRemap()
+	cw := &countWriter{w: w}
+	for _, node := range tree.Root.Children {
+		if err := node.write(cw, remap); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// 源文件中的偏移 -> 写出之后的偏移
+func (tree *BoxTree) offsetRemap() func(uint64) uint64 {
+	type movedBox struct {
+		oldOffset        uint64
+		oldPayloadOffset uint64
+		oldEnd           uint64
+		newOffset        uint64
+		newPayloadOffset uint64
+	}
+	var moved []movedBox
+	pos := uint64(0)
+	for _, node := range tree.Root.Children {
+		payload := node.PayloadSize()
+		if node.fromSource {
+			moved = append(moved, movedBox{
+				oldOffset:        node.Offset,
+				oldPayloadOffset: node.payloadOffset,
+				oldEnd:           node.payloadOffset + node.payloadSize,
+				newOffset:        pos,
+				newPayloadOffset: pos + node.headerLen(payload),
+			})
+		}
+		pos += node.headerLen(payload) + payload
+	}
+	//tfra指向moof的开始, stco指向mdat的内容, box头的长度可能变化
+	return func(offset uint64) uint64 {
+		for _, m := range moved {
+			if offset >= m.oldOffset && offset < m.oldPayloadOffset {
+				return offset - m.oldOffset + m.newOffset
+			} else if offset >= m.oldPayloadOffset && offset < m.oldEnd {
+				return offset - m.oldPayloadOffset + m.newPayloadOffset
+			}
+		}
+		return offset
+	}
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (node *BoxNode) write(w io.Writer, remap func(uint64) uint64) error {
+	payload := node.PayloadSize()
+	size := node.headerLen(payload) + payload
+	hdr := make([]byte, node.headerLen(payload))
+	copy(hdr[4:], node.Type[:])
+	n := 8
+	if node.largeSize || size > 0xFFFFFFFF {
+		binary.BigEndian.PutUint32(hdr, 1)
+		binary.BigEndian.PutUint64(hdr[8:], size)
+		n += 8
+	} else {
+		binary.BigEndian.PutUint32(hdr, uint32(size))
+	}
+	if node.Type == fourcc("uuid") {
+		copy(hdr[n:], node.UserType[:])
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	return node.writePayload(w, remap)
+}
+
+func (node *BoxNode) writePayload(w io.Writer, remap func(uint64) uint64) error {
+	if node.lazy {
+		if _, err := node.src.Seek(int64(node.payloadOffset), io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.CopyN(w, node.src, int64(node.payloadSize))
+		return err
+	}
+	data := node.Data
+	if remap != nil || node.Type == fourcc("mfro") {
+		var err error
+		if data, err = node.fixupData(remap); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	for _, child := range node.Children {
+		if err := child.write(w, remap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errChunkOffsetOverflow = errors.New("chunk offset overflow, stco need to be converted to co64")
+
+// 修正文件偏移, 返回修改后的拷贝, 不修改node.Data
+func (node *BoxNode) fixupData(remap func(uint64) uint64) ([]byte, error) {
+	data := node.Data
+	switch node.Type {
+	case fourcc("stco"), fourcc("co64"):
+		if len(data) < 8 {
+			return data, nil
+		}
+		fixed := append([]byte{}, data...)
+		count := int(binary.BigEndian.Uint32(fixed[4:]))
+		for i, n := 0, 8; i < count; i++ {
+			if node.Type == fourcc("stco") && n+4 <= len(fixed) {
+				offset := remap(uint64(binary.BigEndian.Uint32(fixed[n:])))
+				if offset > 0xFFFFFFFF {
+					return nil, errChunkOffsetOverflow
+				}
+				binary.BigEndian.PutUint32(fixed[n:], uint32(offset))
+				n += 4
+			} else if node.Type == fourcc("co64") && n+8 <= len(fixed) {
+				binary.BigEndian.PutUint64(fixed[n:], remap(binary.BigEndian.Uint64(fixed[n:])))
+				n += 8
+			}
+		}
+		return fixed, nil
+	case fourcc("tfhd"):
+		if len(data) < 16 || data[3]&uint8(TF_FLAG_BASE_DATA_OFFSET) == 0 {
+			return data, nil
+		}
+		fixed := append([]byte{}, data...)
+		binary.BigEndian.PutUint64(fixed[8:], remap(binary.BigEndian.Uint64(fixed[8:])))
+		return fixed, nil
+	case fourcc("tfra"):
+		if len(data) < 16 {
+			return data, nil
+		}
+		fixed := append([]byte{}, data...)
+		lengthSizes := binary.BigEndian.Uint32(fixed[8:])
+		entryLen := int(lengthSizes>>4&0x03+lengthSizes>>2&0x03+lengthSizes&0x03) + 3
+		count := int(binary.BigEndian.Uint32(fixed[12:]))
+		for i, n := 0, 16; i < count; i++ {
+			if fixed[0] == 1 && n+16 <= len(fixed) {
+				binary.BigEndian.PutUint64(fixed[n+8:], remap(binary.BigEndian.Uint64(fixed[n+8:])))
+				n += 16 + entryLen
+			} else if fixed[0] == 0 && n+8 <= len(fixed) {
+				binary.BigEndian.PutUint32(fixed[n+4:], uint32(remap(uint64(binary.BigEndian.Uint32(fixed[n+4:])))))
+				n += 8 + entryLen
+			}
+		}
+		return fixed, nil
+	case fourcc("mfro"):
+		if len(data) < 8 || node.Parent == nil || node.Parent.Type != fourcc("mfra") {
+			return data, nil
+		}
+		fixed := append([]byte{}, data...)
+		binary.BigEndian.PutUint32(fixed[4:], uint32(node.Parent.Size()))
+		return fixed, nil
+	}
+	return data, nil
+}
@@ -0,0 +1,278 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func readAllPackets(t *testing.T, data []byte) []*AVPacket {
+	pkgs, err := readDemuxerPackets(CreateMp4Demuxer(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkgs
+}
+
+// ReadHead之后读出所有packet, 用于需要demuxer选项或者期望出错的测试
+func readDemuxerPackets(demuxer *MovDemuxer) ([]*AVPacket, error) {
+	if _, err := demuxer.ReadHead(); err != nil {
+		return nil, err
+	}
+	var pkgs []*AVPacket
+	for {
+		pkg, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			return pkgs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+}
+
+func writeBoxTree(t *testing.T, tree *BoxTree) []byte {
+	var buf bytes.Buffer
+	n, err := tree.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) || uint64(n) != tree.Root.PayloadSize() {
+		t.Fatalf("WriteTo() = %d, wrote %d bytes, tree size %d", n, buf.Len(), tree.Root.PayloadSize())
+	}
+	return buf.Bytes()
+}
+
+func TestBoxNode_FindAll(t *testing.T) {
+	data := muxTestBuffer(t, boxTreeTestStream)
+	tree, err := ParseBoxTree(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "ftyp", want: []string{"ftyp"}},
+		{path: "/moov/trak[0]/mdia/mdhd", want: []string{"mdhd"}},
+		{path: "moov/trak/mdia/minf/stbl/stsd/alaw", want: []string{"alaw"}},
+		{path: "moov/trak[1]", want: nil},
+		{path: "moov/trak[x]", want: nil},
+		{path: "moov/*", want: nil},
+		{path: "moov/trak/mdia/minf/stbl/stco", want: []string{"stco"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var got []string
+			for _, node := range tree.FindAll(tt.path) {
+				got = append(got, string(node.Type[:]))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindAll(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+	mdat := tree.Find("mdat")
+	if mdat == nil || mdat.Loaded() {
+		t.Fatalf("mdat should not be loaded")
+	}
+	if payload, err := mdat.ReadPayload(); err != nil || len(payload) != 20*160 {
+		t.Errorf("mdat ReadPayload() = %d bytes, err = %v", len(payload), err)
+	}
+	depth := 0
+	tree.Walk(func(node *BoxNode, d int) bool {
+		if d > depth {
+			depth = d
+		}
+		return true
+	})
+	if depth < 6 {
+		t.Errorf("Walk max depth = %d", depth)
+	}
+}
+
+func TestBoxTree_WriteTo(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []MuxerOption
+		edit    func(t *testing.T, tree *BoxTree)
+		check   func(t *testing.T, tree *BoxTree)
+	}{
+		{
+			name: "unchanged",
+			edit: func(t *testing.T, tree *BoxTree) {},
+		},
+		{
+			name:    "unchanged fragment",
+			options: []MuxerOption{WithMp4Flag(MP4_FLAG_FRAGMENT)},
+			edit:    func(t *testing.T, tree *BoxTree) {},
+		},
+		{
+			name: "moov before mdat",
+			edit: func(t *testing.T, tree *BoxTree) {
+				moov := tree.Find("moov")
+				moov.Remove()
+				tree.Root.InsertBefore(moov, tree.Find("mdat"))
+			},
+			check: func(t *testing.T, tree *BoxTree) {
+				if moov, mdat := tree.Find("moov"), tree.Find("mdat"); moov.Offset > mdat.Offset {
+					t.Errorf("moov is not relocated")
+				}
+			},
+		},
+		{
+			name: "unknown and uuid boxes",
+			edit: func(t *testing.T, tree *BoxTree) {
+				uuid := NewBoxNode(fourcc("uuid"), []byte("private data"))
+				uuid.UserType = [16]byte{0x01, 0x02}
+				tree.Root.InsertBefore(uuid, tree.Find("mdat"))
+				tree.Find("moov").Append(NewBoxNode(fourcc("abcd"), bytes.Repeat([]byte{0xff}, 100)))
+				moov := tree.Find("moov")
+				moov.Remove()
+				tree.Root.InsertBefore(moov, uuid)
+			},
+			check: func(t *testing.T, tree *BoxTree) {
+				uuid := tree.Find("uuid")
+				if uuid == nil || uuid.UserType[1] != 0x02 || string(uuid.Data) != "private data" {
+					t.Errorf("uuid box = %+v", uuid)
+				}
+				if abcd := tree.Find("moov/abcd"); abcd == nil || len(abcd.Data) != 100 {
+					t.Errorf("unknown box is lost")
+				}
+			},
+		},
+		{
+			name: "edit mvhd",
+			edit: func(t *testing.T, tree *BoxTree) {
+				node := tree.Find("moov/mvhd")
+				mvhd := NewMovieHeaderBox()
+				if _, err := mvhd.Decode(bytes.NewReader(node.Data)); err != nil {
+					t.Fatal(err)
+				}
+				mvhd.Box.Version = 1
+				mvhd.Creation_time = 0x1122334455
+				_, boxdata := mvhd.Encode()
+				if err := node.Replace(boxdata); err != nil {
+					t.Fatal(err)
+				}
+				node = tree.Find("moov/trak/mdia/mdhd")
+				mdhd := NewMediaHeaderBox()
+				if _, err := mdhd.Decode(bytes.NewReader(node.Data)); err != nil {
+					t.Fatal(err)
+				}
+				mdhd.Language = [3]byte{'e', 'n', 'g'}
+				_, boxdata = mdhd.Encode()
+				if err := node.Replace(boxdata); err != nil {
+					t.Fatal(err)
+				}
+				tree.Find("mdat").Remove()
+				tree.Root.Append(NewBoxNode(fourcc("free"), nil))
+			},
+			check: func(t *testing.T, tree *BoxTree) {
+				mvhd := NewMovieHeaderBox()
+				if _, err := mvhd.Decode(bytes.NewReader(tree.Find("moov/mvhd").Data)); err != nil {
+					t.Fatal(err)
+				}
+				if mvhd.Creation_time != 0x1122334455 || mvhd.Timescale != 1000 {
+					t.Errorf("mvhd creation time = %x timescale = %d", mvhd.Creation_time, mvhd.Timescale)
+				}
+				mdhd := NewMediaHeaderBox()
+				if _, err := mdhd.Decode(bytes.NewReader(tree.Find("moov/trak/mdia/mdhd").Data)); err != nil {
+					t.Fatal(err)
+				}
+				if mdhd.Language != [3]byte{'e', 'n', 'g'} {
+					t.Errorf("mdhd language = %s", mdhd.Language[:])
+				}
+			},
+		},
+		{
+			name:    "strip and insert in fragment",
+			options: []MuxerOption{WithMp4Flag(MP4_FLAG_FRAGMENT)},
+			edit: func(t *testing.T, tree *BoxTree) {
+				tree.Root.InsertBefore(NewBoxNode(fourcc("free"), make([]byte, 1000)), tree.Find("moof"))
+				tree.Find("mfra").InsertBefore(NewBoxNode(fourcc("free"), make([]byte, 10)), tree.Find("mfra/mfro"))
+			},
+			check: func(t *testing.T, tree *BoxTree) {
+				node := tree.Find("mfra/tfra")
+				tfra := NewTrackFragmentRandomAccessBox(0)
+				tfra.Box.Box.Size = node.Size()
+				if _, err := tfra.Decode(bytes.NewReader(node.Data)); err != nil {
+					t.Fatal(err)
+				}
+				moofs := make(map[uint64]bool)
+				for _, moof := range tree.FindAll("moof") {
+					moofs[moof.Offset] = true
+				}
+				if len(tfra.FragEntrys.frags) == 0 {
+					t.Fatalf("tfra has no entry")
+				}
+				for i, entry := range tfra.FragEntrys.frags {
+					if !moofs[entry.moofOffset] {
+						t.Errorf("tfra entry %d moof offset %d is not a moof", i, entry.moofOffset)
+					}
+				}
+				mfra := tree.Find("mfra")
+				if mfro := tree.Find("mfra/mfro"); binary.BigEndian.Uint32(mfro.Data[4:]) != uint32(mfra.Size()) {
+					t.Errorf("mfro = %d, want %d", binary.BigEndian.Uint32(mfro.Data[4:]), mfra.Size())
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := muxTestBuffer(t, boxTreeTestStream, tt.options...)
+			want := readAllPackets(t, data)
+			tree, err := ParseBoxTree(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(t, tree)
+			got := writeBoxTree(t, tree)
+			if tt.check == nil && !bytes.Equal(got, data) {
+				t.Fatalf("unchanged tree is not identical to the source")
+			}
+			newTree, err := ParseBoxTree(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.check != nil {
+				tt.check(t, newTree)
+			}
+			if newTree.Find("mdat") == nil {
+				return
+			}
+			if pkgs := readAllPackets(t, got); !reflect.DeepEqual(pkgs, want) {
+				t.Errorf("demux got %d packets, want %d", len(pkgs), len(want))
+			}
+		})
+	}
+}
+
+func TestBoxTree_LargeSize(t *testing.T) {
+	tests := []struct {
+		name string
+		box  []byte
+		want int
+	}{
+		{name: "64bit size", box: []byte{0, 0, 0, 1, 'f', 'r', 'e', 'e', 0, 0, 0, 0, 0, 0, 0, 20, 1, 2, 3, 4}, want: 20},
+		{name: "size 0 till end", box: []byte{0, 0, 0, 0, 'f', 'r', 'e', 'e', 1, 2, 3, 4}, want: 12},
+		{name: "invalid udta payload", box: []byte{0, 0, 0, 12, 'u', 'd', 't', 'a', 0, 0, 0, 0}, want: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := ParseBoxTree(bytes.NewReader(tt.box))
+			if err != nil {
+				t.Fatal(err)
+			}
+			node := tree.Root.Children[0]
+			if len(node.Data) != 4 || node.Size() != uint64(tt.want) {
+				t.Errorf("box data = %x size = %d, want %d", node.Data, node.Size(), tt.want)
+			}
+			if got := writeBoxTree(t, tree); tt.box[3] != 0 && !bytes.Equal(got, tt.box) {
+				t.Errorf("WriteTo() = %x, want %x", got, tt.box)
+			}
+		})
+	}
+}
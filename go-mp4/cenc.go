@@ -0,0 +1,454 @@
+package mp4
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+// ISO/IEC 23001-7 Common Encryption
+type ProtectionScheme int
+
+const (
+	PROTECTION_SCHEME_CENC ProtectionScheme = iota + 1 //AES-CTR
+	PROTECTION_SCHEME_CBCS                             //AES-CBC, 视频使用1:9 pattern, 音频整块加密
+	PROTECTION_SCHEME_CENS                             //AES-CTR + pattern, 只用于解密
+	PROTECTION_SCHEME_CBC1                             //AES-CBC, 同一个sample内CBC链连续, 只用于解密
+)
+
+func (scheme ProtectionScheme) fourcc() [4]byte {
+	switch scheme {
+	case PROTECTION_SCHEME_CENC:
+		return [4]byte{'c', 'e', 'n', 'c'}
+	case PROTECTION_SCHEME_CBCS:
+		return [4]byte{'c', 'b', 'c', 's'}
+	case PROTECTION_SCHEME_CENS:
+		return [4]byte{'c', 'e', 'n', 's'}
+	case PROTECTION_SCHEME_CBC1:
+		return [4]byte{'c', 'b', 'c', '1'}
+	default:
+		panic("unsupport protection scheme")
+	}
+}
+
+func getProtectionScheme(fourcc [4]byte) ProtectionScheme {
+	for scheme := PROTECTION_SCHEME_CENC; scheme <= PROTECTION_SCHEME_CBC1; scheme++ {
+		if scheme.fourcc() == fourcc {
+			return scheme
+		}
+	}
+	return 0
+}
+
+// 只支持fmp4/dash, 每个sample加密后在traf中写入senc/saiz/saio
+// H264/H265按nalu划分subsample, nalu长度和slice header保持明文
+// AV1/VP9 暂不加密
+func WithEncryption(scheme ProtectionScheme, kid [16]byte, key []byte) MuxerOption {
+	return func(muxer *Movmuxer) {
+		muxer.encryption = &cencEncryption{
+			scheme: scheme,
+			kid:    kid,
+			key:    append([]byte{}, key...),
+		}
+	}
+}
+
+// pssh写入moov和每个moof
+func WithPsshBox(pssh ...PsshBox) MuxerOption {
+	return func(muxer *Movmuxer) {
+		muxer.pssh = append(muxer.pssh, pssh...)
+	}
+}
+
+// 解密使用的content key, KID -> 16字节key
+// 设置之后ReadPacket返回解密后的数据, OnRawSample仍然收到加密的sample
+func WithDecryptionKeys(keys map[[16]byte][]byte) DemuxerOption {
+	return func(demuxer *MovDemuxer) {
+		if demuxer.decryptKeys == nil {
+			demuxer.decryptKeys = make(map[[16]byte]cipher.Block)
+		}
+		for kid, key := range keys {
+			//key不合法时在解密时报错
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				block = nil
+			}
+			demuxer.decryptKeys[kid] = block
+		}
+	}
+}
+
+type cencEncryption struct {
+	scheme     ProtectionScheme
+	kid        [16]byte
+	key        []byte
+	block      cipher.Block
+	constantIV []byte //cbcs所有sample使用同一个IV
+	ivSeed     uint64 //cenc每个track的IV从ivSeed+trackId<<40开始递增, 避免track之间IV重复
+}
+
+func (enc *cencEncryption) init() (err error) {
+	if enc.scheme != PROTECTION_SCHEME_CENC && enc.scheme != PROTECTION_SCHEME_CBCS {
+		return errors.New("unsupport protection scheme")
+	}
+	if enc.block, err = aes.NewCipher(enc.key); err != nil {
+		return err
+	}
+	if enc.block.BlockSize() != 16 || len(enc.key) != 16 {
+		return errors.New("cenc key must be 16 bytes")
+	}
+	iv := make([]byte, 16)
+	if _, err = rand.Read(iv); err != nil {
+		return err
+	}
+	if enc.scheme == PROTECTION_SCHEME_CBCS {
+		enc.constantIV = iv
+	} else {
+		enc.ivSeed = binary.BigEndian.Uint64(iv)
+	}
+	return
+}
+
+func isCencSupported(cid MP4_CODEC_TYPE) bool {
+	return cid == MP4_CODEC_H264 || cid == MP4_CODEC_H265 || isAudio(cid)
+}
+
+// track的tenc默认值
+func (enc *cencEncryption) setupTrack(track *mp4track) {
+	if !isCencSupported(track.cid) {
+		return
+	}
+	track.defaultIsProtected = 1
+	track.defaultKID = enc.kid
+	track.protectionScheme = enc.scheme
+	if enc.scheme == PROTECTION_SCHEME_CENC {
+		track.defaultPerSampleIVSize = 8
+		track.encryptIV = enc.ivSeed + uint64(track.trackId)<<40
+	} else {
+		track.defaultPerSampleIVSize = 0
+		track.defaultConstantIV = enc.constantIV
+		if isVideo(track.cid) {
+			track.defaultCryptByteBlock = 1
+			track.defaultSkipByteBlock = 9
+		}
+	}
+}
+
+func useSubsampleEncryption(track *mp4track) bool {
+	return track.cid == MP4_CODEC_H264 || track.cid == MP4_CODEC_H265
+}
+
+// 加密track缓存中的所有sample, 加密信息追加到track.subSamples
+func (enc *cencEncryption) encryptTrack(track *mp4track) {
+	if track.defaultIsProtected == 0 {
+		return
+	}
+	ws := track.writer.(*fmp4WriterSeeker)
+	for _, sample := range track.samplelist {
+		entry := enc.encryptSample(track, ws.buffer[sample.offset:sample.offset+sample.size])
+		track.subSamples = append(track.subSamples, entry)
+	}
+}
+
+func (enc *cencEncryption) encryptSample(track *mp4track, sample []byte) (entry sencEntry) {
+	var subSamples []subSampleEntry
+	if useSubsampleEncryption(track) {
+		subSamples = track.makeSubsamples(sample, enc.scheme)
+	} else {
+		subSamples = []subSampleEntry{{bytesOfProtectedData: uint32(len(sample))}}
+	}
+
+	iv := make([]byte, 16)
+	if enc.scheme == PROTECTION_SCHEME_CENC {
+		entry.iv = make([]byte, 8)
+		binary.BigEndian.PutUint64(entry.iv, track.encryptIV)
+		track.encryptIV++
+		copy(iv, entry.iv)
+	} else {
+		copy(iv, enc.constantIV)
+	}
+	cryptSample(enc.scheme, enc.block, iv, sample, subSamples, track.defaultCryptByteBlock, track.defaultSkipByteBlock, false)
+	if useSubsampleEncryption(track) {
+		entry.subSamples = subSamples
+	}
+	return
+}
+
+// 加解密一个sample, iv不足16字节的部分补0, subSamples为空时整个sample都是加密部分
+// cenc/cens: CTR的计数器在同一个sample的subsample之间连续
+// cbc1: CBC链在同一个sample的subsample之间连续
+// cbcs: 每个subsample重新使用iv
+// cens/cbcs按crypt:skip加密完整的16字节块, 末尾不足16字节的部分为明文
+func cryptSample(scheme ProtectionScheme, block cipher.Block, iv []byte, sample []byte, subSamples []subSampleEntry, cryptByteBlock, skipByteBlock uint8, decrypt bool) {
+	if len(subSamples) == 0 {
+		subSamples = []subSampleEntry{{bytesOfProtectedData: uint32(len(sample))}}
+	}
+	newCBC := func() cipher.BlockMode {
+		if decrypt {
+			return cipher.NewCBCDecrypter(block, iv)
+		}
+		return cipher.NewCBCEncrypter(block, iv)
+	}
+	var stream cipher.Stream
+	var mode cipher.BlockMode
+	switch scheme {
+	case PROTECTION_SCHEME_CENC, PROTECTION_SCHEME_CENS:
+		stream = cipher.NewCTR(block, iv)
+	case PROTECTION_SCHEME_CBC1:
+		mode = newCBC()
+	}
+	offset := 0
+	for _, sub := range subSamples {
+		offset += int(sub.bytesOfClearData)
+		if offset >= len(sample) {
+			break
+		}
+		end := offset + int(sub.bytesOfProtectedData)
+		if end > len(sample) {
+			end = len(sample)
+		}
+		protected := sample[offset:end]
+		offset = end
+		switch scheme {
+		case PROTECTION_SCHEME_CENC:
+			stream.XORKeyStream(protected, protected)
+		case PROTECTION_SCHEME_CENS:
+			cryptPattern(protected, cryptByteBlock, skipByteBlock, func(blocks []byte) {
+				stream.XORKeyStream(blocks, blocks)
+			})
+		case PROTECTION_SCHEME_CBC1:
+			n := len(protected) / 16 * 16
+			mode.CryptBlocks(protected[:n], protected[:n])
+		case PROTECTION_SCHEME_CBCS:
+			mode = newCBC()
+			cryptPattern(protected, cryptByteBlock, skipByteBlock, func(blocks []byte) {
+				mode.CryptBlocks(blocks, blocks)
+			})
+		}
+	}
+}
+
+// crypt:skip为0:0时所有完整的16字节块都加密
+func cryptPattern(protected []byte, cryptByteBlock, skipByteBlock uint8, crypt func(blocks []byte)) {
+	if cryptByteBlock == 0 && skipByteBlock == 0 {
+		n := len(protected) / 16 * 16
+		crypt(protected[:n])
+		return
+	}
+	cryptSize := int(cryptByteBlock) * 16
+	skipSize := int(skipByteBlock) * 16
+	for offset := 0; len(protected)-offset >= 16; offset += cryptSize + skipSize {
+		n := cryptSize
+		if len(protected)-offset < n {
+			n = (len(protected) - offset) / 16 * 16
+		}
+		crypt(protected[offset : offset+n])
+	}
+}
+
+// 按nalu划分subsample, 非VCL nalu整体明文, VCL nalu的长度字段和slice header明文
+// cenc的加密部分按16字节对齐, 余下的字节并入明文部分
+func (track *mp4track) makeSubsamples(sample []byte, scheme ProtectionScheme) []subSampleEntry {
+	subSamples := make([]subSampleEntry, 0, 2)
+	clear := 0
+	appendSubsample := func(protected int) {
+		for clear > 0xFFFF {
+			subSamples = append(subSamples, subSampleEntry{bytesOfClearData: 0xFFFF})
+			clear -= 0xFFFF
+		}
+		subSamples = append(subSamples, subSampleEntry{bytesOfClearData: uint16(clear), bytesOfProtectedData: uint32(protected)})
+		clear = 0
+	}
+	for offset := 0; offset+4 <= len(sample); {
+		size := int(binary.BigEndian.Uint32(sample[offset:]))
+		if size > len(sample)-offset-4 {
+			size = len(sample) - offset - 4
+		}
+		nalu := sample[offset+4 : offset+4+size]
+		offset += 4 + size
+		headerSize := track.vclHeaderSize(nalu)
+		if headerSize < 0 || headerSize >= size {
+			clear += 4 + size
+			continue
+		}
+		protected := size - headerSize
+		if scheme == PROTECTION_SCHEME_CENC {
+			protected = protected / 16 * 16
+		}
+		if protected == 0 {
+			clear += 4 + size
+			continue
+		}
+		clear += 4 + size - protected
+		appendSubsample(protected)
+	}
+	if clear > 0 || len(subSamples) == 0 {
+		appendSubsample(0)
+	}
+	return subSamples
+}
+
+// 解析过的sps/pps, 用于计算slice header长度
+type cencParamSets struct {
+	h264sps map[uint64]*codec.SPS
+	h264pps map[uint64]*codec.PPS
+	h265sps map[uint64]*codec.H265RawSPS
+	h265pps map[uint64]*codec.H265RawPPS
+}
+
+func newCencParamSets() *cencParamSets {
+	return &cencParamSets{
+		h264sps: make(map[uint64]*codec.SPS),
+		h264pps: make(map[uint64]*codec.PPS),
+		h265sps: make(map[uint64]*codec.H265RawSPS),
+		h265pps: make(map[uint64]*codec.H265RawPPS),
+	}
+}
+
+// 参数集先从extradata中加载, 之后随码流中的sps/pps更新
+func (track *mp4track) loadParamSets() {
+	track.paramSets = newCencParamSets()
+	var annexb []byte
+	if len(track.extraData) > 0 {
+		if track.cid == MP4_CODEC_H264 {
+			spss, ppss := codec.CovertExtradata(track.extraData)
+			for _, ps := range append(spss, ppss...) {
+				annexb = append(annexb, ps...)
+			}
+		} else {
+			hvcc := codec.NewHEVCRecordConfiguration()
+			if !decodeParamSet(func() { hvcc.Decode(track.extraData) }) {
+				return
+			}
+			annexb = hvcc.ToNalus()
+		}
+	} else if extra, ok := track.extra.(*h264ExtraData); ok {
+		//export之后spss/ppss中的startcode会被去掉
+		for _, ps := range append(extra.spss, extra.ppss...) {
+			if start, _ := codec.FindStartCode(ps, 0); start != 0 {
+				annexb = append(annexb, 0x00, 0x00, 0x00, 0x01)
+			}
+			annexb = append(annexb, ps...)
+		}
+	} else if extra, ok := track.extra.(*h265ExtraData); ok {
+		annexb = extra.hvccExtra.ToNalus()
+	}
+	codec.SplitFrame(annexb, func(nalu []byte) bool {
+		track.vclHeaderSize(nalu)
+		return true
+	})
+}
+
+// nalu不带startcode, VCL nalu返回slice header长度, 非VCL返回-1
+func (track *mp4track) vclHeaderSize(nalu []byte) int {
+	if len(nalu) == 0 {
+		return -1
+	}
+	if track.paramSets == nil {
+		track.loadParamSets()
+	}
+	ps := track.paramSets
+	if track.cid == MP4_CODEC_H264 {
+		naluType := codec.H264NaluTypeWithoutStartCode(nalu)
+		switch {
+		case naluType == codec.H264_NAL_SPS:
+			sps := &codec.SPS{}
+			if decodeParamSet(func() { sps.Decode(codec.NewBitStream(codec.CovertRbspToSodb(nalu[1:]))) }) {
+				ps.h264sps[sps.Seq_parameter_set_id] = sps
+			}
+		case naluType == codec.H264_NAL_PPS:
+			pps := &codec.PPS{}
+			if decodeParamSet(func() { pps.Decode(codec.NewBitStream(codec.CovertRbspToSodb(nalu[1:]))) }) {
+				ps.h264pps[pps.Pic_parameter_set_id] = pps
+			}
+		case codec.IsH264VCLNaluType(naluType):
+			var ppsId uint64
+			if !decodeParamSet(func() { ppsId = codec.GetH264SlicePPSId(nalu) }) {
+				return -1
+			}
+			pps, ok := ps.h264pps[ppsId]
+			if !ok {
+				return -1
+			}
+			sps, ok := ps.h264sps[pps.Seq_parameter_set_id]
+			if !ok {
+				return -1
+			}
+			if size, err := codec.H264SliceHeaderSize(nalu, sps, pps); err == nil {
+				return size
+			}
+		}
+		return -1
+	}
+
+	naluType := codec.H265NaluTypeWithoutStartCode(nalu)
+	switch {
+	case naluType == codec.H265_NAL_SPS:
+		sps := &codec.H265RawSPS{}
+		if decodeParamSet(func() { sps.Decode(nalu) }) {
+			ps.h265sps[sps.Sps_seq_parameter_set_id] = sps
+		}
+	case naluType == codec.H265_NAL_PPS:
+		pps := &codec.H265RawPPS{}
+		if decodeParamSet(func() { pps.Decode(nalu) }) {
+			ps.h265pps[pps.Pps_pic_parameter_set_id] = pps
+		}
+	case codec.IsH265VCLNaluType(naluType):
+		var ppsId uint64
+		if !decodeParamSet(func() { ppsId = codec.GetH265SlicePPSId(nalu) }) {
+			return -1
+		}
+		pps, ok := ps.h265pps[ppsId]
+		if !ok {
+			return -1
+		}
+		sps, ok := ps.h265sps[pps.Pps_seq_parameter_set_id]
+		if !ok {
+			return -1
+		}
+		if size, err := codec.H265SliceHeaderSize(nalu, sps, pps); err == nil {
+			return size
+		}
+	}
+	return -1
+}
+
+// 参数集和slice header解析越界时会panic, 解析失败的nalu整体明文
+func decodeParamSet(decode func()) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	decode()
+	return true
+}
+
+func (demuxer *MovDemuxer) decryptSample(track *mp4track, sample []byte, subSample *SubSample) ([]byte, error) {
+	if track.lastSeig != nil && track.lastSeig.IsProtected == 0 {
+		return sample, nil
+	}
+	block, ok := demuxer.decryptKeys[subSample.KID]
+	if !ok {
+		return nil, fmt.Errorf("no decryption key for kid %x", subSample.KID)
+	} else if block == nil {
+		return nil, fmt.Errorf("invalid decryption key for kid %x", subSample.KID)
+	}
+	scheme := track.protectionScheme
+	if scheme == 0 {
+		scheme = PROTECTION_SCHEME_CENC
+	}
+	subSamples := make([]subSampleEntry, len(subSample.Patterns))
+	for i, pattern := range subSample.Patterns {
+		subSamples[i] = subSampleEntry{bytesOfClearData: pattern.BytesClear, bytesOfProtectedData: pattern.BytesProtected}
+	}
+	//sample可能指向chunk缓存, 不能原地解密
+	plain := append([]byte{}, sample...)
+	cryptSample(scheme, block, subSample.IV[:], plain, subSamples, subSample.CryptByteBlock, subSample.SkipByteBlock, true)
+	return plain, nil
+}
@@ -0,0 +1,179 @@
+package mp4
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func Test_cryptSample(t *testing.T) {
+	block, _ := aes.NewCipher([]byte("0123456789abcdef"))
+	iv := []byte("fedcba9876543210")
+	sample := make([]byte, 300)
+	for i := range sample {
+		sample[i] = byte(i)
+	}
+	subSamples := []subSampleEntry{{bytesOfClearData: 10, bytesOfProtectedData: 100}, {bytesOfClearData: 5, bytesOfProtectedData: 185}}
+	tests := []struct {
+		name       string
+		scheme     ProtectionScheme
+		subSamples []subSampleEntry
+		crypt      uint8
+		skip       uint8
+		//加密的字节范围
+		protected [][2]int
+	}{
+		{name: "cenc full sample", scheme: PROTECTION_SCHEME_CENC, protected: [][2]int{{0, 300}}},
+		{name: "cenc", scheme: PROTECTION_SCHEME_CENC, subSamples: subSamples, protected: [][2]int{{10, 110}, {115, 300}}},
+		{name: "cens 1:9", scheme: PROTECTION_SCHEME_CENS, subSamples: subSamples, crypt: 1, skip: 9, protected: [][2]int{{10, 26}, {115, 131}, {275, 291}}},
+		{name: "cbc1", scheme: PROTECTION_SCHEME_CBC1, subSamples: subSamples, protected: [][2]int{{10, 106}, {115, 291}}},
+		{name: "cbcs 1:9", scheme: PROTECTION_SCHEME_CBCS, subSamples: subSamples, crypt: 1, skip: 9, protected: [][2]int{{10, 26}, {115, 131}, {275, 291}}},
+		{name: "cbcs 2:1", scheme: PROTECTION_SCHEME_CBCS, subSamples: subSamples, crypt: 2, skip: 1, protected: [][2]int{{10, 42}, {58, 90}, {115, 147}, {163, 195}, {211, 243}, {259, 291}}},
+		{name: "cbcs 0:0", scheme: PROTECTION_SCHEME_CBCS, subSamples: subSamples, protected: [][2]int{{10, 106}, {115, 291}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte{}, sample...)
+			cryptSample(tt.scheme, block, iv, data, tt.subSamples, tt.crypt, tt.skip, false)
+			encrypted := make([]bool, len(data))
+			for _, r := range tt.protected {
+				for i := r[0]; i < r[1]; i++ {
+					encrypted[i] = true
+				}
+			}
+			for i := 0; i < len(data); i += 16 {
+				end := i + 16
+				if end > len(data) {
+					end = len(data)
+				}
+				//按字节比较可能碰巧相等, 以16字节为单位检查
+				for j := i; j < end; {
+					k := j
+					for k < end && encrypted[k] == encrypted[j] {
+						k++
+					}
+					if changed := !bytes.Equal(data[j:k], sample[j:k]); changed != encrypted[j] {
+						t.Errorf("bytes [%d,%d) encrypted = %v, want %v", j, k, changed, encrypted[j])
+					}
+					j = k
+				}
+			}
+			cryptSample(tt.scheme, block, iv, data, tt.subSamples, tt.crypt, tt.skip, true)
+			if !bytes.Equal(data, sample) {
+				t.Errorf("decrypt() = %x, want %x", data, sample)
+			}
+		})
+	}
+}
+
+// NIST SP 800-38A F.2.1 CBC-AES128和F.5.1 CTR-AES128的测试向量
+func Test_cryptSample_KnownAnswer(t *testing.T) {
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	plain, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+		"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+	ctrIV, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	ctrCipher, _ := hex.DecodeString("874d6191b620e3261bef6864990db6ce9806f66b7970fdff8617187bb9fffdff" +
+		"5ae4df3edbd5d35e5b4f09020db03eab1e031dda2fbe03d1792170a0f3009cee")
+	cbcIV, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	cbcCipher, _ := hex.DecodeString("7649abac8119b246cee98e9b12e9197d5086cb9b507219ee95db113a917678b2" +
+		"73bed6b8e3c1743b7116e69e222295163ff1caa1681fac09120eca307586e1a7")
+	clear := []byte{0x01, 0x02, 0x03}
+	tail := []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF, 0x00}
+	join := func(parts ...[]byte) []byte {
+		var out []byte
+		for _, part := range parts {
+			out = append(out, part...)
+		}
+		return out
+	}
+	tests := []struct {
+		name       string
+		scheme     ProtectionScheme
+		iv         []byte
+		subSamples []subSampleEntry
+		crypt      uint8
+		skip       uint8
+		sample     []byte
+		want       []byte
+	}{
+		{name: "cenc full sample", scheme: PROTECTION_SCHEME_CENC, iv: ctrIV, sample: plain, want: ctrCipher},
+		{
+			//计数器在subsample之间连续
+			name:       "cenc subsamples",
+			scheme:     PROTECTION_SCHEME_CENC,
+			iv:         ctrIV,
+			subSamples: []subSampleEntry{{bytesOfClearData: 3, bytesOfProtectedData: 20}, {bytesOfClearData: 3, bytesOfProtectedData: 44}},
+			sample:     join(clear, plain[:20], clear, plain[20:]),
+			want:       join(clear, ctrCipher[:20], clear, ctrCipher[20:]),
+		},
+		{
+			//每个subsample重新使用iv, 末尾不足16字节为明文
+			name:       "cbcs 0:0",
+			scheme:     PROTECTION_SCHEME_CBCS,
+			iv:         cbcIV,
+			subSamples: []subSampleEntry{{bytesOfClearData: 3, bytesOfProtectedData: 71}, {bytesOfClearData: 3, bytesOfProtectedData: 64}},
+			sample:     join(clear, plain, tail, clear, plain),
+			want:       join(clear, cbcCipher, tail, clear, cbcCipher),
+		},
+		{
+			name:       "cbcs 1:9",
+			scheme:     PROTECTION_SCHEME_CBCS,
+			iv:         cbcIV,
+			subSamples: []subSampleEntry{{bytesOfClearData: 3, bytesOfProtectedData: 64}},
+			crypt:      1,
+			skip:       9,
+			sample:     join(clear, plain),
+			want:       join(clear, cbcCipher[:16], plain[16:]),
+		},
+	}
+	block, _ := aes.NewCipher(key)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte{}, tt.sample...)
+			cryptSample(tt.scheme, block, tt.iv, data, tt.subSamples, tt.crypt, tt.skip, false)
+			if !bytes.Equal(data, tt.want) {
+				t.Errorf("encrypt() = %x, want %x", data, tt.want)
+			}
+			cryptSample(tt.scheme, block, tt.iv, data, tt.subSamples, tt.crypt, tt.skip, true)
+			if !bytes.Equal(data, tt.sample) {
+				t.Errorf("decrypt() = %x, want %x", data, tt.sample)
+			}
+		})
+	}
+}
+
+func Test_makeSubsamples(t *testing.T) {
+	avcc := func(nalus ...[]byte) []byte {
+		var sample []byte
+		for _, nalu := range nalus {
+			sample = append(sample, byte(len(nalu)>>24), byte(len(nalu)>>16), byte(len(nalu)>>8), byte(len(nalu)))
+			sample = append(sample, nalu...)
+		}
+		return sample
+	}
+	sps, pps, slice := testH264SPS[4:], testH264PPS[4:], testH264P[4:]
+	tests := []struct {
+		name   string
+		cid    MP4_CODEC_TYPE
+		sample []byte
+		want   []subSampleEntry
+	}{
+		{name: "h264 slice", cid: MP4_CODEC_H264, sample: avcc(sps, pps, slice),
+			want: []subSampleEntry{{bytesOfClearData: 4 + 8 + 4 + 4 + 4 + 4 + 100%16, bytesOfProtectedData: 96}}},
+		{name: "h264 truncated slice", cid: MP4_CODEC_H264, sample: avcc(sps, pps, slice[:2]),
+			want: []subSampleEntry{{bytesOfClearData: 4 + 8 + 4 + 4 + 4 + 2}}},
+		{name: "h265 truncated slice", cid: MP4_CODEC_H265, sample: avcc([]byte{0x02, 0x01}),
+			want: []subSampleEntry{{bytesOfClearData: 4 + 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := &mp4track{cid: tt.cid}
+			got := track.makeSubsamples(tt.sample, PROTECTION_SCHEME_CENC)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeSubsamples() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
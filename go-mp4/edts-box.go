@@ -158,3 +158,45 @@ func decodeElstBox(demuxer *MovDemuxer) (err error) {
 	track.elst = elst.entrys
 	return
 }
+
+// 将媒体时间(track timescale)映射到展示时间(track timescale)
+// empty edit(media_time == -1)使后面的edit延后播放, media_time之前的sample被裁剪, rate改变播放速度
+// 最后一个edit不限制结束时间, 避免segment_duration取整误差导致末尾的sample被裁剪
+// inEdit == false 表示sample不在任何edit中(例如编码器延迟), 需要解码但不应该显示
+func (track *mp4track) mediaToPresentation(mediaTime int64, movieTimescale uint32) (presentation int64, rate float64, inEdit bool) {
+	if track.elst == nil || len(track.elst.entrys) == 0 {
+		return mediaTime, 1, true
+	}
+	if movieTimescale == 0 {
+		movieTimescale = track.timescale
+	}
+	var start int64
+	var firstStart, firstMediaTime int64 = 0, -1
+	for i, entry := range track.elst.entrys {
+		duration := int64(entry.segmentDuration) * int64(track.timescale) / int64(movieTimescale)
+		if entry.mediaTime == -1 {
+			start += duration
+			continue
+		}
+		if firstMediaTime == -1 {
+			firstStart, firstMediaTime = start, entry.mediaTime
+		}
+		rate = float64(entry.mediaRateInteger) + float64(uint16(entry.mediaRateFraction))/65536
+		if rate == 0 {
+			//dwell, media_time处的sample持续显示segment_duration
+			if mediaTime == entry.mediaTime {
+				return start, 1, true
+			}
+		} else if mediaTime >= entry.mediaTime {
+			last := i == len(track.elst.entrys)-1
+			if last || duration == 0 || mediaTime < entry.mediaTime+int64(float64(duration)*rate) {
+				return start + int64(float64(mediaTime-entry.mediaTime)/rate), rate, true
+			}
+		}
+		start += duration
+	}
+	if firstMediaTime == -1 {
+		return mediaTime + start, 1, true
+	}
+	return firstStart + mediaTime - firstMediaTime, 1, false
+}
@@ -0,0 +1,155 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// aligned(8) class DASHEventMessageBox extends FullBox('emsg', version, flags = 0) {
+//     if (version==0) {
+//         string scheme_id_uri;
+//         string value;
+//         unsigned int(32) timescale;
+//         unsigned int(32) presentation_time_delta;
+//         unsigned int(32) event_duration;
+//         unsigned int(32) id;
+//     } else if (version==1) {
+//         unsigned int(32) timescale;
+//         unsigned int(64) presentation_time;
+//         unsigned int(32) event_duration;
+//         unsigned int(32) id;
+//         string scheme_id_uri;
+//         string value;
+//     }
+//     unsigned int(8) message_data[];
+// }
+
+const (
+	EmsgSchemeSCTE35 = "urn:scte:scte35:2013:bin" //message_data为splice_info_section
+	EmsgSchemeID3    = id3SchemeUri
+)
+
+type EventMessage struct {
+	Version          uint8 //0: PresentationTime是相对于fragment最早展示时间的presentation_time_delta, 1: 绝对时间
+	SchemeIdUri      string
+	Value            string
+	Timescale        uint32
+	PresentationTime uint64
+	EventDuration    uint32 //0xFFFFFFFF表示未知
+	Id               uint32
+	MessageData      []byte
+}
+
+func (msg *EventMessage) Encode() []byte {
+	var payload []byte
+	if msg.Version == 0 {
+		payload = make([]byte, 0, len(msg.SchemeIdUri)+len(msg.Value)+18+len(msg.MessageData))
+		payload = append(append(payload, msg.SchemeIdUri...), 0)
+		payload = append(append(payload, msg.Value...), 0)
+		fields := make([]byte, 16)
+		binary.BigEndian.PutUint32(fields, msg.Timescale)
+		binary.BigEndian.PutUint32(fields[4:], uint32(msg.PresentationTime))
+		binary.BigEndian.PutUint32(fields[8:], msg.EventDuration)
+		binary.BigEndian.PutUint32(fields[12:], msg.Id)
+		payload = append(payload, fields...)
+	} else {
+		payload = make([]byte, 20, 22+len(msg.SchemeIdUri)+len(msg.Value)+len(msg.MessageData))
+		binary.BigEndian.PutUint32(payload, msg.Timescale)
+		binary.BigEndian.PutUint64(payload[4:], msg.PresentationTime)
+		binary.BigEndian.PutUint32(payload[12:], msg.EventDuration)
+		binary.BigEndian.PutUint32(payload[16:], msg.Id)
+		payload = append(append(payload, msg.SchemeIdUri...), 0)
+		payload = append(append(payload, msg.Value...), 0)
+	}
+	payload = append(payload, msg.MessageData...)
+
+	emsg := NewFullBox([4]byte{'e', 'm', 's', 'g'}, msg.Version)
+	emsg.Box.Size = FullBoxLen + uint64(len(payload))
+	offset, boxdata := emsg.Encode()
+	copy(boxdata[offset:], payload)
+	return boxdata
+}
+
+// buf为FullBox头之后的内容
+func (msg *EventMessage) Decode(version uint8, buf []byte) (err error) {
+	msg.Version = version
+	readString := func() (string, error) {
+		i := bytes.IndexByte(buf, 0)
+		if i < 0 {
+			return "", errors.New("emsg string is not null-terminated")
+		}
+		s := string(buf[:i])
+		buf = buf[i+1:]
+		return s, nil
+	}
+	switch version {
+	case 0:
+		if msg.SchemeIdUri, err = readString(); err != nil {
+			return
+		}
+		if msg.Value, err = readString(); err != nil {
+			return
+		}
+		if len(buf) < 16 {
+			return errors.New("emsg box too short")
+		}
+		msg.Timescale = binary.BigEndian.Uint32(buf)
+		msg.PresentationTime = uint64(binary.BigEndian.Uint32(buf[4:]))
+		msg.EventDuration = binary.BigEndian.Uint32(buf[8:])
+		msg.Id = binary.BigEndian.Uint32(buf[12:])
+		buf = buf[16:]
+	case 1:
+		if len(buf) < 20 {
+			return errors.New("emsg box too short")
+		}
+		msg.Timescale = binary.BigEndian.Uint32(buf)
+		msg.PresentationTime = binary.BigEndian.Uint64(buf[4:])
+		msg.EventDuration = binary.BigEndian.Uint32(buf[12:])
+		msg.Id = binary.BigEndian.Uint32(buf[16:])
+		buf = buf[20:]
+		if msg.SchemeIdUri, err = readString(); err != nil {
+			return
+		}
+		if msg.Value, err = readString(); err != nil {
+			return
+		}
+	default:
+		return errors.New("unsupport emsg version")
+	}
+	msg.MessageData = buf
+	return nil
+}
+
+func decodeEmsgBox(demuxer *MovDemuxer, size uint32) (err error) {
+	if size < FullBoxLen {
+		return errors.New("emsg box too short")
+	}
+	fullbox := FullBox{}
+	if _, err = fullbox.Decode(demuxer.reader); err != nil {
+		return
+	}
+	buf := make([]byte, size-FullBoxLen)
+	if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+		return
+	}
+	if demuxer.OnEventMessage == nil {
+		return
+	}
+	msg := EventMessage{}
+	//无法解析的emsg忽略
+	if msg.Decode(fullbox.Version, buf) == nil {
+		demuxer.OnEventMessage(msg)
+	}
+	return
+}
+
+// 在下一个fragment的moof之前写入emsg, 只对fmp4有效
+func (muxer *Movmuxer) AddEventMessage(msg EventMessage) error {
+	if !muxer.movFlag.isFragment() && !muxer.movFlag.isDash() {
+		return errors.New("emsg only support fmp4")
+	}
+	muxer.eventMessages = append(muxer.eventMessages, msg)
+	return nil
+}
@@ -0,0 +1,93 @@
+package mp4
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEventMessage_Decode(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  EventMessage
+	}{
+		{
+			name: "version 0",
+			msg:  EventMessage{SchemeIdUri: "urn:example", Value: "1", Timescale: 90000, PresentationTime: 180000, EventDuration: 0xFFFFFFFF, Id: 7, MessageData: []byte{1, 2}},
+		},
+		{
+			name: "version 1 scte35",
+			msg:  EventMessage{Version: 1, SchemeIdUri: EmsgSchemeSCTE35, Timescale: 1000, PresentationTime: 0x100000000, EventDuration: 30000, Id: 1, MessageData: []byte{0xfc, 0x30}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boxdata := tt.msg.Encode()
+			var got EventMessage
+			if err := got.Decode(boxdata[8], boxdata[FullBoxLen:]); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.msg)
+			}
+			if err := got.Decode(tt.msg.Version, boxdata[FullBoxLen:FullBoxLen+4]); err == nil {
+				t.Errorf("truncated emsg should fail")
+			}
+		})
+	}
+}
+
+func TestMuxEventMessage(t *testing.T) {
+	ws := newFmp4WriterSeeker(1024)
+	muxer, err := CreateMp4Muxer(ws, WithMp4Flag(MP4_FLAG_FRAGMENT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tid := muxer.AddAudioTrack(MP4_CODEC_G711A, WithAudioChannelCount(1), WithAudioSampleRate(8000))
+	var want []EventMessage
+	for i := 0; i < 3; i++ {
+		if err := muxer.Write(tid, make([]byte, 160), uint64(i*20), uint64(i*20)); err != nil {
+			t.Fatal(err)
+		}
+		msg := EventMessage{Version: 1, SchemeIdUri: EmsgSchemeSCTE35, Timescale: 1000, PresentationTime: uint64(i * 20), Id: uint32(i), MessageData: []byte{byte(i)}}
+		want = append(want, msg)
+		if err := muxer.FlushFragment(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := ParseBoxTree(bytes.NewReader(ws.buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, node := range tree.Root.Children {
+		if node.Type == fourcc("emsg") && tree.Root.Children[i+1].Type != fourcc("moof") {
+			t.Errorf("emsg is not followed by moof")
+		}
+	}
+
+	var got []EventMessage
+	demuxer := CreateFmp4StreamDemuxer(bytes.NewReader(ws.buffer))
+	demuxer.OnEventMessage = func(msg EventMessage) {
+		got = append(got, msg)
+	}
+	if _, err := demuxer.ReadHead(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := demuxer.ReadPacket(); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != i+1 {
+			t.Fatalf("got %d emsg after %d packets", len(got), i+1)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("emsg = %+v, want %+v", got, want)
+	}
+	if muxer, _ = CreateMp4Muxer(newFmp4WriterSeeker(1024)); muxer.AddEventMessage(want[0]) == nil {
+		t.Errorf("AddEventMessage should fail for non-fragment mp4")
+	}
+}
@@ -148,6 +148,16 @@ func decodeESDescriptor(esd []byte, track *mp4track) (vosData []byte) {
 	}
 	if track.cid == MP4_CODEC_AAC {
 		track.extra = new(aacExtraData)
+		//HE-AAC的sample entry中一般填的是核心编码的采样率, 以AudioSpecificConfig为准
+		asc := codec.NewAudioSpecificConfiguration()
+		if asc.Decode(vosData) == nil {
+			if rate := asc.SampleRate(); rate > 0 {
+				track.sampleRate = uint32(rate)
+			}
+			if channels := asc.ChannelCount(); channels > 0 {
+				track.chanelCount = uint8(channels)
+			}
+		}
 	}
 	return
 }
@@ -0,0 +1,183 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// moov写在mdat之前, 方便HTTP渐进式播放, 只对非fmp4有效
+// reserve为在mdat之前给moov预留的空间, moov放不下(或者reserve为0)时, 在WriteTrailer中把mdat向后移动,
+// 这需要writer实现io.ReadWriteSeeker, 否则moov仍然写在最后
+func WithFastStart(reserve uint32) MuxerOption {
+	return func(muxer *Movmuxer) {
+		muxer.fastStart = true
+		if reserve > 0 && reserve < BasicBoxLen {
+			reserve = BasicBoxLen
+		}
+		muxer.moovReserve = reserve
+	}
+}
+
+func (muxer *Movmuxer) writeMoovReserve() (err error) {
+	if muxer.reserveOffset, err = muxer.writer.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+	free := NewFreeBox()
+	free.Data = make([]byte, muxer.moovReserve-BasicBoxLen)
+	_, boxdata := free.Encode()
+	_, err = muxer.writer.Write(boxdata)
+	return
+}
+
+func (muxer *Movmuxer) writeFastStartMoov() error {
+	end, err := muxer.writer.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	var moov bytes.Buffer
+	if err = muxer.writeMoov(&moov); err != nil {
+		return err
+	}
+	reserve := int64(muxer.moovReserve)
+	if reserve > 0 && (int64(moov.Len()) == reserve || int64(moov.Len())+BasicBoxLen <= reserve) {
+		return muxer.writeMoovAt(muxer.reserveOffset, moov.Bytes(), reserve, end)
+	}
+	rws, ok := muxer.writer.(io.ReadWriteSeeker)
+	if !ok {
+		//不能移动mdat, moov只能写在最后
+		_, err = muxer.writer.Write(moov.Bytes())
+		return err
+	}
+
+	//moov的大小和chunk offset有关(stco是否需要换成co64), 重新计算直到移动的距离不再变化
+	delta := int64(0)
+	for {
+		need := int64(moov.Len()) - reserve
+		if need < 0 {
+			//剩下的空间不够放一个free box
+			need = int64(moov.Len()) + BasicBoxLen - reserve
+		}
+		if need == delta {
+			break
+		}
+		delta = need
+		for _, track := range muxer.tracks {
+			track.chunkOffsetDelta = uint64(delta)
+		}
+		moov.Reset()
+		if err = muxer.writeMoov(&moov); err != nil {
+			return err
+		}
+	}
+	//mdatOffset之前的8字节free是给64位mdat size预留的, 一起移动
+	moveStart := int64(muxer.mdatOffset) - BasicBoxLen
+	if err = moveData(rws, moveStart, end, delta); err != nil {
+		return err
+	}
+	return muxer.writeMoovAt(moveStart-reserve, moov.Bytes(), reserve+delta, end+delta)
+}
+
+// 在offset处写入moov, 剩下的空间用free填充, 最后回到文件末尾
+func (muxer *Movmuxer) writeMoovAt(offset int64, moov []byte, space int64, end int64) (err error) {
+	if _, err = muxer.writer.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+	if _, err = muxer.writer.Write(moov); err != nil {
+		return
+	}
+	if space > int64(len(moov)) {
+		free := NewFreeBox()
+		free.Data = make([]byte, space-int64(len(moov))-BasicBoxLen)
+		_, boxdata := free.Encode()
+		if _, err = muxer.writer.Write(boxdata); err != nil {
+			return
+		}
+	}
+	_, err = muxer.writer.Seek(end, io.SeekStart)
+	return
+}
+
+// 从后往前把[start, end)移动到start+delta
+func moveData(rws io.ReadWriteSeeker, start, end, delta int64) error {
+	buf := make([]byte, 1024*1024)
+	for pos := end; pos > start; {
+		n := int64(len(buf))
+		if pos-start < n {
+			n = pos - start
+		}
+		pos -= n
+		if _, err := rws.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(rws, buf[:n]); err != nil {
+			return err
+		}
+		if _, err := rws.Seek(pos+delta, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := rws.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 把已有的mp4改成moov在mdat之前, 不重新封装sample, 只修正chunk offset, 32位放不下时stco转换为co64
+// r是源文件, w是新文件, 不能是同一个文件
+func FastStart(r io.ReadSeeker, w io.Writer) error {
+	tree, err := ParseBoxTree(r)
+	if err != nil {
+		return err
+	}
+	moov := tree.Find("moov")
+	if moov == nil {
+		return errors.New("moov box not found")
+	}
+	for _, node := range tree.Root.Children {
+		if node == moov {
+			break
+		}
+		if node.Type == fourcc("mdat") {
+			moov.Remove()
+			tree.Root.InsertBefore(moov, node)
+			break
+		}
+	}
+	for promoteChunkOffsets(tree) {
+	}
+	_, err = tree.WriteTo(w)
+	return err
+}
+
+// 移动之后超过32位的stco转换为co64, 返回是否有转换
+func promoteChunkOffsets(tree *BoxTree) bool {
+	remap := tree.offsetRemap()
+	promoted := false
+	for _, stco := range tree.FindAll("moov/trak/mdia/minf/stbl/stco") {
+		if len(stco.Data) < 8 {
+			continue
+		}
+		count := int(binary.BigEndian.Uint32(stco.Data[4:]))
+		if len(stco.Data) < 8+4*count {
+			continue
+		}
+		overflow := false
+		for i := 0; i < count && !overflow; i++ {
+			overflow = remap(uint64(binary.BigEndian.Uint32(stco.Data[8+4*i:]))) > 0xFFFFFFFF
+		}
+		if !overflow {
+			continue
+		}
+		data := make([]byte, 8+8*count)
+		copy(data[4:8], stco.Data[4:8])
+		for i := 0; i < count; i++ {
+			binary.BigEndian.PutUint64(data[8+8*i:], uint64(binary.BigEndian.Uint32(stco.Data[8+4*i:])))
+		}
+		stco.Type = fourcc("co64")
+		stco.Data = data
+		promoted = true
+	}
+	return promoted
+}
@@ -0,0 +1,139 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 60s音频, moov足够大
+var fastStartTestStream = muxTestStream{audioFrames: 3000, varySize: true}
+
+func topLevelBoxes(t *testing.T, data []byte) []string {
+	tree, err := ParseBoxTree(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, node := range tree.Root.Children {
+		types = append(types, string(node.Type[:]))
+	}
+	return types
+}
+
+func TestWithFastStart(t *testing.T) {
+	data := muxTestBuffer(t, fastStartTestStream)
+	want := readAllPackets(t, data)
+
+	tests := []struct {
+		name     string
+		reserve  uint32
+		readable bool
+		wantErr  bool
+		want     []string
+	}{
+		{name: "reserve enough", reserve: 64 * 1024, want: []string{"ftyp", "moov", "free", "free", "mdat"}},
+		{name: "reserve too small", reserve: 100, want: []string{"ftyp", "free", "free", "mdat", "moov"}},
+		{name: "second pass", readable: true, want: []string{"ftyp", "moov", "free", "mdat"}},
+		{name: "reserve too small second pass", reserve: 100, readable: true, want: []string{"ftyp", "moov", "free", "mdat"}},
+		{name: "no reserve unreadable writer", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data []byte
+			if tt.readable {
+				f, err := os.Create(filepath.Join(t.TempDir(), "faststart.mp4"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				muxTestFile(t, f, fastStartTestStream, WithFastStart(tt.reserve))
+				if data, err = os.ReadFile(f.Name()); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				ws := newFmp4WriterSeeker(1024)
+				muxer, err := CreateMp4Muxer(ws, WithFastStart(tt.reserve))
+				if err == nil {
+					writeMuxTestStream(t, muxer, fastStartTestStream)
+					err = muxer.WriteTrailer()
+				}
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("mux err = %v, wantErr %v", err, tt.wantErr)
+				}
+				data = ws.buffer
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := topLevelBoxes(t, data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("boxes = %v, want %v", got, tt.want)
+			}
+			if pkgs := readAllPackets(t, data); !reflect.DeepEqual(pkgs, want) {
+				t.Errorf("demux got %d packets, want %d", len(pkgs), len(want))
+			}
+		})
+	}
+}
+
+func TestFastStart(t *testing.T) {
+	data := muxTestBuffer(t, fastStartTestStream)
+	want := readAllPackets(t, data)
+	var out bytes.Buffer
+	if err := FastStart(bytes.NewReader(data), &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := topLevelBoxes(t, out.Bytes()); !reflect.DeepEqual(got, []string{"ftyp", "free", "moov", "mdat"}) {
+		t.Errorf("boxes = %v", got)
+	}
+	if pkgs := readAllPackets(t, out.Bytes()); !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("demux got %d packets, want %d", len(pkgs), len(want))
+	}
+	//已经是faststart的文件不变
+	var again bytes.Buffer
+	if err := FastStart(bytes.NewReader(out.Bytes()), &again); err != nil || !bytes.Equal(again.Bytes(), out.Bytes()) {
+		t.Errorf("FastStart() on faststart file changed it, err = %v", err)
+	}
+	if err := FastStart(bytes.NewReader(data[:40]), &again); err == nil {
+		t.Errorf("FastStart() without moov should fail")
+	}
+}
+
+func Test_promoteChunkOffsets(t *testing.T) {
+	stcoData := make([]byte, 16)
+	binary.BigEndian.PutUint32(stcoData[4:], 2)
+	binary.BigEndian.PutUint32(stcoData[8:], 16)
+	binary.BigEndian.PutUint32(stcoData[12:], 0xFFFFFFE0)
+	moov := NewBoxNode(fourcc("moov"), nil)
+	stbl := NewBoxNode(fourcc("stbl"), nil)
+	stbl.Append(NewBoxNode(fourcc("stco"), stcoData))
+	minf := NewBoxNode(fourcc("minf"), nil)
+	minf.Append(stbl)
+	mdia := NewBoxNode(fourcc("mdia"), nil)
+	mdia.Append(minf)
+	trak := NewBoxNode(fourcc("trak"), nil)
+	trak.Append(mdia)
+	moov.Append(trak)
+	//mdat内容从16开始, 不读入内存
+	mdat := &BoxNode{Type: fourcc("mdat"), Offset: 0, largeSize: true, fromSource: true, lazy: true, payloadOffset: 16, payloadSize: 0xFFFFFFF0}
+	tree := &BoxTree{Root: &BoxNode{}}
+	tree.Root.Append(moov, mdat)
+
+	if !promoteChunkOffsets(tree) || promoteChunkOffsets(tree) {
+		t.Fatalf("stco should be promoted once")
+	}
+	co64 := tree.Find("moov/trak/mdia/minf/stbl/co64")
+	if co64 == nil || len(co64.Data) != 24 {
+		t.Fatalf("co64 = %+v", co64)
+	}
+	remap := tree.offsetRemap()
+	shift := moov.Size()
+	for i, want := range []uint64{16 + shift, 0xFFFFFFE0 + shift} {
+		if got := remap(binary.BigEndian.Uint64(co64.Data[8+8*i:])); got != want {
+			t.Errorf("chunk %d offset = %x, want %x", i, got, want)
+		}
+	}
+}
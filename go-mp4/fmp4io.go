@@ -55,3 +55,35 @@ func (fws *fmp4WriterSeeker) Seek(offset int64, whence int) (int64, error) {
 		return 0, errors.New("unsupport SeekEnd")
 	}
 }
+
+// 只能向前读的io.Reader, Seek只支持获取当前位置和向前跳过
+type forwardReader struct {
+	r   io.Reader
+	pos int64
+}
+
+func (fr *forwardReader) Read(p []byte) (n int, err error) {
+	n, err = fr.r.Read(p)
+	fr.pos += int64(n)
+	return
+}
+
+func (fr *forwardReader) Seek(offset int64, whence int) (int64, error) {
+	target := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		target += fr.pos
+	default:
+		return fr.pos, errors.New("forward only reader unsupport SeekEnd")
+	}
+	if target < fr.pos {
+		return fr.pos, errors.New("forward only reader can not seek backward")
+	}
+	if target > fr.pos {
+		if _, err := io.CopyN(io.Discard, fr, target-fr.pos); err != nil {
+			return fr.pos, err
+		}
+	}
+	return fr.pos, nil
+}
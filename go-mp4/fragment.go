@@ -0,0 +1,350 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// fmp4的切分方式
+type FragmentMode int
+
+const (
+	FRAGMENT_BY_GOP      FragmentMode = iota //每个视频关键帧开始一个新的fragment(默认), 需要MP4_FLAG_KEYFRAME
+	FRAGMENT_BY_DURATION                     //时长达到目标值之后在下一个视频关键帧切分, 每个fragment都可以独立解码
+	FRAGMENT_BY_CHUNK                        //时长达到目标值之后立即切分, 不等关键帧, 用于低延迟的CMAF chunk
+	FRAGMENT_BY_SIZE                         //mdat达到目标字节数之后切分
+	FRAGMENT_MANUAL                          //只在调用FlushFragment时切分
+)
+
+// target: FRAGMENT_BY_DURATION/FRAGMENT_BY_CHUNK为ms, FRAGMENT_BY_SIZE为字节
+// 存在视频track时只由视频track触发切分
+func WithFragmentMode(mode FragmentMode, target uint32) MuxerOption {
+	return func(muxer *Movmuxer) {
+		muxer.fragMode = mode
+		muxer.fragTarget = target
+	}
+}
+
+// 一个完整的segment: [styp][sidx][prft][emsg] moof mdat
+type FragmentSegment struct {
+	TrackId        uint32 //MP4_FLAG_SEPARATE_MOOF时为segment所属的track, 否则为0
+	SequenceNumber uint32 //mfhd sequence_number
+	StartDts       uint64 //ms
+	Duration       uint32 //ms
+	Independent    bool   //以关键帧开始, 可以独立解码
+	Data           []byte
+}
+
+type OnSegment func(seg *FragmentSegment) error
+
+// 设置之后segment只交给回调, 不再写入writer, WriteTrailer也不写mfra, init segment通过WriteInitSegment获取
+func WithSegmentCallback(onSegment OnSegment) MuxerOption {
+	return func(muxer *Movmuxer) {
+		muxer.onSegment = onSegment
+	}
+}
+
+// 每个moof之前写入prft, 记录第一个sample对应的墙上时间, clock为nil时使用time.Now
+func WithPrft(clock func() time.Time) MuxerOption {
+	return func(muxer *Movmuxer) {
+		if clock == nil {
+			clock = time.Now
+		}
+		muxer.prftClock = clock
+	}
+}
+
+func (muxer *Movmuxer) trackList() []*mp4track {
+	tracks := make([]*mp4track, 0, len(muxer.tracks))
+	for i := uint32(1); i < muxer.nextTrackId; i++ {
+		tracks = append(tracks, muxer.tracks[i])
+	}
+	return tracks
+}
+
+// 非视频的sample写入时立即进入samplelist, 在写入之前判断(dts/size为将要写入的sample)
+// 视频的sample缓存在lastSample中, 在写入之后判断, 缓存的sample进入下一个fragment
+func (muxer *Movmuxer) shouldFlushFragment(track *mp4track, dts uint64, size int) bool {
+	if !isVideo(track.cid) {
+		for _, t := range muxer.tracks {
+			if isVideo(t.cid) {
+				return false
+			}
+		}
+	}
+	switch muxer.fragMode {
+	case FRAGMENT_BY_GOP:
+		return isVideo(track.cid) && muxer.movFlag.has(MP4_FLAG_KEYFRAME) && track.lastSample.isKey && track.duration > 0
+	case FRAGMENT_BY_DURATION, FRAGMENT_BY_CHUNK:
+		if len(track.samplelist) == 0 {
+			return false
+		}
+		if isVideo(track.cid) {
+			if !track.lastSample.hasVcl || (muxer.fragMode == FRAGMENT_BY_DURATION && !track.lastSample.isKey) {
+				return false
+			}
+			dts = track.lastSample.dts
+		}
+		first := track.samplelist[0].dts
+		return dts >= first && (dts-first)*1000 >= uint64(muxer.fragTarget)*uint64(track.timescale)
+	case FRAGMENT_BY_SIZE:
+		if isVideo(track.cid) && !track.lastSample.hasVcl {
+			return false
+		}
+		pending := 0
+		for _, t := range muxer.tracks {
+			pending += len(t.writer.(*fmp4WriterSeeker).buffer)
+		}
+		return pending > 0 && pending+size >= int(muxer.fragTarget)
+	}
+	return false
+}
+
+func (muxer *Movmuxer) flushFragment() (err error) {
+	if muxer.movFlag.isFragment() && muxer.onSegment == nil && muxer.nextFragmentId == 1 {
+		//first fragment ,write moov
+		if _, err = muxer.writer.Write(muxer.makeFragmentFtyp()); err != nil {
+			return err
+		}
+		if err = muxer.writeMoov(muxer.writer); err != nil {
+			return err
+		}
+	}
+	tracks := muxer.trackList()
+	if muxer.encryption != nil {
+		for _, track := range tracks {
+			muxer.encryption.encryptTrack(track)
+		}
+	}
+	if muxer.movFlag.has(MP4_FLAG_SEPARATE_MOOF) {
+		for _, track := range tracks {
+			if len(track.samplelist) > 0 {
+				if err = muxer.writeSegment([]*mp4track{track}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, track := range tracks {
+		if len(track.samplelist) > 0 {
+			return muxer.writeSegment(tracks)
+		}
+	}
+	return nil
+}
+
+func (muxer *Movmuxer) makeFragmentFtyp() []byte {
+	brands := []uint32{mov_tag(iso5), mov_tag(iso6), mov_tag(mp41)}
+	if muxer.movFlag.has(MP4_FLAG_CMAF) {
+		brands = append(brands, mov_tag(cmfc))
+	}
+	return makeFtypBox(mov_tag(iso5), 0x200, brands)
+}
+
+// CMAF segment以关键帧开始, 否则为chunk
+func (muxer *Movmuxer) makeSegmentStyp(independent bool) []byte {
+	if !muxer.movFlag.has(MP4_FLAG_CMAF) {
+		return makeStypBox(mov_tag(msdh), 0, []uint32{mov_tag(msdh), mov_tag(msix)})
+	}
+	major := cmfl
+	if independent {
+		major = cmfs
+	}
+	return makeStypBox(mov_tag(major), 0, []uint32{mov_tag(major), mov_tag(cmff), mov_tag(msdh), mov_tag(msix)})
+}
+
+// 第一个有sample的视频track作为参考, 没有视频时为第一个有sample的track
+func referenceTrack(tracks []*mp4track) *mp4track {
+	var ref *mp4track
+	for _, track := range tracks {
+		if len(track.samplelist) == 0 {
+			continue
+		}
+		if isVideo(track.cid) {
+			return track
+		}
+		if ref == nil {
+			ref = track
+		}
+	}
+	return ref
+}
+
+func (track *mp4track) startsWithSAP() bool {
+	return !isVideo(track.cid) || track.samplelist[0].isKeyFrame
+}
+
+// 和trun中写入的sample_duration一致
+func (track *mp4track) sampleDuration(i int) uint32 {
+	if i < len(track.samplelist)-1 {
+		return uint32(track.samplelist[i+1].dts - track.samplelist[i].dts)
+	}
+	if track.lastSample != nil && track.lastSample.dts != 0 {
+		return uint32(track.lastSample.dts - track.samplelist[i].dts)
+	}
+	return track.defaultDuration
+}
+
+func (track *mp4track) fragmentDuration() uint64 {
+	if len(track.samplelist) == 0 {
+		return 0
+	}
+	last := len(track.samplelist) - 1
+	return track.samplelist[last].dts - track.samplelist[0].dts + uint64(track.sampleDuration(last))
+}
+
+const sidxBoxLen = FullBoxLen + 28 + 12
+
+func (muxer *Movmuxer) writeSegment(tracks []*mp4track) (err error) {
+	var pos int64
+	if muxer.onSegment == nil {
+		if pos, err = muxer.writer.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+	ref := referenceTrack(tracks)
+	var styp, prft, emsgs []byte
+	var sidxTracks []*mp4track
+	if muxer.movFlag.isDash() || muxer.movFlag.has(MP4_FLAG_CMAF) {
+		styp = muxer.makeSegmentStyp(ref.startsWithSAP())
+		for _, track := range tracks {
+			if len(track.samplelist) > 0 {
+				sidxTracks = append(sidxTracks, track)
+			}
+		}
+	}
+	if muxer.prftClock != nil {
+		prft = makePrftBox(ref, muxer.prftClock())
+	}
+	for i := range muxer.eventMessages {
+		emsgs = append(emsgs, muxer.eventMessages[i].Encode()...)
+	}
+	muxer.eventMessages = muxer.eventMessages[:0]
+	moofOffset := pos + int64(len(styp)+len(sidxTracks)*sidxBoxLen+len(prft)+len(emsgs))
+
+	var mdatlen uint64 = 0
+	for _, track := range tracks {
+		for j := 0; j < len(track.samplelist); j++ {
+			track.samplelist[j].offset += mdatlen
+		}
+		mdatlen += uint64(len(track.writer.(*fmp4WriterSeeker).buffer))
+	}
+	mdatlen += 8
+
+	//先计算moof的大小, 再写入trun中的data_offset
+	mfhd := makeMfhdBox(muxer.nextFragmentId)
+	pssh := muxer.makePsshBoxes()
+	moofSize := 8 + len(mfhd) + len(pssh)
+	for _, track := range tracks {
+		moofSize += len(makeTraf(track, uint64(moofOffset), uint64(0), 0))
+	}
+	trafs := make([][]byte, len(tracks))
+	trafOffset := 8 + len(mfhd) + len(pssh)
+	for i, track := range tracks {
+		trafs[i] = makeTraf(track, uint64(moofOffset), uint64(moofSize+8), uint64(trafOffset)) //moofSize + 8(mdat box)
+		trafOffset += len(trafs[i])
+	}
+	seg := &FragmentSegment{
+		SequenceNumber: muxer.nextFragmentId,
+		StartDts:       ref.samplelist[0].dts * 1000 / uint64(ref.timescale),
+		Duration:       uint32(ref.fragmentDuration() * 1000 / uint64(ref.timescale)),
+		Independent:    ref.startsWithSAP(),
+	}
+	if len(tracks) == 1 {
+		seg.TrackId = tracks[0].trackId
+	}
+	muxer.nextFragmentId++
+
+	moof := BasicBox{Type: [4]byte{'m', 'o', 'o', 'f'}}
+	moof.Size = uint64(moofSize)
+	offset, moofBox := moof.Encode()
+	copy(moofBox[offset:], mfhd)
+	offset += len(mfhd)
+	copy(moofBox[offset:], pssh)
+	offset += len(pssh)
+	for i := range trafs {
+		copy(moofBox[offset:], trafs[i])
+		offset += len(trafs[i])
+	}
+
+	mdat := BasicBox{Type: [4]byte{'m', 'd', 'a', 't'}}
+	mdat.Size = 8
+	_, mdatBox := mdat.Encode()
+	binary.BigEndian.PutUint32(mdatBox, uint32(mdatlen))
+
+	//sidx的first_offset为sidx之后到moof的距离
+	parts := [][]byte{styp}
+	for i, track := range sidxTracks {
+		firstOffset := uint64((len(sidxTracks)-1-i)*sidxBoxLen + len(prft) + len(emsgs))
+		parts = append(parts, makeSidxBox(track, firstOffset, uint32(len(moofBox))+uint32(mdatlen)))
+	}
+	parts = append(parts, prft, emsgs, moofBox, mdatBox)
+	for _, track := range tracks {
+		parts = append(parts, track.writer.(*fmp4WriterSeeker).buffer)
+	}
+	if muxer.onSegment != nil {
+		size := 0
+		for _, part := range parts {
+			size += len(part)
+		}
+		seg.Data = make([]byte, 0, size)
+		for _, part := range parts {
+			seg.Data = append(seg.Data, part...)
+		}
+		err = muxer.onSegment(seg)
+	} else {
+		for _, part := range parts {
+			if _, err = muxer.writer.Write(part); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, track := range tracks {
+		if len(track.samplelist) > 0 {
+			last := len(track.samplelist) - 1
+			track.fragments = append(track.fragments, movFragment{
+				offset:   uint64(moofOffset),
+				duration: track.duration,
+				firstDts: track.samplelist[0].dts,
+				firstPts: track.samplelist[0].pts,
+				lastPts:  track.samplelist[last].pts,
+				lastDts:  track.samplelist[last].dts,
+			})
+		}
+		ws := track.writer.(*fmp4WriterSeeker)
+		ws.buffer = ws.buffer[:0]
+		ws.offset = 0
+		track.clearSamples()
+	}
+	return nil
+}
+
+// aligned(8) class ProducerReferenceTimeBox extends FullBox('prft', version, flags) {
+//     unsigned int(32) reference_track_ID;
+//     unsigned int(64) ntp_timestamp;
+//     if (version==0) {
+//         unsigned int(32) media_time;
+//     } else {
+//         unsigned int(64) media_time;
+//     }
+// }
+
+// 1900-01-01到1970-01-01的秒数
+const ntpEpochOffset = 2208988800
+
+func makePrftBox(track *mp4track, now time.Time) []byte {
+	prft := NewFullBox([4]byte{'p', 'r', 'f', 't'}, 1)
+	prft.Box.Size = FullBoxLen + 20
+	offset, boxdata := prft.Encode()
+	binary.BigEndian.PutUint32(boxdata[offset:], track.trackId)
+	ntp := uint64(now.Unix()+ntpEpochOffset)<<32 | uint64(now.Nanosecond())<<32/1e9
+	binary.BigEndian.PutUint64(boxdata[offset+4:], ntp)
+	binary.BigEndian.PutUint64(boxdata[offset+12:], track.samplelist[0].dts)
+	return boxdata
+}
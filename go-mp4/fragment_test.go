@@ -0,0 +1,129 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 40ms一帧的h264 + 20ms一帧的g711a, 每gop帧一个idr
+func fragmentTestStream(frames, gop int) muxTestStream {
+	return muxTestStream{videoFrames: frames, gop: gop}
+}
+
+func TestWithFragmentMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     FragmentMode
+		target   uint32
+		gop      int
+		wantMoof int
+	}{
+		{name: "gop", mode: FRAGMENT_BY_GOP, gop: 10, wantMoof: 3},
+		{name: "duration", mode: FRAGMENT_BY_DURATION, target: 500, gop: 5, wantMoof: 2},
+		{name: "chunk", mode: FRAGMENT_BY_CHUNK, target: 200, gop: 30, wantMoof: 6},
+		{name: "size", mode: FRAGMENT_BY_SIZE, target: 4000, gop: 30, wantMoof: 3},
+		{name: "manual", mode: FRAGMENT_MANUAL, gop: 10, wantMoof: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newFmp4WriterSeeker(1024)
+			muxTestFile(t, ws, fragmentTestStream(30, tt.gop), WithMp4Flag(MP4_FLAG_FRAGMENT), WithFragmentMode(tt.mode, tt.target))
+			tree, err := ParseBoxTree(bytes.NewReader(ws.buffer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			moofs := tree.FindAll("moof")
+			if len(moofs) != tt.wantMoof {
+				t.Errorf("got %d moof, want %d", len(moofs), tt.wantMoof)
+			}
+			if pkgs := readAllPackets(t, ws.buffer); len(pkgs) != 90 {
+				t.Errorf("got %d packets, want 90", len(pkgs))
+			}
+		})
+	}
+}
+
+func TestWithSegmentCallback(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 500000000, time.UTC)
+	var segs []*FragmentSegment
+	ws := newFmp4WriterSeeker(1024)
+	muxer := muxTestFile(t, ws, fragmentTestStream(20, 10),
+		WithMp4Flag(MP4_FLAG_CMAF|MP4_FLAG_SEPARATE_MOOF),
+		WithPrft(func() time.Time { return now }),
+		WithSegmentCallback(func(seg *FragmentSegment) error {
+			segs = append(segs, seg)
+			return nil
+		}))
+	if len(ws.buffer) != 0 {
+		t.Errorf("muxer wrote %d bytes to writer", len(ws.buffer))
+	}
+	//每个gop一个video segment和一个audio segment
+	if len(segs) != 4 {
+		t.Fatalf("got %d segments, want 4", len(segs))
+	}
+
+	var videoFile bytes.Buffer
+	if err := muxer.WriteInitSegment(&videoFile, 1); err != nil {
+		t.Fatal(err)
+	}
+	for i, seg := range segs {
+		if seg.TrackId != uint32(i%2+1) || seg.SequenceNumber != uint32(i+1) || seg.StartDts != uint64(i/2*400) || seg.Duration != 400 || !seg.Independent {
+			t.Errorf("segment %d = %+v", i, *seg)
+		}
+		tree, err := ParseBoxTree(bytes.NewReader(seg.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var types []string
+		for _, node := range tree.Root.Children {
+			types = append(types, string(node.Type[:]))
+		}
+		if want := "styp sidx prft moof mdat"; strings.Join(types, " ") != want {
+			t.Fatalf("segment %d boxes = %v, want %s", i, types, want)
+		}
+		if major := string(tree.Find("styp").Data[:4]); major != "cmfs" {
+			t.Errorf("styp major brand = %s", major)
+		}
+
+		sidxNode := tree.Find("sidx")
+		boxdata, _ := sidxNode.Bytes()
+		sidx := NewSegmentIndexBox()
+		sidx.Box.Box.Size = sidxNode.Size()
+		if _, err := sidx.Decode(bytes.NewReader(boxdata[BasicBoxLen:])); err != nil {
+			t.Fatal(err)
+		}
+		moof, mdat := tree.Find("moof"), tree.Find("mdat")
+		if sidxNode.Offset+sidxNode.Size()+sidx.FirstOffset != moof.Offset {
+			t.Errorf("sidx first_offset = %d", sidx.FirstOffset)
+		}
+		entry := sidx.Entrys[0]
+		if uint64(entry.ReferencedSize) != moof.Size()+mdat.Size() || entry.SubsegmentDuration != 400 || entry.StartsWithSAP != 1 {
+			t.Errorf("sidx entry = %+v", entry)
+		}
+
+		prft := tree.Find("prft").Data
+		ntp := binary.BigEndian.Uint64(prft[8:])
+		if ntp>>32 != uint64(now.Unix()+ntpEpochOffset) || uint32(ntp) != 1<<31 {
+			t.Errorf("prft ntp = %x", ntp)
+		}
+		if tid := binary.BigEndian.Uint32(prft[4:]); tid != seg.TrackId {
+			t.Errorf("prft track id = %d", tid)
+		}
+		if seg.TrackId == 1 {
+			videoFile.Write(seg.Data)
+		}
+	}
+
+	pkgs := readAllPackets(t, videoFile.Bytes())
+	if len(pkgs) != 20 {
+		t.Fatalf("got %d video packets, want 20", len(pkgs))
+	}
+	for i, pkg := range pkgs {
+		if pkg.Cid != MP4_CODEC_H264 || pkg.Dts != uint64(i*40) {
+			t.Errorf("packet %d: cid %v dts %d", i, pkg.Cid, pkg.Dts)
+		}
+	}
+}
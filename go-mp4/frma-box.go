@@ -17,13 +17,47 @@ func decodeFrmaBox(demuxer *MovDemuxer, size uint32) (err error) {
 			track.extra = new(h264ExtraData)
 		}
 		return
-	case mov_tag([4]byte{'m', 'p', '4', 'a'}):
-		track.cid = MP4_CODEC_AAC
+	case mov_tag([4]byte{'h', 'v', 'c', '1'}), mov_tag([4]byte{'h', 'e', 'v', '1'}):
+		track.cid = MP4_CODEC_H265
+		if track.extra == nil {
+			track.extra = newh265ExtraData()
+		}
+		return
+	case mov_tag([4]byte{'a', 'v', '0', '1'}):
+		track.cid = MP4_CODEC_AV1
 		if track.extra == nil {
+			track.extra = newav1ExtraData()
+		}
+		return
+	case mov_tag([4]byte{'v', 'p', '0', '9'}):
+		track.cid = MP4_CODEC_VP9
+		if track.extra == nil {
+			track.extra = newvp9ExtraData()
+		}
+		return
+	case mov_tag([4]byte{'m', 'p', '4', 'a'}):
+		if track.cid == 0 {
+			track.cid = MP4_CODEC_AAC
+		}
+		if track.extra == nil && track.cid == MP4_CODEC_AAC {
 			track.extra = new(aacExtraData)
 		}
 		return
+	case mov_tag([4]byte{'a', 'l', 'a', 'w'}):
+		track.cid = MP4_CODEC_G711A
+		return
+	case mov_tag([4]byte{'u', 'l', 'a', 'w'}):
+		track.cid = MP4_CODEC_G711U
+		return
 	}
 
     return
 }
+
+func makeFrmaBox(format [4]byte) []byte {
+	frma := BasicBox{Type: [4]byte{'f', 'r', 'm', 'a'}}
+	frma.Size = 12
+	offset, frmaBox := frma.Encode()
+	copy(frmaBox[offset:], format[:])
+	return frmaBox
+}
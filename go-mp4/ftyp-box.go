@@ -17,6 +17,10 @@ var mp42 [4]byte = [4]byte{'m', 'p', '4', '2'}
 var dash [4]byte = [4]byte{'d', 'a', 's', 'h'}
 var msdh [4]byte = [4]byte{'m', 's', 'd', 'h'}
 var msix [4]byte = [4]byte{'m', 's', 'i', 'x'}
+var cmfc [4]byte = [4]byte{'c', 'm', 'f', 'c'}
+var cmff [4]byte = [4]byte{'c', 'm', 'f', 'f'}
+var cmfs [4]byte = [4]byte{'c', 'm', 'f', 's'}
+var cmfl [4]byte = [4]byte{'c', 'm', 'f', 'l'}
 
 func mov_tag(tag [4]byte) uint32 {
 	return binary.LittleEndian.Uint32(tag[:])
@@ -32,6 +32,9 @@ var soun HandlerType = HandlerType{'s', 'o', 'u', 'n'}
 var hint HandlerType = HandlerType{'h', 'i', 'n', 't'}
 var meta HandlerType = HandlerType{'m', 'e', 't', 'a'}
 var auxv HandlerType = HandlerType{'a', 'u', 'x', 'v'}
+var text HandlerType = HandlerType{'t', 'e', 'x', 't'}
+var sbtl HandlerType = HandlerType{'s', 'b', 't', 'l'}
+var subt HandlerType = HandlerType{'s', 'u', 'b', 't'}
 
 func (ht HandlerType) equal(other HandlerType) bool {
     return bytes.Equal(ht[:], other[:])
@@ -89,11 +92,20 @@ func (hdlr *HandlerBox) Encode() (int, []byte) {
 
 func getHandlerType(cid MP4_CODEC_TYPE) HandlerType {
     switch cid {
-    case MP4_CODEC_H264, MP4_CODEC_H265:
+    case MP4_CODEC_H264, MP4_CODEC_H265, MP4_CODEC_AV1, MP4_CODEC_VP9:
         return vide
     case MP4_CODEC_AAC, MP4_CODEC_G711A, MP4_CODEC_G711U,
-        MP4_CODEC_MP2, MP4_CODEC_MP3, MP4_CODEC_OPUS:
+        MP4_CODEC_MP2, MP4_CODEC_MP3, MP4_CODEC_OPUS, MP4_CODEC_LPCM:
         return soun
+    //ffmpeg movenc.c mov_write_hdlr_tag
+    case MP4_CODEC_WEBVTT:
+        return text
+    case MP4_CODEC_TX3G:
+        return sbtl
+    case MP4_CODEC_TTML:
+        return subt
+    case MP4_CODEC_ID3, MP4_CODEC_URIM:
+        return meta
     default:
         panic("unsupport codec id")
     }
@@ -105,6 +117,10 @@ func makeHdlrBox(hdt HandlerType) []byte {
         hdlr = NewHandlerBox(hdt, "VideoHandler")
     } else if hdt.equal(soun) {
         hdlr = NewHandlerBox(hdt, "SoundHandler")
+    } else if hdt.equal(text) || hdt.equal(sbtl) || hdt.equal(subt) {
+        hdlr = NewHandlerBox(hdt, "SubtitleHandler")
+    } else if hdt.equal(meta) {
+        hdlr = NewHandlerBox(hdt, "MetadataHandler")
     } else {
         hdlr = NewHandlerBox(hdt, "")
     }
@@ -104,9 +104,10 @@ func (mdhd *MediaHeaderBox) Decode(r io.Reader) (offset int, err error) {
     }
     bs := codec.NewBitStream(buf[offset:])
     mdhd.Pad = bs.GetBit()
-    mdhd.Language[0] = bs.Uint8(5)
-    mdhd.Language[1] = bs.Uint8(5)
-    mdhd.Language[2] = bs.Uint8(5)
+    //和ff_mov_iso639_to_lang对应, 保存ISO-639-2/T字符
+    mdhd.Language[0] = bs.Uint8(5) + 0x60
+    mdhd.Language[1] = bs.Uint8(5) + 0x60
+    mdhd.Language[2] = bs.Uint8(5) + 0x60
     mdhd.Pre_defined = 0
     offset += 4
     return
@@ -140,9 +141,12 @@ func (mdhd *MediaHeaderBox) Encode() (int, []byte) {
     return offset, buf
 }
 
-func makeMdhdBox(duration uint32) []byte {
+func makeMdhdBox(duration uint32, language [3]byte) []byte {
     mdhd := NewMediaHeaderBox()
     mdhd.Duration = uint64(duration)
+    if language[0] != 0 {
+        mdhd.Language = language
+    }
     _, boxdata := mdhd.Encode()
     return boxdata
 }
@@ -154,5 +158,6 @@ func decodeMdhdBox(demuxer *MovDemuxer) (err error) {
     }
     track := demuxer.tracks[len(demuxer.tracks)-1]
     track.timescale = mdhd.Timescale
+    track.language = mdhd.Language
     return err
 }
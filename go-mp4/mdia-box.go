@@ -1,7 +1,7 @@
 package mp4
 
 func makeMdiaBox(track *mp4track) []byte {
-    mdhdbox := makeMdhdBox(track.duration)
+    mdhdbox := makeMdhdBox(track.duration, track.language)
     hdlrbox := makeHdlrBox(getHandlerType(track.cid))
     minfbox := makeMinfBox(track)
     mdia := BasicBox{Type: [4]byte{'m', 'd', 'i', 'a'}}
@@ -0,0 +1,361 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// moov/udta中的元数据:
+// iTunes风格的meta/ilst, 3GPP TS 26.244的udta字符串, QuickTime的©xyz, Nero的chpl章节
+
+type Chapter struct {
+	Start uint64 //ms
+	Title string
+}
+
+type Metadata struct {
+	Title     string            //©nam, 3GPP titl
+	Artist    string            //©ART, 3GPP perf
+	Album     string            //©alb, 3GPP albm
+	Genre     string            //©gen, 3GPP gnre
+	Comment   string            //©cmt, 3GPP dscp
+	Copyright string            //cprt
+	Date      string            //©day, 3GPP yrrc只有年份
+	Tool      string            //©too, 编码工具
+	Location  string            //©xyz, ISO 6709, 比如"+39.9042+116.4074/"
+	Cover     []byte            //covr, jpeg或者png
+	Tags      map[string]string //其他ilst文本, key为box类型, 比如"©wrt"
+	Chapters  []Chapter
+}
+
+// 写入moov/udta, fmp4写在init segment中
+func WithMetadata(meta Metadata) MuxerOption {
+	return func(muxer *Movmuxer) {
+		muxer.metadata = &meta
+	}
+}
+
+var ilstTextTags = []struct {
+	boxtype [4]byte
+	field   func(meta *Metadata) *string
+}{
+	{[4]byte{0xa9, 'n', 'a', 'm'}, func(meta *Metadata) *string { return &meta.Title }},
+	{[4]byte{0xa9, 'A', 'R', 'T'}, func(meta *Metadata) *string { return &meta.Artist }},
+	{[4]byte{0xa9, 'a', 'l', 'b'}, func(meta *Metadata) *string { return &meta.Album }},
+	{[4]byte{0xa9, 'g', 'e', 'n'}, func(meta *Metadata) *string { return &meta.Genre }},
+	{[4]byte{0xa9, 'c', 'm', 't'}, func(meta *Metadata) *string { return &meta.Comment }},
+	{[4]byte{'c', 'p', 'r', 't'}, func(meta *Metadata) *string { return &meta.Copyright }},
+	{[4]byte{0xa9, 'd', 'a', 'y'}, func(meta *Metadata) *string { return &meta.Date }},
+	{[4]byte{0xa9, 't', 'o', 'o'}, func(meta *Metadata) *string { return &meta.Tool }},
+}
+
+var threeGPPTags = []struct {
+	boxtype [4]byte
+	field   func(meta *Metadata) *string
+}{
+	{[4]byte{'t', 'i', 't', 'l'}, func(meta *Metadata) *string { return &meta.Title }},
+	{[4]byte{'p', 'e', 'r', 'f'}, func(meta *Metadata) *string { return &meta.Artist }},
+	{[4]byte{'a', 'u', 't', 'h'}, func(meta *Metadata) *string { return &meta.Artist }},
+	{[4]byte{'a', 'l', 'b', 'm'}, func(meta *Metadata) *string { return &meta.Album }},
+	{[4]byte{'g', 'n', 'r', 'e'}, func(meta *Metadata) *string { return &meta.Genre }},
+	{[4]byte{'d', 's', 'c', 'p'}, func(meta *Metadata) *string { return &meta.Comment }},
+	{[4]byte{'c', 'p', 'r', 't'}, func(meta *Metadata) *string { return &meta.Copyright }},
+}
+
+// ilst中data box的类型
+const (
+	ilstDataUTF8 = 1
+	ilstDataJPEG = 13
+	ilstDataPNG  = 14
+)
+
+// QuickTime的language code, 'und'
+const qtLanguageUnd = 0x55c4
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}
+
+func makeUdtaBox(meta *Metadata) []byte {
+	udta := NewBoxNode([4]byte{'u', 'd', 't', 'a'}, nil)
+
+	ilst := NewBoxNode([4]byte{'i', 'l', 's', 't'}, nil)
+	for _, tag := range ilstTextTags {
+		if value := *tag.field(meta); value != "" {
+			ilst.Append(makeIlstItem(tag.boxtype, ilstDataUTF8, []byte(value)))
+		}
+	}
+	keys := make([]string, 0, len(meta.Tags))
+	for key := range meta.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		boxtype, idx, err := parsePathElem(key)
+		if err != nil || idx >= 0 || meta.Tags[key] == "" {
+			continue
+		}
+		ilst.Append(makeIlstItem(boxtype, ilstDataUTF8, []byte(meta.Tags[key])))
+	}
+	if len(meta.Cover) > 0 {
+		dataType := uint32(ilstDataJPEG)
+		if bytes.HasPrefix(meta.Cover, pngSignature) {
+			dataType = ilstDataPNG
+		}
+		ilst.Append(makeIlstItem([4]byte{'c', 'o', 'v', 'r'}, dataType, meta.Cover))
+	}
+	if len(ilst.Children) > 0 {
+		metaBox := NewBoxNode([4]byte{'m', 'e', 't', 'a'}, make([]byte, 4))
+		_, hdlr := NewHandlerBox(HandlerType{'m', 'd', 'i', 'r'}, "").Encode()
+		hdlrNode, _ := ParseBox(hdlr)
+		metaBox.Append(hdlrNode, ilst)
+		udta.Append(metaBox)
+	}
+
+	if meta.Location != "" {
+		data := make([]byte, 4, 4+len(meta.Location))
+		binary.BigEndian.PutUint16(data, uint16(len(meta.Location)))
+		binary.BigEndian.PutUint16(data[2:], 0x15c7)
+		udta.Append(NewBoxNode([4]byte{0xa9, 'x', 'y', 'z'}, append(data, meta.Location...)))
+	}
+
+	//auth和perf都对应Artist, 只写perf
+	for _, tag := range threeGPPTags {
+		if value := *tag.field(meta); value != "" && tag.boxtype != [4]byte{'a', 'u', 't', 'h'} {
+			data := make([]byte, 6, 7+len(value))
+			binary.BigEndian.PutUint16(data[4:], qtLanguageUnd)
+			data = append(append(data, value...), 0)
+			udta.Append(NewBoxNode(tag.boxtype, data))
+		}
+	}
+	if len(meta.Date) >= 4 {
+		if year, err := strconv.Atoi(meta.Date[:4]); err == nil {
+			data := make([]byte, 6)
+			binary.BigEndian.PutUint16(data[4:], uint16(year))
+			udta.Append(NewBoxNode([4]byte{'y', 'r', 'r', 'c'}, data))
+		}
+	}
+
+	if len(meta.Chapters) > 0 {
+		udta.Append(makeChplBox(meta.Chapters))
+	}
+	if len(udta.Children) == 0 {
+		return nil
+	}
+	boxdata, _ := udta.Bytes()
+	return boxdata
+}
+
+func makeIlstItem(boxtype [4]byte, dataType uint32, value []byte) *BoxNode {
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint32(data, dataType)
+	item := NewBoxNode(boxtype, nil)
+	item.Append(NewBoxNode([4]byte{'d', 'a', 't', 'a'}, append(data, value...)))
+	return item
+}
+
+// aligned(8) class ChapterListBox extends FullBox('chpl', version = 1, 0) {
+//     unsigned int(32) reserved;
+//     unsigned int(8)  chapter_count;
+//     for (i = 0; i < chapter_count; i++) {
+//         unsigned int(64) start_time; //100ns
+//         unsigned int(8)  title_length;
+//         char             title[title_length];
+//     }
+// }
+
+func makeChplBox(chapters []Chapter) *BoxNode {
+	if len(chapters) > 255 {
+		chapters = chapters[:255]
+	}
+	data := make([]byte, 9)
+	data[0] = 1
+	data[8] = uint8(len(chapters))
+	for _, chapter := range chapters {
+		title := chapter.Title
+		if len(title) > 255 {
+			title = title[:255]
+		}
+		data = append(data, make([]byte, 9)...)
+		binary.BigEndian.PutUint64(data[len(data)-9:], chapter.Start*10000)
+		data[len(data)-1] = uint8(len(title))
+		data = append(data, title...)
+	}
+	return NewBoxNode([4]byte{'c', 'h', 'p', 'l'}, data)
+}
+
+func decodeChplBox(data []byte) (chapters []Chapter) {
+	if len(data) < 5 {
+		return nil
+	}
+	n := 4
+	if data[0] == 1 {
+		n += 4
+	}
+	if n >= len(data) {
+		return nil
+	}
+	count := int(data[n])
+	n++
+	for i := 0; i < count && n+9 <= len(data); i++ {
+		start := binary.BigEndian.Uint64(data[n:])
+		titleLen := int(data[n+8])
+		n += 9
+		if n+titleLen > len(data) {
+			break
+		}
+		chapters = append(chapters, Chapter{Start: start / 10000, Title: string(data[n : n+titleLen])})
+		n += titleLen
+	}
+	return
+}
+
+func (meta *Metadata) decodeUdta(children []*BoxNode) {
+	for _, child := range children {
+		switch child.Type {
+		case [4]byte{'m', 'e', 't', 'a'}:
+			meta.decodeMeta(child)
+		case [4]byte{'c', 'h', 'p', 'l'}:
+			if len(meta.Chapters) == 0 {
+				meta.Chapters = decodeChplBox(child.Data)
+			}
+		case [4]byte{'y', 'r', 'r', 'c'}:
+			if meta.Date == "" && len(child.Data) >= 6 {
+				meta.Date = strconv.Itoa(int(binary.BigEndian.Uint16(child.Data[4:])))
+			}
+		case [4]byte{0xa9, 'x', 'y', 'z'}:
+			if meta.Location == "" {
+				meta.Location = decodeQTString(child.Data)
+			}
+		default:
+			meta.decodeUdtaString(child)
+		}
+	}
+}
+
+// 3GPP的字符串box, 或者QuickTime classic的©xxx字符串
+func (meta *Metadata) decodeUdtaString(node *BoxNode) {
+	for _, tag := range threeGPPTags {
+		if tag.boxtype == node.Type && len(node.Data) > 6 {
+			if field := tag.field(meta); *field == "" {
+				*field = decode3GPPString(node.Data[6:])
+			}
+			return
+		}
+	}
+	for _, tag := range ilstTextTags {
+		if tag.boxtype == node.Type && node.Type[0] == 0xa9 {
+			if field := tag.field(meta); *field == "" {
+				*field = decodeQTString(node.Data)
+			}
+			return
+		}
+	}
+}
+
+func (meta *Metadata) decodeMeta(node *BoxNode) {
+	ilst := node.Find("ilst")
+	if ilst == nil {
+		return
+	}
+	for _, item := range ilst.Children {
+		data := item.Find("data")
+		if data == nil || len(data.Data) < 8 {
+			continue
+		}
+		dataType := binary.BigEndian.Uint32(data.Data) & 0xFFFFFF
+		value := data.Data[8:]
+		if item.Type == [4]byte{'c', 'o', 'v', 'r'} {
+			if len(meta.Cover) == 0 {
+				meta.Cover = append([]byte{}, value...)
+			}
+			continue
+		}
+		if dataType != ilstDataUTF8 {
+			continue
+		}
+		known := false
+		for _, tag := range ilstTextTags {
+			if tag.boxtype == item.Type {
+				*tag.field(meta) = string(value)
+				known = true
+				break
+			}
+		}
+		if !known {
+			if meta.Tags == nil {
+				meta.Tags = make(map[string]string)
+			}
+			meta.Tags[boxTypeString(item.Type)] = string(value)
+		}
+	}
+}
+
+// box类型按Latin-1转换, ©nam -> "©nam"
+func boxTypeString(boxtype [4]byte) string {
+	runes := make([]rune, 4)
+	for i, c := range boxtype {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// unsigned int(16) length; unsigned int(16) language; char string[length]
+func decodeQTString(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	if length > len(data)-4 {
+		length = len(data) - 4
+	}
+	return string(data[4 : 4+length])
+}
+
+// UTF-8或者带BOM的UTF-16, 以0结尾
+func decode3GPPString(data []byte) string {
+	if len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF {
+		u16 := make([]uint16, 0, len(data)/2)
+		for i := 2; i+1 < len(data); i += 2 {
+			c := binary.BigEndian.Uint16(data[i:])
+			if c == 0 {
+				break
+			}
+			u16 = append(u16, c)
+		}
+		return string(utf16.Decode(u16))
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
+func decodeUdtaBox(demuxer *MovDemuxer, size uint32) (err error) {
+	buf := make([]byte, size-BasicBoxLen)
+	if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+		return
+	}
+	//元数据解析失败不影响解封装
+	if children, perr := parseBoxes(buf, 0, nil); perr == nil {
+		demuxer.metadata.decodeUdta(children)
+	}
+	return
+}
+
+func decodeMetaBox(demuxer *MovDemuxer, size uint32) (err error) {
+	buf := make([]byte, size-BasicBoxLen)
+	if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+		return
+	}
+	node := NewBoxNode([4]byte{'m', 'e', 't', 'a'}, nil)
+	node.setPayload(buf, 0)
+	demuxer.metadata.decodeMeta(node)
+	return
+}
+
+func (demuxer *MovDemuxer) GetMetadata() Metadata {
+	return demuxer.metadata
+}
@@ -0,0 +1,105 @@
+package mp4
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMetadata_RoundTrip(t *testing.T) {
+	meta := Metadata{
+		Title:     "标题",
+		Artist:    "artist",
+		Album:     "album",
+		Genre:     "genre",
+		Comment:   "comment",
+		Copyright: "copyright",
+		Date:      "2024-05-01",
+		Tool:      "gomedia",
+		Location:  "+39.9042+116.4074/",
+		Cover:     append(append([]byte{}, pngSignature...), 1, 2, 3, 4),
+		Tags:      map[string]string{"©wrt": "composer", "desc": "description"},
+		Chapters:  []Chapter{{Start: 0, Title: "first"}, {Start: 200, Title: "second"}},
+	}
+	tests := []struct {
+		name    string
+		options []MuxerOption
+	}{
+		{name: "mp4", options: []MuxerOption{WithMetadata(meta)}},
+		{name: "fmp4", options: []MuxerOption{WithMp4Flag(MP4_FLAG_FRAGMENT), WithMetadata(meta)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := muxTestBuffer(t, boxTreeTestStream, tt.options...)
+			tree, err := ParseBoxTree(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tree.Find("moov/udta/meta/ilst/©nam") == nil || tree.Find("moov/udta/chpl") == nil {
+				t.Fatalf("udta is not written")
+			}
+			demuxer := CreateMp4Demuxer(bytes.NewReader(data))
+			if _, err := demuxer.ReadHead(); err != nil {
+				t.Fatal(err)
+			}
+			if got := demuxer.GetMetadata(); !reflect.DeepEqual(got, meta) {
+				t.Errorf("GetMetadata() = %+v, want %+v", got, meta)
+			}
+			if pkgs := readAllPackets(t, data); len(pkgs) != 20 {
+				t.Errorf("demux got %d packets", len(pkgs))
+			}
+		})
+	}
+}
+
+func TestMetadata_decodeUdta(t *testing.T) {
+	box := func(boxtype string, data []byte) []byte {
+		boxdata, _ := NewBoxNode(fourcc(boxtype), data).Bytes()
+		return boxdata
+	}
+	tests := []struct {
+		name string
+		udta []byte
+		want Metadata
+	}{
+		{
+			name: "3gpp utf-8",
+			udta: append(box("titl", []byte{0, 0, 0, 0, 0x15, 0xc7, 'a', 'b', 0}),
+				box("yrrc", []byte{0, 0, 0, 0, 0x07, 0xe8})...),
+			want: Metadata{Title: "ab", Date: "2024"},
+		},
+		{
+			name: "3gpp utf-16",
+			udta: box("auth", []byte{0, 0, 0, 0, 0x15, 0xc7, 0xfe, 0xff, 0x6c, 0x49, 0x00, 'x', 0, 0}),
+			want: Metadata{Artist: "汉x"},
+		},
+		{
+			name: "quicktime string",
+			udta: box("\xa9nam", []byte{0, 3, 0, 0, 'q', 't', 'n', 'x'}),
+			want: Metadata{Title: "qtn"},
+		},
+		{
+			name: "chpl version 0",
+			udta: box("chpl", []byte{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0x98, 0x96, 0x80, 2, 'c', '1'}),
+			want: Metadata{Chapters: []Chapter{{Start: 1000, Title: "c1"}}},
+		},
+		{
+			name: "truncated chpl",
+			udta: box("chpl", []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 10, 'c'}),
+			want: Metadata{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			children, err := parseBoxes(tt.udta, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Metadata
+			got.decodeUdta(children)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeUdta() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,11 +3,15 @@ package mp4
 func makeMinfBox(track *mp4track) []byte {
     var mhdbox []byte
     switch track.cid {
-    case MP4_CODEC_H264, MP4_CODEC_H265:
+    case MP4_CODEC_H264, MP4_CODEC_H265, MP4_CODEC_AV1, MP4_CODEC_VP9:
         mhdbox = makeVmhdBox()
     case MP4_CODEC_G711A, MP4_CODEC_G711U, MP4_CODEC_AAC,
-        MP4_CODEC_MP2, MP4_CODEC_MP3, MP4_CODEC_OPUS:
+        MP4_CODEC_MP2, MP4_CODEC_MP3, MP4_CODEC_OPUS, MP4_CODEC_LPCM:
         mhdbox = makeSmhdBox()
+    case MP4_CODEC_TTML:
+        mhdbox = makeSthdBox()
+    case MP4_CODEC_WEBVTT, MP4_CODEC_TX3G, MP4_CODEC_ID3, MP4_CODEC_URIM:
+        mhdbox = makeNmhdBox()
     default:
         panic("unsupport codec id")
     }
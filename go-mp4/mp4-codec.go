@@ -9,22 +9,35 @@ type MP4_CODEC_TYPE int
 const (
     MP4_CODEC_H264 MP4_CODEC_TYPE = iota + 1
     MP4_CODEC_H265
+    MP4_CODEC_AV1
+    MP4_CODEC_VP9
 
-    MP4_CODEC_AAC MP4_CODEC_TYPE = iota + 100
+    MP4_CODEC_AAC MP4_CODEC_TYPE = iota + 98
     MP4_CODEC_G711A
     MP4_CODEC_G711U
     MP4_CODEC_MP2
     MP4_CODEC_MP3
     MP4_CODEC_OPUS
+    MP4_CODEC_LPCM //16bit有符号小端
+
+    MP4_CODEC_WEBVTT MP4_CODEC_TYPE = iota + 189 //sample为cue文本, 或者完整的vttc/vtte box
+    MP4_CODEC_TTML                               //sample为TTML xml文档
+    MP4_CODEC_TX3G                               //sample为UTF-8文本
+    MP4_CODEC_ID3                                //timed metadata, sample为ID3v2 tag
+    MP4_CODEC_URIM                               //其他uri的timed metadata, uri通过WithExtraData设置, demux时见TrackInfo.MetadataUri
 )
 
 func isVideo(cid MP4_CODEC_TYPE) bool {
-    return cid == MP4_CODEC_H264 || cid == MP4_CODEC_H265
+    return cid == MP4_CODEC_H264 || cid == MP4_CODEC_H265 || cid == MP4_CODEC_AV1 || cid == MP4_CODEC_VP9
 }
 
 func isAudio(cid MP4_CODEC_TYPE) bool {
     return cid == MP4_CODEC_AAC || cid == MP4_CODEC_G711A || cid == MP4_CODEC_G711U ||
-        cid == MP4_CODEC_MP2 || cid == MP4_CODEC_MP3 || cid == MP4_CODEC_OPUS
+        cid == MP4_CODEC_MP2 || cid == MP4_CODEC_MP3 || cid == MP4_CODEC_OPUS || cid == MP4_CODEC_LPCM
+}
+
+func isText(cid MP4_CODEC_TYPE) bool {
+    return cid == MP4_CODEC_WEBVTT || cid == MP4_CODEC_TTML || cid == MP4_CODEC_TX3G
 }
 
 func getCodecNameWithCodecId(cid MP4_CODEC_TYPE) [4]byte {
@@ -33,6 +46,10 @@ func getCodecNameWithCodecId(cid MP4_CODEC_TYPE) [4]byte {
         return [4]byte{'a', 'v', 'c', '1'}
     case MP4_CODEC_H265:
         return [4]byte{'h', 'v', 'c', '1'}
+    case MP4_CODEC_AV1:
+        return [4]byte{'a', 'v', '0', '1'}
+    case MP4_CODEC_VP9:
+        return [4]byte{'v', 'p', '0', '9'}
     case MP4_CODEC_AAC, MP4_CODEC_MP2, MP4_CODEC_MP3:
         return [4]byte{'m', 'p', '4', 'a'}
     case MP4_CODEC_G711A:
@@ -41,6 +58,16 @@ func getCodecNameWithCodecId(cid MP4_CODEC_TYPE) [4]byte {
         return [4]byte{'u', 'l', 'a', 'w'}
     case MP4_CODEC_OPUS:
         return [4]byte{'o', 'p', 'u', 's'}
+    case MP4_CODEC_LPCM:
+        return [4]byte{'i', 'p', 'c', 'm'}
+    case MP4_CODEC_WEBVTT:
+        return [4]byte{'w', 'v', 't', 't'}
+    case MP4_CODEC_TTML:
+        return [4]byte{'s', 't', 'p', 'p'}
+    case MP4_CODEC_TX3G:
+        return [4]byte{'t', 'x', '3', 'g'}
+    case MP4_CODEC_ID3, MP4_CODEC_URIM:
+        return [4]byte{'u', 'r', 'i', 'm'}
     default:
         panic("unsupport codec id")
     }
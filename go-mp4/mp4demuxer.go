@@ -1,26 +1,40 @@
 package mp4
 
 import (
+    "crypto/cipher"
     "encoding/binary"
     "errors"
     "io"
+    "sort"
 
     "github.com/yapingcat/gomedia/go-codec"
 )
 
 type AVPacket struct {
-    Cid     MP4_CODEC_TYPE
-    Data    []byte
-    TrackId int
-    Pts     uint64
-    Dts     uint64
+    Cid      MP4_CODEC_TYPE
+    Data     []byte
+    TrackId  int
+    Pts      uint64 //应用edit list之后的展示时间戳(ms), 所有track一起平移使dts不小于0, edit list之前的sample小于0时为0
+    Dts      uint64
+    MediaPts int64 //stts/ctts得到的原始媒体时间戳(ms), 负的composition offset时可能小于0
+    MediaDts int64
+    Trimmed  bool //不在edit list范围内, 需要解码但不应该显示
+    Preroll  bool //SEEK_EXACT时目标时间之前的包, 需要解码但不应该显示
 }
 
+type SeekMode int
+
+const (
+    SEEK_PREVIOUS_KEYFRAME SeekMode = iota //目标时间之前(包括目标时间)最近的关键帧
+    SEEK_NEAREST_KEYFRAME                  //距离目标时间最近的关键帧
+    SEEK_EXACT                             //从之前的关键帧开始读, 目标时间之前的包标记为Preroll
+)
+
 type SyncSample struct {
     Pts    uint64
     Dts    uint64
     Size   uint32
-    Offset uint32
+    Offset uint64
 }
 
 type SubSample struct{
@@ -49,8 +63,10 @@ type TrackInfo struct {
 	SampleCount  uint32
     ChannelCount uint8
     Timescale    uint32
+    Language     string
     StartDts     uint64
     EndDts       uint64
+    MetadataUri  string //timed metadata track的uri
 }
 
 type Mp4Info struct {
@@ -70,6 +86,7 @@ type MovDemuxer struct {
     readSampleIdx []uint32
     mp4out        []byte
     mp4Info       Mp4Info
+    metadata      Metadata
 
     //for demux fmp4
     isFragement  bool
@@ -78,182 +95,86 @@ type MovDemuxer struct {
     moofOffset   int64
     dataOffset   uint32
 
+    //SEEK_EXACT的目标时间(ms)
+    prerollTime int64
+
+    //所有track的pts/dts统一平移的时间(ms)
+    tsShift      int64
+    tsShiftReady bool
+
+    //for demux fmp4 from io.Reader, 只能向前读, 每次缓存一个mdat
+    forwardOnly      bool
+    streamMdat       []byte
+    streamMdatOffset uint64
+
 	OnRawSample func(cid MP4_CODEC_TYPE, sample []byte, subSample *SubSample) error
+
+    //emsg box, mp4在ReadHead中回调, fmp4流在读到对应的fragment时回调
+    OnEventMessage func(msg EventMessage)
+
+    //for cenc, KID -> content key
+    decryptKeys map[[16]byte]cipher.Block
 }
 
+type DemuxerOption func(demuxer *MovDemuxer)
+
 // how to demux mp4 file
 // 1. CreateMovDemuxer
 // 2. ReadHead()
 // 3. ReadPacket
 
-func CreateMp4Demuxer(r io.ReadSeeker) *MovDemuxer {
-    return &MovDemuxer{
+func CreateMp4Demuxer(r io.ReadSeeker, options ...DemuxerOption) *MovDemuxer {
+    demuxer := &MovDemuxer{
         reader: r,
     }
+    for _, opt := range options {
+        opt(demuxer)
+    }
+    return demuxer
+}
+
+// 从io.Reader中按顺序解析fmp4(直播流, moof/mdat依次到达)
+// ReadHead读到moov结束为止, ReadPacket每次读取一个moof和对应的mdat, 不支持Seek
+func CreateFmp4StreamDemuxer(r io.Reader, options ...DemuxerOption) *MovDemuxer {
+    demuxer := &MovDemuxer{
+        reader:      &forwardReader{r: r},
+        forwardOnly: true,
+        isFragement: true,
+    }
+    for _, opt := range options {
+        opt(demuxer)
+    }
+    return demuxer
 }
 
 func (demuxer *MovDemuxer) ReadHead() ([]TrackInfo, error) {
     infos := make([]TrackInfo, 0, 2)
     var err error
-    for {
-        fullbox := FullBox{}
-        basebox := BasicBox{}
-        _, err = basebox.Decode(demuxer.reader)
-        if err != nil {
-            break
-        }
-        if basebox.Size < BasicBoxLen {
-            err = errors.New("mp4 Parser error")
-            break
-        }
-        switch mov_tag(basebox.Type) {
-        case mov_tag([4]byte{'f', 't', 'y', 'p'}):
-            err = decodeFtypBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'f', 'r', 'e', 'e'}):
-            err = decodeFreeBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'m', 'd', 'a', 't'}):
-            var currentOffset int64
-            if currentOffset, err = demuxer.reader.Seek(0, io.SeekCurrent); err != nil {
-                break
-            }
-            demuxer.mdatOffset = append(demuxer.mdatOffset, uint64(currentOffset))
-            _, err = demuxer.reader.Seek(int64(basebox.Size)-BasicBoxLen, io.SeekCurrent)
-        case mov_tag([4]byte{'m', 'o', 'o', 'v'}):
-            var currentOffset int64
-            if currentOffset, err = demuxer.reader.Seek(0, io.SeekCurrent); err != nil {
-                break
-            }
-            offset := int64(0)
-            if offset, err = demuxer.reader.Seek(0, io.SeekEnd); err != nil {
+    if demuxer.forwardOnly {
+        err = demuxer.readStreamHead()
+    } else {
+        for {
+            var basebox BasicBox
+            basebox, err = demuxer.readBoxHeader()
+            if err != nil {
                 break
             }
-            if offset-currentOffset < int64(basebox.Size)-BasicBoxLen {
-                err = errors.New("incomplete mp4 file")
+            if basebox.Size < BasicBoxLen {
+                err = errors.New("mp4 Parser error")
                 break
             }
-            _, err = demuxer.reader.Seek(currentOffset, io.SeekStart)
-        case mov_tag([4]byte{'m', 'v', 'h', 'd'}):
-            err = decodeMvhd(demuxer)
-        case mov_tag([4]byte{'p', 's', 's', 'h'}):
-            err = decodePsshBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'t', 'r', 'a', 'k'}):
-            track := &mp4track{}
-            demuxer.tracks = append(demuxer.tracks, track)
-        case mov_tag([4]byte{'t', 'k', 'h', 'd'}):
-            err = decodeTkhdBox(demuxer)
-        case mov_tag([4]byte{'m', 'd', 'h', 'd'}):
-            err = decodeMdhdBox(demuxer)
-        case mov_tag([4]byte{'h', 'd', 'l', 'r'}):
-            err = decodeHdlrBox(demuxer, basebox.Size)
-        case mov_tag([4]byte{'m', 'd', 'i', 'a'}):
-        case mov_tag([4]byte{'m', 'i', 'n', 'f'}):
-        case mov_tag([4]byte{'v', 'm', 'h', 'd'}):
-            err = decodeVmhdBox(demuxer)
-        case mov_tag([4]byte{'s', 'm', 'h', 'd'}):
-            err = decodeSmhdBox(demuxer)
-        case mov_tag([4]byte{'h', 'm', 'h', 'd'}):
-            _, err = fullbox.Decode(demuxer.reader)
-        case mov_tag([4]byte{'n', 'm', 'h', 'd'}):
-            _, err = fullbox.Decode(demuxer.reader)
-        case mov_tag([4]byte{'s', 't', 'b', 'l'}):
-            demuxer.tracks[len(demuxer.tracks)-1].stbltable = new(movstbl)
-        case mov_tag([4]byte{'s', 't', 's', 'd'}):
-            err = decodeStsdBox(demuxer)
-        case mov_tag([4]byte{'s', 't', 't', 's'}):
-            err = decodeSttsBox(demuxer)
-        case mov_tag([4]byte{'c', 't', 't', 's'}):
-            err = decodeCttsBox(demuxer)
-        case mov_tag([4]byte{'s', 't', 's', 'c'}):
-            err = decodeStscBox(demuxer)
-        case mov_tag([4]byte{'s', 't', 's', 'z'}):
-            err = decodeStszBox(demuxer)
-        case mov_tag([4]byte{'s', 't', 'c', 'o'}):
-            err = decodeStcoBox(demuxer)
-        case mov_tag([4]byte{'c', 'o', '6', '4'}):
-            err = decodeCo64Box(demuxer)
-        case mov_tag([4]byte{'s', 't', 's', 's'}):
-            err = decodeStssBox(demuxer)
-		case mov_tag([4]byte{'e', 'n', 'c', 'v'}):
-			err = decodeVisualSampleEntry(demuxer)
-		case mov_tag([4]byte{'s', 'i', 'n', 'f'}):
-		case mov_tag([4]byte{'f', 'r', 'm', 'a'}):
-			err = decodeFrmaBox(demuxer, uint32(basebox.Size))
-		case mov_tag([4]byte{'s', 'c', 'h', 'i'}):
-		case mov_tag([4]byte{'t', 'e', 'n', 'c'}):
-			err = decodeTencBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'a', 'v', 'c', '1'}):
-            demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_H264
-            demuxer.tracks[len(demuxer.tracks)-1].extra = new(h264ExtraData)
-            err = decodeVisualSampleEntry(demuxer)
-        case mov_tag([4]byte{'h', 'v', 'c', '1'}), mov_tag([4]byte{'h', 'e', 'v', '1'}):
-            demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_H265
-            demuxer.tracks[len(demuxer.tracks)-1].extra = newh265ExtraData()
-            err = decodeVisualSampleEntry(demuxer)
-		case mov_tag([4]byte{'e', 'n', 'c', 'a'}):
-			err = decodeAudioSampleEntry(demuxer)
-        case mov_tag([4]byte{'m', 'p', '4', 'a'}):
-            demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_AAC
-            demuxer.tracks[len(demuxer.tracks)-1].extra = new(aacExtraData)
-            err = decodeAudioSampleEntry(demuxer)
-        case mov_tag([4]byte{'u', 'l', 'a', 'w'}):
-            demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_G711U
-            err = decodeAudioSampleEntry(demuxer)
-        case mov_tag([4]byte{'a', 'l', 'a', 'w'}):
-            demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_G711A
-            err = decodeAudioSampleEntry(demuxer)
-        case mov_tag([4]byte{'o', 'p', 'u', 's'}):
-            demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_OPUS
-        case mov_tag([4]byte{'a', 'v', 'c', 'C'}):
-            err = decodeAvccBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'h', 'v', 'c', 'C'}):
-            err = decodeHvccBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'e', 's', 'd', 's'}):
-            err = decodeEsdsBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'e', 'd', 't', 's'}):
-        case mov_tag([4]byte{'e', 'l', 's', 't'}):
-            err = decodeElstBox(demuxer)
-        case mov_tag([4]byte{'m', 'v', 'e', 'x'}):
-            demuxer.isFragement = true
-        case mov_tag([4]byte{'m', 'o', 'o', 'f'}):
-            if demuxer.moofOffset, err = demuxer.reader.Seek(0, io.SeekCurrent); err != nil {
+            if err = demuxer.decodeBox(basebox); err != nil {
                 break
             }
-            demuxer.moofOffset -= 8
-            demuxer.dataOffset = uint32(basebox.Size) + 8
-        case mov_tag([4]byte{'m', 'f', 'h', 'd'}):
-            err = decodeMfhdBox(demuxer)
-        case mov_tag([4]byte{'t', 'r', 'a', 'f'}):
-        case mov_tag([4]byte{'t', 'f', 'h', 'd'}):
-            err = decodeTfhdBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'t', 'f', 'd', 't'}):
-            err = decodeTfdtBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'t', 'r', 'u', 'n'}):
-            err = decodeTrunBox(demuxer, uint32(basebox.Size))
-		case mov_tag([4]byte{'s', 'e', 'n', 'c'}):
-			err = decodeSencBox(demuxer, uint32(basebox.Size))
-		case mov_tag([4]byte{'s', 'a', 'i', 'z'}):
-		 	err = decodeSaizBox(demuxer, uint32(basebox.Size))
-		case mov_tag([4]byte{'s', 'a', 'i', 'o'}):
-			err = decodeSaioBox(demuxer, uint32(basebox.Size))
-		case mov_tag([4]byte{'u', 'u', 'i', 'd'}):
-			_, err = demuxer.reader.Seek(int64(basebox.Size)-BasicBoxLen-16, io.SeekCurrent)
-		case mov_tag([4]byte{'s', 'g', 'p', 'd'}):
-			err = decodeSgpdBox(demuxer, uint32(basebox.Size))
-        case mov_tag([4]byte{'w', 'a', 'v', 'e'}):
-            err = decodeWaveBox(demuxer)
-        default:
-            _, err = demuxer.reader.Seek(int64(basebox.Size)-BasicBoxLen, io.SeekCurrent)
-        }
-        if err != nil {
-            break
         }
     }
     if err != nil && err != io.EOF {
         return nil, err
     }
     if !demuxer.isFragement {
-        demuxer.buildSampleList()
+        demuxer.buildSampleIterator()
     }
+    demuxer.buildSyncSamples()
     demuxer.readSampleIdx = make([]uint32, len(demuxer.tracks))
     for _, track := range demuxer.tracks {
         info := TrackInfo{}
@@ -261,21 +182,346 @@ func (demuxer *MovDemuxer) ReadHead() ([]TrackInfo, error) {
         info.Duration = track.duration
         info.ChannelCount = track.chanelCount
         info.SampleRate = track.sampleRate
-		info.SampleCount = uint32(len(track.samplelist))
+		info.SampleCount = uint32(track.sampleCount())
         info.SampleSize = uint16(track.sampleBits)
         info.TrackId = int(track.trackId)
         info.Width = track.width
         info.Height = track.height
         info.Timescale = track.timescale
-        if len(track.samplelist) > 0 {
-            info.StartDts = track.samplelist[0].dts * 1000 / uint64(track.timescale)
-            info.EndDts = track.samplelist[len(track.samplelist)-1].dts * 1000 / uint64(track.timescale)
+        info.Language = string(track.language[:])
+        if track.cid == MP4_CODEC_ID3 || track.cid == MP4_CODEC_URIM {
+            info.MetadataUri = string(track.extraData)
+        }
+        if n := track.sampleCount(); n > 0 {
+            info.StartDts = track.sampleAt(0).dts * 1000 / uint64(track.timescale)
+            info.EndDts = track.sampleAt(n-1).dts * 1000 / uint64(track.timescale)
         }
         infos = append(infos, info)
     }
     return infos, nil
 }
 
+//读到moov结束为止
+func (demuxer *MovDemuxer) readStreamHead() error {
+    moovEnd := int64(-1)
+    for {
+        basebox, err := demuxer.readBoxHeader()
+        if err != nil {
+            return err
+        }
+        if basebox.Size < BasicBoxLen {
+            return errors.New("mp4 Parser error")
+        }
+        switch mov_tag(basebox.Type) {
+        case mov_tag([4]byte{'m', 'o', 'o', 'v'}):
+            moovEnd = demuxer.reader.(*forwardReader).pos + int64(basebox.Size) - BasicBoxLen
+        case mov_tag([4]byte{'m', 'o', 'o', 'f'}), mov_tag([4]byte{'m', 'd', 'a', 't'}):
+            if moovEnd < 0 {
+                return errors.New("moov box must be in front of moof and mdat")
+            }
+        }
+        if err = demuxer.decodeBox(basebox); err != nil {
+            return err
+        }
+        if moovEnd >= 0 && demuxer.reader.(*forwardReader).pos >= moovEnd {
+            return nil
+        }
+    }
+}
+
+//读取下一个moof和mdat, 上一个fragment的sample全部丢弃
+func (demuxer *MovDemuxer) readFragment() error {
+    for i, track := range demuxer.tracks {
+        track.samplelist = track.samplelist[:0]
+        track.fragmentRuns = track.fragmentRuns[:0]
+        track.subSamples = nil
+        demuxer.readSampleIdx[i] = 0
+    }
+    demuxer.streamMdat = nil
+    for {
+        basebox, err := demuxer.readBoxHeader()
+        if err != nil {
+            return err
+        }
+        if basebox.Size < BasicBoxLen {
+            return errors.New("mp4 Parser error")
+        }
+        if mov_tag(basebox.Type) != mov_tag([4]byte{'m', 'd', 'a', 't'}) {
+            if err = demuxer.decodeBox(basebox); err != nil {
+                return err
+            }
+            continue
+        }
+        demuxer.streamMdatOffset = uint64(demuxer.reader.(*forwardReader).pos)
+        demuxer.streamMdat = make([]byte, basebox.Size-BasicBoxLen)
+        if _, err = io.ReadFull(demuxer.reader, demuxer.streamMdat); err != nil {
+            return err
+        }
+        for _, track := range demuxer.tracks {
+            if len(track.samplelist) > 0 {
+                return nil
+            }
+        }
+    }
+}
+
+//读取box头, largesize多出来的8字节从Size中去掉, 之后统一按Size-BasicBoxLen计算box内容的大小
+//size为0时box一直到文件结束
+func (demuxer *MovDemuxer) readBoxHeader() (basebox BasicBox, err error) {
+    var n int
+    if n, err = basebox.Decode(demuxer.reader); err != nil {
+        return
+    }
+    if basebox.Size == 0 {
+        if demuxer.forwardOnly {
+            err = errors.New("box extends to end of file is not supported in stream mode")
+            return
+        }
+        var currentOffset, end int64
+        if currentOffset, err = demuxer.reader.Seek(0, io.SeekCurrent); err != nil {
+            return
+        }
+        if end, err = demuxer.reader.Seek(0, io.SeekEnd); err != nil {
+            return
+        }
+        if _, err = demuxer.reader.Seek(currentOffset, io.SeekStart); err != nil {
+            return
+        }
+        basebox.Size = uint64(end - currentOffset + int64(n))
+    }
+    if basebox.Size < uint64(n) {
+        err = errors.New("mp4 Parser error")
+        return
+    }
+    //uuid的16字节由decodeBox处理
+    extra := n - BasicBoxLen
+    if basebox.Type == [4]byte{'u', 'u', 'i', 'd'} {
+        extra -= 16
+    }
+    basebox.Size -= uint64(extra)
+    return
+}
+
+func (demuxer *MovDemuxer) decodeBox(basebox BasicBox) (err error) {
+    fullbox := FullBox{}
+    switch mov_tag(basebox.Type) {
+    case mov_tag([4]byte{'f', 't', 'y', 'p'}):
+        err = decodeFtypBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'f', 'r', 'e', 'e'}):
+        err = decodeFreeBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'m', 'd', 'a', 't'}):
+        var currentOffset int64
+        if currentOffset, err = demuxer.reader.Seek(0, io.SeekCurrent); err != nil {
+            break
+        }
+        demuxer.mdatOffset = append(demuxer.mdatOffset, uint64(currentOffset))
+        _, err = demuxer.reader.Seek(int64(basebox.Size)-BasicBoxLen, io.SeekCurrent)
+    case mov_tag([4]byte{'m', 'o', 'o', 'v'}):
+        if demuxer.forwardOnly {
+            break
+        }
+        var currentOffset int64
+        if currentOffset, err = demuxer.reader.Seek(0, io.SeekCurrent); err != nil {
+            break
+        }
+        offset := int64(0)
+        if offset, err = demuxer.reader.Seek(0, io.SeekEnd); err != nil {
+            break
+        }
+        if offset-currentOffset < int64(basebox.Size)-BasicBoxLen {
+            err = errors.New("incomplete mp4 file")
+            break
+        }
+        _, err = demuxer.reader.Seek(currentOffset, io.SeekStart)
+    case mov_tag([4]byte{'m', 'v', 'h', 'd'}):
+        err = decodeMvhd(demuxer)
+    case mov_tag([4]byte{'p', 's', 's', 'h'}):
+        err = decodePsshBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'t', 'r', 'a', 'k'}):
+        track := &mp4track{}
+        demuxer.tracks = append(demuxer.tracks, track)
+    case mov_tag([4]byte{'t', 'k', 'h', 'd'}):
+        err = decodeTkhdBox(demuxer)
+    case mov_tag([4]byte{'m', 'd', 'h', 'd'}):
+        err = decodeMdhdBox(demuxer)
+    case mov_tag([4]byte{'h', 'd', 'l', 'r'}):
+        err = decodeHdlrBox(demuxer, basebox.Size)
+    case mov_tag([4]byte{'m', 'd', 'i', 'a'}):
+    case mov_tag([4]byte{'m', 'i', 'n', 'f'}):
+    case mov_tag([4]byte{'v', 'm', 'h', 'd'}):
+        err = decodeVmhdBox(demuxer)
+    case mov_tag([4]byte{'s', 'm', 'h', 'd'}):
+        err = decodeSmhdBox(demuxer)
+    case mov_tag([4]byte{'h', 'm', 'h', 'd'}):
+        _, err = fullbox.Decode(demuxer.reader)
+    case mov_tag([4]byte{'n', 'm', 'h', 'd'}):
+        _, err = fullbox.Decode(demuxer.reader)
+    case mov_tag([4]byte{'s', 't', 'b', 'l'}):
+        demuxer.tracks[len(demuxer.tracks)-1].stbltable = new(movstbl)
+    case mov_tag([4]byte{'s', 't', 's', 'd'}):
+        err = decodeStsdBox(demuxer)
+    case mov_tag([4]byte{'s', 't', 't', 's'}):
+        err = decodeSttsBox(demuxer)
+    case mov_tag([4]byte{'c', 't', 't', 's'}):
+        err = decodeCttsBox(demuxer)
+    case mov_tag([4]byte{'s', 't', 's', 'c'}):
+        err = decodeStscBox(demuxer)
+    case mov_tag([4]byte{'s', 't', 's', 'z'}):
+        err = decodeStszBox(demuxer)
+    case mov_tag([4]byte{'s', 't', 'c', 'o'}):
+        err = decodeStcoBox(demuxer)
+    case mov_tag([4]byte{'c', 'o', '6', '4'}):
+        err = decodeCo64Box(demuxer)
+    case mov_tag([4]byte{'s', 't', 's', 's'}):
+        err = decodeStssBox(demuxer)
+    case mov_tag([4]byte{'e', 'n', 'c', 'v'}):
+        err = decodeVisualSampleEntry(demuxer)
+    case mov_tag([4]byte{'s', 'i', 'n', 'f'}):
+    case mov_tag([4]byte{'f', 'r', 'm', 'a'}):
+        err = decodeFrmaBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'s', 'c', 'h', 'm'}):
+        err = decodeSchmBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'s', 'c', 'h', 'i'}):
+    case mov_tag([4]byte{'t', 'e', 'n', 'c'}):
+        err = decodeTencBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'a', 'v', 'c', '1'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_H264
+        demuxer.tracks[len(demuxer.tracks)-1].extra = new(h264ExtraData)
+        err = decodeVisualSampleEntry(demuxer)
+    case mov_tag([4]byte{'h', 'v', 'c', '1'}), mov_tag([4]byte{'h', 'e', 'v', '1'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_H265
+        demuxer.tracks[len(demuxer.tracks)-1].extra = newh265ExtraData()
+        err = decodeVisualSampleEntry(demuxer)
+    case mov_tag([4]byte{'a', 'v', '0', '1'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_AV1
+        demuxer.tracks[len(demuxer.tracks)-1].extra = newav1ExtraData()
+        err = decodeVisualSampleEntry(demuxer)
+    case mov_tag([4]byte{'v', 'p', '0', '9'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_VP9
+        demuxer.tracks[len(demuxer.tracks)-1].extra = newvp9ExtraData()
+        err = decodeVisualSampleEntry(demuxer)
+    case mov_tag([4]byte{'e', 'n', 'c', 'a'}):
+        err = decodeAudioSampleEntry(demuxer)
+    case mov_tag([4]byte{'m', 'p', '4', 'a'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_AAC
+        demuxer.tracks[len(demuxer.tracks)-1].extra = new(aacExtraData)
+        err = decodeAudioSampleEntry(demuxer)
+    case mov_tag([4]byte{'u', 'l', 'a', 'w'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_G711U
+        err = decodeAudioSampleEntry(demuxer)
+    case mov_tag([4]byte{'a', 'l', 'a', 'w'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_G711A
+        err = decodeAudioSampleEntry(demuxer)
+    case mov_tag([4]byte{'o', 'p', 'u', 's'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_OPUS
+    case mov_tag([4]byte{'i', 'p', 'c', 'm'}), mov_tag([4]byte{'s', 'o', 'w', 't'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_LPCM
+        err = decodeAudioSampleEntry(demuxer)
+    case mov_tag([4]byte{'t', 'w', 'o', 's'}):
+        demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_LPCM
+        demuxer.tracks[len(demuxer.tracks)-1].pcmBigEndian = true
+        err = decodeAudioSampleEntry(demuxer)
+    case mov_tag([4]byte{'w', 'v', 't', 't'}):
+        err = decodeTextSampleEntry(demuxer, MP4_CODEC_WEBVTT, uint32(basebox.Size))
+    case mov_tag([4]byte{'s', 't', 'p', 'p'}):
+        err = decodeTextSampleEntry(demuxer, MP4_CODEC_TTML, uint32(basebox.Size))
+    case mov_tag([4]byte{'t', 'x', '3', 'g'}):
+        err = decodeTextSampleEntry(demuxer, MP4_CODEC_TX3G, uint32(basebox.Size))
+    case mov_tag([4]byte{'u', 'r', 'i', 'm'}):
+        err = decodeTextSampleEntry(demuxer, MP4_CODEC_ID3, uint32(basebox.Size))
+    case mov_tag([4]byte{'p', 'c', 'm', 'C'}):
+        err = decodePcmCBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'a', 'v', 'c', 'C'}):
+        err = decodeAvccBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'h', 'v', 'c', 'C'}):
+        err = decodeHvccBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'a', 'v', '1', 'C'}):
+        err = decodeAv1CBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'v', 'p', 'c', 'C'}):
+        err = decodeVpcCBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'e', 's', 'd', 's'}):
+        err = decodeEsdsBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'e', 'd', 't', 's'}):
+    case mov_tag([4]byte{'e', 'l', 's', 't'}):
+        err = decodeElstBox(demuxer)
+    case mov_tag([4]byte{'m', 'v', 'e', 'x'}):
+        demuxer.isFragement = true
+    case mov_tag([4]byte{'t', 'r', 'e', 'x'}):
+        err = decodeTrexBox(demuxer)
+    case mov_tag([4]byte{'m', 'o', 'o', 'f'}):
+        if demuxer.moofOffset, err = demuxer.reader.Seek(0, io.SeekCurrent); err != nil {
+            break
+        }
+        demuxer.moofOffset -= 8
+        demuxer.dataOffset = uint32(basebox.Size) + 8
+    case mov_tag([4]byte{'m', 'f', 'h', 'd'}):
+        err = decodeMfhdBox(demuxer)
+    case mov_tag([4]byte{'t', 'r', 'a', 'f'}):
+    case mov_tag([4]byte{'t', 'f', 'h', 'd'}):
+        err = decodeTfhdBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'t', 'f', 'd', 't'}):
+        err = decodeTfdtBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'t', 'r', 'u', 'n'}):
+        err = decodeTrunBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'s', 'e', 'n', 'c'}):
+        err = decodeSencBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'s', 'a', 'i', 'z'}):
+        err = decodeSaizBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'s', 'a', 'i', 'o'}):
+        err = decodeSaioBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'u', 'u', 'i', 'd'}):
+        _, err = demuxer.reader.Seek(int64(basebox.Size)-BasicBoxLen-16, io.SeekCurrent)
+    case mov_tag([4]byte{'s', 'g', 'p', 'd'}):
+        err = decodeSgpdBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'m', 'f', 'r', 'a'}):
+    case mov_tag([4]byte{'t', 'f', 'r', 'a'}):
+        err = decodeTfraBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'u', 'd', 't', 'a'}):
+        err = decodeUdtaBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'m', 'e', 't', 'a'}):
+        err = decodeMetaBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'e', 'm', 's', 'g'}):
+        err = decodeEmsgBox(demuxer, uint32(basebox.Size))
+    case mov_tag([4]byte{'w', 'a', 'v', 'e'}):
+        err = decodeWaveBox(demuxer)
+    default:
+        _, err = demuxer.reader.Seek(int64(basebox.Size)-BasicBoxLen, io.SeekCurrent)
+    }
+    return
+}
+
+//sample的加密信息, 未加密时返回nil
+func (demuxer *MovDemuxer) makeSubSample(track *mp4track, idx uint32) *SubSample {
+    if int(idx) >= len(track.subSamples) {
+        return nil
+    }
+    subSample := new(SubSample)
+    subSample.Number = idx
+    if len(track.subSamples[idx].iv) > 0 {
+        copy(subSample.IV[:], track.subSamples[idx].iv)
+    } else {
+        copy(subSample.IV[:], track.defaultConstantIV)
+    }
+    if track.lastSeig != nil {
+        copy(subSample.KID[:], track.lastSeig.KID[:])
+        subSample.CryptByteBlock = track.lastSeig.CryptByteBlock
+        subSample.SkipByteBlock = track.lastSeig.SkipByteBlock
+    } else {
+        copy(subSample.KID[:], track.defaultKID[:])
+        subSample.CryptByteBlock = track.defaultCryptByteBlock
+        subSample.SkipByteBlock = track.defaultSkipByteBlock
+    }
+    subSample.PsshBoxes = append(subSample.PsshBoxes, demuxer.pssh...)
+    if len(track.subSamples[idx].subSamples) > 0 {
+        subSample.Patterns = make([]SubSamplePattern, len(track.subSamples[idx].subSamples))
+        for ei, e := range track.subSamples[idx].subSamples {
+            subSample.Patterns[ei].BytesClear = e.bytesOfClearData
+            subSample.Patterns[ei].BytesProtected = e.bytesOfProtectedData
+        }
+    }
+    return subSample
+}
+
 func (demuxer *MovDemuxer) GetMp4Info() Mp4Info {
     return demuxer.mp4Info
 }
@@ -285,80 +531,66 @@ func (demuxer *MovDemuxer) ReadPacket() (*AVPacket, error) {
     for {
         maxdts := int64(-1)
         minTsSample := sampleEntry{dts: uint64(maxdts)}
-        var (
-			subSample *SubSample = nil
-        	whichTrack *mp4track = nil
-        )
+        var whichTrack *mp4track = nil
         whichTracki := 0
         for i, track := range demuxer.tracks {
             idx := demuxer.readSampleIdx[i]
-            if int(idx) == len(track.samplelist) {
+            if int(idx) == track.sampleCount() {
                 continue
             }
             if whichTrack == nil {
-                minTsSample = track.samplelist[idx]
+                minTsSample = track.sampleAt(int(idx))
                 whichTrack = track
                 whichTracki = i
             } else {
                 dts1 := minTsSample.dts * uint64(demuxer.mp4Info.Timescale) / uint64(whichTrack.timescale)
-                dts2 := track.samplelist[idx].dts * uint64(demuxer.mp4Info.Timescale) / uint64(track.timescale)
+                dts2 := track.sampleAt(int(idx)).dts * uint64(demuxer.mp4Info.Timescale) / uint64(track.timescale)
                 if dts1 > dts2 {
-                    minTsSample = track.samplelist[idx]
+                    minTsSample = track.sampleAt(int(idx))
                     whichTrack = track
                     whichTracki = i
                 }
             }
-			if int(idx) < len(track.subSamples) {
-				subSample = new(SubSample)
-				subSample.Number = idx
-				if len(track.subSamples[idx].iv) > 0 {
-					copy(subSample.IV[:], track.subSamples[idx].iv)
-				} else {
-					copy(subSample.IV[:], track.defaultConstantIV)
-				}
-				if track.lastSeig != nil {
-					copy(subSample.KID[:], track.lastSeig.KID[:])
-					subSample.CryptByteBlock = track.lastSeig.CryptByteBlock
-					subSample.SkipByteBlock = track.lastSeig.SkipByteBlock
-				} else {
-					copy(subSample.KID[:], track.defaultKID[:])
-					subSample.CryptByteBlock = track.defaultCryptByteBlock
-					subSample.SkipByteBlock = track.defaultSkipByteBlock
-				}
-				subSample.PsshBoxes = append(subSample.PsshBoxes, demuxer.pssh...)
-				if len(track.subSamples[idx].subSamples) > 0 {
-					subSample.Patterns = make([]SubSamplePattern, len(track.subSamples[idx].subSamples))
-					for ei, e := range track.subSamples[idx].subSamples {
-						subSample.Patterns[ei].BytesClear = e.bytesOfClearData
-						subSample.Patterns[ei].BytesProtected = e.bytesOfProtectedData
-					}
-				}
-			}
         }
 
         if minTsSample.dts == uint64(maxdts) {
-            return nil, io.EOF
-        }
-        if _, err := demuxer.reader.Seek(int64(minTsSample.offset), io.SeekStart); err != nil {
-            return nil, err
+            if !demuxer.forwardOnly {
+                return nil, io.EOF
+            }
+            if err := demuxer.readFragment(); err != nil {
+                return nil, err
+            }
+            continue
         }
-        sample := make([]byte, minTsSample.size)
-        if _, err := io.ReadFull(demuxer.reader, sample); err != nil {
+        sample, err := demuxer.readSample(whichTrack, int(demuxer.readSampleIdx[whichTracki]), minTsSample)
+        if err != nil {
+            if err == ErrSampleNotInMdat {
+                demuxer.readSampleIdx[whichTracki]++
+            }
             return nil, err
         }
         demuxer.readSampleIdx[whichTracki]++
         avpkg := &AVPacket{
             Cid:     whichTrack.cid,
             TrackId: int(whichTrack.trackId),
-            Pts:     minTsSample.pts * 1000 / uint64(whichTrack.timescale),
-            Dts:     minTsSample.dts * 1000 / uint64(whichTrack.timescale),
-        }
-		if demuxer.OnRawSample != nil {
-			err := demuxer.OnRawSample(whichTrack.cid, sample, subSample)
-			if err != nil {
-				return nil, err
-			}
-		}
+        }
+        demuxer.fillTimestamp(avpkg, whichTrack, minTsSample)
+        avpkg.Preroll = int64(avpkg.Pts) < demuxer.prerollTime
+        var subSample *SubSample
+        if demuxer.OnRawSample != nil || demuxer.decryptKeys != nil {
+            subSample = demuxer.makeSubSample(whichTrack, demuxer.readSampleIdx[whichTracki]-1)
+        }
+        if demuxer.OnRawSample != nil {
+            err := demuxer.OnRawSample(whichTrack.cid, sample, subSample)
+            if err != nil {
+                return nil, err
+            }
+        }
+        if subSample != nil && demuxer.decryptKeys != nil && len(sample) > 0 {
+            if sample, err = demuxer.decryptSample(whichTrack, sample, subSample); err != nil {
+                return nil, err
+            }
+        }
         if whichTrack.cid == MP4_CODEC_H264 {
             extra, ok := whichTrack.extra.(*h264ExtraData)
             if !ok {
@@ -371,6 +603,12 @@ func (demuxer *MovDemuxer) ReadPacket() (*AVPacket, error) {
                 panic("must init aacExtraData first")
             }
             avpkg.Data = demuxer.processH265(sample, extra)
+        } else if whichTrack.cid == MP4_CODEC_AV1 {
+            extra, ok := whichTrack.extra.(*av1ExtraData)
+            if !ok {
+                panic("must init av1ExtraData first")
+            }
+            avpkg.Data = demuxer.processAV1(sample, extra)
         } else if whichTrack.cid == MP4_CODEC_AAC {
             aacExtra, ok := whichTrack.extra.(*aacExtraData)
             if !ok {
@@ -381,15 +619,211 @@ func (demuxer *MovDemuxer) ReadPacket() (*AVPacket, error) {
                 return nil, err
             }
             avpkg.Data = append(adts.Encode(), sample...)
+        } else if whichTrack.cid == MP4_CODEC_LPCM && whichTrack.pcmBigEndian && whichTrack.sampleBits == 16 {
+            for i := 0; i+1 < len(sample); i += 2 {
+                sample[i], sample[i+1] = sample[i+1], sample[i]
+            }
+            avpkg.Data = sample
+        } else if whichTrack.cid == MP4_CODEC_WEBVTT || whichTrack.cid == MP4_CODEC_TX3G {
+            avpkg.Data = parseTextSample(whichTrack.cid, sample)
         } else {
             avpkg.Data = sample
         }
-        if len(avpkg.Data) > 0 {
+        //字幕的空sample表示之前的字幕结束
+        if len(avpkg.Data) > 0 || (isText(whichTrack.cid) && sample != nil) {
             return avpkg, nil
         }
     }
 }
 
+//读取sample数据, 同一个chunk(fmp4为同一个trun)内连续的sample合并为一次读取
+//forward only模式下sample不在当前mdat中, 这个sample被跳过, 可以继续调用ReadPacket
+var ErrSampleNotInMdat = errors.New("sample not in current mdat")
+
+func (demuxer *MovDemuxer) readSample(track *mp4track, idx int, sample sampleEntry) ([]byte, error) {
+    if demuxer.forwardOnly {
+        if sample.offset < demuxer.streamMdatOffset || sample.offset+sample.size > demuxer.streamMdatOffset+uint64(len(demuxer.streamMdat)) {
+            return nil, ErrSampleNotInMdat
+        }
+        start := sample.offset - demuxer.streamMdatOffset
+        return demuxer.streamMdat[start : start+sample.size : start+sample.size], nil
+    }
+    end := sample.offset + sample.size
+    if sample.offset < track.chunkBufOffset || end > track.chunkBufOffset+uint64(len(track.chunkBuf)) {
+        chunkEnd := track.chunkEnd(idx, sample)
+        if chunkEnd > sample.offset+maxChunkReadSize {
+            chunkEnd = sample.offset + maxChunkReadSize
+        }
+        if chunkEnd < end {
+            chunkEnd = end
+        }
+        if _, err := demuxer.reader.Seek(int64(sample.offset), io.SeekStart); err != nil {
+            return nil, err
+        }
+        buf := make([]byte, chunkEnd-sample.offset)
+        n, err := io.ReadFull(demuxer.reader, buf)
+        if err != nil && (err != io.ErrUnexpectedEOF || uint64(n) < sample.size) {
+            track.chunkBuf = nil
+            return nil, err
+        }
+        track.chunkBuf = buf[:n]
+        track.chunkBufOffset = sample.offset
+    }
+    //限制cap, 避免后续append覆盖下一个sample
+    start := sample.offset - track.chunkBufOffset
+    return track.chunkBuf[start : start+sample.size : start+sample.size], nil
+}
+
+func (demuxer *MovDemuxer) fillTimestamp(avpkg *AVPacket, track *mp4track, sample sampleEntry) {
+    timescale := int64(track.timescale)
+    pts, dts, inEdit := demuxer.presentationTime(track, sample)
+    avpkg.MediaPts = int64(sample.pts) * 1000 / timescale
+    avpkg.MediaDts = int64(sample.dts) * 1000 / timescale
+    avpkg.Trimmed = !inEdit
+    shift := demuxer.timestampShift()
+    if pts = pts*1000/timescale + shift; pts > 0 {
+        avpkg.Pts = uint64(pts)
+    }
+    if dts = dts*1000/timescale + shift; dts > 0 {
+        avpkg.Dts = uint64(dts)
+    }
+}
+
+//负的composition offset用edit list修正之后, 开头几帧的展示dts小于0
+//所有track按最小的dts一起平移, 保证dts单调递增并且音视频保持同步
+//每个track只看第一个在edit list范围内的sample, 范围之前被裁剪掉的sample不参与计算
+func (demuxer *MovDemuxer) timestampShift() int64 {
+    if demuxer.tsShiftReady {
+        return demuxer.tsShift
+    }
+    for _, track := range demuxer.tracks {
+        for i := 0; i < track.sampleCount(); i++ {
+            _, dts, inEdit := demuxer.presentationTime(track, track.sampleAt(i))
+            if !inEdit {
+                continue
+            }
+            if dts = -dts * 1000 / int64(track.timescale); dts > demuxer.tsShift {
+                demuxer.tsShift = dts
+            }
+            demuxer.tsShiftReady = true
+            break
+        }
+    }
+    return demuxer.tsShift
+}
+
+//应用edit list之后的pts/dts, 单位为track timescale
+func (demuxer *MovDemuxer) presentationTime(track *mp4track, sample sampleEntry) (pts int64, dts int64, inEdit bool) {
+    mediaPts := int64(sample.pts)
+    mediaDts := int64(sample.dts)
+    pts, rate, inEdit := track.mediaToPresentation(mediaPts, demuxer.mp4Info.Timescale)
+    dts = pts - int64(float64(mediaPts-mediaDts)/rate)
+    return
+}
+
+//标记关键帧, 生成每个track的syncSamples
+//mp4: stss, 没有stss时所有sample都是关键帧(allSync)
+//fmp4: trun/tfhd/trex中的sample flags, 如果存在tfra, 以tfra为准
+func (demuxer *MovDemuxer) buildSyncSamples() {
+    for _, track := range demuxer.tracks {
+        track.syncSamples = track.syncSamples[:0]
+        track.allSync = false
+        if track.sampleIter != nil {
+            if track.sampleIter.allSync {
+                track.allSync = true
+                continue
+            }
+            for _, number := range track.stbltable.stss.sampleNumber {
+                if number >= 1 && int(number) <= track.sampleIter.count {
+                    track.syncSamples = append(track.syncSamples, int(number-1))
+                }
+            }
+            if len(track.syncSamples) == 0 && track.sampleIter.count > 0 {
+                track.syncSamples = append(track.syncSamples, 0)
+            }
+            continue
+        }
+        if demuxer.isFragement {
+            if len(track.tfra) > 0 {
+                for i := range track.samplelist {
+                    track.samplelist[i].isKeyFrame = false
+                }
+                for _, entry := range track.tfra {
+                    if idx := track.findTfraSample(entry); idx >= 0 {
+                        track.samplelist[idx].isKeyFrame = true
+                    }
+                }
+            }
+        } else if track.stbltable != nil && track.stbltable.stss != nil && len(track.stbltable.stss.sampleNumber) > 0 {
+            for _, number := range track.stbltable.stss.sampleNumber {
+                if number >= 1 && int(number) <= len(track.samplelist) {
+                    track.samplelist[number-1].isKeyFrame = true
+                }
+            }
+        } else {
+            for i := range track.samplelist {
+                track.samplelist[i].isKeyFrame = true
+            }
+        }
+        if !isVideo(track.cid) {
+            for i := range track.samplelist {
+                track.samplelist[i].isKeyFrame = true
+            }
+        }
+        for i := range track.samplelist {
+            if track.samplelist[i].isKeyFrame {
+                track.syncSamples = append(track.syncSamples, i)
+            }
+        }
+        if len(track.syncSamples) == 0 && len(track.samplelist) > 0 {
+            track.samplelist[0].isKeyFrame = true
+            track.syncSamples = append(track.syncSamples, 0)
+        }
+    }
+}
+
+//根据moof_offset和time定位tfra指向的sample, 找不到时使用trun_number/sample_number
+//很多muxer的traf_number/trun_number/sample_number固定写1, 所以优先匹配time
+func (track *mp4track) findTfraSample(entry fragEntry) int {
+    first := -1
+    end := len(track.samplelist)
+    for i, run := range track.fragmentRuns {
+        if run.moofOffset != entry.moofOffset {
+            if first >= 0 {
+                end = run.firstSample
+                break
+            }
+            continue
+        }
+        if first < 0 {
+            first = i
+        }
+    }
+    if first < 0 {
+        return -1
+    }
+    start := track.fragmentRuns[first].firstSample
+    for idx := start; idx < end; idx++ {
+        if track.samplelist[idx].pts == entry.time || track.samplelist[idx].dts == entry.time {
+            return idx
+        }
+    }
+    for _, run := range track.fragmentRuns[first:] {
+        if run.moofOffset != entry.moofOffset {
+            break
+        }
+        if run.trunNumber == entry.trunNumber {
+            if idx := run.firstSample + int(entry.sampleNumber) - 1; idx >= run.firstSample && idx < end {
+                return idx
+            }
+        }
+    }
+    if start < end {
+        return start
+    }
+    return -1
+}
+
 func (demuxer *MovDemuxer) GetSyncTable(trackId uint32) ([]SyncSample, error) {
     var track *mp4track = nil
     for i := 0; i < len(demuxer.tracks); i++ {
@@ -402,107 +836,118 @@ func (demuxer *MovDemuxer) GetSyncTable(trackId uint32) ([]SyncSample, error) {
         return nil, errors.New("not found track")
     }
 
-    if track.stbltable == nil || track.stbltable.stss == nil {
-        return nil, errors.New("not found stss box")
+    if track.syncSampleCount() == 0 {
+        return nil, errors.New("not found sync sample")
     }
 
-    syncTable := make([]SyncSample, len(track.stbltable.stss.sampleNumber))
+    syncTable := make([]SyncSample, track.syncSampleCount())
 
     for i := 0; i < len(syncTable); i++ {
-        idx := track.stbltable.stss.sampleNumber[i] - 1
+        sample := track.sampleAt(track.syncSampleAt(i))
         syncTable[i] = SyncSample{
-            Pts:    track.samplelist[idx].pts * 1000 / uint64(track.timescale),
-            Dts:    track.samplelist[idx].dts * 1000 / uint64(track.timescale),
-            Offset: uint32(track.samplelist[idx].offset),
-            Size:   uint32(track.samplelist[idx].size),
+            Pts:    sample.pts * 1000 / uint64(track.timescale),
+            Dts:    sample.dts * 1000 / uint64(track.timescale),
+            Offset: sample.offset,
+            Size:   uint32(sample.size),
         }
     }
     return syncTable, nil
 }
 
+//跳转到目标时间之前最近的关键帧, dts单位ms
 func (demuxer *MovDemuxer) SeekTime(dts uint64) error {
+    return demuxer.SeekTimeWithMode(dts, SEEK_PREVIOUS_KEYFRAME)
+}
+
+// 时间单位ms, 与AVPacket.Pts一致(应用edit list之后的展示时间)
+// 存在视频轨道时, 先在第一个视频轨道中二分查找关键帧, 其余轨道对齐到这个关键帧的时间
+// 没有视频轨道时, 每个轨道定位到覆盖目标时间的sample
+func (demuxer *MovDemuxer) SeekTimeWithMode(ms uint64, mode SeekMode) error {
+    if demuxer.readSampleIdx == nil {
+        return errors.New("call ReadHead first")
+    }
+    if demuxer.forwardOnly {
+        return errors.New("forward only demuxer can not seek")
+    }
+    target := int64(ms)
+    alignTime := target
+    refTrack := -1
     for i, track := range demuxer.tracks {
-        for j := 0; j < len(track.samplelist); j++ {
-            if track.samplelist[j].dts*1000/uint64(track.timescale) < dts {
-                continue
-            }
-            demuxer.readSampleIdx[i] = uint32(j)
+        if isVideo(track.cid) && track.syncSampleCount() > 0 {
+            refTrack = i
             break
         }
     }
-    return nil
-}
-
-func (demuxer *MovDemuxer) buildSampleList() {
-    for _, track := range demuxer.tracks {
-        stbl := track.stbltable
-        chunks := make([]movchunk, stbl.stco.entryCount)
-        iterator := 0
-        for i := 0; i < int(stbl.stco.entryCount); i++ {
-            chunks[i].chunknum = uint32(i + 1)
-            chunks[i].chunkoffset = stbl.stco.chunkOffsetlist[i]
-            for iterator+1 < int(stbl.stsc.entryCount) && stbl.stsc.entrys[iterator+1].firstChunk <= chunks[i].chunknum {
-                iterator++
-            }
-            chunks[i].samplenum = stbl.stsc.entrys[iterator].samplesPerChunk
+    if refTrack >= 0 {
+        track := demuxer.tracks[refTrack]
+        idx := demuxer.searchSyncSample(track, target, mode)
+        demuxer.readSampleIdx[refTrack] = uint32(idx)
+        if mode != SEEK_EXACT {
+            alignTime = demuxer.samplePts(track, idx)
         }
-        track.samplelist = make([]sampleEntry, stbl.stsz.sampleCount)
-        for i := range track.samplelist {
-            if stbl.stsz.sampleSize == 0 {
-                track.samplelist[i].size = uint64(stbl.stsz.entrySizelist[i])
-            } else {
-                track.samplelist[i].size = uint64(stbl.stsz.sampleSize)
-            }
+    }
+
+    for i, track := range demuxer.tracks {
+        if i == refTrack || track.sampleCount() == 0 {
+            continue
         }
-        iterator = 0
-        for i := range chunks {
-            for j := 0; j < int(chunks[i].samplenum); j++ {
-                if iterator >= len(track.samplelist) {
-                    break
-                }
-                if j == 0 {
-                    track.samplelist[iterator].offset = chunks[i].chunkoffset
-                } else {
-                    track.samplelist[iterator].offset = track.samplelist[iterator-1].offset + track.samplelist[iterator-1].size
-                }
-                iterator++
-            }
+        if isVideo(track.cid) && track.syncSampleCount() > 0 {
+            demuxer.readSampleIdx[i] = uint32(demuxer.searchSyncSample(track, alignTime, SEEK_PREVIOUS_KEYFRAME))
+            continue
         }
-        iterator = 0
-        track.samplelist[iterator].dts = 0
-        if track.elst != nil {
-            for _, entry := range track.elst.entrys {
-                if entry.mediaTime == -1 {
-                    track.samplelist[iterator].dts = entry.segmentDuration
-                }
-            }
-        }
-        iterator++
-        for i := range stbl.stts.entrys {
-            for j := 0; j < int(stbl.stts.entrys[i].sampleCount); j++ {
-                if iterator == len(track.samplelist) {
-                    break
-                }
-                track.samplelist[iterator].dts = uint64(stbl.stts.entrys[i].sampleDelta) + track.samplelist[iterator-1].dts
-                iterator++
-            }
+        n := sort.Search(track.sampleCount(), func(j int) bool {
+            return demuxer.sampleDts(track, j) > alignTime
+        })
+        if n > 0 {
+            n--
         }
+        demuxer.readSampleIdx[i] = uint32(n)
+    }
 
-        // no ctts table, so pts == dts
-        if stbl.ctts == nil || stbl.ctts.entryCount == 0 {
-            for i := range track.samplelist {
-                track.samplelist[i].pts = track.samplelist[i].dts
-            }
-        } else {
-            iterator = 0
-            for i := range stbl.ctts.entrys {
-                for j := 0; j < int(stbl.ctts.entrys[i].sampleCount); j++ {
-                    track.samplelist[iterator].pts = track.samplelist[iterator].dts + uint64(stbl.ctts.entrys[i].sampleOffset)
-                    iterator++
-                }
-            }
+    for _, track := range demuxer.tracks {
+        track.chunkBuf = nil
+    }
+    if mode == SEEK_EXACT {
+        demuxer.prerollTime = target
+    } else {
+        demuxer.prerollTime = 0
+    }
+    return nil
+}
+
+//在syncSamples中二分查找, 返回sample下标
+func (demuxer *MovDemuxer) searchSyncSample(track *mp4track, target int64, mode SeekMode) int {
+    count := track.syncSampleCount()
+    n := sort.Search(count, func(i int) bool {
+        return demuxer.samplePts(track, track.syncSampleAt(i)) > target
+    })
+    if n == 0 {
+        return track.syncSampleAt(0)
+    }
+    if mode == SEEK_NEAREST_KEYFRAME && n < count {
+        if demuxer.samplePts(track, track.syncSampleAt(n))-target < target-demuxer.samplePts(track, track.syncSampleAt(n-1)) {
+            return track.syncSampleAt(n)
         }
     }
+    return track.syncSampleAt(n - 1)
+}
+
+func (demuxer *MovDemuxer) samplePts(track *mp4track, idx int) int64 {
+    pts, _, _ := demuxer.presentationTime(track, track.sampleAt(idx))
+    return pts*1000/int64(track.timescale) + demuxer.timestampShift()
+}
+
+func (demuxer *MovDemuxer) sampleDts(track *mp4track, idx int) int64 {
+    _, dts, _ := demuxer.presentationTime(track, track.sampleAt(idx))
+    return dts*1000/int64(track.timescale) + demuxer.timestampShift()
+}
+
+func (demuxer *MovDemuxer) buildSampleIterator() {
+    for _, track := range demuxer.tracks {
+        stbl := track.stbltable
+        allSync := !isVideo(track.cid) || stbl == nil || stbl.stss == nil || len(stbl.stss.sampleNumber) == 0
+        track.sampleIter = newSampleIterator(stbl, allSync)
+    }
 }
 
 func (demuxer *MovDemuxer) processH264(avcc []byte, extra *h264ExtraData) []byte {
@@ -615,3 +1060,26 @@ func (demuxer *MovDemuxer) processH265(hvcc []byte, extra *h265ExtraData) []byte
     out = append(out, hvcc...)
     return out
 }
+
+// 关键帧前面如果没有sequence header,就从av1C中取出来放在前面
+func (demuxer *MovDemuxer) processAV1(av1 []byte, extra *av1ExtraData) []byte {
+    if !codec.IsAV1KeyFrame(av1) {
+        return av1
+    }
+    hasSeqHdr := false
+    codec.SplitAV1OBU(av1, func(obu []byte) bool {
+        if codec.AV1ObuType(obu) == codec.AV1_OBU_SEQUENCE_HEADER {
+            hasSeqHdr = true
+            return false
+        }
+        return true
+    })
+    if hasSeqHdr {
+        return av1
+    }
+    seqHdr := extra.av1cExtra.SequenceHeader()
+    out := make([]byte, len(seqHdr)+len(av1))
+    copy(out, seqHdr)
+    copy(out[len(seqHdr):], av1)
+    return out
+}
@@ -1,9 +1,12 @@
 package mp4
 
 import (
+    "bytes"
+    "encoding/binary"
     "fmt"
     "io"
     "os"
+    "reflect"
     "testing"
 )
 
@@ -40,3 +43,379 @@ func TestCreateMovDemuxer(t *testing.T) {
         }
     }
 }
+
+func TestMediaToPresentation(t *testing.T) {
+	edit := func(duration uint64, mediaTime int64, rate int16) elstEntry {
+		return elstEntry{segmentDuration: duration, mediaTime: mediaTime, mediaRateInteger: rate}
+	}
+	tests := []struct {
+		name      string
+		edits     []elstEntry
+		mediaTime int64
+		want      int64
+		wantIn    bool
+	}{
+		{name: "no edit list", mediaTime: 9000, want: 9000, wantIn: true},
+		{name: "empty edit", edits: []elstEntry{edit(500, -1, 1), edit(1000, 0, 1)}, mediaTime: 0, want: 45000, wantIn: true},
+		{name: "media time offset", edits: []elstEntry{edit(1000, 3000, 1)}, mediaTime: 3000, want: 0, wantIn: true},
+		{name: "trimmed start", edits: []elstEntry{edit(1000, 3000, 1)}, mediaTime: 0, want: -3000, wantIn: false},
+		{name: "last edit is open ended", edits: []elstEntry{edit(1000, 0, 1)}, mediaTime: 180000, want: 180000, wantIn: true},
+		{name: "rate 2", edits: []elstEntry{edit(1000, 0, 2), edit(1000, 180000, 1)}, mediaTime: 90000, want: 45000, wantIn: true},
+		{name: "second edit", edits: []elstEntry{edit(1000, 0, 1), edit(1000, 450000, 1)}, mediaTime: 495000, want: 135000, wantIn: true},
+		{name: "gap between edits", edits: []elstEntry{edit(1000, 0, 1), edit(1000, 450000, 1)}, mediaTime: 180000, want: 180000, wantIn: false},
+		{name: "dwell", edits: []elstEntry{edit(1000, 9000, 0), edit(1000, 9000, 1)}, mediaTime: 9000, want: 0, wantIn: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := &mp4track{timescale: 90000}
+			if len(tt.edits) > 0 {
+				track.elst = &movelst{entryCount: uint32(len(tt.edits)), entrys: tt.edits}
+			}
+			got, _, in := track.mediaToPresentation(tt.mediaTime, 1000)
+			if got != tt.want || in != tt.wantIn {
+				t.Errorf("mediaToPresentation(%d) = %d %v, want %d %v", tt.mediaTime, got, in, tt.want, tt.wantIn)
+			}
+		})
+	}
+}
+
+func TestFillTimestamp(t *testing.T) {
+	//composition offset为2帧, edit list从6000开始, 开头两帧的展示dts小于0
+	video := &mp4track{timescale: 90000, elst: &movelst{entryCount: 1, entrys: []elstEntry{{segmentDuration: 1000, mediaTime: 6000, mediaRateInteger: 1}}},
+		samplelist: []sampleEntry{{dts: 0, pts: 6000}, {dts: 3000, pts: 15000}, {dts: 6000, pts: 9000}, {dts: 9000, pts: 12000}}}
+	audio := &mp4track{timescale: 1000, samplelist: []sampleEntry{{dts: 0, pts: 0}, {dts: 20, pts: 20}}}
+	demuxer := &MovDemuxer{tracks: []*mp4track{video, audio}}
+	demuxer.mp4Info.Timescale = 1000
+	tests := []struct {
+		name    string
+		track   *mp4track
+		sample  sampleEntry
+		pts     uint64
+		dts     uint64
+		trimmed bool
+	}{
+		{name: "i frame", track: video, sample: video.samplelist[0], pts: 66, dts: 0},
+		{name: "p frame", track: video, sample: video.samplelist[1], pts: 166, dts: 33},
+		{name: "b frame", track: video, sample: video.samplelist[2], pts: 99, dts: 66},
+		{name: "b frame 2", track: video, sample: video.samplelist[3], pts: 132, dts: 99},
+		{name: "before edit", track: video, sample: sampleEntry{dts: 0, pts: 3000}, pts: 33, dts: 0, trimmed: true},
+		{name: "audio shifted with video", track: audio, sample: audio.samplelist[1], pts: 86, dts: 86},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkg := &AVPacket{}
+			demuxer.fillTimestamp(pkg, tt.track, tt.sample)
+			if pkg.Pts != tt.pts || pkg.Dts != tt.dts || pkg.Trimmed != tt.trimmed {
+				t.Errorf("fillTimestamp() pts = %d dts = %d trimmed = %v, want %d %d %v", pkg.Pts, pkg.Dts, pkg.Trimmed, tt.pts, tt.dts, tt.trimmed)
+			}
+			timescale := int64(tt.track.timescale)
+			if pkg.MediaPts != int64(tt.sample.pts)*1000/timescale || pkg.MediaDts != int64(tt.sample.dts)*1000/timescale {
+				t.Errorf("fillTimestamp() media pts = %d dts = %d", pkg.MediaPts, pkg.MediaDts)
+			}
+		})
+	}
+}
+
+func newSeekTestDemuxer() *MovDemuxer {
+	video := &mp4track{cid: MP4_CODEC_H264, timescale: 1000, stbltable: &movstbl{stss: &movstss{sampleNumber: []uint32{1, 11, 21}}}}
+	for i := 0; i < 30; i++ {
+		video.samplelist = append(video.samplelist, sampleEntry{dts: uint64(i * 40), pts: uint64(i * 40)})
+	}
+	audio := &mp4track{cid: MP4_CODEC_AAC, timescale: 1000}
+	for i := 0; i < 60; i++ {
+		audio.samplelist = append(audio.samplelist, sampleEntry{dts: uint64(i * 20), pts: uint64(i * 20)})
+	}
+	demuxer := &MovDemuxer{tracks: []*mp4track{audio, video}}
+	demuxer.mp4Info.Timescale = 1000
+	demuxer.readSampleIdx = make([]uint32, 2)
+	demuxer.buildSyncSamples()
+	return demuxer
+}
+
+func TestMovDemuxer_SeekTimeWithMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		ms      uint64
+		mode    SeekMode
+		audio   uint32
+		video   uint32
+		preroll int64
+	}{
+		{name: "previous keyframe", ms: 500, mode: SEEK_PREVIOUS_KEYFRAME, audio: 20, video: 10},
+		{name: "on keyframe", ms: 800, mode: SEEK_PREVIOUS_KEYFRAME, audio: 40, video: 20},
+		{name: "nearest keyframe", ms: 700, mode: SEEK_NEAREST_KEYFRAME, audio: 40, video: 20},
+		{name: "nearest previous keyframe", ms: 550, mode: SEEK_NEAREST_KEYFRAME, audio: 20, video: 10},
+		{name: "exact", ms: 500, mode: SEEK_EXACT, audio: 25, video: 10, preroll: 500},
+		{name: "start", ms: 0, mode: SEEK_EXACT, audio: 0, video: 0},
+		{name: "beyond end", ms: 5000, mode: SEEK_NEAREST_KEYFRAME, audio: 40, video: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			demuxer := newSeekTestDemuxer()
+			if err := demuxer.SeekTimeWithMode(tt.ms, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if demuxer.readSampleIdx[0] != tt.audio || demuxer.readSampleIdx[1] != tt.video || demuxer.prerollTime != tt.preroll {
+				t.Errorf("SeekTimeWithMode() audio = %d video = %d preroll = %d, want %d %d %d",
+					demuxer.readSampleIdx[0], demuxer.readSampleIdx[1], demuxer.prerollTime, tt.audio, tt.video, tt.preroll)
+			}
+		})
+	}
+	if err := new(MovDemuxer).SeekTime(0); err == nil {
+		t.Errorf("SeekTime() before ReadHead should fail")
+	}
+}
+
+func TestMovDemuxer_buildSyncSamples(t *testing.T) {
+	track := &mp4track{cid: MP4_CODEC_H264, timescale: 1000}
+	//两个moof, 第二个moof有两个trun
+	track.fragmentRuns = []fragmentRun{
+		{moofOffset: 100, trunNumber: 1, firstSample: 0},
+		{moofOffset: 500, trunNumber: 1, firstSample: 4},
+		{moofOffset: 500, trunNumber: 2, firstSample: 6},
+	}
+	for i := 0; i < 8; i++ {
+		track.samplelist = append(track.samplelist, sampleEntry{dts: uint64(i * 40), pts: uint64(i * 40), isKeyFrame: i == 0})
+	}
+	demuxer := &MovDemuxer{tracks: []*mp4track{track}, isFragement: true}
+	demuxer.buildSyncSamples()
+	if !reflect.DeepEqual(track.syncSamples, []int{0}) {
+		t.Errorf("syncSamples from trun flags = %v", track.syncSamples)
+	}
+
+	track.tfra = []fragEntry{
+		{time: 0, moofOffset: 100, trafNumber: 1, trunNumber: 1, sampleNumber: 1},
+		{time: 999, moofOffset: 500, trafNumber: 1, trunNumber: 2, sampleNumber: 2},
+		{time: 200, moofOffset: 500, trafNumber: 1, trunNumber: 1, sampleNumber: 1},
+	}
+	demuxer.buildSyncSamples()
+	if !reflect.DeepEqual(track.syncSamples, []int{0, 5, 7}) {
+		t.Errorf("syncSamples from tfra = %v, want [0 5 7]", track.syncSamples)
+	}
+}
+
+func TestSampleIterator(t *testing.T) {
+	stbl := &movstbl{
+		stts: &movstts{entrys: []sttsEntry{{sampleCount: 3, sampleDelta: 100}, {sampleCount: 4, sampleDelta: 50}}},
+		ctts: &movctts{entrys: []cttsEntry{{sampleCount: 1, sampleOffset: 200}, {sampleCount: 2, sampleOffset: 0}, {sampleCount: 1, sampleOffset: 0xFFFFFF9C}}},
+		stsc: &movstsc{entrys: []stscEntry{{firstChunk: 1, samplesPerChunk: 2, sampleDescriptionIndex: 1}, {firstChunk: 3, samplesPerChunk: 3, sampleDescriptionIndex: 1}}},
+		stsz: &movstsz{sampleCount: 8, entrySizelist: []uint32{10, 20, 30, 40, 50, 60, 70, 80}},
+		stco: &movstco{chunkOffsetlist: []uint64{1000, 2000, 3000}},
+		stss: &movstss{sampleNumber: []uint32{1, 5}},
+	}
+	want := []sampleEntry{
+		{dts: 0, pts: 200, offset: 1000, size: 10, isKeyFrame: true},
+		{dts: 100, pts: 100, offset: 1010, size: 20},
+		{dts: 200, pts: 200, offset: 2000, size: 30},
+		{dts: 300, pts: 200, offset: 2030, size: 40},
+		{dts: 350, pts: 350, offset: 3000, size: 50, isKeyFrame: true},
+		{dts: 400, pts: 400, offset: 3050, size: 60},
+		{dts: 450, pts: 450, offset: 3110, size: 70},
+	}
+	it := newSampleIterator(stbl, false)
+	if it.count != len(want) {
+		t.Fatalf("sample count = %d, want %d", it.count, len(want))
+	}
+	check := func(i int) {
+		got := it.sampleAt(i)
+		got.SampleDescriptionIndex = 0
+		if got != want[i] {
+			t.Errorf("sampleAt(%d) = %+v, want %+v", i, got, want[i])
+		}
+	}
+	for i := range want {
+		check(i)
+	}
+	for _, i := range []int{6, 2, 5, 0, 3, 3, 4, 1} {
+		check(i)
+	}
+	it.sampleAt(5)
+	if it.chunkEnd() != 3180 {
+		t.Errorf("chunkEnd() = %d, want 3180", it.chunkEnd())
+	}
+	it.sampleAt(1)
+	if it.chunkEnd() != 1030 {
+		t.Errorf("chunkEnd() = %d, want 1030", it.chunkEnd())
+	}
+}
+
+func TestCreateFmp4StreamDemuxer(t *testing.T) {
+	data := muxTestBuffer(t, boxTreeTestStream, WithMp4Flag(MP4_FLAG_FRAGMENT))
+	want := readAllPackets(t, data)
+	//只实现io.Reader, 不能Seek
+	got, err := readDemuxerPackets(CreateFmp4StreamDemuxer(struct{ io.Reader }{bytes.NewReader(data)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != 20 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("stream demuxer got %d packets, want %d", len(got), len(want))
+	}
+	for i, pkg := range got {
+		if pkg.Pts != uint64(i*20) || !bytes.Equal(pkg.Data, bytes.Repeat([]byte{byte(i)}, 160)) {
+			t.Errorf("packet %d pts = %d data = %x", i, pkg.Pts, pkg.Data[:4])
+		}
+	}
+	if err := CreateFmp4StreamDemuxer(bytes.NewReader(data)).SeekTime(0); err == nil {
+		t.Errorf("SeekTime() before ReadHead should fail")
+	}
+}
+
+func TestMovDemuxer_Decryption(t *testing.T) {
+	kid := [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	key := []byte("0123456789abcdef")
+	//第5帧视频之后切一个fragment
+	stream := muxTestStream{videoFrames: 10, gop: 5, varySize: true, flushEvery: 10}
+	want := readAllPackets(t, muxTestBuffer(t, stream, WithMp4Flag(MP4_FLAG_FRAGMENT)))
+	if len(want) != 30 {
+		t.Fatalf("clear stream got %d packets", len(want))
+	}
+
+	tests := []struct {
+		name    string
+		scheme  ProtectionScheme
+		keys    map[[16]byte][]byte
+		wantErr bool
+	}{
+		{name: "cenc", scheme: PROTECTION_SCHEME_CENC, keys: map[[16]byte][]byte{kid: key}},
+		{name: "cbcs", scheme: PROTECTION_SCHEME_CBCS, keys: map[[16]byte][]byte{kid: key}},
+		{name: "missing key", scheme: PROTECTION_SCHEME_CENC, keys: map[[16]byte][]byte{{}: key}, wantErr: true},
+		{name: "invalid key", scheme: PROTECTION_SCHEME_CBCS, keys: map[[16]byte][]byte{kid: key[:7]}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := muxTestBuffer(t, stream, WithMp4Flag(MP4_FLAG_FRAGMENT), WithEncryption(tt.scheme, kid, key))
+			if encrypted := readAllPackets(t, buf); reflect.DeepEqual(encrypted, want) {
+				t.Fatalf("demux without keys, packets should stay encrypted")
+			}
+
+			demuxer := CreateMp4Demuxer(bytes.NewReader(buf), WithDecryptionKeys(tt.keys))
+			rawSamples := 0
+			demuxer.OnRawSample = func(cid MP4_CODEC_TYPE, sample []byte, sub *SubSample) error {
+				if sub == nil {
+					t.Errorf("%v sample %d has no SubSample", cid, rawSamples)
+				}
+				rawSamples++
+				return nil
+			}
+			got, err := readDemuxerPackets(demuxer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadPacket() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if rawSamples != 30 || !reflect.DeepEqual(got, want) {
+				t.Errorf("decrypted %d packets (%d raw samples), want %d clear packets", len(got), rawSamples, len(want))
+			}
+			got, err = readDemuxerPackets(CreateFmp4StreamDemuxer(struct{ io.Reader }{bytes.NewReader(buf)}, WithDecryptionKeys(tt.keys)))
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("stream demuxer decrypted %d packets, err = %v", len(got), err)
+			}
+		})
+	}
+}
+
+func TestMovDemuxer_readBoxHeader(t *testing.T) {
+	data := muxTestBuffer(t, boxTreeTestStream)
+	want := readAllPackets(t, data)
+	var faststart bytes.Buffer
+	if err := FastStart(bytes.NewReader(data), &faststart); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data func() []byte
+	}{
+		{name: "largesize mdat", data: func() []byte {
+			//ftyp(32) free(8) mdat, free和mdat头合成64位mdat头
+			out := append([]byte{}, data...)
+			mdatSize := binary.BigEndian.Uint32(out[40:])
+			binary.BigEndian.PutUint32(out[32:], 1)
+			copy(out[36:], "mdat")
+			binary.BigEndian.PutUint64(out[40:], uint64(mdatSize)+8)
+			return out
+		}},
+		{name: "mdat extends to end of file", data: func() []byte {
+			out := append([]byte{}, faststart.Bytes()...)
+			tree, err := ParseBoxTree(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			binary.BigEndian.PutUint32(out[tree.Find("mdat").Offset:], 0)
+			return out
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readAllPackets(t, tt.data()); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %d packets, want %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestMovDemuxer_makeSubSample(t *testing.T) {
+	videoKID := [16]byte{0x01}
+	audioKID := [16]byte{0x02}
+	video := &mp4track{defaultKID: videoKID, defaultCryptByteBlock: 1, defaultSkipByteBlock: 9}
+	for i := 0; i < 3; i++ {
+		video.subSamples = append(video.subSamples, sencEntry{
+			iv:         []byte{byte(i), 1, 2, 3, 4, 5, 6, 7},
+			subSamples: []subSampleEntry{{bytesOfClearData: uint16(i), bytesOfProtectedData: 16}},
+		})
+	}
+	audio := &mp4track{defaultKID: audioKID, defaultConstantIV: []byte("fedcba9876543210"), subSamples: make([]sencEntry, 1)}
+	demuxer := &MovDemuxer{tracks: []*mp4track{video, audio}}
+	tests := []struct {
+		name  string
+		track *mp4track
+		idx   uint32
+		want  *SubSample
+	}{
+		{name: "video", track: video, idx: 2, want: &SubSample{Number: 2, KID: videoKID, IV: [16]byte{2, 1, 2, 3, 4, 5, 6, 7},
+			CryptByteBlock: 1, SkipByteBlock: 9, Patterns: []SubSamplePattern{{BytesClear: 2, BytesProtected: 16}}}},
+		{name: "audio constant iv", track: audio, idx: 0, want: &SubSample{Number: 0, KID: audioKID, IV: [16]byte{'f', 'e', 'd', 'c', 'b', 'a', '9', '8', '7', '6', '5', '4', '3', '2', '1', '0'}}},
+		{name: "clear sample", track: audio, idx: 1, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := demuxer.makeSubSample(tt.track, tt.idx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeSubSample() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateFmp4StreamDemuxer_SampleNotInMdat(t *testing.T) {
+	data := muxTestBuffer(t, boxTreeTestStream, WithMp4Flag(MP4_FLAG_FRAGMENT))
+	//第二个moof的trun data_offset指向mdat之外
+	trun := bytes.Index(data, []byte("trun"))
+	trun += 4 + bytes.Index(data[trun+4:], []byte("trun"))
+	if binary.BigEndian.Uint32(data[trun+4:])&0x01 == 0 {
+		t.Fatal("trun has no data_offset")
+	}
+	binary.BigEndian.PutUint32(data[trun+12:], binary.BigEndian.Uint32(data[trun+12:])+10000)
+
+	demuxer := CreateFmp4StreamDemuxer(struct{ io.Reader }{bytes.NewReader(data)})
+	if _, err := demuxer.ReadHead(); err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	lost := 0
+	for {
+		pkg, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			break
+		} else if err == ErrSampleNotInMdat {
+			lost++
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, pkg.Data[0])
+	}
+	want := []byte{0, 1, 2, 3, 4, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}
+	if lost != 5 || !bytes.Equal(got, want) {
+		t.Errorf("ReadPacket() lost %d samples, got %v, want 5 lost and %v", lost, got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package mp4
+
+import "sort"
+
+// 单次合并读取的上限, chunk超过这个大小时分多次读
+const maxChunkReadSize = 4 << 20
+
+// 按需遍历stts/ctts/stsc/stco/stsz/stss, 不展开整个samplelist
+// 顺序读取时每个sample O(1), 随机访问时二分查找表项 O(log n)
+type sampleIterator struct {
+	stbl    *movstbl
+	count   int
+	allSync bool
+
+	//每个表项第一个sample的下标
+	sttsFirst []int
+	sttsDts   []uint64
+	cttsFirst []int
+	stscFirst []int
+
+	//当前位置
+	idx        int
+	sample     sampleEntry
+	sttsIdx    int
+	cttsIdx    int
+	stscIdx    int
+	stssIdx    int
+	chunk      int //当前sample所在的chunk, 从0开始
+	chunkFirst int //chunk中第一个sample的下标
+}
+
+func newSampleIterator(stbl *movstbl, allSync bool) *sampleIterator {
+	it := &sampleIterator{stbl: stbl, allSync: allSync, idx: -1}
+	if stbl == nil || stbl.stsz == nil || stbl.stsc == nil || stbl.stco == nil || len(stbl.stsc.entrys) == 0 {
+		return it
+	}
+	if stbl.stts != nil {
+		it.sttsFirst = make([]int, len(stbl.stts.entrys))
+		it.sttsDts = make([]uint64, len(stbl.stts.entrys))
+		first, dts := 0, uint64(0)
+		for i, entry := range stbl.stts.entrys {
+			it.sttsFirst[i] = first
+			it.sttsDts[i] = dts
+			first += int(entry.sampleCount)
+			dts += uint64(entry.sampleCount) * uint64(entry.sampleDelta)
+		}
+	}
+	if stbl.ctts != nil {
+		it.cttsFirst = make([]int, len(stbl.ctts.entrys))
+		first := 0
+		for i, entry := range stbl.ctts.entrys {
+			it.cttsFirst[i] = first
+			first += int(entry.sampleCount)
+		}
+	}
+
+	//stco中的chunk能容纳的sample数, 超出部分没有offset, 丢弃
+	entrys := stbl.stsc.entrys
+	chunkCount := len(stbl.stco.chunkOffsetlist)
+	it.stscFirst = make([]int, len(entrys))
+	capacity := 0
+	for i, entry := range entrys {
+		it.stscFirst[i] = capacity
+		lastChunk := chunkCount
+		if i+1 < len(entrys) && int(entrys[i+1].firstChunk)-1 < lastChunk {
+			lastChunk = int(entrys[i+1].firstChunk) - 1
+		}
+		if n := lastChunk - int(entry.firstChunk) + 1; n > 0 {
+			capacity += n * int(entry.samplesPerChunk)
+		}
+	}
+	it.count = int(stbl.stsz.sampleCount)
+	if it.count > capacity {
+		it.count = capacity
+	}
+	return it
+}
+
+//first中最后一个<=i的下标
+func lastLessEqual(first []int, i int) int {
+	n := sort.Search(len(first), func(k int) bool { return first[k] > i })
+	if n > 0 {
+		return n - 1
+	}
+	return 0
+}
+
+func (it *sampleIterator) sampleSize(i int) uint64 {
+	if it.stbl.stsz.sampleSize != 0 {
+		return uint64(it.stbl.stsz.sampleSize)
+	}
+	if i < len(it.stbl.stsz.entrySizelist) {
+		return uint64(it.stbl.stsz.entrySizelist[i])
+	}
+	return 0
+}
+
+func (it *sampleIterator) sampleAt(i int) sampleEntry {
+	if i == it.idx {
+		return it.sample
+	}
+	sequential := i == it.idx+1
+	if sequential {
+		for it.sttsIdx+1 < len(it.sttsFirst) && it.sttsFirst[it.sttsIdx+1] <= i {
+			it.sttsIdx++
+		}
+		for it.cttsIdx+1 < len(it.cttsFirst) && it.cttsFirst[it.cttsIdx+1] <= i {
+			it.cttsIdx++
+		}
+		for it.stscIdx+1 < len(it.stscFirst) && it.stscFirst[it.stscIdx+1] <= i {
+			it.stscIdx++
+		}
+	} else {
+		it.sttsIdx = lastLessEqual(it.sttsFirst, i)
+		it.cttsIdx = lastLessEqual(it.cttsFirst, i)
+		it.stscIdx = lastLessEqual(it.stscFirst, i)
+	}
+
+	sample := sampleEntry{size: it.sampleSize(i), SampleDescriptionIndex: 1}
+	stsc := it.stbl.stsc.entrys[it.stscIdx]
+	n := i - it.stscFirst[it.stscIdx]
+	chunk := int(stsc.firstChunk) - 1 + n/int(stsc.samplesPerChunk)
+	chunkFirst := i - n%int(stsc.samplesPerChunk)
+	sample.SampleDescriptionIndex = stsc.sampleDescriptionIndex
+	if sequential && chunk == it.chunk && i > chunkFirst {
+		sample.offset = it.sample.offset + it.sample.size
+	} else {
+		sample.offset = it.stbl.stco.chunkOffsetlist[chunk]
+		for j := chunkFirst; j < i; j++ {
+			sample.offset += it.sampleSize(j)
+		}
+	}
+	it.chunk = chunk
+	it.chunkFirst = chunkFirst
+
+	if len(it.sttsFirst) > 0 {
+		sample.dts = it.sttsDts[it.sttsIdx] + uint64(i-it.sttsFirst[it.sttsIdx])*uint64(it.stbl.stts.entrys[it.sttsIdx].sampleDelta)
+	}
+	sample.pts = sample.dts
+	if len(it.cttsFirst) > 0 {
+		entry := it.stbl.ctts.entrys[it.cttsIdx]
+		if i < it.cttsFirst[it.cttsIdx]+int(entry.sampleCount) {
+			//ctts version 1中sample_offset为有符号数
+			sample.pts = uint64(int64(sample.dts) + int64(int32(entry.sampleOffset)))
+		}
+	}
+
+	if it.allSync {
+		sample.isKeyFrame = true
+	} else {
+		stss := it.stbl.stss.sampleNumber
+		number := uint32(i + 1)
+		if sequential {
+			for it.stssIdx < len(stss) && stss[it.stssIdx] < number {
+				it.stssIdx++
+			}
+		} else {
+			it.stssIdx = sort.Search(len(stss), func(k int) bool { return stss[k] >= number })
+		}
+		sample.isKeyFrame = it.stssIdx < len(stss) && stss[it.stssIdx] == number
+	}
+	it.idx = i
+	it.sample = sample
+	return sample
+}
+
+//当前chunk的结束位置
+func (it *sampleIterator) chunkEnd() uint64 {
+	stsc := it.stbl.stsc.entrys[it.stscIdx]
+	end := it.stbl.stco.chunkOffsetlist[it.chunk]
+	for j := it.chunkFirst; j < it.chunkFirst+int(stsc.samplesPerChunk) && j < it.count; j++ {
+		end += it.sampleSize(j)
+	}
+	return end
+}
+
+func (track *mp4track) sampleCount() int {
+	if track.sampleIter != nil {
+		return track.sampleIter.count
+	}
+	return len(track.samplelist)
+}
+
+func (track *mp4track) sampleAt(idx int) sampleEntry {
+	if track.sampleIter != nil {
+		return track.sampleIter.sampleAt(idx)
+	}
+	return track.samplelist[idx]
+}
+
+func (track *mp4track) syncSampleCount() int {
+	if track.allSync {
+		return track.sampleCount()
+	}
+	return len(track.syncSamples)
+}
+
+func (track *mp4track) syncSampleAt(k int) int {
+	if track.allSync {
+		return k
+	}
+	return track.syncSamples[k]
+}
+
+//sample所在chunk(fmp4为trun)的结束位置, 用于合并读取
+func (track *mp4track) chunkEnd(idx int, sample sampleEntry) uint64 {
+	if track.sampleIter != nil {
+		track.sampleIter.sampleAt(idx)
+		return track.sampleIter.chunkEnd()
+	}
+	end := sample.offset + sample.size
+	if len(track.fragmentRuns) == 0 {
+		return end
+	}
+	n := sort.Search(len(track.fragmentRuns), func(k int) bool { return track.fragmentRuns[k].firstSample > idx })
+	last := len(track.samplelist)
+	if n < len(track.fragmentRuns) {
+		last = track.fragmentRuns[n].firstSample
+	}
+	for j := idx + 1; j < last && track.samplelist[j].offset == end; j++ {
+		end += track.samplelist[j].size
+	}
+	return end
+}
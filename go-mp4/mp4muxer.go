@@ -2,7 +2,9 @@ package mp4
 
 import (
     "encoding/binary"
+    "errors"
     "io"
+    "time"
 )
 
 type MP4_FLAG uint32
@@ -10,9 +12,11 @@ type MP4_FLAG uint32
 //ffmpeg movenc.h
 const (
     MP4_FLAG_FRAGMENT MP4_FLAG = (1 << 1)
-    MP4_FLAG_KEYFRAME MP4_FLAG = (1 << 3)
-    MP4_FLAG_CUSTOM   MP4_FLAG = (1 << 5)
-    MP4_FLAG_DASH     MP4_FLAG = (1 << 11)
+    MP4_FLAG_KEYFRAME      MP4_FLAG = (1 << 3)
+    MP4_FLAG_SEPARATE_MOOF MP4_FLAG = (1 << 4) //每个track单独一个moof+mdat
+    MP4_FLAG_CUSTOM        MP4_FLAG = (1 << 5)
+    MP4_FLAG_DASH          MP4_FLAG = (1 << 11)
+    MP4_FLAG_CMAF          MP4_FLAG = (1 << 22) //写入cmfc/cmfs/cmfl brand, 每个segment前写入styp+sidx
 )
 
 func (f MP4_FLAG) has(ff MP4_FLAG) bool {
@@ -36,7 +40,17 @@ type Movmuxer struct {
     tracks         map[uint32]*mp4track
     movFlag        MP4_FLAG
     onNewFragment  OnFragment
-    fragDuration   uint32
+    fragMode       FragmentMode
+    fragTarget     uint32
+    onSegment      OnSegment
+    prftClock      func() time.Time
+    encryption     *cencEncryption
+    pssh           []PsshBox
+    fastStart      bool
+    moovReserve    uint32
+    reserveOffset  int64
+    metadata       *Metadata
+    eventMessages  []EventMessage
 }
 
 type MuxerOption func(muxer *Movmuxer)
@@ -60,6 +74,25 @@ func CreateMp4Muxer(w io.WriteSeeker, options ...MuxerOption) (*Movmuxer, error)
         opt(muxer)
     }
 
+    if muxer.movFlag.has(MP4_FLAG_CMAF) && !muxer.movFlag.isDash() {
+        muxer.movFlag |= MP4_FLAG_FRAGMENT
+    }
+
+    if muxer.encryption != nil {
+        if !muxer.movFlag.isFragment() && !muxer.movFlag.isDash() {
+            return nil, errors.New("encryption only support fmp4")
+        }
+        if err := muxer.encryption.init(); err != nil {
+            return nil, err
+        }
+    }
+
+    if muxer.fastStart && muxer.moovReserve == 0 && !muxer.movFlag.isFragment() && !muxer.movFlag.isDash() {
+        if _, ok := w.(io.ReadWriteSeeker); !ok {
+            return nil, errors.New("faststart without reserved space need io.ReadWriteSeeker")
+        }
+    }
+
     if !muxer.movFlag.isFragment() && !muxer.movFlag.isDash() {
         ftyp := NewFileTypeBox()
         ftyp.Major_brand = mov_tag(isom)
@@ -74,6 +107,11 @@ func CreateMp4Muxer(w io.WriteSeeker, options ...MuxerOption) (*Movmuxer, error)
         if err != nil {
             return nil, err
         }
+        if muxer.fastStart && muxer.moovReserve > 0 {
+            if err = muxer.writeMoovReserve(); err != nil {
+                return nil, err
+            }
+        }
         free := NewFreeBox()
         freelen, freeboxdata := free.Encode()
         _, err = muxer.writer.Write(freeboxdata[0:freelen])
@@ -135,6 +173,15 @@ func WithExtraData(extraData []byte) TrackOption {
     }
 }
 
+//mdhd中的ISO-639-2/T语言码, 比如"eng", "chi"
+func WithLanguage(language string) TrackOption {
+    return func(track *mp4track) {
+        if len(language) == 3 {
+            copy(track.language[:], language)
+        }
+    }
+}
+
 func (muxer *Movmuxer) AddAudioTrack(cid MP4_CODEC_TYPE, options ...TrackOption) uint32 {
     return muxer.addTrack(cid, options...)
 }
@@ -143,6 +190,19 @@ func (muxer *Movmuxer) AddVideoTrack(cid MP4_CODEC_TYPE, options ...TrackOption)
     return muxer.addTrack(cid, options...)
 }
 
+// 字幕track, cid为MP4_CODEC_WEBVTT/MP4_CODEC_TTML/MP4_CODEC_TX3G
+// sample的显示时长为到下一个sample的dts, 字幕结束时写入一个空sample
+func (muxer *Movmuxer) AddTextTrack(cid MP4_CODEC_TYPE, options ...TrackOption) uint32 {
+    return muxer.addTrack(cid, options...)
+}
+
+// timed metadata track, cid为MP4_CODEC_ID3或者MP4_CODEC_URIM
+// MP4_CODEC_ID3写成uri为EmsgSchemeID3的urim track, 这是gomedia自己的约定, 其他播放器一般不认识,
+// 需要互通时用AddEventMessage写入SchemeIdUri为EmsgSchemeID3的emsg
+func (muxer *Movmuxer) AddMetadataTrack(cid MP4_CODEC_TYPE, options ...TrackOption) uint32 {
+    return muxer.addTrack(cid, options...)
+}
+
 func (muxer *Movmuxer) addTrack(cid MP4_CODEC_TYPE, options ...TrackOption) uint32 {
     var track *mp4track
     if muxer.movFlag.isDash() || muxer.movFlag.isFragment() {
@@ -157,36 +217,40 @@ func (muxer *Movmuxer) addTrack(cid MP4_CODEC_TYPE, options ...TrackOption) uint
     for _, opt := range options {
         opt(track)
     }
-
+    if muxer.encryption != nil {
+        muxer.encryption.setupTrack(track)
+    }
     return track.trackId
 }
 
 func (muxer *Movmuxer) Write(track uint32, data []byte, pts uint64, dts uint64) error {
     mp4track := muxer.tracks[track]
-    err := mp4track.writeSample(data, pts, dts)
-    if err != nil {
-        return err
+    isFmp4 := muxer.movFlag.isFragment() || muxer.movFlag.isDash()
+    if isFmp4 && !isVideo(mp4track.cid) && muxer.shouldFlushFragment(mp4track, dts, len(data)) {
+        if err := muxer.flushFragment(); err != nil {
+            return err
+        }
+        if muxer.onNewFragment != nil {
+            muxer.onNewFragment(mp4track.duration, mp4track.startPts, mp4track.startDts)
+        }
     }
 
-    if !muxer.movFlag.isFragment() && !muxer.movFlag.isDash() {
+    err := mp4track.writeSample(data, pts, dts)
+    if err != nil {
         return err
     }
 
-    if isAudio(mp4track.cid) {
+    if !isFmp4 || !isVideo(mp4track.cid) {
         return nil
     }
 
-    // isCustion := muxer.movFlag.has(MP4_FLAG_CUSTOM)
-    isKeyFrag := muxer.movFlag.has(MP4_FLAG_KEYFRAME)
-    if isKeyFrag {
-        if mp4track.lastSample.isKey && mp4track.duration > 0 {
-            err = muxer.flushFragment()
-            if err != nil {
-                return err
-            }
-            if muxer.onNewFragment != nil {
-                muxer.onNewFragment(mp4track.duration, mp4track.startPts, mp4track.startDts)
-            }
+    if muxer.shouldFlushFragment(mp4track, 0, 0) {
+        err = muxer.flushFragment()
+        if err != nil {
+            return err
+        }
+        if muxer.onNewFragment != nil {
+            muxer.onNewFragment(mp4track.duration, mp4track.startPts, mp4track.startDts)
         }
     }
 
@@ -209,18 +273,24 @@ func (muxer *Movmuxer) WriteTrailer() (err error) {
             return err
         }
         for _, track := range muxer.tracks {
-            if isAudio(track.cid) {
+            if !isVideo(track.cid) {
                 continue
             }
             if muxer.onNewFragment != nil {
                 muxer.onNewFragment(track.duration, track.startPts, track.startPts)
             }
         }
+        if muxer.onSegment != nil {
+            return nil
+        }
         return muxer.writeMfra()
     default:
         if err = muxer.reWriteMdatSize(); err != nil {
             return err
         }
+        if muxer.fastStart {
+            return muxer.writeFastStartMoov()
+        }
         return muxer.writeMoov(muxer.writer)
     }
     return
@@ -234,13 +304,24 @@ func (muxer *Movmuxer) OnNewFragment(onFragment OnFragment) {
     muxer.onNewFragment = onFragment
 }
 
-func (muxer *Movmuxer) WriteInitSegment(w io.Writer) error {
-    ftypBox := makeFtypBox(mov_tag(iso5), 0x200, []uint32{mov_tag(iso5), mov_tag(iso6), mov_tag(mp41)})
-    _, err := w.Write(ftypBox)
+// trackIds为空时包含所有track, MP4_FLAG_SEPARATE_MOOF时可以为每个track单独生成init segment
+func (muxer *Movmuxer) WriteInitSegment(w io.Writer, trackIds ...uint32) error {
+    tracks := muxer.trackList()
+    if len(trackIds) > 0 {
+        tracks = tracks[:0]
+        for _, tid := range trackIds {
+            track, found := muxer.tracks[tid]
+            if !found {
+                return errors.New("track not found")
+            }
+            tracks = append(tracks, track)
+        }
+    }
+    _, err := w.Write(muxer.makeFragmentFtyp())
     if err != nil {
         return err
     }
-    return muxer.writeMoov(w)
+    return muxer.writeTracksMoov(w, tracks)
 }
 
 func (muxer *Movmuxer) reWriteMdatSize() (err error) {
@@ -279,25 +360,34 @@ func (muxer *Movmuxer) reWriteMdatSize() (err error) {
 }
 
 func (muxer *Movmuxer) writeMoov(w io.Writer) (err error) {
+    return muxer.writeTracksMoov(w, muxer.trackList())
+}
+
+func (muxer *Movmuxer) writeTracksMoov(w io.Writer, tracks []*mp4track) (err error) {
     var mvhd []byte
     var mvex []byte
     if muxer.movFlag.isDash() || muxer.movFlag.isFragment() {
         mvhd = makeMvhdBox(muxer.nextTrackId, 0)
-        mvex = makeMvex(muxer)
+        mvex = makeMvex(tracks)
     } else {
         maxdurtaion := uint32(0)
-        for _, track := range muxer.tracks {
+        for _, track := range tracks {
             if maxdurtaion < track.duration {
                 maxdurtaion = track.duration
             }
         }
         mvhd = makeMvhdBox(muxer.nextTrackId, maxdurtaion)
     }
-    moovsize := len(mvhd) + len(mvex)
-    traks := make([][]byte, len(muxer.tracks))
-    for i := uint32(1); i < muxer.nextTrackId; i++ {
-        traks[i-1] = makeTrak(muxer.tracks[i], muxer.movFlag)
-        moovsize += len(traks[i-1])
+    pssh := muxer.makePsshBoxes()
+    var udta []byte
+    if muxer.metadata != nil {
+        udta = makeUdtaBox(muxer.metadata)
+    }
+    moovsize := len(mvhd) + len(mvex) + len(pssh) + len(udta)
+    traks := make([][]byte, len(tracks))
+    for i, track := range tracks {
+        traks[i] = makeTrak(track, muxer.movFlag)
+        moovsize += len(traks[i])
     }
 
     moov := BasicBox{Type: [4]byte{'m', 'o', 'o', 'v'}}
@@ -310,10 +400,23 @@ func (muxer *Movmuxer) writeMoov(w io.Writer) (err error) {
         offset += len(trak)
     }
     copy(moovBox[offset:], mvex)
+    offset += len(mvex)
+    copy(moovBox[offset:], pssh)
+    offset += len(pssh)
+    copy(moovBox[offset:], udta)
     _, err = w.Write(moovBox)
     return
 }
 
+func (muxer *Movmuxer) makePsshBoxes() []byte {
+    var boxes []byte
+    for i := range muxer.pssh {
+        _, pssh := muxer.pssh[i].Encode()
+        boxes = append(boxes, pssh...)
+    }
+    return boxes
+}
+
 func (muxer *Movmuxer) writeMfra() (err error) {
     mfraSize := 0
     tfras := make([][]byte, len(muxer.tracks))
@@ -322,7 +425,8 @@ func (muxer *Movmuxer) writeMfra() (err error) {
         mfraSize += len(tfras[i-1])
     }
 
-    mfro := makeMfroBox(uint32(mfraSize) + 16)
+    //mfra头 + tfra, makeMfroBox会加上mfro自身的16字节
+    mfro := makeMfroBox(uint32(mfraSize) + BasicBoxLen)
     mfraSize += len(mfro)
     mfra := BasicBox{Type: [4]byte{'m', 'f', 'r', 'a'}}
     mfra.Size = 8 + uint64(mfraSize)
@@ -336,127 +440,15 @@ func (muxer *Movmuxer) writeMfra() (err error) {
     return
 }
 
-func (muxer *Movmuxer) FlushFragment() (err error) {
+// emsgs写在这个fragment的moof之前
+func (muxer *Movmuxer) FlushFragment(emsgs ...EventMessage) (err error) {
+    for _, msg := range emsgs {
+        if err = muxer.AddEventMessage(msg); err != nil {
+            return
+        }
+    }
     for _, track := range muxer.tracks {
         track.flush()
     }
     return muxer.flushFragment()
 }
-
-func (muxer *Movmuxer) flushFragment() (err error) {
-
-    if muxer.movFlag.isFragment() {
-        if muxer.nextFragmentId == 1 { //first fragment ,write moov
-            ftypBox := makeFtypBox(mov_tag(iso5), 0x200, []uint32{mov_tag(iso5), mov_tag(iso6), mov_tag(mp41)})
-            _, err := muxer.writer.Write(ftypBox)
-            if err != nil {
-                return err
-            }
-            muxer.writeMoov(muxer.writer)
-        }
-    }
-
-    var moofOffset int64
-    if moofOffset, err = muxer.writer.Seek(0, io.SeekCurrent); err != nil {
-        return err
-    }
-    var mdatlen uint64 = 0
-    for i := uint32(1); i < muxer.nextTrackId; i++ {
-        if len(muxer.tracks[i].samplelist) == 0 {
-            continue
-        }
-        for j := 0; j < len(muxer.tracks[i].samplelist); j++ {
-            muxer.tracks[i].samplelist[j].offset += mdatlen
-        }
-        ws := muxer.tracks[i].writer.(*fmp4WriterSeeker)
-        mdatlen += uint64(len(ws.buffer))
-    }
-    mdatlen += 8
-
-    moofSize := 0
-    mfhd := makeMfhdBox(muxer.nextFragmentId)
-
-    moofSize += len(mfhd)
-    trafs := make([][]byte, len(muxer.tracks))
-    for i := uint32(1); i < muxer.nextTrackId; i++ {
-        traf := makeTraf(muxer.tracks[i], uint64(moofOffset), uint64(0))
-        moofSize += len(traf)
-        trafs[i-1] = traf
-    }
-
-    moofSize += 8 //moof box
-    mfhd = makeMfhdBox(muxer.nextFragmentId)
-    trafs = make([][]byte, len(muxer.tracks))
-    for i := uint32(1); i < muxer.nextTrackId; i++ {
-        traf := makeTraf(muxer.tracks[i], uint64(moofOffset), uint64(moofSize+8)) //moofSize + 8(mdat box)
-        trafs[i-1] = traf
-    }
-    muxer.nextFragmentId++
-
-    moof := BasicBox{Type: [4]byte{'m', 'o', 'o', 'f'}}
-    moof.Size = uint64(moofSize)
-    offset, moofBox := moof.Encode()
-    copy(moofBox[offset:], mfhd)
-    offset += len(mfhd)
-    for i := range trafs {
-        copy(moofBox[offset:], trafs[i])
-        offset += len(trafs[i])
-    }
-
-    mdat := BasicBox{Type: [4]byte{'m', 'd', 'a', 't'}}
-    mdat.Size = 8
-    _, mdatBox := mdat.Encode()
-
-    if muxer.movFlag.isDash() {
-        stypBox := makeStypBox(mov_tag(msdh), 0, []uint32{mov_tag(msdh), mov_tag(msix)})
-        _, err := muxer.writer.Write(stypBox)
-        if err != nil {
-            return err
-        }
-
-        for i := uint32(1); i < muxer.nextTrackId; i++ {
-            sidx := makeSidxBox(muxer.tracks[i], 52*(muxer.nextTrackId-1-i), uint32(mdatlen)+uint32(len(moofBox))+52*(muxer.nextTrackId-i-1))
-            _, err := muxer.writer.Write(sidx)
-            if err != nil {
-                return err
-            }
-        }
-    }
-
-    _, err = muxer.writer.Write(moofBox)
-    if err != nil {
-        return err
-    }
-    binary.BigEndian.PutUint32(mdatBox, uint32(mdatlen))
-    _, err = muxer.writer.Write(mdatBox)
-    if err != nil {
-        return err
-    }
-
-    for i := uint32(1); i < muxer.nextTrackId; i++ {
-        if len(muxer.tracks[i].samplelist) > 0 {
-            firstPts := muxer.tracks[i].samplelist[0].pts
-            firstDts := muxer.tracks[i].samplelist[0].dts
-            lastPts := muxer.tracks[i].samplelist[len(muxer.tracks[i].samplelist)-1].pts
-            lastDts := muxer.tracks[i].samplelist[len(muxer.tracks[i].samplelist)-1].dts
-            frag := movFragment{
-                offset:   uint64(moofOffset),
-                duration: muxer.tracks[i].duration,
-                firstDts: firstDts,
-                firstPts: firstPts,
-                lastPts:  lastPts,
-                lastDts:  lastDts,
-            }
-            muxer.tracks[i].fragments = append(muxer.tracks[i].fragments, frag)
-        }
-        ws := muxer.tracks[i].writer.(*fmp4WriterSeeker)
-        _, err = muxer.writer.Write(ws.buffer)
-        if err != nil {
-            return err
-        }
-        ws.buffer = ws.buffer[:0]
-        ws.offset = 0
-        muxer.tracks[i].clearSamples()
-    }
-    return nil
-}
@@ -1,11 +1,16 @@
 package mp4
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -222,3 +227,422 @@ func TestMuxMp4(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestMuxLPCM(t *testing.T) {
+	ws := newFmp4WriterSeeker(1024)
+	muxer, err := CreateMp4Muxer(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tid := muxer.AddAudioTrack(MP4_CODEC_LPCM, WithAudioChannelCount(1), WithAudioSampleRate(8000))
+	frames := [][]byte{
+		codec.G711AToPCM([]byte{0xD5, 0x55, 0xAA, 0x2A}),
+		codec.G711UToPCM([]byte{0xFF, 0x80, 0x00, 0x7F}),
+	}
+	for i, frame := range frames {
+		if err := muxer.Write(tid, frame, uint64(i*20), uint64(i*20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer := CreateMp4Demuxer(bytes.NewReader(ws.buffer))
+	infos, err := demuxer.ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Cid != MP4_CODEC_LPCM || infos[0].SampleRate != 8000 || infos[0].ChannelCount != 1 || infos[0].SampleSize != 16 {
+		t.Fatalf("ReadHead() = %+v", infos)
+	}
+	for i, frame := range frames {
+		pkg, err := demuxer.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkg.Cid != MP4_CODEC_LPCM || pkg.Pts != uint64(i*20) || !bytes.Equal(pkg.Data, frame) {
+			t.Errorf("ReadPacket() = %v %d %x, want %x", pkg.Cid, pkg.Pts, pkg.Data, frame)
+		}
+	}
+}
+
+func TestMuxVideoCodecs(t *testing.T) {
+	td := []byte{0x12, 0x00}
+	av1SeqHdr := []byte{0x0A, 0x0B, 0x00, 0x00, 0x00, 0x42, 0xA6, 0x7F, 0xD9, 0xE7, 0xFF, 0xCC, 0x02}
+	av1Key := []byte{0x32, 0x02, 0x10, 0x00}
+	av1Inter := []byte{0x32, 0x02, 0x30, 0x00}
+	vp9Key := []byte{0x82, 0x49, 0x83, 0x42, 0x40, 0x27, 0xF0, 0x16, 0x70}
+	vp9Inter := []byte{0x86, 0x00, 0x40, 0x92}
+	join := func(parts ...[]byte) []byte {
+		var out []byte
+		for _, part := range parts {
+			out = append(out, part...)
+		}
+		return out
+	}
+	tests := []struct {
+		name       string
+		cid        MP4_CODEC_TYPE
+		configBox  string
+		frames     [][]byte
+		want       [][]byte
+		wantKey    []bool
+		wantWidth  uint32
+		wantHeight uint32
+	}{
+		{
+			name:      "av1",
+			cid:       MP4_CODEC_AV1,
+			configBox: "av1C",
+			//temporal delimiter不写入mp4
+			frames:     [][]byte{join(td, av1SeqHdr, av1Key), join(td, av1Inter), join(td, av1Inter)},
+			want:       [][]byte{join(av1SeqHdr, av1Key), av1Inter, av1Inter},
+			wantKey:    []bool{true, false, false},
+			wantWidth:  1280,
+			wantHeight: 720,
+		},
+		{
+			name:       "vp9",
+			cid:        MP4_CODEC_VP9,
+			configBox:  "vpcC",
+			frames:     [][]byte{vp9Key, vp9Inter, vp9Inter},
+			want:       [][]byte{vp9Key, vp9Inter, vp9Inter},
+			wantKey:    []bool{true, false, false},
+			wantWidth:  640,
+			wantHeight: 360,
+		},
+	}
+	for _, tt := range tests {
+		for _, flag := range []MP4_FLAG{0, MP4_FLAG_FRAGMENT} {
+			t.Run(fmt.Sprintf("%s flag %d", tt.name, flag), func(t *testing.T) {
+				ws := newFmp4WriterSeeker(1024)
+				muxer, err := CreateMp4Muxer(ws, WithMp4Flag(flag))
+				if err != nil {
+					t.Fatal(err)
+				}
+				tid := muxer.AddVideoTrack(tt.cid)
+				for i, frame := range tt.frames {
+					if err := muxer.Write(tid, append([]byte{}, frame...), uint64(i*40), uint64(i*40)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := muxer.WriteTrailer(); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(ws.buffer, []byte(tt.configBox)) {
+					t.Errorf("%s box not found", tt.configBox)
+				}
+
+				demuxer := CreateMp4Demuxer(bytes.NewReader(ws.buffer))
+				infos, err := demuxer.ReadHead()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(infos) != 1 || infos[0].Cid != tt.cid || infos[0].Width != tt.wantWidth || infos[0].Height != tt.wantHeight {
+					t.Fatalf("ReadHead() = %+v", infos)
+				}
+				for i, want := range tt.want {
+					pkg, err := demuxer.ReadPacket()
+					if err != nil {
+						t.Fatal(err)
+					}
+					if pkg.Cid != tt.cid || pkg.Pts != uint64(i*40) || !bytes.Equal(pkg.Data, want) {
+						t.Errorf("ReadPacket() = %v %d %x, want %x", pkg.Cid, pkg.Pts, pkg.Data, want)
+					}
+					if got := demuxer.tracks[0].sampleAt(i).isKeyFrame; got != tt.wantKey[i] {
+						t.Errorf("sample %d isKeyFrame = %v, want %v", i, got, tt.wantKey[i])
+					}
+				}
+				if _, err := demuxer.ReadPacket(); err != io.EOF {
+					t.Errorf("ReadPacket() = %v, want EOF", err)
+				}
+			})
+		}
+	}
+}
+
+// 按SubSample解密, 用于校验加密结果
+func testDecryptSample(t *testing.T, scheme ProtectionScheme, key []byte, sample []byte, sub *SubSample) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := append([]byte{}, sample...)
+	patterns := sub.Patterns
+	if len(patterns) == 0 {
+		patterns = []SubSamplePattern{{BytesProtected: uint32(len(out))}}
+	}
+	stream := cipher.NewCTR(block, sub.IV[:])
+	offset := 0
+	for _, p := range patterns {
+		offset += int(p.BytesClear)
+		protected := out[offset : offset+int(p.BytesProtected)]
+		offset += int(p.BytesProtected)
+		if scheme == PROTECTION_SCHEME_CENC {
+			stream.XORKeyStream(protected, protected)
+			continue
+		}
+		mode := cipher.NewCBCDecrypter(block, sub.IV[:])
+		crypt, skip := int(sub.CryptByteBlock)*16, int(sub.SkipByteBlock)*16
+		if crypt == 0 && skip == 0 {
+			crypt = len(protected) / 16 * 16
+		}
+		for i := 0; len(protected)-i >= 16; i += crypt + skip {
+			n := crypt
+			if len(protected)-i < n {
+				n = (len(protected) - i) / 16 * 16
+			}
+			mode.CryptBlocks(protected[i:i+n], protected[i:i+n])
+		}
+	}
+	return out
+}
+
+func TestMuxEncryption(t *testing.T) {
+	kid := [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	key := []byte("0123456789abcdef")
+	var widevine [16]byte
+	hex.Decode(widevine[:], []byte(UUIDWidevine))
+	pssh := PsshBox{SystemID: widevine, KIDs: [][16]byte{kid}, Data: []byte{0x12, 0x10}}
+
+	stream := muxTestStream{videoFrames: 10, gop: 5, varySize: true}
+	toAvcc := func(frame []byte) []byte {
+		var avcc []byte
+		codec.SplitFrameWithStartCode(frame, func(nalu []byte) bool {
+			avcc = append(avcc, codec.ConvertAnnexBToAVCC(nalu)...)
+			return true
+		})
+		return avcc
+	}
+
+	tests := []struct {
+		name   string
+		scheme ProtectionScheme
+		//sps, pps, 5字节slice header明文
+		wantVideoClear uint16
+	}{
+		{name: "cenc", scheme: PROTECTION_SCHEME_CENC, wantVideoClear: 4 + 8 + 4 + 4 + 4 + 5 + 100%16},
+		{name: "cbcs", scheme: PROTECTION_SCHEME_CBCS, wantVideoClear: 4 + 8 + 4 + 4 + 4 + 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := muxTestBuffer(t, stream, WithMp4Flag(MP4_FLAG_FRAGMENT), WithEncryption(tt.scheme, kid, key), WithPsshBox(pssh))
+			demuxer := CreateMp4Demuxer(bytes.NewReader(data))
+			videoSamples, audioSamples := 0, 0
+			demuxer.OnRawSample = func(cid MP4_CODEC_TYPE, sample []byte, sub *SubSample) error {
+				if sub == nil {
+					t.Fatalf("%v sample is not encrypted", cid)
+				}
+				if sub.KID != kid || len(sub.PsshBoxes) != 1 || !bytes.Equal(sub.PsshBoxes[0].Data, pssh.Data) {
+					t.Errorf("SubSample KID = %x pssh = %d", sub.KID, len(sub.PsshBoxes))
+				}
+				plain := testDecryptSample(t, tt.scheme, key, sample, sub)
+				if cid == MP4_CODEC_H264 {
+					want := toAvcc(testH264Frame(videoSamples, stream.gop))
+					if !bytes.Equal(plain, want) {
+						t.Errorf("video sample %d decrypt = %x, want %x", videoSamples, plain, want)
+					}
+					if bytes.Equal(sample, want) {
+						t.Errorf("video sample %d is clear", videoSamples)
+					}
+					if videoSamples == 0 && (len(sub.Patterns) != 1 || sub.Patterns[0].BytesClear != tt.wantVideoClear) {
+						t.Errorf("video sample %d subsamples = %+v, want clear %d", videoSamples, sub.Patterns, tt.wantVideoClear)
+					}
+					videoSamples++
+				} else {
+					want := bytes.Repeat([]byte{byte(audioSamples)}, 160+audioSamples%3)
+					if !bytes.Equal(plain, want) || bytes.Equal(sample, want) {
+						t.Errorf("audio sample %d decrypt = %x, want %x", audioSamples, plain, want)
+					}
+					audioSamples++
+				}
+				return nil
+			}
+			infos, err := demuxer.ReadHead()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(infos) != 2 || infos[0].Cid != MP4_CODEC_H264 || infos[1].Cid != MP4_CODEC_G711A {
+				t.Fatalf("ReadHead() = %+v", infos)
+			}
+			for {
+				if _, err := demuxer.ReadPacket(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if videoSamples != 10 || audioSamples != 20 {
+				t.Errorf("got %d video %d audio samples", videoSamples, audioSamples)
+			}
+		})
+	}
+}
+
+// 测试用的音视频流, 音频为8k单声道G711A, 20ms一帧
+type muxTestStream struct {
+	videoFrames int  //h264帧数, 40ms一帧, 每个视频帧之后写2个音频帧
+	gop         int  //视频的关键帧间隔
+	audioFrames int  //没有视频时的音频帧数
+	varySize    bool //音频帧大小在160~162之间变化
+	flushEvery  int  //fragment模式下每写flushEvery个音频帧调用一次FlushFragment
+}
+
+// 20帧音频, fragment模式下每5帧一个fragment
+var boxTreeTestStream = muxTestStream{audioFrames: 20, flushEvery: 5}
+
+// 测试用的h264 annexb nalu, slice带100字节payload
+var (
+	testH264SPS = []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x4d, 0x00, 0x1e, 0xed, 0x82, 0x83, 0xf2}
+	testH264PPS = []byte{0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x3c, 0x80}
+	testH264IDR = append([]byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x02, 0xaa}, bytes.Repeat([]byte{0xab}, 100)...)
+	testH264P   = append([]byte{0x00, 0x00, 0x00, 0x01, 0x41, 0x9a, 0x21, 0x0a}, bytes.Repeat([]byte{0xab}, 100)...)
+)
+
+// 第i帧, 第一帧带sps/pps, 之后每gop帧一个idr, 每次返回新的切片
+func testH264Frame(i int, gop int) []byte {
+	if i == 0 {
+		return append(append(append([]byte{}, testH264SPS...), testH264PPS...), testH264IDR...)
+	} else if i%gop == 0 {
+		return append([]byte{}, testH264IDR...)
+	}
+	return append([]byte{}, testH264P...)
+}
+
+// 添加track并写入所有sample, 不调用WriteTrailer
+func writeMuxTestStream(t *testing.T, muxer *Movmuxer, stream muxTestStream) {
+	var vid uint32
+	audioFrames := stream.audioFrames
+	if stream.videoFrames > 0 {
+		vid = muxer.AddVideoTrack(MP4_CODEC_H264)
+		audioFrames = stream.videoFrames * 2
+	}
+	aid := muxer.AddAudioTrack(MP4_CODEC_G711A, WithAudioChannelCount(1), WithAudioSampleRate(8000))
+	for i := 0; i < audioFrames; i++ {
+		if stream.videoFrames > 0 && i%2 == 0 {
+			if err := muxer.Write(vid, testH264Frame(i/2, stream.gop), uint64(i*20), uint64(i*20)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		size := 160
+		if stream.varySize {
+			size += i % 3
+		}
+		if err := muxer.Write(aid, bytes.Repeat([]byte{byte(i)}, size), uint64(i*20), uint64(i*20)); err != nil {
+			t.Fatal(err)
+		}
+		if stream.flushEvery > 0 && i%stream.flushEvery == stream.flushEvery-1 && muxer.movFlag.isFragment() {
+			if err := muxer.FlushFragment(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// 写入测试流并WriteTrailer
+func muxTestFile(t *testing.T, w io.WriteSeeker, stream muxTestStream, options ...MuxerOption) *Movmuxer {
+	muxer, err := CreateMp4Muxer(w, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeMuxTestStream(t, muxer, stream)
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	return muxer
+}
+
+// 写入内存, 返回文件内容
+func muxTestBuffer(t *testing.T, stream muxTestStream, options ...MuxerOption) []byte {
+	ws := newFmp4WriterSeeker(1024)
+	muxTestFile(t, ws, stream, options...)
+	return ws.buffer
+}
+
+//只保存写入的数据, 可以Seek到很远的位置模拟大文件
+type sparseWriter struct {
+	writes []sparseWrite
+	pos    int64
+}
+
+type sparseWrite struct {
+	offset int64
+	data   []byte
+}
+
+func (sw *sparseWriter) Write(p []byte) (int, error) {
+	sw.writes = append(sw.writes, sparseWrite{offset: sw.pos, data: append([]byte{}, p...)})
+	sw.pos += int64(len(p))
+	return len(p), nil
+}
+
+func (sw *sparseWriter) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent {
+		offset += sw.pos
+	} else if whence != io.SeekStart {
+		return 0, fmt.Errorf("unsupport whence %d", whence)
+	}
+	sw.pos = offset
+	return offset, nil
+}
+
+//后面的写入覆盖前面的
+func (sw *sparseWriter) readAt(offset int64, n int) []byte {
+	for i := len(sw.writes) - 1; i >= 0; i-- {
+		w := sw.writes[i]
+		if offset >= w.offset && offset+int64(n) <= w.offset+int64(len(w.data)) {
+			return w.data[offset-w.offset : offset-w.offset+int64(n)]
+		}
+	}
+	return nil
+}
+
+func TestMuxLargeFile(t *testing.T) {
+	sw := &sparseWriter{}
+	muxer, err := CreateMp4Muxer(sw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tid := muxer.AddAudioTrack(MP4_CODEC_G711A, WithAudioChannelCount(1), WithAudioSampleRate(8000))
+	mdatOffset := sw.pos - BasicBoxLen
+	if err := muxer.Write(tid, make([]byte, 160), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	//跳过5G模拟大文件
+	largeOffset := int64(5) << 30
+	if _, err := sw.Seek(largeOffset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.Write(tid, make([]byte, 160), 20, 20); err != nil {
+		t.Fatal(err)
+	}
+	moovOffset := sw.pos
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	//free占位的8字节被64位mdat头使用
+	mdatHeader := sw.readAt(mdatOffset-BasicBoxLen, 16)
+	if mdatHeader == nil || binary.BigEndian.Uint32(mdatHeader) != 1 || string(mdatHeader[4:8]) != "mdat" ||
+		binary.BigEndian.Uint64(mdatHeader[8:]) != uint64(moovOffset-mdatOffset+BasicBoxLen) {
+		t.Fatalf("mdat header = %x", mdatHeader)
+	}
+	moovSize := sw.readAt(moovOffset, 4)
+	moov, err := ParseBox(sw.readAt(moovOffset, int(binary.BigEndian.Uint32(moovSize))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	co64 := moov.Find("trak/mdia/minf/stbl/co64")
+	if co64 == nil || moov.Find("trak/mdia/minf/stbl/stco") != nil {
+		t.Fatalf("co64 box not found")
+	}
+	box := NewChunkLargeOffsetBox()
+	if _, err := box.Decode(bytes.NewReader(co64.Data)); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint64{uint64(mdatOffset + BasicBoxLen), uint64(largeOffset)}
+	if !reflect.DeepEqual(box.stco.chunkOffsetlist, want) {
+		t.Errorf("chunk offsets = %v, want %v", box.stco.chunkOffsetlist, want)
+	}
+}
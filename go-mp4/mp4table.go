@@ -95,10 +95,20 @@ type movstbl struct {
 }
 
 type fragEntry struct {
-    time       uint64
-    moofOffset uint64
+    time         uint64
+    moofOffset   uint64
+    trafNumber   uint32
+    trunNumber   uint32
+    sampleNumber uint32
 }
 
 type movtfra struct {
     frags []fragEntry
 }
+
+//fmp4 每个trun在samplelist中的起始位置, 用于定位tfra中的sample
+type fragmentRun struct {
+    moofOffset  uint64
+    trunNumber  uint32
+    firstSample int
+}
@@ -74,6 +74,54 @@ func (extra *h265ExtraData) load(data []byte) {
     extra.hvccExtra.Decode(data)
 }
 
+type av1ExtraData struct {
+    av1cExtra *codec.AV1CodecConfigurationRecord
+}
+
+func newav1ExtraData() *av1ExtraData {
+    return &av1ExtraData{
+        av1cExtra: codec.NewAV1CodecConfigurationRecord(),
+    }
+}
+
+func (extra *av1ExtraData) export() []byte {
+    if extra.av1cExtra == nil {
+        panic("extra.av1cExtra must init")
+    }
+    return extra.av1cExtra.Encode()
+}
+
+func (extra *av1ExtraData) load(data []byte) {
+    if extra.av1cExtra == nil {
+        panic("extra.av1cExtra must init")
+    }
+    extra.av1cExtra.Decode(data)
+}
+
+type vp9ExtraData struct {
+    vpccExtra *codec.VPCodecConfigurationRecord
+}
+
+func newvp9ExtraData() *vp9ExtraData {
+    return &vp9ExtraData{
+        vpccExtra: &codec.VPCodecConfigurationRecord{},
+    }
+}
+
+func (extra *vp9ExtraData) export() []byte {
+    if extra.vpccExtra == nil {
+        panic("extra.vpccExtra must init")
+    }
+    return extra.vpccExtra.Encode()
+}
+
+func (extra *vp9ExtraData) load(data []byte) {
+    if extra.vpccExtra == nil {
+        panic("extra.vpccExtra must init")
+    }
+    extra.vpccExtra.Decode(data)
+}
+
 type aacExtraData struct {
     asc []byte
 }
@@ -107,6 +155,7 @@ type mp4track struct {
     sampleRate  uint32
     sampleBits  uint8
     chanelCount uint8
+    language    [3]byte
     samplelist  []sampleEntry
     elst        *movelst
     extra       extraData
@@ -121,7 +170,22 @@ type mp4track struct {
     defaultSize        uint32
     defaultDuration    uint32
     defaultSampleFlags uint32
+    trexSampleFlags    uint32
     baseDataOffset     uint64
+    tfra               []fragEntry
+    fragmentRuns       []fragmentRun
+
+    //for seek, 关键帧在samplelist中的下标, allSync时为空
+    syncSamples []int
+    allSync     bool
+
+    //for demux mp4, 按需遍历sample表, 不展开samplelist
+    sampleIter     *sampleIterator
+    chunkBuf       []byte
+    chunkBufOffset uint64
+
+    //for lpcm, 读取时转换为小端
+    pcmBigEndian bool
 
 	//for subsample
 	defaultIsProtected     uint8
@@ -133,6 +197,14 @@ type mp4track struct {
 	lastSeig               *SeigSampleGroupEntry
 	lastSaiz 			   *SaizBox
 	subSamples             []sencEntry
+
+	//faststart时mdat向后移动的距离
+	chunkOffsetDelta uint64
+
+	//for cenc muxer
+	protectionScheme ProtectionScheme
+	encryptIV        uint64
+	paramSets        *cencParamSets
 }
 
 func newmp4track(cid MP4_CODEC_TYPE, writer io.WriteSeeker) *mp4track {
@@ -154,6 +226,10 @@ func newmp4track(cid MP4_CODEC_TYPE, writer io.WriteSeeker) *mp4track {
         track.extra = new(h264ExtraData)
     } else if cid == MP4_CODEC_H265 {
         track.extra = newh265ExtraData()
+    } else if cid == MP4_CODEC_AV1 {
+        track.extra = newav1ExtraData()
+    } else if cid == MP4_CODEC_VP9 {
+        track.extra = newvp9ExtraData()
     } else if cid == MP4_CODEC_AAC {
         track.extra = new(aacExtraData)
     }
@@ -255,13 +331,13 @@ func (track *mp4track) makeStblTable() {
     }
     stco := &movstco{entryCount: ckn, chunkOffsetlist: make([]uint64, ckn)}
     for i := 0; i < int(stco.entryCount); i++ {
-        stco.chunkOffsetlist[i] = movchunks[i].chunkoffset
+        stco.chunkOffsetlist[i] = movchunks[i].chunkoffset + track.chunkOffsetDelta
     }
     track.stbltable.stts = stts
     track.stbltable.stsc = stsc
     track.stbltable.stco = stco
     track.stbltable.stsz = stsz
-    if track.cid == MP4_CODEC_H264 || track.cid == MP4_CODEC_H265 {
+    if track.cid == MP4_CODEC_H264 || track.cid == MP4_CODEC_H265 || track.cid == MP4_CODEC_AV1 {
         track.stbltable.ctts = ctts
     }
 }
@@ -281,6 +357,10 @@ func (track *mp4track) writeSample(sample []byte, pts, dts uint64) (err error) {
         err = track.writeH264(sample, pts, dts)
     case MP4_CODEC_H265:
         err = track.writeH265(sample, pts, dts)
+    case MP4_CODEC_AV1:
+        err = track.writeAV1(sample, pts, dts)
+    case MP4_CODEC_VP9:
+        err = track.writeVP9(sample, pts, dts)
     case MP4_CODEC_AAC:
         err = track.writeAAC(sample, pts, dts)
     case MP4_CODEC_G711A, MP4_CODEC_G711U:
@@ -289,6 +369,10 @@ func (track *mp4track) writeSample(sample []byte, pts, dts uint64) (err error) {
         err = track.writeMP3(sample, pts, dts)
     case MP4_CODEC_OPUS:
         err = track.writeOPUS(sample, pts, dts)
+    case MP4_CODEC_LPCM:
+        err = track.writeLPCM(sample, pts, dts)
+    case MP4_CODEC_WEBVTT, MP4_CODEC_TTML, MP4_CODEC_TX3G, MP4_CODEC_ID3, MP4_CODEC_URIM:
+        err = track.writeText(sample, pts, dts)
     }
     return err
 }
@@ -334,26 +418,9 @@ func (track *mp4track) writeH264(h264 []byte, pts, dts uint64) (err error) {
         //aud/sps/pps/sei 为帧间隔
         //通过first_slice_in_mb来判断，改nalu是否为一帧的开头
         if track.lastSample.hasVcl && isH264NewAccessUnit(nalu) {
-            var currentOffset int64
-            if currentOffset, err = track.writer.Seek(0, io.SeekCurrent); err != nil {
+            if err = track.writeLastSample(); err != nil {
                 return false
             }
-            entry := sampleEntry{
-                pts:                    track.lastSample.pts,
-                dts:                    track.lastSample.dts,
-                size:                   0,
-                isKeyFrame:             track.lastSample.isKey,
-                SampleDescriptionIndex: 1,
-                offset:                 uint64(currentOffset),
-            }
-            n := 0
-            if n, err = track.writer.Write(track.lastSample.cache); err != nil {
-                return false
-            }
-            entry.size = uint64(n)
-            track.addSampleEntry(entry)
-            track.lastSample.cache = track.lastSample.cache[:0]
-            track.lastSample.hasVcl = false
         }
         if codec.IsH264VCLNaluType(nalu_type) {
             track.lastSample.pts = pts
@@ -396,26 +463,9 @@ func (track *mp4track) writeH265(h265 []byte, pts, dts uint64) (err error) {
         }
 
         if track.lastSample.hasVcl && isH265NewAccessUnit(nalu) {
-            var currentOffset int64
-            if currentOffset, err = track.writer.Seek(0, io.SeekCurrent); err != nil {
+            if err = track.writeLastSample(); err != nil {
                 return false
             }
-            entry := sampleEntry{
-                pts:                    track.lastSample.pts,
-                dts:                    track.lastSample.dts,
-                size:                   0,
-                isKeyFrame:             track.lastSample.isKey,
-                SampleDescriptionIndex: 1,
-                offset:                 uint64(currentOffset),
-            }
-            n := 0
-            if n, err = track.writer.Write(track.lastSample.cache); err != nil {
-                return false
-            }
-            entry.size = uint64(n)
-            track.addSampleEntry(entry)
-            track.lastSample.cache = track.lastSample.cache[:0]
-            track.lastSample.hasVcl = false
         }
         if codec.IsH265VCLNaluType(nalu_type) {
             track.lastSample.pts = pts
@@ -432,6 +482,89 @@ func (track *mp4track) writeH265(h265 []byte, pts, dts uint64) (err error) {
     return
 }
 
+// av1 sample is a temporal unit,temporal delimiter obu should be removed
+// and every obu must has obu_size field
+func (track *mp4track) writeAV1(av1 []byte, pts, dts uint64) (err error) {
+    av1extra, ok := track.extra.(*av1ExtraData)
+    if !ok {
+        panic("must init av1ExtraData first")
+    }
+
+    if track.lastSample.hasVcl {
+        if err = track.writeLastSample(); err != nil {
+            return
+        }
+    }
+
+    err = codec.SplitAV1OBU(av1, func(obu []byte) bool {
+        switch codec.AV1ObuType(obu) {
+        case codec.AV1_OBU_TEMPORAL_DELIMITER, codec.AV1_OBU_TILE_LIST, codec.AV1_OBU_PADDING:
+            return true
+        case codec.AV1_OBU_SEQUENCE_HEADER:
+            if e := av1extra.av1cExtra.UpdateSequenceHeader(obu); e != nil {
+                return true
+            }
+            if track.width == 0 || track.height == 0 {
+                width, height := codec.GetAV1Resolution(obu)
+                if track.width == 0 {
+                    track.width = width
+                }
+                if track.height == 0 {
+                    track.height = height
+                }
+            }
+        case codec.AV1_OBU_FRAME, codec.AV1_OBU_FRAME_HEADER, codec.AV1_OBU_TILE_GROUP:
+            track.lastSample.hasVcl = true
+        }
+        track.lastSample.cache = append(track.lastSample.cache, codec.ConvertAV1ObuToSizedObu(obu)...)
+        return true
+    })
+    if err != nil {
+        return
+    }
+    track.lastSample.pts = pts
+    track.lastSample.dts = dts
+    track.lastSample.isKey = codec.IsAV1KeyFrame(av1)
+    return
+}
+
+// vp9 sample 为一帧或者一个superframe
+func (track *mp4track) writeVP9(vp9 []byte, pts, dts uint64) (err error) {
+    vp9extra, ok := track.extra.(*vp9ExtraData)
+    if !ok {
+        panic("must init vp9ExtraData first")
+    }
+
+    if track.lastSample.hasVcl {
+        if err = track.writeLastSample(); err != nil {
+            return
+        }
+    }
+
+    isKey := codec.IsVP9KeyFrame(vp9)
+    if isKey {
+        if vpcc, e := codec.CreateVPCodecConfigurationRecord(vp9); e == nil {
+            vp9extra.vpccExtra = vpcc
+        }
+        if track.width == 0 || track.height == 0 {
+            if width, height, e := codec.GetVP9Resolution(vp9); e == nil {
+                if track.width == 0 {
+                    track.width = width
+                }
+                if track.height == 0 {
+                    track.height = height
+                }
+            }
+        }
+    }
+    track.lastSample.pts = pts
+    track.lastSample.dts = dts
+    track.lastSample.hasVcl = true
+    track.lastSample.isKey = isKey
+    track.lastSample.cache = append(track.lastSample.cache, vp9...)
+    return
+}
+
 func (track *mp4track) writeAAC(aacframes []byte, pts, dts uint64) (err error) {
     aacextra, ok := track.extra.(*aacExtraData)
     if !ok {
@@ -533,28 +666,19 @@ func (track *mp4track) writeOPUS(opus []byte, pts, dts uint64) (err error) {
     return track.writeG711(opus, pts, dts)
 }
 
+//16bit小端PCM, 一次写入作为一个sample
+func (track *mp4track) writeLPCM(pcm []byte, pts, dts uint64) (err error) {
+    if track.sampleBits == 0 {
+        track.sampleBits = 16
+    }
+    return track.writeG711(pcm, pts, dts)
+}
+
 func (track *mp4track) flush() (err error) {
-    var currentOffset int64
     if track.lastSample != nil && len(track.lastSample.cache) > 0 {
-        if currentOffset, err = track.writer.Seek(0, io.SeekCurrent); err != nil {
+        if err = track.writeLastSample(); err != nil {
             return err
         }
-        entry := sampleEntry{
-            pts:                    track.lastSample.pts,
-            dts:                    track.lastSample.dts,
-            isKeyFrame:             track.lastSample.isKey,
-            size:                   0,
-            SampleDescriptionIndex: 1,
-            offset:                 uint64(currentOffset),
-        }
-        n := 0
-        if n, err = track.writer.Write(track.lastSample.cache); err != nil {
-            return err
-        }
-        entry.size = uint64(n)
-        track.addSampleEntry(entry)
-        track.lastSample.cache = track.lastSample.cache[:0]
-        track.lastSample.hasVcl = false
         track.lastSample.isKey = false
         track.lastSample.dts = 0
         track.lastSample.pts = 0
@@ -562,6 +686,32 @@ func (track *mp4track) flush() (err error) {
     return nil
 }
 
+//把缓存的上一个sample写入文件
+func (track *mp4track) writeLastSample() (err error) {
+    var currentOffset int64
+    if currentOffset, err = track.writer.Seek(0, io.SeekCurrent); err != nil {
+        return
+    }
+    entry := sampleEntry{
+        pts:                    track.lastSample.pts,
+        dts:                    track.lastSample.dts,
+        size:                   0,
+        isKeyFrame:             track.lastSample.isKey,
+        SampleDescriptionIndex: 1,
+        offset:                 uint64(currentOffset),
+    }
+    n := 0
+    if n, err = track.writer.Write(track.lastSample.cache); err != nil {
+        return
+    }
+    entry.size = uint64(n)
+    track.addSampleEntry(entry)
+    track.lastSample.cache = track.lastSample.cache[:0]
+    track.lastSample.hasVcl = false
+    return nil
+}
+
 func (track *mp4track) clearSamples() {
     track.samplelist = track.samplelist[:0]
+    track.subSamples = track.subSamples[:0]
 }
@@ -1,9 +1,9 @@
 package mp4
 
-func makeMvex(muxer *Movmuxer) []byte {
+func makeMvex(tracks []*mp4track) []byte {
 	trexs := make([]byte, 0, 64)
-	for i := uint32(1); i < muxer.nextTrackId; i++ {
-		trex := NewTrackExtendsBox(muxer.tracks[i].trackId)
+	for _, track := range tracks {
+		trex := NewTrackExtendsBox(track.trackId)
 		trex.DefaultSampleDescriptionIndex = 1
 		_, boxData := trex.Encode()
 		trexs = append(trexs, boxData...)
@@ -0,0 +1,78 @@
+package mp4
+
+import (
+	"io"
+)
+
+// ISO/IEC 23003-5
+// aligned(8) class PCMConfig() extends FullBox('pcmC', version = 0, 0) {
+//     unsigned int(8) format_flags;
+//     unsigned int(8) PCM_sample_size;
+// }
+// format_flags & 0x01 == 1 表示小端
+
+type PCMConfigBox struct {
+	Box           *FullBox
+	FormatFlags   uint8
+	PCMSampleSize uint8
+}
+
+func NewPCMConfigBox() *PCMConfigBox {
+	return &PCMConfigBox{
+		Box: NewFullBox([4]byte{'p', 'c', 'm', 'C'}, 0),
+	}
+}
+
+func (pcmc *PCMConfigBox) Size() uint64 {
+	return FullBoxLen + 2
+}
+
+func (pcmc *PCMConfigBox) Encode() (int, []byte) {
+	pcmc.Box.Box.Size = pcmc.Size()
+	offset, buf := pcmc.Box.Encode()
+	buf[offset] = pcmc.FormatFlags
+	buf[offset+1] = pcmc.PCMSampleSize
+	return offset + 2, buf
+}
+
+func (pcmc *PCMConfigBox) Decode(r io.Reader) (offset int, err error) {
+	if offset, err = pcmc.Box.Decode(r); err != nil {
+		return
+	}
+	buf := make([]byte, 2)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return
+	}
+	pcmc.FormatFlags = buf[0]
+	pcmc.PCMSampleSize = buf[1]
+	return offset + 2, nil
+}
+
+func (pcmc *PCMConfigBox) isLittleEndian() bool {
+	return pcmc.FormatFlags&0x01 == 1
+}
+
+func makePcmCBox(sampleBits uint8) []byte {
+	pcmc := NewPCMConfigBox()
+	pcmc.FormatFlags = 0x01
+	pcmc.PCMSampleSize = sampleBits
+	_, boxdata := pcmc.Encode()
+	return boxdata
+}
+
+func decodePcmCBox(demuxer *MovDemuxer, size uint32) (err error) {
+	pcmc := NewPCMConfigBox()
+	offset, err := pcmc.Decode(demuxer.reader)
+	if err != nil {
+		return
+	}
+	if remain := int64(size) - BasicBoxLen - int64(offset); remain > 0 {
+		if _, err = io.CopyN(io.Discard, demuxer.reader, remain); err != nil {
+			return
+		}
+	}
+	track := demuxer.tracks[len(demuxer.tracks)-1]
+	track.sampleBits = pcmc.PCMSampleSize
+	track.pcmBigEndian = !pcmc.isLittleEndian()
+	return
+}
@@ -1,6 +1,7 @@
 package mp4
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 	"encoding/hex"
@@ -49,6 +50,35 @@ func (pssh *PsshBox) Decode(r io.Reader, size uint32) (offset int, err error) {
 	return
 }
 
+// KIDs不为空时使用version 1
+func (pssh *PsshBox) Encode() (int, []byte) {
+	version := uint8(0)
+	if len(pssh.KIDs) > 0 {
+		version = 1
+	}
+	box := NewFullBox([4]byte{'p', 's', 's', 'h'}, version)
+	box.Box.Size = FullBoxLen + 16 + 4 + uint64(len(pssh.Data))
+	if version > 0 {
+		box.Box.Size += 4 + 16*uint64(len(pssh.KIDs))
+	}
+	offset, buf := box.Encode()
+	copy(buf[offset:], pssh.SystemID[:])
+	offset += 16
+	if version > 0 {
+		binary.BigEndian.PutUint32(buf[offset:], uint32(len(pssh.KIDs)))
+		offset += 4
+		for _, kid := range pssh.KIDs {
+			copy(buf[offset:], kid[:])
+			offset += 16
+		}
+	}
+	binary.BigEndian.PutUint32(buf[offset:], uint32(len(pssh.Data)))
+	offset += 4
+	copy(buf[offset:], pssh.Data)
+	offset += len(pssh.Data)
+	return offset, buf
+}
+
 func (pssh *PsshBox) IsWidevine() bool {
 	return hex.EncodeToString(pssh.SystemID[:]) == UUIDWidevine
 }
@@ -66,6 +96,12 @@ func decodePsshBox(demuxer *MovDemuxer, size uint32) (err error) {
 	if _, err = pssh.Decode(demuxer.reader, size); err != nil {
 		return err
 	}
+	//moof中重复的pssh只保留一个
+	for _, p := range demuxer.pssh {
+		if p.SystemID == pssh.SystemID && bytes.Equal(p.Data, pssh.Data) {
+			return
+		}
+	}
 	demuxer.pssh = append(demuxer.pssh, pssh)
 	return
 }
@@ -94,3 +94,14 @@ func decodeSaioBox(demuxer *MovDemuxer, size uint32) error {
 	}
  	return nil
 }
+
+// 只有一个entry, offset为senc中第一个sample的辅助信息相对moof的偏移
+func makeSaioBox(offset uint32) []byte {
+	saio := NewFullBox([4]byte{'s', 'a', 'i', 'o'}, 0)
+	saio.Box.Size = FullBoxLen + 8
+	n, saioBox := saio.Encode()
+	binary.BigEndian.PutUint32(saioBox[n:], 1)
+	n += 4
+	binary.BigEndian.PutUint32(saioBox[n:], offset)
+	return saioBox
+}
@@ -59,3 +59,31 @@ func decodeSaizBox(demuxer *MovDemuxer, size uint32) error {
 	demuxer.currentTrack.lastSaiz = &saiz
 	return nil
 }
+
+// aux_info_type省略, 默认为schm中的scheme_type
+func makeSaizBox(track *mp4track, useSubsample bool) []byte {
+	saiz := NewFullBox([4]byte{'s', 'a', 'i', 'z'}, 0)
+	sizes := make([]byte, len(track.subSamples))
+	defaultSize := -1
+	for i, entry := range track.subSamples {
+		sizes[i] = uint8(sencEntrySize(entry, useSubsample))
+		if defaultSize == -1 {
+			defaultSize = int(sizes[i])
+		} else if defaultSize != int(sizes[i]) {
+			defaultSize = 0
+		}
+	}
+	if defaultSize > 0 {
+		sizes = sizes[:0]
+	} else {
+		defaultSize = 0
+	}
+	saiz.Box.Size = FullBoxLen + 5 + uint64(len(sizes))
+	offset, saizBox := saiz.Encode()
+	saizBox[offset] = uint8(defaultSize)
+	offset++
+	binary.BigEndian.PutUint32(saizBox[offset:], uint32(len(track.subSamples)))
+	offset += 4
+	copy(saizBox[offset:], sizes)
+	return saizBox
+}
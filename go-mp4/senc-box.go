@@ -60,11 +60,53 @@ func (senc *SencBox) Decode(r io.Reader, size uint32, perSampleIVSize uint8) (of
 }
 
 func decodeSencBox(demuxer *MovDemuxer, size uint32) (err error) {
-	perSampleIVSize := demuxer.tracks[len(demuxer.tracks)-1].defaultPerSampleIVSize
+	track := demuxer.currentTrack
+	if track == nil {
+		track = demuxer.tracks[len(demuxer.tracks)-1]
+	}
+	perSampleIVSize := track.defaultPerSampleIVSize
 	senc := SencBox{Box: new(FullBox)}
 	if _, err = senc.Decode(demuxer.reader, size, perSampleIVSize); err != nil {
 		return err
 	}
-	demuxer.currentTrack.subSamples = append(demuxer.currentTrack.subSamples, senc.EntryList.entrys...)
+	track.subSamples = append(track.subSamples, senc.EntryList.entrys...)
 	return
 }
+
+func sencEntrySize(entry sencEntry, useSubsample bool) int {
+	size := len(entry.iv)
+	if useSubsample {
+		size += 2 + 6*len(entry.subSamples)
+	}
+	return size
+}
+
+func makeSencBox(track *mp4track, useSubsample bool) []byte {
+	senc := NewFullBox([4]byte{'s', 'e', 'n', 'c'}, 0)
+	if useSubsample {
+		senc.Flags[2] = uint8(UseSubsampleEncryption)
+	}
+	senc.Box.Size = FullBoxLen + 4
+	for _, entry := range track.subSamples {
+		senc.Box.Size += uint64(sencEntrySize(entry, useSubsample))
+	}
+	offset, sencBox := senc.Encode()
+	binary.BigEndian.PutUint32(sencBox[offset:], uint32(len(track.subSamples)))
+	offset += 4
+	for _, entry := range track.subSamples {
+		copy(sencBox[offset:], entry.iv)
+		offset += len(entry.iv)
+		if !useSubsample {
+			continue
+		}
+		binary.BigEndian.PutUint16(sencBox[offset:], uint16(len(entry.subSamples)))
+		offset += 2
+		for _, sub := range entry.subSamples {
+			binary.BigEndian.PutUint16(sencBox[offset:], sub.bytesOfClearData)
+			offset += 2
+			binary.BigEndian.PutUint32(sencBox[offset:], sub.bytesOfProtectedData)
+			offset += 4
+		}
+	}
+	return sencBox
+}
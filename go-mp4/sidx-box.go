@@ -137,24 +137,32 @@ func (sidx *SegmentIndexBox) Encode() (int, []byte) {
     return offset, boxdata
 }
 
-func makeSidxBox(track *mp4track, totalSidxSize uint32, refsize uint32) []byte {
+// firstOffset为sidx结束到moof的距离, refsize为moof+mdat的大小
+func makeSidxBox(track *mp4track, firstOffset uint64, refsize uint32) []byte {
     sidx := NewSegmentIndexBox()
     sidx.ReferenceID = track.trackId
     sidx.TimeScale = track.timescale
-    sidx.EarliestPresentationTime = track.startPts
     sidx.ReferenceCount = 1
-    sidx.FirstOffset = 52 + uint64(totalSidxSize)
+    sidx.FirstOffset = firstOffset
     entry := sidxEntry{
         ReferenceType:      0,
         ReferencedSize:     refsize,
-        SubsegmentDuration: 0,
-        StartsWithSAP:      1,
+        SubsegmentDuration: uint32(track.fragmentDuration()),
+        StartsWithSAP:      0,
         SAPType:            0,
         SAPDeltaTime:       0,
     }
-
     if len(track.samplelist) > 0 {
-        entry.SubsegmentDuration = uint32(track.samplelist[len(track.samplelist)-1].dts) - uint32(track.startDts)
+        sidx.EarliestPresentationTime = track.samplelist[0].pts
+        for _, sample := range track.samplelist {
+            if sample.pts < sidx.EarliestPresentationTime {
+                sidx.EarliestPresentationTime = sample.pts
+            }
+        }
+        if track.startsWithSAP() {
+            entry.StartsWithSAP = 1
+            entry.SAPType = 1
+        }
     }
     sidx.Entrys = append(sidx.Entrys, entry)
     sidx.Box.Box.Size = sidx.Size()
@@ -0,0 +1,63 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// aligned(8) class ProtectionSchemeInfoBox(fmt) extends Box('sinf') {
+//     OriginalFormatBox(fmt) original_format;
+//     SchemeTypeBox scheme_type_box;
+//     SchemeInformationBox info;
+// }
+
+func makeSinfBox(track *mp4track, scheme ProtectionScheme) []byte {
+	frma := makeFrmaBox(getCodecNameWithCodecId(track.cid))
+	schm := makeSchmBox(scheme)
+	tenc := makeTencBox(track)
+
+	schi := BasicBox{Type: [4]byte{'s', 'c', 'h', 'i'}}
+	schi.Size = 8 + uint64(len(tenc))
+	offset, schiBox := schi.Encode()
+	copy(schiBox[offset:], tenc)
+
+	sinf := BasicBox{Type: [4]byte{'s', 'i', 'n', 'f'}}
+	sinf.Size = 8 + uint64(len(frma)+len(schm)+len(schiBox))
+	offset, sinfBox := sinf.Encode()
+	copy(sinfBox[offset:], frma)
+	offset += len(frma)
+	copy(sinfBox[offset:], schm)
+	offset += len(schm)
+	copy(sinfBox[offset:], schiBox)
+	return sinfBox
+}
+
+// aligned(8) class SchemeTypeBox extends FullBox('schm', 0, flags) {
+//     unsigned int(32) scheme_type;
+//     unsigned int(32) scheme_version;
+// }
+
+func makeSchmBox(scheme ProtectionScheme) []byte {
+	schm := NewFullBox([4]byte{'s', 'c', 'h', 'm'}, 0)
+	schm.Box.Size = FullBoxLen + 8
+	offset, schmBox := schm.Encode()
+	fourcc := scheme.fourcc()
+	copy(schmBox[offset:], fourcc[:])
+	offset += 4
+	binary.BigEndian.PutUint32(schmBox[offset:], 0x00010000)
+	return schmBox
+}
+
+func decodeSchmBox(demuxer *MovDemuxer, size uint32) (err error) {
+	buf := make([]byte, size-BasicBoxLen)
+	if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+		return
+	}
+	if len(buf) < 8 {
+		return
+	}
+	var fourcc [4]byte
+	copy(fourcc[:], buf[4:8])
+	demuxer.tracks[len(demuxer.tracks)-1].protectionScheme = getProtectionScheme(fourcc)
+	return
+}
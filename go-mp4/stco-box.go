@@ -134,7 +134,15 @@ func (co64 *ChunkLargeOffsetBox) Encode() (int, []byte) {
 
 func makeStco(stco *movstco) (boxdata []byte) {
 
-	if stco.entryCount > 0 && stco.chunkOffsetlist[stco.entryCount-1] > 0xFFFFFFFF {
+	//任何一个chunk offset超过32位都需要co64
+	large := false
+	for _, offset := range stco.chunkOffsetlist {
+		if offset > 0xFFFFFFFF {
+			large = true
+			break
+		}
+	}
+	if large {
 		co64 := NewChunkLargeOffsetBox()
 		co64.stco = stco
 		_, boxdata = co64.Encode()
@@ -314,7 +314,7 @@ func makeStsd(track *mp4track, handler_type HandlerType) []byte {
     var avbox []byte
     var extraData []byte
     if len(track.extraData) == 0 {
-        if track.cid == MP4_CODEC_AAC || track.cid == MP4_CODEC_H264 || track.cid == MP4_CODEC_H265 {
+        if track.cid == MP4_CODEC_AAC || track.cid == MP4_CODEC_H264 || track.cid == MP4_CODEC_H265 || track.cid == MP4_CODEC_AV1 || track.cid == MP4_CODEC_VP9 {
             if track.extra == nil {
                 panic(fmt.Sprintf("track %d:extra is nil", track.trackId))
             }
@@ -328,27 +328,47 @@ func makeStsd(track *mp4track, handler_type HandlerType) []byte {
         avbox = makeAvcCBox(extraData)
     } else if track.cid == MP4_CODEC_H265 {
         avbox = makeHvcCBox(extraData)
+    } else if track.cid == MP4_CODEC_AV1 {
+        avbox = makeAv1CBox(extraData)
+    } else if track.cid == MP4_CODEC_VP9 {
+        avbox = makeVpcCBox(extraData)
     } else if track.cid == MP4_CODEC_AAC || track.cid == MP4_CODEC_MP2 || track.cid == MP4_CODEC_MP3 {
         avbox = makeEsdsBox(track.trackId, track.cid, extraData)
     } else if track.cid == MP4_CODEC_OPUS {
         avbox = makeOpusSpecificBox(extraData)
+    } else if track.cid == MP4_CODEC_LPCM {
+        avbox = makePcmCBox(track.sampleBits)
+    }
+
+    //加密的track使用encv/enca, 原始格式写入sinf
+    format := getCodecNameWithCodecId(track.cid)
+    if track.defaultIsProtected == 1 {
+        avbox = append(avbox, makeSinfBox(track, track.protectionScheme)...)
+        if handler_type.equal(vide) {
+            format = [4]byte{'e', 'n', 'c', 'v'}
+        } else {
+            format = [4]byte{'e', 'n', 'c', 'a'}
+        }
     }
 
     var se []byte
     var offset int
     if handler_type.equal(vide) {
-        entry := NewVisualSampleEntry(getCodecNameWithCodecId(track.cid))
+        entry := NewVisualSampleEntry(format)
         entry.width = uint16(track.width)
         entry.height = uint16(track.height)
         entry.entry.box.Size = entry.Size() + uint64(len(avbox))
         offset, se = entry.Encode()
     } else if handler_type.equal(soun) {
-        entry := NewAudioSampleEntry(getCodecNameWithCodecId(track.cid))
+        entry := NewAudioSampleEntry(format)
         entry.channelcount = uint16(track.chanelCount)
         entry.samplerate = track.sampleRate
         entry.samplesize = uint16(track.sampleBits)
         entry.entry.box.Size = entry.Size() + uint64(len(avbox))
         offset, se = entry.Encode()
+    } else {
+        se = makeTextSampleEntry(track)
+        offset = len(se)
     }
     copy(se[offset:], avbox)
 
@@ -401,6 +421,60 @@ func decodeHvccBox(demuxer *MovDemuxer, size uint32) (err error) {
         return
     }
     track := demuxer.tracks[len(demuxer.tracks)-1]
+    if track.extra == nil {
+        track.extra = newh265ExtraData()
+    }
+    track.extra.load(buf)
+    return
+}
+
+func makeAv1CBox(extraData []byte) []byte {
+    av1c := BasicBox{Type: [4]byte{'a', 'v', '1', 'C'}}
+    av1c.Size = 8 + uint64(len(extraData))
+    offset, boxdata := av1c.Encode()
+    copy(boxdata[offset:], extraData)
+    return boxdata
+}
+
+func decodeAv1CBox(demuxer *MovDemuxer, size uint32) (err error) {
+    buf := make([]byte, size-BasicBoxLen)
+    if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+        return
+    }
+    track := demuxer.tracks[len(demuxer.tracks)-1]
+    if track.extra == nil {
+        track.extra = newav1ExtraData()
+    }
+    track.extra.load(buf)
+    return
+}
+
+// VP Codec ISO Media File Format Binding
+// class VPCodecConfigurationBox extends FullBox('vpcC', version = 1, 0)
+// {
+//     VPCodecConfigurationRecord() vpcConfig;
+// }
+func makeVpcCBox(extraData []byte) []byte {
+    vpcc := FullBox{Box: NewBasicBox([4]byte{'v', 'p', 'c', 'C'}), Version: 1}
+    vpcc.Box.Size = vpcc.Size() + uint64(len(extraData))
+    offset, boxdata := vpcc.Encode()
+    copy(boxdata[offset:], extraData)
+    return boxdata
+}
+
+func decodeVpcCBox(demuxer *MovDemuxer, size uint32) (err error) {
+    vpcc := FullBox{}
+    if _, err = vpcc.Decode(demuxer.reader); err != nil {
+        return
+    }
+    buf := make([]byte, size-FullBoxLen)
+    if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+        return
+    }
+    track := demuxer.tracks[len(demuxer.tracks)-1]
+    if track.extra == nil {
+        track.extra = newvp9ExtraData()
+    }
     track.extra.load(buf)
     return
 }
@@ -35,3 +35,34 @@ func decodeTencBox(demuxer *MovDemuxer, size uint32) (err error) {
 	}
 	return nil
 }
+
+// aligned(8) class TrackEncryptionBox extends FullBox('tenc', version, flags=0)
+// cbcs使用version 1, 写入crypt/skip pattern
+func makeTencBox(track *mp4track) []byte {
+	tenc := NewFullBox([4]byte{'t', 'e', 'n', 'c'}, 0)
+	if track.defaultCryptByteBlock != 0 || track.defaultSkipByteBlock != 0 {
+		tenc.Version = 1
+	}
+	tenc.Box.Size = FullBoxLen + 20
+	if track.defaultPerSampleIVSize == 0 {
+		tenc.Box.Size += 1 + uint64(len(track.defaultConstantIV))
+	}
+	offset, tencBox := tenc.Encode()
+	offset++
+	if tenc.Version != 0 {
+		tencBox[offset] = track.defaultCryptByteBlock<<4 | track.defaultSkipByteBlock&0x0f
+	}
+	offset++
+	tencBox[offset] = track.defaultIsProtected
+	offset++
+	tencBox[offset] = track.defaultPerSampleIVSize
+	offset++
+	copy(tencBox[offset:], track.defaultKID[:])
+	offset += 16
+	if track.defaultPerSampleIVSize == 0 {
+		tencBox[offset] = uint8(len(track.defaultConstantIV))
+		offset++
+		copy(tencBox[offset:], track.defaultConstantIV)
+	}
+	return tencBox
+}
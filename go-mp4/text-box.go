@@ -0,0 +1,199 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// 字幕和timed metadata track
+// WebVTT/TTML: ISO/IEC 14496-30, tx3g: 3GPP TS 26.245
+// AOM Carriage of ID3 Timed Metadata in CMAF只定义了emsg方式, ID3 track写成uri为id3SchemeUri的urim是私有映射
+
+const id3SchemeUri = "https://aomedia.org/emsg/ID3"
+const ttmlNamespace = "http://www.w3.org/ns/ttml"
+
+// Box Types: 'nmhd', 'sthd', 内容只有FullBox头
+func makeNmhdBox() []byte {
+	_, boxdata := NewFullBox([4]byte{'n', 'm', 'h', 'd'}, 0).Encode()
+	return boxdata
+}
+
+func makeSthdBox() []byte {
+	_, boxdata := NewFullBox([4]byte{'s', 't', 'h', 'd'}, 0).Encode()
+	return boxdata
+}
+
+// class WVTTSampleEntry() extends PlainTextSampleEntry('wvtt') {
+//     WebVTTConfigurationBox config; //'vttC', WebVTT文件头, 比如"WEBVTT"
+//     WebVTTSourceLabelBox label;    // recommended
+//     MPEG4BitRateBox ();            // optional
+// }
+//
+// class XMLSubtitleSampleEntry() extends SubtitleSampleEntry('stpp') {
+//     string namespace;
+//     string schema_location; // optional
+//     string auxiliary_mime_types; // optional
+// }
+//
+// class TextSampleEntry() extends SampleEntry('tx3g') {
+//     unsigned int(32) displayFlags;
+//     signed int(8) horizontal-justification;
+//     signed int(8) vertical-justification;
+//     unsigned int(8) background-color-rgba[4];
+//     BoxRecord default-text-box;
+//     StyleRecord default-style;
+//     FontTableBox font-table;
+// }
+//
+// class URIMetaSampleEntry() extends MetaDataSampleEntry('urim') {
+//     URIBox the_label; //FullBox('uri ', 0, 0) { string theURI; }
+// }
+
+func makeTextSampleEntry(track *mp4track) []byte {
+	var payload []byte
+	switch track.cid {
+	case MP4_CODEC_WEBVTT:
+		config := []byte("WEBVTT")
+		if len(track.extraData) > 0 {
+			config = track.extraData
+		}
+		vttc, _ := NewBoxNode([4]byte{'v', 't', 't', 'C'}, config).Bytes()
+		payload = vttc
+	case MP4_CODEC_TTML:
+		payload = append([]byte(ttmlNamespace), 0, 0, 0)
+	case MP4_CODEC_TX3G:
+		if len(track.extraData) > 0 {
+			payload = track.extraData
+			break
+		}
+		payload = make([]byte, 38)
+		payload[4] = 1    //水平居中
+		payload[5] = 0xff //底部对齐
+		binary.BigEndian.PutUint16(payload[14:], uint16(track.height))
+		binary.BigEndian.PutUint16(payload[16:], uint16(track.width))
+		binary.BigEndian.PutUint16(payload[22:], 1) //font-ID
+		payload[25] = 18                            //font-size
+		binary.BigEndian.PutUint32(payload[26:], 0xFFFFFFFF)
+		ftab, _ := NewBoxNode([4]byte{'f', 't', 'a', 'b'}, []byte{0, 1, 0, 1, 5, 'S', 'e', 'r', 'i', 'f'}).Bytes()
+		payload = append(payload[:30], ftab...)
+	case MP4_CODEC_ID3, MP4_CODEC_URIM:
+		theUri := id3SchemeUri
+		if track.cid == MP4_CODEC_URIM {
+			theUri = string(track.extraData)
+		}
+		uri, _ := NewBoxNode([4]byte{'u', 'r', 'i', ' '}, append(make([]byte, 4, 5+len(theUri)), append([]byte(theUri), 0)...)).Bytes()
+		payload = uri
+	}
+	entry := NewSampleEntry(getCodecNameWithCodecId(track.cid))
+	entry.box.Size = entry.Size() + uint64(len(payload))
+	offset, boxdata := entry.Encode()
+	copy(boxdata[offset:], payload)
+	return boxdata
+}
+
+func decodeTextSampleEntry(demuxer *MovDemuxer, cid MP4_CODEC_TYPE, size uint32) (err error) {
+	if size < BasicBoxLen+8 {
+		return errors.New("text sample entry too short")
+	}
+	buf := make([]byte, size-BasicBoxLen)
+	if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+		return
+	}
+	track := demuxer.tracks[len(demuxer.tracks)-1]
+	track.cid = cid
+	switch cid {
+	case MP4_CODEC_WEBVTT:
+		if children, e := parseBoxes(buf[8:], 0, nil); e == nil {
+			for _, child := range children {
+				if child.Type == [4]byte{'v', 't', 't', 'C'} {
+					track.extraData = child.Data
+				}
+			}
+		}
+	case MP4_CODEC_TX3G:
+		track.extraData = buf[8:]
+	case MP4_CODEC_ID3:
+		//uri不是id3SchemeUri的作为MP4_CODEC_URIM输出, sample不做处理
+		track.cid = MP4_CODEC_URIM
+		if children, e := parseBoxes(buf[8:], 0, nil); e == nil {
+			for _, child := range children {
+				if child.Type == [4]byte{'u', 'r', 'i', ' '} && len(child.Data) > 4 {
+					track.extraData = []byte(strings.TrimRight(string(child.Data[4:]), "\x00"))
+				}
+			}
+		}
+		if string(track.extraData) == id3SchemeUri {
+			track.cid = MP4_CODEC_ID3
+		}
+	}
+	return
+}
+
+// WebVTT sample由vttc(cue)或者vtte(空白)组成, cue文本在vttc/payl中
+// tx3g sample为16位长度加上UTF-8文本
+func formatTextSample(cid MP4_CODEC_TYPE, data []byte) ([]byte, error) {
+	switch cid {
+	case MP4_CODEC_WEBVTT:
+		if len(data) == 0 {
+			return NewBoxNode([4]byte{'v', 't', 't', 'e'}, nil).Bytes()
+		}
+		if len(data) >= BasicBoxLen && uint64(binary.BigEndian.Uint32(data)) <= uint64(len(data)) {
+			switch string(data[4:8]) {
+			case "vttc", "vtte", "vtta":
+				return data, nil
+			}
+		}
+		vttc := NewBoxNode([4]byte{'v', 't', 't', 'c'}, nil)
+		vttc.Append(NewBoxNode([4]byte{'p', 'a', 'y', 'l'}, data))
+		return vttc.Bytes()
+	case MP4_CODEC_TX3G:
+		if len(data) > 0xFFFF {
+			return nil, errors.New("tx3g sample text too long")
+		}
+		sample := make([]byte, 2, 2+len(data))
+		binary.BigEndian.PutUint16(sample, uint16(len(data)))
+		return append(sample, data...), nil
+	}
+	return data, nil
+}
+
+// 取出cue文本, 同时显示的多个cue用换行分隔, vtte返回空
+func parseTextSample(cid MP4_CODEC_TYPE, sample []byte) []byte {
+	switch cid {
+	case MP4_CODEC_WEBVTT:
+		children, err := parseBoxes(sample, 0, nil)
+		if err != nil {
+			return sample
+		}
+		var cues [][]byte
+		for _, child := range children {
+			if child.Type != [4]byte{'v', 't', 't', 'c'} {
+				continue
+			}
+			if payl := child.Find("payl"); payl != nil {
+				cues = append(cues, payl.Data)
+			}
+		}
+		return bytes.Join(cues, []byte("\n"))
+	case MP4_CODEC_TX3G:
+		if len(sample) < 2 {
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(sample))
+		if n > len(sample)-2 {
+			n = len(sample) - 2
+		}
+		return sample[2 : 2+n]
+	}
+	return sample
+}
+
+func (track *mp4track) writeText(data []byte, pts, dts uint64) (err error) {
+	if data, err = formatTextSample(track.cid, data); err != nil {
+		return
+	}
+	return track.writeG711(data, pts, dts)
+}
@@ -0,0 +1,121 @@
+package mp4
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMuxTextTrack(t *testing.T) {
+	type cue struct {
+		data []byte
+		pts  uint64
+	}
+	tests := []struct {
+		name string
+		cid  MP4_CODEC_TYPE
+		uri  string
+		cues []cue
+		want []cue
+	}{
+		{
+			name: "webvtt",
+			cid:  MP4_CODEC_WEBVTT,
+			cues: []cue{{[]byte("hello"), 0}, {nil, 1000}, {[]byte("world"), 1500}, {nil, 3000}},
+			want: []cue{{[]byte("hello"), 0}, {[]byte{}, 1000}, {[]byte("world"), 1500}, {[]byte{}, 3000}},
+		},
+		{
+			name: "webvtt boxes",
+			cid:  MP4_CODEC_WEBVTT,
+			cues: []cue{{append(mustBoxBytes(t, "vttc", "payl", "a"), mustBoxBytes(t, "vttc", "payl", "b")...), 0}, {nil, 500}},
+			want: []cue{{[]byte("a\nb"), 0}, {[]byte{}, 500}},
+		},
+		{
+			name: "tx3g",
+			cid:  MP4_CODEC_TX3G,
+			cues: []cue{{[]byte("字幕"), 0}, {nil, 2000}},
+			want: []cue{{[]byte("字幕"), 0}, {[]byte{}, 2000}},
+		},
+		{
+			name: "ttml",
+			cid:  MP4_CODEC_TTML,
+			cues: []cue{{[]byte(`<tt xmlns="http://www.w3.org/ns/ttml"></tt>`), 0}},
+			want: []cue{{[]byte(`<tt xmlns="http://www.w3.org/ns/ttml"></tt>`), 0}},
+		},
+		{
+			name: "id3",
+			cid:  MP4_CODEC_ID3,
+			uri:  EmsgSchemeID3,
+			cues: []cue{{[]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), 0}},
+			want: []cue{{[]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), 0}},
+		},
+		{
+			name: "other uri",
+			cid:  MP4_CODEC_URIM,
+			uri:  "urn:example:metadata",
+			cues: []cue{{[]byte{0x01, 0x02}, 0}, {[]byte{0x03}, 40}},
+			want: []cue{{[]byte{0x01, 0x02}, 0}, {[]byte{0x03}, 40}},
+		},
+	}
+	for _, tt := range tests {
+		for _, fragment := range []bool{false, true} {
+			name := tt.name
+			var options []MuxerOption
+			if fragment {
+				name += " fragment"
+				options = append(options, WithMp4Flag(MP4_FLAG_FRAGMENT))
+			}
+			t.Run(name, func(t *testing.T) {
+				ws := newFmp4WriterSeeker(1024)
+				muxer, err := CreateMp4Muxer(ws, options...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var tid uint32
+				if tt.cid == MP4_CODEC_ID3 {
+					tid = muxer.AddMetadataTrack(tt.cid)
+				} else if tt.cid == MP4_CODEC_URIM {
+					tid = muxer.AddMetadataTrack(tt.cid, WithExtraData([]byte(tt.uri)))
+				} else {
+					tid = muxer.AddTextTrack(tt.cid, WithLanguage("eng"))
+				}
+				for _, c := range tt.cues {
+					if err := muxer.Write(tid, c.data, c.pts, c.pts); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := muxer.WriteTrailer(); err != nil {
+					t.Fatal(err)
+				}
+				demuxer := CreateMp4Demuxer(bytes.NewReader(ws.buffer))
+				infos, err := demuxer.ReadHead()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(infos) != 1 || infos[0].Cid != tt.cid || infos[0].MetadataUri != tt.uri {
+					t.Fatalf("ReadHead() = %+v", infos)
+				}
+				if tt.uri == "" && infos[0].Language != "eng" {
+					t.Errorf("language = %q", infos[0].Language)
+				}
+				var got []cue
+				for _, pkg := range readAllPackets(t, ws.buffer) {
+					got = append(got, cue{pkg.Data, pkg.Pts})
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func mustBoxBytes(t *testing.T, container, child, payload string) []byte {
+	node := NewBoxNode(fourcc(container), nil)
+	node.Append(NewBoxNode(fourcc(child), []byte(payload)))
+	data, err := node.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
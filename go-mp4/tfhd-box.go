@@ -158,6 +158,12 @@ func decodeTfhdBox(demuxer *MovDemuxer, size uint32) error {
         demuxer.tracks[i].defaultDuration = tfhd.DefaultSampleDuration
         demuxer.tracks[i].defaultSize = tfhd.DefaultSampleSize
         demuxer.tracks[i].baseDataOffset = tfhd.BaseDataOffset
+        tfhdFlags := uint32(tfhd.Box.Flags[0])<<16 | uint32(tfhd.Box.Flags[1])<<8 | uint32(tfhd.Box.Flags[2])
+        if tfhdFlags&TF_FLAG_DEAAULT_SAMPLE_FLAGS_PRESENT > 0 {
+            demuxer.tracks[i].defaultSampleFlags = tfhd.DefaultSampleFlags
+        } else {
+            demuxer.tracks[i].defaultSampleFlags = demuxer.tracks[i].trexSampleFlags
+        }
     }
     return err
 }
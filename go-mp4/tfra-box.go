@@ -81,12 +81,25 @@ func (tfra *TrackFragmentRandomAccessBox) Decode(r io.Reader) (offset int, err e
             tfra.FragEntrys.frags[i].moofOffset = uint64(binary.BigEndian.Uint32(buf[n:]))
             n += 4
         }
-        n += int(tfra.LengthSizeOfTrafNum + tfra.LengthSizeOfTrunNum + tfra.LengthSizeOfSampleNum + 3)
+        tfra.FragEntrys.frags[i].trafNumber = readTfraNumber(buf[n:], tfra.LengthSizeOfTrafNum)
+        n += int(tfra.LengthSizeOfTrafNum) + 1
+        tfra.FragEntrys.frags[i].trunNumber = readTfraNumber(buf[n:], tfra.LengthSizeOfTrunNum)
+        n += int(tfra.LengthSizeOfTrunNum) + 1
+        tfra.FragEntrys.frags[i].sampleNumber = readTfraNumber(buf[n:], tfra.LengthSizeOfSampleNum)
+        n += int(tfra.LengthSizeOfSampleNum) + 1
     }
-    offset += 4
+    offset += n
     return
 }
 
+func readTfraNumber(buf []byte, lengthSize uint8) uint32 {
+    num := uint32(0)
+    for i := 0; i <= int(lengthSize); i++ {
+        num = num<<8 | uint32(buf[i])
+    }
+    return num
+}
+
 func (tfra *TrackFragmentRandomAccessBox) Encode() (int, []byte) {
     tfra.Box.Box.Size = tfra.Size()
     offset, boxdata := tfra.Box.Encode()
@@ -136,3 +149,16 @@ func makeTfraBox(track *mp4track) []byte {
     _, tfraData := tfra.Encode()
     return tfraData
 }
+
+func decodeTfraBox(demuxer *MovDemuxer, size uint32) (err error) {
+    tfra := TrackFragmentRandomAccessBox{Box: &FullBox{Box: &BasicBox{Size: uint64(size)}}}
+    if _, err = tfra.Decode(demuxer.reader); err != nil {
+        return
+    }
+    for _, track := range demuxer.tracks {
+        if track.trackId == tfra.TrackID {
+            track.tfra = append(track.tfra, tfra.FragEntrys.frags...)
+        }
+    }
+    return
+}
@@ -1,12 +1,23 @@
 package mp4
 
-func makeTraf(track *mp4track, moofOffset uint64, moofSize uint64) []byte {
+// trafOffset为traf在moof中的偏移, 用于计算saio
+func makeTraf(track *mp4track, moofOffset uint64, moofSize uint64, trafOffset uint64) []byte {
 	tfhd := makeTfhdBox(track, moofOffset)
 	tfdt := makeTfdtBox(track)
 	trun := makeTrunBoxes(track, moofSize)
 
+	var senc, saiz, saio []byte
+	if len(track.subSamples) > 0 {
+		useSubsample := useSubsampleEncryption(track)
+		senc = makeSencBox(track, useSubsample)
+		saiz = makeSaizBox(track, useSubsample)
+		//senc的FullBox头和sample_count之后为第一个sample的辅助信息
+		sencOffset := trafOffset + 8 + uint64(len(tfhd)+len(tfdt)+len(trun)) + FullBoxLen + 4
+		saio = makeSaioBox(uint32(sencOffset))
+	}
+
 	traf := BasicBox{Type: [4]byte{'t', 'r', 'a', 'f'}}
-	traf.Size = 8 + uint64(len(tfhd)+len(tfdt)+len(trun))
+	traf.Size = 8 + uint64(len(tfhd)+len(tfdt)+len(trun)+len(senc)+len(saiz)+len(saio))
 	offset, boxData := traf.Encode()
 	copy(boxData[offset:], tfhd)
 	offset += len(tfhd)
@@ -14,5 +25,11 @@ func makeTraf(track *mp4track, moofOffset uint64, moofSize uint64) []byte {
 	offset += len(tfdt)
 	copy(boxData[offset:], trun)
 	offset += len(trun)
+	copy(boxData[offset:], senc)
+	offset += len(senc)
+	copy(boxData[offset:], saiz)
+	offset += len(saiz)
+	copy(boxData[offset:], saio)
+	offset += len(saio)
 	return boxData
 }
@@ -78,3 +78,16 @@ func makeTrexBox(track *mp4track) []byte {
 	_, boxData := trex.Encode()
 	return boxData
 }
+
+func decodeTrexBox(demuxer *MovDemuxer) (err error) {
+	trex := TrackExtendsBox{Box: new(FullBox)}
+	if _, err = trex.Decode(demuxer.reader); err != nil {
+		return
+	}
+	for _, track := range demuxer.tracks {
+		if track.trackId == trex.TrackID {
+			track.trexSampleFlags = trex.DefaultSampleFlags
+		}
+	}
+	return
+}
@@ -169,11 +169,23 @@ func decodeTrunBox(demuxer *MovDemuxer, size uint32) (err error) {
         return errors.New("current track is nil")
     }
 
+    track := demuxer.currentTrack
+    run := fragmentRun{
+        moofOffset:  uint64(demuxer.moofOffset),
+        trunNumber:  1,
+        firstSample: len(track.samplelist),
+    }
+    if n := len(track.fragmentRuns); n > 0 && track.fragmentRuns[n-1].moofOffset == run.moofOffset {
+        run.trunNumber = track.fragmentRuns[n-1].trunNumber + 1
+    }
+    track.fragmentRuns = append(track.fragmentRuns, run)
+
+    trunFlags := uint32(trun.Box.Flags[0])<<16 | uint32(trun.Box.Flags[1])<<8 | uint32(trun.Box.Flags[2])
     dataOffset := trun.Dataoffset
     nextDts := demuxer.currentTrack.startDts
     delta := 0
     var cts int64 = 0
-    for _, entry := range trun.EntryList.entrys {
+    for i, entry := range trun.EntryList.entrys {
         sample := sampleEntry{}
         sample.offset = uint64(dataOffset) + demuxer.currentTrack.baseDataOffset
         sample.dts = nextDts
@@ -190,11 +202,23 @@ func decodeTrunBox(demuxer *MovDemuxer, size uint32) (err error) {
         } else {
             delta = int(entry.sampleDuration)
         }
-        cts = int64(entry.sampleCompositionTimeOffset)
+        if trun.Box.Version == 1 {
+            cts = int64(int32(entry.sampleCompositionTimeOffset))
+        } else {
+            cts = int64(entry.sampleCompositionTimeOffset)
+        }
         sample.pts = uint64(int64(sample.dts) + cts)
+        sampleFlags := track.defaultSampleFlags
+        if i == 0 && trunFlags&TR_FLAG_DATA_FIRST_SAMPLE_FLAGS > 0 {
+            sampleFlags = trun.FirstSampleFlags
+        } else if trunFlags&TR_FLAG_DATA_SAMPLE_FLAGS > 0 {
+            sampleFlags = entry.sampleFlags
+        }
+        sample.isKeyFrame = sampleFlags&MOV_FRAG_SAMPLE_FLAG_IS_NON_SYNC == 0
         nextDts += uint64(delta)
         demuxer.currentTrack.samplelist = append(demuxer.currentTrack.samplelist, sample)
     }
+    demuxer.currentTrack.startDts = nextDts
     demuxer.dataOffset = uint32(dataOffset)
     return
 }
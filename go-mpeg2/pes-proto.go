@@ -25,7 +25,7 @@ const (
 func findPESIDByStreamType(cid TS_STREAM_TYPE) PES_STREMA_ID {
 
     switch cid {
-    case TS_STREAM_AAC, TS_STREAM_AUDIO_MPEG1, TS_STREAM_AUDIO_MPEG2:
+    case TS_STREAM_AAC, TS_STREAM_AAC_LATM, TS_STREAM_AUDIO_MPEG1, TS_STREAM_AUDIO_MPEG2:
         return PES_STREAM_AUDIO
     case TS_STREAM_H264, TS_STREAM_H265:
         return PES_STREAM_VIDEO
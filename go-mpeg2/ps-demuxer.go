@@ -10,6 +10,10 @@ type psstream struct {
     pts       uint64
     dts       uint64
     streamBuf []byte
+    probed    bool
+    reorder   videoReorder
+    au        []byte //开启重排序后,按PTS把nalu合成一帧
+    auPts     uint64
 }
 
 func newpsstream(sid uint8, cid PS_STREAM_TYPE) *psstream {
@@ -30,6 +34,10 @@ type PSDemuxer struct {
     //decodeResult 解码ps包时的产生的错误
     //这个回调主要用于debug，查看是否ps包存在问题
     OnPacket func(pkg Display, decodeResult error)
+    //H264/H265的PES只有PTS没有DTS时,根据slice header中的POC推算DTS
+    //开启后按帧(access unit)回调,而不是按nalu回调
+    ReorderH264 bool
+    ReorderH265 bool
 }
 
 func NewPSDemuxer() *PSDemuxer {
@@ -168,10 +176,21 @@ func (psdemuxer *PSDemuxer) Flush() {
         if len(stream.streamBuf) == 0 {
             continue
         }
+        if stream.reorder != nil {
+            psdemuxer.outputNalu(stream, stream.streamBuf, stream.pts)
+            continue
+        }
         if psdemuxer.OnFrame != nil {
             psdemuxer.OnFrame(stream.streamBuf, stream.cid, stream.pts/90, stream.dts/90)
         }
     }
+    for _, stream := range psdemuxer.streamMap {
+        if stream.reorder == nil {
+            continue
+        }
+        psdemuxer.writeAccessUnit(stream)
+        stream.reorder.Flush()
+    }
 }
 
 func (psdemuxer *PSDemuxer) guessCodecid(stream *psstream) {
@@ -244,6 +263,31 @@ func (psdemuxer *PSDemuxer) demuxAudio(stream *psstream, pes *PesPacket) error {
 }
 
 func (psdemuxer *PSDemuxer) demuxH26x(stream *psstream, pes *PesPacket) error {
+    if !stream.probed {
+        stream.probed = true
+        onFrame := func(frame []byte, pts uint64, dts uint64) {
+            if psdemuxer.OnFrame != nil {
+                psdemuxer.OnFrame(frame, stream.cid, pts/90, dts/90)
+            }
+        }
+        if psdemuxer.ReorderH264 && stream.cid == PS_STREAM_H264 && pes.PTS_DTS_flags != 0x03 {
+            reorder := codec.NewH264Reorder()
+            reorder.OnFrame = onFrame
+            stream.reorder = reorder
+        } else if psdemuxer.ReorderH265 && stream.cid == PS_STREAM_H265 && pes.PTS_DTS_flags != 0x03 {
+            reorder := codec.NewH265Reorder()
+            reorder.OnFrame = onFrame
+            stream.reorder = reorder
+        }
+    }
+    //PTS变了说明上一帧已经结束,缓存里剩下的是上一帧的最后一个nalu
+    //不能等到下一个start code,新PES可能只带了半个start code
+    if len(stream.streamBuf) > 0 && stream.pts != pes.Pts {
+        if start, _ := codec.FindStartCode(stream.streamBuf, 0); start >= 0 {
+            psdemuxer.demuxH26xNalu(stream, stream.streamBuf[start:])
+        }
+        stream.streamBuf = stream.streamBuf[:0]
+    }
     if len(stream.streamBuf) == 0 {
         stream.pts = pes.Pts
         stream.dts = pes.Dts
@@ -255,26 +299,56 @@ func (psdemuxer *PSDemuxer) demuxH26x(stream *psstream, pes *PesPacket) error {
         if end < 0 {
             break
         }
-        if stream.cid == PS_STREAM_H264 {
-            naluType := codec.H264NaluType(stream.streamBuf[start:])
-            if naluType != codec.H264_NAL_AUD {
-                if psdemuxer.OnFrame != nil {
-                    psdemuxer.OnFrame(stream.streamBuf[start:end], stream.cid, stream.pts/90, stream.dts/90)
-                }
-            }
-        } else if stream.cid == PS_STREAM_H265 {
-            naluType := codec.H265NaluType(stream.streamBuf[start:])
-            if naluType != codec.H265_NAL_AUD {
-                if psdemuxer.OnFrame != nil {
-                    psdemuxer.OnFrame(stream.streamBuf[start:end], stream.cid, stream.pts/90, stream.dts/90)
-                }
-            }
-        }
+        psdemuxer.demuxH26xNalu(stream, stream.streamBuf[start:end])
         start = end
         sc = sc2
     }
-    stream.streamBuf = stream.streamBuf[start:]
+    //PES在start code中间截断时还找不到start code,保留到下一个PES
+    if start > 0 {
+        stream.streamBuf = stream.streamBuf[start:]
+    }
     stream.pts = pes.Pts
     stream.dts = pes.Dts
     return nil
 }
+
+func (psdemuxer *PSDemuxer) demuxH26xNalu(stream *psstream, nalu []byte) {
+    if stream.cid == PS_STREAM_H264 {
+        naluType := codec.H264NaluType(nalu)
+        if naluType != codec.H264_NAL_AUD && stream.reorder != nil {
+            psdemuxer.outputNalu(stream, nalu, stream.pts)
+        } else if naluType != codec.H264_NAL_AUD {
+            if psdemuxer.OnFrame != nil {
+                psdemuxer.OnFrame(nalu, stream.cid, stream.pts/90, stream.dts/90)
+            }
+        }
+    } else if stream.cid == PS_STREAM_H265 {
+        naluType := codec.H265NaluType(nalu)
+        if naluType != codec.H265_NAL_AUD && stream.reorder != nil {
+            psdemuxer.outputNalu(stream, nalu, stream.pts)
+        } else if naluType != codec.H265_NAL_AUD {
+            if psdemuxer.OnFrame != nil {
+                psdemuxer.OnFrame(nalu, stream.cid, stream.pts/90, stream.dts/90)
+            }
+        }
+    }
+}
+
+func (psdemuxer *PSDemuxer) outputNalu(stream *psstream, nalu []byte, pts uint64) {
+    if stream.auPts != pts {
+        psdemuxer.writeAccessUnit(stream)
+    }
+    stream.au = append(stream.au, nalu...)
+    stream.auPts = pts
+}
+
+func (psdemuxer *PSDemuxer) writeAccessUnit(stream *psstream) {
+    if len(stream.au) == 0 {
+        return
+    }
+    // 缺少参数集的帧无法解析slice header,原样输出
+    if err := stream.reorder.WriteWithPts(stream.au, stream.auPts); err != nil && psdemuxer.OnFrame != nil {
+        psdemuxer.OnFrame(stream.au, stream.cid, stream.auPts/90, stream.auPts/90)
+    }
+    stream.au = stream.au[:0]
+}
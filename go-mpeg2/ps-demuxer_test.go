@@ -1,7 +1,10 @@
 package mpeg2
 
 import (
+	"reflect"
 	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
 )
 
 var ps1 []byte = []byte{0x00, 0x00, 0x01, 0xBA}
@@ -78,3 +81,73 @@ func TestPSDemuxer_Input(t *testing.T) {
 		})
 	}
 }
+
+//PSMuxer总是写PTS和DTS, 这里手动封装只有PTS的PES, 每个PES最多带chunk字节
+func muxPtsOnlyPS(frames [][]byte, pts []uint64, chunk int) []byte {
+	bsw := codec.NewBitStreamWriter(1024)
+	psm := &Program_stream_map{Current_next_indicator: 1}
+	psm.Stream_map = append(psm.Stream_map, NewElementary_stream_elem(uint8(PS_STREAM_H264), uint8(PES_STREAM_VIDEO)))
+	for i, frame := range frames {
+		pack := PSPackHeader{System_clock_reference_base: pts[i] * 90, Program_mux_rate: 6106}
+		pack.Encode(bsw)
+		if i == 0 {
+			psm.Encode(bsw)
+		}
+		for len(frame) > 0 {
+			n := chunk
+			if n > len(frame) {
+				n = len(frame)
+			}
+			pes := NewPesPacket()
+			pes.Stream_id = uint8(PES_STREAM_VIDEO)
+			pes.PTS_DTS_flags = 0x02
+			pes.PES_header_data_length = 5
+			pes.Pts = pts[i] * 90
+			pes.PES_packet_length = uint16(8 + n)
+			pes.Pes_payload = frame[:n]
+			pes.Encode(bsw)
+			frame = frame[n:]
+		}
+	}
+	return bsw.Bits()
+}
+
+func TestPSDemuxer_ReorderH264(t *testing.T) {
+	frames, pts, wantDts := reorderH264TestFrames()
+	tests := []struct {
+		name    string
+		chunk   int
+		reorder bool
+		wantDts []uint64
+	}{
+		{name: "without reorder", chunk: 1024, wantDts: pts},
+		{name: "reorder", chunk: 1024, reorder: true, wantDts: wantDts},
+		//start code和slice header被拆到多个PES中
+		{name: "split pes", chunk: 3, reorder: true, wantDts: wantDts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPts, gotDts []uint64
+			demuxer := NewPSDemuxer()
+			demuxer.ReorderH264 = tt.reorder
+			demuxer.OnFrame = func(frame []byte, cid PS_STREAM_TYPE, pts uint64, dts uint64) {
+				//不开启重排序时按nalu回调, 只统计slice
+				if codec.IsH264VCLNaluType(codec.H264NaluType(frame)) || tt.reorder {
+					gotPts = append(gotPts, pts)
+					gotDts = append(gotDts, dts)
+				}
+			}
+			if err := demuxer.Input(muxPtsOnlyPS(frames, pts, tt.chunk)); err != nil {
+				t.Fatal(err)
+			}
+			//最后一帧要等Flush才输出
+			if len(gotPts) >= len(pts) {
+				t.Fatalf("got %d frames before flush", len(gotPts))
+			}
+			demuxer.Flush()
+			if !reflect.DeepEqual(gotPts, pts) || !reflect.DeepEqual(gotDts, tt.wantDts) {
+				t.Errorf("pts = %v dts = %v, want %v %v", gotPts, gotDts, pts, tt.wantDts)
+			}
+		})
+	}
+}
@@ -0,0 +1,462 @@
+package mpeg2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ETSI TR 101 290 5.2.1 First priority 和 5.2.2 Second priority
+type TR101290Check int
+
+const (
+	TR101290_TS_SYNC_LOSS TR101290Check = iota + 1
+	TR101290_SYNC_BYTE_ERROR
+	TR101290_PAT_ERROR
+	TR101290_CONTINUITY_COUNT_ERROR
+	TR101290_PMT_ERROR
+	TR101290_PID_ERROR
+	TR101290_TRANSPORT_ERROR
+	TR101290_CRC_ERROR
+	TR101290_PCR_REPETITION_ERROR
+	TR101290_PCR_DISCONTINUITY_ERROR
+	TR101290_PCR_ACCURACY_ERROR
+	TR101290_PTS_ERROR
+)
+
+func (check TR101290Check) String() string {
+	switch check {
+	case TR101290_TS_SYNC_LOSS:
+		return "1.1 TS_sync_loss"
+	case TR101290_SYNC_BYTE_ERROR:
+		return "1.2 Sync_byte_error"
+	case TR101290_PAT_ERROR:
+		return "1.3 PAT_error"
+	case TR101290_CONTINUITY_COUNT_ERROR:
+		return "1.4 Continuity_count_error"
+	case TR101290_PMT_ERROR:
+		return "1.5 PMT_error"
+	case TR101290_PID_ERROR:
+		return "1.6 PID_error"
+	case TR101290_TRANSPORT_ERROR:
+		return "2.1 Transport_error"
+	case TR101290_CRC_ERROR:
+		return "2.2 CRC_error"
+	case TR101290_PCR_REPETITION_ERROR:
+		return "2.3a PCR_repetition_error"
+	case TR101290_PCR_DISCONTINUITY_ERROR:
+		return "2.3b PCR_discontinuity_indicator_error"
+	case TR101290_PCR_ACCURACY_ERROR:
+		return "2.4 PCR_accuracy_error"
+	case TR101290_PTS_ERROR:
+		return "2.5 PTS_error"
+	}
+	return fmt.Sprintf("unknown check %d", int(check))
+}
+
+func (check TR101290Check) Priority() int {
+	if check < TR101290_TRANSPORT_ERROR {
+		return 1
+	}
+	return 2
+}
+
+// 检查周期, 单位为27MHz
+const (
+	tr101290PatPeriod          = 500 * PCR_CLOCK_RATE / 1000
+	tr101290PmtPeriod          = 500 * PCR_CLOCK_RATE / 1000
+	tr101290PcrRepetition      = 40 * PCR_CLOCK_RATE / 1000
+	tr101290PcrDiscontinuity   = 100 * PCR_CLOCK_RATE / 1000
+	tr101290PcrAccuracy        = 500 * PCR_CLOCK_RATE * 2 / 1000000000 //±500ns的两倍, 避免小数
+	tr101290PtsRepetition      = 700 * PCR_CLOCK_RATE / 1000
+	tsAnalyzerDefaultPidPeriod = 5000
+	tsAnalyzerDefaultSnapshot  = 1000
+)
+
+type TSAnalyzerEvent struct {
+	Check   TR101290Check
+	PID     uint16
+	Time    uint64 //27MHz, 以第一个PCR为0
+	Packet  uint64 //从0开始的ts包序号
+	Message string
+}
+
+type TSPidSnapshot struct {
+	PID              uint16
+	Type             string //PAT, PMT, SDT, PES, NULL, 未知的pid为空
+	StreamType       TS_STREAM_TYPE
+	Program          uint16
+	Packets          uint64
+	Bitrate          uint64 //bits/s, 最近一个统计周期
+	ContinuityErrors uint64
+	TransportErrors  uint64
+	CRCErrors        uint64
+	PCRCount         uint64
+}
+
+type TSAnalyzerSnapshot struct {
+	Time    uint64 //27MHz
+	Packets uint64
+	Bitrate uint64 //bits/s, 最近一个统计周期, 包含空包
+	Errors  map[TR101290Check]uint64
+	Pids    []TSPidSnapshot //按pid排序
+}
+
+type analyzerPid struct {
+	typ           string
+	stream_type   TS_STREAM_TYPE
+	program       uint16
+	packets       uint64
+	window        uint64
+	cc_errors     uint64
+	tei_errors    uint64
+	crc_errors    uint64
+	pcr_count     uint64
+	referenced    bool
+	last_seen     uint64
+	has_pts       bool
+	last_pts      uint64
+	has_pcr       bool
+	last_pcr      uint64
+	last_pcr_pkt  uint64
+	pcr_delta     uint64 //上一个PCR间隔, 用于推算码率
+	pcr_delta_pkt uint64
+	pmt_time      uint64
+}
+
+// 基于TSDemuxer的TR 101 290分析器
+// 时间以第一个出现的PCR为参考时钟, 按照包的个数和PCR推算的码率插值, 没有PCR之前不做超时检查
+type TSAnalyzer struct {
+	OnEvent    func(event *TSAnalyzerEvent)
+	OnSnapshot func(snapshot *TSAnalyzerSnapshot)
+	//PID_error的超时时间, 默认5000ms
+	PidPeriod uint64
+	//OnSnapshot周期, 默认1000ms
+	SnapshotPeriod uint64
+
+	demuxer       *TSDemuxer
+	pids          map[uint16]*analyzerPid
+	errors        map[TR101290Check]uint64
+	packets       uint64
+	window        uint64
+	pat_time      uint64
+	clock_pid     uint16
+	clock_started bool
+	clock_time    uint64 //参考PCR对应的时间
+	clock_pkt     uint64
+	snapshot_time uint64
+}
+
+func NewTSAnalyzer() *TSAnalyzer {
+	analyzer := &TSAnalyzer{
+		PidPeriod:      tsAnalyzerDefaultPidPeriod,
+		SnapshotPeriod: tsAnalyzerDefaultSnapshot,
+		demuxer:        NewTSDemuxer(),
+		pids:           make(map[uint16]*analyzerPid),
+		errors:         make(map[TR101290Check]uint64),
+	}
+	analyzer.demuxer.OnContinuityError = analyzer.onContinuityError
+	analyzer.demuxer.OnPCR = analyzer.onPcr
+	analyzer.demuxer.OnTSPacket = analyzer.onTSPacket
+	analyzer.demuxer.onSection = analyzer.onSection
+	return analyzer
+}
+
+// 读取数据出错时返回错误, 结束时输出最后一个统计周期
+func (analyzer *TSAnalyzer) Input(r io.Reader) error {
+	reader := newTSPacketReader(r)
+	reader.onResync = func(skipped int) {
+		analyzer.report(TR101290_SYNC_BYTE_ERROR, 0, fmt.Sprintf("skip %d bytes", skipped))
+		//连续两个以上的包同步字节错误
+		if skipped >= 2*reader.size {
+			analyzer.report(TR101290_TS_SYNC_LOSS, 0, fmt.Sprintf("skip %d bytes", skipped))
+		}
+		analyzer.resetPcrRate()
+	}
+	for {
+		buf, err := reader.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		analyzer.inputPacket(buf)
+	}
+	if analyzer.OnSnapshot != nil && analyzer.window > 0 {
+		analyzer.OnSnapshot(analyzer.Snapshot())
+	}
+	return nil
+}
+
+// 当前时间, 27MHz
+func (analyzer *TSAnalyzer) now() uint64 {
+	if !analyzer.clock_started {
+		return 0
+	}
+	ref := analyzer.pids[analyzer.clock_pid]
+	if ref.pcr_delta_pkt == 0 {
+		return analyzer.clock_time
+	}
+	return analyzer.clock_time + (analyzer.packets-analyzer.clock_pkt)*ref.pcr_delta/ref.pcr_delta_pkt
+}
+
+func (analyzer *TSAnalyzer) getPid(pid uint16) *analyzerPid {
+	p, found := analyzer.pids[pid]
+	if !found {
+		p = &analyzerPid{}
+		analyzer.pids[pid] = p
+	}
+	return p
+}
+
+func (analyzer *TSAnalyzer) report(check TR101290Check, pid uint16, msg string) {
+	analyzer.errors[check]++
+	if analyzer.OnEvent != nil {
+		analyzer.OnEvent(&TSAnalyzerEvent{
+			Check:   check,
+			PID:     pid,
+			Time:    analyzer.now(),
+			Packet:  analyzer.packets - 1,
+			Message: msg,
+		})
+	}
+}
+
+func (analyzer *TSAnalyzer) inputPacket(buf []byte) {
+	analyzer.packets++
+	analyzer.window++
+	tei := buf[1] >> 7
+	pid := uint16(buf[1]&0x1F)<<8 | uint16(buf[2])
+	scrambling := buf[3] >> 6
+	p := analyzer.getPid(pid)
+	p.packets++
+	p.window++
+	p.last_seen = analyzer.now()
+	if pid == TS_PID_Nil {
+		p.typ = "NULL"
+	}
+	if tei == 1 {
+		p.tei_errors++
+		analyzer.report(TR101290_TRANSPORT_ERROR, pid, "transport_error_indicator is set")
+		analyzer.resetPcrRate()
+	} else if scrambling != 0 {
+		if pid == uint16(TS_PID_PAT) {
+			analyzer.report(TR101290_PAT_ERROR, pid, "scrambled PAT")
+		} else if p.typ == "PMT" {
+			analyzer.report(TR101290_PMT_ERROR, pid, "scrambled PMT")
+		}
+	}
+	analyzer.demuxer.decodePacket(buf)
+	if analyzer.clock_started {
+		analyzer.checkTimeout()
+		if analyzer.SnapshotPeriod > 0 && analyzer.OnSnapshot != nil &&
+			analyzer.now() >= analyzer.snapshot_time+analyzer.SnapshotPeriod*PCR_CLOCK_RATE/1000 {
+			analyzer.OnSnapshot(analyzer.Snapshot())
+		}
+	}
+}
+
+// PAT/PMT/PID/PTS的超时检查, 超时之后重新计时
+func (analyzer *TSAnalyzer) checkTimeout() {
+	now := analyzer.now()
+	if now > analyzer.pat_time+tr101290PatPeriod {
+		analyzer.pat_time = now
+		analyzer.report(TR101290_PAT_ERROR, uint16(TS_PID_PAT), "PAT interval exceeds 500ms")
+	}
+	pidPeriod := analyzer.PidPeriod * PCR_CLOCK_RATE / 1000
+	for pid, p := range analyzer.pids {
+		if p.typ == "PMT" && now > p.pmt_time+tr101290PmtPeriod {
+			p.pmt_time = now
+			analyzer.report(TR101290_PMT_ERROR, pid, "PMT interval exceeds 500ms")
+		}
+		if p.referenced && pidPeriod > 0 && now > p.last_seen+pidPeriod {
+			p.last_seen = now
+			analyzer.report(TR101290_PID_ERROR, pid, fmt.Sprintf("pid not present for %dms", analyzer.PidPeriod))
+		}
+		if p.has_pts && now > p.last_pts+tr101290PtsRepetition {
+			p.last_pts = now
+			analyzer.report(TR101290_PTS_ERROR, pid, "PTS interval exceeds 700ms")
+		}
+	}
+}
+
+func (analyzer *TSAnalyzer) onContinuityError(pid uint16, expected uint8, got uint8) {
+	analyzer.getPid(pid).cc_errors++
+	analyzer.report(TR101290_CONTINUITY_COUNT_ERROR, pid, fmt.Sprintf("expected %d, got %d", expected, got))
+	analyzer.resetPcrRate()
+}
+
+// 丢包之后包的个数不再对应码率, 重新开始PCR_accuracy检查
+func (analyzer *TSAnalyzer) resetPcrRate() {
+	for _, p := range analyzer.pids {
+		p.has_pcr = false
+	}
+}
+
+func (analyzer *TSAnalyzer) onSection(pid uint16, section []byte, crcOk bool) {
+	p := analyzer.getPid(pid)
+	if !crcOk {
+		p.crc_errors++
+		analyzer.report(TR101290_CRC_ERROR, pid, fmt.Sprintf("table_id %#x", section[0]))
+		return
+	}
+	if pid == uint16(TS_PID_PAT) {
+		if section[0] != uint8(TS_TID_PAS) {
+			analyzer.report(TR101290_PAT_ERROR, pid, fmt.Sprintf("table_id %#x on pid 0", section[0]))
+			return
+		}
+		analyzer.pat_time = analyzer.now()
+	} else if p.typ == "PMT" {
+		if section[0] != uint8(TS_TID_PMS) {
+			analyzer.report(TR101290_PMT_ERROR, pid, fmt.Sprintf("table_id %#x on PMT pid", section[0]))
+			return
+		}
+		p.pmt_time = analyzer.now()
+	}
+}
+
+func (analyzer *TSAnalyzer) onTSPacket(pkg *TSPacket) {
+	switch payload := pkg.Payload.(type) {
+	case *Pat:
+		analyzer.getPid(pkg.PID).typ = "PAT"
+		for _, p := range analyzer.pids {
+			if p.typ == "PMT" {
+				p.typ = ""
+			}
+		}
+		for _, pm := range payload.Pmts {
+			if pm.Program_number == 0x0000 {
+				continue
+			}
+			p := analyzer.getPid(pm.PID)
+			if p.program != pm.Program_number {
+				p.pmt_time = analyzer.now()
+			}
+			p.typ = "PMT"
+			p.program = pm.Program_number
+		}
+	case *Pmt:
+		streams := make(map[uint16]bool, len(payload.Streams))
+		for _, ps := range payload.Streams {
+			streams[ps.Elementary_PID] = true
+			p := analyzer.getPid(ps.Elementary_PID)
+			if !p.referenced {
+				p.referenced = true
+				p.last_seen = analyzer.now()
+			}
+			p.typ = "PES"
+			p.stream_type = TS_STREAM_TYPE(ps.StreamType)
+			p.program = payload.Program_number
+		}
+		//PMT中删除的流不再检查PID_error
+		for pid, p := range analyzer.pids {
+			if p.typ == "PES" && p.program == payload.Program_number && !streams[pid] {
+				p.referenced = false
+			}
+		}
+	case *Sdt:
+		analyzer.getPid(pkg.PID).typ = "SDT"
+	case *PesPacket:
+		if pkg.Payload_unit_start_indicator == 1 && payload.PTS_DTS_flags&0x02 != 0 {
+			p := analyzer.getPid(pkg.PID)
+			p.has_pts = true
+			p.last_pts = analyzer.now()
+		}
+	}
+}
+
+func (analyzer *TSAnalyzer) onPcr(pid uint16, pcr uint64, discontinuity bool) {
+	p := analyzer.getPid(pid)
+	p.pcr_count++
+	pkt := analyzer.packets - 1
+	if !analyzer.clock_started {
+		analyzer.clock_started = true
+		analyzer.clock_pid = pid
+		analyzer.clock_pkt = pkt
+	}
+	if p.has_pcr && !discontinuity {
+		if pcr < p.last_pcr || pcr-p.last_pcr > tr101290PcrDiscontinuity {
+			analyzer.report(TR101290_PCR_DISCONTINUITY_ERROR, pid, fmt.Sprintf("pcr jumps from %d to %d", p.last_pcr, pcr))
+			discontinuity = true
+		} else {
+			delta := pcr - p.last_pcr
+			if delta > tr101290PcrRepetition {
+				analyzer.report(TR101290_PCR_REPETITION_ERROR, pid, fmt.Sprintf("pcr interval %.2fms", float64(delta)*1000/PCR_CLOCK_RATE))
+			}
+			//按照上一个间隔的码率推算当前PCR
+			if p.pcr_delta_pkt > 0 {
+				expected := p.last_pcr + (pkt-p.last_pcr_pkt)*p.pcr_delta/p.pcr_delta_pkt
+				diff := int64(pcr - expected)
+				if diff < 0 {
+					diff = -diff
+				}
+				if uint64(diff)*2 > tr101290PcrAccuracy {
+					analyzer.report(TR101290_PCR_ACCURACY_ERROR, pid, fmt.Sprintf("pcr is off by %dns", uint64(diff)*1000/(PCR_CLOCK_RATE/1000000)))
+				}
+			}
+			if pid == analyzer.clock_pid {
+				analyzer.clock_time += delta
+				analyzer.clock_pkt = pkt
+			}
+			p.pcr_delta = delta
+			p.pcr_delta_pkt = pkt - p.last_pcr_pkt
+		}
+	}
+	if !p.has_pcr || discontinuity {
+		if pid == analyzer.clock_pid {
+			analyzer.clock_time = analyzer.now()
+			analyzer.clock_pkt = pkt
+		}
+		p.pcr_delta_pkt = 0
+	}
+	p.has_pcr = true
+	p.last_pcr = pcr
+	p.last_pcr_pkt = pkt
+}
+
+// 统计数据, 同时开始新的统计周期
+func (analyzer *TSAnalyzer) Snapshot() *TSAnalyzerSnapshot {
+	now := analyzer.now()
+	duration := now - analyzer.snapshot_time
+	bitrate := func(packets uint64) uint64 {
+		if duration == 0 {
+			return 0
+		}
+		return packets * TS_PAKCET_SIZE * 8 * PCR_CLOCK_RATE / duration
+	}
+	snapshot := &TSAnalyzerSnapshot{
+		Time:    now,
+		Packets: analyzer.packets,
+		Bitrate: bitrate(analyzer.window),
+		Errors:  make(map[TR101290Check]uint64, len(analyzer.errors)),
+	}
+	for check, count := range analyzer.errors {
+		snapshot.Errors[check] = count
+	}
+	for pid, p := range analyzer.pids {
+		if p.packets == 0 {
+			continue
+		}
+		snapshot.Pids = append(snapshot.Pids, TSPidSnapshot{
+			PID:              pid,
+			Type:             p.typ,
+			StreamType:       p.stream_type,
+			Program:          p.program,
+			Packets:          p.packets,
+			Bitrate:          bitrate(p.window),
+			ContinuityErrors: p.cc_errors,
+			TransportErrors:  p.tei_errors,
+			CRCErrors:        p.crc_errors,
+			PCRCount:         p.pcr_count,
+		})
+		p.window = 0
+	}
+	sort.Slice(snapshot.Pids, func(i, j int) bool {
+		return snapshot.Pids[i].PID < snapshot.Pids[j].PID
+	})
+	analyzer.window = 0
+	analyzer.snapshot_time = now
+	return snapshot
+}
@@ -0,0 +1,229 @@
+package mpeg2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// 1Mbps CBR, 两路AAC, 第一路携带PCR, 每40ms一帧
+// 两路AAC, 码率1Mbps
+func muxAnalyzerTestStream(t *testing.T, seconds int, options func(muxer *TSMuxer)) ([][]byte, uint16, uint16) {
+	muxer := NewTSMuxer()
+	muxer.SetMuxRate(1000000)
+	if options != nil {
+		options(muxer)
+	}
+	packets, pids := muxTSTestStream(t, muxer, tsTestStream{streams: 2, frames: seconds * 25, size: 300})
+	return packets, pids[0], pids[1]
+}
+
+func packetPid(pkg []byte) uint16 {
+	return uint16(pkg[1]&0x1F)<<8 | uint16(pkg[2])
+}
+
+func TestTSAnalyzer_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		options func(muxer *TSMuxer)
+		corrupt func(packets [][]byte, first, second uint16) [][]byte
+		want    map[TR101290Check]uint64
+	}{
+		{name: "clean", want: map[TR101290Check]uint64{}},
+		{
+			name: "continuity",
+			corrupt: func(packets [][]byte, first, second uint16) [][]byte {
+				for i, pkg := range packets {
+					if i > 100 && packetPid(pkg) == second {
+						return append(packets[:i:i], packets[i+1:]...)
+					}
+				}
+				return packets
+			},
+			want: map[TR101290Check]uint64{TR101290_CONTINUITY_COUNT_ERROR: 1},
+		},
+		{
+			name: "transport error",
+			corrupt: func(packets [][]byte, first, second uint16) [][]byte {
+				for i, pkg := range packets {
+					if i > 100 && packetPid(pkg) == second {
+						pkg[1] |= 0x80
+						break
+					}
+				}
+				return packets
+			},
+			//被丢弃的包导致continuity_counter不连续
+			want: map[TR101290Check]uint64{TR101290_TRANSPORT_ERROR: 1, TR101290_CONTINUITY_COUNT_ERROR: 1},
+		},
+		{
+			name: "crc",
+			corrupt: func(packets [][]byte, first, second uint16) [][]byte {
+				for i, pkg := range packets {
+					if i > 100 && packetPid(pkg) == uint16(TS_PID_PAT) {
+						pkg[10] ^= 0xff
+						break
+					}
+				}
+				return packets
+			},
+			//损坏的PAT不计入PAT的间隔
+			want: map[TR101290Check]uint64{TR101290_CRC_ERROR: 1, TR101290_PAT_ERROR: 1},
+		},
+		{
+			name: "sync loss",
+			corrupt: func(packets [][]byte, first, second uint16) [][]byte {
+				out := append([][]byte{}, packets[:100]...)
+				out = append(out, bytes.Repeat([]byte{0xaa}, 600))
+				return append(out, packets[100:]...)
+			},
+			want: map[TR101290Check]uint64{TR101290_SYNC_BYTE_ERROR: 1, TR101290_TS_SYNC_LOSS: 1},
+		},
+		{
+			name: "sync byte",
+			corrupt: func(packets [][]byte, first, second uint16) [][]byte {
+				out := append([][]byte{}, packets[:100]...)
+				out = append(out, []byte{0x00, 0x01, 0x02})
+				return append(out, packets[100:]...)
+			},
+			want: map[TR101290Check]uint64{TR101290_SYNC_BYTE_ERROR: 1},
+		},
+		{
+			name:    "pat and pmt",
+			options: func(muxer *TSMuxer) { muxer.SetTablePeriod(800) },
+			want:    map[TR101290Check]uint64{TR101290_PAT_ERROR: 3, TR101290_PMT_ERROR: 3},
+		},
+		{
+			name:    "pcr repetition",
+			options: func(muxer *TSMuxer) { muxer.SetPcrPeriod(60) },
+			want:    map[TR101290Check]uint64{TR101290_PCR_REPETITION_ERROR: 31},
+		},
+		{
+			name: "pcr accuracy",
+			corrupt: func(packets [][]byte, first, second uint16) [][]byte {
+				pcrs := 0
+				for _, pkg := range packets {
+					//adaptation_field中PCR_flag
+					if packetPid(pkg) == first && pkg[3]&0x20 != 0 && pkg[4] > 0 && pkg[5]&0x10 != 0 {
+						if pcrs++; pcrs == 10 {
+							pkg[10] ^= 0x01 //PCR base最低位, 相差300个27MHz时钟
+							break
+						}
+					}
+				}
+				return packets
+			},
+			//被修改的PCR, 以及按照错误的码率推算出的后两个PCR
+			want: map[TR101290Check]uint64{TR101290_PCR_ACCURACY_ERROR: 3},
+		},
+		{
+			name: "pcr discontinuity",
+			corrupt: func(packets [][]byte, first, second uint16) [][]byte {
+				pcrs := 0
+				for _, pkg := range packets {
+					if packetPid(pkg) == first && pkg[3]&0x20 != 0 && pkg[4] > 0 && pkg[5]&0x10 != 0 {
+						if pcrs++; pcrs == 10 {
+							pkg[7] ^= 0x80 //PCR base跳变超过100ms, 没有discontinuity_indicator
+							break
+						}
+					}
+				}
+				return packets
+			},
+			//跳变到错误的PCR, 以及从错误的PCR跳回来
+			want: map[TR101290Check]uint64{TR101290_PCR_DISCONTINUITY_ERROR: 2},
+		},
+		{
+			name: "pid and pts",
+			corrupt: func(packets [][]byte, first, second uint16) [][]byte {
+				//替换成空包, 保持码率不变
+				null := append([]byte{0x47, 0x1f, 0xff, 0x10}, bytes.Repeat([]byte{0xff}, 184)...)
+				for i, pkg := range packets {
+					if i >= 300 && packetPid(pkg) == second {
+						packets[i] = null
+					}
+				}
+				return packets
+			},
+			want: map[TR101290Check]uint64{TR101290_PID_ERROR: 1, TR101290_PTS_ERROR: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets, first, second := muxAnalyzerTestStream(t, 3, tt.options)
+			if tt.corrupt != nil {
+				packets = tt.corrupt(packets, first, second)
+			}
+			analyzer := NewTSAnalyzer()
+			analyzer.PidPeriod = 1000
+			var events []*TSAnalyzerEvent
+			analyzer.OnEvent = func(event *TSAnalyzerEvent) {
+				events = append(events, event)
+			}
+			var last *TSAnalyzerSnapshot
+			analyzer.OnSnapshot = func(snapshot *TSAnalyzerSnapshot) {
+				last = snapshot
+			}
+			if err := analyzer.Input(bytes.NewReader(bytes.Join(packets, nil))); err != nil {
+				t.Fatal(err)
+			}
+			if last == nil || !reflect.DeepEqual(last.Errors, tt.want) {
+				t.Errorf("errors = %v, want %v", last, tt.want)
+				for _, event := range events {
+					t.Logf("%+v", *event)
+				}
+			}
+			if uint64(len(events)) != func() (n uint64) {
+				for _, count := range tt.want {
+					n += count
+				}
+				return
+			}() {
+				t.Errorf("got %d events", len(events))
+			}
+		})
+	}
+}
+
+func TestTSAnalyzer_Snapshot(t *testing.T) {
+	packets, first, second := muxAnalyzerTestStream(t, 3, nil)
+	analyzer := NewTSAnalyzer()
+	var snapshots []*TSAnalyzerSnapshot
+	analyzer.OnSnapshot = func(snapshot *TSAnalyzerSnapshot) {
+		snapshots = append(snapshots, snapshot)
+	}
+	if err := analyzer.Input(bytes.NewReader(bytes.Join(packets, nil))); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) < 3 {
+		t.Fatalf("got %d snapshots", len(snapshots))
+	}
+	snapshot := snapshots[1]
+	if snapshot.Bitrate < 990000 || snapshot.Bitrate > 1010000 {
+		t.Errorf("bitrate = %d", snapshot.Bitrate)
+	}
+	if last := snapshots[len(snapshots)-1]; last.Packets != uint64(len(packets)) {
+		t.Errorf("packets = %d, want %d", last.Packets, len(packets))
+	}
+	types := make(map[uint16]string)
+	var sum uint64
+	for _, pid := range snapshot.Pids {
+		types[pid.PID] = pid.Type
+		sum += pid.Bitrate
+		if pid.PID == first || pid.PID == second {
+			if pid.StreamType != TS_STREAM_AAC || pid.Program != 1 || pid.Bitrate == 0 {
+				t.Errorf("pid %d = %+v", pid.PID, pid)
+			}
+		}
+		if (pid.PID == first) != (pid.PCRCount > 0) {
+			t.Errorf("pid %d pcr count %d", pid.PID, pid.PCRCount)
+		}
+	}
+	if sum < snapshot.Bitrate-2000 || sum > snapshot.Bitrate+2000 {
+		t.Errorf("pid bitrate sum %d, total %d", sum, snapshot.Bitrate)
+	}
+	want := map[uint16]string{0: "PAT", 0x200: "PMT", first: "PES", second: "PES", TS_PID_Nil: "NULL"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("pid types = %v, want %v", types, want)
+	}
+}
@@ -0,0 +1,225 @@
+package mpeg2
+
+import (
+	"errors"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+const (
+	PCR_CLOCK_RATE = 27000000
+
+	//T-STD transport buffer TBn, ISO/IEC 13818-1 2.4.2.3
+	TSTD_TB_SIZE       = 512
+	TSTD_AUDIO_RX_RATE = 2000000
+)
+
+// CBR模式下PES写完时PCR已经超过了它的DTS, 内容码率高于mux rate
+// 这一帧已经输出, 但是码流不再是合法的CBR
+var ErrMuxRateTooLow = errors.New("pcr runs ahead of dts, mux rate is lower than the content bitrate")
+
+type cbrState struct {
+	mux_rate     uint64 //bits/s, 0为VBR
+	max_delay    uint64 //ms, 第一个PCR比第一个DTS提前的时间
+	pcr_period   uint64 //ms
+	first_pcr    uint64 //27MHz
+	start_lag    uint64 //27MHz, 第一个DTS小于max_delay时PCR少提前的时间
+	started      bool
+	packet_count uint64
+	last_tables  uint64 //上一次发送PAT/PMT时的PCR
+	buckets      map[uint16]*LeakyBucket
+	null_cc      uint8
+	on_overflow  func(pid uint16, pcr uint64, fullness uint64)
+}
+
+// 开启CBR输出, muxRate为包含空包在内的总码率(bits/s)
+// PCR按照包的位置推算, DTS之前插入空包或者只带PCR的包
+func (mux *TSMuxer) SetMuxRate(muxRate uint64) {
+	mux.cbr.mux_rate = muxRate
+}
+
+// 默认40ms
+func (mux *TSMuxer) SetPcrPeriod(ms uint64) {
+	mux.cbr.pcr_period = ms
+}
+
+// CBR模式下PCR相对DTS的提前量, 默认700ms
+func (mux *TSMuxer) SetMaxDelay(ms uint64) {
+	mux.cbr.max_delay = ms
+}
+
+// 默认400ms
+func (mux *TSMuxer) SetTablePeriod(ms uint64) {
+	mux.table_period = ms
+}
+
+// 为pid开启T-STD漏桶检查, 只在CBR模式下有效
+// size为缓冲区字节数, leakRate为流出速率(bits/s), 例如TB: TSTD_TB_SIZE, 音频TSTD_AUDIO_RX_RATE
+func (mux *TSMuxer) SetTSTDBuffer(pid uint16, size uint64, leakRate uint64) {
+	if mux.cbr.buckets == nil {
+		mux.cbr.buckets = make(map[uint16]*LeakyBucket)
+	}
+	mux.cbr.buckets[pid] = NewLeakyBucket(size, leakRate)
+}
+
+// 缓冲区溢出时回调, pcr为溢出的包到达的时间(27MHz)
+func (mux *TSMuxer) OnTSTDOverflow(onOverflow func(pid uint16, pcr uint64, fullness uint64)) {
+	mux.cbr.on_overflow = onOverflow
+}
+
+func (mux *TSMuxer) isCBR() bool {
+	return mux.cbr.mux_rate > 0
+}
+
+// 下一个输出的ts包第一个字节到达的时间
+func (mux *TSMuxer) currentPcr() uint64 {
+	bits := mux.cbr.packet_count * TS_PAKCET_SIZE * 8
+	return mux.cbr.first_pcr + bits/mux.cbr.mux_rate*PCR_CLOCK_RATE + bits%mux.cbr.mux_rate*PCR_CLOCK_RATE/mux.cbr.mux_rate
+}
+
+func (mux *TSMuxer) output(pkg []byte) {
+	if mux.isCBR() && len(mux.cbr.buckets) > 0 {
+		pid := uint16(pkg[1]&0x1F)<<8 | uint16(pkg[2])
+		if bucket, found := mux.cbr.buckets[pid]; found {
+			pcr := mux.currentPcr()
+			if !bucket.Push(pcr, TS_PAKCET_SIZE) && mux.cbr.on_overflow != nil {
+				mux.cbr.on_overflow(pid, pcr, bucket.Fullness())
+			}
+		}
+	}
+	mux.cbr.packet_count++
+	if mux.OnPacket != nil {
+		mux.OnPacket(pkg)
+	}
+}
+
+// 在写入dts对应的PES之前补齐空包, dts单位为90KHz
+func (mux *TSMuxer) pace(dts uint64) {
+	delay := mux.cbr.max_delay * PCR_CLOCK_RATE / 1000
+	if !mux.cbr.started {
+		mux.cbr.started = true
+		if dts*300 > delay {
+			mux.cbr.first_pcr = dts*300 - delay
+		} else {
+			mux.cbr.start_lag = delay - dts*300
+		}
+	}
+	for mux.currentPcr()+delay < dts*300 {
+		if mux.writeDuePcr(0) {
+			continue
+		}
+		if mux.tablesDue(0) {
+			mux.writeTables()
+		} else {
+			mux.writeNullPacket()
+		}
+	}
+}
+
+// PES最后一个包到达的时间不能晚于dts(90KHz), 开始时少提前的时间作为余量
+func (mux *TSMuxer) checkOverrun(dts uint64) error {
+	if mux.currentPcr() > dts*300+mux.cbr.start_lag {
+		return ErrMuxRateTooLow
+	}
+	return nil
+}
+
+func (mux *TSMuxer) tablesDue(dts uint64) bool {
+	if mux.pat_period == 0 {
+		return true
+	}
+	if mux.isCBR() {
+		return mux.currentPcr() >= mux.cbr.last_tables+mux.table_period*PCR_CLOCK_RATE/1000
+	}
+	return mux.pat_period+mux.table_period < dts
+}
+
+// 再等一个包就会超过pcr_period时即到期
+func (mux *TSMuxer) pcrDue(pmt *table_pmt) bool {
+	packetTime := TS_PAKCET_SIZE * 8 * PCR_CLOCK_RATE / mux.cbr.mux_rate
+	return !pmt.pcr_written || mux.currentPcr()+packetTime > pmt.last_pcr+mux.cbr.pcr_period*PCR_CLOCK_RATE/1000
+}
+
+// 给PCR到期的节目插入只带PCR的包, exceptPid正在输出的PES, 由PES自己携带PCR
+func (mux *TSMuxer) writeDuePcr(exceptPid uint16) bool {
+	written := false
+	for _, pmt := range mux.pat.pmts {
+		if pmt.pcr_pid == 0 || pmt.pcr_pid == exceptPid || !mux.pcrDue(pmt) {
+			continue
+		}
+		mux.writePcrPacket(pmt)
+		written = true
+	}
+	return written
+}
+
+func (mux *TSMuxer) fillPcr(adaptation *Adaptation_field, pmt *table_pmt) {
+	pcr := mux.currentPcr()
+	adaptation.PCR_flag = 1
+	adaptation.Program_clock_reference_base = pcr / 300 % (1 << 33)
+	adaptation.Program_clock_reference_extension = uint16(pcr % 300)
+	pmt.last_pcr = pcr
+	pmt.pcr_written = true
+}
+
+// adaptation_field_control为'10', 没有payload, continuity_counter不增加
+func (mux *TSMuxer) writePcrPacket(pmt *table_pmt) {
+	var tshdr TSPacket
+	tshdr.PID = pmt.pcr_pid
+	tshdr.Adaptation_field_control = 0x02
+	for _, stream := range pmt.streams {
+		if stream.pid == pmt.pcr_pid {
+			tshdr.Continuity_counter = (stream.cc + 15) % 16
+		}
+	}
+	adaptation := new(Adaptation_field)
+	mux.fillPcr(adaptation, pmt)
+	adaptation.Stuffing_byte = TS_PAKCET_SIZE - 4 - 2 - 6
+	tshdr.Field = adaptation
+	bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
+	tshdr.EncodeHeader(bsw)
+	mux.output(bsw.Bits())
+}
+
+func (mux *TSMuxer) writeNullPacket() {
+	var tshdr TSPacket
+	tshdr.PID = TS_PID_Nil
+	tshdr.Adaptation_field_control = 0x01
+	tshdr.Continuity_counter = mux.cbr.null_cc
+	mux.cbr.null_cc = (mux.cbr.null_cc + 1) % 16
+	bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
+	tshdr.EncodeHeader(bsw)
+	bsw.FillRemainData(0xff)
+	mux.output(bsw.Bits())
+}
+
+// 漏桶: 数据按到达时间进入, 以固定速率流出, 超过容量即溢出
+type LeakyBucket struct {
+	size     uint64 //bytes
+	rate     uint64 //bits/s
+	fullness uint64 //bits * PCR_CLOCK_RATE, 避免除法误差
+	last     uint64 //27MHz
+}
+
+func NewLeakyBucket(size uint64, rate uint64) *LeakyBucket {
+	return &LeakyBucket{size: size, rate: rate}
+}
+
+// 在时间t(27MHz)放入n字节, 溢出时返回false
+func (bucket *LeakyBucket) Push(t uint64, n uint64) bool {
+	if t > bucket.last {
+		if bucket.rate == 0 || t-bucket.last >= (bucket.fullness+bucket.rate-1)/bucket.rate {
+			bucket.fullness = 0
+		} else {
+			bucket.fullness -= (t - bucket.last) * bucket.rate
+		}
+		bucket.last = t
+	}
+	bucket.fullness += n * 8 * PCR_CLOCK_RATE
+	return bucket.fullness <= bucket.size*8*PCR_CLOCK_RATE
+}
+
+// 当前缓冲的字节数
+func (bucket *LeakyBucket) Fullness() uint64 {
+	return (bucket.fullness + 8*PCR_CLOCK_RATE - 1) / (8 * PCR_CLOCK_RATE)
+}
@@ -0,0 +1,160 @@
+package mpeg2
+
+import (
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+func TestLeakyBucket_Push(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   uint64
+		rate   uint64
+		pushes []uint64 //到达时间, 每次188字节
+		want   []bool
+		full   uint64
+	}{
+		{name: "drain between packets", size: 512, rate: 1504000, pushes: []uint64{0, 27000, 54000}, want: []bool{true, true, true}, full: 188},
+		{name: "burst overflow", size: 512, rate: 1504000, pushes: []uint64{0, 0, 0}, want: []bool{true, true, false}, full: 564},
+		{name: "partial drain", size: 512, rate: 1504000, pushes: []uint64{0, 0, 13500}, want: []bool{true, true, true}, full: 470},
+		{name: "no leak", size: 400, rate: 0, pushes: []uint64{0, 27000000}, want: []bool{true, true}, full: 188},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := NewLeakyBucket(tt.size, tt.rate)
+			for i, ts := range tt.pushes {
+				if got := bucket.Push(ts, TS_PAKCET_SIZE); got != tt.want[i] {
+					t.Errorf("push %d = %v, want %v", i, got, tt.want[i])
+				}
+			}
+			if got := bucket.Fullness(); got != tt.full {
+				t.Errorf("Fullness() = %d, want %d", got, tt.full)
+			}
+		})
+	}
+}
+
+func TestTSMuxer_CBR(t *testing.T) {
+	const muxRate = 2000000
+	var packets [][]byte
+	muxer := NewTSMuxer()
+	muxer.SetMuxRate(muxRate)
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, append([]byte{}, pkg...))
+	}
+	pid := muxer.AddStream(TS_STREAM_AAC)
+	overflows := 0
+	muxer.SetTSTDBuffer(pid, TSTD_TB_SIZE, TSTD_AUDIO_RX_RATE)
+	muxer.OnTSTDOverflow(func(pid uint16, pcr uint64, fullness uint64) {
+		overflows++
+	})
+	var dtss []uint64
+	for i := 0; i < 50; i++ {
+		dts := uint64(1000 + i*40)
+		dtss = append(dtss, dts)
+		if err := muxer.Write(pid, make([]byte, 500), dts, dts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if overflows != 0 {
+		t.Errorf("got %d TB overflows", overflows)
+	}
+
+	firstPcr := uint64(1000-700) * 27000
+	packetPcr := func(i int) uint64 {
+		return firstPcr + uint64(i)*TS_PAKCET_SIZE*8*PCR_CLOCK_RATE/muxRate
+	}
+	var lastPcr, lastPat uint64
+	nulls, pes := 0, 0
+	for i, pkg := range packets {
+		var hdr TSPacket
+		if err := hdr.DecodeHeader(codec.NewBitStream(pkg)); err != nil {
+			t.Fatal(err)
+		}
+		switch hdr.PID {
+		case TS_PID_Nil:
+			nulls++
+		case uint16(TS_PID_PAT):
+			if lastPat > 0 && packetPcr(i)-lastPat > 400*27000+packetPcr(1)-packetPcr(0) {
+				t.Errorf("PAT interval %d at packet %d", packetPcr(i)-lastPat, i)
+			}
+			lastPat = packetPcr(i)
+		case pid:
+			if hdr.Payload_unit_start_indicator == 1 {
+				if packetPcr(i) > dtss[pes]*27000 {
+					t.Errorf("pes %d arrives at %d after dts %d", pes, packetPcr(i), dtss[pes]*27000)
+				}
+				pes++
+			}
+		}
+		if hdr.Field == nil || hdr.Field.PCR_flag == 0 {
+			continue
+		}
+		pcr := hdr.Field.Program_clock_reference_base*300 + uint64(hdr.Field.Program_clock_reference_extension)
+		if diff := int64(pcr) - int64(packetPcr(i)); diff < -1 || diff > 1 {
+			t.Fatalf("packet %d pcr = %d, want %d", i, pcr, packetPcr(i))
+		}
+		if lastPcr > 0 && pcr-lastPcr > 40*27000 {
+			t.Errorf("pcr interval %d at packet %d", pcr-lastPcr, i)
+		}
+		lastPcr = pcr
+	}
+	if pes != 50 || nulls == 0 {
+		t.Errorf("got %d pes, %d null packets", pes, nulls)
+	}
+	//最后一个PES的dts减去max_delay对应的包数
+	wantPackets := int((dtss[49]-1000)*27000*muxRate/(TS_PAKCET_SIZE*8*PCR_CLOCK_RATE)) + 3
+	if len(packets) < wantPackets || len(packets) > wantPackets+5 {
+		t.Errorf("got %d packets, want about %d", len(packets), wantPackets)
+	}
+}
+
+func TestTSMuxer_CBROverflow(t *testing.T) {
+	muxer := NewTSMuxer()
+	muxer.SetMuxRate(10000000)
+	pid := muxer.AddStream(TS_STREAM_AAC)
+	var overflow []uint64
+	muxer.SetTSTDBuffer(pid, TSTD_TB_SIZE, 1000000)
+	muxer.OnTSTDOverflow(func(opid uint16, pcr uint64, fullness uint64) {
+		if opid != pid || fullness <= TSTD_TB_SIZE {
+			t.Errorf("overflow pid %d fullness %d", opid, fullness)
+		}
+		overflow = append(overflow, pcr)
+	})
+	if err := muxer.Write(pid, make([]byte, 5000), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(overflow) == 0 {
+		t.Errorf("expect TB overflow")
+	}
+}
+
+func TestTSMuxer_CBROverrun(t *testing.T) {
+	tests := []struct {
+		name    string
+		muxRate uint64
+		wantErr bool
+	}{
+		{name: "enough", muxRate: 6000000},
+		//20KB 25fps约4Mbit/s
+		{name: "too low", muxRate: 1000000, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			muxer := NewTSMuxer()
+			muxer.SetMuxRate(tt.muxRate)
+			pid := muxer.AddStream(TS_STREAM_H264)
+			frame := append([]byte{0x00, 0x00, 0x00, 0x01, 0x41}, make([]byte, 20000)...)
+			var err error
+			for i := 0; i < 100 && err == nil; i++ {
+				err = muxer.Write(pid, frame, uint64(i*40), uint64(i*40))
+			}
+			if tt.wantErr && err != ErrMuxRateTooLow {
+				t.Errorf("Write() error = %v, want %v", err, ErrMuxRateTooLow)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Write() error = %v", err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package mpeg2
 
 import (
     "errors"
+    "fmt"
     "io"
 
     "github.com/yapingcat/gomedia/go-codec"
@@ -26,162 +27,386 @@ type tsstream struct {
     pes_sid PES_STREMA_ID
     pes_pkg *PesPacket
     pkg     *pakcet_t
+    reorder videoReorder
+    probed  bool
+    latm    *codec.LATMDecoder
+    //continuity_counter错误或者PES头损坏之后丢弃数据, 直到下一个payload_unit_start_indicator
+    waitStart bool
 }
 
 type tsprogram struct {
     pn      uint16
+    pcr_pid uint16
+    version int
     streams map[uint16]*tsstream
 }
 
+// 每个pid的统计
+type TSPidStats struct {
+    Packets          uint64
+    ContinuityErrors uint64
+    TransportErrors  uint64
+    CRCErrors        uint64
+    PCRCount         uint64
+    LastPCR          uint64 //27MHz
+}
+
+type tspid struct {
+    stats   TSPidStats
+    lastcc  uint8
+    hascc   bool
+    dupcc   bool
+    section *sectionBuffer
+}
+
 type TSDemuxer struct {
     programs   map[uint16]*tsprogram
+    pids       map[uint16]*tspid
     OnFrame    func(cid TS_STREAM_TYPE, frame []byte, pts uint64, dts uint64)
     OnTSPacket func(pkg *TSPacket)
+    //pcr为27MHz, discontinuity为adaptation_field中的discontinuity_indicator
+    OnPCR func(pid uint16, pcr uint64, discontinuity bool)
+    //continuity_counter不连续, expected为期望的值
+    OnContinuityError func(pid uint16, expected uint8, got uint8)
+    //不影响继续解析的错误, 例如CRC错误, 同步字节丢失, PES头损坏
+    OnError func(err error)
+    //解析出来的表: *Pat, *Pmt, *Sdt, *Nit, *Eit, *Tdt, *Tot, *SpliceInfoSection
+    OnTable func(pid uint16, table interface{})
+    //H264/H265的PES只有PTS没有DTS时,根据slice header中的POC推算DTS
+    ReorderH264 bool
+    ReorderH265 bool
+    packetSize  int
+    //TSAnalyzer检查table_id和CRC
+    onSection func(pid uint16, section []byte, crcOk bool)
+}
+
+//H264Reorder/H265Reorder
+type videoReorder interface {
+    WriteWithPts(frame []byte, pts uint64) error
+    Flush()
 }
 
 func NewTSDemuxer() *TSDemuxer {
     return &TSDemuxer{
         programs:   make(map[uint16]*tsprogram),
+        pids:       make(map[uint16]*tspid),
         OnFrame:    nil,
         OnTSPacket: nil,
     }
 }
 
+// 自动检测的包长度: 188, 192(M2TS)或者204
+func (demuxer *TSDemuxer) PacketSize() int {
+    return demuxer.packetSize
+}
+
+func (demuxer *TSDemuxer) PidStats() map[uint16]TSPidStats {
+    stats := make(map[uint16]TSPidStats, len(demuxer.pids))
+    for pid, p := range demuxer.pids {
+        stats[pid] = p.stats
+    }
+    return stats
+}
+
+// 只有读取数据出错时才返回错误, 损坏的包通过OnError通知之后跳过
 func (demuxer *TSDemuxer) Input(r io.Reader) error {
-    var err error = nil
-    var buf []byte
+    reader := newTSPacketReader(r)
+    reader.onResync = func(skipped int) {
+        demuxer.reportError(fmt.Errorf("%w, skip %d bytes", ErrTSSyncLost, skipped))
+    }
     for {
-        if len(buf) > TS_PAKCET_SIZE {
-            buf = buf[TS_PAKCET_SIZE:]
-        } else {
-            if err != nil {
-                if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
-                    break
-                }
-                return err
-            }
-            buf, err = demuxer.probe(r)
-            if err != nil && buf == nil {
-                if errors.Is(err, io.EOF) {
-                    break
-                }
-                return err
+        buf, err := reader.next()
+        if err != nil {
+            if errors.Is(err, io.EOF) {
+                break
             }
+            return err
         }
+        demuxer.packetSize = reader.size
+        demuxer.decodePacket(buf)
+    }
+    demuxer.flush()
+    return nil
+}
 
-        bs := codec.NewBitStream(buf[:TS_PAKCET_SIZE])
-        var pkg TSPacket
-        if err := pkg.DecodeHeader(bs); err != nil {
-            return err
+func (demuxer *TSDemuxer) reportError(err error) {
+    if demuxer.OnError != nil {
+        demuxer.OnError(err)
+    }
+}
+
+func (demuxer *TSDemuxer) getPid(pid uint16) *tspid {
+    p, found := demuxer.pids[pid]
+    if !found {
+        p = &tspid{}
+        demuxer.pids[pid] = p
+    }
+    return p
+}
+
+// 返回false表示重复包, 需要丢弃
+func (demuxer *TSDemuxer) checkContinuity(p *tspid, pkg *TSPacket) bool {
+    discontinuity := pkg.Field != nil && pkg.Field.Discontinuity_indicator == 1
+    hasPayload := pkg.Adaptation_field_control&0x01 != 0
+    if !p.hascc || discontinuity {
+        p.hascc = true
+        p.dupcc = false
+        p.lastcc = pkg.Continuity_counter
+        return true
+    }
+    if !hasPayload {
+        //没有payload时continuity_counter不增加
+        return true
+    }
+    if pkg.Continuity_counter == p.lastcc && !p.dupcc {
+        //允许重复发送一次
+        p.dupcc = true
+        return false
+    }
+    expected := (p.lastcc + 1) % 16
+    p.dupcc = false
+    p.lastcc = pkg.Continuity_counter
+    if pkg.Continuity_counter != expected {
+        p.stats.ContinuityErrors++
+        if p.section != nil {
+            p.section.reset()
         }
-        if pkg.PID == uint16(TS_PID_PAT) {
-            if pkg.Payload_unit_start_indicator == 1 {
-                bs.SkipBits(8)
+        for _, program := range demuxer.programs {
+            if stream, found := program.streams[pkg.PID]; found {
+                stream.waitStart = true
             }
-            pkg.Payload, err = ReadSection(TS_TID_PAS, bs)
-            if err != nil {
-                return err
+        }
+        if demuxer.OnContinuityError != nil {
+            demuxer.OnContinuityError(pkg.PID, expected, pkg.Continuity_counter)
+        }
+    }
+    return true
+}
+
+func (demuxer *TSDemuxer) decodePacket(buf []byte) {
+    defer func() {
+        //损坏的包可能导致bitstream越界
+        if e := recover(); e != nil {
+            demuxer.reportError(fmt.Errorf("decode ts packet failed: %v", e))
+        }
+    }()
+    bs := codec.NewBitStream(buf)
+    var pkg TSPacket
+    if err := pkg.DecodeHeader(bs); err != nil {
+        demuxer.reportError(err)
+        return
+    }
+    if pkg.PID == TS_PID_Nil {
+        return
+    }
+    p := demuxer.getPid(pkg.PID)
+    p.stats.Packets++
+    if pkg.Transport_error_indicator == 1 {
+        p.stats.TransportErrors++
+        return
+    }
+    if !demuxer.checkContinuity(p, &pkg) {
+        return
+    }
+    if pkg.Field != nil && pkg.Field.PCR_flag == 1 {
+        pcr := pkg.Field.Program_clock_reference_base*300 + uint64(pkg.Field.Program_clock_reference_extension)
+        p.stats.PCRCount++
+        p.stats.LastPCR = pcr
+        if demuxer.OnPCR != nil {
+            demuxer.OnPCR(pkg.PID, pcr, pkg.Field.Discontinuity_indicator == 1)
+        }
+    }
+    if pkg.Adaptation_field_control&0x01 == 0 || bs.RemainBytes() <= 0 {
+        if demuxer.OnTSPacket != nil {
+            demuxer.OnTSPacket(&pkg)
+        }
+        return
+    }
+
+    if demuxer.isSectionPid(pkg.PID) {
+        if p.section == nil {
+            p.section = new(sectionBuffer)
+        }
+        err := p.section.feed(bs.RemainData(), pkg.Payload_unit_start_indicator == 1, func(section []byte) {
+            crcOk := checkSectionCrc(section)
+            if demuxer.onSection != nil {
+                demuxer.onSection(pkg.PID, section, crcOk)
             }
-            pat := pkg.Payload.(*Pat)
-            for _, pmt := range pat.Pmts {
-                if pmt.Program_number != 0x0000 {
-                    if _, found := demuxer.programs[pmt.PID]; !found {
-                        demuxer.programs[pmt.PID] = &tsprogram{pn: 0, streams: make(map[uint16]*tsstream)}
-                    }
-                }
+            if !crcOk {
+                p.stats.CRCErrors++
+                demuxer.reportError(fmt.Errorf("pid %d: %w", pkg.PID, ErrTSSectionCRC))
+                return
             }
-        } else if pkg.PID == TS_PID_Nil {
-            continue
-        } else {
-            for p, s := range demuxer.programs {
-                if p == pkg.PID { // pmt table
-                    if pkg.Payload_unit_start_indicator == 1 {
-                        bs.SkipBits(8) //pointer filed
-                    }
-                    pkg.Payload, err = ReadSection(TS_TID_PMS, bs)
-                    if err != nil {
-                        return err
-                    }
-                    pmt := pkg.Payload.(*Pmt)
-                    s.pn = pmt.Program_number
-                    for _, ps := range pmt.Streams {
-                        if _, found := s.streams[ps.Elementary_PID]; !found {
-                            s.streams[ps.Elementary_PID] = &tsstream{
-                                cid:     TS_STREAM_TYPE(ps.StreamType),
-                                pes_sid: findPESIDByStreamType(TS_STREAM_TYPE(ps.StreamType)),
-                                pes_pkg: NewPesPacket(),
-                            }
-                        }
-                    }
-                } else {
-                    for sid, stream := range s.streams {
-                        if sid != pkg.PID {
-                            continue
-                        }
-                        if pkg.Payload_unit_start_indicator == 1 {
-                            err := stream.pes_pkg.Decode(bs)
-                            // ignore error if it was a short payload read, next ts packet should append missing data
-                            if err != nil && !(errors.Is(err, errNeedMore) && stream.pes_pkg.Pes_payload != nil) {
-                                return err
-                            }
-                            pkg.Payload = stream.pes_pkg
-                        } else {
-                            stream.pes_pkg.Pes_payload = bs.RemainData()
-                            pkg.Payload = bs.RemainData()
-                        }
-                        stype := findPESIDByStreamType(stream.cid)
-                        if stype == PES_STREAM_AUDIO {
-                            demuxer.doAudioPesPacket(stream, pkg.Payload_unit_start_indicator)
-                        } else if stype == PES_STREAM_VIDEO {
-                            demuxer.doVideoPesPacket(stream, pkg.Payload_unit_start_indicator)
-                        }
-                    }
+            if table := demuxer.decodeSection(pkg.PID, section); table != nil {
+                pkg.Payload = table
+                if demuxer.OnTable != nil {
+                    demuxer.OnTable(pkg.PID, table)
                 }
             }
+        })
+        if err != nil {
+            demuxer.reportError(fmt.Errorf("pid %d: %w", pkg.PID, err))
         }
-        if demuxer.OnTSPacket != nil {
-            demuxer.OnTSPacket(&pkg)
+    } else {
+        for _, s := range demuxer.programs {
+            stream, found := s.streams[pkg.PID]
+            if !found {
+                continue
+            }
+            demuxer.decodePes(stream, &pkg, bs)
         }
     }
-    demuxer.flush()
-    return nil
+    if demuxer.OnTSPacket != nil {
+        demuxer.OnTSPacket(&pkg)
+    }
 }
 
-func (demuxer *TSDemuxer) probe(r io.Reader) ([]byte, error) {
-    buf := make([]byte, TS_PAKCET_SIZE, 2*TS_PAKCET_SIZE)
-    if _, err := io.ReadFull(r, buf); err != nil {
-        return nil, err
+func (demuxer *TSDemuxer) decodePes(stream *tsstream, pkg *TSPacket, bs *codec.BitStream) {
+    if pkg.Payload_unit_start_indicator == 1 {
+        if data := bs.RemainData(); len(data) < 3 || data[0] != 0x00 || data[1] != 0x00 || data[2] != 0x01 {
+            stream.waitStart = true
+            demuxer.reportError(fmt.Errorf("pid %d: pes start code not found", pkg.PID))
+            return
+        }
+        err := stream.pes_pkg.Decode(bs)
+        // ignore error if it was a short payload read, next ts packet should append missing data
+        if err != nil && !(errors.Is(err, errNeedMore) && stream.pes_pkg.Pes_payload != nil) {
+            stream.waitStart = true
+            demuxer.reportError(fmt.Errorf("pid %d: %w", pkg.PID, err))
+            return
+        }
+        if stream.waitStart {
+            stream.waitStart = false
+            if stream.pkg != nil {
+                stream.pkg.payload = stream.pkg.payload[:0]
+                stream.pkg.pts = stream.pes_pkg.Pts
+                stream.pkg.dts = stream.pes_pkg.Dts
+            }
+        }
+        pkg.Payload = stream.pes_pkg
+    } else {
+        if stream.waitStart {
+            return
+        }
+        stream.pes_pkg.Pes_payload = bs.RemainData()
+        pkg.Payload = bs.RemainData()
     }
-    if buf[0] == 0x47 {
-        return buf, nil
+    stype := findPESIDByStreamType(stream.cid)
+    if stype == PES_STREAM_AUDIO {
+        demuxer.doAudioPesPacket(stream, pkg.Payload_unit_start_indicator)
+    } else if stype == PES_STREAM_VIDEO {
+        demuxer.doVideoPesPacket(stream, pkg.Payload_unit_start_indicator)
+    }
+}
+
+// PSI/SI和SCTE 35的pid按照section解析
+func (demuxer *TSDemuxer) isSectionPid(pid uint16) bool {
+    switch pid {
+    case uint16(TS_PID_PAT), TS_PID_NIT, TS_PID_SDT, TS_PID_EIT, TS_PID_TDT:
+        return true
     }
-    buf = buf[:2*TS_PAKCET_SIZE]
-    if _, err := io.ReadFull(r, buf[TS_PAKCET_SIZE:]); err != nil {
-        return nil, err
+    if _, isPmt := demuxer.programs[pid]; isPmt {
+        return true
     }
-LOOP:
-    i := 0
-    for ; i < TS_PAKCET_SIZE; i++ {
-        if buf[i] == 0x47 && buf[i+TS_PAKCET_SIZE] == 0x47 {
-            break
+    for _, program := range demuxer.programs {
+        if stream, found := program.streams[pid]; found && stream.cid == TS_STREAM_SCTE35 {
+            return true
         }
     }
-    if i == 0 {
-        return buf, nil
-    } else if i < TS_PAKCET_SIZE {
-        copy(buf, buf[i:])
-        if _, err := io.ReadFull(r, buf[2*TS_PAKCET_SIZE-i:]); err != nil {
-            return buf[:TS_PAKCET_SIZE], err
-        } else {
-            return buf, nil
+    return false
+}
+
+type sectionDecoder interface {
+    Decode(bs *codec.BitStream) error
+}
+
+func (demuxer *TSDemuxer) decodeTable(table sectionDecoder, bs *codec.BitStream) interface{} {
+    if err := table.Decode(bs); err != nil {
+        demuxer.reportError(err)
+        return nil
+    }
+    return table
+}
+
+// 返回解析出来的表, 不认识的table_id返回nil
+func (demuxer *TSDemuxer) decodeSection(pid uint16, section []byte) interface{} {
+    bs := codec.NewBitStream(section)
+    switch {
+    case pid == uint16(TS_PID_PAT) && section[0] == uint8(TS_TID_PAS):
+        pat := NewPat()
+        if err := pat.Decode(bs); err != nil {
+            demuxer.reportError(err)
+            return nil
         }
-    } else {
-        copy(buf, buf[TS_PAKCET_SIZE:])
-        if _, err := io.ReadFull(r, buf[TS_PAKCET_SIZE:]); err != nil {
-            return buf[:TS_PAKCET_SIZE], err
+        if pat.Current_next_indicator == 0 {
+            return pat
+        }
+        pmtPids := make(map[uint16]bool)
+        for _, pmt := range pat.Pmts {
+            if pmt.Program_number != 0x0000 {
+                pmtPids[pmt.PID] = true
+                if _, found := demuxer.programs[pmt.PID]; !found {
+                    demuxer.programs[pmt.PID] = &tsprogram{pn: 0, version: -1, streams: make(map[uint16]*tsstream)}
+                }
+            }
+        }
+        //PAT更新之后删除的节目
+        for pid := range demuxer.programs {
+            if !pmtPids[pid] {
+                delete(demuxer.programs, pid)
+            }
+        }
+        return pat
+    case pid == TS_PID_SDT && (section[0] == uint8(TS_TID_SDT) || section[0] == uint8(TS_TID_SDT_OTHER)):
+        return demuxer.decodeTable(NewSdt(), bs)
+    case pid == TS_PID_NIT && (section[0] == uint8(TS_TID_NIT) || section[0] == uint8(TS_TID_NIT_OTHER)):
+        return demuxer.decodeTable(NewNit(), bs)
+    case pid == TS_PID_EIT && isEitTableId(section[0]):
+        return demuxer.decodeTable(NewEit(), bs)
+    case pid == TS_PID_TDT && section[0] == uint8(TS_TID_TDT):
+        return demuxer.decodeTable(NewTdt(), bs)
+    case pid == TS_PID_TDT && section[0] == uint8(TS_TID_TOT):
+        return demuxer.decodeTable(NewTot(), bs)
+    case section[0] == uint8(TS_TID_SCTE35):
+        return demuxer.decodeTable(NewSpliceInfoSection(), bs)
+    case section[0] == uint8(TS_TID_PMS):
+        program, found := demuxer.programs[pid]
+        if !found {
+            return nil
         }
-        goto LOOP
+        pmt := NewPmt()
+        if err := pmt.Decode(bs); err != nil {
+            demuxer.reportError(err)
+            return nil
+        }
+        if pmt.Current_next_indicator == 0 {
+            return pmt
+        }
+        program.pn = pmt.Program_number
+        program.pcr_pid = pmt.PCR_PID
+        if program.version == int(pmt.Version_number) {
+            return pmt
+        }
+        program.version = int(pmt.Version_number)
+        streamPids := make(map[uint16]bool)
+        for _, ps := range pmt.Streams {
+            streamPids[ps.Elementary_PID] = true
+            if s, found := program.streams[ps.Elementary_PID]; !found || s.cid != TS_STREAM_TYPE(ps.StreamType) {
+                program.streams[ps.Elementary_PID] = &tsstream{
+                    cid:     TS_STREAM_TYPE(ps.StreamType),
+                    pes_sid: findPESIDByStreamType(TS_STREAM_TYPE(ps.StreamType)),
+                    pes_pkg: NewPesPacket(),
+                }
+            }
+        }
+        for pid := range program.streams {
+            if !streamPids[pid] {
+                delete(program.streams, pid)
+            }
+        }
+        return pmt
     }
+    return nil
 }
 
 func (demuxer *TSDemuxer) flush() {
@@ -208,12 +433,17 @@ func (demuxer *TSDemuxer) flush() {
                     }
                     return false
                 })
-                demuxer.OnFrame(stream.cid, stream.pkg.payload[audLen:], stream.pkg.pts/90, stream.pkg.dts/90)
+                demuxer.outputVideoFrame(stream, stream.pkg.payload[audLen:], stream.pkg.pts, stream.pkg.dts)
             } else {
-                demuxer.OnFrame(stream.cid, stream.pkg.payload, stream.pkg.pts/90, stream.pkg.dts/90)
+                demuxer.outputAudioFrame(stream, stream.pkg.payload, stream.pkg.pts, stream.pkg.dts)
             }
             stream.pkg = nil
         }
+        for _, stream := range pm.streams {
+            if stream.reorder != nil {
+                stream.reorder.Flush()
+            }
+        }
     }
 }
 
@@ -221,6 +451,23 @@ func (demuxer *TSDemuxer) doVideoPesPacket(stream *tsstream, start uint8) {
     if stream.cid != TS_STREAM_H264 && stream.cid != TS_STREAM_H265 {
         return
     }
+    if start == 1 && !stream.probed {
+        stream.probed = true
+        onFrame := func(frame []byte, pts uint64, dts uint64) {
+            if demuxer.OnFrame != nil {
+                demuxer.OnFrame(stream.cid, frame, pts/90, dts/90)
+            }
+        }
+        if demuxer.ReorderH264 && stream.cid == TS_STREAM_H264 && stream.pes_pkg.PTS_DTS_flags != 0x03 {
+            reorder := codec.NewH264Reorder()
+            reorder.OnFrame = onFrame
+            stream.reorder = reorder
+        } else if demuxer.ReorderH265 && stream.cid == TS_STREAM_H265 && stream.pes_pkg.PTS_DTS_flags != 0x03 {
+            reorder := codec.NewH265Reorder()
+            reorder.OnFrame = onFrame
+            stream.reorder = reorder
+        }
+    }
     if stream.pkg == nil {
         stream.pkg = newPacket_t(1024)
         stream.pkg.pts = stream.pes_pkg.Pts
@@ -240,7 +487,7 @@ func (demuxer *TSDemuxer) doVideoPesPacket(stream *tsstream, start uint8) {
 }
 
 func (demuxer *TSDemuxer) doAudioPesPacket(stream *tsstream, start uint8) {
-    if stream.cid != TS_STREAM_AAC && stream.cid != TS_STREAM_AUDIO_MPEG1 && stream.cid != TS_STREAM_AUDIO_MPEG2 {
+    if stream.cid != TS_STREAM_AAC && stream.cid != TS_STREAM_AAC_LATM && stream.cid != TS_STREAM_AUDIO_MPEG1 && stream.cid != TS_STREAM_AUDIO_MPEG2 {
         return
     }
 
@@ -252,7 +499,7 @@ func (demuxer *TSDemuxer) doAudioPesPacket(stream *tsstream, start uint8) {
 
     if len(stream.pkg.payload) > 0 && (start == 1 || stream.pes_pkg.Pts != stream.pkg.pts) {
         if demuxer.OnFrame != nil {
-            demuxer.OnFrame(stream.cid, stream.pkg.payload, stream.pkg.pts/90, stream.pkg.dts/90)
+            demuxer.outputAudioFrame(stream, stream.pkg.payload, stream.pkg.pts, stream.pkg.dts)
         }
         stream.pkg.payload = stream.pkg.payload[:0]
     }
@@ -261,6 +508,35 @@ func (demuxer *TSDemuxer) doAudioPesPacket(stream *tsstream, start uint8) {
     stream.pkg.dts = stream.pes_pkg.Dts
 }
 
+//LOAS(0x11)转换成ADTS输出,cid为TS_STREAM_AAC
+func (demuxer *TSDemuxer) outputAudioFrame(stream *tsstream, frame []byte, pts uint64, dts uint64) {
+    if stream.cid != TS_STREAM_AAC_LATM {
+        demuxer.OnFrame(stream.cid, frame, pts/90, dts/90)
+        return
+    }
+    if stream.latm == nil {
+        stream.latm = codec.NewLATMDecoder(nil)
+    }
+    var adts []byte
+    codec.SplitLOASFrame(frame, func(loas []byte) {
+        aacs, err := stream.latm.DecodeLOAS(loas)
+        if err != nil {
+            return
+        }
+        for _, aac := range aacs {
+            hdr, err := codec.ConvertASCToADTS(stream.latm.AudioSpecificConfig(), len(aac)+7)
+            if err != nil {
+                return
+            }
+            adts = append(adts, hdr.Encode()...)
+            adts = append(adts, aac...)
+        }
+    })
+    if len(adts) > 0 {
+        demuxer.OnFrame(TS_STREAM_AAC, adts, pts/90, dts/90)
+    }
+}
+
 func (demuxer *TSDemuxer) splitH264Frame(stream *tsstream) bool {
     data := stream.pkg.payload
     start, sct := codec.FindStartCode(data, 0)
@@ -307,7 +583,7 @@ func (demuxer *TSDemuxer) splitH264Frame(stream *tsstream) bool {
                     }
                     return false
                 })
-                demuxer.OnFrame(stream.cid, data[frameBeg+audLen:start], stream.pkg.pts/90, stream.pkg.dts/90)
+                demuxer.outputVideoFrame(stream, data[frameBeg+audLen:start], stream.pkg.pts, stream.pkg.dts)
             }
             frameBeg = start
             needUpdate = true
@@ -330,6 +606,17 @@ func (demuxer *TSDemuxer) splitH264Frame(stream *tsstream) bool {
     return needUpdate
 }
 
+func (demuxer *TSDemuxer) outputVideoFrame(stream *tsstream, frame []byte, pts uint64, dts uint64) {
+    if stream.reorder == nil {
+        demuxer.OnFrame(stream.cid, frame, pts/90, dts/90)
+        return
+    }
+    // 缺少参数集的帧无法解析slice header,原样输出
+    if err := stream.reorder.WriteWithPts(frame, pts); err != nil {
+        demuxer.OnFrame(stream.cid, frame, pts/90, dts/90)
+    }
+}
+
 func (demuxer *TSDemuxer) splitH265Frame(stream *tsstream) bool {
     data := stream.pkg.payload
     start, sct := codec.FindStartCode(data, 0)
@@ -384,7 +671,7 @@ func (demuxer *TSDemuxer) splitH265Frame(stream *tsstream) bool {
                     }
                     return false
                 })
-                demuxer.OnFrame(stream.cid, data[frameBeg+audLen:start], stream.pkg.pts/90, stream.pkg.dts/90)
+                demuxer.outputVideoFrame(stream, data[frameBeg+audLen:start], stream.pkg.pts, stream.pkg.dts)
             }
             frameBeg = start
             needUpdate = true
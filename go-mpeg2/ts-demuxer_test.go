@@ -0,0 +1,353 @@
+package mpeg2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+func TestTSDemuxer_LATM(t *testing.T) {
+	enc, err := codec.NewLATMEncoder([]byte{0x12, 0x10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := [][]byte{bytes.Repeat([]byte{0x11}, 400), {0x01, 0x02, 0x03}}
+
+	ts := new(bytes.Buffer)
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		ts.Write(pkg)
+	}
+	pid := muxer.AddStream(TS_STREAM_AAC_LATM)
+	for i, frame := range frames {
+		loas, err := enc.EncodeLOAS(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := muxer.Write(pid, loas, uint64(i*23), uint64(i*23)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got [][]byte
+	demuxer := NewTSDemuxer()
+	demuxer.OnFrame = func(cid TS_STREAM_TYPE, frame []byte, pts uint64, dts uint64) {
+		if cid != TS_STREAM_AAC {
+			t.Errorf("cid = %d, want %d", cid, TS_STREAM_AAC)
+		}
+		codec.SplitAACFrame(frame, func(aac []byte) {
+			got = append(got, append([]byte{}, aac[7:]...))
+		})
+	}
+	if err := demuxer.Input(ts); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(frames) {
+		t.Fatalf("got %d frames, want %d", len(got), len(frames))
+	}
+	for i := range frames {
+		if !bytes.Equal(got[i], frames[i]) {
+			t.Errorf("frame %d mismatch", i)
+		}
+	}
+}
+
+// 每帧一个PES, 每个PES占用多个ts包
+// 单路AAC, 每帧400字节
+func muxDemuxerTestStream(t *testing.T, muxer *TSMuxer, frames int) ([][]byte, uint16) {
+	packets, pids := muxTSTestStream(t, muxer, tsTestStream{streams: 1, frames: frames, size: 400})
+	return packets, pids[0]
+}
+
+func demuxTestStream(t *testing.T, demuxer *TSDemuxer, data []byte) []byte {
+	var got []byte
+	demuxer.OnFrame = func(cid TS_STREAM_TYPE, frame []byte, pts uint64, dts uint64) {
+		if len(frame) != 400 || frame[0] != frame[399] || pts != uint64(frame[0]-1)*40 {
+			t.Errorf("frame %d: len %d pts %d", frame[0], len(frame), pts)
+		}
+		got = append(got, frame[0])
+	}
+	if err := demuxer.Input(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestTSDemuxer_PacketSize(t *testing.T) {
+	packets, _ := muxDemuxerTestStream(t, NewTSMuxer(), 10)
+	tests := []struct {
+		name   string
+		size   int
+		header int
+	}{
+		{"ts", TS_PAKCET_SIZE, 0},
+		{"m2ts", TS_M2TS_PACKET_SIZE, 4},
+		{"dvb", TS_DVB_PACKET_SIZE, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data []byte
+			for i, pkg := range packets {
+				packet := make([]byte, tt.size)
+				packet[0] = byte(i)
+				copy(packet[tt.header:], pkg)
+				data = append(data, packet...)
+			}
+			demuxer := NewTSDemuxer()
+			demuxer.OnError = func(err error) {
+				t.Errorf("unexpected error %v", err)
+			}
+			got := demuxTestStream(t, demuxer, data)
+			if len(got) != 10 {
+				t.Errorf("got %d frames, want 10", len(got))
+			}
+			if demuxer.PacketSize() != tt.size {
+				t.Errorf("packet size = %d, want %d", demuxer.PacketSize(), tt.size)
+			}
+		})
+	}
+}
+
+func TestTSDemuxer_Resync(t *testing.T) {
+	packets, pid := muxDemuxerTestStream(t, NewTSMuxer(), 10)
+	var data []byte
+	for i, pkg := range packets {
+		switch i {
+		case 5:
+			//包之间插入垃圾数据
+			data = append(data, 0x47, 0x00, 0x01, 0x47, 0x10)
+			data = append(data, bytes.Repeat([]byte{0xaa}, 300)...)
+		case 15:
+			//包被截断, 丢失的数据所在的帧无法恢复
+			data = append(data, pkg[:100]...)
+			continue
+		}
+		data = append(data, pkg...)
+	}
+	var errs []error
+	var ccErrors int
+	demuxer := NewTSDemuxer()
+	demuxer.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+	demuxer.OnContinuityError = func(p uint16, expected, got uint8) {
+		if p != pid {
+			t.Errorf("continuity error on pid %d", p)
+		}
+		ccErrors++
+	}
+	got := demuxTestStream(t, demuxer, data)
+	if len(got) != 9 {
+		t.Errorf("got frames %v, want 9 frames", got)
+	}
+	if len(errs) != 2 || !errors.Is(errs[0], ErrTSSyncLost) || !errors.Is(errs[1], ErrTSSyncLost) {
+		t.Errorf("errors = %v", errs)
+	}
+	if ccErrors != 1 || demuxer.PidStats()[pid].ContinuityErrors != 1 {
+		t.Errorf("continuity errors = %d", ccErrors)
+	}
+}
+
+func TestTSDemuxer_Continuity(t *testing.T) {
+	packets, pid := muxDemuxerTestStream(t, NewTSMuxer(), 4)
+	var data []byte
+	for i, pkg := range packets {
+		if i == 4 {
+			continue
+		}
+		data = append(data, pkg...)
+		if i == 7 {
+			//重复包只解析一次
+			data = append(data, pkg...)
+		}
+	}
+	type ccError struct{ expected, got uint8 }
+	var ccErrors []ccError
+	demuxer := NewTSDemuxer()
+	demuxer.OnContinuityError = func(p uint16, expected, got uint8) {
+		ccErrors = append(ccErrors, ccError{expected, got})
+	}
+	got := demuxTestStream(t, demuxer, data)
+	var hdr TSPacket
+	hdr.DecodeHeader(codec.NewBitStream(packets[4]))
+	if len(ccErrors) != 1 || ccErrors[0].expected != hdr.Continuity_counter || ccErrors[0].got != (hdr.Continuity_counter+1)%16 {
+		t.Errorf("continuity errors = %v, lost cc %d", ccErrors, hdr.Continuity_counter)
+	}
+	if len(got) != 3 {
+		t.Errorf("got frames %v, want 3", got)
+	}
+	stats := demuxer.PidStats()[pid]
+	if stats.Packets != uint64(len(packets)-2) || stats.ContinuityErrors != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestTSDemuxer_PCR(t *testing.T) {
+	muxer := NewTSMuxer()
+	muxer.SetMuxRate(1000000)
+	packets, pid := muxDemuxerTestStream(t, muxer, 20)
+	var pcrs []uint64
+	demuxer := NewTSDemuxer()
+	demuxer.OnPCR = func(p uint16, pcr uint64, discontinuity bool) {
+		if p != pid || discontinuity {
+			t.Errorf("pcr on pid %d, discontinuity %v", p, discontinuity)
+		}
+		pcrs = append(pcrs, pcr)
+	}
+	demuxTestStream(t, demuxer, bytes.Join(packets, nil))
+	if len(pcrs) < 10 {
+		t.Fatalf("got %d pcr", len(pcrs))
+	}
+	for i := 1; i < len(pcrs); i++ {
+		if pcrs[i] <= pcrs[i-1] || pcrs[i]-pcrs[i-1] > 40*PCR_CLOCK_RATE/1000 {
+			t.Errorf("pcr %d: %d after %d", i, pcrs[i], pcrs[i-1])
+		}
+	}
+	if stats := demuxer.PidStats()[pid]; stats.PCRCount != uint64(len(pcrs)) || stats.LastPCR != pcrs[len(pcrs)-1] {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestTSDemuxer_Section(t *testing.T) {
+	var packets [][]byte
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, append([]byte{}, pkg...))
+	}
+	if err := muxer.AddProgram(1, WithProgramDescriptors(NewRegistrationDescriptor("GA94", bytes.Repeat([]byte{0xaa}, 200)...)), WithService(TS_SERVICE_DIGITAL_RADIO, "p", "s")); err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := muxer.AddProgramStream(1, TS_STREAM_AAC)
+	for i := 0; i < 15; i++ {
+		if err := muxer.Write(pid, bytes.Repeat([]byte{byte(i + 1)}, 400), uint64(i*40), uint64(i*40)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//第二个PAT的CRC损坏
+	patCount := 0
+	for _, pkg := range packets {
+		if pkg[1]&0x1F == 0 && pkg[2] == 0 {
+			if patCount++; patCount == 2 {
+				pkg[12] ^= 0xff
+			}
+		}
+	}
+	if patCount < 2 {
+		t.Fatalf("got %d pat", patCount)
+	}
+
+	var tables []interface{}
+	demuxer := NewTSDemuxer()
+	demuxer.OnTSPacket = func(pkg *TSPacket) {
+		switch pkg.Payload.(type) {
+		case *Pat, *Pmt, *Sdt:
+			tables = append(tables, pkg.Payload)
+		}
+	}
+	var errs []error
+	demuxer.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+	got := demuxTestStream(t, demuxer, bytes.Join(packets, nil))
+	if len(got) != 15 {
+		t.Errorf("got frames %v", got)
+	}
+	var pmts []*Pmt
+	for _, table := range tables {
+		if pmt, ok := table.(*Pmt); ok {
+			pmts = append(pmts, pmt)
+		}
+	}
+	if len(pmts) == 0 || len(pmts[0].Descriptors) != 1 || len(pmts[0].Descriptors[0].Data) != 204 || pmts[0].Streams[0].Elementary_PID != pid {
+		t.Fatalf("pmt = %+v", pmts)
+	}
+	if _, ok := tables[0].(*Pat); !ok {
+		t.Errorf("first table = %T", tables[0])
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrTSSectionCRC) || demuxer.PidStats()[0].CRCErrors != 1 {
+		t.Errorf("errors = %v", errs)
+	}
+}
+
+// 把视频PES的PTS_DTS_flags改为只有PTS, DTS的位置填充0xFF(PES头的stuffing)
+func stripPesDts(t *testing.T, pkg []byte, pid uint16) {
+	if pkg[1]&0x40 == 0 || uint16(pkg[1]&0x1F)<<8|uint16(pkg[2]) != pid {
+		return
+	}
+	offset := 4
+	if pkg[3]&0x20 != 0 {
+		offset += 1 + int(pkg[4])
+	}
+	pes := pkg[offset:]
+	if !bytes.Equal(pes[:3], []byte{0x00, 0x00, 0x01}) || pes[7]>>6 != 0x03 {
+		t.Fatalf("unexpected pes header %x", pes[:19])
+	}
+	pes[7] = pes[7]&0x3F | 0x80
+	pes[9] = pes[9]&0x0F | 0x20
+	copy(pes[14:19], bytes.Repeat([]byte{0xFF}, 5))
+}
+
+//带B帧的H264码流, 返回解码顺序的帧, 每帧的pts和按POC推算出的dts
+func reorderH264TestFrames() (frames [][]byte, pts []uint64, dts []uint64) {
+	header, _ := hex.DecodeString("00000001674d001eed8283f403c22114e0" + "0000000168ce3c80")
+	idr, _ := hex.DecodeString("0000000165888402aaa0")
+	p1, _ := hex.DecodeString("00000001419a220aaa80")
+	b1, _ := hex.DecodeString("00000001019e41455540")
+	p2, _ := hex.DecodeString("00000001419a440aaa80")
+	b3, _ := hex.DecodeString("00000001019e63455540")
+	//num_reorder_frames = 1, 解码顺序 I0 P2 B1 P4 B3 I0 P2 B1
+	frames = [][]byte{append(append([]byte{}, header...), idr...), p1, b1, p2, b3, append(append([]byte{}, header...), idr...), p1, b1}
+	pts = []uint64{80, 160, 120, 240, 200, 280, 360, 320}
+	dts = []uint64{40, 80, 120, 160, 200, 240, 280, 320}
+	return
+}
+
+func TestTSDemuxer_ReorderH264(t *testing.T) {
+	frames, pts, wantDts := reorderH264TestFrames()
+
+	var packets [][]byte
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, append([]byte{}, pkg...))
+	}
+	pid := muxer.AddStream(TS_STREAM_H264)
+	for i, frame := range frames {
+		if err := muxer.Write(pid, frame, pts[i], pts[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, pkg := range packets {
+		stripPesDts(t, pkg, pid)
+	}
+
+	tests := []struct {
+		name    string
+		reorder bool
+		wantDts []uint64
+	}{
+		//没有DTS时dts等于pts
+		{name: "without reorder", wantDts: pts},
+		{name: "reorder", reorder: true, wantDts: wantDts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPts, gotDts []uint64
+			demuxer := NewTSDemuxer()
+			demuxer.ReorderH264 = tt.reorder
+			demuxer.OnFrame = func(cid TS_STREAM_TYPE, frame []byte, pts uint64, dts uint64) {
+				gotPts = append(gotPts, pts)
+				gotDts = append(gotDts, dts)
+			}
+			if err := demuxer.Input(bytes.NewReader(bytes.Join(packets, nil))); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotPts, pts) || !reflect.DeepEqual(gotDts, tt.wantDts) {
+				t.Errorf("pts = %v dts = %v, want %v %v", gotPts, gotDts, pts, tt.wantDts)
+			}
+		})
+	}
+}
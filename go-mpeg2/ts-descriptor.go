@@ -0,0 +1,170 @@
+package mpeg2
+
+import (
+	"errors"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+// descriptor tag, ISO/IEC 13818-1 2.6 和 ETSI EN 300 468 6.1
+const (
+	TS_DESCRIPTOR_REGISTRATION       uint8 = 0x05
+	TS_DESCRIPTOR_ISO_639_LANGUAGE   uint8 = 0x0A
+	TS_DESCRIPTOR_NETWORK_NAME       uint8 = 0x40
+	TS_DESCRIPTOR_SERVICE            uint8 = 0x48
+	TS_DESCRIPTOR_SHORT_EVENT        uint8 = 0x4D
+	TS_DESCRIPTOR_MAX_PAYLOAD_LENGTH       = 0xFF
+)
+
+// service_type, ETSI EN 300 468 Table 87
+const (
+	TS_SERVICE_DIGITAL_TV    uint8 = 0x01
+	TS_SERVICE_DIGITAL_RADIO uint8 = 0x02
+	TS_SERVICE_AVC_HD_TV     uint8 = 0x19
+	TS_SERVICE_HEVC_TV       uint8 = 0x1F
+)
+
+//	descriptor() {
+//	    descriptor_tag       8 uimsbf
+//	    descriptor_length    8 uimsbf
+//	    descriptor_data[]
+//	}
+type Descriptor struct {
+	Tag  uint8
+	Data []byte
+}
+
+func (desc *Descriptor) Encode(bsw *codec.BitStreamWriter) {
+	bsw.PutByte(desc.Tag)
+	bsw.PutByte(uint8(len(desc.Data)))
+	bsw.PutBytes(desc.Data)
+}
+
+// format_identifier为四个字节, 例如"HEVC", "Opus", "AC-3"
+func NewRegistrationDescriptor(formatIdentifier string, additional ...byte) Descriptor {
+	data := make([]byte, 4, 4+len(additional))
+	copy(data, formatIdentifier)
+	return Descriptor{Tag: TS_DESCRIPTOR_REGISTRATION, Data: append(data, additional...)}
+}
+
+// language为ISO 639-2三个字母的语言代码, audioType 0:undefined 1:clean effects 2:hearing impaired 3:visual impaired commentary
+func NewISO639LanguageDescriptor(language string, audioType uint8) Descriptor {
+	data := make([]byte, 4)
+	copy(data, language)
+	data[3] = audioType
+	return Descriptor{Tag: TS_DESCRIPTOR_ISO_639_LANGUAGE, Data: data}
+}
+
+// SDT中的service_descriptor
+func NewServiceDescriptor(serviceType uint8, provider, name string) Descriptor {
+	data := make([]byte, 0, 3+len(provider)+len(name))
+	data = append(data, serviceType, uint8(len(provider)))
+	data = append(data, provider...)
+	data = append(data, uint8(len(name)))
+	data = append(data, name...)
+	return Descriptor{Tag: TS_DESCRIPTOR_SERVICE, Data: data}
+}
+
+// NIT中的network_name_descriptor
+func NewNetworkNameDescriptor(name string) Descriptor {
+	return Descriptor{Tag: TS_DESCRIPTOR_NETWORK_NAME, Data: []byte(name)}
+}
+
+// EIT中的short_event_descriptor, language为ISO 639-2三个字母的语言代码
+func NewShortEventDescriptor(language, name, text string) Descriptor {
+	data := make([]byte, 3, 5+len(name)+len(text))
+	copy(data, language)
+	data = append(data, uint8(len(name)))
+	data = append(data, name...)
+	data = append(data, uint8(len(text)))
+	data = append(data, text...)
+	return Descriptor{Tag: TS_DESCRIPTOR_SHORT_EVENT, Data: data}
+}
+
+func (desc *Descriptor) Language() (string, bool) {
+	if desc.Tag != TS_DESCRIPTOR_ISO_639_LANGUAGE || len(desc.Data) < 3 {
+		return "", false
+	}
+	return string(desc.Data[:3]), true
+}
+
+func (desc *Descriptor) FormatIdentifier() (string, bool) {
+	if desc.Tag != TS_DESCRIPTOR_REGISTRATION || len(desc.Data) < 4 {
+		return "", false
+	}
+	return string(desc.Data[:4]), true
+}
+
+func (desc *Descriptor) Service() (serviceType uint8, provider, name string, ok bool) {
+	if desc.Tag != TS_DESCRIPTOR_SERVICE || len(desc.Data) < 2 {
+		return
+	}
+	n := int(desc.Data[1])
+	if len(desc.Data) < 3+n {
+		return
+	}
+	provider = string(desc.Data[2 : 2+n])
+	m := int(desc.Data[2+n])
+	if len(desc.Data) < 3+n+m {
+		return
+	}
+	return desc.Data[0], provider, string(desc.Data[3+n : 3+n+m]), true
+}
+
+func (desc *Descriptor) NetworkName() (string, bool) {
+	if desc.Tag != TS_DESCRIPTOR_NETWORK_NAME {
+		return "", false
+	}
+	return string(desc.Data), true
+}
+
+func (desc *Descriptor) ShortEvent() (language, name, text string, ok bool) {
+	if desc.Tag != TS_DESCRIPTOR_SHORT_EVENT || len(desc.Data) < 4 {
+		return
+	}
+	n := int(desc.Data[3])
+	if len(desc.Data) < 5+n {
+		return
+	}
+	name = string(desc.Data[4 : 4+n])
+	m := int(desc.Data[4+n])
+	if len(desc.Data) < 5+n+m {
+		return
+	}
+	return string(desc.Data[:3]), name, string(desc.Data[5+n : 5+n+m]), true
+}
+
+func descriptorsLength(descs []Descriptor) uint16 {
+	length := 0
+	for i := range descs {
+		length += 2 + len(descs[i].Data)
+	}
+	return uint16(length)
+}
+
+func encodeDescriptors(bsw *codec.BitStreamWriter, descs []Descriptor) {
+	for i := range descs {
+		descs[i].Encode(bsw)
+	}
+}
+
+func decodeDescriptors(data []byte) ([]Descriptor, error) {
+	var descs []Descriptor
+	for len(data) > 0 {
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return descs, errors.New("descriptor length out of range")
+		}
+		descs = append(descs, Descriptor{Tag: data[0], Data: append([]byte{}, data[2:2+int(data[1])]...)})
+		data = data[2+int(data[1]):]
+	}
+	return descs, nil
+}
+
+func checkDescriptors(descs []Descriptor) error {
+	for i := range descs {
+		if len(descs[i].Data) > TS_DESCRIPTOR_MAX_PAYLOAD_LENGTH {
+			return errors.New("descriptor data too long")
+		}
+	}
+	return nil
+}
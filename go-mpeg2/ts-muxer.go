@@ -7,9 +7,10 @@ import (
 )
 
 type pes_stream struct {
-    pid        uint16
-    cc         uint8
-    streamtype TS_STREAM_TYPE
+    pid         uint16
+    cc          uint8
+    streamtype  TS_STREAM_TYPE
+    descriptors []Descriptor
 }
 
 func NewPESStream(pid uint16, cid TS_STREAM_TYPE) *pes_stream {
@@ -27,6 +28,15 @@ type table_pmt struct {
     version_number uint8
     pm             uint16
     streams        []*pes_stream
+    descriptors    []Descriptor
+    written        bool
+    last_pcr       uint64 //CBR模式下上一次发送的PCR
+    pcr_written    bool
+
+    //SDT service_descriptor, name为空时不写入SDT
+    service_type     uint8
+    service_provider string
+    service_name     string
 }
 
 func NewTablePmt() *table_pmt {
@@ -40,10 +50,30 @@ func NewTablePmt() *table_pmt {
     }
 }
 
+func (pmt *table_pmt) isVideoPid(pid uint16) bool {
+    for _, stream := range pmt.streams {
+        if stream.pid == pid {
+            return findPESIDByStreamType(stream.streamtype) == PES_STREAM_VIDEO
+        }
+    }
+    return false
+}
+
+// SCTE 35要求PMT的program_info中有"CUEI"的registration_descriptor
+func (pmt *table_pmt) addCueRegistration() {
+    for _, desc := range pmt.descriptors {
+        if format, _ := desc.FormatIdentifier(); format == "CUEI" {
+            return
+        }
+    }
+    pmt.descriptors = append(pmt.descriptors, NewRegistrationDescriptor("CUEI"))
+}
+
 type table_pat struct {
     cc             uint8
     version_number uint8
     pmts           []*table_pmt
+    written        bool
 }
 
 func NewTablePat() *table_pat {
@@ -54,42 +84,289 @@ func NewTablePat() *table_pat {
     }
 }
 
+type table_sdt struct {
+    cc             uint8
+    version_number uint8
+    written        bool
+}
+
 type TSMuxer struct {
-    pat        *table_pat
-    stream_pid uint16
-    pmt_pid    uint16
-    pat_period uint64
-    OnPacket   func(pkg []byte)
+    pat          *table_pat
+    sdt          table_sdt
+    stream_pid   uint16
+    pmt_pid      uint16
+    pat_period   uint64
+    table_period uint64
+    tsid         uint16
+    onid         uint16
+    cbr          cbrState
+    OnPacket     func(pkg []byte)
 }
 
 func NewTSMuxer() *TSMuxer {
     return &TSMuxer{
-        pat:        NewTablePat(),
-        stream_pid: 0x100,
-        pmt_pid:    0x200,
-        pat_period: 0,
-        OnPacket:   nil,
+        pat:          NewTablePat(),
+        stream_pid:   0x100,
+        pmt_pid:      0x200,
+        pat_period:   0,
+        table_period: 400,
+        tsid:         1,
+        onid:         1,
+        cbr: cbrState{
+            pcr_period: 40,
+            max_delay:  700,
+        },
+        OnPacket: nil,
+    }
+}
+
+// ISO/IEC 13818-1 2.4.4.9, EN 300 468 5.2.3
+const tsMaxPsiSectionLength = 1021
+
+type ProgramOption func(pmt *table_pmt)
+
+// 不设置时从0x200开始分配
+func WithPmtPid(pid uint16) ProgramOption {
+    return func(pmt *table_pmt) {
+        pmt.pid = pid
     }
 }
 
+// 设置之后在SDT中写入service_descriptor
+func WithService(serviceType uint8, provider string, name string) ProgramOption {
+    return func(pmt *table_pmt) {
+        pmt.service_type = serviceType
+        pmt.service_provider = provider
+        pmt.service_name = name
+    }
+}
+
+// PMT program_info中的descriptor
+func WithProgramDescriptors(descs ...Descriptor) ProgramOption {
+    return func(pmt *table_pmt) {
+        pmt.descriptors = append(pmt.descriptors, descs...)
+    }
+}
+
+type StreamOption func(stream *pes_stream)
+
+// 不设置时从0x100开始分配
+func WithStreamPid(pid uint16) StreamOption {
+    return func(stream *pes_stream) {
+        stream.pid = pid
+    }
+}
+
+// ISO 639-2语言代码, 例如"eng", "chi"
+func WithLanguage(language string) StreamOption {
+    return func(stream *pes_stream) {
+        stream.descriptors = append(stream.descriptors, NewISO639LanguageDescriptor(language, 0))
+    }
+}
+
+// registration descriptor, 例如"HEVC", "Opus"
+func WithRegistration(formatIdentifier string) StreamOption {
+    return func(stream *pes_stream) {
+        stream.descriptors = append(stream.descriptors, NewRegistrationDescriptor(formatIdentifier))
+    }
+}
+
+// PMT ES_info中的descriptor
+func WithStreamDescriptors(descs ...Descriptor) StreamOption {
+    return func(stream *pes_stream) {
+        stream.descriptors = append(stream.descriptors, descs...)
+    }
+}
+
+func (mux *TSMuxer) SetTransportStreamId(tsid uint16) {
+    mux.tsid = tsid
+    mux.patChanged()
+    mux.sdtChanged()
+}
+
+func (mux *TSMuxer) SetOriginalNetworkId(onid uint16) {
+    mux.onid = onid
+    mux.sdtChanged()
+}
+
 func (mux *TSMuxer) AddStream(cid TS_STREAM_TYPE) uint16 {
     if mux.pat == nil {
         mux.pat = NewTablePat()
     }
     if len(mux.pat.pmts) == 0 {
-        tmppmt := NewTablePmt()
-        tmppmt.pid = mux.pmt_pid
-        tmppmt.pm = 1
-        mux.pmt_pid++
-        mux.pat.pmts = append(mux.pat.pmts, tmppmt)
-    }
-    sid := mux.stream_pid
-    tmpstream := NewPESStream(sid, cid)
-    mux.stream_pid++
-    mux.pat.pmts[0].streams = append(mux.pat.pmts[0].streams, tmpstream)
+        mux.AddProgram(1)
+    }
+    sid, _ := mux.AddProgramStream(mux.pat.pmts[0].pm, cid)
     return sid
 }
 
+func (mux *TSMuxer) AddProgram(programNumber uint16, options ...ProgramOption) error {
+    if programNumber == 0 {
+        return errors.New("program_number 0 is reserved for network_PID")
+    }
+    if mux.findProgram(programNumber) != nil {
+        return errors.New("program already exists")
+    }
+    pmt := NewTablePmt()
+    pmt.pm = programNumber
+    for _, opt := range options {
+        opt(pmt)
+    }
+    if err := checkDescriptors(pmt.descriptors); err != nil {
+        return err
+    }
+    if err := checkPmtLength(pmt); err != nil {
+        return err
+    }
+    if pmt.pid == 0 {
+        pmt.pid = mux.allocPid(&mux.pmt_pid)
+    } else if err := mux.checkPid(pmt.pid); err != nil {
+        return err
+    }
+    mux.pat.pmts = append(mux.pat.pmts, pmt)
+    if pmt.service_name != "" {
+        if err := mux.checkSdtLength(); err != nil {
+            mux.pat.pmts = mux.pat.pmts[:len(mux.pat.pmts)-1]
+            return err
+        }
+    }
+    mux.patChanged()
+    if pmt.service_name != "" {
+        mux.sdtChanged()
+    }
+    return nil
+}
+
+func (mux *TSMuxer) RemoveProgram(programNumber uint16) error {
+    for i, pmt := range mux.pat.pmts {
+        if pmt.pm != programNumber {
+            continue
+        }
+        mux.pat.pmts = append(mux.pat.pmts[:i], mux.pat.pmts[i+1:]...)
+        mux.patChanged()
+        if pmt.service_name != "" {
+            mux.sdtChanged()
+        }
+        return nil
+    }
+    return errors.New("not Found program")
+}
+
+func (mux *TSMuxer) AddProgramStream(programNumber uint16, cid TS_STREAM_TYPE, options ...StreamOption) (uint16, error) {
+    pmt := mux.findProgram(programNumber)
+    if pmt == nil {
+        return 0, errors.New("not Found program")
+    }
+    stream := NewPESStream(0, cid)
+    for _, opt := range options {
+        opt(stream)
+    }
+    if err := checkDescriptors(stream.descriptors); err != nil {
+        return 0, err
+    }
+    if stream.pid == 0 {
+        stream.pid = mux.allocPid(&mux.stream_pid)
+    } else if err := mux.checkPid(stream.pid); err != nil {
+        return 0, err
+    }
+    streams, descriptors := pmt.streams, pmt.descriptors
+    pmt.streams = append(pmt.streams, stream)
+    if cid == TS_STREAM_SCTE35 {
+        pmt.addCueRegistration()
+    }
+    if err := checkPmtLength(pmt); err != nil {
+        pmt.streams, pmt.descriptors = streams, descriptors
+        return 0, err
+    }
+    mux.pmtChanged(pmt)
+    return stream.pid, nil
+}
+
+func (mux *TSMuxer) RemoveStream(pid uint16) error {
+    for _, pmt := range mux.pat.pmts {
+        for i, stream := range pmt.streams {
+            if stream.pid != pid {
+                continue
+            }
+            pmt.streams = append(pmt.streams[:i], pmt.streams[i+1:]...)
+            if pmt.pcr_pid == pid {
+                pmt.pcr_pid = 0
+            }
+            mux.pmtChanged(pmt)
+            return nil
+        }
+    }
+    return errors.New("not Found pid stream")
+}
+
+func (mux *TSMuxer) findProgram(programNumber uint16) *table_pmt {
+    for _, pmt := range mux.pat.pmts {
+        if pmt.pm == programNumber {
+            return pmt
+        }
+    }
+    return nil
+}
+
+func (mux *TSMuxer) pidInUse(pid uint16) bool {
+    for _, pmt := range mux.pat.pmts {
+        if pmt.pid == pid {
+            return true
+        }
+        for _, stream := range pmt.streams {
+            if stream.pid == pid {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// 0x0000-0x001F为PAT/CAT/SDT等表保留, 0x1FFF为空包
+func (mux *TSMuxer) checkPid(pid uint16) error {
+    if pid < 0x20 || pid >= uint16(TS_PID_Nil) {
+        return errors.New("pid is reserved")
+    }
+    if mux.pidInUse(pid) {
+        return errors.New("pid already in use")
+    }
+    return nil
+}
+
+func (mux *TSMuxer) allocPid(next *uint16) uint16 {
+    for mux.pidInUse(*next) {
+        *next++
+    }
+    pid := *next
+    *next++
+    return pid
+}
+
+// 表已经发送过, 内容变化之后version_number加1, 并且在下一次Write时立即重发
+func (mux *TSMuxer) patChanged() {
+    if mux.pat.written {
+        mux.pat.version_number = (mux.pat.version_number + 1) % 32
+        mux.pat.written = false
+    }
+    mux.pat_period = 0
+}
+
+func (mux *TSMuxer) pmtChanged(pmt *table_pmt) {
+    if pmt.written {
+        pmt.version_number = (pmt.version_number + 1) % 32
+        pmt.written = false
+    }
+    mux.pat_period = 0
+}
+
+func (mux *TSMuxer) sdtChanged() {
+    if mux.sdt.written {
+        mux.sdt.version_number = (mux.sdt.version_number + 1) % 32
+        mux.sdt.written = false
+    }
+    mux.pat_period = 0
+}
+
 /// Muxer audio/video stream data
 /// pid: stream id by AddStream
 /// pts: audio/video stream timestamp in ms
@@ -109,8 +386,13 @@ func (mux *TSMuxer) Write(pid uint16, data []byte, pts uint64, dts uint64) error
     if whichpmt == nil || whichstream == nil {
         return errors.New("not Found pid stream")
     }
-    if whichpmt.pcr_pid == 0 || (findPESIDByStreamType(whichstream.streamtype) == PES_STREAM_VIDEO && whichpmt.pcr_pid != pid) {
+    if whichstream.streamtype == TS_STREAM_SCTE35 {
+        return errors.New("scte35 stream should use WriteSpliceInfo")
+    }
+    //优先使用视频流作为PCR_PID, 多个视频流时不再切换
+    if whichpmt.pcr_pid == 0 || (findPESIDByStreamType(whichstream.streamtype) == PES_STREAM_VIDEO && whichpmt.pcr_pid != pid && !whichpmt.isVideoPid(whichpmt.pcr_pid)) {
         whichpmt.pcr_pid = pid
+        mux.pmtChanged(whichpmt)
     }
 
     var withaud bool = false
@@ -139,36 +421,12 @@ func (mux *TSMuxer) Write(pid uint16, data []byte, pts uint64, dts uint64) error
         })
     }
 
-    if mux.pat_period == 0 || mux.pat_period+400 < dts {
+    if mux.isCBR() {
+        mux.pace(dts * 90)
+    }
+    if mux.tablesDue(dts) {
         mux.pat_period = dts
-        if mux.pat_period == 0 {
-            mux.pat_period = 1 //avoid write pat twice
-        }
-        tmppat := NewPat()
-        tmppat.Version_number = mux.pat.version_number
-        for _, pmt := range mux.pat.pmts {
-            tmppm := PmtPair{
-                Program_number: pmt.pm,
-                PID:            pmt.pid,
-            }
-            tmppat.Pmts = append(tmppat.Pmts, tmppm)
-        }
-        mux.writePat(tmppat)
-
-        for _, pmt := range mux.pat.pmts {
-            tmppmt := NewPmt()
-            tmppmt.Program_number = pmt.pm
-            tmppmt.Version_number = pmt.version_number
-            tmppmt.PCR_PID = pmt.pcr_pid
-            for _, stream := range pmt.streams {
-                var sp StreamPair
-                sp.StreamType = uint8(stream.streamtype)
-                sp.Elementary_PID = stream.pid
-                sp.ES_Info_Length = 0
-                tmppmt.Streams = append(tmppmt.Streams, sp)
-            }
-            mux.writePmt(tmppmt, pmt)
-        }
+        mux.writeTables()
     }
 
     flag := false
@@ -180,40 +438,169 @@ func (mux *TSMuxer) Write(pid uint16, data []byte, pts uint64, dts uint64) error
     }
 
     mux.writePES(whichstream, whichpmt, data, pts*90, dts*90, flag, withaud)
+    if mux.isCBR() {
+        return mux.checkOverrun(dts * 90)
+    }
+    return nil
+}
+
+// 在AddProgramStream(programNumber, TS_STREAM_SCTE35)添加的pid上发送splice_info_section
+// splice_time中的Pts_time为90KHz, 和Write的pts*90使用同一个时间基准
+func (mux *TSMuxer) WriteSpliceInfo(pid uint16, splice *SpliceInfoSection) error {
+    var whichstream *pes_stream = nil
+    for _, pmt := range mux.pat.pmts {
+        for _, stream := range pmt.streams {
+            if stream.pid == pid && stream.streamtype == TS_STREAM_SCTE35 {
+                whichstream = stream
+            }
+        }
+    }
+    if whichstream == nil {
+        return errors.New("not Found scte35 stream")
+    }
+    if mux.pat_period == 0 {
+        mux.writeTables()
+    }
+    bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
+    splice.Encode(bsw)
+    mux.writeSection(pid, &whichstream.cc, bsw.Bits())
+    return nil
+}
+
+func (mux *TSMuxer) writeTables() {
+    if mux.pat_period == 0 {
+        mux.pat_period = 1 //avoid write pat twice
+    }
+    if mux.isCBR() {
+        mux.cbr.last_tables = mux.currentPcr()
+    }
+    tmppat := NewPat()
+    tmppat.Transport_stream_id = mux.tsid
+    tmppat.Version_number = mux.pat.version_number
+    for _, pmt := range mux.pat.pmts {
+        tmppm := PmtPair{
+            Program_number: pmt.pm,
+            PID:            pmt.pid,
+        }
+        tmppat.Pmts = append(tmppat.Pmts, tmppm)
+    }
+    mux.writePat(tmppat)
+    mux.pat.written = true
+
+    sdt := mux.makeSdt()
+    if len(sdt.Services) > 0 {
+        mux.writeSdt(sdt)
+        mux.sdt.written = true
+    }
+
+    for _, pmt := range mux.pat.pmts {
+        mux.writePmt(pmt.makePmt(), pmt)
+        pmt.written = true
+    }
+}
+
+func (pmt *table_pmt) makePmt() *Pmt {
+    tmppmt := NewPmt()
+    tmppmt.Program_number = pmt.pm
+    tmppmt.Version_number = pmt.version_number
+    tmppmt.PCR_PID = pmt.pcr_pid
+    if tmppmt.PCR_PID == 0 {
+        tmppmt.PCR_PID = uint16(TS_PID_Nil)
+    }
+    tmppmt.Descriptors = pmt.descriptors
+    for _, stream := range pmt.streams {
+        var sp StreamPair
+        sp.StreamType = uint8(stream.streamtype)
+        sp.Elementary_PID = stream.pid
+        sp.Descriptors = stream.descriptors
+        tmppmt.Streams = append(tmppmt.Streams, sp)
+    }
+    return tmppmt
+}
+
+func (mux *TSMuxer) makeSdt() *Sdt {
+    sdt := NewSdt()
+    sdt.Transport_stream_id = mux.tsid
+    sdt.Original_network_id = mux.onid
+    sdt.Version_number = mux.sdt.version_number
+    for _, pmt := range mux.pat.pmts {
+        if pmt.service_name == "" {
+            continue
+        }
+        sdt.Services = append(sdt.Services, SdtService{
+            Service_id:     pmt.pm,
+            Running_status: 4, //running
+            Descriptors:    []Descriptor{NewServiceDescriptor(pmt.service_type, pmt.service_provider, pmt.service_name)},
+        })
+    }
+    return sdt
+}
+
+// PMT和SDT只使用一个section, section_length不能超过1021
+func checkPmtLength(pmt *table_pmt) error {
+    tmppmt := pmt.makePmt()
+    tmppmt.Encode(codec.NewBitStreamWriter(TS_PAKCET_SIZE))
+    if tmppmt.Section_length > tsMaxPsiSectionLength {
+        return errors.New("pmt section_length exceeds 1021")
+    }
+    return nil
+}
+
+func (mux *TSMuxer) checkSdtLength() error {
+    sdt := mux.makeSdt()
+    sdt.Encode(codec.NewBitStreamWriter(TS_PAKCET_SIZE))
+    if sdt.Section_length > tsMaxPsiSectionLength {
+        return errors.New("sdt section_length exceeds 1021")
+    }
     return nil
 }
 
 func (mux *TSMuxer) writePat(pat *Pat) {
-    var tshdr TSPacket
-    tshdr.Payload_unit_start_indicator = 1
-    tshdr.PID = 0
-    tshdr.Adaptation_field_control = 0x01
-    tshdr.Continuity_counter = mux.pat.cc
-    mux.pat.cc = (mux.pat.cc + 1) % 16
     bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
-    tshdr.EncodeHeader(bsw)
-    bsw.PutByte(0x00) //pointer
     pat.Encode(bsw)
-    bsw.FillRemainData(0xff)
-    if mux.OnPacket != nil {
-        mux.OnPacket(bsw.Bits())
-    }
+    mux.writeSection(uint16(TS_PID_PAT), &mux.pat.cc, bsw.Bits())
 }
 
 func (mux *TSMuxer) writePmt(pmt *Pmt, t_pmt *table_pmt) {
-    var tshdr TSPacket
-    tshdr.Payload_unit_start_indicator = 1
-    tshdr.PID = t_pmt.pid
-    tshdr.Adaptation_field_control = 0x01
-    tshdr.Continuity_counter = t_pmt.cc
-    t_pmt.cc = (t_pmt.cc + 1) % 16
     bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
-    tshdr.EncodeHeader(bsw)
-    bsw.PutByte(0x00) //pointer
     pmt.Encode(bsw)
-    bsw.FillRemainData(0xff)
-    if mux.OnPacket != nil {
-        mux.OnPacket(bsw.Bits())
+    mux.writeSection(t_pmt.pid, &t_pmt.cc, bsw.Bits())
+}
+
+func (mux *TSMuxer) writeSdt(sdt *Sdt) {
+    bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
+    sdt.Encode(bsw)
+    mux.writeSection(TS_PID_SDT, &mux.sdt.cc, bsw.Bits())
+}
+
+// section超过一个ts包时拆分到后续的ts包中, 只有第一个包带pointer_field
+func (mux *TSMuxer) writeSection(pid uint16, cc *uint8, section []byte) {
+    bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
+    for first := true; first || len(section) > 0; first = false {
+        if mux.isCBR() {
+            mux.writeDuePcr(0)
+        }
+        bsw.Reset()
+        var tshdr TSPacket
+        tshdr.PID = pid
+        tshdr.Adaptation_field_control = 0x01
+        tshdr.Continuity_counter = *cc
+        *cc = (*cc + 1) % 16
+        if first {
+            tshdr.Payload_unit_start_indicator = 1
+        }
+        tshdr.EncodeHeader(bsw)
+        if first {
+            bsw.PutByte(0x00) //pointer
+        }
+        n := TS_PAKCET_SIZE - bsw.ByteOffset()
+        if n > len(section) {
+            n = len(section)
+        }
+        bsw.PutBytes(section[:n])
+        section = section[n:]
+        bsw.FillRemainData(0xff)
+        mux.output(bsw.Bits())
     }
 }
 
@@ -221,6 +608,9 @@ func (mux *TSMuxer) writePES(pes *pes_stream, pmt *table_pmt, data []byte, pts u
     var firstPesPacket bool = true
     bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
     for {
+        if mux.isCBR() {
+            mux.writeDuePcr(pes.pid)
+        }
         bsw.Reset()
         var tshdr TSPacket
         if firstPesPacket {
@@ -239,24 +629,29 @@ func (mux *TSMuxer) writePES(pes *pes_stream, pmt *table_pmt, data []byte, pts u
             headlen += 2
         }
 
-        if firstPesPacket && pes.pid == pmt.pcr_pid {
+        //CBR模式下PCR按包的位置推算, 并且至少每pcr_period插入一次
+        if pes.pid == pmt.pcr_pid && (firstPesPacket || (mux.isCBR() && mux.pcrDue(pmt))) {
             if adaptation == nil {
                 adaptation = new(Adaptation_field)
                 headlen += 2
             }
             tshdr.Adaptation_field_control = tshdr.Adaptation_field_control | 0x20
-            adaptation.PCR_flag = 1
-            var pcr_base uint64 = 0
-            var pcr_ext uint16 = 0
-            if dts == 0 {
-                pcr_base = pts * 300 / 300
-                pcr_ext = uint16(pts * 300 % 300)
+            if mux.isCBR() {
+                mux.fillPcr(adaptation, pmt)
             } else {
-                pcr_base = dts * 300 / 300
-                pcr_ext = uint16(dts * 300 % 300)
+                adaptation.PCR_flag = 1
+                var pcr_base uint64 = 0
+                var pcr_ext uint16 = 0
+                if dts == 0 {
+                    pcr_base = pts * 300 / 300
+                    pcr_ext = uint16(pts * 300 % 300)
+                } else {
+                    pcr_base = dts * 300 / 300
+                    pcr_ext = uint16(dts * 300 % 300)
+                }
+                adaptation.Program_clock_reference_base = pcr_base
+                adaptation.Program_clock_reference_extension = pcr_ext
             }
-            adaptation.Program_clock_reference_base = pcr_base
-            adaptation.Program_clock_reference_extension = pcr_ext
             headlen += 6
         }
 
@@ -319,12 +714,10 @@ func (mux *TSMuxer) writePES(pes *pes_stream, pmt *table_pmt, data []byte, pts u
             bsw.PutBytes(payload)
         }
         firstPesPacket = false
-        if mux.OnPacket != nil {
-            if len(bsw.Bits()) != TS_PAKCET_SIZE {
-                panic("packet ts packet failed")
-            }
-            mux.OnPacket(bsw.Bits())
+        if len(bsw.Bits()) != TS_PAKCET_SIZE {
+            panic("packet ts packet failed")
         }
+        mux.output(bsw.Bits())
         if len(data) == 0 {
             break
         }
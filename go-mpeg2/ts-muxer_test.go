@@ -0,0 +1,342 @@
+package mpeg2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+// 测试用的AAC流, 40ms一帧, 第i帧为size个byte(i+1)
+type tsTestStream struct {
+	streams int
+	frames  int
+	size    int
+}
+
+// 用muxer写入测试流, 返回所有ts包和每路流的pid
+func muxTSTestStream(t *testing.T, muxer *TSMuxer, stream tsTestStream) ([][]byte, []uint16) {
+	var packets [][]byte
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, append([]byte{}, pkg...))
+	}
+	pids := make([]uint16, stream.streams)
+	for i := range pids {
+		pids[i] = muxer.AddStream(TS_STREAM_AAC)
+	}
+	for i := 0; i < stream.frames; i++ {
+		for _, pid := range pids {
+			if err := muxer.Write(pid, bytes.Repeat([]byte{byte(i + 1)}, stream.size), uint64(i*40), uint64(i*40)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return packets, pids
+}
+
+type tsSections struct {
+	pats []*Pat
+	pmts map[uint16][]*Pmt
+	sdts []*Sdt
+	pes  map[uint16]int
+}
+
+// 按pid拼接section, 解析PAT/PMT/SDT, 统计每个pid的PES个数
+func parseTSSections(t *testing.T, packets [][]byte) *tsSections {
+	result := &tsSections{pmts: make(map[uint16][]*Pmt), pes: make(map[uint16]int)}
+	pmtPids := make(map[uint16]bool)
+	pending := make(map[uint16][]byte)
+	lastcc := make(map[uint16]uint8)
+	flush := func(pid uint16) {
+		section := pending[pid]
+		delete(pending, pid)
+		if len(section) == 0 {
+			return
+		}
+		length := int(section[1]&0x0F)<<8 | int(section[2])
+		if len(section) < 3+length {
+			t.Fatalf("pid %d section is truncated", pid)
+		}
+		if codec.CalcCrc32(0xffffffff, section[:3+length-4]) != uint32(section[3+length-1])<<24|uint32(section[3+length-2])<<16|uint32(section[3+length-3])<<8|uint32(section[3+length-4]) {
+			t.Errorf("pid %d section crc mismatch", pid)
+		}
+		bs := codec.NewBitStream(section[:3+length])
+		switch {
+		case pid == uint16(TS_PID_PAT):
+			pat := NewPat()
+			if err := pat.Decode(bs); err != nil {
+				t.Fatal(err)
+			}
+			for _, pm := range pat.Pmts {
+				pmtPids[pm.PID] = true
+			}
+			result.pats = append(result.pats, pat)
+		case pid == TS_PID_SDT:
+			sdt := NewSdt()
+			if err := sdt.Decode(bs); err != nil {
+				t.Fatal(err)
+			}
+			result.sdts = append(result.sdts, sdt)
+		default:
+			pmt := NewPmt()
+			if err := pmt.Decode(bs); err != nil {
+				t.Fatal(err)
+			}
+			result.pmts[pid] = append(result.pmts[pid], pmt)
+		}
+	}
+	for _, pkg := range packets {
+		if len(pkg) != TS_PAKCET_SIZE {
+			t.Fatalf("packet size %d", len(pkg))
+		}
+		var hdr TSPacket
+		bs := codec.NewBitStream(pkg)
+		if err := hdr.DecodeHeader(bs); err != nil {
+			t.Fatal(err)
+		}
+		if cc, found := lastcc[hdr.PID]; found && (cc+1)%16 != hdr.Continuity_counter {
+			t.Errorf("pid %d continuity_counter %d after %d", hdr.PID, hdr.Continuity_counter, cc)
+		}
+		lastcc[hdr.PID] = hdr.Continuity_counter
+		if hdr.PID != uint16(TS_PID_PAT) && hdr.PID != TS_PID_SDT && !pmtPids[hdr.PID] {
+			if hdr.Payload_unit_start_indicator == 1 {
+				result.pes[hdr.PID]++
+			}
+			continue
+		}
+		if hdr.Payload_unit_start_indicator == 1 {
+			flush(hdr.PID)
+			bs.SkipBits(8)
+		}
+		pending[hdr.PID] = append(pending[hdr.PID], bs.RemainData()...)
+		if section := pending[hdr.PID]; len(section) >= 3 && len(section) >= 3+(int(section[1]&0x0F)<<8|int(section[2])) {
+			flush(hdr.PID)
+		}
+	}
+	for pid := range pending {
+		flush(pid)
+	}
+	return result
+}
+
+func TestTSMuxer_AddProgram(t *testing.T) {
+	var packets [][]byte
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, append([]byte{}, pkg...))
+	}
+	muxer.SetTransportStreamId(0x10)
+	if err := muxer.AddProgram(1, WithPmtPid(0x1000), WithService(TS_SERVICE_HEVC_TV, "gomedia", "news")); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.AddProgram(2, WithPmtPid(0x1100), WithService(TS_SERVICE_DIGITAL_RADIO, "gomedia", "radio")); err != nil {
+		t.Fatal(err)
+	}
+	video, err := muxer.AddProgramStream(1, TS_STREAM_H265, WithStreamPid(0x1011), WithRegistration("HEVC"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := muxer.AddProgramStream(1, TS_STREAM_AAC, WithStreamPid(0x1012), WithLanguage("eng"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opus, err := muxer.AddProgramStream(2, TS_STREAM_PRIVATE, WithRegistration("Opus"), WithLanguage("fra"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opus != 0x100 {
+		t.Errorf("auto pid = %#x, want 0x100", opus)
+	}
+
+	errTests := []struct {
+		name string
+		err  error
+	}{
+		{"program 0", muxer.AddProgram(0)},
+		{"duplicate program", muxer.AddProgram(1)},
+		{"pmt pid in use", muxer.AddProgram(3, WithPmtPid(0x1011))},
+		{"reserved pid", muxer.AddProgram(3, WithPmtPid(0x0011))},
+		{"unknown program", func() error { _, err := muxer.AddProgramStream(9, TS_STREAM_AAC); return err }()},
+		{"stream pid in use", func() error { _, err := muxer.AddProgramStream(2, TS_STREAM_AAC, WithStreamPid(0x1000)); return err }()},
+	}
+	for _, tt := range errTests {
+		if tt.err == nil {
+			t.Errorf("%s: expect error", tt.name)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := muxer.Write(audio, bytes.Repeat([]byte{0x11}, 300), uint64(i*40), uint64(i*40)); err != nil {
+			t.Fatal(err)
+		}
+		if err := muxer.Write(opus, bytes.Repeat([]byte{0x22}, 50), uint64(i*40), uint64(i*40)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sections := parseTSSections(t, packets)
+	if len(sections.pats) == 0 || sections.pats[0].Transport_stream_id != 0x10 {
+		t.Fatalf("pat = %+v", sections.pats)
+	}
+	if want := []PmtPair{{1, 0x1000}, {2, 0x1100}}; !reflect.DeepEqual(sections.pats[0].Pmts, want) {
+		t.Errorf("pat programs = %+v, want %+v", sections.pats[0].Pmts, want)
+	}
+
+	pmt := sections.pmts[0x1000][0]
+	if pmt.Program_number != 1 || pmt.PCR_PID != audio || len(pmt.Streams) != 2 {
+		t.Fatalf("pmt 1 = %+v", pmt)
+	}
+	if format, _ := pmt.Streams[0].Descriptors[0].FormatIdentifier(); format != "HEVC" || pmt.Streams[0].Elementary_PID != video {
+		t.Errorf("video stream = %+v", pmt.Streams[0])
+	}
+	if lang, _ := pmt.Streams[1].Descriptors[0].Language(); lang != "eng" {
+		t.Errorf("audio language = %q", lang)
+	}
+	pmt = sections.pmts[0x1100][0]
+	if len(pmt.Streams) != 1 || pmt.Streams[0].StreamType != uint8(TS_STREAM_PRIVATE) || len(pmt.Streams[0].Descriptors) != 2 {
+		t.Fatalf("pmt 2 = %+v", pmt)
+	}
+	if format, _ := pmt.Streams[0].Descriptors[0].FormatIdentifier(); format != "Opus" {
+		t.Errorf("opus registration = %q", format)
+	}
+
+	if len(sections.sdts) == 0 || len(sections.sdts[0].Services) != 2 {
+		t.Fatalf("sdt = %+v", sections.sdts)
+	}
+	for i, want := range []string{"news", "radio"} {
+		service := sections.sdts[0].Services[i]
+		if _, provider, name, ok := service.Descriptors[0].Service(); !ok || provider != "gomedia" || name != want || service.Service_id != uint16(i+1) {
+			t.Errorf("service %d = %+v", i, service)
+		}
+	}
+	if sections.pes[audio] != 3 || sections.pes[opus] != 3 {
+		t.Errorf("pes count = %v", sections.pes)
+	}
+}
+
+func TestTSMuxer_Version(t *testing.T) {
+	var packets [][]byte
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, append([]byte{}, pkg...))
+	}
+	audio := muxer.AddStream(TS_STREAM_AAC)
+	if err := muxer.AddProgram(2, WithService(TS_SERVICE_DIGITAL_TV, "p", "s")); err != nil {
+		t.Fatal(err)
+	}
+	write := func(pid uint16) {
+		if err := muxer.Write(pid, []byte{0x01, 0x02}, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(audio)
+
+	//节目变化之后立即重发, 版本号加1
+	second, err := muxer.AddProgramStream(1, TS_STREAM_AAC, WithLanguage("deu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(second)
+	if err := muxer.RemoveProgram(2); err != nil {
+		t.Fatal(err)
+	}
+	write(audio)
+	if err := muxer.RemoveStream(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.Write(second, []byte{0x01}, 0, 0); err == nil {
+		t.Errorf("write removed stream should fail")
+	}
+	write(audio)
+
+	sections := parseTSSections(t, packets)
+	var patVersions, pmtVersions, sdtVersions []uint8
+	for _, pat := range sections.pats {
+		patVersions = append(patVersions, pat.Version_number)
+	}
+	for _, pmt := range sections.pmts[0x200] {
+		pmtVersions = append(pmtVersions, pmt.Version_number)
+	}
+	for _, sdt := range sections.sdts {
+		sdtVersions = append(sdtVersions, sdt.Version_number)
+	}
+	if want := []uint8{0, 0, 1, 1}; !reflect.DeepEqual(patVersions, want) {
+		t.Errorf("pat versions = %v, want %v", patVersions, want)
+	}
+	if want := []uint8{0, 1, 1, 2}; !reflect.DeepEqual(pmtVersions, want) {
+		t.Errorf("pmt versions = %v, want %v", pmtVersions, want)
+	}
+	if len(sdtVersions) != 2 {
+		t.Errorf("sdt versions = %v", sdtVersions)
+	}
+}
+
+func TestTSMuxer_LargePmt(t *testing.T) {
+	var packets [][]byte
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, append([]byte{}, pkg...))
+	}
+	if err := muxer.AddProgram(1, WithProgramDescriptors(NewRegistrationDescriptor("GA94", bytes.Repeat([]byte{0xaa}, 200)...))); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.AddProgram(2, WithProgramDescriptors(Descriptor{Tag: 0x80, Data: make([]byte, 256)})); err == nil {
+		t.Errorf("descriptor longer than 255 bytes should fail")
+	}
+	pid, _ := muxer.AddProgramStream(1, TS_STREAM_AAC)
+	if err := muxer.Write(pid, []byte{0x01}, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	sections := parseTSSections(t, packets)
+	pmts := sections.pmts[0x200]
+	if len(pmts) != 1 || len(pmts[0].Descriptors) != 1 || len(pmts[0].Descriptors[0].Data) != 204 || len(pmts[0].Streams) != 1 {
+		t.Fatalf("pmt = %+v", pmts)
+	}
+}
+
+func TestTSMuxer_SectionLengthLimit(t *testing.T) {
+	var packets [][]byte
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, append([]byte{}, pkg...))
+	}
+	large := func() Descriptor { return Descriptor{Tag: 0x80, Data: make([]byte, 255)} }
+	name := string(bytes.Repeat([]byte{'n'}, 240))
+
+	//PMT: 13 + 257*3 + 5 = 789, 再加一个257字节的descriptor超过1021
+	if err := muxer.AddProgram(1, WithProgramDescriptors(large(), large(), large())); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.AddProgram(2, WithProgramDescriptors(large(), large(), large(), large())); err == nil {
+		t.Errorf("AddProgram() with oversized pmt should fail")
+	}
+	pid, err := muxer.AddProgramStream(1, TS_STREAM_AAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := muxer.AddProgramStream(1, TS_STREAM_H264, WithStreamDescriptors(large())); err == nil {
+		t.Errorf("AddProgramStream() with oversized pmt should fail")
+	}
+	//SDT: 每个service 5 + 2 + 3 + 7 + 240 = 257字节, 第4个service超过1021
+	for i := uint16(2); i <= 5; i++ {
+		err := muxer.AddProgram(i, WithService(TS_SERVICE_DIGITAL_TV, "gomedia", name))
+		if (err != nil) != (i == 5) {
+			t.Errorf("AddProgram(%d) error = %v", i, err)
+		}
+	}
+	if muxer.findProgram(5) != nil {
+		t.Errorf("program 5 should not be added")
+	}
+
+	if err := muxer.Write(pid, []byte{0x01}, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	sections := parseTSSections(t, packets)
+	pmts := sections.pmts[0x200]
+	if len(pmts) != 1 || len(pmts[0].Descriptors) != 3 || len(pmts[0].Streams) != 1 || pmts[0].Streams[0].Elementary_PID != pid {
+		t.Fatalf("pmt = %+v", pmts)
+	}
+	if len(sections.sdts) != 1 || len(sections.sdts[0].Services) != 3 {
+		t.Fatalf("sdt = %+v", sections.sdts)
+	}
+}
@@ -17,6 +17,10 @@ const (
     TS_PID_CAT
     TS_PID_TSDT
     TS_PID_IPMP
+    TS_PID_NIT = 0x0010
+    TS_PID_SDT = 0x0011
+    TS_PID_EIT = 0x0012
+    TS_PID_TDT = 0x0014 //TDT和TOT
     TS_PID_Nil = 0x1FFF
 )
 
@@ -24,11 +28,22 @@ const (
 type PAT_TID int
 
 const (
-    TS_TID_PAS       PAT_TID = 0x00 // program_association_section
-    TS_TID_CAS               = 0x01 // conditional_access_section(CA_section)
-    TS_TID_PMS               = 0x02 // TS_program_map_section
-    TS_TID_SDS               = 0x03 //TS_description_section
-    TS_TID_FORBIDDEN PAT_TID = 0xFF
+    TS_TID_PAS                PAT_TID = 0x00 // program_association_section
+    TS_TID_CAS                        = 0x01 // conditional_access_section(CA_section)
+    TS_TID_PMS                        = 0x02 // TS_program_map_section
+    TS_TID_SDS                        = 0x03 //TS_description_section
+    TS_TID_NIT                        = 0x40 //network_information_section - actual_network
+    TS_TID_NIT_OTHER                  = 0x41 //network_information_section - other_network
+    TS_TID_SDT                        = 0x42 //service_description_section - actual_transport_stream
+    TS_TID_SDT_OTHER                  = 0x46 //service_description_section - other_transport_stream
+    TS_TID_EIT_PF                     = 0x4E //event_information_section - actual_transport_stream, present/following
+    TS_TID_EIT_PF_OTHER               = 0x4F //event_information_section - other_transport_stream, present/following
+    TS_TID_EIT_SCHEDULE               = 0x50 //event_information_section - actual_transport_stream, schedule 0x50-0x5F
+    TS_TID_EIT_SCHEDULE_OTHER         = 0x60 //event_information_section - other_transport_stream, schedule 0x60-0x6F
+    TS_TID_TDT                        = 0x70 //time_date_section
+    TS_TID_TOT                        = 0x73 //time_offset_section
+    TS_TID_SCTE35                     = 0xFC //splice_info_section, SCTE 35
+    TS_TID_FORBIDDEN          PAT_TID = 0xFF
 )
 
 type TS_STREAM_TYPE int
@@ -36,9 +51,12 @@ type TS_STREAM_TYPE int
 const (
     TS_STREAM_AUDIO_MPEG1 TS_STREAM_TYPE = 0x03
     TS_STREAM_AUDIO_MPEG2 TS_STREAM_TYPE = 0x04
+    TS_STREAM_PRIVATE     TS_STREAM_TYPE = 0x06 //PES packets containing private data, 通过registration descriptor区分, 例如Opus
     TS_STREAM_AAC         TS_STREAM_TYPE = 0x0F
+    TS_STREAM_AAC_LATM    TS_STREAM_TYPE = 0x11
     TS_STREAM_H264        TS_STREAM_TYPE = 0x1B
     TS_STREAM_H265        TS_STREAM_TYPE = 0x24
+    TS_STREAM_SCTE35      TS_STREAM_TYPE = 0x86 //splice_info_section, 不是PES
 )
 
 const (
@@ -410,10 +428,53 @@ func ReadSection(sectionType PAT_TID, bs *codec.BitStream) (interface{}, error)
             return nil, err
         }
         return pmt, nil
+    case TS_TID_SDT, TS_TID_SDT_OTHER:
+        sdt := NewSdt()
+        if err := sdt.Decode(bs); err != nil {
+            return nil, err
+        }
+        return sdt, nil
+    case TS_TID_NIT, TS_TID_NIT_OTHER:
+        nit := NewNit()
+        if err := nit.Decode(bs); err != nil {
+            return nil, err
+        }
+        return nit, nil
+    case TS_TID_TDT:
+        tdt := NewTdt()
+        if err := tdt.Decode(bs); err != nil {
+            return nil, err
+        }
+        return tdt, nil
+    case TS_TID_TOT:
+        tot := NewTot()
+        if err := tot.Decode(bs); err != nil {
+            return nil, err
+        }
+        return tot, nil
+    case TS_TID_SCTE35:
+        splice := NewSpliceInfoSection()
+        if err := splice.Decode(bs); err != nil {
+            return nil, err
+        }
+        return splice, nil
+    default:
+        //EIT的table_id为一个范围, 0x4E~0x4F present/following, 0x50~0x6F schedule
+        if isEitTableId(uint8(sectionType)) {
+            eit := NewEit()
+            if err := eit.Decode(bs); err != nil {
+                return nil, err
+            }
+            return eit, nil
+        }
     }
     return nil, nil
 }
 
+func isEitTableId(tid uint8) bool {
+    return tid >= uint8(TS_TID_EIT_PF) && tid <= uint8(TS_TID_EIT_SCHEDULE_OTHER)+0x0F
+}
+
 type Pat struct {
     Table_id                 uint8  //8  uimsbf
     Section_syntax_indicator uint8  //1  bslbf
@@ -515,6 +576,7 @@ type StreamPair struct {
     StreamType     uint8  //8 uimsbf
     Elementary_PID uint16 //13 uimsbf
     ES_Info_Length uint16 //12 uimsbf
+    Descriptors    []Descriptor
 }
 
 type Pmt struct {
@@ -528,6 +590,7 @@ type Pmt struct {
     Last_section_number      uint8  //8  uimsbf
     PCR_PID                  uint16 //13 uimsbf
     Program_info_length      uint16 //12 uimsbf
+    Descriptors              []Descriptor
     Streams                  []StreamPair
 }
 
@@ -555,6 +618,8 @@ func (pmt *Pmt) PrettyPrint(file *os.File) {
         file.WriteString(fmt.Sprintf("----stream %d\n", i))
         if stream.StreamType == uint8(TS_STREAM_AAC) {
             file.WriteString("    stream_type:AAC\n")
+        } else if stream.StreamType == uint8(TS_STREAM_AAC_LATM) {
+            file.WriteString("    stream_type:AAC LATM\n")
         } else if stream.StreamType == uint8(TS_STREAM_AUDIO_MPEG1) {
             file.WriteString("    stream_type:MPEG1\n")
         } else if stream.StreamType == uint8(TS_STREAM_AUDIO_MPEG2) {
@@ -563,6 +628,8 @@ func (pmt *Pmt) PrettyPrint(file *os.File) {
             file.WriteString("    stream_type:H264\n")
         } else if stream.StreamType == uint8(TS_STREAM_H265) {
             file.WriteString("    stream_type:H265\n")
+        } else if stream.StreamType == uint8(TS_STREAM_PRIVATE) {
+            file.WriteString("    stream_type:Private\n")
         } else {
             file.WriteString(fmt.Sprintf("    stream_type:UnSupport streamtype:%d\n", stream.StreamType))
         }
@@ -588,15 +655,18 @@ func (pmt *Pmt) Encode(bsw *codec.BitStreamWriter) {
     bsw.PutUint8(0x07, 3)
     bsw.PutUint16(pmt.PCR_PID, 13)
     bsw.PutUint8(0x0f, 4)
-    //TODO Program info length
-    bsw.PutUint16(0x0000 /*pmt.Program_info_length*/, 12)
-    for _, stream := range pmt.Streams {
+    pmt.Program_info_length = descriptorsLength(pmt.Descriptors)
+    bsw.PutUint16(pmt.Program_info_length, 12)
+    encodeDescriptors(bsw, pmt.Descriptors)
+    for i := range pmt.Streams {
+        stream := &pmt.Streams[i]
         bsw.PutUint8(stream.StreamType, 8)
-        bsw.PutUint8(0x00, 3)
+        bsw.PutUint8(0x07, 3)
         bsw.PutUint16(stream.Elementary_PID, 13)
-        bsw.PutUint8(0x00, 4)
-        //TODO ES_info
-        bsw.PutUint8(0 /*ES_info_length*/, 12)
+        bsw.PutUint8(0x0f, 4)
+        stream.ES_Info_Length = descriptorsLength(stream.Descriptors)
+        bsw.PutUint16(stream.ES_Info_Length, 12)
+        encodeDescriptors(bsw, stream.Descriptors)
     }
     length := bsw.DistanceFromMarkDot()
     pmt.Section_length = uint16(length)/8 + 4
@@ -625,8 +695,10 @@ func (pmt *Pmt) Decode(bs *codec.BitStream) error {
     pmt.PCR_PID = bs.Uint16(13)
     bs.SkipBits(4)
     pmt.Program_info_length = bs.Uint16(12)
-    //TODO N loop descriptors
-    bs.SkipBits(int(pmt.Program_info_length) * 8)
+    if bs.RemainBytes() < int(pmt.Program_info_length) {
+        return errors.New("pmt program_info_length out of range")
+    }
+    pmt.Descriptors, _ = decodeDescriptors(bs.GetBytes(int(pmt.Program_info_length)))
     //fmt.Printf("section length %d pmt.Pogram_info_length=%d\n", pmt.Section_length, pmt.Pogram_info_length)
     for i := 0; i < int(pmt.Section_length)-9-int(pmt.Program_info_length)-4; {
         tmp := StreamPair{
@@ -639,10 +711,135 @@ func (pmt *Pmt) Decode(bs *codec.BitStream) error {
         tmp.Elementary_PID = bs.Uint16(13)
         bs.SkipBits(4)
         tmp.ES_Info_Length = bs.Uint16(12)
-        //TODO N loop descriptors
-        bs.SkipBits(int(tmp.ES_Info_Length) * 8)
+        if bs.RemainBytes() < int(tmp.ES_Info_Length) {
+            return errors.New("pmt ES_info_length out of range")
+        }
+        tmp.Descriptors, _ = decodeDescriptors(bs.GetBytes(int(tmp.ES_Info_Length)))
         pmt.Streams = append(pmt.Streams, tmp)
         i += 5 + int(tmp.ES_Info_Length)
     }
     return nil
 }
+
+type SdtService struct {
+    Service_id                 uint16 //16 uimsbf
+    EIT_schedule_flag          uint8  //1  bslbf
+    EIT_present_following_flag uint8  //1  bslbf
+    Running_status             uint8  //3  uimsbf
+    Free_CA_mode               uint8  //1  bslbf
+    Descriptors                []Descriptor
+}
+
+// service_description_section(), ETSI EN 300 468 5.2.3
+type Sdt struct {
+    Table_id                 uint8  //8  uimsbf
+    Section_syntax_indicator uint8  //1  bslbf
+    Section_length           uint16 //12 uimsbf
+    Transport_stream_id      uint16 //16 uimsbf
+    Version_number           uint8  //5  uimsbf
+    Current_next_indicator   uint8  //1  bslbf
+    Section_number           uint8  //8  uimsbf
+    Last_section_number      uint8  //8  uimsbf
+    Original_network_id      uint16 //16 uimsbf
+    Services                 []SdtService
+}
+
+func NewSdt() *Sdt {
+    return &Sdt{
+        Table_id:                 uint8(TS_TID_SDT),
+        Section_syntax_indicator: 1,
+        Current_next_indicator:   1,
+        Services:                 make([]SdtService, 0, 8),
+    }
+}
+
+func (sdt *Sdt) PrettyPrint(file *os.File) {
+    file.WriteString(fmt.Sprintf("Table id:%d\n", sdt.Table_id))
+    file.WriteString(fmt.Sprintf("Section_length:%d\n", sdt.Section_length))
+    file.WriteString(fmt.Sprintf("Transport_stream_id:%d\n", sdt.Transport_stream_id))
+    file.WriteString(fmt.Sprintf("Version_number:%d\n", sdt.Version_number))
+    file.WriteString(fmt.Sprintf("Original_network_id:%d\n", sdt.Original_network_id))
+    for i, service := range sdt.Services {
+        file.WriteString(fmt.Sprintf("----service %d\n", i))
+        file.WriteString(fmt.Sprintf("    service_id:%d\n", service.Service_id))
+        file.WriteString(fmt.Sprintf("    running_status:%d\n", service.Running_status))
+        for _, desc := range service.Descriptors {
+            if stype, provider, name, ok := desc.Service(); ok {
+                file.WriteString(fmt.Sprintf("    service_type:%d provider:%s name:%s\n", stype, provider, name))
+            }
+        }
+    }
+}
+
+func (sdt *Sdt) Encode(bsw *codec.BitStreamWriter) {
+    bsw.PutUint8(sdt.Table_id, 8)
+    loc := bsw.ByteOffset()
+    bsw.PutUint8(sdt.Section_syntax_indicator, 1)
+    bsw.PutUint8(0x01, 1)
+    bsw.PutUint8(0x03, 2)
+    bsw.PutUint16(0, 12)
+    bsw.Markdot()
+    bsw.PutUint16(sdt.Transport_stream_id, 16)
+    bsw.PutUint8(0x03, 2)
+    bsw.PutUint8(sdt.Version_number, 5)
+    bsw.PutUint8(sdt.Current_next_indicator, 1)
+    bsw.PutUint8(sdt.Section_number, 8)
+    bsw.PutUint8(sdt.Last_section_number, 8)
+    bsw.PutUint16(sdt.Original_network_id, 16)
+    bsw.PutUint8(0xff, 8)
+    for _, service := range sdt.Services {
+        bsw.PutUint16(service.Service_id, 16)
+        bsw.PutUint8(0x3f, 6)
+        bsw.PutUint8(service.EIT_schedule_flag, 1)
+        bsw.PutUint8(service.EIT_present_following_flag, 1)
+        bsw.PutUint8(service.Running_status, 3)
+        bsw.PutUint8(service.Free_CA_mode, 1)
+        bsw.PutUint16(descriptorsLength(service.Descriptors), 12)
+        encodeDescriptors(bsw, service.Descriptors)
+    }
+    length := bsw.DistanceFromMarkDot()
+    sdt.Section_length = uint16(length)/8 + 4
+    bsw.SetUint16(sdt.Section_length&0x0FFF|(uint16(sdt.Section_syntax_indicator)<<15)|0x7000, loc)
+    crc := codec.CalcCrc32(0xffffffff, bsw.Bits()[bsw.ByteOffset()-int(sdt.Section_length-4)-3:bsw.ByteOffset()])
+    tmpcrc := make([]byte, 4)
+    binary.LittleEndian.PutUint32(tmpcrc, crc)
+    bsw.PutBytes(tmpcrc)
+}
+
+func (sdt *Sdt) Decode(bs *codec.BitStream) error {
+    sdt.Table_id = bs.Uint8(8)
+    if sdt.Table_id != uint8(TS_TID_SDT) && sdt.Table_id != uint8(TS_TID_SDT_OTHER) {
+        return errors.New("table id is Not TS_TID_SDT")
+    }
+    sdt.Section_syntax_indicator = bs.Uint8(1)
+    bs.SkipBits(3)
+    sdt.Section_length = bs.Uint16(12)
+    if sdt.Section_length < 12 || bs.RemainBytes() < int(sdt.Section_length) {
+        return errors.New("sdt section_length out of range")
+    }
+    sdt.Transport_stream_id = bs.Uint16(16)
+    bs.SkipBits(2)
+    sdt.Version_number = bs.Uint8(5)
+    sdt.Current_next_indicator = bs.Uint8(1)
+    sdt.Section_number = bs.Uint8(8)
+    sdt.Last_section_number = bs.Uint8(8)
+    sdt.Original_network_id = bs.Uint16(16)
+    bs.SkipBits(8)
+    for i := 0; i < int(sdt.Section_length)-8-4; {
+        var service SdtService
+        service.Service_id = bs.Uint16(16)
+        bs.SkipBits(6)
+        service.EIT_schedule_flag = bs.GetBit()
+        service.EIT_present_following_flag = bs.GetBit()
+        service.Running_status = bs.Uint8(3)
+        service.Free_CA_mode = bs.GetBit()
+        length := int(bs.Uint16(12))
+        if i+5+length > int(sdt.Section_length)-8-4 {
+            return errors.New("sdt descriptors_loop_length out of range")
+        }
+        service.Descriptors, _ = decodeDescriptors(bs.GetBytes(length))
+        sdt.Services = append(sdt.Services, service)
+        i += 5 + length
+    }
+    return nil
+}
@@ -0,0 +1,156 @@
+package mpeg2
+
+import (
+	"errors"
+	"io"
+)
+
+const (
+	TS_M2TS_PACKET_SIZE = 192 //4字节TP_extra_header + 188
+	TS_DVB_PACKET_SIZE  = 204 //188 + 16字节Reed-Solomon
+
+	tsSyncCount = 5 //连续几个同步字节才认为找到了包边界
+)
+
+var ErrTSSyncLost = errors.New("ts sync byte lost")
+
+// 按188/192/204字节切分ts包, 同步字节丢失后重新同步
+// 每次对齐到0x47, 192字节的TP_extra_header落在上一个包的末尾, 204字节的RS校验字节落在包的末尾
+type tsPacketReader struct {
+	r        io.Reader
+	buf      []byte
+	start    int
+	size     int
+	locked   bool
+	eof      bool
+	synced   bool
+	pkt      [TS_PAKCET_SIZE]byte
+	onResync func(skipped int)
+}
+
+func newTSPacketReader(r io.Reader) *tsPacketReader {
+	return &tsPacketReader{r: r, buf: make([]byte, 0, 64*TS_DVB_PACKET_SIZE)}
+}
+
+func (reader *tsPacketReader) pending() []byte {
+	return reader.buf[reader.start:]
+}
+
+func (reader *tsPacketReader) skip(n int) {
+	reader.start += n
+}
+
+// 保证至少有n个字节, 除非读到结尾
+func (reader *tsPacketReader) fill(n int) error {
+	for len(reader.buf)-reader.start < n && !reader.eof {
+		if reader.start > 0 {
+			remain := copy(reader.buf, reader.buf[reader.start:])
+			reader.buf = reader.buf[:remain]
+			reader.start = 0
+		}
+		if cap(reader.buf)-len(reader.buf) < n {
+			tmp := make([]byte, len(reader.buf), len(reader.buf)+n)
+			copy(tmp, reader.buf)
+			reader.buf = tmp
+		}
+		m, err := reader.r.Read(reader.buf[len(reader.buf):cap(reader.buf)])
+		reader.buf = reader.buf[:len(reader.buf)+m]
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				reader.eof = true
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (reader *tsPacketReader) checkSync(data []byte, pos int, size int) bool {
+	count := 0
+	for ; pos < len(data); pos += size {
+		if data[pos] != 0x47 {
+			return false
+		}
+		if count++; count == tsSyncCount {
+			return true
+		}
+	}
+	//文件结尾不足tsSyncCount个包
+	return reader.eof && pos-size+TS_PAKCET_SIZE <= len(data)
+}
+
+func (reader *tsPacketReader) sync() error {
+	skipped := 0
+	defer func() {
+		if reader.synced && skipped > 0 && reader.onResync != nil {
+			reader.onResync(skipped)
+		}
+	}()
+	sizes := []int{TS_PAKCET_SIZE, TS_M2TS_PACKET_SIZE, TS_DVB_PACKET_SIZE}
+	if reader.size > 0 {
+		sizes = append([]int{reader.size}, sizes...)
+	}
+	for {
+		if err := reader.fill(TS_DVB_PACKET_SIZE * (tsSyncCount + 1)); err != nil {
+			return err
+		}
+		data := reader.pending()
+		if len(data) < TS_PAKCET_SIZE {
+			reader.skip(len(data))
+			skipped += len(data)
+			return io.EOF
+		}
+		for i := 0; i < TS_DVB_PACKET_SIZE && i < len(data); i++ {
+			if data[i] != 0x47 {
+				continue
+			}
+			for _, size := range sizes {
+				if reader.checkSync(data, i, size) {
+					reader.skip(i)
+					skipped += i
+					reader.size = size
+					return nil
+				}
+			}
+		}
+		n := TS_DVB_PACKET_SIZE
+		if n > len(data) {
+			n = len(data)
+		}
+		reader.skip(n)
+		skipped += n
+	}
+}
+
+// 返回的数据在下一次调用之前有效
+func (reader *tsPacketReader) next() ([]byte, error) {
+	for {
+		if !reader.locked {
+			if err := reader.sync(); err != nil {
+				return nil, err
+			}
+			reader.locked = true
+			reader.synced = true
+		}
+		if err := reader.fill(reader.size); err != nil {
+			return nil, err
+		}
+		data := reader.pending()
+		if len(data) < TS_PAKCET_SIZE {
+			reader.skip(len(data))
+			return nil, io.EOF
+		}
+		if data[0] != 0x47 {
+			reader.locked = false
+			continue
+		}
+		copy(reader.pkt[:], data[:TS_PAKCET_SIZE])
+		if len(data) < reader.size {
+			reader.skip(len(data))
+		} else {
+			reader.skip(reader.size)
+		}
+		return reader.pkt[:], nil
+	}
+}
@@ -0,0 +1,465 @@
+package mpeg2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+// SCTE 35 splice_command_type
+const (
+	SCTE35_SPLICE_NULL           uint8 = 0x00
+	SCTE35_SPLICE_SCHEDULE       uint8 = 0x04
+	SCTE35_SPLICE_INSERT         uint8 = 0x05
+	SCTE35_TIME_SIGNAL           uint8 = 0x06
+	SCTE35_BANDWIDTH_RESERVATION uint8 = 0x07
+	SCTE35_PRIVATE_COMMAND       uint8 = 0xFF
+)
+
+// splice_descriptor_tag
+const (
+	SCTE35_AVAIL_DESCRIPTOR        uint8 = 0x00
+	SCTE35_DTMF_DESCRIPTOR         uint8 = 0x01
+	SCTE35_SEGMENTATION_DESCRIPTOR uint8 = 0x02
+	SCTE35_TIME_DESCRIPTOR         uint8 = 0x03
+
+	SCTE35_IDENTIFIER uint32 = 0x43554549 //"CUEI"
+)
+
+// segmentation_type_id, SCTE 35 Table 22
+const (
+	SCTE35_SEGMENTATION_PROGRAM_START                        uint8 = 0x10
+	SCTE35_SEGMENTATION_PROGRAM_END                          uint8 = 0x11
+	SCTE35_SEGMENTATION_CHAPTER_START                        uint8 = 0x20
+	SCTE35_SEGMENTATION_CHAPTER_END                          uint8 = 0x21
+	SCTE35_SEGMENTATION_PROVIDER_ADVERTISEMENT_START         uint8 = 0x30
+	SCTE35_SEGMENTATION_PROVIDER_ADVERTISEMENT_END           uint8 = 0x31
+	SCTE35_SEGMENTATION_DISTRIBUTOR_ADVERTISEMENT_START      uint8 = 0x32
+	SCTE35_SEGMENTATION_DISTRIBUTOR_ADVERTISEMENT_END        uint8 = 0x33
+	SCTE35_SEGMENTATION_PROVIDER_PLACEMENT_OPPORTUNITY_START uint8 = 0x34
+	SCTE35_SEGMENTATION_PROVIDER_PLACEMENT_OPPORTUNITY_END   uint8 = 0x35
+)
+
+// splice_time(), Time_specified_flag为0时表示立即执行
+type SpliceTime struct {
+	Time_specified_flag uint8  //1  bslbf
+	Pts_time            uint64 //33 uimsbf, 90KHz
+}
+
+func (st *SpliceTime) encode(bsw *codec.BitStreamWriter) {
+	bsw.PutUint8(st.Time_specified_flag, 1)
+	if st.Time_specified_flag == 1 {
+		bsw.PutUint8(0x3F, 6)
+		bsw.PutUint64(st.Pts_time, 33)
+	} else {
+		bsw.PutUint8(0x7F, 7)
+	}
+}
+
+func (st *SpliceTime) decode(bs *codec.BitStream) {
+	st.Time_specified_flag = bs.GetBit()
+	if st.Time_specified_flag == 1 {
+		bs.SkipBits(6)
+		st.Pts_time = bs.GetBits(33)
+	} else {
+		bs.SkipBits(7)
+	}
+}
+
+type SpliceComponent struct {
+	Component_tag uint8
+	Splice_time   SpliceTime //Splice_immediate_flag为1时没有
+}
+
+// splice_insert(), SCTE 35 9.7.3
+type SpliceInsert struct {
+	Splice_event_id               uint32 //32 uimsbf
+	Splice_event_cancel_indicator uint8  //1  bslbf
+	Out_of_network_indicator      uint8  //1  bslbf
+	Program_splice_flag           uint8  //1  bslbf
+	Duration_flag                 uint8  //1  bslbf
+	Splice_immediate_flag         uint8  //1  bslbf
+	Splice_time                   SpliceTime
+	Components                    []SpliceComponent
+	Auto_return                   uint8  //1  bslbf
+	Break_duration                uint64 //33 uimsbf, 90KHz
+	Unique_program_id             uint16 //16 uimsbf
+	Avail_num                     uint8  //8  uimsbf
+	Avails_expected               uint8  //8  uimsbf
+}
+
+func (insert *SpliceInsert) encode(bsw *codec.BitStreamWriter) {
+	bsw.PutUint32(insert.Splice_event_id, 32)
+	bsw.PutUint8(insert.Splice_event_cancel_indicator, 1)
+	bsw.PutUint8(0x7F, 7)
+	if insert.Splice_event_cancel_indicator == 1 {
+		return
+	}
+	bsw.PutUint8(insert.Out_of_network_indicator, 1)
+	bsw.PutUint8(insert.Program_splice_flag, 1)
+	bsw.PutUint8(insert.Duration_flag, 1)
+	bsw.PutUint8(insert.Splice_immediate_flag, 1)
+	bsw.PutUint8(0x0F, 4)
+	if insert.Program_splice_flag == 1 && insert.Splice_immediate_flag == 0 {
+		insert.Splice_time.encode(bsw)
+	}
+	if insert.Program_splice_flag == 0 {
+		bsw.PutUint8(uint8(len(insert.Components)), 8)
+		for i := range insert.Components {
+			bsw.PutUint8(insert.Components[i].Component_tag, 8)
+			if insert.Splice_immediate_flag == 0 {
+				insert.Components[i].Splice_time.encode(bsw)
+			}
+		}
+	}
+	if insert.Duration_flag == 1 {
+		bsw.PutUint8(insert.Auto_return, 1)
+		bsw.PutUint8(0x3F, 6)
+		bsw.PutUint64(insert.Break_duration, 33)
+	}
+	bsw.PutUint16(insert.Unique_program_id, 16)
+	bsw.PutUint8(insert.Avail_num, 8)
+	bsw.PutUint8(insert.Avails_expected, 8)
+}
+
+func (insert *SpliceInsert) decode(bs *codec.BitStream) {
+	insert.Splice_event_id = bs.Uint32(32)
+	insert.Splice_event_cancel_indicator = bs.GetBit()
+	bs.SkipBits(7)
+	if insert.Splice_event_cancel_indicator == 1 {
+		return
+	}
+	insert.Out_of_network_indicator = bs.GetBit()
+	insert.Program_splice_flag = bs.GetBit()
+	insert.Duration_flag = bs.GetBit()
+	insert.Splice_immediate_flag = bs.GetBit()
+	bs.SkipBits(4)
+	if insert.Program_splice_flag == 1 && insert.Splice_immediate_flag == 0 {
+		insert.Splice_time.decode(bs)
+	}
+	if insert.Program_splice_flag == 0 {
+		count := int(bs.Uint8(8))
+		for i := 0; i < count; i++ {
+			var component SpliceComponent
+			component.Component_tag = bs.Uint8(8)
+			if insert.Splice_immediate_flag == 0 {
+				component.Splice_time.decode(bs)
+			}
+			insert.Components = append(insert.Components, component)
+		}
+	}
+	if insert.Duration_flag == 1 {
+		insert.Auto_return = bs.GetBit()
+		bs.SkipBits(6)
+		insert.Break_duration = bs.GetBits(33)
+	}
+	insert.Unique_program_id = bs.Uint16(16)
+	insert.Avail_num = bs.Uint8(8)
+	insert.Avails_expected = bs.Uint8(8)
+}
+
+// splice_descriptor(), Data为identifier之后的数据
+type SpliceDescriptor struct {
+	Tag        uint8
+	Identifier uint32
+	Data       []byte
+}
+
+type SegmentationComponent struct {
+	Component_tag uint8
+	Pts_offset    uint64 //33 uimsbf
+}
+
+// segmentation_descriptor(), SCTE 35 10.3.3
+type SegmentationDescriptor struct {
+	Segmentation_event_id               uint32 //32 uimsbf
+	Segmentation_event_cancel_indicator uint8  //1  bslbf
+	Program_segmentation_flag           uint8  //1  bslbf
+	Segmentation_duration_flag          uint8  //1  bslbf
+	Delivery_not_restricted_flag        uint8  //1  bslbf
+	Web_delivery_allowed_flag           uint8  //1  bslbf
+	No_regional_blackout_flag           uint8  //1  bslbf
+	Archive_allowed_flag                uint8  //1  bslbf
+	Device_restrictions                 uint8  //2  bslbf
+	Components                          []SegmentationComponent
+	Segmentation_duration               uint64 //40 uimsbf, 90KHz
+	Segmentation_upid_type              uint8  //8  uimsbf
+	Segmentation_upid                   []byte
+	Segmentation_type_id                uint8 //8  uimsbf
+	Segment_num                         uint8 //8  uimsbf
+	Segments_expected                   uint8 //8  uimsbf
+	Sub_segment_num                     uint8 //8  uimsbf, 只有placement opportunity类型有
+	Sub_segments_expected               uint8 //8  uimsbf
+}
+
+func hasSubSegment(typeId uint8) bool {
+	return typeId == 0x34 || typeId == 0x36 || typeId == 0x38 || typeId == 0x3A || typeId == 0x44 || typeId == 0x46
+}
+
+func (seg *SegmentationDescriptor) SpliceDescriptor() SpliceDescriptor {
+	bsw := codec.NewBitStreamWriter(32 + len(seg.Segmentation_upid))
+	bsw.PutUint32(seg.Segmentation_event_id, 32)
+	bsw.PutUint8(seg.Segmentation_event_cancel_indicator, 1)
+	bsw.PutUint8(0x7F, 7)
+	if seg.Segmentation_event_cancel_indicator == 0 {
+		bsw.PutUint8(seg.Program_segmentation_flag, 1)
+		bsw.PutUint8(seg.Segmentation_duration_flag, 1)
+		bsw.PutUint8(seg.Delivery_not_restricted_flag, 1)
+		if seg.Delivery_not_restricted_flag == 0 {
+			bsw.PutUint8(seg.Web_delivery_allowed_flag, 1)
+			bsw.PutUint8(seg.No_regional_blackout_flag, 1)
+			bsw.PutUint8(seg.Archive_allowed_flag, 1)
+			bsw.PutUint8(seg.Device_restrictions, 2)
+		} else {
+			bsw.PutUint8(0x1F, 5)
+		}
+		if seg.Program_segmentation_flag == 0 {
+			bsw.PutUint8(uint8(len(seg.Components)), 8)
+			for _, component := range seg.Components {
+				bsw.PutUint8(component.Component_tag, 8)
+				bsw.PutUint8(0x7F, 7)
+				bsw.PutUint64(component.Pts_offset, 33)
+			}
+		}
+		if seg.Segmentation_duration_flag == 1 {
+			bsw.PutUint64(seg.Segmentation_duration, 40)
+		}
+		bsw.PutUint8(seg.Segmentation_upid_type, 8)
+		bsw.PutUint8(uint8(len(seg.Segmentation_upid)), 8)
+		bsw.PutBytes(seg.Segmentation_upid)
+		bsw.PutUint8(seg.Segmentation_type_id, 8)
+		bsw.PutUint8(seg.Segment_num, 8)
+		bsw.PutUint8(seg.Segments_expected, 8)
+		if hasSubSegment(seg.Segmentation_type_id) {
+			bsw.PutUint8(seg.Sub_segment_num, 8)
+			bsw.PutUint8(seg.Sub_segments_expected, 8)
+		}
+	}
+	return SpliceDescriptor{Tag: SCTE35_SEGMENTATION_DESCRIPTOR, Identifier: SCTE35_IDENTIFIER, Data: bsw.Bits()}
+}
+
+func (desc *SpliceDescriptor) Segmentation() (seg *SegmentationDescriptor, err error) {
+	if desc.Tag != SCTE35_SEGMENTATION_DESCRIPTOR || desc.Identifier != SCTE35_IDENTIFIER {
+		return nil, errors.New("not a segmentation_descriptor")
+	}
+	if len(desc.Data) < 5 {
+		return nil, errors.New("segmentation_descriptor too short")
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			seg, err = nil, errors.New("segmentation_descriptor length out of range")
+		}
+	}()
+	seg = new(SegmentationDescriptor)
+	bs := codec.NewBitStream(desc.Data)
+	seg.Segmentation_event_id = bs.Uint32(32)
+	seg.Segmentation_event_cancel_indicator = bs.GetBit()
+	bs.SkipBits(7)
+	if seg.Segmentation_event_cancel_indicator == 1 {
+		return seg, nil
+	}
+	seg.Program_segmentation_flag = bs.GetBit()
+	seg.Segmentation_duration_flag = bs.GetBit()
+	seg.Delivery_not_restricted_flag = bs.GetBit()
+	if seg.Delivery_not_restricted_flag == 0 {
+		seg.Web_delivery_allowed_flag = bs.GetBit()
+		seg.No_regional_blackout_flag = bs.GetBit()
+		seg.Archive_allowed_flag = bs.GetBit()
+		seg.Device_restrictions = bs.Uint8(2)
+	} else {
+		bs.SkipBits(5)
+	}
+	if seg.Program_segmentation_flag == 0 {
+		count := int(bs.Uint8(8))
+		for i := 0; i < count; i++ {
+			var component SegmentationComponent
+			component.Component_tag = bs.Uint8(8)
+			bs.SkipBits(7)
+			component.Pts_offset = bs.GetBits(33)
+			seg.Components = append(seg.Components, component)
+		}
+	}
+	if seg.Segmentation_duration_flag == 1 {
+		seg.Segmentation_duration = bs.GetBits(40)
+	}
+	seg.Segmentation_upid_type = bs.Uint8(8)
+	length := int(bs.Uint8(8))
+	if bs.RemainBytes() < length+3 {
+		return nil, errors.New("segmentation_upid_length out of range")
+	}
+	seg.Segmentation_upid = append([]byte{}, bs.GetBytes(length)...)
+	seg.Segmentation_type_id = bs.Uint8(8)
+	seg.Segment_num = bs.Uint8(8)
+	seg.Segments_expected = bs.Uint8(8)
+	if hasSubSegment(seg.Segmentation_type_id) && bs.RemainBytes() >= 2 {
+		seg.Sub_segment_num = bs.Uint8(8)
+		seg.Sub_segments_expected = bs.Uint8(8)
+	}
+	return seg, nil
+}
+
+// splice_info_section(), SCTE 35 9.6, section_syntax_indicator为0但是有CRC_32
+// 不支持加密的section
+type SpliceInfoSection struct {
+	Table_id                 uint8  //8  uimsbf
+	Section_syntax_indicator uint8  //1  bslbf
+	Private_indicator        uint8  //1  bslbf
+	Sap_type                 uint8  //2  bslbf
+	Section_length           uint16 //12 uimsbf
+	Protocol_version         uint8  //8  uimsbf
+	Encrypted_packet         uint8  //1  bslbf
+	Encryption_algorithm     uint8  //6  bslbf
+	Pts_adjustment           uint64 //33 uimsbf
+	Cw_index                 uint8  //8  uimsbf
+	Tier                     uint16 //12 bslbf
+	Splice_command_type      uint8  //8  uimsbf
+	Splice_insert            *SpliceInsert
+	Time_signal              *SpliceTime
+	Splice_command           []byte //其他splice_command的原始数据
+	Descriptors              []SpliceDescriptor
+}
+
+func NewSpliceInfoSection() *SpliceInfoSection {
+	return &SpliceInfoSection{
+		Table_id:            uint8(TS_TID_SCTE35),
+		Sap_type:            0x03, //not specified
+		Tier:                0xFFF,
+		Splice_command_type: SCTE35_SPLICE_NULL,
+	}
+}
+
+func (splice *SpliceInfoSection) PrettyPrint(file *os.File) {
+	file.WriteString(fmt.Sprintf("Table id:%d\n", splice.Table_id))
+	file.WriteString(fmt.Sprintf("Pts_adjustment:%d\n", splice.Pts_adjustment))
+	file.WriteString(fmt.Sprintf("Splice_command_type:%d\n", splice.Splice_command_type))
+	if splice.Splice_insert != nil {
+		file.WriteString(fmt.Sprintf("Splice_insert:%+v\n", *splice.Splice_insert))
+	}
+	if splice.Time_signal != nil {
+		file.WriteString(fmt.Sprintf("Time_signal:%+v\n", *splice.Time_signal))
+	}
+	for _, desc := range splice.Descriptors {
+		if seg, err := desc.Segmentation(); err == nil {
+			file.WriteString(fmt.Sprintf("Segmentation_descriptor:%+v\n", *seg))
+		}
+	}
+}
+
+func (splice *SpliceInfoSection) encodeCommand() []byte {
+	bsw := codec.NewBitStreamWriter(32)
+	switch splice.Splice_command_type {
+	case SCTE35_SPLICE_INSERT:
+		if splice.Splice_insert != nil {
+			splice.Splice_insert.encode(bsw)
+		}
+	case SCTE35_TIME_SIGNAL:
+		if splice.Time_signal != nil {
+			splice.Time_signal.encode(bsw)
+		}
+	case SCTE35_SPLICE_NULL, SCTE35_BANDWIDTH_RESERVATION:
+	default:
+		bsw.PutBytes(splice.Splice_command)
+	}
+	return bsw.Bits()
+}
+
+func (splice *SpliceInfoSection) Encode(bsw *codec.BitStreamWriter) {
+	loc := beginSection(bsw, splice.Table_id)
+	bsw.PutUint8(splice.Protocol_version, 8)
+	bsw.PutUint8(0, 1) //encrypted_packet
+	bsw.PutUint8(splice.Encryption_algorithm, 6)
+	bsw.PutUint64(splice.Pts_adjustment, 33)
+	bsw.PutUint8(splice.Cw_index, 8)
+	bsw.PutUint16(splice.Tier, 12)
+	command := splice.encodeCommand()
+	bsw.PutUint16(uint16(len(command)), 12)
+	bsw.PutUint8(splice.Splice_command_type, 8)
+	bsw.PutBytes(command)
+	loopLength := 0
+	for _, desc := range splice.Descriptors {
+		loopLength += 6 + len(desc.Data)
+	}
+	bsw.PutUint16(uint16(loopLength), 16)
+	for _, desc := range splice.Descriptors {
+		bsw.PutUint8(desc.Tag, 8)
+		bsw.PutUint8(uint8(4+len(desc.Data)), 8)
+		bsw.PutUint32(desc.Identifier, 32)
+		bsw.PutBytes(desc.Data)
+	}
+	flags := uint16(splice.Section_syntax_indicator)<<15 | uint16(splice.Private_indicator)<<14 | uint16(splice.Sap_type&0x03)<<12
+	splice.Section_length = endSection(bsw, loc, flags, true)
+}
+
+func (splice *SpliceInfoSection) Decode(bs *codec.BitStream) (err error) {
+	splice.Table_id = bs.Uint8(8)
+	if splice.Table_id != uint8(TS_TID_SCTE35) {
+		return errors.New("table id is Not TS_TID_SCTE35")
+	}
+	splice.Section_syntax_indicator = bs.GetBit()
+	splice.Private_indicator = bs.GetBit()
+	splice.Sap_type = bs.Uint8(2)
+	splice.Section_length = bs.Uint16(12)
+	if splice.Section_length < 17 || bs.RemainBytes() < int(splice.Section_length) {
+		return errors.New("splice_info_section section_length out of range")
+	}
+	splice.Protocol_version = bs.Uint8(8)
+	splice.Encrypted_packet = bs.GetBit()
+	splice.Encryption_algorithm = bs.Uint8(6)
+	if splice.Encrypted_packet == 1 {
+		return errors.New("encrypted splice_info_section is not supported")
+	}
+	splice.Pts_adjustment = bs.GetBits(33)
+	splice.Cw_index = bs.Uint8(8)
+	splice.Tier = bs.Uint16(12)
+	commandLength := int(bs.Uint16(12))
+	splice.Splice_command_type = bs.Uint8(8)
+	remain := int(splice.Section_length) - 11 - 4
+	if commandLength > remain-2 {
+		return errors.New("splice_command_length out of range")
+	}
+	command := bs.GetBytes(commandLength)
+	remain -= commandLength
+	if err = splice.decodeCommand(command); err != nil {
+		return err
+	}
+	loopLength := int(bs.Uint16(16))
+	if remain -= 2; loopLength > remain {
+		return errors.New("descriptor_loop_length out of range")
+	}
+	data := bs.GetBytes(loopLength)
+	for len(data) > 0 {
+		if len(data) < 6 || len(data) < 2+int(data[1]) || data[1] < 4 {
+			return errors.New("splice_descriptor length out of range")
+		}
+		splice.Descriptors = append(splice.Descriptors, SpliceDescriptor{
+			Tag:        data[0],
+			Identifier: uint32(data[2])<<24 | uint32(data[3])<<16 | uint32(data[4])<<8 | uint32(data[5]),
+			Data:       append([]byte{}, data[6:2+int(data[1])]...),
+		})
+		data = data[2+int(data[1]):]
+	}
+	return nil
+}
+
+func (splice *SpliceInfoSection) decodeCommand(command []byte) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.New("splice_command length out of range")
+		}
+	}()
+	bs := codec.NewBitStream(command)
+	switch splice.Splice_command_type {
+	case SCTE35_SPLICE_INSERT:
+		splice.Splice_insert = new(SpliceInsert)
+		splice.Splice_insert.decode(bs)
+	case SCTE35_TIME_SIGNAL:
+		splice.Time_signal = new(SpliceTime)
+		splice.Time_signal.decode(bs)
+	case SCTE35_SPLICE_NULL, SCTE35_BANDWIDTH_RESERVATION:
+	default:
+		splice.Splice_command = append([]byte{}, command...)
+	}
+	return nil
+}
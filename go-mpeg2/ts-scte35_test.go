@@ -0,0 +1,239 @@
+package mpeg2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+// SCTE 35 14.1 time_signal和14.2 splice_insert的示例
+func TestSpliceInfoSection_Decode(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		check func(t *testing.T, splice *SpliceInfoSection)
+	}{
+		{
+			name: "splice_insert",
+			data: "/DAvAAAAAAAA///wFAVIAACPf+/+c2nALv4AUsz1AAAAAAAKAAhDVUVJAAABNWLbowo=",
+			check: func(t *testing.T, splice *SpliceInfoSection) {
+				want := &SpliceInsert{
+					Splice_event_id:          0x4800008F,
+					Out_of_network_indicator: 1,
+					Program_splice_flag:      1,
+					Duration_flag:            1,
+					Splice_time:              SpliceTime{Time_specified_flag: 1, Pts_time: 0x07369C02E},
+					Auto_return:              1,
+					Break_duration:           0x0052CCF5,
+				}
+				if splice.Splice_command_type != SCTE35_SPLICE_INSERT || !reflect.DeepEqual(splice.Splice_insert, want) {
+					t.Errorf("splice_insert = %+v", splice.Splice_insert)
+				}
+				if len(splice.Descriptors) != 1 || splice.Descriptors[0].Tag != SCTE35_AVAIL_DESCRIPTOR || !bytes.Equal(splice.Descriptors[0].Data, []byte{0x00, 0x00, 0x01, 0x35}) {
+					t.Errorf("descriptors = %+v", splice.Descriptors)
+				}
+			},
+		},
+		{
+			name: "time_signal",
+			data: "/DA0AAAAAAAA///wBQb+cr0AUAAeAhxDVUVJSAAAjn/PAAGlmbAICAAAAAAsoKGKNAIAmsnRfg==",
+			check: func(t *testing.T, splice *SpliceInfoSection) {
+				if splice.Splice_command_type != SCTE35_TIME_SIGNAL || *splice.Time_signal != (SpliceTime{Time_specified_flag: 1, Pts_time: 0x072BD0050}) {
+					t.Errorf("time_signal = %+v", splice.Time_signal)
+				}
+				seg, err := splice.Descriptors[0].Segmentation()
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := &SegmentationDescriptor{
+					Segmentation_event_id:      0x4800008E,
+					Program_segmentation_flag:  1,
+					Segmentation_duration_flag: 1,
+					No_regional_blackout_flag:  1,
+					Archive_allowed_flag:       1,
+					Device_restrictions:        3,
+					Segmentation_duration:      0x0001A599B0,
+					Segmentation_upid_type:     0x08,
+					Segmentation_upid:          []byte{0x00, 0x00, 0x00, 0x00, 0x2C, 0xA0, 0xA1, 0x8A},
+					Segmentation_type_id:       SCTE35_SEGMENTATION_PROVIDER_PLACEMENT_OPPORTUNITY_START,
+					Segment_num:                2,
+				}
+				if !reflect.DeepEqual(seg, want) {
+					t.Errorf("segmentation = %+v", seg)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := base64.StdEncoding.DecodeString(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !checkSectionCrc(data) {
+				t.Errorf("crc mismatch")
+			}
+			got, err := ReadSection(TS_TID_SCTE35, codec.NewBitStream(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			splice := got.(*SpliceInfoSection)
+			tt.check(t, splice)
+			//重新编码之后和原始数据一致
+			if encoded := encodeSection(splice); !bytes.Equal(encoded, data) {
+				t.Errorf("encode = %x\nwant     %x", encoded, data)
+			}
+		})
+	}
+}
+
+func TestSpliceInfoSection_EncodeDecode(t *testing.T) {
+	seg := &SegmentationDescriptor{
+		Segmentation_event_id:        7,
+		Delivery_not_restricted_flag: 1,
+		Components:                   []SegmentationComponent{{Component_tag: 1, Pts_offset: 900}, {Component_tag: 2}},
+		Segmentation_upid_type:       0x09,
+		Segmentation_upid:            []byte("SIGNAL:abc"),
+		Segmentation_type_id:         SCTE35_SEGMENTATION_PROVIDER_PLACEMENT_OPPORTUNITY_START,
+		Segment_num:                  1,
+		Segments_expected:            2,
+		Sub_segment_num:              1,
+		Sub_segments_expected:        4,
+	}
+	tests := []struct {
+		name   string
+		splice *SpliceInfoSection
+	}{
+		{"splice_null", NewSpliceInfoSection()},
+		{"component splice_insert", func() *SpliceInfoSection {
+			splice := NewSpliceInfoSection()
+			splice.Pts_adjustment = 1 << 32
+			splice.Splice_command_type = SCTE35_SPLICE_INSERT
+			splice.Splice_insert = &SpliceInsert{
+				Splice_event_id: 1,
+				Components: []SpliceComponent{
+					{Component_tag: 1, Splice_time: SpliceTime{Time_specified_flag: 1, Pts_time: 90000}},
+					{Component_tag: 2},
+				},
+				Unique_program_id: 10,
+				Avail_num:         1,
+				Avails_expected:   2,
+			}
+			return splice
+		}()},
+		{"cancel", func() *SpliceInfoSection {
+			splice := NewSpliceInfoSection()
+			splice.Splice_command_type = SCTE35_SPLICE_INSERT
+			splice.Splice_insert = &SpliceInsert{Splice_event_id: 2, Splice_event_cancel_indicator: 1}
+			return splice
+		}()},
+		{"time_signal segmentation", func() *SpliceInfoSection {
+			splice := NewSpliceInfoSection()
+			splice.Splice_command_type = SCTE35_TIME_SIGNAL
+			splice.Time_signal = &SpliceTime{Time_specified_flag: 1, Pts_time: 1<<33 - 1}
+			splice.Descriptors = []SpliceDescriptor{seg.SpliceDescriptor()}
+			return splice
+		}()},
+		{"private command", func() *SpliceInfoSection {
+			splice := NewSpliceInfoSection()
+			splice.Splice_command_type = SCTE35_PRIVATE_COMMAND
+			splice.Splice_command = []byte{'A', 'B', 'C', 'D', 0x01}
+			return splice
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section := encodeSection(tt.splice)
+			got, err := ReadSection(TS_TID_SCTE35, codec.NewBitStream(section))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !checkSectionCrc(section) || !reflect.DeepEqual(got, tt.splice) {
+				t.Errorf("got %+v\nwant %+v", got, tt.splice)
+			}
+		})
+	}
+	desc := seg.SpliceDescriptor()
+	if got, err := desc.Segmentation(); err != nil || !reflect.DeepEqual(got, seg) {
+		t.Errorf("segmentation = %+v, %v", got, err)
+	}
+	desc.Data = desc.Data[:20]
+	if _, err := desc.Segmentation(); err == nil {
+		t.Errorf("truncated segmentation_descriptor should fail")
+	}
+}
+
+func TestTSMuxer_WriteSpliceInfo(t *testing.T) {
+	var packets []byte
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, pkg...)
+	}
+	audio := muxer.AddStream(TS_STREAM_AAC)
+	cue, err := muxer.AddProgramStream(1, TS_STREAM_SCTE35, WithStreamPid(0x500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	splice := NewSpliceInfoSection()
+	splice.Splice_command_type = SCTE35_SPLICE_INSERT
+	splice.Splice_insert = &SpliceInsert{
+		Splice_event_id:          100,
+		Out_of_network_indicator: 1,
+		Program_splice_flag:      1,
+		Duration_flag:            1,
+		Splice_time:              SpliceTime{Time_specified_flag: 1, Pts_time: 40 * 90},
+		Auto_return:              1,
+		Break_duration:           30 * 90000,
+	}
+	if err := muxer.WriteSpliceInfo(cue, splice); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.WriteSpliceInfo(audio, splice); err == nil {
+		t.Errorf("write splice_info_section to audio pid should fail")
+	}
+	if err := muxer.Write(cue, []byte{0x01}, 0, 0); err == nil {
+		t.Errorf("write pes to scte35 pid should fail")
+	}
+	for i := 0; i < 3; i++ {
+		if err := muxer.Write(audio, bytes.Repeat([]byte{0x11}, 100), uint64(i*40), uint64(i*40)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var splices []*SpliceInfoSection
+	var pmt *Pmt
+	demuxer := NewTSDemuxer()
+	demuxer.OnTable = func(pid uint16, table interface{}) {
+		switch table := table.(type) {
+		case *SpliceInfoSection:
+			if pid != cue {
+				t.Errorf("splice_info_section on pid %d", pid)
+			}
+			splices = append(splices, table)
+		case *Pmt:
+			pmt = table
+		}
+	}
+	frames := 0
+	demuxer.OnFrame = func(cid TS_STREAM_TYPE, frame []byte, pts uint64, dts uint64) {
+		frames++
+	}
+	if err := demuxer.Input(bytes.NewReader(packets)); err != nil {
+		t.Fatal(err)
+	}
+	if len(splices) != 1 || !reflect.DeepEqual(splices[0], splice) {
+		t.Errorf("splices = %+v", splices)
+	}
+	if frames != 3 {
+		t.Errorf("got %d frames", frames)
+	}
+	if pmt == nil || len(pmt.Descriptors) != 1 || len(pmt.Streams) != 2 || pmt.Streams[1].StreamType != uint8(TS_STREAM_SCTE35) {
+		t.Fatalf("pmt = %+v", pmt)
+	}
+	if format, _ := pmt.Descriptors[0].FormatIdentifier(); format != "CUEI" {
+		t.Errorf("pmt registration = %q", format)
+	}
+}
@@ -0,0 +1,94 @@
+package mpeg2
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+const TS_MAX_SECTION_LENGTH = 4096
+
+var (
+	ErrTSSectionCRC       = errors.New("ts section crc mismatch")
+	ErrTSSectionTruncated = errors.New("ts section truncated")
+)
+
+// 拼接跨越多个ts包的section, 一个ts包中也可能有多个section
+type sectionBuffer struct {
+	data    []byte
+	started bool
+}
+
+func (buf *sectionBuffer) reset() {
+	buf.data = buf.data[:0]
+	buf.started = false
+}
+
+// 完整section的长度, 不足3个字节时返回0
+func sectionLength(data []byte) int {
+	if len(data) < 3 {
+		return 0
+	}
+	return 3 + (int(data[1]&0x0F)<<8 | int(data[2]))
+}
+
+// payload为ts包去掉包头和adaptation_field之后的数据, 每拼出一个完整的section调用一次onSection
+func (buf *sectionBuffer) feed(payload []byte, start bool, onSection func(section []byte)) error {
+	var err error
+	if start {
+		pointer := int(payload[0])
+		if pointer+1 > len(payload) {
+			buf.reset()
+			return errors.New("pointer_field out of range")
+		}
+		if buf.started {
+			buf.data = append(buf.data, payload[1:1+pointer]...)
+			if n := sectionLength(buf.data); n > 0 && n <= len(buf.data) {
+				onSection(buf.data[:n])
+			} else {
+				err = ErrTSSectionTruncated
+			}
+		}
+		buf.reset()
+		payload = payload[1+pointer:]
+		//一个section结束后如果下一个字节不是0xff, 那么紧接着是新的section
+		for len(payload) > 0 && payload[0] != 0xff {
+			n := sectionLength(payload)
+			if n == 0 || n > len(payload) {
+				buf.data = append(buf.data, payload...)
+				buf.started = true
+				break
+			}
+			onSection(payload[:n])
+			payload = payload[n:]
+		}
+		return err
+	}
+	if !buf.started {
+		return nil
+	}
+	buf.data = append(buf.data, payload...)
+	n := sectionLength(buf.data)
+	if n > TS_MAX_SECTION_LENGTH {
+		buf.reset()
+		return errors.New("section length out of range")
+	}
+	if n > 0 && n <= len(buf.data) {
+		onSection(buf.data[:n])
+		buf.reset()
+	}
+	return nil
+}
+
+// section_syntax_indicator为0的section没有CRC_32, TOT和SCTE 35除外
+func checkSectionCrc(section []byte) bool {
+	if section[1]&0x80 == 0 && section[0] != uint8(TS_TID_TOT) && section[0] != uint8(TS_TID_SCTE35) {
+		return true
+	}
+	if len(section) < 7 {
+		return false
+	}
+	n := len(section)
+	return codec.CalcCrc32(0xffffffff, section[:n-4]) == binary.LittleEndian.Uint32(section[n-4:])
+}
@@ -0,0 +1,394 @@
+package mpeg2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+// DVB SI, ETSI EN 300 468
+
+// 写入table_id和占位的section_length, 返回section_length所在的位置
+func beginSection(bsw *codec.BitStreamWriter, tableId uint8) int {
+	bsw.PutUint8(tableId, 8)
+	loc := bsw.ByteOffset()
+	bsw.PutUint16(0, 16)
+	bsw.Markdot()
+	return loc
+}
+
+// 回填section_length, flags为section_length前面的4个bit, withCrc时在末尾写入CRC_32
+func endSection(bsw *codec.BitStreamWriter, loc int, flags uint16, withCrc bool) uint16 {
+	length := uint16(bsw.DistanceFromMarkDot() / 8)
+	if withCrc {
+		length += 4
+	}
+	bsw.SetUint16(length&0x0FFF|flags, loc)
+	if withCrc {
+		crc := codec.CalcCrc32(0xffffffff, bsw.Bits()[bsw.ByteOffset()-int(length-4)-3:bsw.ByteOffset()])
+		tmpcrc := make([]byte, 4)
+		binary.LittleEndian.PutUint32(tmpcrc, crc)
+		bsw.PutBytes(tmpcrc)
+	}
+	return length
+}
+
+// 读取table_id和section_length, 检查table_id是否在[minTid, maxTid]之间
+func decodeSectionHeader(bs *codec.BitStream, minTid, maxTid uint8, minLength int) (tableId uint8, syntax uint8, length uint16, err error) {
+	tableId = bs.Uint8(8)
+	if tableId < minTid || tableId > maxTid {
+		return tableId, 0, 0, fmt.Errorf("unexpected table id %#x", tableId)
+	}
+	syntax = bs.Uint8(1)
+	bs.SkipBits(3)
+	length = bs.Uint16(12)
+	if int(length) < minLength || bs.RemainBytes() < int(length) {
+		return tableId, syntax, length, fmt.Errorf("table %#x section_length out of range", tableId)
+	}
+	return
+}
+
+func decodeDescriptorLoop(bs *codec.BitStream, remain *int) ([]Descriptor, error) {
+	length := int(bs.Uint16(12))
+	*remain -= 2
+	if length > *remain {
+		return nil, errors.New("descriptors_loop_length out of range")
+	}
+	*remain -= length
+	return decodeDescriptors(bs.GetBytes(length))
+}
+
+func toBCD(v int) uint8 {
+	return uint8(v/10%10<<4 | v%10)
+}
+
+func fromBCD(v uint8) int {
+	return int(v>>4)*10 + int(v&0x0F)
+}
+
+// 16位MJD + 24位BCD编码的UTC时分秒, 零值编码为全1(未定义)
+func encodeMJDTime(bsw *codec.BitStreamWriter, t time.Time) {
+	if t.IsZero() {
+		bsw.PutUint64(0xFFFFFFFFFF, 40)
+		return
+	}
+	t = t.UTC()
+	bsw.PutUint16(uint16(t.Unix()/86400+40587), 16)
+	bsw.PutUint8(toBCD(t.Hour()), 8)
+	bsw.PutUint8(toBCD(t.Minute()), 8)
+	bsw.PutUint8(toBCD(t.Second()), 8)
+}
+
+func decodeMJDTime(bs *codec.BitStream) time.Time {
+	v := bs.GetBits(40)
+	if v == 0xFFFFFFFFFF {
+		return time.Time{}
+	}
+	mjd := int64(v >> 24)
+	seconds := int64(fromBCD(uint8(v>>16))*3600 + fromBCD(uint8(v>>8))*60 + fromBCD(uint8(v)))
+	return time.Unix((mjd-40587)*86400+seconds, 0).UTC()
+}
+
+// 24位BCD编码的时分秒
+func encodeBCDDuration(bsw *codec.BitStreamWriter, d time.Duration) {
+	seconds := int(d / time.Second)
+	bsw.PutUint8(toBCD(seconds/3600), 8)
+	bsw.PutUint8(toBCD(seconds/60%60), 8)
+	bsw.PutUint8(toBCD(seconds%60), 8)
+}
+
+func decodeBCDDuration(bs *codec.BitStream) time.Duration {
+	h, m, s := fromBCD(bs.Uint8(8)), fromBCD(bs.Uint8(8)), fromBCD(bs.Uint8(8))
+	return time.Duration(h*3600+m*60+s) * time.Second
+}
+
+// network_information_section(), 5.2.1
+type Nit struct {
+	Table_id                 uint8  //8  uimsbf
+	Section_syntax_indicator uint8  //1  bslbf
+	Section_length           uint16 //12 uimsbf
+	Network_id               uint16 //16 uimsbf
+	Version_number           uint8  //5  uimsbf
+	Current_next_indicator   uint8  //1  bslbf
+	Section_number           uint8  //8  uimsbf
+	Last_section_number      uint8  //8  uimsbf
+	Descriptors              []Descriptor
+	Streams                  []NitTransportStream
+}
+
+type NitTransportStream struct {
+	Transport_stream_id uint16 //16 uimsbf
+	Original_network_id uint16 //16 uimsbf
+	Descriptors         []Descriptor
+}
+
+func NewNit() *Nit {
+	return &Nit{
+		Table_id:                 uint8(TS_TID_NIT),
+		Section_syntax_indicator: 1,
+		Current_next_indicator:   1,
+	}
+}
+
+func (nit *Nit) PrettyPrint(file *os.File) {
+	file.WriteString(fmt.Sprintf("Table id:%d\n", nit.Table_id))
+	file.WriteString(fmt.Sprintf("Network_id:%d\n", nit.Network_id))
+	file.WriteString(fmt.Sprintf("Version_number:%d\n", nit.Version_number))
+	for _, desc := range nit.Descriptors {
+		if name, ok := desc.NetworkName(); ok {
+			file.WriteString(fmt.Sprintf("Network_name:%s\n", name))
+		}
+	}
+	for i, ts := range nit.Streams {
+		file.WriteString(fmt.Sprintf("----transport stream %d\n", i))
+		file.WriteString(fmt.Sprintf("    transport_stream_id:%d\n", ts.Transport_stream_id))
+		file.WriteString(fmt.Sprintf("    original_network_id:%d\n", ts.Original_network_id))
+	}
+}
+
+func (nit *Nit) Encode(bsw *codec.BitStreamWriter) {
+	loc := beginSection(bsw, nit.Table_id)
+	bsw.PutUint16(nit.Network_id, 16)
+	bsw.PutUint8(0x03, 2)
+	bsw.PutUint8(nit.Version_number, 5)
+	bsw.PutUint8(nit.Current_next_indicator, 1)
+	bsw.PutUint8(nit.Section_number, 8)
+	bsw.PutUint8(nit.Last_section_number, 8)
+	bsw.PutUint8(0x0F, 4)
+	bsw.PutUint16(descriptorsLength(nit.Descriptors), 12)
+	encodeDescriptors(bsw, nit.Descriptors)
+	loopLength := 0
+	for _, ts := range nit.Streams {
+		loopLength += 6 + int(descriptorsLength(ts.Descriptors))
+	}
+	bsw.PutUint8(0x0F, 4)
+	bsw.PutUint16(uint16(loopLength), 12)
+	for _, ts := range nit.Streams {
+		bsw.PutUint16(ts.Transport_stream_id, 16)
+		bsw.PutUint16(ts.Original_network_id, 16)
+		bsw.PutUint8(0x0F, 4)
+		bsw.PutUint16(descriptorsLength(ts.Descriptors), 12)
+		encodeDescriptors(bsw, ts.Descriptors)
+	}
+	nit.Section_length = endSection(bsw, loc, uint16(nit.Section_syntax_indicator)<<15|0x7000, true)
+}
+
+func (nit *Nit) Decode(bs *codec.BitStream) (err error) {
+	if nit.Table_id, nit.Section_syntax_indicator, nit.Section_length, err = decodeSectionHeader(bs, uint8(TS_TID_NIT), uint8(TS_TID_NIT_OTHER), 13); err != nil {
+		return err
+	}
+	nit.Network_id = bs.Uint16(16)
+	bs.SkipBits(2)
+	nit.Version_number = bs.Uint8(5)
+	nit.Current_next_indicator = bs.Uint8(1)
+	nit.Section_number = bs.Uint8(8)
+	nit.Last_section_number = bs.Uint8(8)
+	bs.SkipBits(4)
+	remain := int(nit.Section_length) - 5 - 4
+	if nit.Descriptors, err = decodeDescriptorLoop(bs, &remain); err != nil {
+		return err
+	}
+	bs.SkipBits(4)
+	loopLength := int(bs.Uint16(12))
+	if remain -= 2; loopLength > remain {
+		return errors.New("nit transport_stream_loop_length out of range")
+	}
+	for loopLength >= 6 {
+		var ts NitTransportStream
+		ts.Transport_stream_id = bs.Uint16(16)
+		ts.Original_network_id = bs.Uint16(16)
+		bs.SkipBits(4)
+		loopLength -= 4
+		if ts.Descriptors, err = decodeDescriptorLoop(bs, &loopLength); err != nil {
+			return err
+		}
+		nit.Streams = append(nit.Streams, ts)
+	}
+	return nil
+}
+
+// event_information_section(), 5.2.4
+type Eit struct {
+	Table_id                    uint8  //8  uimsbf
+	Section_syntax_indicator    uint8  //1  bslbf
+	Section_length              uint16 //12 uimsbf
+	Service_id                  uint16 //16 uimsbf
+	Version_number              uint8  //5  uimsbf
+	Current_next_indicator      uint8  //1  bslbf
+	Section_number              uint8  //8  uimsbf
+	Last_section_number         uint8  //8  uimsbf
+	Transport_stream_id         uint16 //16 uimsbf
+	Original_network_id         uint16 //16 uimsbf
+	Segment_last_section_number uint8  //8  uimsbf
+	Last_table_id               uint8  //8  uimsbf
+	Events                      []EitEvent
+}
+
+type EitEvent struct {
+	Event_id       uint16        //16 uimsbf
+	Start_time     time.Time     //40 bslbf, UTC, 零值表示未定义
+	Duration       time.Duration //24 uimsbf
+	Running_status uint8         //3  uimsbf
+	Free_CA_mode   uint8         //1  bslbf
+	Descriptors    []Descriptor
+}
+
+// 默认为present/following, 0号section为当前节目, 1号section为下一个节目
+func NewEit() *Eit {
+	return &Eit{
+		Table_id:                 uint8(TS_TID_EIT_PF),
+		Section_syntax_indicator: 1,
+		Current_next_indicator:   1,
+		Last_table_id:            uint8(TS_TID_EIT_PF),
+	}
+}
+
+func (eit *Eit) IsPresentFollowing() bool {
+	return eit.Table_id == uint8(TS_TID_EIT_PF) || eit.Table_id == uint8(TS_TID_EIT_PF_OTHER)
+}
+
+func (eit *Eit) PrettyPrint(file *os.File) {
+	file.WriteString(fmt.Sprintf("Table id:%d\n", eit.Table_id))
+	file.WriteString(fmt.Sprintf("Service_id:%d\n", eit.Service_id))
+	file.WriteString(fmt.Sprintf("Version_number:%d\n", eit.Version_number))
+	file.WriteString(fmt.Sprintf("Section_number:%d\n", eit.Section_number))
+	for i, event := range eit.Events {
+		file.WriteString(fmt.Sprintf("----event %d\n", i))
+		file.WriteString(fmt.Sprintf("    event_id:%d\n", event.Event_id))
+		file.WriteString(fmt.Sprintf("    start_time:%s duration:%s\n", event.Start_time.Format(time.RFC3339), event.Duration))
+		for _, desc := range event.Descriptors {
+			if lang, name, text, ok := desc.ShortEvent(); ok {
+				file.WriteString(fmt.Sprintf("    language:%s name:%s text:%s\n", lang, name, text))
+			}
+		}
+	}
+}
+
+func (eit *Eit) Encode(bsw *codec.BitStreamWriter) {
+	loc := beginSection(bsw, eit.Table_id)
+	bsw.PutUint16(eit.Service_id, 16)
+	bsw.PutUint8(0x03, 2)
+	bsw.PutUint8(eit.Version_number, 5)
+	bsw.PutUint8(eit.Current_next_indicator, 1)
+	bsw.PutUint8(eit.Section_number, 8)
+	bsw.PutUint8(eit.Last_section_number, 8)
+	bsw.PutUint16(eit.Transport_stream_id, 16)
+	bsw.PutUint16(eit.Original_network_id, 16)
+	bsw.PutUint8(eit.Segment_last_section_number, 8)
+	bsw.PutUint8(eit.Last_table_id, 8)
+	for _, event := range eit.Events {
+		bsw.PutUint16(event.Event_id, 16)
+		encodeMJDTime(bsw, event.Start_time)
+		encodeBCDDuration(bsw, event.Duration)
+		bsw.PutUint8(event.Running_status, 3)
+		bsw.PutUint8(event.Free_CA_mode, 1)
+		bsw.PutUint16(descriptorsLength(event.Descriptors), 12)
+		encodeDescriptors(bsw, event.Descriptors)
+	}
+	eit.Section_length = endSection(bsw, loc, uint16(eit.Section_syntax_indicator)<<15|0x7000, true)
+}
+
+func (eit *Eit) Decode(bs *codec.BitStream) (err error) {
+	if eit.Table_id, eit.Section_syntax_indicator, eit.Section_length, err = decodeSectionHeader(bs, uint8(TS_TID_EIT_PF), uint8(TS_TID_EIT_SCHEDULE_OTHER)+0x0F, 15); err != nil {
+		return err
+	}
+	eit.Service_id = bs.Uint16(16)
+	bs.SkipBits(2)
+	eit.Version_number = bs.Uint8(5)
+	eit.Current_next_indicator = bs.Uint8(1)
+	eit.Section_number = bs.Uint8(8)
+	eit.Last_section_number = bs.Uint8(8)
+	eit.Transport_stream_id = bs.Uint16(16)
+	eit.Original_network_id = bs.Uint16(16)
+	eit.Segment_last_section_number = bs.Uint8(8)
+	eit.Last_table_id = bs.Uint8(8)
+	remain := int(eit.Section_length) - 11 - 4
+	for remain >= 12 {
+		var event EitEvent
+		event.Event_id = bs.Uint16(16)
+		event.Start_time = decodeMJDTime(bs)
+		event.Duration = decodeBCDDuration(bs)
+		event.Running_status = bs.Uint8(3)
+		event.Free_CA_mode = bs.GetBit()
+		remain -= 10
+		if event.Descriptors, err = decodeDescriptorLoop(bs, &remain); err != nil {
+			return err
+		}
+		eit.Events = append(eit.Events, event)
+	}
+	return nil
+}
+
+// time_date_section(), 5.2.5, 没有CRC_32
+type Tdt struct {
+	Table_id                 uint8     //8  uimsbf
+	Section_syntax_indicator uint8     //1  bslbf
+	Section_length           uint16    //12 uimsbf
+	UTC_time                 time.Time //40 bslbf
+}
+
+func NewTdt() *Tdt {
+	return &Tdt{Table_id: uint8(TS_TID_TDT)}
+}
+
+func (tdt *Tdt) PrettyPrint(file *os.File) {
+	file.WriteString(fmt.Sprintf("Table id:%d\n", tdt.Table_id))
+	file.WriteString(fmt.Sprintf("UTC_time:%s\n", tdt.UTC_time.Format(time.RFC3339)))
+}
+
+func (tdt *Tdt) Encode(bsw *codec.BitStreamWriter) {
+	loc := beginSection(bsw, tdt.Table_id)
+	encodeMJDTime(bsw, tdt.UTC_time)
+	tdt.Section_length = endSection(bsw, loc, 0x7000, false)
+}
+
+func (tdt *Tdt) Decode(bs *codec.BitStream) (err error) {
+	if tdt.Table_id, tdt.Section_syntax_indicator, tdt.Section_length, err = decodeSectionHeader(bs, uint8(TS_TID_TDT), uint8(TS_TID_TDT), 5); err != nil {
+		return err
+	}
+	tdt.UTC_time = decodeMJDTime(bs)
+	return nil
+}
+
+// time_offset_section(), 5.2.6, section_syntax_indicator为0但是有CRC_32
+type Tot struct {
+	Table_id                 uint8     //8  uimsbf
+	Section_syntax_indicator uint8     //1  bslbf
+	Section_length           uint16    //12 uimsbf
+	UTC_time                 time.Time //40 bslbf
+	Descriptors              []Descriptor
+}
+
+func NewTot() *Tot {
+	return &Tot{Table_id: uint8(TS_TID_TOT)}
+}
+
+func (tot *Tot) PrettyPrint(file *os.File) {
+	file.WriteString(fmt.Sprintf("Table id:%d\n", tot.Table_id))
+	file.WriteString(fmt.Sprintf("UTC_time:%s\n", tot.UTC_time.Format(time.RFC3339)))
+	file.WriteString(fmt.Sprintf("Descriptors:%d\n", len(tot.Descriptors)))
+}
+
+func (tot *Tot) Encode(bsw *codec.BitStreamWriter) {
+	loc := beginSection(bsw, tot.Table_id)
+	encodeMJDTime(bsw, tot.UTC_time)
+	bsw.PutUint8(0x0F, 4)
+	bsw.PutUint16(descriptorsLength(tot.Descriptors), 12)
+	encodeDescriptors(bsw, tot.Descriptors)
+	tot.Section_length = endSection(bsw, loc, 0x7000, true)
+}
+
+func (tot *Tot) Decode(bs *codec.BitStream) (err error) {
+	if tot.Table_id, tot.Section_syntax_indicator, tot.Section_length, err = decodeSectionHeader(bs, uint8(TS_TID_TOT), uint8(TS_TID_TOT), 11); err != nil {
+		return err
+	}
+	tot.UTC_time = decodeMJDTime(bs)
+	bs.SkipBits(4)
+	remain := int(tot.Section_length) - 5 - 4
+	tot.Descriptors, err = decodeDescriptorLoop(bs, &remain)
+	return err
+}
@@ -0,0 +1,154 @@
+package mpeg2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+type siTable interface {
+	Encode(bsw *codec.BitStreamWriter)
+}
+
+func encodeSection(table siTable) []byte {
+	bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
+	table.Encode(bsw)
+	return bsw.Bits()
+}
+
+func TestSITable_EncodeDecode(t *testing.T) {
+	start := time.Date(2024, 3, 9, 20, 15, 30, 0, time.UTC)
+	nit := NewNit()
+	nit.Network_id = 0x3001
+	nit.Version_number = 3
+	nit.Descriptors = []Descriptor{NewNetworkNameDescriptor("gomedia net")}
+	nit.Streams = []NitTransportStream{
+		{Transport_stream_id: 1, Original_network_id: 0x3001, Descriptors: []Descriptor{{Tag: 0x41, Data: []byte{0x00, 0x01, 0x01}}}},
+		{Transport_stream_id: 2, Original_network_id: 0x3001},
+	}
+	eit := NewEit()
+	eit.Service_id = 1
+	eit.Transport_stream_id = 1
+	eit.Original_network_id = 0x3001
+	eit.Last_section_number = 1
+	eit.Events = []EitEvent{
+		{Event_id: 100, Start_time: start, Duration: 90 * time.Minute, Running_status: 4, Descriptors: []Descriptor{NewShortEventDescriptor("eng", "News", "Evening news")}},
+		{Event_id: 101, Duration: 45*time.Minute + 30*time.Second, Running_status: 1},
+	}
+	schedule := NewEit()
+	schedule.Table_id = uint8(TS_TID_EIT_SCHEDULE) + 1
+	schedule.Last_table_id = uint8(TS_TID_EIT_SCHEDULE) + 1
+	scheduleOther := NewEit()
+	scheduleOther.Table_id = uint8(TS_TID_EIT_SCHEDULE_OTHER) + 0x0F
+	scheduleOther.Last_table_id = uint8(TS_TID_EIT_SCHEDULE_OTHER) + 0x0F
+	scheduleOther.Events = []EitEvent{{Event_id: 200, Start_time: start, Duration: time.Hour, Running_status: 1}}
+	tdt := NewTdt()
+	tdt.UTC_time = start
+	tot := NewTot()
+	tot.UTC_time = start
+	tot.Descriptors = []Descriptor{{Tag: 0x58, Data: []byte{'G', 'B', 'R', 0x02, 0x00, 0x00, 0xe5, 0x4d, 0x01, 0x00, 0x00, 0x01, 0x00}}}
+
+	tests := []struct {
+		name  string
+		tid   PAT_TID
+		table siTable
+		crc   bool
+	}{
+		{"nit", TS_TID_NIT, nit, true},
+		{"eit", TS_TID_EIT_PF, eit, true},
+		{"eit schedule", TS_TID_EIT_SCHEDULE + 1, schedule, true},
+		{"eit schedule other", TS_TID_EIT_SCHEDULE_OTHER + 0x0F, scheduleOther, true},
+		{"tdt", TS_TID_TDT, tdt, false},
+		{"tot", TS_TID_TOT, tot, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section := encodeSection(tt.table)
+			if sectionLength(section) != len(section) {
+				t.Fatalf("section_length %d, encoded %d bytes", sectionLength(section), len(section))
+			}
+			if !checkSectionCrc(section) {
+				t.Errorf("crc mismatch")
+			}
+			if tt.crc {
+				section[len(section)-1] ^= 0xff
+				if checkSectionCrc(section) {
+					t.Errorf("corrupted crc passed")
+				}
+				section[len(section)-1] ^= 0xff
+			}
+			got, err := ReadSection(tt.tid, codec.NewBitStream(section))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.table) {
+				t.Errorf("got %+v\nwant %+v", got, tt.table)
+			}
+		})
+	}
+
+	if name, ok := nit.Descriptors[0].NetworkName(); !ok || name != "gomedia net" {
+		t.Errorf("network name = %q", name)
+	}
+	if lang, name, text, ok := eit.Events[0].Descriptors[0].ShortEvent(); !ok || lang != "eng" || name != "News" || text != "Evening news" {
+		t.Errorf("short event = %q %q %q", lang, name, text)
+	}
+	if !eit.IsPresentFollowing() || schedule.IsPresentFollowing() {
+		t.Errorf("present/following flag")
+	}
+}
+
+func TestMJDTime(t *testing.T) {
+	//ETSI EN 300 468 Annex C: 93/10/13 12:45:00 编码为 0xC079124500
+	bs := codec.NewBitStream([]byte{0xC0, 0x79, 0x12, 0x45, 0x00})
+	if got, want := decodeMJDTime(bs), time.Date(1993, 10, 13, 12, 45, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("decode = %v, want %v", got, want)
+	}
+	bsw := codec.NewBitStreamWriter(5)
+	encodeMJDTime(bsw, time.Date(1993, 10, 13, 12, 45, 0, 0, time.UTC))
+	if want := []byte{0xC0, 0x79, 0x12, 0x45, 0x00}; !reflect.DeepEqual(bsw.Bits(), want) {
+		t.Errorf("encode = %x, want %x", bsw.Bits(), want)
+	}
+}
+
+func TestTSDemuxer_OnTable(t *testing.T) {
+	var packets []byte
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		packets = append(packets, pkg...)
+	}
+	pid := muxer.AddStream(TS_STREAM_AAC)
+	if err := muxer.Write(pid, []byte{0x01, 0x02}, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	nit := NewNit()
+	nit.Descriptors = []Descriptor{NewNetworkNameDescriptor("net")}
+	eit := NewEit()
+	eit.Events = []EitEvent{{Event_id: 1, Duration: time.Hour, Descriptors: []Descriptor{NewShortEventDescriptor("eng", "a", "b")}}}
+	tdt := NewTdt()
+	tdt.UTC_time = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var cc [4]uint8
+	muxer.writeSection(TS_PID_NIT, &cc[0], encodeSection(nit))
+	muxer.writeSection(TS_PID_EIT, &cc[1], encodeSection(eit))
+	muxer.writeSection(TS_PID_TDT, &cc[2], encodeSection(tdt))
+	//EIT pid上的TDT不会被解析
+	muxer.writeSection(TS_PID_EIT, &cc[1], encodeSection(NewTdt()))
+
+	var tables []interface{}
+	demuxer := NewTSDemuxer()
+	demuxer.OnTable = func(p uint16, table interface{}) {
+		switch table.(type) {
+		case *Nit, *Eit, *Tdt:
+			tables = append(tables, table)
+		}
+	}
+	if err := demuxer.Input(bytes.NewReader(packets)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{nit, eit, tdt}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables = %+v, want %+v", tables, want)
+	}
+}
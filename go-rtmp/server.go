@@ -208,7 +208,7 @@ func (server *RtmpServerHandle) Input(data []byte) error {
 func (server *RtmpServerHandle) WriteFrame(cid codec.CodecID, frame []byte, pts, dts uint32) error {
     if cid == codec.CODECID_AUDIO_AAC || cid == codec.CODECID_AUDIO_G711A || cid == codec.CODECID_AUDIO_G711U {
         return server.WriteAudio(cid, frame, pts, dts)
-    } else if cid == codec.CODECID_VIDEO_H264 || cid == codec.CODECID_VIDEO_H265 {
+    } else if cid == codec.CODECID_VIDEO_H264 || cid == codec.CODECID_VIDEO_H265 || cid == codec.CODECID_VIDEO_AV1 {
         return server.WriteVideo(cid, frame, pts, dts)
     } else {
         return errors.New("unsupport codec id")
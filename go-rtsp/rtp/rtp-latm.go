@@ -0,0 +1,154 @@
+package rtp
+
+import (
+    "bytes"
+    "errors"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+// RFC6416 MP4A-LATM
+// 每个rtp包的payload由一个或多个AudioMuxElement组成, 一个AudioMuxElement也可以分片到多个rtp包中,
+// marker=1表示AudioMuxElement结束
+// cpresent=0时StreamMuxConfig通过sdp fmtp中的config传输, AudioMuxElement(0)
+// cpresent=1时StreamMuxConfig在AudioMuxElement(1)中带内传输
+
+type LATMPacker struct {
+    CommPacker
+    pt       uint8
+    ssrc     uint32
+    sequence uint16
+}
+
+// 只支持cpresent=0
+func NewLATMPacker(pt uint8, ssrc uint32, sequence uint16, mtu int) *LATMPacker {
+    return &LATMPacker{
+        pt:         pt,
+        ssrc:       ssrc,
+        sequence:   sequence,
+        CommPacker: CommPacker{mtu: mtu},
+    }
+}
+
+// data为raw aac, 如果带有adts头会先去掉adts头
+func (packer *LATMPacker) Pack(data []byte, timestamp uint32) error {
+    if len(data) >= 7 && codec.FindSyncword(data, 0) == 0 {
+        adts := codec.NewAdtsFrameHeader()
+        adts.Decode(data)
+        if adts.Fix_Header.Protection_absent == 1 {
+            data = data[7:]
+        } else {
+            data = data[9:]
+        }
+    }
+    element := make([]byte, 0, len(data)+len(data)/255+1)
+    length := len(data)
+    for length >= 0xFF {
+        element = append(element, 0xFF)
+        length -= 0xFF
+    }
+    element = append(element, uint8(length))
+    element = append(element, data...)
+
+    for len(element) > 0 {
+        pkg := RtpPacket{}
+        pkg.Header.PayloadType = packer.pt
+        pkg.Header.SequenceNumber = packer.sequence
+        pkg.Header.SSRC = packer.ssrc
+        pkg.Header.Timestamp = timestamp
+        size := packer.mtu - RTP_FIX_HEAD_LEN
+        if len(element) <= size {
+            size = len(element)
+            pkg.Header.Marker = 1
+        }
+        pkg.Payload = element[:size]
+        element = element[size:]
+        packer.sequence++
+        if packer.onRtp != nil {
+            packer.onRtp(&pkg)
+        }
+        if packer.onPacket != nil {
+            if err := packer.onPacket(pkg.Encode()); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+type LATMUnPacker struct {
+    CommUnPacker
+    cpresent     bool
+    decoder      *codec.LATMDecoder
+    timestamp    uint32
+    lastSequence uint16
+    lost         bool
+    frameBuffer  *bytes.Buffer
+}
+
+// config为sdp fmtp中的StreamMuxConfig, cpresent=1时可以为nil
+func NewLATMUnPacker(cpresent bool, config []byte) (*LATMUnPacker, error) {
+    unpacker := &LATMUnPacker{
+        cpresent:    cpresent,
+        decoder:     codec.NewLATMDecoder(nil),
+        frameBuffer: new(bytes.Buffer),
+    }
+    if len(config) > 0 {
+        smc := &codec.StreamMuxConfig{}
+        if err := smc.Decode(config); err != nil {
+            return nil, err
+        }
+        unpacker.decoder.Config = smc
+    } else if !cpresent {
+        return nil, errors.New("mp4a-latm with cpresent=0 need StreamMuxConfig")
+    }
+    return unpacker, nil
+}
+
+// 输出adts格式的aac
+func (unpacker *LATMUnPacker) UnPack(pkt []byte) error {
+    pkg := &RtpPacket{}
+    if err := pkg.Decode(pkt); err != nil {
+        return err
+    }
+
+    if unpacker.onRtp != nil {
+        unpacker.onRtp(pkg)
+    }
+
+    // 上一个AudioMuxElement的最后一个分片丢失
+    if unpacker.frameBuffer.Len() > 0 && unpacker.timestamp != pkg.Header.Timestamp {
+        unpacker.frameBuffer.Reset()
+    }
+    if unpacker.frameBuffer.Len() == 0 {
+        unpacker.lost = false
+    } else if unpacker.lastSequence+1 != pkg.Header.SequenceNumber {
+        unpacker.lost = true
+    }
+    unpacker.timestamp = pkg.Header.Timestamp
+    unpacker.lastSequence = pkg.Header.SequenceNumber
+    unpacker.frameBuffer.Write(pkg.Payload)
+    if pkg.Header.Marker == 0 {
+        return nil
+    }
+    defer unpacker.frameBuffer.Reset()
+    if unpacker.lost {
+        return nil
+    }
+    frames, err := unpacker.decoder.DecodeAudioMuxElements(unpacker.frameBuffer.Bytes(), unpacker.cpresent)
+    if err != nil {
+        return err
+    }
+    asc := unpacker.decoder.AudioSpecificConfig()
+    for _, frame := range frames {
+        adtsHdr, err := codec.ConvertASCToADTS(asc, len(frame)+7)
+        if err != nil {
+            return err
+        }
+        adts := append(adtsHdr.Encode(), frame...)
+        if unpacker.onFrame != nil {
+            unpacker.onFrame(adts, unpacker.timestamp, false)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,89 @@
+package rtp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+func TestLATM_PackUnPack(t *testing.T) {
+	asc := []byte{0x12, 0x10}
+	smc, err := codec.NewStreamMuxConfig(asc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adts := func(frame []byte) []byte {
+		hdr, err := codec.ConvertASCToADTS(asc, len(frame)+7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(hdr.Encode(), frame...)
+	}
+	small := []byte{0x01, 0x02, 0x03}
+	large := bytes.Repeat([]byte{0x21}, 600)
+	tests := []struct {
+		name    string
+		frames  [][]byte
+		input   func(frame []byte) []byte
+		mtu     int
+		packets int
+		drop    int //丢弃的rtp包序号, -1不丢包
+		want    [][]byte
+	}{
+		{name: "single packet", frames: [][]byte{small, small}, mtu: 1400, packets: 2, drop: -1, want: [][]byte{small, small}},
+		{name: "fragmented", frames: [][]byte{large, small}, mtu: 212, packets: 5, drop: -1, want: [][]byte{large, small}},
+		{name: "adts input", frames: [][]byte{small, large}, input: adts, mtu: 1400, packets: 2, drop: -1, want: [][]byte{small, large}},
+		{name: "lost fragment", frames: [][]byte{large, small}, mtu: 212, packets: 5, drop: 1, want: [][]byte{small}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var packets [][]byte
+			packer := NewLATMPacker(97, 0x1234, 100, tt.mtu)
+			packer.OnPacket(func(pkt []byte) error {
+				packets = append(packets, append([]byte{}, pkt...))
+				return nil
+			})
+			for i, frame := range tt.frames {
+				if tt.input != nil {
+					frame = tt.input(frame)
+				}
+				if err := packer.Pack(frame, uint32(i*1024)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(packets) != tt.packets {
+				t.Fatalf("Pack() got %d packets, want %d", len(packets), tt.packets)
+			}
+			for _, pkt := range packets {
+				if len(pkt) > tt.mtu {
+					t.Errorf("packet size %d exceeds mtu %d", len(pkt), tt.mtu)
+				}
+			}
+
+			unpacker, err := NewLATMUnPacker(false, smc.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][]byte
+			unpacker.OnFrame(func(frame []byte, timestamp uint32, lost bool) {
+				if !bytes.Equal(frame[:7], adts(frame[7:])[:7]) {
+					t.Errorf("adts header = %x", frame[:7])
+				}
+				got = append(got, frame[7:])
+			})
+			for i, pkt := range packets {
+				if i == tt.drop {
+					continue
+				}
+				if err := unpacker.UnPack(pkt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnPack() got %d frames, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ const (
     RTSP_CODEC_G711U
     RTSP_CODEC_PS
     RTSP_CODEC_TS
+    RTSP_CODEC_AAC_LATM //mp4a-latm/mpeg4-latm, 之前和mpeg4-generic一样返回RTSP_CODEC_AAC, 解包之后同样输出adts
 )
 
 type RtspCodec struct {
@@ -30,8 +31,10 @@ func GetCodecIdByEncodeName(name string) RTSP_CODEC_ID {
         return RTSP_CODEC_H264
     case "h265":
         return RTSP_CODEC_H265
-    case "mpeg4-generic", "mpeg4-latm":
+    case "mpeg4-generic":
         return RTSP_CODEC_AAC
+    case "mp4a-latm", "mpeg4-latm":
+        return RTSP_CODEC_AAC_LATM
     case "pcmu":
         return RTSP_CODEC_G711A
     case "pcma":
@@ -58,6 +61,8 @@ func GetEncodeNameByCodecId(cid RTSP_CODEC_ID) string {
         return "MP2P"
     case RTSP_CODEC_TS:
         return "MP2T"
+    case RTSP_CODEC_AAC_LATM:
+        return "MP4A-LATM"
     default:
         panic("unsupport rtsp codec id")
     }
@@ -281,6 +281,15 @@ func (track *RtspTrack) createUnpacker() rtp.UnPacker {
         } else {
             return rtp.NewAACUnPacker(13, 3, nil)
         }
+    case RTSP_CODEC_AAC_LATM:
+        if latmFmtp, ok := track.paramHandler.(*sdp.LATMFmtpParam); ok {
+            if unpacker, err := rtp.NewLATMUnPacker(latmFmtp.CPresent(), latmFmtp.StreamMuxConfig()); err == nil {
+                return unpacker
+            }
+        }
+        //没有可用的config时只能按照带内StreamMuxConfig处理
+        unpacker, _ := rtp.NewLATMUnPacker(true, nil)
+        return unpacker
     case RTSP_CODEC_G711A, RTSP_CODEC_G711U:
         return rtp.NewG711UnPacker()
     case RTSP_CODEC_TS:
@@ -293,6 +302,8 @@ func (track *RtspTrack) createPacker() rtp.Packer {
     switch track.Codec.Cid {
     case RTSP_CODEC_AAC:
         return rtp.NewAACPacker(track.Codec.PayloadType, track.ssrc, track.initSequence, 1400)
+    case RTSP_CODEC_AAC_LATM:
+        return rtp.NewLATMPacker(track.Codec.PayloadType, track.ssrc, track.initSequence, 1400)
     case RTSP_CODEC_H264:
         return rtp.NewH264Packer(track.Codec.PayloadType, track.ssrc, track.initSequence, 1400)
     case RTSP_CODEC_H265:
@@ -24,6 +24,8 @@ func CreateFmtpParamParser(name string) FmtpCodecParamParser {
         return NewH265FmtpParam()
     case "mpeg4-generic":
         return NewAACFmtpParam()
+    case "mp4a-latm", "mpeg4-latm":
+        return NewLATMFmtpParam()
     }
     return nil
 }
@@ -318,3 +320,84 @@ func (param *AACFmtpParam) Save() string {
 
     return paramstr
 }
+
+// RFC6416
+// m=audio 49230 RTP/AVP 96
+// a=rtpmap:96 MP4A-LATM/44100/2
+// a=fmtp:96 profile-level-id=30;cpresent=0;object=2;config=400024203fc0
+type LATMFmtpParam struct {
+    profileLevelId int
+    object         int
+    bitrate        int
+    cpresent       int
+    config         []byte
+}
+
+type LATMFmtpParamOption func(extra *LATMFmtpParam)
+
+// StreamMuxConfig
+func WithStreamMuxConfig(config []byte) LATMFmtpParamOption {
+    return func(extra *LATMFmtpParam) {
+        extra.config = make([]byte, len(config))
+        copy(extra.config, config)
+    }
+}
+
+func NewLATMFmtpParam(opt ...LATMFmtpParamOption) *LATMFmtpParam {
+    param := &LATMFmtpParam{
+        profileLevelId: 30,
+        object:         2,
+        cpresent:       0,
+    }
+    for _, o := range opt {
+        o(param)
+    }
+    return param
+}
+
+func (param *LATMFmtpParam) CPresent() bool {
+    return param.cpresent == 1
+}
+
+func (param *LATMFmtpParam) StreamMuxConfig() []byte {
+    return param.config
+}
+
+func (param *LATMFmtpParam) Load(fmtp string) {
+    items := strings.SplitN(fmtp, " ", 2)
+    if len(items) < 2 {
+        return
+    }
+    // cpresent缺省值为1
+    param.cpresent = 1
+    codecParams := strings.Split(items[1], ";")
+    for _, p := range codecParams {
+        kv := strings.Split(strings.TrimSpace(p), "=")
+        if len(kv) < 2 {
+            continue
+        }
+        switch strings.ToLower(kv[0]) {
+        case "profile-level-id":
+            param.profileLevelId, _ = strconv.Atoi(kv[1])
+        case "object":
+            param.object, _ = strconv.Atoi(kv[1])
+        case "bitrate":
+            param.bitrate, _ = strconv.Atoi(kv[1])
+        case "cpresent":
+            param.cpresent, _ = strconv.Atoi(kv[1])
+        case "config":
+            param.config, _ = hex.DecodeString(kv[1])
+        }
+    }
+}
+
+func (param *LATMFmtpParam) Save() string {
+    paramstr := fmt.Sprintf("profile-level-id=%d;cpresent=%d;object=%d", param.profileLevelId, param.cpresent, param.object)
+    if param.bitrate > 0 {
+        paramstr += ";bitrate=" + strconv.Itoa(param.bitrate)
+    }
+    if len(param.config) > 0 {
+        paramstr += ";config=" + hex.EncodeToString(param.config)
+    }
+    return paramstr
+}
@@ -1,6 +1,7 @@
 package sdp
 
 import (
+	"encoding/hex"
 	"fmt"
 	"testing"
 )
@@ -31,3 +32,62 @@ func TestParserSdp(t *testing.T) {
 		fmt.Printf("%+v\n", sdp.Medias[1])
 	})
 }
+
+func TestLATMFmtpParam_Load(t *testing.T) {
+	tests := []struct {
+		name     string
+		fmtp     string
+		cpresent bool
+		config   string
+		save     string
+	}{
+		{name: "cpresent=0", fmtp: "96 profile-level-id=30; cpresent=0; object=2; config=400024203fc0",
+			config: "400024203fc0", save: "profile-level-id=30;cpresent=0;object=2;config=400024203fc0"},
+		{name: "default cpresent", fmtp: "96 profile-level-id=15; object=2; bitrate=64000", cpresent: true,
+			save: "profile-level-id=15;cpresent=1;object=2;bitrate=64000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := NewLATMFmtpParam()
+			param.Load(tt.fmtp)
+			if param.CPresent() != tt.cpresent {
+				t.Errorf("CPresent() = %v, want %v", param.CPresent(), tt.cpresent)
+			}
+			if hex.EncodeToString(param.StreamMuxConfig()) != tt.config {
+				t.Errorf("StreamMuxConfig() = %x, want %s", param.StreamMuxConfig(), tt.config)
+			}
+			if param.Save() != tt.save {
+				t.Errorf("Save() = %s, want %s", param.Save(), tt.save)
+			}
+		})
+	}
+}
+
+func TestCreateFmtpParamParser_LATM(t *testing.T) {
+	tests := []struct {
+		name   string
+		rtpmap string
+	}{
+		{name: "mp4a-latm", rtpmap: "MP4A-LATM/44100/2"},
+		{name: "mpeg4-latm", rtpmap: "MPEG4-LATM/44100/2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sdp := &Sdp{}
+			err := sdp.ParserSdp("v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=No Name\r\nt=0 0\r\nm=audio 0 RTP/AVP 96\r\n" +
+				"a=rtpmap:96 " + tt.rtpmap + "\r\na=fmtp:96 profile-level-id=30; cpresent=0; object=2; config=400024203fc0\r\n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			media := sdp.Medias[0]
+			param, ok := CreateFmtpParamParser(media.EncodeName).(*LATMFmtpParam)
+			if !ok {
+				t.Fatalf("CreateFmtpParamParser(%s) is not LATMFmtpParam", media.EncodeName)
+			}
+			param.Load(media.Attrs["fmtp"])
+			if param.CPresent() || hex.EncodeToString(param.StreamMuxConfig()) != "400024203fc0" {
+				t.Errorf("cpresent = %v config = %x", param.CPresent(), param.StreamMuxConfig())
+			}
+		})
+	}
+}